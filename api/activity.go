@@ -0,0 +1,68 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// activityBuckets maps values of ?bucket= of /v1/activity to seconds.
+var activityBuckets = map[string]int{
+	"day":  cache.BUCKET_DAY,
+	"week": cache.BUCKET_WEEK,
+}
+
+type ActivityBucket struct {
+	Start int64 `json:"start"` // Unix time.
+	Items int   `json:"items"`
+}
+
+// handleActivity returns numbers of items of ?address= per ?bucket=
+// (day or week) as JSON, for graphs of wallet history. Buckets are
+// returned by pages with offset cursors (see page.go).
+func (a *api) handleActivity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := r.URL.Query()
+	addressHex := query.Get("address")
+	address, err := cache.ParseAddress(addressHex)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cache.ParseAddress(%q): %v.\n", addressHex, err)
+		return
+	}
+	bucketName := query.Get("bucket")
+	if bucketName == "" {
+		bucketName = "day"
+	}
+	bucket, has := activityBuckets[bucketName]
+	if !has {
+		writeError(w, http.StatusBadRequest, "Bad bucket: %q, want day or week.\n", bucketName)
+		return
+	}
+	p, ok := parsePage(w, r, MAX_ACTIVITY_BUCKETS)
+	if !ok {
+		return
+	}
+	t := a.snapshot(w, r)
+	if a.checkETag(w, r, t.BuildID(), false) {
+		return
+	}
+	buckets, err := t.AddressActivity(address[:], bucket)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "AddressActivity: %v.\n", err)
+		log.Printf("AddressActivity: %v.\n", err)
+		return
+	}
+	start, end, ok := p.offsetPage(w, len(buckets))
+	if !ok {
+		return
+	}
+	resp := make([]ActivityBucket, 0, end-start)
+	for _, b := range buckets[start:end] {
+		resp = append(resp, ActivityBucket{
+			Start: int64(b.Start),
+			Items: b.Items,
+		})
+	}
+	writeJSON(w, r, resp)
+}
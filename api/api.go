@@ -0,0 +1,526 @@
+// Package api implements HTTP API on top of cache.Server.
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/mempool"
+	"github.com/starius/sialite/webhook"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Options struct {
+	// MaxConcurrentRequests limits the number of requests handled
+	// at the same time. Excess requests get 503. 0 means no limit.
+	MaxConcurrentRequests int
+
+	// ShutdownTimeout is how long Serve waits for active requests
+	// to finish after ctx is canceled.
+	ShutdownTimeout time.Duration
+
+	// Mempool, if not nil, is served at /v1/mempool. Transactions of
+	// blocks received from Updates are removed from it.
+	Mempool *mempool.Mempool
+
+	// Replication enables /v1/replication/* used by followers.
+	Replication bool
+
+	// Updates, if not nil, provides new versions of the index.
+	// The old version is retired (see cache.Server.Retire): it is
+	// closed when the last request using it is done. Do not use it
+	// after sending a new version without pinning it with Acquire.
+	// When Serve returns, the current version is retired as well, so
+	// the caller does not close the index passed to Serve.
+	Updates <-chan *cache.Server
+
+	// CacheHeaders enables ETag and Cache-Control headers, so responses
+	// can be cached by browsers and CDNs. ETags are derived from the
+	// build ID of the index (see cache.Server.BuildID).
+	CacheHeaders bool
+
+	// Webhooks, if not nil, are notified when the index is updated.
+	// They are managed at /v1/webhooks if Keys are set or the hosts of
+	// URLs are restricted (see webhook.Manager.SetAllowedHosts), since
+	// the server sends requests to registered URLs.
+	Webhooks *webhook.Manager
+
+	// PrefetchHistory makes history requests prefetch items of the
+	// next page (see cache.Server.SetPrefetchHistory).
+	PrefetchHistory bool
+
+	// VerifyAddresses makes history requests skip items of other
+	// addresses sharing the prefix with the queried address (see
+	// cache.Server.SetVerifyAddresses). Otherwise such items are
+	// returned with Verified unset.
+	VerifyAddresses bool
+
+	// Tip, if not nil, provides recent blocks which are not in the
+	// index yet. They are included in history responses, which use
+	// the index of Tip. New versions of the index created by Tip.Merge
+	// should be sent to Updates for other requests.
+	Tip *cache.Tip
+
+	// Keys, if not nil, are required to make requests (see LoadKeys).
+	Keys *Keys
+
+	// RateLimit limits requests per second of each client address.
+	// RateBurst is the number of requests which can be made at once.
+	// 0 means no limit.
+	RateLimit float64
+	RateBurst int
+
+	// TrustedProxies are addresses of reverse proxies. Client address
+	// of their requests is taken from X-Forwarded-For.
+	TrustedProxies []*net.IPNet
+
+	// TLSConfig, if not nil, makes Serve serve HTTPS.
+	TLSConfig *tls.Config
+
+	// SyncCheck, if not nil, makes /readyz fail if the index is behind
+	// the network or diverged from it. The state of peers is served at
+	// /v1/sync. /healthz and /readyz do not require Keys.
+	SyncCheck *SyncCheck
+
+	// Compress enables compression of responses with gzip or other
+	// codings added by RegisterEncoding, negotiated by Accept-Encoding.
+	Compress bool
+
+	// HugePages advises the kernel to back randomly accessed files of
+	// the index with transparent huge pages (see
+	// cache.Server.AdviseHugePages). Failures are logged.
+	HugePages bool
+
+	// MaxProofLeaves, if not 0, makes item responses skip proofs of
+	// items of blocks with more leaves (see
+	// cache.Server.SetMaxProofLeaves). Such proofs are built by
+	// ProofWorkers goroutines (default 1) and served at /v1/proof.
+	MaxProofLeaves int
+	ProofWorkers   int
+
+	// NoAddressLookups disables endpoints looking up addresses or
+	// public keys (history, balance, audit, activity, webhooks), so the
+	// server does not help to surveil the chain. Light clients use
+	// /v1/filters, served in any mode, to find their blocks locally and
+	// request items by block and index.
+	NoAddressLookups bool
+
+	// Labels, if not nil, are added to responses about addresses and
+	// served at /v1/labels (see LoadLabels).
+	Labels *Labels
+
+	// MemoryBudget, if not 0, is the max memory of the process in bytes,
+	// e.g. the memory limit of its container. Results of async proofs
+	// and the mempool can take 1/8 of it each; the oldest entries are
+	// evicted. When the resident memory exceeds the budget, pages of
+	// the index are released (see cache.Server.ReleasePages). The use
+	// of the budget is served at /v1/memory.
+	MemoryBudget int64
+
+	// TracerProvider, if not nil, makes spans of requests and of the
+	// subsystems of cache serving them (see tracing.go). MeterProvider,
+	// if not nil, gets the durations of requests with exemplars.
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+}
+
+type api struct {
+	mu      sync.RWMutex
+	s       *cache.Server
+	mempool *mempool.Mempool
+
+	cacheHeaders    bool
+	webhooks        *webhook.Manager
+	prefetchHistory bool
+	verifyAddresses bool
+	hugePages       bool
+	maxProofLeaves  int
+	proofs          *proofJobs
+	tip             *cache.Tip
+	labels          *Labels
+	memory          *memoryState // nil if there is no MemoryBudget.
+
+	syncCheck *SyncCheck
+	syncMu    sync.Mutex
+	sync      *syncState
+
+	indexStatsMu      sync.Mutex
+	indexStats        *IndexStatsResponse
+	indexStatsBuildID string
+
+	// stopped is set by stop. Versions received from Updates after it
+	// are retired at once.
+	stopped bool
+
+	// queries serves queries of /v1/batch: the routes behind API keys.
+	queries http.Handler
+}
+
+// pinnedKey is the key of the indices pinned for the request in its
+// context (see pinIndices).
+type pinnedKey struct{}
+
+// acquire pins the current indices (see cache.Server.Acquire): the base
+// and the index of Tip or the last version received from Updates. The
+// result must be released with Release. It returns nil if there is no
+// index.
+func (a *api) acquire() *cache.Tiered {
+	if a.tip != nil {
+		// The index of Tip is used instead of a.s, since they are
+		// updated together by Tip.Merge.
+		return a.tip.AcquireTiered()
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.s == nil {
+		return nil
+	}
+	// a.s is retired after it is replaced under a.mu, so it is open.
+	a.s.Acquire()
+	return &cache.Tiered{Cold: a.s}
+}
+
+// pinIndices pins the indices for the request until the response is
+// written. Replaced versions of the index are retired and closed when
+// the last request using them is done, since items of responses point
+// to the mmaped files.
+func (a *api) pinIndices(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t := a.acquire(); t != nil {
+			defer func() {
+				if err := t.Release(); err != nil {
+					log.Printf("Closing the old index: %v.", err)
+				}
+			}()
+			r = r.WithContext(context.WithValue(r.Context(), pinnedKey{}, t))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// tiered returns the index and the index of the tip on top of it pinned
+// for the request or nil if there is no index.
+func (a *api) tiered(r *http.Request) *cache.Tiered {
+	t, _ := r.Context().Value(pinnedKey{}).(*cache.Tiered)
+	return t
+}
+
+// server returns the index pinned for the request or nil.
+func (a *api) server(r *http.Request) *cache.Server {
+	if t := a.tiered(r); t != nil {
+		return t.Cold
+	}
+	return nil
+}
+
+// snapshot returns tiered(r) and marks the response with the height of
+// its last block. While Tip adds or merges blocks, the previous indices
+// are served and the response is marked as stale, so clients can tell
+// it from an answer of the updated index.
+func (a *api) snapshot(w http.ResponseWriter, r *http.Request) *cache.Tiered {
+	t := a.tiered(r)
+	w.Header().Set("X-Sialite-Snapshot-Height", strconv.Itoa(t.TipHeight()))
+	if a.tip != nil && a.tip.Updating() {
+		w.Header().Set("X-Sialite-Stale", "1")
+	}
+	return t
+}
+
+// prepare applies the options to a new version of the index.
+func (a *api) prepare(s *cache.Server) {
+	s.SetPrefetchHistory(a.prefetchHistory)
+	s.SetVerifyAddresses(a.verifyAddresses)
+	s.SetMaxProofLeaves(a.maxProofLeaves)
+	if a.hugePages {
+		if err := s.AdviseHugePages(); err != nil {
+			log.Printf("AdviseHugePages: %v.", err)
+		}
+	}
+}
+
+func (a *api) receiveUpdates(updates <-chan *cache.Server) {
+	for s := range updates {
+		a.prepare(s)
+		a.mu.Lock()
+		if a.stopped {
+			a.mu.Unlock()
+			if err := s.Retire(); err != nil {
+				log.Printf("Closing the new index: %v.", err)
+			}
+			continue
+		}
+		old := a.s
+		a.s = s
+		a.mu.Unlock()
+		if a.mempool != nil && old != s {
+			removeConfirmed(a.mempool, old, s)
+		}
+		if old != nil && old != s {
+			// Requests still using it have pinned it.
+			if err := old.Retire(); err != nil {
+				log.Printf("Closing the old index: %v.", err)
+			}
+		}
+		if a.webhooks != nil {
+			a.webhooks.Updated(s)
+		}
+	}
+}
+
+// stop retires the current version of the index received from Updates,
+// which the API owns, when the API is no longer served.
+func (a *api) stop() {
+	a.mu.Lock()
+	s := a.s
+	a.s = nil
+	a.stopped = true
+	a.mu.Unlock()
+	if s != nil {
+		if err := s.Retire(); err != nil {
+			log.Printf("Closing the index: %v.", err)
+		}
+	}
+}
+
+// NewHandler returns http.Handler serving the API of s.
+func NewHandler(s *cache.Server, opts Options) http.Handler {
+	_, handler := newHandler(s, opts)
+	return handler
+}
+
+// newAPI returns the state of the API of s without starting its
+// goroutines.
+func newAPI(s *cache.Server, opts Options) *api {
+	webhooks := opts.Webhooks
+	if opts.NoAddressLookups {
+		// Webhooks watch addresses.
+		webhooks = nil
+	}
+	var memory *memoryState
+	if opts.MemoryBudget != 0 {
+		memory = &memoryState{budget: opts.MemoryBudget}
+	}
+	return &api{
+		s:               s,
+		mempool:         opts.Mempool,
+		cacheHeaders:    opts.CacheHeaders,
+		webhooks:        webhooks,
+		prefetchHistory: opts.PrefetchHistory,
+		verifyAddresses: opts.VerifyAddresses,
+		hugePages:       opts.HugePages,
+		maxProofLeaves:  opts.MaxProofLeaves,
+		tip:             opts.Tip,
+		labels:          opts.Labels,
+		memory:          memory,
+		syncCheck:       opts.SyncCheck,
+	}
+}
+
+func newHandler(s *cache.Server, opts Options) (*api, http.Handler) {
+	a := newAPI(s, opts)
+	a.prepare(s)
+	if opts.MaxProofLeaves != 0 {
+		a.proofs = newProofJobs(opts.ProofWorkers)
+	}
+	if a.memory != nil {
+		a.limitCaches()
+		go a.enforceMemoryBudget()
+	}
+	router := httprouter.New()
+	routes := a.routes(opts)
+	tr := newTracing(opts)
+	for _, rt := range routes {
+		handle := rt.handle
+		if tr != nil {
+			handle = tr.handle(rt)
+		}
+		router.Handle(rt.method, rt.path, handle)
+	}
+	doc, err := openAPIDocument(routes)
+	if err != nil {
+		log.Printf("openAPIDocument: %v.", err)
+	} else {
+		router.GET("/v1/openapi.json", handleOpenAPI(doc))
+	}
+	if a.webhooks != nil {
+		a.webhooks.Updated(s)
+	}
+	if opts.Updates != nil {
+		go a.receiveUpdates(opts.Updates)
+	}
+	if opts.SyncCheck != nil {
+		go a.checkSync(opts.SyncCheck)
+	}
+	var handler http.Handler = router
+	if opts.Keys != nil {
+		handler = requireKeys(router, opts.Keys)
+	}
+	a.queries = handler
+	var root http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			a.handleHealthz(w, r)
+		case "/readyz":
+			a.handleReadyz(w, r)
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	})
+	root = a.pinIndices(root)
+	root = recoverFaults(root)
+	if opts.Compress {
+		root = compressResponses(root)
+	}
+	return a, root
+}
+
+func limitConcurrency(handler http.Handler, limit int) http.Handler {
+	if limit <= 0 {
+		return handler
+	}
+	sem := make(chan struct{}, limit)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "Too many concurrent requests.\n")
+			return
+		}
+		defer func() { <-sem }()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Serve serves the API of s on listener until ctx is canceled.
+// Then it stops accepting new connections and waits for active
+// requests to finish (at most opts.ShutdownTimeout).
+func Serve(ctx context.Context, listener net.Listener, s *cache.Server, opts Options) error {
+	return ServeListeners(ctx, []net.Listener{listener}, s, opts)
+}
+
+// ServeListeners is like Serve but serves on several listeners.
+// It returns when any of them fails.
+func ServeListeners(ctx context.Context, listeners []net.Listener, s *cache.Server, opts Options) error {
+	a, handler := newHandler(s, opts)
+	err := serveHandler(ctx, listeners, handler, opts)
+	if opts.Updates != nil {
+		a.stop()
+	}
+	return err
+}
+
+// serveHandler serves the handler on listeners until ctx is canceled,
+// applying the options of the HTTP layer.
+func serveHandler(ctx context.Context, listeners []net.Listener, handler http.Handler, opts Options) error {
+	handler = limitConcurrency(handler, opts.MaxConcurrentRequests)
+	srv := &http.Server{
+		Handler:   limitRate(handler, opts.RateLimit, opts.RateBurst, opts.TrustedProxies),
+		TLSConfig: opts.TLSConfig,
+	}
+	errc := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		if opts.TLSConfig != nil {
+			listener = tls.NewListener(listener, opts.TLSConfig)
+		}
+		go func(listener net.Listener) {
+			errc <- srv.Serve(listener)
+		}(listener)
+	}
+	select {
+	case err := <-errc:
+		srv.Close()
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx := context.Background()
+	if opts.ShutdownTimeout != 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, opts.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("srv.Shutdown: %v", err)
+	}
+	for range listeners {
+		if err := <-errc; err != http.ErrServerClosed {
+			return err
+		}
+	}
+	return nil
+}
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+// SystemdListener returns the listener passed by systemd socket
+// activation or nil if the process was not socket activated.
+func SystemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds == 0 {
+		return nil, nil
+	}
+	if nfds != 1 {
+		return nil, fmt.Errorf("want 1 socket from systemd, got %d", nfds)
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	f := os.NewFile(listenFdsStart, "LISTEN_FD_3")
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("net.FileListener: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Listen returns the listener passed by systemd or listens on addr.
+func Listen(addr string) (net.Listener, error) {
+	listener, err := SystemdListener()
+	if err != nil || listener != nil {
+		return listener, err
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ListenAll returns the listener passed by systemd or listens on each
+// of comma-separated addresses.
+func ListenAll(addrs string) ([]net.Listener, error) {
+	listener, err := SystemdListener()
+	if err != nil {
+		return nil, err
+	}
+	if listener != nil {
+		return []net.Listener{listener}, nil
+	}
+	var listeners []net.Listener
+	for _, addr := range strings.Split(addrs, ",") {
+		listener, err := net.Listen("tcp", strings.TrimSpace(addr))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
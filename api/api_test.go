@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/cache/cachetest"
+)
+
+func TestServeRetiresCurrentIndex(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	s1 := cachetest.BuildServer(t, cachetest.Parameters(), blocks[:500])
+	s2 := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	updates := make(chan *cache.Server)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Serve(ctx, listener, s1, Options{Updates: updates})
+	}()
+	updates <- s2
+	// Wait until the API serves s2.
+	url := "http://" + listener.Addr().String() + "/v1/limits"
+	for {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET /v1/limits: %v", err)
+		}
+		var limits LimitsResponse
+		err = json.NewDecoder(resp.Body).Decode(&limits)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("decoding /v1/limits: %v", err)
+		}
+		if limits.TipHeight == s2.TipHeight() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	// Both versions are retired and closed: s1 when it was replaced and
+	// s2 when Serve returned.
+	if s1.Acquire() {
+		t.Errorf("the replaced index is open")
+	}
+	if s2.Acquire() {
+		t.Errorf("the current index is open after Serve returned")
+	}
+}
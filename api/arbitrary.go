@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/hex"
+	"log"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// ArbitraryDataResult is a transaction with matching ArbitraryData.
+type ArbitraryDataResult struct {
+	ID            string `json:"id"`
+	Block         int    `json:"block"`
+	TxID          string `json:"txid"`
+	Confirmations int    `json:"confirmations"`
+	// Data are hex encoded entries of ArbitraryData of the transaction.
+	Data []string `json:"data"`
+}
+
+// handleArbitraryData returns transactions having an entry of
+// ArbitraryData starting with ?prefix= (hex) or ?text= as JSON list of
+// ArbitraryDataResult, by pages (see page.go).
+func (a *api) handleArbitraryData(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	query := r.URL.Query()
+	prefix := []byte(query.Get("text"))
+	if prefixHex := query.Get("prefix"); prefixHex != "" {
+		var err error
+		if prefix, err = hex.DecodeString(prefixHex); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad prefix: %q.\n", prefixHex)
+			return
+		}
+	}
+	if len(prefix) == 0 {
+		writeError(w, http.StatusBadRequest, "Specify prefix or text.\n")
+		return
+	}
+	p, ok := parsePage(w, r, cache.MAX_HISTORY_SIZE)
+	if !ok {
+		return
+	}
+	if a.checkETag(w, r, t.BuildID(), false) {
+		return
+	}
+	page, err := t.SearchArbitraryDataPage(prefix, p.cursor, p.limit)
+	if err != nil {
+		writeItemPageError(w, "SearchArbitraryDataPage", err)
+		return
+	}
+	items := page.Items
+	results := []ArbitraryDataResult{}
+	for _, item := range items {
+		_, tx, err := cache.DecodeItem(item)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "cache.DecodeItem: %v.\n", err)
+			log.Printf("cache.DecodeItem: %v.\n", err)
+			return
+		}
+		result := ArbitraryDataResult{
+			ID:            item.ID,
+			Block:         item.Block,
+			TxID:          tx.ID().String(),
+			Confirmations: item.Confirmations,
+		}
+		for _, data := range tx.ArbitraryData {
+			result.Data = append(result.Data, hex.EncodeToString(data))
+		}
+		results = append(results, result)
+	}
+	setPageHeaders(w, page.Next, page.Total)
+	writeJSON(w, r, results)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// MaxAuditAddresses is the max number of addresses in /v1/audit.
+const MaxAuditAddresses = 100
+
+// handleAudit returns Sia-encoded cache.Audit of the addresses
+// (?address=...&address=...) at the height (?height=...).
+func (a *api) handleAudit(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := r.URL.Query()
+	heightStr := query.Get("height")
+	height, err := strconv.Atoi(heightStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad height: %q.\n", heightStr)
+		return
+	}
+	addressesHex := query["address"]
+	if len(addressesHex) == 0 || len(addressesHex) > MaxAuditAddresses {
+		writeError(w, http.StatusBadRequest, "Want from 1 to %d addresses, got %d.\n", MaxAuditAddresses, len(addressesHex))
+		return
+	}
+	addresses := make([]types.UnlockHash, 0, len(addressesHex))
+	for _, addressHex := range addressesHex {
+		address, err := cache.ParseAddress(addressHex)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "cache.ParseAddress(%q): %v.\n", addressHex, err)
+			return
+		}
+		addresses = append(addresses, address)
+	}
+	s := a.server(r)
+	if err := s.CheckHeight(height); err != nil {
+		writeNotYetIndexed(w, s.TipHeight())
+		return
+	}
+	if a.checkETag(w, r, s.BuildID(), isFinal(height, s.TipHeight()+1)) {
+		return
+	}
+	audit, err := s.Audit(addresses, height)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Audit: %v.\n", err)
+		log.Printf("Audit: %v.\n", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := encoding.NewEncoder(&buf).Encode(audit); err != nil {
+		writeError(w, http.StatusInternalServerError, "Encode: %v.\n", err)
+		log.Printf("Encode: %v.\n", err)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+type Balance struct {
+	Address  string       `json:"address"`
+	Label    string       `json:"label,omitempty"`
+	Height   int          `json:"height"`
+	Siacoins cache.Amount `json:"siacoins"`
+	Siafunds string       `json:"siafunds"`
+
+	// Parts of the balance which can not be spent by the next block
+	// (immature miner payouts and timelocked outputs), and the height
+	// from which the whole balance is spendable.
+	LockedSiacoins cache.Amount `json:"locked_siacoins"`
+	LockedSiafunds string       `json:"locked_siafunds"`
+	UnlockHeight   int          `json:"unlock_height"`
+}
+
+// handleBalance returns the balance of ?address= as of ?height=
+// (the last block if height is not set).
+func (a *api) handleBalance(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s := a.server(r)
+	query := r.URL.Query()
+	addressHex := query.Get("address")
+	address, err := cache.ParseAddress(addressHex)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cache.ParseAddress(%q): %v.\n", addressHex, err)
+		return
+	}
+	height := s.TipHeight()
+	if heightStr := query.Get("height"); heightStr != "" {
+		height, err = strconv.Atoi(heightStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Bad height: %q.\n", heightStr)
+			return
+		}
+		if err := s.CheckHeight(height); err != nil {
+			writeNotYetIndexed(w, s.TipHeight())
+			return
+		}
+	}
+	buildID, immutable := a.withLabels(s.BuildID(), isFinal(height, s.TipHeight()+1))
+	if a.checkETag(w, r, buildID, immutable) {
+		return
+	}
+	balance, err := s.GetBalanceDetailsAt(address, height)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "GetBalanceDetailsAt: %v.\n", err)
+		log.Printf("GetBalanceDetailsAt: %v.\n", err)
+		return
+	}
+	sc := query.Get("sc") != ""
+	writeJSON(w, r, Balance{
+		Address:  cache.FormatAddress(address),
+		Label:    a.label(address),
+		Height:   height,
+		Siacoins: cache.NewAmount(balance.Siacoins, sc),
+		Siafunds: cache.FormatHastings(balance.Siafunds),
+
+		LockedSiacoins: cache.NewAmount(balance.LockedSiacoins, sc),
+		LockedSiafunds: cache.FormatHastings(balance.LockedSiafunds),
+		UnlockHeight:   balance.UnlockHeight,
+	})
+}
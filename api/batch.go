@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// MAX_BATCH_SIZE is the max number of queries of /v1/batch.
+const MAX_BATCH_SIZE = 100
+
+// maxBatchConcurrency is the max number of queries of a batch answered
+// at the same time.
+const maxBatchConcurrency = 8
+
+const maxBatchRequest = 1024 * 1024
+
+// BatchQuery is a query of /v1/batch: a GET request of the API, e.g.
+// "/v1/item?id=1000:t:0". ID is copied to the answer.
+type BatchQuery struct {
+	ID   string `json:"id,omitempty"`
+	Path string `json:"path"`
+}
+
+// BatchAnswer is the response to BatchQuery. JSON responses are put in
+// Body, other successful responses (e.g. Sia-encoded /v1/history) in
+// Data (base64), and messages of errors in Error with the whole error
+// response in ErrorInfo.
+type BatchAnswer struct {
+	ID        string          `json:"id,omitempty"`
+	Status    int             `json:"status"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Data      []byte          `json:"data,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorInfo *ErrorResponse  `json:"error_info,omitempty"`
+}
+
+// batchWriter records the response to a query.
+type batchWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (bw *batchWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *batchWriter) WriteHeader(code int) {
+	if bw.status == 0 {
+		bw.status = code
+	}
+}
+
+func (bw *batchWriter) Write(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.buf.Write(b)
+}
+
+// serveQuery serves a query of /v1/batch as a separate request: it takes
+// a token from the rate limit of the client and is checked against the
+// limits of the API key, including its quota of addresses.
+func (a *api) serveQuery(w http.ResponseWriter, r *http.Request) {
+	if !takeRate(r) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "Rate limit exceeded.\n")
+		return
+	}
+	a.queries.ServeHTTP(w, r)
+}
+
+// handleBatch answers a JSON list of BatchQuery with a list of
+// BatchAnswer in the same order. Queries are answered concurrently by
+// handler, as if they were separate requests with the API key of the
+// batch.
+func handleBatch(handler http.Handler) httprouter.Handle {
+	handler = recoverFaults(handler)
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		var queries []BatchQuery
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchRequest)).Decode(&queries); err != nil {
+			writeError(w, http.StatusBadRequest, "Bad request: %v.\n", err)
+			return
+		}
+		if len(queries) > MAX_BATCH_SIZE {
+			writeError(w, http.StatusBadRequest, "Too many queries: %d, max %d.\n", len(queries), MAX_BATCH_SIZE)
+			return
+		}
+		requests := make([]*http.Request, len(queries))
+		for i, q := range queries {
+			if !strings.HasPrefix(q.Path, "/v1/") || strings.HasPrefix(q.Path, "/v1/batch") {
+				writeError(w, http.StatusBadRequest, "Bad path of query %d: %q.\n", i, q.Path)
+				return
+			}
+			req, err := http.NewRequest(http.MethodGet, q.Path, nil)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Bad path of query %d: %v.\n", i, err)
+				return
+			}
+			req = req.WithContext(r.Context())
+			req.RemoteAddr = r.RemoteAddr
+			for _, name := range []string{"X-Sialite-Key", "Authorization"} {
+				if value := r.Header.Get(name); value != "" {
+					req.Header.Set(name, value)
+				}
+			}
+			requests[i] = req
+		}
+		answers := make([]BatchAnswer, len(queries))
+		sem := make(chan struct{}, maxBatchConcurrency)
+		var wg sync.WaitGroup
+		for i := range queries {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				bw := &batchWriter{header: make(http.Header)}
+				handler.ServeHTTP(bw, requests[i])
+				answers[i] = newBatchAnswer(queries[i].ID, bw)
+			}(i)
+		}
+		wg.Wait()
+		writeJSON(w, r, answers)
+	}
+}
+
+func newBatchAnswer(id string, bw *batchWriter) BatchAnswer {
+	answer := BatchAnswer{
+		ID:     id,
+		Status: bw.status,
+	}
+	if answer.Status == 0 {
+		answer.Status = http.StatusOK
+	}
+	body := bw.buf.Bytes()
+	switch {
+	case answer.Status != http.StatusOK:
+		var info ErrorResponse
+		if err := json.Unmarshal(body, &info); err == nil && info.Code != "" {
+			answer.Error = info.Message
+			answer.ErrorInfo = &info
+		} else {
+			answer.Error = strings.TrimSpace(string(body))
+		}
+	case strings.HasPrefix(bw.header.Get("Content-Type"), "application/json"):
+		answer.Body = json.RawMessage(bytes.TrimSpace(body))
+	default:
+		answer.Data = body
+	}
+	return answer
+}
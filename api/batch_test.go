@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/starius/sialite/cache/cachetest"
+)
+
+func TestBatchQuota(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	addresses, err := cachetest.ReadAddresses()
+	if err != nil {
+		t.Fatalf("cachetest.ReadAddresses: %v", err)
+	}
+	s := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	dir, err := ioutil.TempDir("", "TestBatchQuota")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	keysFile := filepath.Join(dir, "keys.json")
+	if err := ioutil.WriteFile(keysFile, []byte(`[{"key": "secret", "name": "alice", "max_addresses": 2}]`), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	keys, err := LoadKeys(keysFile)
+	if err != nil {
+		t.Fatalf("LoadKeys: %v", err)
+	}
+	handler := NewHandler(s, Options{Keys: keys})
+
+	var queries []BatchQuery
+	for _, address := range addresses[:3] {
+		queries = append(queries, BatchQuery{ID: address, Path: "/v1/balance?address=" + address})
+	}
+	body, err := json.Marshal(queries)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	req := httptest.NewRequest("POST", "/v1/batch", bytes.NewReader(body))
+	req.Header.Set("X-Sialite-Key", "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /v1/batch: status %d: %s", rec.Code, rec.Body)
+	}
+	var answers []BatchAnswer
+	if err := json.Unmarshal(rec.Body.Bytes(), &answers); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(answers) != len(queries) {
+		t.Fatalf("got %d answers, want %d", len(answers), len(queries))
+	}
+	// The queries are answered concurrently, so any of them can be the
+	// one exceeding the quota.
+	ok, forbidden := 0, 0
+	for _, answer := range answers {
+		switch answer.Status {
+		case http.StatusOK:
+			ok++
+		case http.StatusForbidden:
+			forbidden++
+		default:
+			t.Errorf("query %s: status %d: %s", answer.ID, answer.Status, answer.Error)
+		}
+	}
+	if ok != 2 || forbidden != 1 {
+		t.Errorf("got %d answers 200 and %d answers 403, want 2 and 1", ok, forbidden)
+	}
+
+	// Addresses of the batch are counted in the quota of the key.
+	req = httptest.NewRequest("GET", "/v1/balance?address="+addresses[3], nil)
+	req.Header.Set("X-Sialite-Key", "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET /v1/balance after the batch: status %d, want 403", rec.Code)
+	}
+}
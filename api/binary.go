@@ -0,0 +1,45 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/encoding"
+)
+
+// SIA_ENCODING_TYPE is the media type of Sia-encoded responses. Light
+// clients put it into Accept to get items and proofs without JSON,
+// which inflates binary data by hex or base64. Endpoints returning
+// Sia-encoded data anyway (e.g. /v1/history) ignore it.
+const SIA_ENCODING_TYPE = "application/x-sia-encoding"
+
+// negotiate returns if the response should be Sia-encoded and the
+// build ID for checkETag distinguishing the representations.
+func negotiate(w http.ResponseWriter, r *http.Request, buildID string) (string, bool) {
+	w.Header().Add("Vary", "Accept")
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == SIA_ENCODING_TYPE {
+			return buildID + "-sia", true
+		}
+	}
+	return buildID, false
+}
+
+// writeSiaEncoded writes the objects Sia-encoded one after another.
+func writeSiaEncoded(w http.ResponseWriter, status int, objects ...interface{}) {
+	var buf bytes.Buffer
+	if err := encoding.NewEncoder(&buf).EncodeAll(objects...); err != nil {
+		writeError(w, http.StatusInternalServerError, "Encode: %v.\n", err)
+		log.Printf("Encode: %v.\n", err)
+		return
+	}
+	w.Header().Set("Content-Type", SIA_ENCODING_TYPE)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
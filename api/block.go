@@ -0,0 +1,92 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// BlockResponse is the header of a block found by its ID.
+type BlockResponse struct {
+	ID         string `json:"id"`
+	Height     int    `json:"height"`
+	Timestamp  int64  `json:"timestamp"`
+	MerkleRoot string `json:"merkle_root"`
+
+	// Items are filled if ?items= is set.
+	Items []BlockItemJSON `json:"items,omitempty"`
+}
+
+// BlockItemJSON describes an item of the block without decoding it.
+type BlockItemJSON struct {
+	ID   string       `json:"id"`
+	Size int          `json:"size"`
+	Fee  cache.Amount `json:"fee"`
+}
+
+// handleBlock returns the header of the block with ID :id as JSON.
+// If ?items= is set, sizes and fees of items of the block are listed
+// by pages with offset cursors (see page.go).
+func (a *api) handleBlock(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	idhex := ps.ByName("id")
+	var idhash crypto.Hash
+	if err := idhash.LoadString(idhex); err != nil {
+		writeError(w, http.StatusBadRequest, "id.LoadString: %v.\n", err)
+		return
+	}
+	id := types.BlockID(idhash)
+	blockIndex, err := t.BlockIndexByID(id)
+	if err == cache.ErrNoBlock {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "BlockIndexByID: %v.\n", err)
+		log.Printf("BlockIndexByID: %v.\n", err)
+		return
+	}
+	if a.checkETag(w, r, t.BuildID(), isFinal(blockIndex, t.NumBlocks())) {
+		return
+	}
+	header, err := t.GetBlockHeader(blockIndex)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "GetBlockHeader: %v.\n", err)
+		log.Printf("GetBlockHeader: %v.\n", err)
+		return
+	}
+	resp := BlockResponse{
+		ID:         id.String(),
+		Height:     t.StartHeight() + blockIndex,
+		Timestamp:  int64(header.Timestamp),
+		MerkleRoot: header.MerkleRoot.String(),
+	}
+	if r.URL.Query().Get("items") != "" {
+		p, ok := parsePage(w, r, MAX_BLOCK_ITEMS)
+		if !ok {
+			return
+		}
+		infos, err := t.BlockItemInfos(blockIndex)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "BlockItemInfos: %v.\n", err)
+			log.Printf("BlockItemInfos: %v.\n", err)
+			return
+		}
+		start, end, ok := p.offsetPage(w, len(infos))
+		if !ok {
+			return
+		}
+		withSC := r.URL.Query().Get("sc") != ""
+		for _, info := range infos[start:end] {
+			resp.Items = append(resp.Items, BlockItemJSON{
+				ID:   info.ID,
+				Size: info.Size,
+				Fee:  cache.NewAmount(info.Fee, withSC),
+			})
+		}
+	}
+	writeJSON(w, r, resp)
+}
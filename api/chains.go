@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/starius/sialite/cache"
+)
+
+// Chain is an index served under a route prefix by NewChainsHandler,
+// e.g. mainnet at "" and testnet at "/testnet". Each chain has its own
+// Options, e.g. Updates fed by its own follower. Options of the HTTP
+// layer (MaxConcurrentRequests, ShutdownTimeout, RateLimit, RateBurst,
+// TrustedProxies and TLSConfig) are taken from ServeChains and shared.
+type Chain struct {
+	// Prefix starts with "/" and does not end with "/". Empty prefix
+	// serves the chain at the root.
+	Prefix  string
+	Server  *cache.Server
+	Options Options
+}
+
+// ChainResponse describes a chain in /v1/chains.
+type ChainResponse struct {
+	Prefix      string `json:"prefix"`
+	StartHeight int    `json:"start_height"`
+	Blocks      int    `json:"blocks"`
+	BuildID     string `json:"build_id"`
+}
+
+type chainsAPI struct {
+	prefixes []string
+	apis     map[string]*api
+}
+
+// NewChainsHandler returns http.Handler serving the APIs of chains under
+// their prefixes. The list of chains is served at /v1/chains.
+func NewChainsHandler(chains []Chain) (http.Handler, error) {
+	_, handler, err := newChainsHandler(chains)
+	return handler, err
+}
+
+func newChainsHandler(chains []Chain) (*chainsAPI, http.Handler, error) {
+	c := &chainsAPI{
+		apis: make(map[string]*api),
+	}
+	mux := http.NewServeMux()
+	for _, chain := range chains {
+		prefix := chain.Prefix
+		if prefix != "" && (!strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/")) {
+			return nil, nil, fmt.Errorf("bad prefix of chain: %q", prefix)
+		}
+		if _, has := c.apis[prefix]; has {
+			return nil, nil, fmt.Errorf("duplicate prefix of chain: %q", prefix)
+		}
+		a, handler := newHandler(chain.Server, chain.Options)
+		c.apis[prefix] = a
+		c.prefixes = append(c.prefixes, prefix)
+		if prefix == "" {
+			mux.Handle("/", handler)
+		} else {
+			mux.Handle(prefix+"/", http.StripPrefix(prefix, handler))
+		}
+	}
+	sort.Strings(c.prefixes)
+	mux.HandleFunc("/v1/chains", c.handleChains)
+	return c, mux, nil
+}
+
+func (c *chainsAPI) handleChains(w http.ResponseWriter, r *http.Request) {
+	resp := make([]ChainResponse, 0, len(c.prefixes))
+	for _, prefix := range c.prefixes {
+		t := c.apis[prefix].acquire()
+		resp = append(resp, ChainResponse{
+			Prefix:      prefix,
+			StartHeight: t.Cold.StartHeight(),
+			Blocks:      t.Cold.NumBlocks(),
+			BuildID:     t.Cold.BuildID(),
+		})
+		t.Release()
+	}
+	writeJSON(w, r, resp)
+}
+
+// ServeChains is like ServeListeners but serves several chains (see
+// NewChainsHandler). Like ServeListeners, it retires the current index
+// of each chain with Updates when it returns.
+func ServeChains(ctx context.Context, listeners []net.Listener, chains []Chain, opts Options) error {
+	c, handler, err := newChainsHandler(chains)
+	if err != nil {
+		return err
+	}
+	err = serveHandler(ctx, listeners, handler, opts)
+	for _, chain := range chains {
+		if chain.Options.Updates != nil {
+			c.apis[chain.Prefix].stop()
+		}
+	}
+	return err
+}
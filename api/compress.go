@@ -0,0 +1,159 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the min size of responses with known length
+// which are compressed.
+const minCompressSize = 1024
+
+// Encoding is a content coding of responses (see Options.Compress).
+type Encoding struct {
+	// Name is the token of Accept-Encoding and Content-Encoding.
+	Name string
+
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	encodingsMu sync.RWMutex
+	// encodings are in the order of preference of the server.
+	encodings = []Encoding{
+		{
+			Name: "gzip",
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriterLevel(w, gzip.BestSpeed)
+			},
+		},
+	}
+)
+
+// RegisterEncoding adds the content coding, preferred over the ones
+// registered before. gzip is built in; other codings, e.g. zstd, are
+// registered by binaries which link their implementations.
+func RegisterEncoding(e Encoding) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+	encodings = append([]Encoding{e}, encodings...)
+}
+
+// negotiateEncoding returns the encoding accepted by the client with
+// the highest quality or nil. Ties are resolved by the order of
+// preference of the server.
+func negotiateEncoding(acceptEncoding string) *Encoding {
+	if acceptEncoding == "" {
+		return nil
+	}
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		quality[name] = q
+	}
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	var best *Encoding
+	bestQ := 0.0
+	for i := range encodings {
+		q, has := quality[encodings[i].Name]
+		if !has {
+			q, has = quality["*"]
+		}
+		if has && q > bestQ {
+			best = &encodings[i]
+			bestQ = q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the response if it is large enough.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding *Encoding
+
+	wroteHeader bool
+	writer      io.WriteCloser // nil if not compressed.
+	err         error
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	compress := code == http.StatusOK || code == http.StatusNotFound
+	if h.Get("Content-Encoding") != "" {
+		compress = false
+	}
+	if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil && length < minCompressSize {
+		compress = false
+	}
+	if compress {
+		writer, err := cw.encoding.NewWriter(cw.ResponseWriter)
+		if err != nil {
+			cw.err = err
+		} else {
+			cw.writer = writer
+			h.Set("Content-Encoding", cw.encoding.Name)
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				// Compressed bytes differ from the identity response.
+				h.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	if cw.writer == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.writer.Write(b)
+}
+
+func (cw *compressWriter) close() error {
+	if cw.writer == nil {
+		return nil
+	}
+	return cw.writer.Close()
+}
+
+// compressResponses compresses responses with the content coding
+// negotiated by Accept-Encoding.
+func compressResponses(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == nil || r.Method == http.MethodHead {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		handler.ServeHTTP(cw, r)
+	})
+}
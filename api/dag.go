@@ -0,0 +1,98 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+const (
+	// MaxDAGNodes is the max number of transactions in /v1/dag.
+	MaxDAGNodes = 100
+
+	// MaxDAGBlocks is the max value of ?blocks= of /v1/dag.
+	MaxDAGBlocks = 144
+)
+
+// DAGResponse is the graph of ancestors of a transaction as adjacency
+// lists. Nodes[0] is the requested transaction.
+type DAGResponse struct {
+	Nodes     []DAGNode `json:"nodes"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+type DAGNode struct {
+	ID    string `json:"id"`
+	Block int    `json:"block"`
+	// TxID is empty for miner payouts.
+	TxID string `json:"txid,omitempty"`
+	// Parents are IDs of the nodes creating outputs spent by the node.
+	Parents []string `json:"parents,omitempty"`
+}
+
+// handleDAG returns ancestors of the item ?id= as JSON. Ancestors are
+// looked up in the block of the item and ?blocks= blocks before it.
+func (a *api) handleDAG(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	query := r.URL.Query()
+	id, err := cache.ParseItemID(query.Get("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cache.ParseItemID: %v.\n", err)
+		return
+	}
+	blocks := 0
+	if blocksStr := query.Get("blocks"); blocksStr != "" {
+		blocks, err = strconv.Atoi(blocksStr)
+		if err != nil || blocks < 0 || blocks > MaxDAGBlocks {
+			writeError(w, http.StatusBadRequest, "Bad blocks: %q, max %d.\n", blocksStr, MaxDAGBlocks)
+			return
+		}
+	}
+	// Ancestors in the cold index of an item of the hot index
+	// are not found.
+	if t.CheckHeight(id.Height) != nil {
+		writeNotYetIndexed(w, t.TipHeight())
+		return
+	}
+	s, firstBlock := t.Layer(id.Height)
+	if s == nil {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		return
+	}
+	itemIndex, err := s.ItemIndex(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		return
+	}
+	blockIndex := id.Height - s.StartHeight()
+	if a.checkETag(w, r, s.BuildID(), isFinal(firstBlock+blockIndex, t.NumBlocks())) {
+		return
+	}
+	g, err := s.TransactionAncestors(itemIndex, blockIndex-blocks, MaxDAGNodes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "TransactionAncestors: %v.\n", err)
+		log.Printf("TransactionAncestors: %v.\n", err)
+		return
+	}
+	resp := DAGResponse{
+		Truncated: g.Truncated,
+	}
+	for _, node := range g.Nodes {
+		n := DAGNode{
+			ID:    node.ID,
+			Block: firstBlock + node.Block,
+		}
+		if node.TxID != (types.TransactionID{}) {
+			n.TxID = node.TxID.String()
+		}
+		for _, parent := range node.Parents {
+			n.Parents = append(n.Parents, g.Nodes[parent].ID)
+		}
+		resp.Nodes = append(resp.Nodes, n)
+	}
+	writeJSON(w, r, resp)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/starius/sialite/cache"
+)
+
+// Error responses have JSON body ErrorResponse, so clients can decide
+// whether to retry by Code and Retryable instead of parsing messages.
+// Retryable errors are temporary: the block is not yet indexed, the
+// server is overloaded or a deadline is exceeded, so the same request
+// may succeed later, after Retry-After seconds if the header is set.
+
+// Codes of ErrorResponse.
+const (
+	CODE_BAD_REQUEST     = "bad_request"
+	CODE_UNAUTHORIZED    = "unauthorized"
+	CODE_FORBIDDEN       = "forbidden"
+	CODE_NOT_FOUND       = "not_found"
+	CODE_NOT_YET_INDEXED = "not_yet_indexed"
+	CODE_CONFLICT        = "conflict"
+	CODE_TOO_LARGE       = "too_large"
+	CODE_RATE_LIMITED    = "rate_limited"
+	CODE_UNAVAILABLE     = "unavailable"
+	CODE_TIMEOUT         = "timeout"
+	CODE_INTERNAL        = "internal"
+)
+
+// ErrorResponse is the body of error responses.
+type ErrorResponse struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Retryable bool              `json:"retryable"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// errorKind is how an error is reported to clients.
+type errorKind struct {
+	status    int
+	code      string
+	retryable bool
+}
+
+// statusKinds are the kinds of errors by HTTP status.
+var statusKinds = map[int]errorKind{
+	http.StatusBadRequest:            {http.StatusBadRequest, CODE_BAD_REQUEST, false},
+	http.StatusUnauthorized:          {http.StatusUnauthorized, CODE_UNAUTHORIZED, false},
+	http.StatusForbidden:             {http.StatusForbidden, CODE_FORBIDDEN, false},
+	http.StatusNotFound:              {http.StatusNotFound, CODE_NOT_FOUND, false},
+	http.StatusConflict:              {http.StatusConflict, CODE_CONFLICT, false},
+	http.StatusRequestEntityTooLarge: {http.StatusRequestEntityTooLarge, CODE_TOO_LARGE, false},
+	http.StatusTooManyRequests:       {http.StatusTooManyRequests, CODE_RATE_LIMITED, true},
+	http.StatusServiceUnavailable:    {http.StatusServiceUnavailable, CODE_UNAVAILABLE, true},
+	http.StatusGatewayTimeout:        {http.StatusGatewayTimeout, CODE_TIMEOUT, true},
+}
+
+// errorKinds are the kinds of typed errors of cache and of contexts,
+// matched with errors.Is, so wrapped errors match as well. They take
+// precedence over the status passed to writeError.
+var errorKinds = []struct {
+	err  error
+	kind errorKind
+}{
+	{cache.ErrNotYetIndexed, errorKind{http.StatusNotFound, CODE_NOT_YET_INDEXED, true}},
+	{cache.ErrNoItem, errorKind{http.StatusNotFound, CODE_NOT_FOUND, false}},
+	{cache.ErrNoBlock, errorKind{http.StatusNotFound, CODE_NOT_FOUND, false}},
+	{cache.ErrBadCursor, errorKind{http.StatusBadRequest, CODE_BAD_REQUEST, false}},
+	{cache.ErrBadFilterPrefix, errorKind{http.StatusBadRequest, CODE_BAD_REQUEST, false}},
+	{cache.ErrLocked, errorKind{http.StatusServiceUnavailable, CODE_UNAVAILABLE, true}},
+	{cache.ErrFault, errorKind{http.StatusServiceUnavailable, CODE_UNAVAILABLE, true}},
+	{context.DeadlineExceeded, errorKind{http.StatusGatewayTimeout, CODE_TIMEOUT, true}},
+}
+
+// kindOf returns the kind of the error response with the status and
+// the arguments of its message.
+func kindOf(status int, args []interface{}) errorKind {
+	for _, arg := range args {
+		err, ok := arg.(error)
+		if !ok {
+			continue
+		}
+		for _, known := range errorKinds {
+			if errors.Is(err, known.err) {
+				return known.kind
+			}
+		}
+	}
+	if kind, has := statusKinds[status]; has {
+		return kind
+	}
+	return errorKind{status, CODE_INTERNAL, false}
+}
+
+// writeError writes ErrorResponse with the message formatted as by
+// fmt.Fprintf. The status, the code and retryability are found by
+// errors among args (see errorKinds), otherwise by the status.
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	kind := kindOf(status, args)
+	writeErrorResponse(w, kind.status, ErrorResponse{
+		Code:      kind.code,
+		Message:   strings.TrimSuffix(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"), "."),
+		Retryable: kind.retryable,
+	})
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, resp ErrorResponse) {
+	// checkETag sets caching headers before the response is known, but
+	// errors must not be cached as the response of the build.
+	uncacheable(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// FinalityDepth is the number of blocks on top of a block after which
+// responses about the block are cached as immutable.
+const FinalityDepth = 6
+
+// checkETag sets ETag and Cache-Control headers derived from the build
+// ID of the index, if caching headers are enabled. Responses depending
+// only on blocks below tip-FinalityDepth are immutable. If the client
+// already has the response (If-None-Match), checkETag writes 304 and
+// returns true. The headers are set before the handler knows if it
+// succeeds, so error responses remove them (see uncacheable).
+func (a *api) checkETag(w http.ResponseWriter, r *http.Request, buildID string, immutable bool) bool {
+	if !a.cacheHeaders {
+		return false
+	}
+	etag := `"` + buildID + `"`
+	w.Header().Set("ETag", etag)
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		// The response changes when a new index is loaded.
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		// Compressed responses have weak ETags (see compress.go).
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// uncacheable replaces caching headers set by checkETag, so the response
+// (e.g. an error) is not stored by browsers and CDNs.
+func uncacheable(w http.ResponseWriter) {
+	w.Header().Del("ETag")
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// isFinal returns if the block with given height is at least
+// FinalityDepth blocks below the tip.
+func isFinal(height, nblocks int) bool {
+	return height < nblocks-FinalityDepth
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/starius/sialite/cache"
+)
+
+// recoverFaults fails requests which fault reading mmaped files of the
+// index (see cache.Guard) with 503 instead of crashing the process.
+func recoverFaults(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		old := debug.SetPanicOnFault(true)
+		defer func() {
+			debug.SetPanicOnFault(old)
+			if rec := recover(); rec != nil {
+				if !cache.IsFault(rec) {
+					panic(rec)
+				}
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusServiceUnavailable, "%v.\n", cache.ErrFault)
+				log.Printf("%s: %v: %v.\n", r.URL.Path, cache.ErrFault, rec)
+			}
+		}()
+		handler.ServeHTTP(w, r)
+	})
+}
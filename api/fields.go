@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/starius/sialite/cache"
+)
+
+// Partial responses. ?fields= is a comma separated list of fields to
+// return, other fields are dropped. For JSON responses fields are JSON
+// keys; nested fields are separated by dots (e.g. transaction.minerfees)
+// and lists are transparent: fields apply to each element. For
+// Sia-encoded lists of cache.Item (/v1/history) fields are names of
+// fields of cache.Item (case-insensitive, e.g. fields=ID,Block,Matches
+// drops Data and MerkleProof); dropped fields are encoded as empty
+// values, so the format does not change.
+
+// fieldTree is the parsed ?fields=. nil subtree selects the whole value.
+type fieldTree map[string]fieldTree
+
+func parseFields(text string) fieldTree {
+	if text == "" {
+		return nil
+	}
+	tree := make(fieldTree)
+	for _, path := range strings.Split(text, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		node := tree
+		parts := strings.Split(path, ".")
+		for i, part := range parts {
+			sub, has := node[part]
+			if has && sub == nil {
+				// The whole value is already selected.
+				break
+			}
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+			if !has {
+				sub = make(fieldTree)
+				node[part] = sub
+			}
+			node = sub
+		}
+	}
+	return tree
+}
+
+// apply drops fields not selected by the tree from a value decoded from
+// JSON.
+func (tree fieldTree) apply(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(tree))
+		for key, sub := range tree {
+			value, has := v[key]
+			if !has {
+				continue
+			}
+			if sub == nil {
+				out[key] = value
+			} else {
+				out[key] = sub.apply(value)
+			}
+		}
+		return out
+	case []interface{}:
+		for i := range v {
+			v[i] = tree.apply(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// writeJSON writes resp as JSON response, keeping only fields selected
+// by ?fields= if it is set.
+func writeJSON(w http.ResponseWriter, r *http.Request, resp interface{}) {
+	if tree := parseFields(r.URL.Query().Get("fields")); tree != nil {
+		data, err := json.Marshal(resp)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "json.Marshal: %v.\n", err)
+			log.Printf("json.Marshal: %v.\n", err)
+			return
+		}
+		d := json.NewDecoder(bytes.NewReader(data))
+		// Amounts may not fit into float64.
+		d.UseNumber()
+		var generic interface{}
+		if err := d.Decode(&generic); err != nil {
+			writeError(w, http.StatusInternalServerError, "json.Decode: %v.\n", err)
+			log.Printf("json.Decode: %v.\n", err)
+			return
+		}
+		resp = tree.apply(generic)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// selectItemFields zeroes fields of items not selected by ?fields=.
+func selectItemFields(r *http.Request, items []cache.Item) {
+	tree := parseFields(strings.ToLower(r.URL.Query().Get("fields")))
+	if tree == nil {
+		return
+	}
+	for i := range items {
+		v := reflect.ValueOf(&items[i]).Elem()
+		st := v.Type()
+		for j := 0; j < st.NumField(); j++ {
+			if _, has := tree[strings.ToLower(st.Field(j).Name)]; !has {
+				v.Field(j).Set(reflect.Zero(st.Field(j).Type))
+			}
+		}
+	}
+}
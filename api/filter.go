@@ -0,0 +1,70 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// MAX_FILTERS is the max number of filters of /v1/filters.
+const MAX_FILTERS = 1000
+
+// FilterResponse is the filter of a block (see cache.BuildFilter).
+// The items of a matched block are requested by /v1/item?block=&index=
+// with index from 0 to Items-1.
+type FilterResponse struct {
+	Height int    `json:"height"`
+	Items  int    `json:"items"`
+	Filter []byte `json:"filter"`
+}
+
+// handleFilters returns filters of ?count= blocks starting from the
+// block ?start= (block index) as JSON.
+func (a *api) handleFilters(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	query := r.URL.Query()
+	start, err := strconv.Atoi(query.Get("start"))
+	if err != nil || start < 0 || start >= t.NumBlocks() {
+		writeError(w, http.StatusBadRequest, "Bad start: %q.\n", query.Get("start"))
+		return
+	}
+	count := MAX_FILTERS
+	if countText := query.Get("count"); countText != "" {
+		count, err = strconv.Atoi(countText)
+		if err != nil || count <= 0 || count > MAX_FILTERS {
+			writeError(w, http.StatusBadRequest, "Bad count: %q, want 1-%d.\n", countText, MAX_FILTERS)
+			return
+		}
+	}
+	end := start + count
+	if end > t.NumBlocks() {
+		end = t.NumBlocks()
+	}
+	if a.checkETag(w, r, t.BuildID(), isFinal(end-1, t.NumBlocks())) {
+		return
+	}
+	resp := make([]FilterResponse, 0, end-start)
+	for blockIndex := start; blockIndex < end; blockIndex++ {
+		s, first := t.Layer(t.StartHeight() + blockIndex)
+		payoutsStart, _, itemsEnd, err := s.GetBlockItems(blockIndex - first)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "GetBlockItems: %v.\n", err)
+			log.Printf("GetBlockItems: %v.\n", err)
+			return
+		}
+		filter, err := s.BlockFilter(blockIndex - first)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "BlockFilter: %v.\n", err)
+			log.Printf("BlockFilter: %v.\n", err)
+			return
+		}
+		resp = append(resp, FilterResponse{
+			Height: t.StartHeight() + blockIndex,
+			Items:  itemsEnd - payoutsStart,
+			Filter: filter,
+		})
+	}
+	writeJSON(w, r, resp)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+type GenesisResponse struct {
+	ID        string                  `json:"id"`
+	Timestamp int64                   `json:"timestamp"`
+	Outputs   []GenesisOutputResponse `json:"outputs"`
+}
+
+type GenesisOutputResponse struct {
+	ItemID  string       `json:"item_id"`
+	ID      string       `json:"id"`
+	Nature  string       `json:"nature"`
+	Address string       `json:"address"`
+	Value   cache.Amount `json:"value"`
+}
+
+// handleGenesis returns the genesis block and its outputs (the siafund
+// allocation) as JSON. Add ?sc=1 to get siacoin values in SC.
+func (a *api) handleGenesis(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s := a.server(r)
+	if a.checkETag(w, r, s.BuildID(), isFinal(0, s.NumBlocks())) {
+		return
+	}
+	g, err := s.Genesis()
+	if err == cache.ErrNoGenesis {
+		writeError(w, http.StatusNotFound, "Genesis: %v.\n", err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Genesis: %v.\n", err)
+		log.Printf("Genesis: %v.\n", err)
+		return
+	}
+	withSC := r.URL.Query().Get("sc") != ""
+	resp := GenesisResponse{
+		ID:        g.ID.String(),
+		Timestamp: int64(g.Timestamp),
+	}
+	for _, out := range g.Outputs {
+		resp.Outputs = append(resp.Outputs, GenesisOutputResponse{
+			ItemID:  out.ItemID,
+			ID:      out.ID.String(),
+			Nature:  out.Nature,
+			Address: cache.FormatAddress(out.UnlockHash),
+			Value:   cache.NewAmount(out.Value, withSC && out.Nature != cache.NATURE_SIAFUND_OUTPUT),
+		})
+	}
+	writeJSON(w, r, resp)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// HeaderProofResponse proves that the block is an ancestor of the last
+// block of the index with NumBlocks blocks (see cache.HeaderProof).
+// Root is the root of the headers MMR of the index, which clients
+// tracking the tip compare with the root they know.
+type HeaderProofResponse struct {
+	Height      int    `json:"height"`
+	BlockID     string `json:"block_id"`
+	StartHeight int    `json:"start_height"`
+	NumBlocks   int    `json:"num_blocks"`
+	Root        string `json:"root"`
+	Proof       string `json:"proof"` // Hex of concatenated hashes.
+}
+
+// handleHeaderProof returns the proof of the block ?height= against
+// the headers MMR as JSON. Blocks of the tip are proven against the
+// MMR of the tip, which starts at StartHeight. With Accept:
+// SIA_ENCODING_TYPE it returns Sia-encoded cache.HeaderProof and root.
+func (a *api) handleHeaderProof(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	heightStr := r.URL.Query().Get("height")
+	height, err := strconv.Atoi(heightStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad height: %q.\n", heightStr)
+		return
+	}
+	if t.CheckHeight(height) != nil {
+		writeNotYetIndexed(w, t.TipHeight())
+		return
+	}
+	s, _ := t.Layer(height)
+	if s == nil {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		return
+	}
+	buildID, binary := negotiate(w, r, s.BuildID())
+	// The proof changes when blocks are added.
+	if a.checkETag(w, r, buildID, false) {
+		return
+	}
+	p, err := s.ProveHeader(height - s.StartHeight())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "ProveHeader: %v.\n", err)
+		log.Printf("ProveHeader: %v.\n", err)
+		return
+	}
+	root := s.HeadersMMRRoot()
+	if binary {
+		writeSiaEncoded(w, http.StatusOK, p, root)
+		return
+	}
+	resp := HeaderProofResponse{
+		Height:      height,
+		BlockID:     p.BlockID.String(),
+		StartHeight: s.StartHeight(),
+		NumBlocks:   p.NumBlocks,
+		Root:        hex.EncodeToString(root[:]),
+		Proof:       hex.EncodeToString(p.Proof),
+	}
+	writeJSON(w, r, resp)
+}
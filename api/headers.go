@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// MAX_HEADERS is the max number of headers returned by /v1/headers.
+const MAX_HEADERS = 10000
+
+// handleHeaders returns raw headers (cache.HEADER_SIZE bytes each) of
+// blocks starting from height ?start=, up to MAX_HEADERS headers.
+// Clients syncing headers pass the ID of the block before ?start= as
+// ?parent=; if it is not in the chain of the server (the client is on
+// another fork), 409 Conflict is returned and the client should retry
+// with lower ?start=. An empty response means the client is synced.
+func (a *api) handleHeaders(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	q := r.URL.Query()
+	height, err := strconv.Atoi(q.Get("start"))
+	if err != nil || height < t.StartHeight() {
+		writeError(w, http.StatusBadRequest, "Bad start: %q.\n", q.Get("start"))
+		return
+	}
+	start := height - t.StartHeight()
+	if parentText := q.Get("parent"); parentText != "" {
+		var parentHash crypto.Hash
+		if err := parentHash.LoadString(parentText); err != nil {
+			writeError(w, http.StatusBadRequest, "parent.LoadString: %v.\n", err)
+			return
+		}
+		parentIndex, err := t.BlockIndexByID(types.BlockID(parentHash))
+		if err != nil && err != cache.ErrNoBlock {
+			writeError(w, http.StatusInternalServerError, "BlockIndexByID: %v.\n", err)
+			log.Printf("BlockIndexByID: %v.\n", err)
+			return
+		}
+		if err == cache.ErrNoBlock || parentIndex != start-1 {
+			writeError(w, http.StatusConflict, "Parent is not in the chain.\n")
+			return
+		}
+	}
+	if start > t.NumBlocks() {
+		writeError(w, http.StatusConflict, "Start is above the tip.\n")
+		return
+	}
+	end := start + MAX_HEADERS
+	if end > t.NumBlocks() {
+		end = t.NumBlocks()
+	}
+	if a.checkETag(w, r, t.BuildID(), isFinal(end-1, t.NumBlocks())) {
+		return
+	}
+	headers, err := t.RawHeaders(start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "RawHeaders: %v.\n", err)
+		log.Printf("RawHeaders: %v.\n", err)
+		return
+	}
+	w.Header().Set("X-Sialite-Tip-Height", strconv.Itoa(t.TipHeight()))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(headers)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(headers)
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/netlib"
+)
+
+// SyncCheck configures the check of the index against the network
+// used by /readyz and /v1/sync.
+type SyncCheck struct {
+	// Peers are compared with the index. If Peers is empty, NumPeers
+	// random bootstrap peers are used.
+	Peers    []string
+	NumPeers int
+
+	// MaxBehind is the max number of blocks which peers (the median)
+	// have after the last block of a ready index.
+	MaxBehind int
+
+	// Interval is the period of checks.
+	Interval time.Duration
+
+	DialOptions netlib.DialOptions
+}
+
+type peerState struct {
+	node     string
+	err      error
+	ancestor int // Height of the last common block.
+	blocks   int
+	diverged bool
+}
+
+type syncState struct {
+	height  int
+	tip     types.BlockID
+	peers   []peerState
+	checked time.Time
+
+	// behind is the median of the numbers of blocks after the tip of
+	// peers which have not diverged.
+	behind    int
+	diverged  int
+	responded int
+}
+
+func (c *SyncCheck) peers() []string {
+	if len(c.Peers) != 0 {
+		return c.Peers
+	}
+	var peers []string
+	for _, i := range fastrand.Perm(len(modules.BootstrapPeers)) {
+		if len(peers) == c.NumPeers {
+			break
+		}
+		peers = append(peers, string(modules.BootstrapPeers[i]))
+	}
+	return peers
+}
+
+func compareChain(ctx context.Context, node string, ids []types.BlockID, max int, opts netlib.DialOptions) (*netlib.ChainComparison, error) {
+	sess, err := netlib.Dial(ctx, node, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+	return sess.CompareChain(ctx, ids, max)
+}
+
+// heightOf returns the height of the block with the ID or -1.
+func heightOf(ids []types.BlockID, startHeight int, id types.BlockID) int {
+	for i := len(ids) - 1; i >= 0; i-- {
+		if ids[i] == id {
+			return startHeight + i
+		}
+	}
+	if id == types.GenesisID {
+		return 0
+	}
+	return -1
+}
+
+// checkPeers compares the index with the chains of the peers.
+func (a *api) checkPeers(c *SyncCheck) (*syncState, error) {
+	t := a.acquire()
+	defer t.Release()
+	ids, err := t.BlockIDs()
+	if err != nil {
+		return nil, err
+	}
+	state := &syncState{
+		height: t.StartHeight() + len(ids) - 1,
+	}
+	if len(ids) != 0 {
+		state.tip = ids[len(ids)-1]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.Interval)
+	defer cancel()
+	var counts []int
+	for _, node := range c.peers() {
+		p := peerState{node: node}
+		// One block more than MaxBehind is enough to fail the check.
+		cmp, err := compareChain(ctx, node, ids, c.MaxBehind+1, c.DialOptions)
+		if err != nil {
+			p.err = err
+		} else {
+			p.ancestor = heightOf(ids, t.StartHeight(), cmp.Ancestor)
+			p.blocks = cmp.Blocks
+			p.diverged = cmp.Diverged(state.tip)
+			state.responded++
+			if p.diverged {
+				state.diverged++
+			} else {
+				counts = append(counts, p.blocks)
+			}
+		}
+		state.peers = append(state.peers, p)
+	}
+	if state.responded == 0 {
+		return state, fmt.Errorf("no peers responded")
+	}
+	if len(counts) != 0 {
+		sort.Ints(counts)
+		state.behind = counts[len(counts)/2]
+	}
+	return state, nil
+}
+
+func (a *api) checkSync(c *SyncCheck) {
+	for {
+		state, err := a.checkPeers(c)
+		if err != nil {
+			log.Printf("Checking sync state: %v.", err)
+		}
+		if state != nil {
+			for _, p := range state.peers {
+				if p.diverged {
+					log.Printf("Peer %s diverged from the index at height %d.", p.node, p.ancestor)
+				}
+			}
+			state.checked = time.Now()
+			a.syncMu.Lock()
+			a.sync = state
+			a.syncMu.Unlock()
+		}
+		time.Sleep(c.Interval)
+	}
+}
+
+func (a *api) syncState() *syncState {
+	a.syncMu.Lock()
+	defer a.syncMu.Unlock()
+	return a.sync
+}
+
+// handleHealthz reports that the process is alive.
+func (a *api) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "OK.\n")
+}
+
+// handleReadyz reports if the index is open and, if SyncCheck is set,
+// the index is at most MaxBehind blocks behind the network and most
+// of the peers have not diverged from it (i.e. it is not on a dead fork).
+func (a *api) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if a.server(r) == nil {
+		writeError(w, http.StatusServiceUnavailable, "Index is not open.\n")
+		return
+	}
+	if a.syncCheck != nil {
+		state := a.syncState()
+		if state == nil {
+			writeError(w, http.StatusServiceUnavailable, "Sync state is not checked yet.\n")
+			return
+		}
+		if state.responded == 0 {
+			writeError(w, http.StatusServiceUnavailable, "No peers responded.\n")
+			return
+		}
+		if 2*state.diverged >= state.responded {
+			writeError(w, http.StatusServiceUnavailable, "Index diverged from %d of %d peers.\n", state.diverged, state.responded)
+			return
+		}
+		if state.behind > a.syncCheck.MaxBehind {
+			writeError(w, http.StatusServiceUnavailable, "Index is more than %d blocks behind peers.\n", a.syncCheck.MaxBehind)
+			return
+		}
+	}
+	fmt.Fprintf(w, "OK.\n")
+}
+
+type SyncResponse struct {
+	Checked  int64              `json:"checked"` // Unix time.
+	Height   int                `json:"height"`
+	BlockID  string             `json:"block_id"`
+	Behind   int                `json:"behind"`
+	Diverged int                `json:"diverged"`
+	Peers    []PeerSyncResponse `json:"peers"`
+}
+
+type PeerSyncResponse struct {
+	Node  string `json:"node"`
+	Error string `json:"error,omitempty"`
+
+	// AncestorHeight is the height of the last common block.
+	AncestorHeight int `json:"ancestor_height"`
+
+	// Blocks is the number of blocks of the peer after the common block,
+	// at most SyncCheck.MaxBehind+1.
+	Blocks   int  `json:"blocks"`
+	Diverged bool `json:"diverged,omitempty"`
+}
+
+// handleSync returns the last comparison of the index with peers.
+func (a *api) handleSync(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	state := a.syncState()
+	if state == nil {
+		writeError(w, http.StatusServiceUnavailable, "Sync state is not checked yet.\n")
+		return
+	}
+	resp := SyncResponse{
+		Checked:  state.checked.Unix(),
+		Height:   state.height,
+		BlockID:  state.tip.String(),
+		Behind:   state.behind,
+		Diverged: state.diverged,
+	}
+	for _, p := range state.peers {
+		pr := PeerSyncResponse{
+			Node:           p.node,
+			AncestorHeight: p.ancestor,
+			Blocks:         p.blocks,
+			Diverged:       p.diverged,
+		}
+		if p.err != nil {
+			pr.Error = p.err.Error()
+		}
+		resp.Peers = append(resp.Peers, pr)
+	}
+	writeJSON(w, r, resp)
+}
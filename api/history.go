@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// handleHistory returns a page (see page.go) of the history of ?address=
+// as Sia-encoded cursor of the next page and list of cache.Item.
+func (a *api) handleHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	addressHex := r.URL.Query().Get("address")
+	address, err := cache.ParseAddress(addressHex)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cache.ParseAddress(%q): %v.\n", addressHex, err)
+		log.Printf("cache.ParseAddress(%q): %v.\n", addressHex, err)
+		return
+	}
+	addressBytes := address[:]
+	p, ok := parsePage(w, r, cache.MAX_HISTORY_SIZE)
+	if !ok {
+		return
+	}
+	minConfirmations := 0
+	if minStr := r.URL.Query().Get("min_confirmations"); minStr != "" {
+		min, err := strconv.Atoi(minStr)
+		if err != nil || min < 0 {
+			writeError(w, http.StatusBadRequest, "Bad min_confirmations: %q.\n", minStr)
+			return
+		}
+		minConfirmations = min
+	}
+	t := a.snapshot(w, r)
+	// Proofs cover the cold index only.
+	s := t.Cold
+	if a.checkETag(w, r, t.BuildID(), false) {
+		return
+	}
+	if fromStr := r.URL.Query().Get("from_height"); fromStr != "" && p.cursor == "" {
+		from, err := strconv.Atoi(fromStr)
+		if err != nil || from < 0 {
+			writeError(w, http.StatusBadRequest, "Bad from_height: %q.\n", fromStr)
+			return
+		}
+		cursor, err := t.HistoryCursorAt(addressBytes, from)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "HistoryCursorAt: %v.\n", err)
+			log.Printf("HistoryCursorAt: %v.\n", err)
+			return
+		}
+		if cursor == "" {
+			writeError(w, http.StatusNotFound, "Not found.\n")
+			return
+		}
+		p.cursor = cursor
+	}
+	page, err := t.GetHistoryPageContext(r.Context(), addressBytes, p.cursor, p.limit)
+	if err != nil {
+		writeItemPageError(w, "GetHistoryPage", err)
+		return
+	}
+	history, next := page.Items, page.Next
+	if minConfirmations != 0 {
+		history, next = capConfirmed(history, next, t.NumBlocks()-minConfirmations)
+	}
+	w.Header().Set("X-Sialite-Tip-Height", strconv.Itoa(t.TipHeight()))
+	setPageHeaders(w, next, page.Total)
+	if len(page.Items) == 0 && r.URL.Query().Get("prove_absence") != "" {
+		handleAbsence(w, s, addressBytes)
+		return
+	}
+	if len(page.Items) == 0 {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		log.Printf("Not found.\n")
+		return
+	}
+	selectItemFields(r, history)
+	var buf bytes.Buffer
+	e := encoding.NewEncoder(&buf)
+	objects := []interface{}{next, history}
+	if r.URL.Query().Get("prove_entries") != "" {
+		// Proof that history covers all entries of the address index.
+		proof, err := s.ProveAddress(addressBytes)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "ProveAddress: %v.\n", err)
+			log.Printf("ProveAddress: %v.\n", err)
+			return
+		}
+		objects = append(objects, proof)
+	}
+	if err := e.EncodeAll(objects...); err != nil {
+		writeError(w, http.StatusInternalServerError, "Encode: %v.\n", err)
+		log.Printf("Encode: %v.\n", err)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.Header().Set("X-Sialite-Address", cache.FormatAddress(address))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// handleAbsence responds with 404 and Sia-encoded cache.AbsenceProof.
+func handleAbsence(w http.ResponseWriter, s *cache.Server, address []byte) {
+	proof, err := s.ProveAbsence(address)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ProveAbsence: %v.\n", err)
+		log.Printf("ProveAbsence: %v.\n", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := encoding.NewEncoder(&buf).Encode(proof); err != nil {
+		writeError(w, http.StatusInternalServerError, "Encode: %v.\n", err)
+		log.Printf("Encode: %v.\n", err)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.Header().Set("X-Sialite-Absence-Proof", "1")
+	w.WriteHeader(http.StatusNotFound)
+	buf.WriteTo(w)
+}
+
+// capConfirmed drops items of the page after block lastBlock, i.e. with
+// fewer confirmations than requested. History is in the order of blocks,
+// so they are at the end of the page and the rest of the history is
+// after them. The cursor of the next page then points to the first of
+// them, so the client can continue from it when they are confirmed;
+// the page can be empty in this case.
+func capConfirmed(history []cache.Item, next string, lastBlock int) ([]cache.Item, string) {
+	for i, item := range history {
+		if item.Block > lastBlock {
+			return history[:i], item.ID
+		}
+	}
+	return history, next
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// HostActivityResponse lists transactions of a host (see
+// cache.Server.HostActivity).
+type HostActivityResponse struct {
+	Key          string                `json:"key"`
+	Transactions []HostTransactionJSON `json:"transactions"`
+}
+
+type HostTransactionJSON struct {
+	ID            string          `json:"id"`
+	Block         int             `json:"block"`
+	TxID          string          `json:"txid"`
+	Confirmations int             `json:"confirmations"`
+	Events        []HostEventJSON `json:"events"`
+}
+
+type HostEventJSON struct {
+	Kind           string `json:"kind"`
+	NetAddress     string `json:"net_address,omitempty"`
+	ContractID     string `json:"contract_id,omitempty"`
+	RevisionNumber uint64 `json:"revision_number,omitempty"`
+	FileSize       uint64 `json:"file_size,omitempty"`
+}
+
+// handleHostActivity returns a page (see page.go) of announcements of
+// the host with ed25519 key ?pubkey= and revisions of its contracts as
+// JSON.
+func (a *api) handleHostActivity(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pk, ok := parsePublicKey(w, r)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(w, r, cache.MAX_HISTORY_SIZE)
+	if !ok {
+		return
+	}
+	t := a.snapshot(w, r)
+	if a.checkETag(w, r, t.BuildID(), false) {
+		return
+	}
+	page, err := t.HostActivityPage(pk, p.cursor, p.limit)
+	if err != nil {
+		writeItemPageError(w, "HostActivityPage", err)
+		return
+	}
+	items := page.Items
+	resp := HostActivityResponse{
+		Key:          fmt.Sprintf("ed25519:%x", pk[:]),
+		Transactions: []HostTransactionJSON{},
+	}
+	for _, item := range items {
+		_, tx, err := cache.DecodeItem(item)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "cache.DecodeItem: %v.\n", err)
+			log.Printf("cache.DecodeItem: %v.\n", err)
+			return
+		}
+		if tx == nil {
+			continue
+		}
+		txJSON := HostTransactionJSON{
+			ID:            item.ID,
+			Block:         item.Block,
+			TxID:          tx.ID().String(),
+			Confirmations: item.Confirmations,
+		}
+		for _, event := range cache.HostEvents(tx, pk) {
+			e := HostEventJSON{
+				Kind:           event.Kind,
+				NetAddress:     string(event.NetAddress),
+				RevisionNumber: event.RevisionNumber,
+				FileSize:       event.FileSize,
+			}
+			if event.Kind == cache.HOST_REVISION {
+				e.ContractID = event.ContractID.String()
+			}
+			txJSON.Events = append(txJSON.Events, e)
+		}
+		resp.Transactions = append(resp.Transactions, txJSON)
+	}
+	setPageHeaders(w, page.Next, page.Total)
+	writeJSON(w, r, resp)
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+type ItemResponse struct {
+	ID          string               `json:"id"`
+	Block       int                  `json:"block"`
+	Index       int                  `json:"index"`
+	Size        int                  `json:"size"`
+	Fee         *cache.Amount        `json:"fee,omitempty"`
+	MinerPayout *types.SiacoinOutput `json:"miner_payout,omitempty"`
+	Transaction *types.Transaction   `json:"transaction,omitempty"`
+	Inputs      []ResolvedInput      `json:"inputs,omitempty"`
+
+	// Labels are labels of addresses of outputs (see Options.Labels).
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ResolvedInput is an input of the transaction with the value and
+// the source of the spent output. Value, Nature and source fields
+// are empty if the output was not found.
+type ResolvedInput struct {
+	ParentID    string        `json:"parent_id"`
+	Siafund     bool          `json:"siafund"`
+	Address     string        `json:"address"`
+	Label       string        `json:"label,omitempty"`
+	Value       *cache.Amount `json:"value,omitempty"`
+	Nature      string        `json:"nature,omitempty"`
+	SourceBlock int           `json:"source_block,omitempty"`
+	SourceTx    string        `json:"source_tx,omitempty"`
+	Multisig    *MultisigJSON `json:"multisig,omitempty"`
+}
+
+// MultisigJSON is the m-of-n structure of multi-signature unlock
+// conditions (see cache.Multisig).
+type MultisigJSON struct {
+	Required   int      `json:"required"`
+	Total      int      `json:"total"`
+	PublicKeys []string `json:"public_keys"`
+	Timelock   uint64   `json:"timelock,omitempty"`
+}
+
+// handleItem returns the item ?index= of the block at height ?block=
+// as JSON. Alternatively the item is identified by ?id= (see
+// cache.ItemID). Inputs of transactions are resolved to the outputs
+// they spend. With Accept: SIA_ENCODING_TYPE it returns Sia-encoded
+// cache.Item with its Merkle proof instead.
+func (a *api) handleItem(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	s := t.Cold
+	// firstBlock is the index of the first block of s in t.
+	firstBlock := 0
+	query := r.URL.Query()
+	var itemIndex int
+	if idText := query.Get("id"); idText != "" {
+		id, err := cache.ParseItemID(idText)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "cache.ParseItemID: %v.\n", err)
+			return
+		}
+		if t.CheckHeight(id.Height) != nil {
+			writeNotYetIndexed(w, t.TipHeight())
+			return
+		}
+		if s, firstBlock = t.Layer(id.Height); s == nil {
+			writeError(w, http.StatusNotFound, "Not found.\n")
+			return
+		}
+		if itemIndex, err = s.ItemIndex(id); err != nil {
+			writeError(w, http.StatusNotFound, "Not found.\n")
+			return
+		}
+	} else {
+		block, err := strconv.Atoi(query.Get("block"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Bad block: %q.\n", query.Get("block"))
+			return
+		}
+		index, err := strconv.Atoi(query.Get("index"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Bad index: %q.\n", query.Get("index"))
+			return
+		}
+		if t.CheckHeight(block) != nil {
+			writeNotYetIndexed(w, t.TipHeight())
+			return
+		}
+		if s, firstBlock = t.Layer(block); s == nil {
+			writeError(w, http.StatusNotFound, "Not found.\n")
+			return
+		}
+		payoutsStart, _, end, err := s.GetBlockItems(block - s.StartHeight())
+		if err != nil || index < 0 || payoutsStart+index >= end {
+			writeError(w, http.StatusNotFound, "Not found.\n")
+			return
+		}
+		itemIndex = payoutsStart + index
+	}
+	_, end := cache.StartSpan(r.Context(), cache.SPAN_ITEM_READ)
+	item, err := s.GetItemWithoutProof(itemIndex)
+	end()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "GetItemWithoutProof: %v.\n", err)
+		log.Printf("GetItemWithoutProof: %v.\n", err)
+		return
+	}
+	buildID, binary := negotiate(w, r, s.BuildID())
+	immutable := isFinal(firstBlock+item.Block, t.NumBlocks())
+	if binary {
+		// The item with its Merkle proof, like items of /v1/history.
+		if a.checkETag(w, r, buildID, immutable) {
+			return
+		}
+		if item, err = s.GetItemContext(r.Context(), itemIndex); err != nil {
+			writeError(w, http.StatusInternalServerError, "GetItem: %v.\n", err)
+			log.Printf("GetItem: %v.\n", err)
+			return
+		}
+		item.Block += firstBlock
+		writeSiaEncoded(w, http.StatusOK, item)
+		return
+	}
+	buildID, immutable = a.withLabels(buildID, immutable)
+	if a.checkETag(w, r, buildID, immutable) {
+		return
+	}
+	_, end = cache.StartSpan(r.Context(), cache.SPAN_DECOMPRESS)
+	payout, tx, err := cache.DecodeItem(item)
+	end()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DecodeItem: %v.\n", err)
+		log.Printf("DecodeItem: %v.\n", err)
+		return
+	}
+	info, err := s.GetItemInfo(itemIndex)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "GetItemInfo: %v.\n", err)
+		log.Printf("GetItemInfo: %v.\n", err)
+		return
+	}
+	withSC := query.Get("sc") != ""
+	resp := ItemResponse{
+		ID:          item.ID,
+		Block:       s.StartHeight() + item.Block,
+		Index:       item.Index,
+		Size:        info.Size,
+		MinerPayout: payout,
+		Transaction: tx,
+	}
+	if tx != nil {
+		fee := cache.NewAmount(info.Fee, withSC)
+		resp.Fee = &fee
+		inputs, err := t.ResolveInputs(tx)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "ResolveInputs: %v.\n", err)
+			log.Printf("ResolveInputs: %v.\n", err)
+			return
+		}
+		for _, in := range inputs {
+			ri := ResolvedInput{
+				ParentID: fmt.Sprintf("%x", in.ParentID[:]),
+				Siafund:  in.Siafund,
+				Address:  cache.FormatAddress(in.UnlockHash),
+				Label:    a.label(in.UnlockHash),
+			}
+			if in.Multisig != nil {
+				ri.Multisig = &MultisigJSON{
+					Required: in.Multisig.Required,
+					Total:    len(in.Multisig.PublicKeys),
+					Timelock: uint64(in.Multisig.Timelock),
+				}
+				for _, key := range in.Multisig.PublicKeys {
+					ri.Multisig.PublicKeys = append(ri.Multisig.PublicKeys, key.String())
+				}
+			}
+			if in.Output != nil {
+				value := cache.NewAmount(in.Output.Value, withSC && !in.Siafund)
+				ri.Value = &value
+				ri.Nature = in.Output.Nature
+				ri.SourceBlock = in.Block
+				if in.TxID != (types.TransactionID{}) {
+					ri.SourceTx = in.TxID.String()
+				}
+			}
+			resp.Inputs = append(resp.Inputs, ri)
+		}
+	}
+	if a.labels != nil {
+		var outputs []cache.Output
+		if payout != nil {
+			outputs = []cache.Output{{UnlockHash: payout.UnlockHash}}
+		} else {
+			outputs = cache.TransactionOutputs(tx)
+		}
+		for _, out := range outputs {
+			if label := a.label(out.UnlockHash); label != "" {
+				if resp.Labels == nil {
+					resp.Labels = make(map[string]string)
+				}
+				resp.Labels[cache.FormatAddress(out.UnlockHash)] = label
+			}
+		}
+	}
+	writeJSON(w, r, resp)
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is an entry of the key file, which is a JSON list of keys:
+//
+//	[{"key": "secret", "name": "alice", "rate": 5, "burst": 20, "max_addresses": 1000}]
+type APIKey struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+
+	// Rate is the number of requests per second and Burst is the number
+	// of requests which can be made at once. Rate 0 means no limit.
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+
+	// MaxAddresses is the max number of distinct addresses queried with
+	// the key per UTC day. 0 means no limit.
+	MaxAddresses int `json:"max_addresses,omitempty"`
+}
+
+// tokenBucket implements rate limits.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket and takes a token from it. It returns false
+// if the bucket is empty.
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) bool {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		elapsed := now.Sub(b.last).Seconds()
+		b.tokens = math.Min(b.tokens+elapsed*rate, float64(burst))
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type keyState struct {
+	APIKey
+
+	bucket tokenBucket
+
+	// Addresses queried on the day.
+	day       int64
+	addresses map[string]struct{}
+}
+
+// Keys is the set of API keys loaded from the key file.
+// It is safe for concurrent use.
+type Keys struct {
+	path string
+
+	mu   sync.Mutex
+	keys map[string]*keyState
+}
+
+// LoadKeys reads the key file.
+func LoadKeys(path string) (*Keys, error) {
+	k := &Keys{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the key file again. Usage of keys which are still
+// present is kept.
+func (k *Keys) Reload() error {
+	data, err := ioutil.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	var list []APIKey
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("json.Unmarshal(%q): %v", k.path, err)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys := make(map[string]*keyState, len(list))
+	for _, key := range list {
+		if key.Key == "" {
+			return fmt.Errorf("key %q is empty", key.Name)
+		}
+		if _, has := keys[key.Key]; has {
+			return fmt.Errorf("key %q is duplicate", key.Name)
+		}
+		if key.Rate > 0 && key.Burst < 1 {
+			key.Burst = 1
+		}
+		state := &keyState{
+			APIKey: key,
+		}
+		if old, has := k.keys[key.Key]; has {
+			state.bucket = old.bucket
+			state.bucket.tokens = math.Min(old.bucket.tokens, float64(key.Burst))
+			state.day = old.day
+			state.addresses = old.addresses
+		}
+		keys[key.Key] = state
+	}
+	k.keys = keys
+	return nil
+}
+
+// check accounts a request made with the key and returns HTTP status
+// and the error message if the request must be rejected.
+func (k *Keys) check(key string, addresses []string, now time.Time) (int, string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	state, has := k.keys[key]
+	if !has {
+		return http.StatusUnauthorized, "Unknown API key."
+	}
+	if state.Rate > 0 && !state.bucket.take(now, state.Rate, state.Burst) {
+		return http.StatusTooManyRequests, "Rate limit exceeded."
+	}
+	if state.MaxAddresses > 0 && len(addresses) != 0 {
+		day := now.Unix() / (24 * 60 * 60)
+		if day != state.day || state.addresses == nil {
+			state.day = day
+			state.addresses = make(map[string]struct{})
+		}
+		var newAddresses []string
+		for _, address := range addresses {
+			if _, has := state.addresses[address]; !has {
+				newAddresses = append(newAddresses, address)
+			}
+		}
+		if len(state.addresses)+len(newAddresses) > state.MaxAddresses {
+			return http.StatusForbidden, fmt.Sprintf("Quota of %d addresses per day exceeded.", state.MaxAddresses)
+		}
+		for _, address := range newAddresses {
+			state.addresses[address] = struct{}{}
+		}
+	}
+	return http.StatusOK, ""
+}
+
+// requestKey returns the API key of the request passed in header
+// X-Sialite-Key or as "Authorization: Bearer <key>".
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-Sialite-Key"); key != "" {
+		return key
+	}
+	const prefix = "Bearer "
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, prefix) {
+		return strings.TrimPrefix(auth, prefix)
+	}
+	return ""
+}
+
+// requireKeys rejects requests without a valid API key and requests
+// exceeding limits of the key. Addresses are counted from ?address=
+// and ?pubkey=.
+func requireKeys(handler http.Handler, keys *Keys) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := requestKey(r)
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "API key required.\n")
+			return
+		}
+		query := r.URL.Query()
+		addresses := append(query["address"], query["pubkey"]...)
+		status, message := keys.check(key, addresses, time.Now())
+		if status != http.StatusOK {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			writeError(w, status, "%s\n", message)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// MAX_LABELS is the max number of labels returned by /v1/labels.
+const MAX_LABELS = 1000
+
+// AddressLabel is an entry of the label file, which is a JSON list of
+// local annotations of addresses, e.g. known exchanges:
+//
+//	[{"address": "<76 hex characters>", "label": "Exchange", "tags": ["exchange"]}]
+type AddressLabel struct {
+	Address string   `json:"address"`
+	Label   string   `json:"label"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// Labels is the set of address labels loaded from the label file.
+// They are added to responses about the addresses and served at
+// /v1/labels. It is safe for concurrent use.
+type Labels struct {
+	path string
+
+	mu        sync.RWMutex
+	byAddress map[types.UnlockHash]AddressLabel
+	version   string
+}
+
+// LoadLabels reads the label file.
+func LoadLabels(path string) (*Labels, error) {
+	l := &Labels{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload reads the label file again.
+func (l *Labels) Reload() error {
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return err
+	}
+	var list []AddressLabel
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("json.Unmarshal(%q): %v", l.path, err)
+	}
+	byAddress := make(map[types.UnlockHash]AddressLabel, len(list))
+	for _, label := range list {
+		uh, err := cache.ParseAddress(label.Address)
+		if err != nil {
+			return fmt.Errorf("cache.ParseAddress(%q): %v", label.Address, err)
+		}
+		if _, has := byAddress[uh]; has {
+			return fmt.Errorf("address %q is duplicate", label.Address)
+		}
+		label.Address = cache.FormatAddress(uh)
+		byAddress[uh] = label
+	}
+	sum := sha256.Sum256(data)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.byAddress = byAddress
+	l.version = hex.EncodeToString(sum[:8])
+	return nil
+}
+
+// Lookup returns the label of the address.
+func (l *Labels) Lookup(address types.UnlockHash) (AddressLabel, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	label, has := l.byAddress[address]
+	return label, has
+}
+
+// WithTag returns labels having the tag sorted by address.
+func (l *Labels) WithTag(tag string) []AddressLabel {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var labels []AddressLabel
+	for _, label := range l.byAddress {
+		for _, t := range label.Tags {
+			if t == tag {
+				labels = append(labels, label)
+				break
+			}
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Address < labels[j].Address })
+	return labels
+}
+
+// Version identifies the content of the label file.
+func (l *Labels) Version() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.version
+}
+
+// label returns the label of the address or "" if labels are disabled
+// or the address has no label.
+func (a *api) label(address types.UnlockHash) string {
+	if a.labels == nil {
+		return ""
+	}
+	label, _ := a.labels.Lookup(address)
+	return label.Label
+}
+
+// withLabels returns arguments of checkETag for responses including
+// labels, which change when the label file is reloaded.
+func (a *api) withLabels(buildID string, immutable bool) (string, bool) {
+	if a.labels == nil {
+		return buildID, immutable
+	}
+	return buildID + "-" + a.labels.Version(), false
+}
+
+// handleLabels returns labels of addresses ?address= or labels with
+// the tag ?tag= as JSON.
+func (a *api) handleLabels(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	query := r.URL.Query()
+	resp := []AddressLabel{}
+	if tag := query.Get("tag"); tag != "" {
+		resp = append(resp, a.labels.WithTag(tag)...)
+	}
+	if len(query["address"]) > MAX_LABELS {
+		writeError(w, http.StatusBadRequest, "Want up to %d addresses, got %d.\n", MAX_LABELS, len(query["address"]))
+		return
+	}
+	for _, addressHex := range query["address"] {
+		address, err := cache.ParseAddress(addressHex)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "cache.ParseAddress(%q): %v.\n", addressHex, err)
+			return
+		}
+		if label, has := a.labels.Lookup(address); has {
+			resp = append(resp, label)
+		}
+	}
+	if len(resp) > MAX_LABELS {
+		resp = resp[:MAX_LABELS]
+	}
+	if a.checkETag(w, r, a.labels.Version(), false) {
+		return
+	}
+	writeJSON(w, r, resp)
+}
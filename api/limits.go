@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// APIVersion is the version of the API, the prefix of its paths.
+const APIVersion = "v1"
+
+// Requests of blocks and items after the tip get 404 with the header
+// X-Sialite-Not-Yet-Indexed, so clients can tell "not synced yet" from
+// "does not exist" and retry later. The body is ErrorResponse with code
+// CODE_NOT_YET_INDEXED. /v1/limits returns the range of indexed blocks
+// and items.
+
+// LimitsResponse describes the range of blocks and items served.
+type LimitsResponse struct {
+	APIVersion  string `json:"api_version"`
+	StartHeight int    `json:"start_height"`
+	TipHeight   int    `json:"tip_height"`
+	NumItems    int    `json:"num_items"`
+
+	// LastItemID is the ID of the last item (see cache.ItemID). Items
+	// with greater IDs are not yet indexed.
+	LastItemID string `json:"last_item_id"`
+
+	// Stale is set while new blocks are added to the index, so the tip
+	// may be higher soon.
+	Stale bool `json:"stale,omitempty"`
+}
+
+// writeNotYetIndexed responds to a request of a block after the tip.
+func writeNotYetIndexed(w http.ResponseWriter, tipHeight int) {
+	w.Header().Set("X-Sialite-Tip-Height", strconv.Itoa(tipHeight))
+	w.Header().Set("X-Sialite-Not-Yet-Indexed", "1")
+	writeErrorResponse(w, http.StatusNotFound, ErrorResponse{
+		Code:      CODE_NOT_YET_INDEXED,
+		Message:   fmt.Sprintf("Not yet indexed: the last block has height %d", tipHeight),
+		Retryable: true,
+		Details:   map[string]string{"tip_height": strconv.Itoa(tipHeight)},
+	})
+}
+
+// handleLimits returns LimitsResponse.
+func (a *api) handleLimits(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	if a.checkETag(w, r, t.BuildID(), false) {
+		return
+	}
+	lastItemID, err := t.LastItemID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "LastItemID: %v.\n", err)
+		log.Printf("LastItemID: %v.\n", err)
+		return
+	}
+	writeJSON(w, r, LimitsResponse{
+		APIVersion:  APIVersion,
+		StartHeight: t.StartHeight(),
+		TipHeight:   t.TipHeight(),
+		NumItems:    t.NumItems(),
+		LastItemID:  lastItemID,
+		Stale:       a.tip != nil && a.tip.Updating(),
+	})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// memoryCheckInterval is the period of checks of MemoryBudget.
+const memoryCheckInterval = 10 * time.Second
+
+// cacheShare is the part of MemoryBudget which each in-process cache
+// (results of async proofs, mempool) can take.
+const cacheShare = 8
+
+// MemoryResponse is the use of Options.MemoryBudget.
+type MemoryResponse struct {
+	Budget int64 `json:"budget"`
+
+	// Resident is the resident memory of the process, including pages
+	// of mmaped files of the index. It is 0 if unknown (not Linux).
+	Resident int64 `json:"resident"`
+
+	ProofBytes   int `json:"proof_bytes"`
+	MempoolBytes int `json:"mempool_bytes"`
+
+	// ProofEvictions and MempoolEvictions are the numbers of entries
+	// evicted from the caches to stay within their shares of the
+	// budget. PageReleases is the number of times pages of the index
+	// were released since Resident exceeded the budget.
+	ProofEvictions   int64 `json:"proof_evictions"`
+	MempoolEvictions int64 `json:"mempool_evictions"`
+	PageReleases     int64 `json:"page_releases"`
+}
+
+type memoryState struct {
+	budget int64
+
+	mu           sync.Mutex
+	resident     int64
+	pageReleases int64
+}
+
+// residentMemory returns the resident set size of the process.
+func residentMemory() (int64, error) {
+	data, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("bad /proc/self/statm: %q", data)
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad /proc/self/statm: %q", data)
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
+
+// limitCaches caps the in-process caches by their shares of the budget.
+func (a *api) limitCaches() {
+	maxBytes := int(a.memory.budget / cacheShare)
+	if a.proofs != nil {
+		a.proofs.setMaxBytes(maxBytes)
+	}
+	if a.mempool != nil {
+		a.mempool.SetMaxBytes(maxBytes)
+	}
+}
+
+// enforceMemoryBudget releases pages of the index and free memory of
+// the heap when the resident memory exceeds the budget.
+func (a *api) enforceMemoryBudget() {
+	for range time.Tick(memoryCheckInterval) {
+		resident, err := residentMemory()
+		if err != nil {
+			log.Printf("Checking memory budget: %v; only caches are limited.", err)
+			return
+		}
+		if resident > a.memory.budget {
+			t := a.acquire()
+			if err := t.Cold.ReleasePages(); err != nil {
+				log.Printf("ReleasePages: %v.", err)
+			}
+			t.Release()
+			debug.FreeOSMemory()
+			a.memory.mu.Lock()
+			a.memory.pageReleases++
+			a.memory.mu.Unlock()
+		}
+		a.memory.mu.Lock()
+		a.memory.resident = resident
+		a.memory.mu.Unlock()
+	}
+}
+
+func (a *api) handleMemory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	resp := MemoryResponse{Budget: a.memory.budget}
+	a.memory.mu.Lock()
+	resp.Resident = a.memory.resident
+	resp.PageReleases = a.memory.pageReleases
+	a.memory.mu.Unlock()
+	if a.proofs != nil {
+		resp.ProofBytes, resp.ProofEvictions = a.proofs.usage()
+	}
+	if a.mempool != nil {
+		_, resp.MempoolBytes = a.mempool.Size()
+		resp.MempoolEvictions = a.mempool.Evictions()
+	}
+	writeJSON(w, r, resp)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/mempool"
+)
+
+type MempoolEntry struct {
+	ID      string             `json:"id"`
+	Seen    int64              `json:"seen"`
+	Outputs cache.Amount       `json:"outputs"`
+	Fees    cache.Amount       `json:"fees"`
+	Tx      *types.Transaction `json:"tx"`
+}
+
+func (a *api) handleMempool(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	withSC := r.URL.Query().Get("sc") != ""
+	var entries []mempool.Entry
+	if addressHex := r.URL.Query().Get("address"); addressHex != "" {
+		address, err := cache.ParseAddress(addressHex)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "cache.ParseAddress(%q): %v.\n", addressHex, err)
+			return
+		}
+		entries = a.mempool.ByAddress(address)
+	} else {
+		entries = a.mempool.Entries()
+	}
+	result := make([]MempoolEntry, 0, len(entries))
+	for i := range entries {
+		e := &entries[i]
+		fees := types.NewCurrency64(0)
+		for _, fee := range e.Tx.MinerFees {
+			fees = fees.Add(fee)
+		}
+		result = append(result, MempoolEntry{
+			ID:      e.ID.String(),
+			Seen:    e.Seen.Unix(),
+			Outputs: cache.NewAmount(e.Tx.SiacoinOutputSum(), withSC),
+			Fees:    cache.NewAmount(fees, withSC),
+			Tx:      &e.Tx,
+		})
+	}
+	writeJSON(w, r, result)
+}
+
+// removeConfirmed removes transactions of blocks of s after the last
+// block of old (the previous version of the index) from the mempool.
+func removeConfirmed(mp *mempool.Mempool, old, s *cache.Server) {
+	start := 0
+	if old != nil {
+		start = old.StartHeight() + old.NumBlocks() - s.StartHeight()
+		if start < 0 {
+			start = 0
+		}
+	}
+	err := s.ForEachBlock(start, s.NumBlocks(), func(block *cache.DecodedBlock) error {
+		mp.RemoveConfirmed(block.Transactions)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Removing confirmed transactions from the mempool: %v.", err)
+	}
+}
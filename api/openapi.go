@@ -0,0 +1,531 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// The OpenAPI document of the API is generated from the list of routes
+// and types of their responses and served at /v1/openapi.json, so
+// clients in other languages can be generated from it.
+
+// route is an endpoint of the API.
+type route struct {
+	method  string
+	path    string // In the syntax of httprouter, e.g. /v1/block/:id.
+	handle  httprouter.Handle
+	summary string
+	params  []param
+
+	// body is a value of the type of JSON request body, if any.
+	body interface{}
+
+	// resp is a value of the type of JSON response. nil means a binary
+	// response (Sia-encoded or raw).
+	resp interface{}
+
+	// siaEncoded means the JSON response is also available Sia-encoded
+	// (see SIA_ENCODING_TYPE).
+	siaEncoded bool
+}
+
+// param is a query or path parameter of a route.
+type param struct {
+	name        string
+	typ         string // One of "string", "integer", "boolean".
+	description string
+	required    bool
+	repeated    bool
+}
+
+var (
+	pageParams = []param{
+		{name: "cursor", typ: "string", description: "Cursor of the page (X-Sialite-Next-Cursor of the previous page)."},
+		{name: "offset", typ: "string", description: "Alias of cursor."},
+		{name: "limit", typ: "integer", description: "Max number of entries of the page."},
+	}
+	scParam      = param{name: "sc", typ: "boolean", description: "Add siacoin values in SC."}
+	addressParam = param{name: "address", typ: "string", description: "Address (76 hex characters).", required: true}
+	pubkeyParam  = param{name: "pubkey", typ: "string", description: "Ed25519 public key (ed25519:<hex>).", required: true}
+	itemIDParam  = param{name: "id", typ: "string", description: "Item ID (height:t:index, see cache.ItemID).", required: true}
+	heightParam  = param{name: "height", typ: "integer", description: "Height of the block."}
+)
+
+func params(lists ...[]param) []param {
+	var all []param
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// routes returns the routes of the API with the options.
+func (a *api) routes(opts Options) []route {
+	var routes []route
+	if !opts.NoAddressLookups {
+		routes = append(routes, []route{
+			{
+				method: "GET", path: "/v1/history", handle: a.handleHistory,
+				summary: "Page of the history of the address as Sia-encoded cursor of the next page and list of cache.Item.",
+				params: params([]param{addressParam}, pageParams, []param{
+					{name: "min_confirmations", typ: "integer", description: "Stop the page before the first item with fewer confirmations; the next cursor points to it, so the page can be empty."},
+					{name: "from_height", typ: "integer", description: "Start the first page with the first item at or after the height (ignored with a cursor)."},
+					{name: "prove_absence", typ: "boolean", description: "Return the proof of absence of the address with 404."},
+					{name: "prove_entries", typ: "boolean", description: "Append the proof of all entries of the address."},
+				}),
+			},
+			{
+				method: "GET", path: "/v1/pubkey", handle: a.handlePublicKey,
+				summary: "Addresses of the public key.",
+				params:  []param{pubkeyParam},
+				resp:    PublicKeyResponse{},
+			},
+			{
+				method: "GET", path: "/v1/pubkey/history", handle: a.handlePublicKeyHistory,
+				summary: "Page of the history of addresses of the public key in the format of /v1/history.",
+				params: params([]param{pubkeyParam}, pageParams, []param{
+					{name: "multisig", typ: "boolean", description: "Include multi-signature addresses of the key."},
+				}),
+			},
+			{
+				method: "GET", path: "/v1/audit", handle: a.handleAudit,
+				summary: "Sia-encoded cache.Audit of the addresses.",
+				params: []param{
+					{name: "address", typ: "string", description: "Address (76 hex characters).", required: true, repeated: true},
+					{name: "height", typ: "integer", description: "Height of the block.", required: true},
+				},
+			},
+			{
+				method: "GET", path: "/v1/balance", handle: a.handleBalance,
+				summary: "Balance of the address.",
+				params:  []param{addressParam, heightParam, scParam},
+				resp:    Balance{},
+			},
+			{
+				method: "GET", path: "/v1/activity", handle: a.handleActivity,
+				summary: "Numbers of items of the address per day or week.",
+				params:  params([]param{addressParam, {name: "bucket", typ: "string", description: "day or week.", required: true}}, pageParams),
+				resp:    []ActivityBucket{},
+			},
+		}...)
+	}
+	routes = append(routes, []route{
+		{
+			method: "GET", path: "/v1/filters", handle: a.handleFilters,
+			summary: "Filters of blocks (see cache.BuildFilter).",
+			params: []param{
+				{name: "start", typ: "integer", description: "Index of the first block.", required: true},
+				{name: "count", typ: "integer", description: "Number of blocks."},
+			},
+			resp: []FilterResponse{},
+		},
+		{
+			method: "GET", path: "/v1/host", handle: a.handleHostActivity,
+			summary: "Announcements of the host and revisions of its contracts.",
+			params:  params([]param{pubkeyParam}, pageParams),
+			resp:    HostActivityResponse{},
+		},
+		{
+			method: "GET", path: "/v1/item", handle: a.handleItem,
+			summary: "The item by ID or by block and index, with resolved inputs.",
+			params: []param{
+				{name: "id", typ: "string", description: "Item ID (height:t:index, see cache.ItemID)."},
+				{name: "block", typ: "integer", description: "Height of the block."},
+				{name: "index", typ: "integer", description: "Index of the item in the block."},
+				scParam,
+			},
+			resp:       ItemResponse{},
+			siaEncoded: true,
+		},
+		{
+			method: "GET", path: "/v1/dag", handle: a.handleDAG,
+			summary: "Ancestors of the transaction.",
+			params:  []param{itemIDParam, {name: "blocks", typ: "integer", description: "Number of blocks before the item to look up ancestors in."}},
+			resp:    DAGResponse{},
+		},
+		{
+			method: "GET", path: "/v1/arbitrary", handle: a.handleArbitraryData,
+			summary: "Transactions with ArbitraryData starting with the prefix.",
+			params: params([]param{
+				{name: "prefix", typ: "string", description: "Hex prefix."},
+				{name: "text", typ: "string", description: "Text prefix."},
+			}, pageParams),
+			resp: []ArbitraryDataResult{},
+		},
+		{
+			method: "GET", path: "/v1/headers", handle: a.handleHeaders,
+			summary: "Raw headers of blocks.",
+			params: []param{
+				{name: "start", typ: "integer", description: "Height of the first block.", required: true},
+				{name: "parent", typ: "string", description: "ID of the block before start."},
+			},
+		},
+		{
+			method: "GET", path: "/v1/headerproof", handle: a.handleHeaderProof,
+			summary:    "Proof of the block against the headers MMR.",
+			params:     []param{{name: "height", typ: "integer", description: "Height of the block.", required: true}},
+			resp:       HeaderProofResponse{},
+			siaEncoded: true,
+		},
+		{
+			method: "GET", path: "/v1/genesis", handle: a.handleGenesis,
+			summary: "The genesis block and its outputs.",
+			params:  []param{scParam},
+			resp:    GenesisResponse{},
+		},
+		{
+			method: "GET", path: "/v1/block/:id", handle: a.handleBlock,
+			summary: "The header of the block and optionally sizes and fees of its items.",
+			params: params([]param{
+				{name: "id", typ: "string", description: "Block ID.", required: true},
+				{name: "items", typ: "boolean", description: "List items of the block."},
+				scParam,
+			}, pageParams),
+			resp: BlockResponse{},
+		},
+		{
+			method: "GET", path: "/v1/stats/contracts", handle: a.handleContractStats,
+			summary: "Time series of file contract stats.",
+			params: []param{
+				{name: "start", typ: "integer", description: "Index of the first block."},
+				{name: "end", typ: "integer", description: "Index of the block after the last one."},
+				{name: "step", typ: "integer", description: "Number of blocks per point."},
+				scParam,
+			},
+			resp: []ContractStatsPoint{},
+		},
+		{
+			method: "GET", path: "/v1/limits", handle: a.handleLimits,
+			summary: "Range of indexed blocks and items.",
+			resp:    LimitsResponse{},
+		},
+		{
+			method: "GET", path: "/v1/stats/index", handle: a.handleIndexStats,
+			summary: "Stats of the index.",
+			resp:    IndexStatsResponse{},
+		},
+		{
+			method: "GET", path: "/v1/stats/addresses", handle: a.handleTopAddresses,
+			summary: "Addresses with the most items.",
+			params:  []param{{name: "limit", typ: "integer", description: "Max number of addresses."}},
+			resp:    []TopAddressResponse{},
+		},
+		{
+			method: "POST", path: "/v1/batch", handle: handleBatch(http.HandlerFunc(a.serveQuery)),
+			summary: "Answers of many GET queries.",
+			body:    []BatchQuery{},
+			resp:    []BatchAnswer{},
+		},
+	}...)
+	if opts.MaxProofLeaves != 0 {
+		routes = append(routes, []route{
+			{
+				method: "POST", path: "/v1/proof", handle: a.handleRequestProof,
+				summary:    "Start building the proof of the item.",
+				params:     []param{itemIDParam},
+				resp:       ProofResponse{},
+				siaEncoded: true,
+			},
+			{
+				method: "GET", path: "/v1/proof/:token", handle: a.handleProof,
+				summary:    "State of the proof.",
+				params:     []param{{name: "token", typ: "string", description: "Token returned by POST /v1/proof.", required: true}},
+				resp:       ProofResponse{},
+				siaEncoded: true,
+			},
+		}...)
+	}
+	if a.labels != nil {
+		routes = append(routes, route{
+			method: "GET", path: "/v1/labels", handle: a.handleLabels,
+			summary: "Labels of the addresses or labels with the tag.",
+			params: []param{
+				{name: "address", typ: "string", description: "Address (76 hex characters).", repeated: true},
+				{name: "tag", typ: "string", description: "Tag."},
+			},
+			resp: []AddressLabel{},
+		})
+	}
+	if a.mempool != nil {
+		routes = append(routes, route{
+			method: "GET", path: "/v1/mempool", handle: a.handleMempool,
+			summary: "Unconfirmed transactions.",
+			params:  []param{{name: "address", typ: "string", description: "Address (76 hex characters)."}, scParam},
+			resp:    []MempoolEntry{},
+		})
+	}
+	if a.webhooks != nil && opts.Keys == nil && !a.webhooks.HasAllowedHosts() {
+		log.Printf("Webhooks can not be registered without Keys or allowed hosts.")
+	} else if a.webhooks != nil {
+		routes = append(routes, []route{
+			{
+				method: "POST", path: "/v1/webhooks", handle: a.handleRegisterWebhook,
+				summary: "Register a webhook.",
+				body:    WebhookRequest{},
+				resp:    WebhookResponse{},
+			},
+			{
+				method: "DELETE", path: "/v1/webhooks/:id", handle: a.handleRemoveWebhook,
+				summary: "Remove the webhook.",
+				params:  []param{{name: "id", typ: "string", description: "ID of the webhook.", required: true}},
+			},
+		}...)
+	}
+	if opts.Replication {
+		routes = append(routes, []route{
+			{
+				method: "GET", path: "/v1/replication/parameters", handle: a.handleReplicationParameters,
+				summary: "Parameters of the index.",
+				resp:    cache.Parameters{},
+			},
+			{
+				method: "GET", path: "/v1/replication/segments", handle: a.handleReplicationSegments,
+				summary: "Segments of files of the index.",
+				params:  []param{{name: "start", typ: "integer", description: "Index of the first block.", required: true}},
+				resp:    []cache.Segment{},
+			},
+			{
+				method: "POST", path: "/v1/replication/filtered", handle: a.handleReplicationFiltered,
+				summary: "Headers of blocks and their items matching address prefixes (Sia-encoded).",
+				body:    FilteredRequest{},
+			},
+		}...)
+	}
+	if a.memory != nil {
+		routes = append(routes, route{
+			method: "GET", path: "/v1/memory", handle: a.handleMemory,
+			summary: "Use of the memory budget.",
+			resp:    MemoryResponse{},
+		})
+	}
+	if opts.SyncCheck != nil {
+		routes = append(routes, route{
+			method: "GET", path: "/v1/sync", handle: a.handleSync,
+			summary: "The last comparison of the index with peers.",
+			resp:    SyncResponse{},
+		})
+	}
+	return routes
+}
+
+// OpenAPI returns the OpenAPI 3 document of the API served by
+// NewHandler with the options.
+func OpenAPI(opts Options) ([]byte, error) {
+	a := newAPI(nil, opts)
+	return openAPIDocument(a.routes(opts))
+}
+
+func openAPIDocument(routes []route) ([]byte, error) {
+	s := &schemas{
+		defs:  make(map[string]interface{}),
+		names: make(map[reflect.Type]string),
+	}
+	paths := make(map[string]map[string]interface{})
+	for _, rt := range routes {
+		p := openAPIPath(rt.path)
+		if paths[p] == nil {
+			paths[p] = make(map[string]interface{})
+		}
+		paths[p][strings.ToLower(rt.method)] = s.operation(rt)
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "sialite API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": s.defs,
+		},
+	}, "", "  ")
+}
+
+// openAPIPath converts /v1/block/:id to /v1/block/{id}.
+func openAPIPath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func (s *schemas) operation(rt route) map[string]interface{} {
+	var parameters []interface{}
+	for _, p := range rt.params {
+		in := "query"
+		if strings.Contains(rt.path, "/:"+p.name) {
+			in = "path"
+		}
+		var schema interface{} = map[string]interface{}{"type": p.typ}
+		if p.repeated {
+			schema = map[string]interface{}{"type": "array", "items": schema}
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":        p.name,
+			"in":          in,
+			"description": p.description,
+			"required":    p.required || in == "path",
+			"schema":      schema,
+		})
+	}
+	success := map[string]interface{}{"description": "OK"}
+	if rt.resp != nil {
+		content := map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(rt.resp))},
+		}
+		if rt.siaEncoded {
+			content[SIA_ENCODING_TYPE] = map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}
+		}
+		success["content"] = content
+		if rt.method == "GET" {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        "fields",
+				"in":          "query",
+				"description": "Comma separated list of fields to return.",
+				"schema":      map[string]interface{}{"type": "string"},
+			})
+		}
+	} else {
+		success["content"] = map[string]interface{}{
+			"application/octet-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+		}
+	}
+	op := map[string]interface{}{
+		"summary": rt.summary,
+		"responses": map[string]interface{}{
+			"200": success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(ErrorResponse{}))},
+				},
+			},
+		},
+	}
+	if len(parameters) != 0 {
+		op["parameters"] = parameters
+	}
+	if rt.body != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": s.schema(reflect.TypeOf(rt.body))},
+			},
+		}
+	}
+	return op
+}
+
+// schemas builds JSON schemas of Go types as encoding/json encodes them.
+// Named structs are put to components/schemas.
+type schemas struct {
+	defs  map[string]interface{}
+	names map[reflect.Type]string
+}
+
+var (
+	marshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (s *schemas) schema(t reflect.Type) map[string]interface{} {
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+	// Types of Sia (hashes, currencies, etc) are encoded as strings.
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, has := s.names[t]
+		if !has {
+			name = t.Name()
+			if _, taken := s.defs[name]; taken {
+				name = path.Base(t.PkgPath()) + "." + name
+			}
+			s.names[t] = name
+			// Reserve the name for recursive types.
+			s.defs[name] = nil
+			s.defs[name] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func (s *schemas) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	s.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (s *schemas) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !reflect.PtrTo(ft).Implements(marshalerType) {
+				s.addFields(ft, properties)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = s.schema(f.Type)
+	}
+}
+
+// handleOpenAPI returns the OpenAPI document.
+func handleOpenAPI(doc []byte) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/starius/sialite/cache"
+)
+
+// Pagination of list endpoints. Requests:
+//
+//   ?limit=  is the max number of entries of the page, up to the max
+//            of the endpoint; the max is used by default.
+//   ?cursor= is the cursor returned by the previous page; empty cursor
+//            is the first page.
+//
+// Lists of items (history, activity of hosts, search of ArbitraryData)
+// use item IDs as cursors (see cache/page.go). Lists of positions (items
+// of a block, buckets of activity) use offsets as cursors and also accept
+// ?offset=. Responses set headers:
+//
+//   X-Sialite-Next-Cursor is the cursor of the next page. It is not set
+//                         after the last page.
+//   X-Sialite-Total       is the number of entries of the whole list.
+//                         It is not set if it is not cheap to compute.
+
+// MAX_BLOCK_ITEMS is the max page of /v1/block/:id?items=.
+const MAX_BLOCK_ITEMS = 1000
+
+// MAX_ACTIVITY_BUCKETS is the max page of /v1/activity.
+const MAX_ACTIVITY_BUCKETS = 1000
+
+type page struct {
+	cursor string
+	limit  int
+}
+
+// parsePage parses ?limit= and ?cursor= (or ?offset=) and writes the
+// error to w.
+func parsePage(w http.ResponseWriter, r *http.Request, maxLimit int) (page, bool) {
+	query := r.URL.Query()
+	p := page{
+		cursor: query.Get("cursor"),
+		limit:  maxLimit,
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if p.cursor != "" {
+			writeError(w, http.StatusBadRequest, "Specify cursor or offset.\n")
+			return p, false
+		}
+		p.cursor = offset
+	}
+	if limitText := query.Get("limit"); limitText != "" {
+		limit, err := strconv.Atoi(limitText)
+		if err != nil || limit <= 0 || limit > maxLimit {
+			writeError(w, http.StatusBadRequest, "Bad limit: %q, want 1-%d.\n", limitText, maxLimit)
+			return p, false
+		}
+		p.limit = limit
+	}
+	return p, true
+}
+
+// offsetPage returns the range [start, end) of the page of the list of
+// given size for offset cursors and the cursor of the next page.
+func (p page) offsetPage(w http.ResponseWriter, size int) (start, end int, ok bool) {
+	if p.cursor != "" {
+		var err error
+		start, err = strconv.Atoi(p.cursor)
+		if err != nil || start < 0 || start > size {
+			writeError(w, http.StatusBadRequest, "Bad cursor: %q.\n", p.cursor)
+			return 0, 0, false
+		}
+	}
+	end = start + p.limit
+	if end > size {
+		end = size
+	}
+	next := ""
+	if end < size {
+		next = strconv.Itoa(end)
+	}
+	setPageHeaders(w, next, size)
+	return start, end, true
+}
+
+// writeItemPageError writes the error of a page of items.
+func writeItemPageError(w http.ResponseWriter, name string, err error) {
+	if err == cache.ErrBadCursor {
+		writeError(w, http.StatusBadRequest, "Bad cursor.\n")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "%s: %v.\n", name, err)
+	log.Printf("%s: %v.\n", name, err)
+}
+
+// setPageHeaders sets headers of the page. total < 0 means unknown.
+func setPageHeaders(w http.ResponseWriter, next string, total int) {
+	if next != "" {
+		w.Header().Set("X-Sialite-Next-Cursor", next)
+	}
+	if total >= 0 {
+		w.Header().Set("X-Sialite-Total", strconv.Itoa(total))
+	}
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// Proofs of items of huge blocks (see Options.MaxProofLeaves) are built
+// asynchronously by a few workers, so requests for them can not occupy
+// many serving goroutines. POST /v1/proof?id=<item ID> returns a token;
+// GET /v1/proof/:token returns 202 until the proof is built.
+
+// MAX_PENDING_PROOFS is the max number of proofs queued for workers.
+// Excess requests get 503.
+const MAX_PENDING_PROOFS = 100
+
+// proofResultTTL is how long built proofs are kept.
+const proofResultTTL = 10 * time.Minute
+
+// ProofResponse is the state of an async proof.
+type ProofResponse struct {
+	Token  string `json:"token"`
+	ItemID string `json:"item_id"`
+	Done   bool   `json:"done"`
+	Proof  []byte `json:"proof,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type proofJob struct {
+	token     string
+	itemID    string
+	s         *cache.Server
+	itemIndex int
+
+	// Fields below are protected by proofJobs.mu.
+	done     bool
+	proof    []byte
+	err      error
+	finished time.Time
+}
+
+type proofJobs struct {
+	mu     sync.Mutex
+	jobs   map[string]*proofJob // By token.
+	byItem map[string]*proofJob // Pending and done jobs by item ID.
+	queue  chan *proofJob
+
+	// bytes is the total size of kept proofs. If maxBytes is not 0,
+	// the oldest results are evicted to keep bytes under it.
+	bytes     int
+	maxBytes  int
+	evictions int64
+}
+
+func newProofJobs(workers int) *proofJobs {
+	if workers <= 0 {
+		workers = 1
+	}
+	p := &proofJobs{
+		jobs:   make(map[string]*proofJob),
+		byItem: make(map[string]*proofJob),
+		queue:  make(chan *proofJob, MAX_PENDING_PROOFS),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *proofJobs) work() {
+	for job := range p.queue {
+		var proof []byte
+		err := cache.Guard(func() error {
+			var err error
+			proof, err = job.s.GetItemProof(job.itemIndex)
+			return err
+		})
+		if err != nil {
+			log.Printf("GetItemProof(%s): %v.\n", job.itemID, err)
+		}
+		if err := job.s.Release(); err != nil {
+			log.Printf("Closing the old index: %v.\n", err)
+		}
+		p.mu.Lock()
+		job.done = true
+		job.proof = proof
+		job.err = err
+		job.finished = time.Now()
+		p.bytes += len(proof)
+		p.evict()
+		p.mu.Unlock()
+	}
+}
+
+// remove forgets the done job. p.mu must be held.
+func (p *proofJobs) remove(job *proofJob) {
+	delete(p.jobs, job.token)
+	if p.byItem[job.itemID] == job {
+		delete(p.byItem, job.itemID)
+	}
+	p.bytes -= len(job.proof)
+}
+
+// expire removes old results. p.mu must be held.
+func (p *proofJobs) expire(now time.Time) {
+	for _, job := range p.jobs {
+		if job.done && now.Sub(job.finished) > proofResultTTL {
+			p.remove(job)
+		}
+	}
+}
+
+// evict removes the oldest results while they take more than maxBytes.
+// p.mu must be held.
+func (p *proofJobs) evict() {
+	if p.maxBytes == 0 {
+		return
+	}
+	for p.bytes > p.maxBytes {
+		var oldest *proofJob
+		for _, job := range p.jobs {
+			if job.done && (oldest == nil || job.finished.Before(oldest.finished)) {
+				oldest = job
+			}
+		}
+		p.remove(oldest)
+		p.evictions++
+	}
+}
+
+// setMaxBytes limits the total size of kept proofs (0 = no limit).
+func (p *proofJobs) setMaxBytes(maxBytes int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxBytes = maxBytes
+	p.evict()
+}
+
+// usage returns the total size of kept proofs and the number of
+// evicted results.
+func (p *proofJobs) usage() (bytes int, evictions int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.bytes, p.evictions
+}
+
+// submit returns the job building the proof of the item, reusing the
+// job of the same item of the same index. It returns nil if the queue
+// is full.
+func (p *proofJobs) submit(s *cache.Server, itemID string, itemIndex int) *proofJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire(time.Now())
+	if job := p.byItem[itemID]; job != nil && job.s == s {
+		return job
+	}
+	var tokenBytes [16]byte
+	if _, err := rand.Read(tokenBytes[:]); err != nil {
+		log.Printf("rand.Read: %v.\n", err)
+		return nil
+	}
+	job := &proofJob{
+		token:     hex.EncodeToString(tokenBytes[:]),
+		itemID:    itemID,
+		s:         s,
+		itemIndex: itemIndex,
+	}
+	// The index is pinned until the proof is built, since it may be
+	// replaced meanwhile. It is pinned by the request, so it is open.
+	s.Acquire()
+	select {
+	case p.queue <- job:
+	default:
+		s.Release()
+		return nil
+	}
+	p.jobs[job.token] = job
+	p.byItem[itemID] = job
+	return job
+}
+
+// state returns the response of the job and if it is known.
+func (p *proofJobs) state(token string) (ProofResponse, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job, has := p.jobs[token]
+	if !has {
+		return ProofResponse{}, false
+	}
+	resp := ProofResponse{
+		Token:  job.token,
+		ItemID: job.itemID,
+		Done:   job.done,
+		Proof:  job.proof,
+	}
+	if job.err != nil {
+		resp.Error = job.err.Error()
+	}
+	return resp, true
+}
+
+func writeProofState(w http.ResponseWriter, r *http.Request, resp ProofResponse) {
+	if _, binary := negotiate(w, r, ""); binary && resp.Done && resp.Error == "" {
+		// The proof in the format of cache.Item.MerkleProof.
+		writeSiaEncoded(w, http.StatusOK, resp.Proof)
+		return
+	}
+	if !resp.Done {
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+	}
+	writeJSON(w, r, resp)
+}
+
+// handleRequestProof starts building the proof of the item ?id=.
+func (a *api) handleRequestProof(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	idText := r.URL.Query().Get("id")
+	id, err := cache.ParseItemID(idText)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cache.ParseItemID: %v.\n", err)
+		return
+	}
+	if t.CheckHeight(id.Height) != nil {
+		writeNotYetIndexed(w, t.TipHeight())
+		return
+	}
+	s, _ := t.Layer(id.Height)
+	if s == nil {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		return
+	}
+	itemIndex, err := s.ItemIndex(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		return
+	}
+	job := a.proofs.submit(s, id.String(), itemIndex)
+	if job == nil {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "Too many pending proofs.\n")
+		return
+	}
+	resp, _ := a.proofs.state(job.token)
+	w.Header().Set("Location", "/v1/proof/"+job.token)
+	writeProofState(w, r, resp)
+}
+
+// handleProof returns the state of the proof requested before.
+func (a *api) handleProof(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	resp, has := a.proofs.state(ps.ByName("token"))
+	if !has {
+		writeError(w, http.StatusNotFound, "Unknown or expired token.\n")
+		return
+	}
+	writeProofState(w, r, resp)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParseTrustedProxies parses a comma-separated list of IP addresses
+// and CIDR networks, e.g. "127.0.0.1,10.0.0.0/8".
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("bad IP address: %q", part)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("net.ParseCIDR(%q): %v", part, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client of the request. If the
+// request came from a trusted proxy, the address is taken from header
+// X-Forwarded-For: it is the rightmost address not added by a trusted
+// proxy. Addresses to the left of it can be forged by the client.
+func clientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrusted(ip, trusted) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		next := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if next == nil {
+			break
+		}
+		ip = next
+		if !isTrusted(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+// maxIdleBuckets is the number of buckets of ipLimiter after which
+// full buckets are removed.
+const maxIdleBuckets = 10000
+
+// ipLimiter limits the rate of requests per client address.
+type ipLimiter struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (l *ipLimiter) take(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buckets) >= maxIdleBuckets {
+		// Buckets which would be full now are equal to new buckets.
+		for key, b := range l.buckets {
+			if now.Sub(b.last).Seconds()*l.rate+b.tokens >= float64(l.burst) {
+				delete(l.buckets, key)
+			}
+		}
+	}
+	b, has := l.buckets[ip]
+	if !has {
+		b = &tokenBucket{}
+		l.buckets[ip] = b
+	}
+	return b.take(now, l.rate, l.burst)
+}
+
+// limitRate limits the rate of requests per client address (see
+// clientIP) to rate requests per second with bursts of burst requests.
+func limitRate(handler http.Handler, rate float64, burst int, trusted []*net.IPNet) http.Handler {
+	if rate <= 0 {
+		return handler
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	l := &ipLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r, trusted).String()
+		if !l.take(ip, time.Now()) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "Rate limit exceeded.\n")
+			return
+		}
+		take := func() bool {
+			return l.take(ip, time.Now())
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateKey{}, take)))
+	})
+}
+
+// rateKey is the key of the rate limit of the client in the context of
+// the request (see takeRate).
+type rateKey struct{}
+
+// takeRate takes a token from the rate limit of the client of the
+// request, e.g. for a query of /v1/batch. It returns false if the client
+// exceeded the limit.
+func takeRate(r *http.Request) bool {
+	take, ok := r.Context().Value(rateKey{}).(func() bool)
+	return !ok || take()
+}
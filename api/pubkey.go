@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// PublicKeyResponse lists addresses of single-signature unlock
+// conditions of an ed25519 key (see cache.Tiered.AddressesOfPublicKey).
+// Addresses[0] is the standard address of the key. Multisig lists
+// addresses of multi-signature unlock conditions with the key, if the
+// index has them (see cache.Parameters.MultisigKeys).
+type PublicKeyResponse struct {
+	Key       string   `json:"key"`
+	Addresses []string `json:"addresses"`
+	Multisig  []string `json:"multisig,omitempty"`
+}
+
+// parsePublicKey parses ?pubkey= and writes the error to w.
+func parsePublicKey(w http.ResponseWriter, r *http.Request) (crypto.PublicKey, bool) {
+	keyText := r.URL.Query().Get("pubkey")
+	pk, err := cache.ParsePublicKey(keyText)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "cache.ParsePublicKey(%q): %v.\n", keyText, err)
+		return pk, false
+	}
+	return pk, true
+}
+
+// handlePublicKey returns addresses of the ed25519 key ?pubkey= as JSON.
+func (a *api) handlePublicKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pk, ok := parsePublicKey(w, r)
+	if !ok {
+		return
+	}
+	t := a.snapshot(w, r)
+	if a.checkETag(w, r, t.BuildID(), false) {
+		return
+	}
+	resp := PublicKeyResponse{
+		Key: fmt.Sprintf("ed25519:%x", pk[:]),
+	}
+	for _, uh := range t.AddressesOfPublicKey(pk) {
+		resp.Addresses = append(resp.Addresses, cache.FormatAddress(uh))
+	}
+	for _, uh := range t.MultisigAddressesOfPublicKey(pk) {
+		resp.Multisig = append(resp.Multisig, cache.FormatAddress(uh))
+	}
+	writeJSON(w, r, resp)
+}
+
+// handlePublicKeyHistory returns a page (see page.go) of the history of
+// all addresses of the ed25519 key ?pubkey= in the format of /v1/history
+// without proofs. With ?multisig=1 multi-signature addresses of the key
+// are included.
+func (a *api) handlePublicKeyHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pk, ok := parsePublicKey(w, r)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(w, r, cache.MAX_HISTORY_SIZE)
+	if !ok {
+		return
+	}
+	t := a.snapshot(w, r)
+	if a.checkETag(w, r, t.BuildID(), false) {
+		return
+	}
+	addresses := t.AddressesOfPublicKey(pk)
+	if r.URL.Query().Get("multisig") != "" {
+		addresses = append(addresses, t.MultisigAddressesOfPublicKey(pk)...)
+	}
+	page, err := t.GetHistoryOfAddressesPage(addresses, p.cursor, p.limit)
+	if err != nil {
+		writeItemPageError(w, "GetHistoryOfAddressesPage", err)
+		return
+	}
+	history := page.Items
+	w.Header().Set("X-Sialite-Tip-Height", strconv.Itoa(t.TipHeight()))
+	setPageHeaders(w, page.Next, page.Total)
+	if len(history) == 0 {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		return
+	}
+	selectItemFields(r, history)
+	var buf bytes.Buffer
+	if err := encoding.NewEncoder(&buf).EncodeAll(page.Next, history); err != nil {
+		writeError(w, http.StatusInternalServerError, "Encode: %v.\n", err)
+		log.Printf("Encode: %v.\n", err)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// MaxSegments is the max number of segments returned by
+// /v1/replication/segments.
+const MaxSegments = 100
+
+// MaxFilteredBlocks is the max number of blocks returned by
+// /v1/replication/filtered.
+const MaxFilteredBlocks = 100
+
+// maxFilteredRequest limits the body of /v1/replication/filtered.
+const maxFilteredRequest = 1 << 20
+
+// FilteredRequest asks for blocks starting with block Start filtered by
+// address prefixes (hex, see cache.GetFilteredBlock).
+type FilteredRequest struct {
+	Start    int      `json:"start"`
+	Prefixes []string `json:"prefixes"`
+}
+
+func (a *api) handleReplicationParameters(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	data, err := a.server(r).ParametersJSON()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "ParametersJSON: %v.\n", err)
+		log.Printf("ParametersJSON: %v.\n", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// handleReplicationSegments returns Sia-encoded list of segments
+// of blocks starting with block start. The list is empty if the
+// leader has no blocks after start.
+func (a *api) handleReplicationSegments(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s := a.server(r)
+	startStr := r.URL.Query().Get("start")
+	start, err := strconv.Atoi(startStr)
+	if err != nil || start < 0 {
+		writeError(w, http.StatusBadRequest, "Bad start: %q.\n", startStr)
+		return
+	}
+	end := start + MaxSegments
+	// A full page of final blocks does not change.
+	immutable := isFinal(end-1, s.NumBlocks())
+	if end > s.NumBlocks() {
+		end = s.NumBlocks()
+	}
+	if a.checkETag(w, r, s.BuildID(), immutable) {
+		return
+	}
+	segments := []cache.Segment{}
+	for i := start; i < end; i++ {
+		seg, err := s.GetSegment(i)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "GetSegment(%d): %v.\n", i, err)
+			log.Printf("GetSegment(%d): %v.\n", i, err)
+			return
+		}
+		segments = append(segments, seg)
+	}
+	var buf bytes.Buffer
+	if err := encoding.NewEncoder(&buf).Encode(segments); err != nil {
+		writeError(w, http.StatusInternalServerError, "Encode: %v.\n", err)
+		log.Printf("Encode: %v.\n", err)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.Header().Set("X-Sialite-Blocks", strconv.Itoa(s.NumBlocks()))
+	w.WriteHeader(http.StatusOK)
+	buf.WriteTo(w)
+}
+
+// handleReplicationFiltered returns Sia-encoded list of
+// cache.FilteredBlock of blocks starting with block start for
+// watch-only nodes. The list is empty if there are no blocks after
+// start.
+func (a *api) handleReplicationFiltered(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req FilteredRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxFilteredRequest)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad request: %v.\n", err)
+		return
+	}
+	prefixes := make([][]byte, 0, len(req.Prefixes))
+	for _, prefixHex := range req.Prefixes {
+		prefix, err := hex.DecodeString(prefixHex)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Bad prefix %q: %v.\n", prefixHex, err)
+			return
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := cache.CheckFilterPrefixes(prefixes); err != nil {
+		writeError(w, http.StatusBadRequest, "%v.\n", err)
+		return
+	}
+	s := a.server(r)
+	if req.Start < 0 {
+		writeError(w, http.StatusBadRequest, "Bad start: %d.\n", req.Start)
+		return
+	}
+	end := req.Start + MaxFilteredBlocks
+	if end > s.NumBlocks() {
+		end = s.NumBlocks()
+	}
+	blocks := []cache.FilteredBlock{}
+	for i := req.Start; i < end; i++ {
+		fb, err := s.GetFilteredBlock(i, prefixes)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "GetFilteredBlock(%d): %v.\n", i, err)
+			log.Printf("GetFilteredBlock(%d): %v.\n", i, err)
+			return
+		}
+		blocks = append(blocks, fb)
+	}
+	w.Header().Set("X-Sialite-Blocks", strconv.Itoa(s.NumBlocks()))
+	writeSiaEncoded(w, http.StatusOK, blocks)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+)
+
+// MaxStatsPoints is the max number of points returned by /v1/stats/*.
+const MaxStatsPoints = 1000
+
+// ContractStatsPoint is cache.ContractStats of blocks [Start, End).
+type ContractStatsPoint struct {
+	Start           int          `json:"start"`
+	End             int          `json:"end"`
+	Contracts       int          `json:"contracts"`
+	Revisions       int          `json:"revisions"`
+	FileSize        uint64       `json:"file_size"`
+	RevisedFileSize uint64       `json:"revised_file_size"`
+	Payout          cache.Amount `json:"payout"`
+	HostOutputs     cache.Amount `json:"host_outputs"`
+}
+
+// parseRange parses ?start=, ?end= and ?step= of /v1/stats/* requests.
+// By default, the range covers all blocks and has one step.
+func parseRange(r *http.Request, nblocks int) (start, end, step int, err error) {
+	query := r.URL.Query()
+	start, end = 0, nblocks
+	if v := query.Get("start"); v != "" {
+		if start, err = strconv.Atoi(v); err != nil {
+			return 0, 0, 0, fmt.Errorf("bad start: %q", v)
+		}
+	}
+	if v := query.Get("end"); v != "" {
+		if end, err = strconv.Atoi(v); err != nil {
+			return 0, 0, 0, fmt.Errorf("bad end: %q", v)
+		}
+	}
+	if end > nblocks {
+		end = nblocks
+	}
+	if start < 0 || start >= end {
+		return 0, 0, 0, fmt.Errorf("bad range: [%d, %d)", start, end)
+	}
+	step = end - start
+	if v := query.Get("step"); v != "" {
+		if step, err = strconv.Atoi(v); err != nil || step <= 0 {
+			return 0, 0, 0, fmt.Errorf("bad step: %q", v)
+		}
+	}
+	if (end-start+step-1)/step > MaxStatsPoints {
+		return 0, 0, 0, fmt.Errorf("too many points, max %d", MaxStatsPoints)
+	}
+	return start, end, step, nil
+}
+
+// handleContractStats returns the time series of file contract stats
+// as JSON list of ContractStatsPoint.
+func (a *api) handleContractStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	s := a.server(r)
+	start, end, step, err := parseRange(r, s.NumBlocks())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v.\n", err)
+		return
+	}
+	if a.checkETag(w, r, s.BuildID(), isFinal(end-1, s.NumBlocks())) {
+		return
+	}
+	withSC := r.URL.Query().Get("sc") != ""
+	points := []ContractStatsPoint{}
+	for pointStart := start; pointStart < end; pointStart += step {
+		pointEnd := pointStart + step
+		if pointEnd > end {
+			pointEnd = end
+		}
+		stats, err := s.SumContractStats(pointStart, pointEnd)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "SumContractStats: %v.\n", err)
+			log.Printf("SumContractStats: %v.\n", err)
+			return
+		}
+		points = append(points, ContractStatsPoint{
+			Start:           pointStart,
+			End:             pointEnd,
+			Contracts:       stats.Contracts,
+			Revisions:       stats.Revisions,
+			FileSize:        stats.FileSize,
+			RevisedFileSize: stats.RevisedFileSize,
+			Payout:          cache.NewAmount(stats.Payout, withSC),
+			HostOutputs:     cache.NewAmount(stats.HostOutputs, withSC),
+		})
+	}
+	writeJSON(w, r, points)
+}
+
+// IndexStatsResponse is the layout of the indices (see cache.IndexStats).
+// Hot is the index of recent blocks, if any.
+type IndexStatsResponse struct {
+	Cold cache.IndexStats  `json:"cold"`
+	Hot  *cache.IndexStats `json:"hot,omitempty"`
+}
+
+// handleIndexStats returns IndexStatsResponse as JSON. cache.Server.Stats
+// reads all pages of the address index, so the response is kept until
+// the indices change.
+func (a *api) handleIndexStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	t := a.snapshot(w, r)
+	buildID := t.BuildID()
+	if a.checkETag(w, r, buildID, false) {
+		return
+	}
+	a.indexStatsMu.Lock()
+	if a.indexStatsBuildID != buildID {
+		resp := &IndexStatsResponse{
+			Cold: t.Cold.Stats(),
+		}
+		if t.Hot != nil {
+			hot := t.Hot.Stats()
+			resp.Hot = &hot
+		}
+		a.indexStats = resp
+		a.indexStatsBuildID = buildID
+	}
+	resp := a.indexStats
+	a.indexStatsMu.Unlock()
+	writeJSON(w, r, resp)
+}
+
+// TopAddressResponse is an address with the most items.
+type TopAddressResponse struct {
+	Address string `json:"address"`
+	Label   string `json:"label,omitempty"`
+	Items   int    `json:"items"`
+}
+
+// handleTopAddresses returns up to ?limit= addresses of the cold index
+// with the most items as JSON list of TopAddressResponse.
+func (a *api) handleTopAddresses(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	p, ok := parsePage(w, r, cache.TOP_ADDRESSES)
+	if !ok {
+		return
+	}
+	s := a.server(r)
+	buildID, immutable := a.withLabels(s.BuildID(), false)
+	if a.checkETag(w, r, buildID, immutable) {
+		return
+	}
+	top, err := s.TopAddresses(p.limit)
+	if err == cache.ErrNoTopAddresses {
+		writeError(w, http.StatusNotFound, "%v.\n", err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "TopAddresses: %v.\n", err)
+		log.Printf("TopAddresses: %v.\n", err)
+		return
+	}
+	resp := make([]TopAddressResponse, 0, len(top))
+	for _, t := range top {
+		resp = append(resp, TopAddressResponse{
+			Address: cache.FormatAddress(t.Address),
+			Label:   a.label(t.Address),
+			Items:   t.Items,
+		})
+	}
+	writeJSON(w, r, resp)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Each request gets a server span named by its route, e.g.
+// "GET /v1/history", with child spans of the subsystems of cache (see
+// cache.Tracer). The duration of the request is recorded in the
+// histogram instrumentationName/request.duration in the context of the
+// span, so exporters supporting exemplars link slow buckets to traces.
+
+const instrumentationName = "github.com/starius/sialite/api"
+
+// otelTracer makes spans of cache with an OpenTelemetry tracer.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+func (t otelTracer) StartSpan(ctx context.Context, name string) (context.Context, func()) {
+	ctx, span := t.tracer.Start(ctx, name)
+	return ctx, func() { span.End() }
+}
+
+// statusWriter remembers the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+// tracing instruments handlers of routes.
+type tracing struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram // nil without MeterProvider.
+}
+
+func newTracing(opts Options) *tracing {
+	if opts.TracerProvider == nil {
+		return nil
+	}
+	t := &tracing{
+		tracer: opts.TracerProvider.Tracer(instrumentationName),
+	}
+	if opts.MeterProvider != nil {
+		meter := opts.MeterProvider.Meter(instrumentationName)
+		duration, err := meter.Float64Histogram(
+			"request.duration",
+			metric.WithUnit("s"),
+			metric.WithDescription("Duration of requests by route."),
+		)
+		if err != nil {
+			log.Printf("meter.Float64Histogram: %v.", err)
+		} else {
+			t.duration = duration
+		}
+	}
+	return t
+}
+
+// handle wraps the handler of the route in a span.
+func (t *tracing) handle(rt route) httprouter.Handle {
+	name := rt.method + " " + rt.path
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		started := time.Now()
+		ctx, span := t.tracer.Start(
+			r.Context(), name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", rt.method),
+				attribute.String("http.route", rt.path),
+			),
+		)
+		defer span.End()
+		ctx = cache.WithTracer(ctx, otelTracer{tracer: t.tracer})
+		sw := &statusWriter{ResponseWriter: w}
+		rt.handle(sw, r.WithContext(ctx), ps)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+		if t.duration != nil {
+			t.duration.Record(
+				ctx, time.Since(started).Seconds(),
+				metric.WithAttributes(
+					attribute.String("http.route", rt.path),
+					attribute.Int("http.status_code", sw.status),
+				),
+			)
+		}
+	}
+}
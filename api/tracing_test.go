@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/cache/cachetest"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// statusOf returns the attribute http.status_code of the span.
+func statusOf(span sdktrace.ReadOnlySpan) int64 {
+	for _, kv := range span.Attributes() {
+		if kv.Key == "http.status_code" {
+			return kv.Value.AsInt64()
+		}
+	}
+	return -1
+}
+
+func TestTracing(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	addresses, err := cachetest.ReadAddresses()
+	if err != nil {
+		t.Fatalf("cachetest.ReadAddresses: %v", err)
+	}
+	s := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	handler := NewHandler(s, Options{TracerProvider: tp})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/history?address="+addresses[0], nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /v1/history: status %d: %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/history?address=bad", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("GET /v1/history with bad address: status %d, want 400", rec.Code)
+	}
+
+	var servers []sdktrace.ReadOnlySpan
+	children := make(map[trace.SpanID][]string)
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer {
+			servers = append(servers, span)
+		} else {
+			parent := span.Parent().SpanID()
+			children[parent] = append(children[parent], span.Name())
+		}
+	}
+	if len(servers) != 2 {
+		t.Fatalf("got %d server spans, want 2", len(servers))
+	}
+	for i, wantStatus := range []int64{http.StatusOK, http.StatusBadRequest} {
+		span := servers[i]
+		if span.Name() != "GET /v1/history" {
+			t.Errorf("span %d is named %q, want %q", i, span.Name(), "GET /v1/history")
+		}
+		if status := statusOf(span); status != wantStatus {
+			t.Errorf("span %d has http.status_code %d, want %d", i, status, wantStatus)
+		}
+		// Only server errors are errors of spans.
+		if span.Status().Code == codes.Error {
+			t.Errorf("span %d has error status", i)
+		}
+	}
+	hasLookup := false
+	for _, name := range children[servers[0].SpanContext().SpanID()] {
+		if name == cache.SPAN_FASTMAP_LOOKUP {
+			hasLookup = true
+		}
+	}
+	if !hasLookup {
+		t.Errorf("the span of the history request has no child span %s, got %v", cache.SPAN_FASTMAP_LOOKUP, children[servers[0].SpanContext().SpanID()])
+	}
+	if len(children[servers[1].SpanContext().SpanID()]) != 0 {
+		t.Errorf("the span of the bad request has child spans %v", children[servers[1].SpanContext().SpanID()])
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/julienschmidt/httprouter"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/webhook"
+)
+
+// maxWebhookRequest is the max size of body of POST /v1/webhooks.
+const maxWebhookRequest = 64 * 1024
+
+type WebhookRequest struct {
+	URL              string   `json:"url"`
+	Addresses        []string `json:"addresses"`
+	MinConfirmations int      `json:"min_confirmations"`
+}
+
+type WebhookResponse struct {
+	ID string `json:"id"`
+}
+
+// handleRegisterWebhook registers the webhook described by JSON
+// WebhookRequest and returns WebhookResponse.
+func (a *api) handleRegisterWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req WebhookRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxWebhookRequest)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad request: %v.\n", err)
+		return
+	}
+	addresses := make([]types.UnlockHash, 0, len(req.Addresses))
+	for _, addressHex := range req.Addresses {
+		address, err := cache.ParseAddress(addressHex)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "cache.ParseAddress(%q): %v.\n", addressHex, err)
+			return
+		}
+		addresses = append(addresses, address)
+	}
+	hook, err := a.webhooks.Register(req.URL, addresses, req.MinConfirmations, a.server(r).NumBlocks())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Register: %v.\n", err)
+		log.Printf("Register: %v.\n", err)
+		return
+	}
+	writeJSON(w, r, WebhookResponse{ID: hook.ID})
+}
+
+func (a *api) handleRemoveWebhook(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := a.webhooks.Remove(ps.ByName("id")); err == webhook.ErrNoHook {
+		writeError(w, http.StatusNotFound, "Not found.\n")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "Remove: %v.\n", err)
+		log.Printf("Remove: %v.\n", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
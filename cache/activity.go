@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Sizes of buckets of AddressActivity in seconds.
+const (
+	BUCKET_DAY  = 24 * 60 * 60
+	BUCKET_WEEK = 7 * BUCKET_DAY
+)
+
+// ActivityBucket is the number of items of an address in the blocks
+// with timestamps in [Start, Start+bucket).
+type ActivityBucket struct {
+	Start types.Timestamp
+	Items int
+}
+
+// AddressActivity returns the numbers of items of the address per time
+// bucket of given size in seconds, ordered by Start. Buckets without
+// items are omitted. Items are not decoded: the block of an item is
+// found by its index and its time is the timestamp of the block.
+// So if AddressPrefixLen is less than the size of the address, items
+// of other addresses having the same prefix are counted as well.
+func (s *Server) AddressActivity(address []byte, bucket int) ([]ActivityBucket, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("bad size of bucket: %d", bucket)
+	}
+	items, err := s.addressItems(address)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[types.Timestamp]int)
+	prevBlock := -1
+	var start types.Timestamp
+	for _, itemIndex := range items {
+		if blockIndex := s.blockOfItem(itemIndex); blockIndex != prevBlock {
+			header, err := s.GetBlockHeader(blockIndex)
+			if err != nil {
+				return nil, err
+			}
+			start = header.Timestamp - header.Timestamp%types.Timestamp(bucket)
+			prevBlock = blockIndex
+		}
+		counts[start]++
+	}
+	// Timestamps of blocks are not monotonic, so buckets are sorted.
+	buckets := make([]ActivityBucket, 0, len(counts))
+	for start, n := range counts {
+		buckets = append(buckets, ActivityBucket{Start: start, Items: n})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start < buckets[j].Start
+	})
+	return buckets, nil
+}
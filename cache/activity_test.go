@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestAddressActivity(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	addresses, err := readAddresses()
+	if err != nil {
+		t.Fatalf("readAddresses: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	for _, address := range addresses {
+		uh, err := ParseAddress(address)
+		if err != nil {
+			t.Fatalf("ParseAddress(%s): %v", address, err)
+		}
+		items, err := s.addressItems(uh[:])
+		if err != nil {
+			t.Fatalf("addressItems: %v", err)
+		}
+		for _, bucket := range []int{BUCKET_DAY, BUCKET_WEEK} {
+			buckets, err := s.AddressActivity(uh[:], bucket)
+			if err != nil {
+				t.Fatalf("AddressActivity(%s, %d): %v", address, bucket, err)
+			}
+			total := 0
+			for i, b := range buckets {
+				total += b.Items
+				if int(b.Start)%bucket != 0 {
+					t.Errorf("AddressActivity(%s, %d): bucket starts at %d", address, bucket, b.Start)
+				}
+				if i > 0 && buckets[i-1].Start >= b.Start {
+					t.Errorf("AddressActivity(%s, %d): buckets are not ordered", address, bucket)
+				}
+			}
+			if total != len(items) {
+				t.Errorf("AddressActivity(%s, %d): %d items, want %d", address, bucket, total, len(items))
+			}
+		}
+	}
+	if _, err := s.AddressActivity(make([]byte, 32), 0); err == nil {
+		t.Errorf("AddressActivity accepted bucket 0")
+	}
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// addressLen is the length of the standard text form of an address:
+// hex of the unlock hash followed by hex of its checksum.
+const addressLen = 2 * (crypto.HashSize + types.UnlockHashChecksumSize)
+
+var (
+	ErrAddressNoChecksum  = fmt.Errorf("address has no checksum; use the standard %d-character form", addressLen)
+	ErrAddressBadLength   = fmt.Errorf("address must have %d hex characters", addressLen)
+	ErrAddressBadChecksum = fmt.Errorf("address checksum mismatch")
+)
+
+// ParseAddress parses an address in the standard text form (76 hex
+// characters including checksum) and returns the unlock hash.
+// Unlike silently truncating the input, it rejects raw 32-byte hashes
+// and addresses with a wrong checksum.
+func ParseAddress(address string) (types.UnlockHash, error) {
+	var uh types.UnlockHash
+	if len(address) == 2*crypto.HashSize {
+		return uh, ErrAddressNoChecksum
+	} else if len(address) != addressLen {
+		return uh, ErrAddressBadLength
+	}
+	if _, err := hex.DecodeString(address); err != nil {
+		return uh, fmt.Errorf("address is not valid hex: %v", err)
+	}
+	if err := uh.LoadString(address); err != nil {
+		return uh, ErrAddressBadChecksum
+	}
+	return uh, nil
+}
+
+// FormatAddress returns the standard text form of the unlock hash.
+func FormatAddress(uh types.UnlockHash) string {
+	return uh.String()
+}
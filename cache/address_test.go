@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	addresses, err := readAddresses()
+	if err != nil {
+		t.Fatalf("readAddresses: %v", err)
+	}
+	for _, address := range addresses {
+		uh, err := ParseAddress(address)
+		if err != nil {
+			t.Errorf("ParseAddress(%s): %v", address, err)
+			continue
+		}
+		if got := FormatAddress(uh); got != address {
+			t.Errorf("FormatAddress(ParseAddress(%s)) = %s", address, got)
+		}
+		if _, err := ParseAddress(address[:64]); err != ErrAddressNoChecksum {
+			t.Errorf("ParseAddress(%s): want ErrAddressNoChecksum, got %v", address[:64], err)
+		}
+		// Change the last character of the checksum.
+		last := address[len(address)-1]
+		wrong := byte('0')
+		if last == '0' {
+			wrong = '1'
+		}
+		bad := address[:len(address)-1] + string(wrong)
+		if _, err := ParseAddress(bad); err != ErrAddressBadChecksum {
+			t.Errorf("ParseAddress(%s): want ErrAddressBadChecksum, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// With Parameters.AddressHeights each item index in a list of the
+// address index is followed by the height of the block of the item
+// (uvarint), so a height can be found in the list without reading
+// items. Inlined lists of one or two items have no heights; they are
+// found by the blocks of the items.
+
+// heightOfValue is the suffix of values of the address index (see
+// fastmap.MultiMapWriter.SetValueSuffix).
+func (s *Builder) heightOfValue(value []byte) []byte {
+	var tmp [8]byte
+	copy(tmp[:], value)
+	// Value 0 is special on wire, so all indices are shifted.
+	itemIndex := binary.LittleEndian.Uint64(tmp[:]) - 1
+	blockIndex := sort.Search(len(s.blockStarts), func(i int) bool {
+		return s.blockStarts[i] > itemIndex
+	}) - 1
+	n := binary.PutUvarint(s.heightSuffix, uint64(s.startHeight+blockIndex))
+	return s.heightSuffix[:n]
+}
+
+// lookupAddress returns the values of the address index under the
+// prefix without heights and the heights of the blocks of the items if
+// the index has them (see Parameters.AddressHeights), otherwise nil.
+func (s *Server) lookupAddress(prefix []byte) ([]byte, []int, error) {
+	values, inlined, err := s.addressMap.LookupInlined(prefix)
+	if err != nil || values == nil || !s.par.AddressHeights {
+		return values, nil, err
+	}
+	var tmp [8]byte
+	if inlined {
+		var heights []int
+		for pos := 0; pos+s.offsetIndexLen <= len(values); pos += s.offsetIndexLen {
+			copy(tmp[:], values[pos:pos+s.offsetIndexLen])
+			itemIndex := int(binary.LittleEndian.Uint64(tmp[:])) - 1
+			heights = append(heights, s.StartHeight()+s.blockOfItem(itemIndex))
+		}
+		return values, heights, nil
+	}
+	stripped := make([]byte, 0, len(values))
+	var heights []int
+	for pos := 0; pos < len(values); {
+		if pos+s.offsetIndexLen > len(values) {
+			return nil, nil, fmt.Errorf("Error in database: truncated list of address index")
+		}
+		stripped = append(stripped, values[pos:pos+s.offsetIndexLen]...)
+		pos += s.offsetIndexLen
+		height, n := binary.Uvarint(values[pos:])
+		if n <= 0 {
+			return nil, nil, fmt.Errorf("Error in database: bad height in address index")
+		}
+		pos += n
+		heights = append(heights, int(height))
+	}
+	return stripped, heights, nil
+}
+
+// HistoryCursorAt returns the cursor of the page of the history of the
+// address starting with its first item in a block with height not less
+// than height or "" if there are no such items. Indices built without
+// Parameters.AddressHeights find the block of each checked item.
+func (s *Server) HistoryCursorAt(address []byte, height int) (string, error) {
+	if len(address) != crypto.HashSize {
+		return "", fmt.Errorf("size of address: want %d, got %d", crypto.HashSize, len(address))
+	}
+	values, heights, err := s.lookupAddress(address[:s.addressPrefixLen])
+	if err != nil || values == nil {
+		return "", err
+	}
+	itemIndices := s.decodeAddressItems(values)
+	var pos int
+	if heights != nil && len(heights) == len(itemIndices) {
+		pos = sort.SearchInts(heights, height)
+	} else {
+		pos = sort.Search(len(itemIndices), func(i int) bool {
+			return s.StartHeight()+s.blockOfItem(itemIndices[i]) >= height
+		})
+	}
+	return s.cursorAt(itemIndices, pos)
+}
+
+// HistoryCursorAt is like Server.HistoryCursorAt, but finds the item in
+// both indices.
+func (t *Tiered) HistoryCursorAt(address []byte, height int) (string, error) {
+	if t.Hot == nil {
+		return t.Cold.HistoryCursorAt(address, height)
+	}
+	if height < t.Hot.StartHeight() {
+		cursor, err := t.Cold.HistoryCursorAt(address, height)
+		if err != nil || cursor != "" {
+			return cursor, err
+		}
+	}
+	return t.Hot.HistoryCursorAt(address, height)
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddressHeights(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	p := testParameters()
+	p.AddressTree = true
+	plain := buildTestServer(t, p, blocks)
+	p.AddressHeights = true
+	withHeights := buildTestServer(t, p, blocks)
+	top, err := plain.TopAddresses(5)
+	if err != nil {
+		t.Fatalf("TopAddresses: %v", err)
+	}
+	for _, a := range top {
+		want, err := plain.addressItems(a.Address[:])
+		if err != nil {
+			t.Fatalf("addressItems: %v", err)
+		}
+		got, err := withHeights.addressItems(a.Address[:])
+		if err != nil {
+			t.Fatalf("addressItems: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("address %s: items differ", FormatAddress(a.Address))
+		}
+		_, heights, err := withHeights.lookupAddress(a.Address[:32])
+		if err != nil || len(heights) != len(want) {
+			t.Fatalf("lookupAddress returned %d heights, %v; want %d", len(heights), err, len(want))
+		}
+		for i, itemIndex := range want {
+			if heights[i] != plain.blockOfItem(itemIndex) {
+				t.Errorf("height of item %d is %d, want %d", itemIndex, heights[i], plain.blockOfItem(itemIndex))
+			}
+		}
+		for _, height := range []int{0, 1, 100, 500, 999, 1000} {
+			wantCursor, err := plain.HistoryCursorAt(a.Address[:], height)
+			if err != nil {
+				t.Fatalf("HistoryCursorAt: %v", err)
+			}
+			gotCursor, err := withHeights.HistoryCursorAt(a.Address[:], height)
+			if err != nil {
+				t.Fatalf("HistoryCursorAt: %v", err)
+			}
+			if gotCursor != wantCursor {
+				t.Errorf("HistoryCursorAt(%d) = %q, want %q", height, gotCursor, wantCursor)
+			}
+		}
+	}
+	// Proofs of the address tree cover values without heights.
+	root, err := withHeights.AddressTreeRoot()
+	if err != nil {
+		t.Fatalf("AddressTreeRoot: %v", err)
+	}
+	proof, err := withHeights.ProveAddress(top[0].Address[:])
+	if err != nil {
+		t.Fatalf("ProveAddress: %v", err)
+	}
+	if _, err := VerifyAddress(withHeights.par, root, withHeights.NumAddressKeys(), top[0].Address[:], proof); err != nil {
+		t.Errorf("VerifyAddress: %v", err)
+	}
+}
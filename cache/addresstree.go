@@ -0,0 +1,369 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// The address tree is a Merkle tree over the sorted keys of the address
+// index (address prefixes) with their values. It is built if
+// Parameters.AddressTree is set and allows to prove that an address
+// has no history.
+//
+// Leaf is H(0x00 || key || values), node is H(0x01 || left || right).
+// If a level has odd number of nodes, the last one is moved to the
+// next level as is. File addressKeys has the sorted keys, file
+// addressTree has all levels of the tree starting with leaves.
+
+func addressTreeLevels(nleaves int) []int {
+	levels := []int{nleaves}
+	for n := nleaves; n > 1; {
+		n = (n + 1) / 2
+		levels = append(levels, n)
+	}
+	return levels
+}
+
+type addressTreeWriter struct {
+	h         hash.Hash
+	sum       []byte
+	keys      builderFile
+	keysBuf   *bufio.Writer
+	tree      builderFile
+	treeBuf   *bufio.Writer
+	nleaves   int
+	prefixLen int
+
+	// root is the last written node, which is the root after close.
+	root crypto.Hash
+}
+
+func newAddressTreeWriter(h hash.Hash, keys, tree builderFile, prefixLen int) *addressTreeWriter {
+	return &addressTreeWriter{
+		h:         h,
+		keys:      keys,
+		keysBuf:   bufio.NewWriter(keys),
+		tree:      tree,
+		treeBuf:   bufio.NewWriter(tree),
+		prefixLen: prefixLen,
+	}
+}
+
+// addKey is passed to MultiMapWriter.SetKeyCallback.
+func (w *addressTreeWriter) addKey(key, values []byte) error {
+	if _, err := w.keysBuf.Write(key); err != nil {
+		return err
+	}
+	w.h.Reset()
+	_, _ = w.h.Write([]byte{0x00})
+	_, _ = w.h.Write(key)
+	_, _ = w.h.Write(values)
+	w.sum = w.h.Sum(w.sum[:0])
+	if _, err := w.treeBuf.Write(w.sum); err != nil {
+		return err
+	}
+	copy(w.root[:], w.sum)
+	w.nleaves++
+	return nil
+}
+
+// close writes upper levels of the tree.
+func (w *addressTreeWriter) close() error {
+	if err := w.keysBuf.Flush(); err != nil {
+		return err
+	}
+	if err := w.keys.Close(); err != nil {
+		return err
+	}
+	if err := w.treeBuf.Flush(); err != nil {
+		return err
+	}
+	levels := addressTreeLevels(w.nleaves)
+	var levelStart int64
+	left := make([]byte, crypto.HashSize)
+	right := make([]byte, crypto.HashSize)
+	for l := 0; l+1 < len(levels); l++ {
+		n := levels[l]
+		levelLen := int64(n) * crypto.HashSize
+		r := bufio.NewReader(io.NewSectionReader(w.tree, levelStart, levelLen))
+		for i := 0; i < n; i += 2 {
+			if _, err := io.ReadFull(r, left); err != nil {
+				return err
+			}
+			if i+1 == n {
+				if _, err := w.treeBuf.Write(left); err != nil {
+					return err
+				}
+				copy(w.root[:], left)
+				break
+			}
+			if _, err := io.ReadFull(r, right); err != nil {
+				return err
+			}
+			w.sum = hashNode(w.h, w.sum[:0], left, right)
+			if _, err := w.treeBuf.Write(w.sum); err != nil {
+				return err
+			}
+			copy(w.root[:], w.sum)
+		}
+		// Next level must be readable before it is used.
+		if err := w.treeBuf.Flush(); err != nil {
+			return err
+		}
+		levelStart += levelLen
+	}
+	return w.tree.Close()
+}
+
+// nodePrefix is a variable, since a slice literal passed to h.Write
+// is allocated on every call.
+var nodePrefix = []byte{0x01}
+
+func hashNode(h hash.Hash, sum, left, right []byte) []byte {
+	h.Reset()
+	_, _ = h.Write(nodePrefix)
+	_, _ = h.Write(left)
+	_, _ = h.Write(right)
+	return h.Sum(sum)
+}
+
+// AddressTreeProof proves that the key of the address index with given
+// position in sorted order has given values.
+type AddressTreeProof struct {
+	Index  int
+	Key    []byte
+	Values []byte
+	Proof  []byte // Concatenated hashes.
+}
+
+// AbsenceProof proves that an address is absent in the address index.
+// Left and Right are adjacent keys around the address; Left is nil if
+// the address is less than all keys, Right is nil if it is greater.
+type AbsenceProof struct {
+	NumKeys int
+	Left    *AddressTreeProof
+	Right   *AddressTreeProof
+}
+
+var (
+	ErrNoAddressTree    = fmt.Errorf("The index has no address tree")
+	ErrAddressIsPresent = fmt.Errorf("The address is present in the index")
+)
+
+func (s *Server) numAddressKeys() int {
+	return len(s.AddressKeys) / s.addressPrefixLen
+}
+
+func (s *Server) addressKey(i int) []byte {
+	return s.AddressKeys[i*s.addressPrefixLen : (i+1)*s.addressPrefixLen]
+}
+
+// AddressTreeRoot returns the root of the address tree.
+func (s *Server) AddressTreeRoot() (crypto.Hash, error) {
+	var root crypto.Hash
+	if !s.par.AddressTree {
+		return root, ErrNoAddressTree
+	}
+	if len(s.AddressTree) == 0 {
+		return root, nil
+	}
+	copy(root[:], s.AddressTree[len(s.AddressTree)-crypto.HashSize:])
+	return root, nil
+}
+
+func (s *Server) addressTreeProof(index int) (*AddressTreeProof, error) {
+	key := s.addressKey(index)
+	values, _, err := s.lookupAddress(key)
+	if err != nil {
+		return nil, err
+	}
+	p := &AddressTreeProof{
+		Index:  index,
+		Key:    key,
+		Values: values,
+	}
+	var levelStart int
+	i := index
+	for _, n := range addressTreeLevels(s.numAddressKeys()) {
+		if sibling := i ^ 1; sibling < n {
+			start := levelStart + sibling*crypto.HashSize
+			p.Proof = append(p.Proof, s.AddressTree[start:start+crypto.HashSize]...)
+		}
+		levelStart += n * crypto.HashSize
+		i /= 2
+	}
+	return p, nil
+}
+
+// ProveAddress returns the proof of the entry of the address index
+// for the address. Values of the proof are the indices of items of the
+// address, see AddressTreeItems.
+func (s *Server) ProveAddress(address []byte) (*AddressTreeProof, error) {
+	if !s.par.AddressTree {
+		return nil, ErrNoAddressTree
+	}
+	if len(address) < s.addressPrefixLen {
+		return nil, fmt.Errorf("too short address")
+	}
+	prefix := address[:s.addressPrefixLen]
+	n := s.numAddressKeys()
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(s.addressKey(i), prefix) >= 0
+	})
+	if i == n || !bytes.Equal(s.addressKey(i), prefix) {
+		return nil, fmt.Errorf("the address is absent in the index")
+	}
+	return s.addressTreeProof(i)
+}
+
+// ProveAbsence returns the proof that the address has no history.
+func (s *Server) ProveAbsence(address []byte) (*AbsenceProof, error) {
+	if !s.par.AddressTree {
+		return nil, ErrNoAddressTree
+	}
+	if len(address) < s.addressPrefixLen {
+		return nil, fmt.Errorf("too short address")
+	}
+	prefix := address[:s.addressPrefixLen]
+	n := s.numAddressKeys()
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(s.addressKey(i), prefix) >= 0
+	})
+	if i < n && bytes.Equal(s.addressKey(i), prefix) {
+		return nil, ErrAddressIsPresent
+	}
+	proof := &AbsenceProof{NumKeys: n}
+	var err error
+	if i > 0 {
+		if proof.Left, err = s.addressTreeProof(i - 1); err != nil {
+			return nil, err
+		}
+	}
+	if i < n {
+		if proof.Right, err = s.addressTreeProof(i); err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
+}
+
+func verifyAddressTreeProof(h hash.Hash, p *AddressTreeProof, nkeys int, root crypto.Hash) bool {
+	if p.Index < 0 || p.Index >= nkeys || len(p.Proof)%crypto.HashSize != 0 {
+		return false
+	}
+	h.Reset()
+	_, _ = h.Write([]byte{0x00})
+	_, _ = h.Write(p.Key)
+	_, _ = h.Write(p.Values)
+	sum := h.Sum(nil)
+	proof := p.Proof
+	i := p.Index
+	for _, n := range addressTreeLevels(nkeys) {
+		if sibling := i ^ 1; sibling < n {
+			if len(proof) == 0 {
+				return false
+			}
+			if sibling < i {
+				sum = hashNode(h, nil, proof[:crypto.HashSize], sum)
+			} else {
+				sum = hashNode(h, nil, sum, proof[:crypto.HashSize])
+			}
+			proof = proof[crypto.HashSize:]
+		}
+		i /= 2
+	}
+	return len(proof) == 0 && bytes.Equal(sum, root[:])
+}
+
+// VerifyAbsence checks the proof that the address is absent in the
+// index with given parameters and root of the address tree.
+func VerifyAbsence(par Parameters, root crypto.Hash, address []byte, proof *AbsenceProof) error {
+	newHash, err := newLeafHash(par.LeafHash)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	if len(address) < par.AddressPrefixLen {
+		return fmt.Errorf("too short address")
+	}
+	prefix := address[:par.AddressPrefixLen]
+	if proof.Left == nil && proof.Right == nil {
+		if proof.NumKeys != 0 {
+			return fmt.Errorf("no neighbours in the proof")
+		}
+		return nil
+	}
+	if proof.Left != nil {
+		if !verifyAddressTreeProof(h, proof.Left, proof.NumKeys, root) {
+			return fmt.Errorf("bad proof of left neighbour")
+		}
+		if bytes.Compare(proof.Left.Key, prefix) >= 0 {
+			return fmt.Errorf("left neighbour is not less than the address")
+		}
+	} else if proof.Right.Index != 0 {
+		return fmt.Errorf("no left neighbour, but right one is not first")
+	}
+	if proof.Right != nil {
+		if !verifyAddressTreeProof(h, proof.Right, proof.NumKeys, root) {
+			return fmt.Errorf("bad proof of right neighbour")
+		}
+		if bytes.Compare(proof.Right.Key, prefix) <= 0 {
+			return fmt.Errorf("right neighbour is not greater than the address")
+		}
+	} else if proof.Left.Index != proof.NumKeys-1 {
+		return fmt.Errorf("no right neighbour, but left one is not last")
+	}
+	if proof.Left != nil && proof.Right != nil && proof.Left.Index+1 != proof.Right.Index {
+		return fmt.Errorf("neighbours are not adjacent")
+	}
+	return nil
+}
+
+// VerifyAddress checks the proof of the entry of the address index for
+// the address and returns indices of items of the address. A client
+// compares them with the history returned by the server to make sure
+// that no items were omitted.
+func VerifyAddress(par Parameters, root crypto.Hash, nkeys int, address []byte, proof *AddressTreeProof) ([]int, error) {
+	newHash, err := newLeafHash(par.LeafHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(address) < par.AddressPrefixLen {
+		return nil, fmt.Errorf("too short address")
+	}
+	if !bytes.Equal(proof.Key, address[:par.AddressPrefixLen]) {
+		return nil, fmt.Errorf("the proof is for another address")
+	}
+	if !verifyAddressTreeProof(newHash(), proof, nkeys, root) {
+		return nil, fmt.Errorf("bad proof")
+	}
+	return AddressTreeItems(par, proof.Values)
+}
+
+// AddressTreeItems decodes values of the address index to item indices.
+func AddressTreeItems(par Parameters, values []byte) ([]int, error) {
+	if len(values)%par.OffsetIndexLen != 0 {
+		return nil, fmt.Errorf("bad length of values: %d", len(values))
+	}
+	var tmp [8]byte
+	var items []int
+	for pos := 0; pos < len(values); pos += par.OffsetIndexLen {
+		copy(tmp[:], values[pos:pos+par.OffsetIndexLen])
+		// Value 0 is special on wire, so all indices are shifted.
+		items = append(items, int(binary.LittleEndian.Uint64(tmp[:]))-1)
+	}
+	return items, nil
+}
+
+// NumAddressKeys returns the number of leaves of the address tree.
+// Clients need it to verify proofs.
+func (s *Server) NumAddressKeys() int {
+	return s.numAddressKeys()
+}
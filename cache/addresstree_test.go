@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestProveAbsence(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	addresses, err := readAddresses()
+	if err != nil {
+		t.Fatalf("readAddresses: %v", err)
+	}
+	p := testParameters()
+	p.AddressPrefixLen = 16
+	p.AddressTree = true
+	b, s := buildTestIndex(t, "", p, blocks)
+	root, err := s.AddressTreeRoot()
+	if err != nil {
+		t.Fatalf("AddressTreeRoot: %v", err)
+	}
+	if got := b.Report().AddressTreeRoot; got != fmt.Sprintf("%x", root[:]) {
+		t.Errorf("Report().AddressTreeRoot = %s, want %x", got, root[:])
+	}
+	for _, address := range addresses {
+		uh, err := ParseAddress(address)
+		if err != nil {
+			t.Fatalf("ParseAddress(%s): %v", address, err)
+		}
+		if _, err := s.ProveAbsence(uh[:]); err != ErrAddressIsPresent {
+			t.Errorf("ProveAbsence(%s): want ErrAddressIsPresent, got %v", address, err)
+		}
+		entryProof, err := s.ProveAddress(uh[:])
+		if err != nil {
+			t.Errorf("ProveAddress(%s): %v", address, err)
+		} else if items, err := VerifyAddress(p, root, s.NumAddressKeys(), uh[:], entryProof); err != nil {
+			t.Errorf("VerifyAddress(%s): %v", address, err)
+		} else if wantItems, err := s.addressItems(uh[:]); err != nil {
+			t.Errorf("addressItems(%s): %v", address, err)
+		} else if fmt.Sprint(items) != fmt.Sprint(wantItems) {
+			t.Errorf("VerifyAddress(%s) = %v, want %v", address, items, wantItems)
+		}
+		// Neighbours of the address: previous, next, first and last.
+		for _, last := range []byte{0x00, 0xFF} {
+			absent := uh
+			absent[p.AddressPrefixLen-1] ^= 0x01
+			absent[0] = last
+			proof, err := s.ProveAbsence(absent[:])
+			if err == ErrAddressIsPresent {
+				continue
+			} else if err != nil {
+				t.Errorf("ProveAbsence(%x): %v", absent[:], err)
+				continue
+			}
+			if err := VerifyAbsence(p, root, absent[:], proof); err != nil {
+				t.Errorf("VerifyAbsence(%x): %v", absent[:], err)
+			}
+			if err := VerifyAbsence(p, root, uh[:], proof); err == nil {
+				t.Errorf("VerifyAbsence(%s) succeeded for present address", address)
+			}
+		}
+	}
+}
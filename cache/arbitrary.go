@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// ARBITRARY_DATA_PREFIX_LEN is the number of first bytes of entries
+// of ArbitraryData of transactions stored in the index. Entries
+// shorter than that are padded with zeros.
+const ARBITRARY_DATA_PREFIX_LEN = 16
+
+// File arbitraryData is an item index (see itemindex.go) with keys of
+// ARBITRARY_DATA_PREFIX_LEN first bytes of entries.
+
+func (s *Builder) writeArbitraryData(tx *types.Transaction, itemIndex uint64) error {
+	for _, data := range tx.ArbitraryData {
+		if len(data) == 0 {
+			continue
+		}
+		if err := s.arbitraryData.add(data, itemIndex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchArbitraryData returns transactions having an entry of
+// ArbitraryData starting with the prefix, in the order of the
+// blockchain, up to MAX_HISTORY_SIZE items. The prefix must not be
+// empty. Candidates are found by ARBITRARY_DATA_PREFIX_LEN first bytes
+// of the prefix and checked by decoding the transactions.
+func (s *Server) SearchArbitraryData(prefix []byte) ([]Item, error) {
+	page, err := s.SearchArbitraryDataPage(prefix, "", MAX_HISTORY_SIZE)
+	return page.Items, err
+}
+
+// SearchArbitraryDataPage is like SearchArbitraryData, but returns up
+// to limit items starting from the cursor start (see page.go). Total is
+// not known, since candidates found in the index are checked by
+// decoding them.
+func (s *Server) SearchArbitraryDataPage(prefix []byte, start string, limit int) (ItemPage, error) {
+	if len(prefix) == 0 {
+		return ItemPage{}, fmt.Errorf("empty prefix")
+	}
+	key := prefix
+	if len(key) > ARBITRARY_DATA_PREFIX_LEN {
+		key = key[:ARBITRARY_DATA_PREFIX_LEN]
+	}
+	candidates := searchItemIndex(s.ArbitraryData, ARBITRARY_DATA_PREFIX_LEN, s.offsetIndexLen, key)
+	items, pos, err := s.pageItems(context.Background(), candidates, start, limit, func(item *Item) (bool, error) {
+		_, tx, err := DecodeItem(*item)
+		if err != nil {
+			return false, err
+		}
+		return tx != nil && hasArbitraryData(tx, prefix), nil
+	})
+	if err != nil {
+		return ItemPage{}, err
+	}
+	next, err := s.cursorAt(candidates, pos)
+	if err != nil {
+		return ItemPage{}, err
+	}
+	return ItemPage{Items: items, Next: next, Total: -1}, nil
+}
+
+func hasArbitraryData(tx *types.Transaction, prefix []byte) bool {
+	for _, data := range tx.ArbitraryData {
+		if bytes.HasPrefix(data, prefix) {
+			return true
+		}
+	}
+	return false
+}
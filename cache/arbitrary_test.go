@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestSearchArbitraryData(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	entries := [][]byte{
+		[]byte("HostAnnouncement with a long tail 1"),
+		[]byte("Host"),
+		[]byte("HostAnnouncement with a long tail 2"),
+		[]byte("other"),
+	}
+	chain := []*types.Block{blocks[0]}
+	parentID := blocks[0].ID()
+	for i, data := range entries {
+		block := &types.Block{
+			ParentID:  parentID,
+			Timestamp: types.Timestamp(1433600000 + i + 1),
+			Transactions: []types.Transaction{
+				{ArbitraryData: [][]byte{{}, data}},
+			},
+		}
+		chain = append(chain, block)
+		parentID = block.ID()
+	}
+	s := buildTestServer(t, testParameters(), chain)
+	cases := []struct {
+		prefix string
+		blocks []int
+	}{
+		{"Host", []int{1, 2, 3}},
+		{"HostAnnouncement", []int{1, 3}},
+		{"HostAnnouncement with a long tail 2", []int{3}},
+		{"HostAnnouncement with a long tail 3", nil},
+		{"Host\x00", nil},
+		{"oth", []int{4}},
+		{"z", nil},
+	}
+	for _, c := range cases {
+		items, err := s.SearchArbitraryData([]byte(c.prefix))
+		if err != nil {
+			t.Fatalf("SearchArbitraryData(%q): %v", c.prefix, err)
+		}
+		var got []int
+		for _, item := range items {
+			got = append(got, item.Block)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.blocks) {
+			t.Errorf("SearchArbitraryData(%q) returned items of blocks %v, want %v", c.prefix, got, c.blocks)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// AuditOutput is an output of an audited address unspent at the height.
+type AuditOutput struct {
+	ID      crypto.Hash
+	Address types.UnlockHash
+	Nature  string
+	Index   int
+	Value   types.Currency
+
+	// Created is the item creating the output, with MerkleProof.
+	Created Item
+
+	// Spent is the item spending the output after the height, if any.
+	Spent *Item
+
+	// SpendableHeight is the height of the first block which can spend
+	// the output: miner payouts mature after types.MaturityDelay blocks
+	// and unlock conditions may have a timelock (see AddressTimelock).
+	SpendableHeight int
+}
+
+// Audit is the set of outputs of addresses unspent at the height.
+// Height and UnlockHeight are heights of blocks in the chain, not
+// positions of blocks in the index (see StartHeight).
+type Audit struct {
+	Height   int
+	Outputs  []AuditOutput
+	Siacoins types.Currency
+	Siafunds types.Currency
+
+	// Parts of Siacoins and Siafunds which can not be spent by the next
+	// block, and the height from which all the outputs are spendable.
+	LockedSiacoins types.Currency
+	LockedSiafunds types.Currency
+	UnlockHeight   int
+}
+
+// addressItems returns indices of all items of the address prefix
+// in increasing order.
+func (s *Server) addressItems(address []byte) ([]int, error) {
+	values, _, err := s.lookupAddress(address[:s.addressPrefixLen])
+	if err != nil || values == nil {
+		return nil, err
+	}
+	return s.decodeAddressItems(values), nil
+}
+
+// decodeAddressItems decodes values of the address index to sorted
+// unique item indices. Indices built before the address index was
+// sorted by item index as a number (see emsort.Fields) are sorted here.
+func (s *Server) decodeAddressItems(values []byte) []int {
+	var tmp [8]byte
+	var items []int
+	for pos := 0; pos+s.offsetIndexLen <= len(values); pos += s.offsetIndexLen {
+		copy(tmp[:], values[pos:pos+s.offsetIndexLen])
+		// Value 0 is special on wire, so all indices are shifted.
+		items = append(items, int(binary.LittleEndian.Uint64(tmp[:]))-1)
+	}
+	if !sort.IntsAreSorted(items) {
+		sort.Ints(items)
+	}
+	// Skip duplicates like addressWindow does (see serve.go).
+	unique := items[:0]
+	for _, itemIndex := range items {
+		if len(unique) == 0 || unique[len(unique)-1] != itemIndex {
+			unique = append(unique, itemIndex)
+		}
+	}
+	return unique
+}
+
+// blockIDs returns IDs of all blocks by index. They are computed by
+// chaining headers on the first call and kept, since the index does not
+// change, so the headers are hashed once per Server (32 bytes of memory
+// per block). The result must not be modified.
+func (s *Server) blockIDs() ([]types.BlockID, error) {
+	s.blockIDsOnce.Do(func() {
+		ids := make([]types.BlockID, 0, s.nblocks)
+		parentID := s.firstParentID()
+		for height := 0; height < s.nblocks; height++ {
+			header, err := s.GetBlockHeader(height)
+			if err != nil {
+				s.blockIDsErr = err
+				return
+			}
+			parentID = header.ID(parentID)
+			ids = append(ids, parentID)
+		}
+		s.blockIDsTable = ids
+	})
+	return s.blockIDsTable, s.blockIDsErr
+}
+
+// BlockIDs returns IDs of all blocks (see blockIDs).
+func (s *Server) BlockIDs() ([]types.BlockID, error) {
+	ids, err := s.blockIDs()
+	if err != nil {
+		return nil, err
+	}
+	return append([]types.BlockID(nil), ids...), nil
+}
+
+// Audit returns siacoin and siafund outputs of the addresses which exist
+// and are unspent after the block with given height, with Merkle proofs
+// of creating and spending items. Outputs of file contracts are not
+// included, since they are created by storage proofs, not by the items.
+// It returns ErrNotYetIndexed if the height is after TipHeight and
+// ErrNoBlock if it is before StartHeight.
+func (s *Server) Audit(addresses []types.UnlockHash, height int) (*Audit, error) {
+	return s.audit(addresses, height, true)
+}
+
+// GetBalanceAt returns siacoins and siafunds of the address as of the
+// block with given height. Like Audit, it counts only outputs created by
+// items, so outputs created by storage proofs are not included.
+func (s *Server) GetBalanceAt(address types.UnlockHash, height int) (siacoins, siafunds types.Currency, err error) {
+	audit, err := s.GetBalanceDetailsAt(address, height)
+	if err != nil {
+		return types.Currency{}, types.Currency{}, err
+	}
+	return audit.Siacoins, audit.Siafunds, nil
+}
+
+// GetBalanceDetailsAt is like GetBalanceAt, but returns the outputs and
+// locked amounts too. Items of the outputs have no Merkle proofs.
+func (s *Server) GetBalanceDetailsAt(address types.UnlockHash, height int) (*Audit, error) {
+	return s.audit([]types.UnlockHash{address}, height, false)
+}
+
+func (s *Server) audit(addresses []types.UnlockHash, height int, withProofs bool) (*Audit, error) {
+	getItem := s.GetItemWithoutProof
+	if withProofs {
+		getItem = s.GetItem
+	}
+	if err := s.CheckHeight(height); err != nil {
+		return nil, err
+	}
+	// Items refer to blocks by their positions in the index.
+	blockIndex := height - s.StartHeight()
+	if blockIndex < 0 {
+		return nil, ErrNoBlock
+	}
+	audit := &Audit{
+		Height:         height,
+		Siacoins:       types.NewCurrency64(0),
+		Siafunds:       types.NewCurrency64(0),
+		LockedSiacoins: types.NewCurrency64(0),
+		LockedSiafunds: types.NewCurrency64(0),
+		UnlockHeight:   height + 1,
+	}
+	var blockIDs []types.BlockID
+	for _, address := range addresses {
+		items, err := s.addressItems(address[:])
+		if err != nil {
+			return nil, err
+		}
+		// Outputs created before the height and indices of their items.
+		var outputs []AuditOutput
+		var outputItems []int
+		spends := make(map[crypto.Hash]int)
+		for _, itemIndex := range items {
+			item, err := s.GetItemWithoutProof(itemIndex)
+			if err != nil {
+				return nil, err
+			}
+			payout, tx, err := DecodeItem(item)
+			if err != nil {
+				return nil, err
+			}
+			if payout != nil {
+				if payout.UnlockHash != address || item.Block > blockIndex {
+					continue
+				}
+				if blockIDs == nil {
+					if blockIDs, err = s.blockIDs(); err != nil {
+						return nil, err
+					}
+				}
+				outputs = append(outputs, AuditOutput{
+					ID:      crypto.Hash(MinerPayoutID(blockIDs[item.Block], item.Index)),
+					Address: address,
+					Nature:  NATURE_MINER_PAYOUT,
+					Index:   item.Index,
+					Value:   payout.Value,
+
+					SpendableHeight: s.spendableHeight(address, item.Block, true),
+				})
+				outputItems = append(outputItems, itemIndex)
+				continue
+			}
+			for _, in := range TransactionInputs(tx) {
+				if in.UnlockHash == address {
+					spends[in.ParentID] = itemIndex
+				}
+			}
+			if item.Block > blockIndex {
+				continue
+			}
+			for _, out := range TransactionOutputs(tx) {
+				if out.UnlockHash != address {
+					continue
+				}
+				if out.Nature != NATURE_SIACOIN_OUTPUT && out.Nature != NATURE_SIAFUND_OUTPUT {
+					continue
+				}
+				outputs = append(outputs, AuditOutput{
+					ID:      out.ID,
+					Address: address,
+					Nature:  out.Nature,
+					Index:   out.Index,
+					Value:   out.Value,
+
+					SpendableHeight: s.spendableHeight(address, item.Block, false),
+				})
+				outputItems = append(outputItems, itemIndex)
+			}
+		}
+		for i, out := range outputs {
+			created, err := getItem(outputItems[i])
+			if err != nil {
+				return nil, err
+			}
+			out.Created = created
+			if spendIndex, has := spends[out.ID]; has {
+				spent, err := getItem(spendIndex)
+				if err != nil {
+					return nil, err
+				}
+				if spent.Block <= blockIndex {
+					continue
+				}
+				out.Spent = &spent
+			}
+			locked := out.SpendableHeight > height+1
+			if out.SpendableHeight > audit.UnlockHeight {
+				audit.UnlockHeight = out.SpendableHeight
+			}
+			if out.Nature == NATURE_SIAFUND_OUTPUT {
+				audit.Siafunds = audit.Siafunds.Add(out.Value)
+				if locked {
+					audit.LockedSiafunds = audit.LockedSiafunds.Add(out.Value)
+				}
+			} else {
+				audit.Siacoins = audit.Siacoins.Add(out.Value)
+				if locked {
+					audit.LockedSiacoins = audit.LockedSiacoins.Add(out.Value)
+				}
+			}
+			audit.Outputs = append(audit.Outputs, out)
+		}
+	}
+	return audit, nil
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestBalanceAt(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	addresses, err := readAddresses()
+	if err != nil {
+		t.Fatalf("readAddresses: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	last := s.TipHeight()
+	for _, address := range addresses {
+		uh, err := ParseAddress(address)
+		if err != nil {
+			t.Fatalf("ParseAddress(%s): %v", address, err)
+		}
+		audit, err := s.Audit([]types.UnlockHash{uh}, last)
+		if err != nil {
+			t.Errorf("Audit(%s): %v", address, err)
+			continue
+		}
+		siacoins, siafunds, err := s.GetBalanceAt(uh, last)
+		if err != nil {
+			t.Errorf("GetBalanceAt(%s): %v", address, err)
+			continue
+		}
+		if siacoins.Cmp(audit.Siacoins) != 0 || siafunds.Cmp(audit.Siafunds) != 0 {
+			t.Errorf("GetBalanceAt(%s) = %s, %s; Audit returned %s, %s", address, siacoins, siafunds, audit.Siacoins, audit.Siafunds)
+		}
+		for _, out := range audit.Outputs {
+			if out.Created.Block > last {
+				t.Errorf("Audit(%s): output created in block %d", address, out.Created.Block)
+			}
+			if out.Spent != nil {
+				t.Errorf("Audit(%s): output spent in block %d", address, out.Spent.Block)
+			}
+			if len(out.Created.MerkleProof) == 0 && out.Created.NumLeaves > 1 {
+				t.Errorf("Audit(%s): no Merkle proof", address)
+			}
+		}
+	}
+}
+
+func TestAuditStartHeight(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	addresses, err := readAddresses()
+	if err != nil {
+		t.Fatalf("readAddresses: %v", err)
+	}
+	const ncold = 900
+	full, _, hot := buildTestTiers(t, blocks, ncold)
+	height := hot.TipHeight()
+	if _, err := hot.Audit(nil, ncold-1); err != ErrNoBlock {
+		t.Errorf("Audit before StartHeight: got %v, want %v", err, ErrNoBlock)
+	}
+	if _, err := hot.Audit(nil, height+1); err != ErrNotYetIndexed {
+		t.Errorf("Audit after TipHeight: got %v, want %v", err, ErrNotYetIndexed)
+	}
+	for _, address := range addresses {
+		uh, err := ParseAddress(address)
+		if err != nil {
+			t.Fatalf("ParseAddress(%s): %v", address, err)
+		}
+		want, err := full.GetBalanceDetailsAt(uh, height)
+		if err != nil {
+			t.Fatalf("full.GetBalanceDetailsAt(%s): %v", address, err)
+		}
+		got, err := hot.GetBalanceDetailsAt(uh, height)
+		if err != nil {
+			t.Fatalf("hot.GetBalanceDetailsAt(%s): %v", address, err)
+		}
+		if got.Height != height || got.UnlockHeight < height+1 {
+			t.Errorf("hot.GetBalanceDetailsAt(%s): height %d, unlock height %d", address, got.Height, got.UnlockHeight)
+		}
+		// The hot index has the outputs created after its start.
+		var wantIDs []crypto.Hash
+		for _, out := range want.Outputs {
+			if out.Created.Block >= ncold {
+				wantIDs = append(wantIDs, out.ID)
+			}
+		}
+		var gotIDs []crypto.Hash
+		for _, out := range got.Outputs {
+			gotIDs = append(gotIDs, out.ID)
+		}
+		if !reflect.DeepEqual(gotIDs, wantIDs) {
+			t.Errorf("hot.GetBalanceDetailsAt(%s) has outputs %v, want %v", address, gotIDs, wantIDs)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/fastmap"
+)
+
+// The map from block ID to block index is a fastmap with keys of
+// full block IDs and values of 4-byte little endian block indices.
+const (
+	blockIDsPageLen   = 4096
+	blockIDsPrefixLen = 8
+	blockIndexLen     = 4
+)
+
+var ErrNoBlock = fmt.Errorf("No such block")
+
+var blockIDFiles = []string{
+	"blockIDsFastmapData",
+	"blockIDsFastmapPrefixes",
+}
+
+// writeBlockIDs writes the map from block ID to block index. The IDs
+// are taken from knownBlocks, so the headers are not read again.
+func (s *Builder) writeBlockIDs() error {
+	ids := make([]types.BlockID, 0, len(s.knownBlocks))
+	for id := range s.knownBlocks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i][:], ids[j][:]) < 0
+	})
+	data, err := s.fs.create(path.Join(s.dir, "blockIDsFastmapData"+newSuffix))
+	if err != nil {
+		return err
+	}
+	prefixes, err := s.fs.create(path.Join(s.dir, "blockIDsFastmapPrefixes"+newSuffix))
+	if err != nil {
+		data.Close()
+		return err
+	}
+	w, err := fastmap.NewMapWriter(blockIDsPageLen, crypto.HashSize, blockIndexLen, blockIDsPrefixLen, data, prefixes)
+	if err != nil {
+		data.Close()
+		prefixes.Close()
+		return fmt.Errorf("fastmap.NewMapWriter: %v", err)
+	}
+	rec := make([]byte, crypto.HashSize+blockIndexLen)
+	for _, id := range ids {
+		copy(rec, id[:])
+		binary.LittleEndian.PutUint32(rec[crypto.HashSize:], uint32(s.knownBlocks[id]))
+		if _, err := w.Write(rec); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// BlockIndexByID returns the index of the block with the ID.
+// It returns ErrNoBlock if the block is not in the index.
+func (s *Server) BlockIndexByID(id types.BlockID) (int, error) {
+	if s.blockIDMap == nil {
+		return 0, ErrNoBlock
+	}
+	value, err := s.blockIDMap.Lookup(id[:])
+	if err != nil {
+		return 0, fmt.Errorf("blockIDMap.Lookup: %v", err)
+	}
+	if value == nil {
+		return 0, ErrNoBlock
+	}
+	blockIndex := int(binary.LittleEndian.Uint32(value))
+	if blockIndex >= s.nblocks {
+		return 0, fmt.Errorf("block index %d is out of range", blockIndex)
+	}
+	return blockIndex, nil
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestBlockIndexByID(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	for i, block := range blocks {
+		blockIndex, err := s.BlockIndexByID(block.ID())
+		if err != nil {
+			t.Fatalf("BlockIndexByID(%d): %v", i, err)
+		}
+		if blockIndex != i {
+			t.Errorf("BlockIndexByID returned %d, want %d", blockIndex, i)
+		}
+	}
+	if _, err := s.BlockIndexByID(types.BlockID{}); err != ErrNoBlock {
+		t.Errorf("BlockIndexByID(unknown) returned %v, want ErrNoBlock", err)
+	}
+}
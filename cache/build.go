@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -20,49 +21,142 @@ import (
 	"github.com/starius/sialite/fastmap"
 )
 
-type parameters struct {
+// Parameters of the index, stored in parameters.json.
+type Parameters struct {
 	OffsetLen               int
 	OffsetIndexLen          int
 	AddressPageLen          int
 	AddressPrefixLen        int
 	AddressFastmapPrefixLen int
 	AddressOffsetLen        int
+
+	// LeafHash is the hash of leaves and Merkle proofs, one of HASH_*.
+	// Empty value means HASH_BLAKE2B.
+	LeafHash string `json:",omitempty"`
+
+	// AddressTree enables the Merkle tree over the address index.
+	// See ProveAbsence.
+	AddressTree bool `json:",omitempty"`
+
+	// MultisigKeys enables the index of keys of multi-signature unlock
+	// conditions. See multisig.go.
+	MultisigKeys bool `json:",omitempty"`
+
+	// AddressHeights stores the height of the block (uvarint) after
+	// each item index in lists of the address index. See
+	// addressheights.go.
+	AddressHeights bool `json:",omitempty"`
+
+	// StartHeight and StartParentID are set if the index does not
+	// start from the genesis block (see sialiteserver -checkpoint).
+	// Block i of the index has height StartHeight+i and the first
+	// block is a child of StartParentID.
+	StartHeight   int            `json:",omitempty"`
+	StartParentID *types.BlockID `json:",omitempty"`
 }
 
-type blockHeader struct {
+// BlockHeader is a record of headers file. ParentID is not stored,
+// since it is the ID of the previous block.
+type BlockHeader struct {
 	Nonce      types.BlockNonce
 	Timestamp  types.Timestamp
 	MerkleRoot crypto.Hash
 }
 
+// headerSize is the size of encoded BlockHeader.
+const headerSize = 8 + 8 + crypto.HashSize
+
+// HEADER_SIZE is the size of encoded BlockHeader for clients reading
+// raw headers (see Tiered.RawHeaders and HeaderVerifier.Append).
+const HEADER_SIZE = headerSize
+
+// ID returns the ID of the block given the ID of its parent.
+func (h BlockHeader) ID(parentID types.BlockID) types.BlockID {
+	return types.BlockHeader{
+		ParentID:   parentID,
+		Nonce:      h.Nonce,
+		Timestamp:  h.Timestamp,
+		MerkleRoot: h.MerkleRoot,
+	}.ID()
+}
+
 type Builder struct {
-	blockchain      *os.File
+	blockchain      builderFile
 	blockchainBuf   *bufio.Writer
 	blockchainLen   uint64
 	dataBuf         bytes.Buffer
 	compressedBuf   []byte
-	leavesHashes    *os.File
+	leavesHashes    builderFile
 	leavesHashesBuf *bufio.Writer
 
 	siaHash    hash.Hash
 	siaHashBuf []byte
 
-	// Series of blockHeader.
-	headersFile    *os.File
+	// Series of BlockHeader.
+	headersFile    builderFile
 	headersEncoder *encoding.Encoder
 
+	// Series of feeSize-byte big-endian sums of miner fees of blocks.
+	blockFees builderFile
+
+	// Series of contractStatsSize-byte records of ContractStats of blocks.
+	contractStats builderFile
+
+	// Series of itemInfoSize-byte records of items. See iteminfo.go.
+	itemInfo    builderFile
+	itemInfoBuf *bufio.Writer
+
+	// Nodes of the headers MMR, see mmr.go.
+	headersMMR *mmrWriter
+
 	offsetIndex uint64
 
 	// 8-byte offsets of miner payouts, and txs in blockchain
-	offsets *os.File
+	offsets    builderFile
+	offsetsBuf *bufio.Writer
 
 	// list of pairs (index of first miner payout, index of first tx) in offsets
 	// Indices are offsetLen byte long
-	blockLocations *os.File
+	blockLocations    builderFile
+	blockLocationsBuf *bufio.Writer
 
 	// unlockhash(addressPrefixLen bytes) + addressOffsetLen byte index in offsets
 	addresses    emsort.SortedWriter
-	addressestmp *os.File
+	addressestmp builderFile
+	addressesMap *fastmap.MultiMapWriter
+	addressTree  *addressTreeWriter
+	topAddresses *topAddresses
+	// blockStarts are indices of the first items of blocks, kept if
+	// Parameters.AddressHeights is set.
+	blockStarts  []uint64
+	withHeights  bool
+	heightSuffix []byte
+
+	// First bytes of entries of ArbitraryData. See arbitrary.go.
+	arbitraryData *itemIndexWriter
+	// Keys of hosts. See host.go.
+	hostKeys *itemIndexWriter
+
+	// Public keys of single-signature inputs. See pubkey.go.
+	publicKeys    emsort.SortedWriter
+	publicKeysTmp builderFile
+	publicKeyBuf  []byte
+
+	// Timelocks of unlock conditions. See timelock.go.
+	timelocks    emsort.SortedWriter
+	timelocksTmp builderFile
+	timelockBuf  []byte
+
+	// Keys of multi-signature inputs. See multisig.go.
+	multisigKeys     emsort.SortedWriter
+	multisigKeysTmp  builderFile
+	multisigKeyBuf   []byte
+	withMultisigKeys bool
+
+	dir     string
+	fs      builderFS
+	addTime time.Duration
+	report  *BuildReport
 
 	buf, tmpBuf []byte
 
@@ -70,23 +164,45 @@ type Builder struct {
 
 	offsetLen, offsetIndexLen           int
 	addressRecordSize, addressPrefixLen int
-}
 
-func NewBuilder(dir string, memLimit, offsetLen, offsetIndexLen, addressPageLen, addressPrefixLen, addressFastmapPrefixLen, addressOffsetLen int) (*Builder, error) {
+	// Indices of added blocks by ID, to skip blocks which are already
+	// present and to write the block ID map (see writeBlockIDs).
+	knownBlocks map[types.BlockID]int
+	lastBlockID types.BlockID
+	nblocks     int
 
-	bufferSize := 8 // Max of used buffers.
-	addressRecordSize := addressPrefixLen + offsetIndexLen
-	if addressRecordSize > bufferSize {
-		bufferSize = addressRecordSize
-	}
+	// Timestamps of the last MedianTimestampWindow blocks, the latest
+	// first (see HeaderVerifierState).
+	timestamps []types.Timestamp
 
-	if list, err := ioutil.ReadDir(dir); err != nil {
-		return nil, fmt.Errorf("ioutil.ReadDir(%q): %v", dir, err)
-	} else if len(list) != 0 {
-		return nil, fmt.Errorf("Output directory is not empty")
-	}
+	// startParentID is the parent of the first block, if the index
+	// does not start from the genesis block.
+	startParentID *types.BlockID
+
+	// See SetDropPageCache.
+	dropPageCache bool
+	nextDrop      uint64
+	dropTime      time.Duration
+
+	// See SetIOLimit.
+	throttle *ioThrottle
+
+	// See SetCheckpointInterval. checkpointed is true if the directory
+	// has CHECKPOINT_FILE to be removed by Close.
+	checkpointInterval int
+	checkpointed       bool
+
+	// See SetOnProgress.
+	onProgress   func(BlockStats)
+	startHeight  int
+	addressCount int
 
-	p := parameters{
+	// lock is the exclusive lock of the directory (see lock.go).
+	lock *os.File
+}
+
+func NewBuilder(dir string, memLimit, offsetLen, offsetIndexLen, addressPageLen, addressPrefixLen, addressFastmapPrefixLen, addressOffsetLen int) (*Builder, error) {
+	p := Parameters{
 		OffsetLen:               offsetLen,
 		OffsetIndexLen:          offsetIndexLen,
 		AddressPageLen:          addressPageLen,
@@ -94,8 +210,47 @@ func NewBuilder(dir string, memLimit, offsetLen, offsetIndexLen, addressPageLen,
 		AddressFastmapPrefixLen: addressFastmapPrefixLen,
 		AddressOffsetLen:        addressOffsetLen,
 	}
+	return NewBuilderFromParameters(dir, memLimit, p)
+}
+
+// NewBuilderFromParameters is like NewBuilder, but takes Parameters.
+func NewBuilderFromParameters(dir string, memLimit int, p Parameters) (*Builder, error) {
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir(%q): %v", dir, err)
+	}
+	for _, f := range list {
+		// The lock file may be created by NewServer.
+		if f.Name() != lockFile {
+			return nil, fmt.Errorf("Output directory is not empty")
+		}
+	}
+	lock, err := lockDir(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := createBuilder(dir, memLimit, p, osFS{os.Create})
+	if err != nil {
+		unlockDir(lock)
+		return nil, err
+	}
+	b.lock = lock
+	return b, nil
+}
 
-	parametersJson, err := os.Create(path.Join(dir, "parameters.json"))
+// NewBuilderWithParameters is like NewBuilder, but the parameters are
+// taken from contents of parameters.json of another index.
+// See Server.ParametersJSON.
+func NewBuilderWithParameters(dir string, memLimit int, parametersJSON []byte) (*Builder, error) {
+	var p Parameters
+	if err := json.Unmarshal(parametersJSON, &p); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return NewBuilderFromParameters(dir, memLimit, p)
+}
+
+func createBuilder(dir string, memLimit int, p Parameters, fs builderFS) (*Builder, error) {
+	parametersJson, err := fs.create(path.Join(dir, "parameters.json"))
 	if err != nil {
 		return nil, fmt.Errorf("opening parameters.json: %v", err)
 	}
@@ -108,42 +263,215 @@ func NewBuilder(dir string, memLimit, offsetLen, offsetIndexLen, addressPageLen,
 		return nil, fmt.Errorf("JSON Close: %v", err)
 	}
 
-	blockchain, err := os.Create(path.Join(dir, "blockchain"))
+	return newBuilder(dir, memLimit, p, fs)
+}
+
+// OpenBuilder reopens the directory written by Builder to append blocks.
+// Blocks already present in the directory are skipped by Add, so the
+// source of blocks may start below the last indexed block.
+// The address index is rebuilt by Close from all items.
+// Servers using the directory continue to work (see lock.go).
+func OpenBuilder(dir string, memLimit int) (*Builder, error) {
+	lock, err := lockDir(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := openBuilder(dir, memLimit)
+	if err != nil {
+		unlockDir(lock)
+		return nil, err
+	}
+	b.lock = lock
+	return b, nil
+}
+
+func openBuilder(dir string, memLimit int) (*Builder, error) {
+	p, err := readParameters(dir)
+	if err != nil {
+		return nil, err
+	}
+	s, err := openServer(dir)
+	if err != nil {
+		return nil, fmt.Errorf("NewServer: %v", err)
+	}
+	defer s.Close()
+	return appendBuilder(dir, memLimit, p, s)
+}
+
+// appendBuilder returns Builder appending blocks to the files of the
+// blocks of s, which is opened from dir.
+func appendBuilder(dir string, memLimit int, p Parameters, s *Server) (*Builder, error) {
+	openAppend := func(name string) (*os.File, error) {
+		return os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	}
+	b, err := newBuilder(dir, memLimit, p, osFS{openAppend})
+	if err != nil {
+		return nil, err
+	}
+	// Load IDs of existing blocks and re-add their addresses
+	// to the address index.
+	err = s.ForEachBlock(0, s.NumBlocks(), func(block *DecodedBlock) error {
+		b.knownBlocks[block.ID] = b.nblocks
+		b.lastBlockID = block.ID
+		b.nblocks++
+		b.timestamps = pushTimestamp(b.timestamps, block.Header.Timestamp)
+		if b.withHeights {
+			b.blockStarts = append(b.blockStarts, uint64(block.FirstItem))
+		}
+		for i := range block.MinerPayouts {
+			b.setAddressLoc(uint64(block.FirstItem + i))
+			if err := b.writeAddress(block.MinerPayouts[i].UnlockHash); err != nil {
+				return err
+			}
+		}
+		for i := range block.Transactions {
+			b.setAddressLoc(uint64(block.FirstTx + i))
+			if err := forEachAddress(&block.Transactions[i], b.writeAddress); err != nil {
+				return err
+			}
+			if err := b.writeArbitraryData(&block.Transactions[i], uint64(block.FirstTx+i)); err != nil {
+				return err
+			}
+			if err := b.writePublicKeys(&block.Transactions[i]); err != nil {
+				return err
+			}
+			if err := b.writeTimelocks(&block.Transactions[i]); err != nil {
+				return err
+			}
+			if err := b.writeMultisigKeys(&block.Transactions[i]); err != nil {
+				return err
+			}
+			if err := b.writeHostKeys(&block.Transactions[i], uint64(block.FirstTx+i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading existing blocks: %v", err)
+	}
+	b.offsetIndex = uint64(s.NumItems())
+	b.blockchainLen = uint64(len(s.Blockchain))
+	b.headersMMR.peaks = mmrPeaks(s.HeadersMMR, s.NumBlocks())
+	return b, nil
+}
+
+func readParameters(dir string) (Parameters, error) {
+	var par Parameters
+	jf, err := os.Open(path.Join(dir, "parameters.json"))
+	if err != nil {
+		return par, err
+	}
+	defer jf.Close()
+	if err := json.NewDecoder(jf).Decode(&par); err != nil {
+		return par, err
+	}
+	return par, nil
+}
+
+// newSuffix is added to the names of address index files while they
+// are being written.
+const newSuffix = ".new"
+
+var addressIndexFiles = []string{
+	"addressesFastmapData",
+	"addressesFastmapPrefixes",
+	"addressesIndices",
+	"addressKeys",
+	"addressTree",
+}
+
+// renamedFiles returns the names of files which are written under
+// temporary names and renamed by Close.
+func renamedFiles() []string {
+	var names []string
+	names = append(names, addressIndexFiles...)
+	names = append(names, blockIDFiles...)
+	names = append(names, "arbitraryData", "publicKeys", "hostKeys", "timelocks", "multisigKeys")
+	return names
+}
+
+func newBuilder(dir string, memLimit int, p Parameters, fs builderFS) (*Builder, error) {
+	offsetLen := p.OffsetLen
+	offsetIndexLen := p.OffsetIndexLen
+	addressPageLen := p.AddressPageLen
+	addressPrefixLen := p.AddressPrefixLen
+	addressFastmapPrefixLen := p.AddressFastmapPrefixLen
+	addressOffsetLen := p.AddressOffsetLen
+
+	leafHash, err := newLeafHash(p.LeafHash)
+	if err != nil {
+		return nil, err
+	}
+
+	throttle := &ioThrottle{}
+	fs = throttledFS{fs, throttle}
+
+	bufferSize := 8 // Max of used buffers.
+	addressRecordSize := addressPrefixLen + offsetIndexLen
+	if addressRecordSize > bufferSize {
+		bufferSize = addressRecordSize
+	}
+
+	blockchain, err := fs.open(path.Join(dir, "blockchain"))
 	if err != nil {
 		return nil, fmt.Errorf("opening blockchain: %v", err)
 	}
 
-	leavesHashes, err := os.Create(path.Join(dir, "leavesHashes"))
+	leavesHashes, err := fs.open(path.Join(dir, "leavesHashes"))
 	if err != nil {
 		return nil, fmt.Errorf("opening leavesHashes: %v", err)
 	}
 
-	headersFile, err := os.Create(path.Join(dir, "headers"))
+	headersFile, err := fs.open(path.Join(dir, "headers"))
 	if err != nil {
 		return nil, fmt.Errorf("opening headers: %v", err)
 	}
 	headersEncoder := encoding.NewEncoder(headersFile)
 
-	offsets, err := os.Create(path.Join(dir, "offsets"))
+	blockFees, err := fs.open(path.Join(dir, "blockFees"))
+	if err != nil {
+		return nil, fmt.Errorf("opening blockFees: %v", err)
+	}
+
+	contractStats, err := fs.open(path.Join(dir, "contractStats"))
+	if err != nil {
+		return nil, fmt.Errorf("opening contractStats: %v", err)
+	}
+
+	headersMMR, err := fs.open(path.Join(dir, "headersMMR"))
+	if err != nil {
+		return nil, fmt.Errorf("opening headersMMR: %v", err)
+	}
+
+	offsets, err := fs.open(path.Join(dir, "offsets"))
 	if err != nil {
 		return nil, fmt.Errorf("opening offsets: %v", err)
 	}
 
-	blockLocations, err := os.Create(path.Join(dir, "blockLocations"))
+	itemInfo, err := fs.open(path.Join(dir, "itemInfo"))
+	if err != nil {
+		return nil, fmt.Errorf("opening itemInfo: %v", err)
+	}
+
+	blockLocations, err := fs.open(path.Join(dir, "blockLocations"))
 	if err != nil {
 		return nil, fmt.Errorf("opening blockLocations: %v", err)
 	}
 
-	addressesFastmapData, err := os.Create(path.Join(dir, "addressesFastmapData"))
+	// Files of the address index are written under temporary names
+	// and renamed by Close, so a Server using the old index is not
+	// affected by the rebuild.
+	addressesFastmapData, err := fs.create(path.Join(dir, "addressesFastmapData"+newSuffix))
 	if err != nil {
 		return nil, fmt.Errorf("opening addressesFastmapData: %v", err)
 	}
-	addressesFastmapPrefixes, err := os.Create(path.Join(dir, "addressesFastmapPrefixes"))
+	addressesFastmapPrefixes, err := fs.create(path.Join(dir, "addressesFastmapPrefixes"+newSuffix))
 	if err != nil {
 		return nil, fmt.Errorf("opening addressesFastmapPrefixes: %v", err)
 	}
 
-	addressesIndices, err := os.Create(path.Join(dir, "addressesIndices"))
+	addressesIndices, err := fs.create(path.Join(dir, "addressesIndices"+newSuffix))
 	if err != nil {
 		return nil, fmt.Errorf("opening addressesIndices: %v", err)
 	}
@@ -160,11 +488,99 @@ func NewBuilder(dir string, memLimit, offsetLen, offsetIndexLen, addressPageLen,
 		return nil, fmt.Errorf("fastmap.NewMultiMapWriter: %v", err)
 	}
 
-	addressestmp, err := os.Create(path.Join(dir, "addresses.tmp"))
+	// Files of the address tree are empty if it is disabled.
+	addressKeys, err := fs.create(path.Join(dir, "addressKeys"+newSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("opening addressKeys: %v", err)
+	}
+	addressTree, err := fs.create(path.Join(dir, "addressTree"+newSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("opening addressTree: %v", err)
+	}
+	addressTreeWriter := newAddressTreeWriter(leafHash(), addressKeys, addressTree, addressPrefixLen)
+	top := &topAddresses{n: TOP_ADDRESSES}
+	addressesMultiMapWriter.SetKeyCallback(func(key, values []byte) error {
+		top.add(key, len(values)/offsetIndexLen)
+		if p.AddressTree {
+			return addressTreeWriter.addKey(key, values)
+		}
+		return nil
+	})
+
+	addressestmp, err := fs.create(path.Join(dir, "addresses.tmp"))
 	if err != nil {
 		return nil, fmt.Errorf("opening addresses.tmp: %v", err)
 	}
-	addresses, err := emsort.New(addressesMultiMapWriter, addressRecordSize, emsort.BytesLess, memLimit, addressestmp)
+	// Item indices are little endian, so they are compared as numbers
+	// to keep items of an address in the order of the chain.
+	addressOrder := emsort.Fields{
+		{Len: addressPrefixLen},
+		{Len: offsetIndexLen, LittleEndian: true},
+	}
+	addresses, err := emsort.NewWithComparator(addressesMultiMapWriter, addressRecordSize, addressOrder, memLimit, addressestmp)
+	if err != nil {
+		return nil, fmt.Errorf("emsort.NewWithComparator: %v", err)
+	}
+
+	arbitraryData, err := newItemIndexWriter(fs, dir, "arbitraryData", ARBITRARY_DATA_PREFIX_LEN, offsetIndexLen, memLimit)
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := newItemIndexWriter(fs, dir, "hostKeys", crypto.PublicKeySize, offsetIndexLen, memLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeysFile, err := fs.create(path.Join(dir, "publicKeys"+newSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("opening publicKeys: %v", err)
+	}
+	publicKeysTmp, err := fs.create(path.Join(dir, "publicKeys.tmp"))
+	if err != nil {
+		return nil, fmt.Errorf("opening publicKeys.tmp: %v", err)
+	}
+	publicKeysMemLimit := memLimit / 8
+	if publicKeysMemLimit < publicKeyRecordSize {
+		publicKeysMemLimit = publicKeyRecordSize
+	}
+	publicKeysOut := &uniqueWriter{w: &bufferedFile{bufio.NewWriter(publicKeysFile), publicKeysFile}}
+	publicKeys, err := emsort.New(publicKeysOut, publicKeyRecordSize, emsort.BytesLess, publicKeysMemLimit, publicKeysTmp)
+	if err != nil {
+		return nil, fmt.Errorf("emsort.New: %v", err)
+	}
+
+	timelocksFile, err := fs.create(path.Join(dir, "timelocks"+newSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("opening timelocks: %v", err)
+	}
+	timelocksTmp, err := fs.create(path.Join(dir, "timelocks.tmp"))
+	if err != nil {
+		return nil, fmt.Errorf("opening timelocks.tmp: %v", err)
+	}
+	timelocksMemLimit := memLimit / 32
+	if timelocksMemLimit < timelockRecordSize {
+		timelocksMemLimit = timelockRecordSize
+	}
+	timelocksOut := &uniqueWriter{w: &bufferedFile{bufio.NewWriter(timelocksFile), timelocksFile}}
+	timelocks, err := emsort.New(timelocksOut, timelockRecordSize, emsort.BytesLess, timelocksMemLimit, timelocksTmp)
+	if err != nil {
+		return nil, fmt.Errorf("emsort.New: %v", err)
+	}
+
+	multisigKeysFile, err := fs.create(path.Join(dir, "multisigKeys"+newSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("opening multisigKeys: %v", err)
+	}
+	multisigKeysTmp, err := fs.create(path.Join(dir, "multisigKeys.tmp"))
+	if err != nil {
+		return nil, fmt.Errorf("opening multisigKeys.tmp: %v", err)
+	}
+	multisigKeysMemLimit := memLimit / 32
+	if multisigKeysMemLimit < publicKeyRecordSize {
+		multisigKeysMemLimit = publicKeyRecordSize
+	}
+	multisigKeysOut := &uniqueWriter{w: &bufferedFile{bufio.NewWriter(multisigKeysFile), multisigKeysFile}}
+	multisigKeys, err := emsort.New(multisigKeysOut, publicKeyRecordSize, emsort.BytesLess, multisigKeysMemLimit, multisigKeysTmp)
 	if err != nil {
 		return nil, fmt.Errorf("emsort.New: %v", err)
 	}
@@ -173,21 +589,51 @@ func NewBuilder(dir string, memLimit, offsetLen, offsetIndexLen, addressPageLen,
 		return nil, fmt.Errorf("too large offsetLen")
 	}
 
-	return &Builder{
+	b := &Builder{
 		blockchain:      blockchain,
 		blockchainBuf:   bufio.NewWriter(blockchain),
 		leavesHashes:    leavesHashes,
 		leavesHashesBuf: bufio.NewWriter(leavesHashes),
-		siaHash:         crypto.NewHash(),
+		siaHash:         leafHash(),
 
 		headersFile:    headersFile,
 		headersEncoder: headersEncoder,
+		blockFees:      blockFees,
+		contractStats:  contractStats,
+		itemInfo:       itemInfo,
+		itemInfoBuf:    bufio.NewWriter(itemInfo),
+		headersMMR:     newMMRWriter(leafHash(), headersMMR),
 
-		offsets:        offsets,
-		blockLocations: blockLocations,
-		addresses:      addresses,
+		offsets:           offsets,
+		offsetsBuf:        bufio.NewWriter(offsets),
+		blockLocations:    blockLocations,
+		blockLocationsBuf: bufio.NewWriter(blockLocations),
+		addresses:         addresses,
 
 		addressestmp: addressestmp,
+		addressesMap: addressesMultiMapWriter,
+		addressTree:  addressTreeWriter,
+		topAddresses: top,
+
+		arbitraryData: arbitraryData,
+		hostKeys:      hostKeys,
+
+		publicKeys:    publicKeys,
+		publicKeysTmp: publicKeysTmp,
+		publicKeyBuf:  make([]byte, publicKeyRecordSize),
+
+		timelocks:    timelocks,
+		timelocksTmp: timelocksTmp,
+		timelockBuf:  make([]byte, timelockRecordSize),
+
+		multisigKeys:     multisigKeys,
+		multisigKeysTmp:  multisigKeysTmp,
+		multisigKeyBuf:   make([]byte, publicKeyRecordSize),
+		withMultisigKeys: p.MultisigKeys,
+
+		dir:      dir,
+		fs:       fs,
+		throttle: throttle,
 
 		buf:    make([]byte, bufferSize),
 		tmpBuf: make([]byte, 8),
@@ -198,11 +644,45 @@ func NewBuilder(dir string, memLimit, offsetLen, offsetIndexLen, addressPageLen,
 		offsetIndexLen:    offsetIndexLen,
 		addressRecordSize: addressRecordSize,
 		addressPrefixLen:  addressPrefixLen,
-	}, nil
+
+		knownBlocks:   make(map[types.BlockID]int),
+		timestamps:    make([]types.Timestamp, 0, types.MedianTimestampWindow),
+		startParentID: p.StartParentID,
+		startHeight:   p.StartHeight,
+
+		withHeights:  p.AddressHeights,
+		heightSuffix: make([]byte, binary.MaxVarintLen64),
+	}
+	if p.AddressHeights {
+		addressesMultiMapWriter.SetValueSuffix(b.heightOfValue)
+	}
+	return b, nil
 }
 
+// Add appends the block to the index. If the block was already added,
+// it is skipped. Otherwise the block must be a child of the last block.
 func (s *Builder) Add(block *types.Block) error {
-	header := blockHeader{
+	started := time.Now()
+	defer func() {
+		s.addTime += time.Since(started)
+	}()
+	id := block.ID()
+	if _, has := s.knownBlocks[id]; has {
+		return nil
+	}
+	if s.nblocks != 0 && block.ParentID != s.lastBlockID {
+		return fmt.Errorf("block %s is not a child of the last block %s", id, s.lastBlockID)
+	}
+	if s.nblocks == 0 && s.startParentID != nil && block.ParentID != *s.startParentID {
+		return fmt.Errorf("block %s is not a child of the start block %s", id, *s.startParentID)
+	}
+	if s.nblocks == 0 && s.startParentID == nil && id != types.GenesisID {
+		// Otherwise heights of all blocks would be shifted.
+		return fmt.Errorf("the first block %s is not the genesis block %s", id, types.GenesisID)
+	}
+	blockchainLen0 := s.blockchainLen
+	addressCount0 := s.addressCount
+	header := BlockHeader{
 		Nonce:      block.Nonce,
 		Timestamp:  block.Timestamp,
 		MerkleRoot: block.MerkleRoot(),
@@ -210,40 +690,38 @@ func (s *Builder) Add(block *types.Block) error {
 	if err := s.headersEncoder.Encode(header); err != nil {
 		return err
 	}
+	if err := s.writeFees(block); err != nil {
+		return err
+	}
+	if err := s.writeContractStats(block); err != nil {
+		return err
+	}
+	if err := s.headersMMR.add(id); err != nil {
+		return err
+	}
 	offsetFull := s.buf[:8]
 	offset := s.buf[:s.offsetLen]
 	blockLoc := s.buf[:s.offsetIndexLen*2]
-	addressLoc := s.buf[:s.addressRecordSize]
-	addressPrefix := addressLoc[:s.addressPrefixLen]
-	locOfAddress := addressLoc[s.addressPrefixLen:s.addressRecordSize]
-	writeAddress := func(uh types.UnlockHash) error {
-		copy(addressPrefix, uh[:])
-		if n, err := s.addresses.Write(addressLoc); err != nil {
-			return err
-		} else if n != s.addressRecordSize {
-			return io.ErrShortWrite
-		}
-		return nil
-	}
 	firstMinerPayout := s.offsetIndex
 	// See Block.MarshalSia.
 	for _, mp := range block.MinerPayouts {
 		binary.LittleEndian.PutUint64(offsetFull, s.blockchainLen)
-		if n, err := s.offsets.Write(offset); err != nil {
+		if n, err := s.offsetsBuf.Write(offset); err != nil {
 			return err
 		} else if n != s.offsetLen {
 			return io.ErrShortWrite
 		}
-		wireOffsetIndex := s.offsetIndex + 1 // To avoid special 0 value on wire.
-		binary.LittleEndian.PutUint64(s.tmpBuf, wireOffsetIndex)
-		copy(locOfAddress, s.tmpBuf)
-		if err := writeAddress(mp.UnlockHash); err != nil {
+		s.setAddressLoc(s.offsetIndex)
+		if err := s.writeAddress(mp.UnlockHash); err != nil {
 			return err
 		}
 		s.offsetIndex++
 		if err := mp.MarshalSia(&s.dataBuf); err != nil {
 			return err
 		}
+		if err := s.writeItemInfo(s.dataBuf.Len(), nil); err != nil {
+			return err
+		}
 		s.siaHash.Reset()
 		_, _ = s.siaHash.Write([]byte{0x00})
 		_, _ = s.siaHash.Write(s.dataBuf.Bytes())
@@ -257,64 +735,39 @@ func (s *Builder) Add(block *types.Block) error {
 		}
 	}
 	firstTransaction := s.offsetIndex
-	for i, tx := range block.Transactions {
+	for i := range block.Transactions {
 		binary.LittleEndian.PutUint64(offsetFull, s.blockchainLen)
-		if n, err := s.offsets.Write(offset); err != nil {
+		if n, err := s.offsetsBuf.Write(offset); err != nil {
 			return err
 		} else if n != s.offsetLen {
 			return io.ErrShortWrite
 		}
-		wireOffsetIndex := s.offsetIndex + 1 // To avoid special 0 value on wire.
-		binary.LittleEndian.PutUint64(s.tmpBuf, wireOffsetIndex)
-		copy(locOfAddress, s.tmpBuf)
-		for _, si := range tx.SiacoinInputs {
-			if err := writeAddress(si.UnlockConditions.UnlockHash()); err != nil {
-				return err
-			}
+		s.setAddressLoc(s.offsetIndex)
+		if err := forEachAddress(&block.Transactions[i], s.writeAddress); err != nil {
+			return err
 		}
-		for _, si := range tx.SiafundInputs {
-			if err := writeAddress(si.UnlockConditions.UnlockHash()); err != nil {
-				return err
-			}
+		if err := s.writeArbitraryData(&block.Transactions[i], s.offsetIndex); err != nil {
+			return err
 		}
-		for _, so := range tx.SiacoinOutputs {
-			if err := writeAddress(so.UnlockHash); err != nil {
-				return err
-			}
+		if err := s.writePublicKeys(&block.Transactions[i]); err != nil {
+			return err
 		}
-		for _, so := range tx.SiafundOutputs {
-			if err := writeAddress(so.UnlockHash); err != nil {
-				return err
-			}
+		if err := s.writeTimelocks(&block.Transactions[i]); err != nil {
+			return err
 		}
-		for _, contract := range tx.FileContracts {
-			for _, so := range contract.ValidProofOutputs {
-				if err := writeAddress(so.UnlockHash); err != nil {
-					return err
-				}
-			}
-			for _, so := range contract.MissedProofOutputs {
-				if err := writeAddress(so.UnlockHash); err != nil {
-					return err
-				}
-			}
+		if err := s.writeMultisigKeys(&block.Transactions[i]); err != nil {
+			return err
 		}
-		for _, rev := range tx.FileContractRevisions {
-			for _, so := range rev.NewValidProofOutputs {
-				if err := writeAddress(so.UnlockHash); err != nil {
-					return err
-				}
-			}
-			for _, so := range rev.NewMissedProofOutputs {
-				if err := writeAddress(so.UnlockHash); err != nil {
-					return err
-				}
-			}
+		if err := s.writeHostKeys(&block.Transactions[i], s.offsetIndex); err != nil {
+			return err
 		}
 		s.offsetIndex++
 		if err := block.Transactions[i].MarshalSia(&s.dataBuf); err != nil {
 			return err
 		}
+		if err := s.writeItemInfo(s.dataBuf.Len(), &block.Transactions[i]); err != nil {
+			return err
+		}
 		s.siaHash.Reset()
 		_, _ = s.siaHash.Write([]byte{0x00})
 		_, _ = s.siaHash.Write(s.dataBuf.Bytes())
@@ -333,7 +786,7 @@ func (s *Builder) Add(block *types.Block) error {
 	copy(blockLoc[:s.offsetIndexLen], s.tmpBuf)
 	binary.LittleEndian.PutUint64(s.tmpBuf, firstTransaction)
 	copy(blockLoc[s.offsetIndexLen:], s.tmpBuf)
-	if n, err := s.blockLocations.Write(blockLoc); err != nil {
+	if n, err := s.blockLocationsBuf.Write(blockLoc); err != nil {
 		return err
 	} else if n != len(blockLoc) {
 		return io.ErrShortWrite
@@ -341,10 +794,149 @@ func (s *Builder) Add(block *types.Block) error {
 	if s.blockchainLen > s.offsetEnd {
 		return fmt.Errorf("too large offset (%d > %d); increase offsetLen", s.blockchainLen, s.offsetEnd)
 	}
+	s.knownBlocks[id] = s.nblocks
+	s.lastBlockID = id
+	s.nblocks++
+	s.timestamps = pushTimestamp(s.timestamps, block.Timestamp)
+	if s.withHeights {
+		s.blockStarts = append(s.blockStarts, firstMinerPayout)
+	}
+	if s.dropPageCache && s.blockchainLen >= s.nextDrop {
+		if err := s.dropCache(growingFiles); err != nil {
+			return err
+		}
+		s.nextDrop = s.blockchainLen + dropInterval
+	}
+	if s.checkpointInterval != 0 && s.nblocks%s.checkpointInterval == 0 {
+		if err := s.Checkpoint(); err != nil {
+			return fmt.Errorf("checkpoint: %v", err)
+		}
+	}
+	if s.onProgress != nil {
+		s.onProgress(BlockStats{
+			Height:       s.startHeight + s.nblocks - 1,
+			ID:           id,
+			Items:        len(block.MinerPayouts) + len(block.Transactions),
+			Transactions: len(block.Transactions),
+			Bytes:        int(s.blockchainLen - blockchainLen0),
+			Addresses:    s.addressCount - addressCount0,
+			Duration:     time.Since(started),
+		})
+	}
+	return nil
+}
+
+func (s *Builder) writeFees(block *types.Block) error {
+	fees := types.NewCurrency64(0)
+	for _, tx := range block.Transactions {
+		for _, fee := range tx.MinerFees {
+			fees = fees.Add(fee)
+		}
+	}
+	feesBytes := fees.Big().Bytes()
+	if len(feesBytes) > feeSize {
+		return fmt.Errorf("too large sum of fees: %s", fees)
+	}
+	var record [feeSize]byte
+	copy(record[feeSize-len(feesBytes):], feesBytes)
+	if n, err := s.blockFees.Write(record[:]); err != nil {
+		return err
+	} else if n != feeSize {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// LastBlockID returns the ID of the last added block.
+func (s *Builder) LastBlockID() types.BlockID {
+	return s.lastBlockID
+}
+
+// HeaderVerifierState returns the state of HeaderVerifier after the
+// last added block, e.g. to verify headers of the next blocks before
+// downloading them.
+func (s *Builder) HeaderVerifierState() HeaderVerifierState {
+	return HeaderVerifierState{
+		Height:     s.startHeight + s.nblocks,
+		LastID:     s.lastBlockID,
+		Timestamps: append([]types.Timestamp(nil), s.timestamps...),
+	}
+}
+
+// setAddressLoc sets the item index of next address records.
+func (s *Builder) setAddressLoc(offsetIndex uint64) {
+	locOfAddress := s.buf[s.addressPrefixLen:s.addressRecordSize]
+	wireOffsetIndex := offsetIndex + 1 // To avoid special 0 value on wire.
+	binary.LittleEndian.PutUint64(s.tmpBuf, wireOffsetIndex)
+	copy(locOfAddress, s.tmpBuf)
+}
+
+func (s *Builder) writeAddress(uh types.UnlockHash) error {
+	addressLoc := s.buf[:s.addressRecordSize]
+	copy(addressLoc[:s.addressPrefixLen], uh[:])
+	if n, err := s.addresses.Write(addressLoc); err != nil {
+		return err
+	} else if n != s.addressRecordSize {
+		return io.ErrShortWrite
+	}
+	s.addressCount++
+	return nil
+}
+
+// forEachAddress calls f for each address of the transaction.
+func forEachAddress(tx *types.Transaction, f func(types.UnlockHash) error) error {
+	for _, si := range tx.SiacoinInputs {
+		if err := f(si.UnlockConditions.UnlockHash()); err != nil {
+			return err
+		}
+	}
+	for _, si := range tx.SiafundInputs {
+		if err := f(si.UnlockConditions.UnlockHash()); err != nil {
+			return err
+		}
+	}
+	for _, so := range tx.SiacoinOutputs {
+		if err := f(so.UnlockHash); err != nil {
+			return err
+		}
+	}
+	for _, so := range tx.SiafundOutputs {
+		if err := f(so.UnlockHash); err != nil {
+			return err
+		}
+	}
+	for _, contract := range tx.FileContracts {
+		for _, so := range contract.ValidProofOutputs {
+			if err := f(so.UnlockHash); err != nil {
+				return err
+			}
+		}
+		for _, so := range contract.MissedProofOutputs {
+			if err := f(so.UnlockHash); err != nil {
+				return err
+			}
+		}
+	}
+	for _, rev := range tx.FileContractRevisions {
+		for _, so := range rev.NewValidProofOutputs {
+			if err := f(so.UnlockHash); err != nil {
+				return err
+			}
+		}
+		for _, so := range rev.NewMissedProofOutputs {
+			if err := f(so.UnlockHash); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// Close finishes the files and builds the address index.
+// It writes build_report.json, see Report.
 func (s *Builder) Close() error {
+	defer unlockDir(s.lock)
+	flushStarted := time.Now()
 	if err := s.blockchainBuf.Flush(); err != nil {
 		return err
 	}
@@ -360,20 +952,127 @@ func (s *Builder) Close() error {
 	if err := s.headersFile.Close(); err != nil {
 		return err
 	}
+	if err := s.blockFees.Close(); err != nil {
+		return err
+	}
+	if err := s.contractStats.Close(); err != nil {
+		return err
+	}
+	if err := s.itemInfoBuf.Flush(); err != nil {
+		return err
+	}
+	if err := s.itemInfo.Close(); err != nil {
+		return err
+	}
+	if err := s.headersMMR.close(); err != nil {
+		return err
+	}
+	// Offsets point to blockchain and blockLocations point to offsets,
+	// so they are flushed after the files they point to.
+	if err := s.offsetsBuf.Flush(); err != nil {
+		return err
+	}
 	if err := s.offsets.Close(); err != nil {
 		return err
 	}
+	if err := s.blockLocationsBuf.Flush(); err != nil {
+		return err
+	}
 	if err := s.blockLocations.Close(); err != nil {
 		return err
 	}
+	indexStarted := time.Now()
 	if err := s.addresses.Close(); err != nil {
 		return err
 	}
 	if err := s.addressestmp.Close(); err != nil {
 		return err
 	}
-	if err := os.Remove(s.addressestmp.Name()); err != nil {
+	if err := s.addressTree.close(); err != nil {
+		return err
+	}
+	if err := s.fs.remove(path.Join(s.dir, "addresses.tmp")); err != nil {
+		return err
+	}
+	if err := s.arbitraryData.close(); err != nil {
 		return err
 	}
+	if err := s.hostKeys.close(); err != nil {
+		return err
+	}
+	if err := s.publicKeys.Close(); err != nil {
+		return err
+	}
+	if err := s.publicKeysTmp.Close(); err != nil {
+		return err
+	}
+	if err := s.fs.remove(path.Join(s.dir, "publicKeys.tmp")); err != nil {
+		return err
+	}
+	if err := s.timelocks.Close(); err != nil {
+		return err
+	}
+	if err := s.timelocksTmp.Close(); err != nil {
+		return err
+	}
+	if err := s.fs.remove(path.Join(s.dir, "timelocks.tmp")); err != nil {
+		return err
+	}
+	if err := s.multisigKeys.Close(); err != nil {
+		return err
+	}
+	if err := s.multisigKeysTmp.Close(); err != nil {
+		return err
+	}
+	if err := s.fs.remove(path.Join(s.dir, "multisigKeys.tmp")); err != nil {
+		return err
+	}
+	if err := s.writeBlockIDs(); err != nil {
+		return err
+	}
+	for _, name := range renamedFiles() {
+		file := path.Join(s.dir, name)
+		if err := s.fs.rename(file+newSuffix, file); err != nil {
+			return err
+		}
+	}
+	if s.dropPageCache {
+		if err := s.dropCache(reportedFiles); err != nil {
+			return err
+		}
+	}
+	report, err := newBuildReport(s.dir, s.fs, s.addresses.Stats(), s.addressesMap.Stats())
+	if err != nil {
+		return err
+	}
+	if s.addressTree.nleaves != 0 {
+		report.AddressTreeRoot = fmt.Sprintf("%x", s.addressTree.root)
+		report.AddressKeys = s.addressTree.nleaves
+	}
+	report.TopAddresses = s.topAddresses.sorted()
+	if s.nblocks != 0 {
+		report.HeadersMMRRoot = fmt.Sprintf("%x", s.headersMMR.root())
+	}
+	report.Blocks = s.nblocks
+	report.Items = s.offsetIndex
+	report.AddDuration = s.addTime
+	report.FlushDuration = indexStarted.Sub(flushStarted)
+	report.AddressIndexDuration = time.Since(indexStarted)
+	report.DropPageCacheDuration = s.dropTime
+	report.IOThrottleDuration = s.throttle.sleptTime()
+	if err := writeBuildReport(s.dir, s.fs, report); err != nil {
+		return err
+	}
+	if s.checkpointed {
+		if err := s.fs.remove(path.Join(s.dir, CHECKPOINT_FILE)); err != nil {
+			return err
+		}
+	}
+	s.report = report
 	return nil
 }
+
+// Report returns the report of the build. Call it after Close.
+func (s *Builder) Report() *BuildReport {
+	return s.report
+}
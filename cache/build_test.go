@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestAppendOverlapping(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	build := func(dir string, parts [][]*types.Block) error {
+		for i, part := range parts {
+			var b *Builder
+			var err error
+			if i == 0 {
+				b, err = NewBuilder(dir, 1024*1024, 8, 4, 4096, 16, 5, 4)
+			} else {
+				b, err = OpenBuilder(dir, 1024*1024)
+			}
+			if err != nil {
+				return err
+			}
+			for _, block := range part {
+				if err := b.Add(block); err != nil {
+					return err
+				}
+			}
+			if err := b.Close(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	dir1, err := ioutil.TempDir("", "TestAppendOverlapping")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir1)
+	dir2, err := ioutil.TempDir("", "TestAppendOverlapping")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir2)
+	if err := build(dir1, [][]*types.Block{blocks}); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	// Second part overlaps with the first one.
+	if err := build(dir2, [][]*types.Block{blocks[:500], blocks[400:]}); err != nil {
+		t.Fatalf("build with append: %v", err)
+	}
+	files, err := ioutil.ReadDir(dir1)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	for _, f := range files {
+		if f.Name() == "build_report.json" {
+			// Contains durations.
+			continue
+		}
+		data1, err := ioutil.ReadFile(filepath.Join(dir1, f.Name()))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		data2, err := ioutil.ReadFile(filepath.Join(dir2, f.Name()))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		if !bytes.Equal(data1, data2) {
+			t.Errorf("file %s differs after append", f.Name())
+		}
+	}
+	// A block which does not extend the chain is rejected.
+	b, err := OpenBuilder(dir2, 1024*1024)
+	if err != nil {
+		t.Fatalf("OpenBuilder: %v", err)
+	}
+	orphan := *blocks[500]
+	orphan.ParentID = types.BlockID{}
+	if err := b.Add(&orphan); err == nil {
+		t.Errorf("b.Add(orphan) succeeded")
+	}
+	if err := b.Close(); err != nil {
+		t.Errorf("b.Close: %v", err)
+	}
+}
+
+func TestStartHeight(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	const start = 500
+	startParentID := blocks[start-1].ID()
+	p := testParameters()
+	p.StartHeight = start
+	p.StartParentID = &startParentID
+	b, err := NewMemoryBuilderFromParameters(1024*1024, p)
+	if err != nil {
+		t.Fatalf("NewMemoryBuilderFromParameters: %v", err)
+	}
+	if err := b.Add(blocks[start+1]); err == nil {
+		t.Errorf("b.Add accepted a block which is not a child of StartParentID")
+	}
+	s := buildTestServer(t, p, blocks[start:])
+	if s.NumBlocks() != len(blocks)-start {
+		t.Fatalf("NumBlocks() = %d, want %d", s.NumBlocks(), len(blocks)-start)
+	}
+	err = s.ForEachBlock(0, s.NumBlocks(), func(block *DecodedBlock) error {
+		want := blocks[block.Height]
+		if block.ID != want.ID() {
+			t.Errorf("block %d: ID = %s, want %s", block.Height, block.ID, want.ID())
+		}
+		subsidy := types.CalculateCoinbase(types.BlockHeight(block.Height))
+		if block.Reward.Subsidy.Cmp(subsidy) != 0 {
+			t.Errorf("block %d: subsidy = %s, want %s", block.Height, block.Reward.Subsidy, subsidy)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachBlock: %v", err)
+	}
+	// Item IDs refer to heights, not to positions in the index.
+	_, _, nitems, err := s.GetBlockItems(s.NumBlocks() - 1)
+	if err != nil {
+		t.Fatalf("GetBlockItems: %v", err)
+	}
+	for itemIndex := 0; itemIndex < nitems; itemIndex++ {
+		item, err := s.GetItemWithoutProof(itemIndex)
+		if err != nil {
+			t.Fatalf("GetItemWithoutProof(%d): %v", itemIndex, err)
+		}
+		id, err := ParseItemID(item.ID)
+		if err != nil {
+			t.Fatalf("ParseItemID(%q): %v", item.ID, err)
+		}
+		if got, err := s.ItemIndex(id); err != nil || got != itemIndex {
+			t.Errorf("ItemIndex(%s) = %d, %v; want %d", id, got, err, itemIndex)
+		}
+		payout, tx, err := DecodeItem(item)
+		if err != nil {
+			t.Fatalf("DecodeItem: %v", err)
+		}
+		block := blocks[id.Height]
+		if id.Type == ITEM_MINER_PAYOUT && (payout == nil || payout.UnlockHash != block.MinerPayouts[id.Index].UnlockHash) {
+			t.Errorf("item %s is not miner payout %d of block %d", id, id.Index, id.Height)
+		}
+		if id.Type == ITEM_TRANSACTION && (tx == nil || tx.ID() != block.Transactions[id.Index].ID()) {
+			t.Errorf("item %s is not transaction %d of block %d", id, id.Index, id.Height)
+		}
+	}
+	for _, bad := range []string{"", "1:t", "x:t:0", "1:x:0", "1:t:-1", "0:t:0", "1000:p:0", "600:p:100"} {
+		if _, err := s.GetItemByID(bad); err == nil {
+			t.Errorf("GetItemByID(%q) succeeded", bad)
+		}
+	}
+	// Items after the tip are distinguished from missing items.
+	if _, err := s.GetItemByID("1000:p:0"); err != ErrNotYetIndexed {
+		t.Errorf("GetItemByID of an item after the tip returned %v, want %v", err, ErrNotYetIndexed)
+	}
+	if _, err := s.GetItemByID("600:p:100"); err != ErrNoItem {
+		t.Errorf("GetItemByID of a missing item returned %v, want %v", err, ErrNoItem)
+	}
+}
+
+func BenchmarkBuilder(b *testing.B) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		b.Fatalf("read1000Blocks: %v", err)
+	}
+	for i := 0; i < b.N; i++ {
+		dir, err := ioutil.TempDir("", "BenchmarkBuilder")
+		if err != nil {
+			b.Fatalf("ioutil.TempDir: %v", err)
+		}
+		builder, err := NewBuilder(dir, 1024*1024, 8, 4, 4096, 16, 5, 4)
+		if err != nil {
+			b.Fatalf("NewBuilder: %v", err)
+		}
+		for _, block := range blocks {
+			if err := builder.Add(block); err != nil {
+				b.Fatalf("builder.Add: %v", err)
+			}
+		}
+		if err := builder.Close(); err != nil {
+			b.Fatalf("builder.Close: %v", err)
+		}
+		os.RemoveAll(dir)
+	}
+}
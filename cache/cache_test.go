@@ -2,12 +2,14 @@ package cache
 
 import (
 	"compress/gzip"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
 
@@ -83,6 +85,58 @@ func readAddresses() ([]string, error) {
 	return addresses, nil
 }
 
+// testParameters returns the parameters of indices built by tests.
+func testParameters() Parameters {
+	return Parameters{
+		OffsetLen:               8,
+		OffsetIndexLen:          4,
+		AddressPageLen:          4096,
+		AddressPrefixLen:        32,
+		AddressFastmapPrefixLen: 5,
+		AddressOffsetLen:        4,
+	}
+}
+
+// buildTestIndex builds the index of blocks with parameters p and opens
+// it. If dir is empty, the index is built in memory, otherwise in dir,
+// which must exist and be empty. The caller closes the Server.
+func buildTestIndex(tb testing.TB, dir string, p Parameters, blocks []*types.Block) (*Builder, *Server) {
+	var b *Builder
+	var err error
+	if dir == "" {
+		b, err = NewMemoryBuilderFromParameters(1024*1024, p)
+	} else {
+		b, err = NewBuilderFromParameters(dir, 1024*1024, p)
+	}
+	if err != nil {
+		tb.Fatalf("creating Builder: %v", err)
+	}
+	for _, block := range blocks {
+		if err := b.Add(block); err != nil {
+			tb.Fatalf("b.Add: %v", err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		tb.Fatalf("b.Close: %v", err)
+	}
+	var s *Server
+	if dir == "" {
+		s, err = NewServerFromBytes(b.MemoryFiles())
+	} else {
+		s, err = NewServer(dir)
+	}
+	if err != nil {
+		tb.Fatalf("opening Server: %v", err)
+	}
+	return b, s
+}
+
+// buildTestServer builds the index of blocks in memory.
+func buildTestServer(tb testing.TB, p Parameters, blocks []*types.Block) *Server {
+	_, s := buildTestIndex(tb, "", p, blocks)
+	return s
+}
+
 func TestOnRealBlocks(t *testing.T) {
 	blocks, err := read1000Blocks()
 	if err != nil {
@@ -149,6 +203,8 @@ next:
 			t.Errorf("NewServer: %v", err)
 			continue next
 		}
+		s.SetPrefetchHistory(true)
+		s.Prefetch([]int{-1, 0, s.nitems - 1, s.nitems})
 	next2:
 		for _, address := range addresses {
 			addressBytes, err := hex.DecodeString(address)
@@ -165,6 +221,20 @@ next:
 				t.Errorf("s.GetHistory(%s): returned nothing", address)
 				continue next2
 			}
+			seen := make(map[[2]int]bool)
+			for _, item := range history {
+				key := [2]int{item.Block, item.Index}
+				if seen[key] {
+					t.Errorf("s.GetHistory(%s): duplicate item %v", address, key)
+				}
+				seen[key] = true
+				if tc.addressPrefixLen == 32 && item.Roles == 0 {
+					t.Errorf("s.GetHistory(%s): item %v has no roles", address, key)
+				}
+				if want := s.NumBlocks() - item.Block; item.Confirmations != want {
+					t.Errorf("s.GetHistory(%s): item %v has %d confirmations, want %d", address, key, item.Confirmations, want)
+				}
+			}
 			// Change the first byte and make sure nothing is found.
 			addressBytes[0] = ^addressBytes[0]
 			history, _, err = s.GetHistory(addressBytes[:32], "")
@@ -187,3 +257,162 @@ next:
 		}
 	}
 }
+
+func TestAddressWindow(t *testing.T) {
+	s := &Server{offsetIndexLen: 4}
+	encode := func(itemIndices ...int) []byte {
+		values := make([]byte, 4*len(itemIndices))
+		for i, itemIndex := range itemIndices {
+			binary.LittleEndian.PutUint32(values[4*i:], uint32(itemIndex+1))
+		}
+		return values
+	}
+	cases := []struct {
+		values []byte
+		n      int
+		want   []int
+		total  int
+	}{
+		{encode(1, 2, 2, 3, 300), 3, []int{1, 2, 3}, 5},
+		{encode(1, 2, 2, 3, 300), 10, []int{1, 2, 3, 300}, 5},
+		// Indices built before the address index was sorted by item
+		// index as a number.
+		{encode(256, 1, 300), 1, []int{1, 256, 300}, 3},
+	}
+	for _, c := range cases {
+		got, total, err := s.addressWindow(c.values, "", c.n)
+		if err != nil {
+			t.Fatalf("addressWindow: %v", err)
+		}
+		if !reflect.DeepEqual(got, c.want) || total != c.total {
+			t.Errorf("addressWindow(%v, %d): got %v (total %d), want %v (total %d)", c.values, c.n, got, total, c.want, c.total)
+		}
+	}
+}
+
+// benchParameters returns the parameter sets compared by
+// BenchmarkParameters: the parameters of sialitebuilder by default and
+// variations of them.
+func benchParameters() []struct {
+	name string
+	par  Parameters
+} {
+	base := Parameters{
+		OffsetLen:               8,
+		OffsetIndexLen:          4,
+		AddressPageLen:          4096,
+		AddressPrefixLen:        16,
+		AddressFastmapPrefixLen: 5,
+		AddressOffsetLen:        4,
+	}
+	sets := []struct {
+		name string
+		par  Parameters
+	}{{"default", base}}
+	add := func(name string, change func(p *Parameters)) {
+		p := base
+		change(&p)
+		sets = append(sets, struct {
+			name string
+			par  Parameters
+		}{name, p})
+	}
+	add("prefix32", func(p *Parameters) { p.AddressPrefixLen = 32 })
+	add("prefix8", func(p *Parameters) { p.AddressPrefixLen, p.AddressFastmapPrefixLen = 8, 4 })
+	add("page1024", func(p *Parameters) { p.AddressPageLen = 1024 })
+	add("page16384", func(p *Parameters) { p.AddressPageLen = 16384 })
+	add("fastmap3", func(p *Parameters) { p.AddressFastmapPrefixLen = 3 })
+	add("sha256", func(p *Parameters) { p.LeafHash = HASH_SHA256 })
+	add("tree", func(p *Parameters) { p.AddressTree = true })
+	add("heights", func(p *Parameters) { p.AddressHeights = true })
+	return sets
+}
+
+func buildBenchIndex(blocks []*types.Block, par Parameters) (*Builder, error) {
+	builder, err := NewMemoryBuilderFromParameters(1024*1024, par)
+	if err != nil {
+		return nil, fmt.Errorf("NewMemoryBuilderFromParameters: %v", err)
+	}
+	for _, block := range blocks {
+		if err := builder.Add(block); err != nil {
+			return nil, fmt.Errorf("builder.Add: %v", err)
+		}
+	}
+	if err := builder.Close(); err != nil {
+		return nil, fmt.Errorf("builder.Close: %v", err)
+	}
+	return builder, nil
+}
+
+// BenchmarkParameters builds the index of the first 1000 blocks of
+// mainnet with each of benchParameters and measures the build, the
+// lookup of the history of addresses of testdata/addresses.txt and the
+// sizes of the index (custom metrics of the Build benchmarks), to guide
+// the defaults of sialitebuilder. Compare parameter sets with
+//
+//	go test -run '^$' -bench Parameters -benchmem ./cache
+func BenchmarkParameters(b *testing.B) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		b.Fatalf("read1000Blocks: %v", err)
+	}
+	hexAddresses, err := readAddresses()
+	if err != nil {
+		b.Fatalf("readAddresses: %v", err)
+	}
+	var addresses [][]byte
+	for _, address := range hexAddresses {
+		addressBytes, err := hex.DecodeString(address)
+		if err != nil {
+			b.Fatalf("hex.DecodeString(%s): %v", address, err)
+		}
+		addresses = append(addresses, addressBytes[:32])
+	}
+	for _, bp := range benchParameters() {
+		par := bp.par
+		b.Run("Build-"+bp.name, func(b *testing.B) {
+			var stats IndexStats
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				builder, err := buildBenchIndex(blocks, par)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if i == 0 {
+					b.StopTimer()
+					s, err := NewServerFromBytes(builder.MemoryFiles())
+					if err != nil {
+						b.Fatalf("NewServerFromBytes: %v", err)
+					}
+					stats = s.Stats()
+					b.StartTimer()
+				}
+			}
+			b.ReportMetric(float64(stats.TotalSize), "index-bytes")
+			b.ReportMetric(float64(stats.AddressIndexSize), "address-index-bytes")
+			b.ReportMetric(stats.BytesPerAddress, "bytes/address")
+			b.ReportMetric(float64(stats.AddressPages), "address-pages")
+		})
+		b.Run("History-"+bp.name, func(b *testing.B) {
+			builder, err := buildBenchIndex(blocks, par)
+			if err != nil {
+				b.Fatal(err)
+			}
+			s, err := NewServerFromBytes(builder.MemoryFiles())
+			if err != nil {
+				b.Fatalf("NewServerFromBytes: %v", err)
+			}
+			items := 0
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				page, err := s.GetHistoryPage(addresses[i%len(addresses)], "", 100)
+				if err != nil {
+					b.Fatalf("GetHistoryPage: %v", err)
+				}
+				items += len(page.Items)
+			}
+			b.ReportMetric(float64(items)/float64(b.N), "items/op")
+		})
+	}
+}
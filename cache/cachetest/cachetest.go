@@ -0,0 +1,147 @@
+// Package cachetest builds indices of the test blocks of package cache
+// for tests of other packages.
+package cachetest
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	blocksOnce sync.Once
+	blocks     []*types.Block
+	blocksErr  error
+)
+
+// testdata returns the path of the file in cache/testdata.
+func testdata(name string) (string, error) {
+	_, filename, _, ok := runtime.Caller(0)
+	if !ok {
+		return "", fmt.Errorf("Unable to find current package file")
+	}
+	return filepath.Join(filepath.Dir(filename), "..", "testdata", name), nil
+}
+
+// ReadBlocks returns the first 1000 blocks of Sia. They are read once
+// and shared by the callers, so they must not be modified.
+func ReadBlocks() ([]*types.Block, error) {
+	blocksOnce.Do(func() {
+		blocks, blocksErr = readBlocks()
+	})
+	return blocks, blocksErr
+}
+
+func readBlocks() ([]*types.Block, error) {
+	blocksFile, err := testdata("first_1000.blocks.gz")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(blocksFile)
+	if err != nil {
+		return nil, fmt.Errorf("os.Open(%q): %v", blocksFile, err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("gzip.NewReader: %v", err)
+	}
+	var blocks []*types.Block
+	for {
+		var block types.Block
+		err := encoding.ReadObject(gz, &block, types.BlockSizeLimit)
+		if err == io.EOF {
+			return blocks, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("encoding.ReadObject: %v", err)
+		}
+		blocks = append(blocks, &block)
+	}
+}
+
+// ReadAddresses returns addresses used in the first 1000 blocks in the
+// standard form with checksum.
+func ReadAddresses() ([]string, error) {
+	addressesFile, err := testdata("addresses.txt")
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(addressesFile)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(%q): %v", addressesFile, err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// ReadUnlockHashes returns the addresses of ReadAddresses decoded.
+func ReadUnlockHashes() ([]types.UnlockHash, error) {
+	addresses, err := ReadAddresses()
+	if err != nil {
+		return nil, err
+	}
+	var uhs []types.UnlockHash
+	for _, address := range addresses {
+		data, err := hex.DecodeString(address)
+		if err != nil {
+			return nil, fmt.Errorf("hex.DecodeString(%q): %v", address, err)
+		}
+		var uh types.UnlockHash
+		copy(uh[:], data)
+		uhs = append(uhs, uh)
+	}
+	return uhs, nil
+}
+
+// Parameters returns the parameters of indices built by tests.
+func Parameters() cache.Parameters {
+	return cache.Parameters{
+		OffsetLen:               8,
+		OffsetIndexLen:          4,
+		AddressPageLen:          4096,
+		AddressPrefixLen:        32,
+		AddressFastmapPrefixLen: 5,
+		AddressOffsetLen:        4,
+	}
+}
+
+// Checkpoint returns p changed to build the index of blocks[start:],
+// starting from a checkpoint at height start.
+func Checkpoint(p cache.Parameters, blocks []*types.Block, start int) cache.Parameters {
+	parentID := blocks[start-1].ID()
+	p.StartHeight = start
+	p.StartParentID = &parentID
+	return p
+}
+
+// BuildServer builds the index of blocks with parameters p in memory.
+func BuildServer(tb testing.TB, p cache.Parameters, blocks []*types.Block) *cache.Server {
+	b, err := cache.NewMemoryBuilderFromParameters(1024*1024, p)
+	if err != nil {
+		tb.Fatalf("NewMemoryBuilderFromParameters: %v", err)
+	}
+	for _, block := range blocks {
+		if err := b.Add(block); err != nil {
+			tb.Fatalf("b.Add: %v", err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		tb.Fatalf("b.Close: %v", err)
+	}
+	s, err := cache.NewServerFromBytes(b.MemoryFiles())
+	if err != nil {
+		tb.Fatalf("NewServerFromBytes: %v", err)
+	}
+	return s
+}
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A long build interrupted by a crash or a reboot leaves files of
+// blocks with torn records and no address index, so it could only be
+// restarted from scratch. With SetCheckpointInterval the builder
+// periodically writes the files of blocks to disk and records their
+// sizes in CHECKPOINT_FILE. ResumeBuilder truncates the files to the
+// sizes of the last checkpoint and continues as OpenBuilder does: the
+// external sorts are not resumed, the address index and other sorted
+// indices are rebuilt from the blocks of the checkpoint.
+
+// CHECKPOINT_FILE is the name of the file written by Builder.Checkpoint
+// in the directory of the index. Close removes it.
+const CHECKPOINT_FILE = "checkpoint.json"
+
+var ErrNoCheckpoint = fmt.Errorf("No checkpoint in the directory")
+
+// blockFiles are the files appended by Builder.Add, in the order of
+// flushing: a file is written to disk after the files it points to.
+var blockFiles = []string{
+	"blockchain",
+	"leavesHashes",
+	"headers",
+	"blockFees",
+	"contractStats",
+	"itemInfo",
+	"headersMMR",
+	"offsets",
+	"blockLocations",
+}
+
+// Checkpoint is the contents of CHECKPOINT_FILE.
+type Checkpoint struct {
+	Blocks int
+	Items  uint64
+	// Height is the height of the last block.
+	Height      int
+	LastBlockID types.BlockID
+
+	// Sizes of blockFiles, bytes.
+	FileSizes map[string]int64
+
+	// State of the external sort of the address index at the
+	// checkpoint. The sort is not resumed, it is informational.
+	EmsortChunks   int
+	EmsortTmpBytes int64
+
+	Time time.Time
+}
+
+// SetCheckpointInterval makes Add call Checkpoint after each block with
+// index divisible by n. 0 disables checkpoints.
+func (s *Builder) SetCheckpointInterval(n int) {
+	s.checkpointInterval = n
+}
+
+// Checkpoint flushes the files of blocks, writes them to disk and
+// records their sizes in CHECKPOINT_FILE, so ResumeBuilder can continue
+// the build from the current block if it is interrupted.
+func (s *Builder) Checkpoint() error {
+	started := time.Now()
+	if err := s.blockchainBuf.Flush(); err != nil {
+		return err
+	}
+	if err := s.leavesHashesBuf.Flush(); err != nil {
+		return err
+	}
+	if err := s.itemInfoBuf.Flush(); err != nil {
+		return err
+	}
+	if err := s.headersMMR.flush(); err != nil {
+		return err
+	}
+	if err := s.offsetsBuf.Flush(); err != nil {
+		return err
+	}
+	if err := s.blockLocationsBuf.Flush(); err != nil {
+		return err
+	}
+	c := Checkpoint{
+		Blocks:      s.nblocks,
+		Items:       s.offsetIndex,
+		Height:      s.startHeight + s.nblocks - 1,
+		LastBlockID: s.lastBlockID,
+		FileSizes:   make(map[string]int64),
+	}
+	for _, name := range blockFiles {
+		file := path.Join(s.dir, name)
+		if err := s.fs.sync(file); err != nil {
+			return fmt.Errorf("sync %s: %v", name, err)
+		}
+		size, err := s.fs.size(file)
+		if err != nil {
+			return fmt.Errorf("size of %s: %v", name, err)
+		}
+		c.FileSizes[name] = size
+	}
+	stats := s.addresses.Stats()
+	c.EmsortChunks = stats.Chunks
+	c.EmsortTmpBytes = stats.TmpBytes
+	c.Time = started
+	file := path.Join(s.dir, CHECKPOINT_FILE)
+	f, err := s.fs.create(file + ".tmp")
+	if err != nil {
+		return fmt.Errorf("opening %s: %v", CHECKPOINT_FILE, err)
+	}
+	e := json.NewEncoder(f)
+	e.SetIndent("", "\t")
+	if err := e.Encode(c); err != nil {
+		f.Close()
+		return fmt.Errorf("JSON Encode: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("JSON Close: %v", err)
+	}
+	if err := s.fs.sync(file + ".tmp"); err != nil {
+		return err
+	}
+	if err := s.fs.rename(file+".tmp", file); err != nil {
+		return err
+	}
+	s.checkpointed = true
+	return nil
+}
+
+// ReadCheckpoint returns the last checkpoint of the build in dir or
+// ErrNoCheckpoint.
+func ReadCheckpoint(dir string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path.Join(dir, CHECKPOINT_FILE))
+	if os.IsNotExist(err) {
+		return nil, ErrNoCheckpoint
+	} else if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", CHECKPOINT_FILE, err)
+	}
+	return &c, nil
+}
+
+// ResumeBuilder reopens the directory of an interrupted build to append
+// blocks after its last checkpoint. Data written after the checkpoint
+// is discarded. As with OpenBuilder, blocks already present are skipped
+// by Add. Servers using an older index in the directory continue to
+// work, since files are not truncated below the sizes they map.
+func ResumeBuilder(dir string, memLimit int) (*Builder, error) {
+	lock, err := lockDir(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := resumeBuilder(dir, memLimit)
+	if err != nil {
+		unlockDir(lock)
+		return nil, err
+	}
+	b.lock = lock
+	return b, nil
+}
+
+func resumeBuilder(dir string, memLimit int) (*Builder, error) {
+	c, err := ReadCheckpoint(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range blockFiles {
+		want, has := c.FileSizes[name]
+		if !has {
+			return nil, fmt.Errorf("%s: no size of %s", CHECKPOINT_FILE, name)
+		}
+		file := path.Join(dir, name)
+		stat, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if stat.Size() < want {
+			return nil, fmt.Errorf("%s is truncated: %d bytes, want %d", name, stat.Size(), want)
+		}
+		if err := os.Truncate(file, want); err != nil {
+			return nil, err
+		}
+	}
+	p, err := readParameters(dir)
+	if err != nil {
+		return nil, err
+	}
+	s, err := openBlocks(dir, p)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	if s.NumBlocks() != c.Blocks {
+		return nil, fmt.Errorf("%d blocks after truncation, want %d", s.NumBlocks(), c.Blocks)
+	}
+	b, err := appendBuilder(dir, memLimit, p, s)
+	if err != nil {
+		return nil, err
+	}
+	if b.lastBlockID != c.LastBlockID {
+		return nil, fmt.Errorf("the last block is %s, want %s", b.lastBlockID, c.LastBlockID)
+	}
+	b.checkpointed = true
+	return b, nil
+}
+
+// openBlocks returns Server reading only blockFiles. Other indices may
+// be absent in an interrupted build. It is enough for ForEachBlock.
+func openBlocks(dir string, par Parameters) (*Server, error) {
+	files, err := mmapFiles(dir, blockFiles)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		par:            par,
+		offsetLen:      par.OffsetLen,
+		offsetIndexLen: par.OffsetIndexLen,
+
+		Blockchain:     files["blockchain"],
+		Offsets:        files["offsets"],
+		BlockLocations: files["blockLocations"],
+		LeavesHashes:   files["leavesHashes"],
+		Headers:        files["headers"],
+		BlockFees:      files["blockFees"],
+		ContractStats:  files["contractStats"],
+		ItemInfo:       files["itemInfo"],
+		HeadersMMR:     files["headersMMR"],
+
+		mmaped: true,
+	}
+	s.nblocks = len(s.BlockLocations) / (2 * par.OffsetIndexLen)
+	s.nitems = len(s.Offsets) / par.OffsetLen
+	if s.nblocks*(2*par.OffsetIndexLen) != len(s.BlockLocations) || s.nitems*par.OffsetLen != len(s.Offsets) {
+		s.Close()
+		return nil, fmt.Errorf("Bad length of blockLocations or offsets")
+	}
+	return s, nil
+}
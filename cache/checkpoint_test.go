@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeBuilder(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	dir1, err := ioutil.TempDir("", "TestResumeBuilder")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir1)
+	dir2, err := ioutil.TempDir("", "TestResumeBuilder")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir2)
+	b1, err := NewBuilder(dir1, 1024*1024, 8, 4, 4096, 16, 5, 4)
+	if err != nil {
+		t.Fatalf("NewBuilder: %v", err)
+	}
+	for _, block := range blocks {
+		if err := b1.Add(block); err != nil {
+			t.Fatalf("b1.Add: %v", err)
+		}
+	}
+	if err := b1.Close(); err != nil {
+		t.Fatalf("b1.Close: %v", err)
+	}
+	if _, err := ResumeBuilder(dir1, 1024*1024); err != ErrNoCheckpoint {
+		t.Errorf("ResumeBuilder of complete index: want ErrNoCheckpoint, got %v", err)
+	}
+	b2, err := NewBuilder(dir2, 1024*1024, 8, 4, 4096, 16, 5, 4)
+	if err != nil {
+		t.Fatalf("NewBuilder: %v", err)
+	}
+	b2.SetCheckpointInterval(300)
+	for _, block := range blocks[:700] {
+		if err := b2.Add(block); err != nil {
+			t.Fatalf("b2.Add: %v", err)
+		}
+	}
+	// Interrupt the build: b2 is not closed and blockchain has a torn
+	// record after the checkpoint.
+	unlockDir(b2.lock)
+	f, err := os.OpenFile(filepath.Join(dir2, "blockchain"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("os.OpenFile: %v", err)
+	}
+	if _, err := f.Write([]byte("torn")); err != nil {
+		t.Fatalf("f.Write: %v", err)
+	}
+	f.Close()
+	c, err := ReadCheckpoint(dir2)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint: %v", err)
+	}
+	if c.Blocks != 600 || c.Height != 599 || c.LastBlockID != blocks[599].ID() {
+		t.Errorf("checkpoint: %d blocks, height %d, last block %s", c.Blocks, c.Height, c.LastBlockID)
+	}
+	b3, err := ResumeBuilder(dir2, 1024*1024)
+	if err != nil {
+		t.Fatalf("ResumeBuilder: %v", err)
+	}
+	if b3.LastBlockID() != blocks[599].ID() {
+		t.Errorf("LastBlockID after resume: got %s, want %s", b3.LastBlockID(), blocks[599].ID())
+	}
+	// The source of blocks may overlap with the checkpoint.
+	for _, block := range blocks[500:] {
+		if err := b3.Add(block); err != nil {
+			t.Fatalf("b3.Add: %v", err)
+		}
+	}
+	if err := b3.Close(); err != nil {
+		t.Fatalf("b3.Close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir2, CHECKPOINT_FILE)); !os.IsNotExist(err) {
+		t.Errorf("%s is not removed by Close: %v", CHECKPOINT_FILE, err)
+	}
+	files1, err := ioutil.ReadDir(dir1)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	files2, err := ioutil.ReadDir(dir2)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	if len(files1) != len(files2) {
+		t.Errorf("%d files after resume, want %d", len(files2), len(files1))
+	}
+	for _, f := range files1 {
+		if f.Name() == "build_report.json" {
+			// Contains durations.
+			continue
+		}
+		data1, err := ioutil.ReadFile(filepath.Join(dir1, f.Name()))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		data2, err := ioutil.ReadFile(filepath.Join(dir2, f.Name()))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		if !bytes.Equal(data1, data2) {
+			t.Errorf("file %s differs after resume", f.Name())
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Clock returns the current time. Verification of timestamps depends on
+// the current time, so it is injected to verify headers as of another
+// time, e.g. in tests or when replaying historical verification.
+type Clock interface {
+	Now() types.Timestamp
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() types.Timestamp {
+	return types.CurrentTimestamp()
+}
+
+// SystemClock is the Clock of the system time.
+var SystemClock Clock = systemClock{}
+
+// FixedClock is a Clock which always returns the same time.
+type FixedClock types.Timestamp
+
+func (c FixedClock) Now() types.Timestamp {
+	return types.Timestamp(c)
+}
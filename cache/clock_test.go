@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestClock(t *testing.T) {
+	if now := FixedClock(1234).Now(); now != 1234 {
+		t.Errorf("FixedClock(1234).Now() = %d, want 1234", now)
+	}
+	before := types.CurrentTimestamp()
+	now := SystemClock.Now()
+	after := types.CurrentTimestamp()
+	if now < before || now > after {
+		t.Errorf("SystemClock.Now() = %d, want between %d and %d", now, before, after)
+	}
+}
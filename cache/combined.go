@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+)
+
+// Combined layout: all files of an index in one file, which is easier to
+// distribute as a snapshot and needs one file descriptor and one mmap.
+// The file starts with the section table:
+//
+//   magic     [8]byte "SIALITEC"
+//   version   uint32
+//   nsections uint32
+//   sections  nsections * (name [32]byte, offset uint64, length uint64)
+//
+// Names are names of files of the directory layout, zero padded. Each
+// section starts at a multiple of combinedAlign, so it is page aligned
+// when the file is mmaped. Integers are little endian. The combined file
+// is written by WriteCombined from a complete directory and is never
+// modified; the directory layout is still used by Builder.
+
+// COMBINED_FILE is the name of the combined file in a directory. NewServer
+// opens it in directories without the directory layout.
+const COMBINED_FILE = "index.combined"
+
+const (
+	combinedMagic     = "SIALITEC"
+	combinedVersion   = 1
+	combinedNameLen   = 32
+	combinedEntrySize = combinedNameLen + 8 + 8
+	combinedAlign     = 64 * 1024 // Max page size of supported platforms.
+)
+
+var ErrNotCombined = fmt.Errorf("Not a combined index file")
+
+// combinedFiles returns names of sections of the combined file.
+func combinedFiles() []string {
+	return append([]string{"parameters.json"}, serverFiles()...)
+}
+
+func alignCombined(offset int64) int64 {
+	return (offset + combinedAlign - 1) / combinedAlign * combinedAlign
+}
+
+// WriteCombined writes the index of the directory dir to the combined
+// file out. The file is written to out.tmp and renamed, so out is
+// replaced atomically.
+func WriteCombined(dir, out string) error {
+	lock, err := lockDir(dir, false)
+	if err != nil {
+		return err
+	}
+	defer unlockDir(lock)
+	names := combinedFiles()
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	table := make([]byte, 16+len(names)*combinedEntrySize)
+	copy(table, combinedMagic)
+	binary.LittleEndian.PutUint32(table[8:], combinedVersion)
+	binary.LittleEndian.PutUint32(table[12:], uint32(len(names)))
+	offset := alignCombined(int64(len(table)))
+	for i, name := range names {
+		entry := table[16+i*combinedEntrySize:]
+		copy(entry[:combinedNameLen], name)
+		in, err := os.Open(path.Join(dir, name))
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			in.Close()
+			f.Close()
+			return err
+		}
+		n, err := io.Copy(f, in)
+		in.Close()
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("copying %s: %v", name, err)
+		}
+		binary.LittleEndian.PutUint64(entry[combinedNameLen:], uint64(offset))
+		binary.LittleEndian.PutUint64(entry[combinedNameLen+8:], uint64(n))
+		offset = alignCombined(offset + n)
+	}
+	if _, err := f.WriteAt(table, 0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+// parseCombined returns sections of the combined file.
+func parseCombined(data []byte) (map[string][]byte, error) {
+	if len(data) < 16 || string(data[:8]) != combinedMagic {
+		return nil, ErrNotCombined
+	}
+	if version := binary.LittleEndian.Uint32(data[8:]); version != combinedVersion {
+		return nil, fmt.Errorf("unknown version of combined file: %d", version)
+	}
+	nsections := int(binary.LittleEndian.Uint32(data[12:]))
+	if nsections > (len(data)-16)/combinedEntrySize {
+		return nil, fmt.Errorf("Bad number of sections: %d", nsections)
+	}
+	files := make(map[string][]byte, nsections)
+	for i := 0; i < nsections; i++ {
+		entry := data[16+i*combinedEntrySize:]
+		name := string(bytes.TrimRight(entry[:combinedNameLen], "\x00"))
+		offset := binary.LittleEndian.Uint64(entry[combinedNameLen:])
+		length := binary.LittleEndian.Uint64(entry[combinedNameLen+8:])
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return nil, fmt.Errorf("Section %s is out of file", name)
+		}
+		files[name] = data[offset : offset+length : offset+length]
+	}
+	return files, nil
+}
+
+// openCombined mmaps the combined file.
+func openCombined(file string) (*Server, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		return nil, ErrNotCombined
+	}
+	data, err := mmapFile(f, int(stat.Size()))
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewServerFromCombined(data)
+	if err != nil {
+		munmap(data)
+		return nil, err
+	}
+	s.mmaped = true
+	s.unmap = func() error {
+		return munmap(data)
+	}
+	runtime.SetFinalizer(s, (*Server).Close)
+	return s, nil
+}
+
+// NewServerFromCombined creates Server from contents of a combined file.
+func NewServerFromCombined(data []byte) (*Server, error) {
+	files, err := parseCombined(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewServerFromBytes(files)
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCombinedLayout(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestCombinedLayout")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	indexDir := filepath.Join(dir, "index")
+	if err := os.Mkdir(indexDir, 0755); err != nil {
+		t.Fatalf("os.Mkdir: %v", err)
+	}
+	_, s1 := buildTestIndex(t, indexDir, testParameters(), blocks)
+	defer s1.Close()
+	snapshotDir := filepath.Join(dir, "snapshot")
+	if err := os.Mkdir(snapshotDir, 0755); err != nil {
+		t.Fatalf("os.Mkdir: %v", err)
+	}
+	combined := filepath.Join(snapshotDir, COMBINED_FILE)
+	if err := WriteCombined(indexDir, combined); err != nil {
+		t.Fatalf("WriteCombined: %v", err)
+	}
+
+	for _, p := range []string{combined, snapshotDir} {
+		s2, err := NewServer(p)
+		if err != nil {
+			t.Fatalf("NewServer(%s): %v", p, err)
+		}
+		if s2.BuildID() != s1.BuildID() || s2.NumItems() != s1.NumItems() {
+			t.Errorf("NewServer(%s): build ID %s and %d items, want %s and %d", p, s2.BuildID(), s2.NumItems(), s1.BuildID(), s1.NumItems())
+		}
+		for _, itemIndex := range []int{0, s1.NumItems() / 2, s1.NumItems() - 1} {
+			want, err := s1.GetItem(itemIndex)
+			if err != nil {
+				t.Fatalf("GetItem: %v", err)
+			}
+			got, err := s2.GetItem(itemIndex)
+			if err != nil {
+				t.Fatalf("GetItem: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("GetItem(%d) differs in combined layout", itemIndex)
+			}
+		}
+		if err := s2.Close(); err != nil {
+			t.Errorf("s2.Close: %v", err)
+		}
+	}
+	if _, err := NewServerFromCombined([]byte("not an index")); err != ErrNotCombined {
+		t.Errorf("NewServerFromCombined(garbage): want ErrNotCombined, got %v", err)
+	}
+}
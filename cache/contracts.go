@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// contractStatsSize is the size of a record of contractStats file:
+// Contracts, Revisions (4 bytes each), FileSize, RevisedFileSize
+// (8 bytes each), Payout, HostOutputs (amountSize bytes each).
+const contractStatsSize = 4 + 4 + 8 + 8 + 2*amountSize
+
+// amountSize is the size of big-endian currency in contractStats.
+const amountSize = 16
+
+// ContractStats aggregates file contracts of blocks.
+type ContractStats struct {
+	// Contracts is the number of new file contracts.
+	Contracts int
+	// Revisions is the number of file contract revisions.
+	Revisions int
+	// FileSize is the sum of file sizes of new contracts, bytes.
+	FileSize uint64
+	// RevisedFileSize is the sum of file sizes set by revisions, bytes.
+	RevisedFileSize uint64
+	// Payout is the sum of payouts of new contracts (including siafund fee).
+	Payout types.Currency
+	// HostOutputs is the sum of valid proof outputs of hosts of new
+	// contracts: the collateral of the host plus the contract price.
+	// Sia does not record the collateral separately.
+	HostOutputs types.Currency
+}
+
+// Add returns the sum of two stats.
+func (c ContractStats) Add(other ContractStats) ContractStats {
+	return ContractStats{
+		Contracts:       c.Contracts + other.Contracts,
+		Revisions:       c.Revisions + other.Revisions,
+		FileSize:        c.FileSize + other.FileSize,
+		RevisedFileSize: c.RevisedFileSize + other.RevisedFileSize,
+		Payout:          c.Payout.Add(other.Payout),
+		HostOutputs:     c.HostOutputs.Add(other.HostOutputs),
+	}
+}
+
+// blockContractStats computes ContractStats of the block.
+func blockContractStats(block *types.Block) ContractStats {
+	stats := ContractStats{
+		Payout:      types.NewCurrency64(0),
+		HostOutputs: types.NewCurrency64(0),
+	}
+	for _, tx := range block.Transactions {
+		for _, fc := range tx.FileContracts {
+			stats.Contracts++
+			stats.FileSize += fc.FileSize
+			stats.Payout = stats.Payout.Add(fc.Payout)
+			// Outputs of renter-host contracts are renter, host.
+			if len(fc.ValidProofOutputs) >= 2 {
+				stats.HostOutputs = stats.HostOutputs.Add(fc.ValidProofOutputs[1].Value)
+			}
+		}
+		for _, rev := range tx.FileContractRevisions {
+			stats.Revisions++
+			stats.RevisedFileSize += rev.NewFileSize
+		}
+	}
+	return stats
+}
+
+func putAmount(buf []byte, c types.Currency) error {
+	b := c.Big().Bytes()
+	if len(b) > amountSize {
+		return fmt.Errorf("too large amount: %s", c)
+	}
+	copy(buf[amountSize-len(b):], b)
+	return nil
+}
+
+func (s *Builder) writeContractStats(block *types.Block) error {
+	stats := blockContractStats(block)
+	var record [contractStatsSize]byte
+	binary.BigEndian.PutUint32(record[0:4], uint32(stats.Contracts))
+	binary.BigEndian.PutUint32(record[4:8], uint32(stats.Revisions))
+	binary.BigEndian.PutUint64(record[8:16], stats.FileSize)
+	binary.BigEndian.PutUint64(record[16:24], stats.RevisedFileSize)
+	if err := putAmount(record[24:24+amountSize], stats.Payout); err != nil {
+		return err
+	}
+	if err := putAmount(record[24+amountSize:], stats.HostOutputs); err != nil {
+		return err
+	}
+	if n, err := s.contractStats.Write(record[:]); err != nil {
+		return err
+	} else if n != contractStatsSize {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// GetContractStats returns ContractStats of the block with given index.
+func (s *Server) GetContractStats(blockIndex int) (ContractStats, error) {
+	if blockIndex < 0 || blockIndex >= s.nblocks {
+		return ContractStats{}, ErrTooLargeBlockIndex
+	}
+	record := s.ContractStats[blockIndex*contractStatsSize : (blockIndex+1)*contractStatsSize]
+	return ContractStats{
+		Contracts:       int(binary.BigEndian.Uint32(record[0:4])),
+		Revisions:       int(binary.BigEndian.Uint32(record[4:8])),
+		FileSize:        binary.BigEndian.Uint64(record[8:16]),
+		RevisedFileSize: binary.BigEndian.Uint64(record[16:24]),
+		Payout:          types.NewCurrency(new(big.Int).SetBytes(record[24 : 24+amountSize])),
+		HostOutputs:     types.NewCurrency(new(big.Int).SetBytes(record[24+amountSize:])),
+	}, nil
+}
+
+// SumContractStats returns the sum of ContractStats of blocks [start, end).
+func (s *Server) SumContractStats(start, end int) (ContractStats, error) {
+	sum := ContractStats{
+		Payout:      types.NewCurrency64(0),
+		HostOutputs: types.NewCurrency64(0),
+	}
+	for i := start; i < end; i++ {
+		stats, err := s.GetContractStats(i)
+		if err != nil {
+			return ContractStats{}, err
+		}
+		sum = sum.Add(stats)
+	}
+	return sum, nil
+}
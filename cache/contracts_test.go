@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestContractStats(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	want := ContractStats{
+		Payout:      types.NewCurrency64(0),
+		HostOutputs: types.NewCurrency64(0),
+	}
+	for _, block := range blocks {
+		want = want.Add(blockContractStats(block))
+	}
+	got, err := s.SumContractStats(0, s.NumBlocks())
+	if err != nil {
+		t.Fatalf("SumContractStats: %v", err)
+	}
+	if got.Contracts != want.Contracts || got.Revisions != want.Revisions || got.FileSize != want.FileSize || got.RevisedFileSize != want.RevisedFileSize || got.Payout.Cmp(want.Payout) != 0 || got.HostOutputs.Cmp(want.HostOutputs) != 0 {
+		t.Errorf("SumContractStats = %+v, want %+v", got, want)
+	}
+	if _, err := s.GetContractStats(s.NumBlocks()); err != ErrTooLargeBlockIndex {
+		t.Errorf("GetContractStats(NumBlocks()): want ErrTooLargeBlockIndex, got %v", err)
+	}
+}
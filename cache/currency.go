@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Amounts are never converted to floating point numbers. Hastings are
+// formatted as a decimal integer and SC as an exact decimal fraction.
+
+// siacoinDigits is the number of decimal digits of hastings in 1 SC.
+const siacoinDigits = 24
+
+var ErrBadAmount = fmt.Errorf("Bad amount")
+
+// Amount is JSON representation of types.Currency.
+type Amount struct {
+	Hastings string `json:"hastings"`
+	SC       string `json:"sc,omitempty"`
+}
+
+// NewAmount returns Amount of c. SC is filled if withSC is true.
+func NewAmount(c types.Currency, withSC bool) Amount {
+	a := Amount{Hastings: FormatHastings(c)}
+	if withSC {
+		a.SC = FormatSC(c)
+	}
+	return a
+}
+
+// FormatHastings returns c as decimal number of hastings.
+func FormatHastings(c types.Currency) string {
+	return c.Big().String()
+}
+
+// FormatSC returns c as exact decimal number of SC, e.g. "1.5 SC".
+func FormatSC(c types.Currency) string {
+	digits := c.Big().String()
+	if len(digits) <= siacoinDigits {
+		digits = strings.Repeat("0", siacoinDigits-len(digits)+1) + digits
+	}
+	intPart := digits[:len(digits)-siacoinDigits]
+	fracPart := strings.TrimRight(digits[len(digits)-siacoinDigits:], "0")
+	if fracPart == "" {
+		return intPart + " SC"
+	}
+	return intPart + "." + fracPart + " SC"
+}
+
+// ParseHastings parses decimal number of hastings.
+func ParseHastings(s string) (types.Currency, error) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return types.Currency{}, ErrBadAmount
+	}
+	b, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return types.Currency{}, ErrBadAmount
+	}
+	return types.NewCurrency(b), nil
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestFormatSC(t *testing.T) {
+	cases := []struct {
+		hastings, sc string
+	}{
+		{"0", "0 SC"},
+		{"1", "0.000000000000000000000001 SC"},
+		{"1000000000000000000000000", "1 SC"},
+		{"1500000000000000000000000", "1.5 SC"},
+		{"123456789000000000000000000000", "123456.789 SC"},
+	}
+	for _, c := range cases {
+		amount, err := ParseHastings(c.hastings)
+		if err != nil {
+			t.Errorf("ParseHastings(%s): %v", c.hastings, err)
+			continue
+		}
+		if got := FormatHastings(amount); got != c.hastings {
+			t.Errorf("FormatHastings(ParseHastings(%s)) = %s", c.hastings, got)
+		}
+		if got := FormatSC(amount); got != c.sc {
+			t.Errorf("FormatSC(%s) = %s, want %s", c.hastings, got, c.sc)
+		}
+	}
+	for _, bad := range []string{"", "-1", "1.5", "0x10", " 1"} {
+		if _, err := ParseHastings(bad); err != ErrBadAmount {
+			t.Errorf("ParseHastings(%q): want ErrBadAmount, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TxNode is an item of TxGraph.
+type TxNode struct {
+	Item  int // Index of the item.
+	ID    string
+	Block int
+
+	// TxID is the ID of the transaction. It is zero for miner payouts.
+	TxID types.TransactionID
+
+	// Parents are indices in TxGraph.Nodes of the items creating
+	// the outputs spent by the transaction.
+	Parents []int
+}
+
+// TxGraph is the graph of ancestors of a transaction (the DAG of
+// transactions connected by spent outputs) as adjacency lists.
+// Nodes[0] is the transaction itself.
+type TxGraph struct {
+	Nodes []TxNode
+
+	// Truncated is true if some ancestors were not included
+	// because of maxNodes.
+	Truncated bool
+}
+
+// TransactionAncestors returns the graph of ancestors of the item,
+// which are found by resolving inputs (see ResolveInputs). Only items
+// of blocks with index >= minBlock and at most maxNodes items are
+// included.
+func (s *Server) TransactionAncestors(itemIndex, minBlock, maxNodes int) (*TxGraph, error) {
+	g := &TxGraph{
+		Nodes: []TxNode{{Item: itemIndex}},
+	}
+	nodeOf := map[int]int{itemIndex: 0}
+	for i := 0; i < len(g.Nodes); i++ {
+		node := &g.Nodes[i]
+		item, err := s.GetItemWithoutProof(node.Item)
+		if err != nil {
+			return nil, err
+		}
+		node.ID = item.ID
+		node.Block = item.Block
+		_, tx, err := DecodeItem(item)
+		if err != nil {
+			return nil, err
+		}
+		if tx == nil {
+			continue
+		}
+		node.TxID = tx.ID()
+		inputs, err := s.ResolveInputs(tx)
+		if err != nil {
+			return nil, err
+		}
+		var parents []int
+		for _, in := range inputs {
+			if in.Output == nil || in.Block < minBlock {
+				continue
+			}
+			parent, has := nodeOf[in.Item]
+			if !has {
+				if len(g.Nodes) >= maxNodes {
+					g.Truncated = true
+					continue
+				}
+				parent = len(g.Nodes)
+				nodeOf[in.Item] = parent
+				g.Nodes = append(g.Nodes, TxNode{Item: in.Item})
+				// node may point to the old array.
+				node = &g.Nodes[i]
+			}
+			if !containsInt(parents, parent) {
+				parents = append(parents, parent)
+			}
+		}
+		node.Parents = parents
+	}
+	return g, nil
+}
+
+func containsInt(list []int, x int) bool {
+	for _, y := range list {
+		if y == x {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestTransactionAncestors(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	_, _, nitems, err := s.GetBlockItems(s.NumBlocks() - 1)
+	if err != nil {
+		t.Fatalf("GetBlockItems: %v", err)
+	}
+	ngraphs := 0
+	for itemIndex := nitems - 1; itemIndex >= 0 && ngraphs < 10; itemIndex-- {
+		g, err := s.TransactionAncestors(itemIndex, 0, 20)
+		if err != nil {
+			t.Fatalf("TransactionAncestors(%d): %v", itemIndex, err)
+		}
+		if g.Nodes[0].Item != itemIndex {
+			t.Errorf("TransactionAncestors(%d): root is %d", itemIndex, g.Nodes[0].Item)
+		}
+		if len(g.Nodes) == 1 {
+			continue
+		}
+		ngraphs++
+		for _, node := range g.Nodes {
+			for _, parent := range node.Parents {
+				if g.Nodes[parent].Block > node.Block {
+					t.Errorf("item %s of block %d has parent %s of block %d", node.ID, node.Block, g.Nodes[parent].ID, g.Nodes[parent].Block)
+				}
+			}
+		}
+		if g1, err := s.TransactionAncestors(itemIndex, 0, 1); err != nil || !g1.Truncated || len(g1.Nodes) != 1 {
+			t.Errorf("TransactionAncestors(%d, maxNodes=1) is not truncated", itemIndex)
+		}
+		if g1, err := s.TransactionAncestors(itemIndex, s.NumBlocks(), 20); err != nil || len(g1.Nodes) != 1 {
+			t.Errorf("TransactionAncestors(%d, minBlock=NumBlocks) has ancestors", itemIndex)
+		}
+	}
+	if ngraphs == 0 {
+		t.Errorf("no transaction has ancestors")
+	}
+}
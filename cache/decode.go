@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/golang/snappy"
+)
+
+// DecodeItem decodes the payload of the item. Exactly one of payout and tx
+// is not nil on success.
+func DecodeItem(item Item) (payout *types.SiacoinOutput, tx *types.Transaction, err error) {
+	switch item.Compression {
+	case NO_COMPRESSION:
+		payout = new(types.SiacoinOutput)
+		if err := encoding.Unmarshal(item.Data, payout); err != nil {
+			return nil, nil, fmt.Errorf("decoding miner payout: %v", err)
+		}
+		return payout, nil, nil
+	case SNAPPY:
+		data, err := snappy.Decode(nil, item.Data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("snappy.Decode: %v", err)
+		}
+		tx = new(types.Transaction)
+		if err := encoding.Unmarshal(data, tx); err != nil {
+			return nil, nil, fmt.Errorf("decoding transaction: %v", err)
+		}
+		return nil, tx, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown compression: %d", item.Compression)
+	}
+}
+
+// MinerPayoutID returns the ID of i-th miner payout of the block.
+// It is the same as types.Block.MinerPayoutID, but does not require
+// the whole block.
+func MinerPayoutID(blockID types.BlockID, i int) types.SiacoinOutputID {
+	return types.SiacoinOutputID(crypto.HashAll(blockID, uint64(i)))
+}
+
+// Natures of outputs.
+const (
+	NATURE_MINER_PAYOUT                    = "miner_payout"
+	NATURE_SIACOIN_OUTPUT                  = "siacoin_output"
+	NATURE_SIAFUND_OUTPUT                  = "siafund_output"
+	NATURE_VALID_PROOF_OUTPUT              = "valid_proof_output"
+	NATURE_MISSED_PROOF_OUTPUT             = "missed_proof_output"
+	NATURE_VALID_PROOF_OUTPUT_IN_REVISION  = "valid_proof_output_in_revision"
+	NATURE_MISSED_PROOF_OUTPUT_IN_REVISION = "missed_proof_output_in_revision"
+)
+
+// Output is an output created by an item.
+type Output struct {
+	ID         crypto.Hash
+	Nature     string
+	Index      int // Index of output in its slice.
+	Index0     int // Index of FileContract or FileContractRevision.
+	UnlockHash types.UnlockHash
+	Value      types.Currency
+}
+
+// Input is an input spent by a transaction.
+type Input struct {
+	ParentID   crypto.Hash
+	Siafund    bool
+	Index      int // Index of input in its slice.
+	UnlockHash types.UnlockHash
+
+	// Multisig is the structure of multi-signature unlock conditions
+	// or nil for single-signature ones.
+	Multisig *Multisig
+}
+
+// TransactionOutputs lists outputs of the transaction in the same order
+// as they are added to the address index by Builder.
+func TransactionOutputs(tx *types.Transaction) []Output {
+	var outputs []Output
+	for i, so := range tx.SiacoinOutputs {
+		outputs = append(outputs, Output{
+			ID:         crypto.Hash(tx.SiacoinOutputID(uint64(i))),
+			Nature:     NATURE_SIACOIN_OUTPUT,
+			Index:      i,
+			UnlockHash: so.UnlockHash,
+			Value:      so.Value,
+		})
+	}
+	for i, so := range tx.SiafundOutputs {
+		outputs = append(outputs, Output{
+			ID:         crypto.Hash(tx.SiafundOutputID(uint64(i))),
+			Nature:     NATURE_SIAFUND_OUTPUT,
+			Index:      i,
+			UnlockHash: so.UnlockHash,
+			Value:      so.Value,
+		})
+	}
+	for i0, contract := range tx.FileContracts {
+		fcid := tx.FileContractID(uint64(i0))
+		for i, so := range contract.ValidProofOutputs {
+			outputs = append(outputs, Output{
+				ID:         crypto.Hash(fcid.StorageProofOutputID(types.ProofValid, uint64(i))),
+				Nature:     NATURE_VALID_PROOF_OUTPUT,
+				Index:      i,
+				Index0:     i0,
+				UnlockHash: so.UnlockHash,
+				Value:      so.Value,
+			})
+		}
+		for i, so := range contract.MissedProofOutputs {
+			outputs = append(outputs, Output{
+				ID:         crypto.Hash(fcid.StorageProofOutputID(types.ProofMissed, uint64(i))),
+				Nature:     NATURE_MISSED_PROOF_OUTPUT,
+				Index:      i,
+				Index0:     i0,
+				UnlockHash: so.UnlockHash,
+				Value:      so.Value,
+			})
+		}
+	}
+	for i0, rev := range tx.FileContractRevisions {
+		for i, so := range rev.NewValidProofOutputs {
+			outputs = append(outputs, Output{
+				ID:         crypto.Hash(rev.ParentID.StorageProofOutputID(types.ProofValid, uint64(i))),
+				Nature:     NATURE_VALID_PROOF_OUTPUT_IN_REVISION,
+				Index:      i,
+				Index0:     i0,
+				UnlockHash: so.UnlockHash,
+				Value:      so.Value,
+			})
+		}
+		for i, so := range rev.NewMissedProofOutputs {
+			outputs = append(outputs, Output{
+				ID:         crypto.Hash(rev.ParentID.StorageProofOutputID(types.ProofMissed, uint64(i))),
+				Nature:     NATURE_MISSED_PROOF_OUTPUT_IN_REVISION,
+				Index:      i,
+				Index0:     i0,
+				UnlockHash: so.UnlockHash,
+				Value:      so.Value,
+			})
+		}
+	}
+	return outputs
+}
+
+// TransactionInputs lists inputs of the transaction.
+func TransactionInputs(tx *types.Transaction) []Input {
+	var inputs []Input
+	for i, si := range tx.SiacoinInputs {
+		inputs = append(inputs, Input{
+			ParentID:   crypto.Hash(si.ParentID),
+			Index:      i,
+			UnlockHash: si.UnlockConditions.UnlockHash(),
+			Multisig:   MultisigOf(&tx.SiacoinInputs[i].UnlockConditions),
+		})
+	}
+	for i, si := range tx.SiafundInputs {
+		inputs = append(inputs, Input{
+			ParentID:   crypto.Hash(si.ParentID),
+			Siafund:    true,
+			Index:      i,
+			UnlockHash: si.UnlockConditions.UnlockHash(),
+			Multisig:   MultisigOf(&tx.SiafundInputs[i].UnlockConditions),
+		})
+	}
+	return inputs
+}
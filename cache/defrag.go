@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+)
+
+// Values of a key of the address index are stored as one list, which
+// GetHistoryPage decodes and searches for the cursor on every page, so
+// pages of hot addresses (exchanges, pools) with millions of items are
+// slow. Defrag is an offline pass copying the lists of hot address
+// prefixes, decoded and sorted, to HOT_ADDRESSES_FILE, optionally split
+// into buckets of BucketBlocks blocks. Pages of these prefixes are read
+// from there: the cursor is found by binary search and only the items
+// of the page are decoded. The file is ignored if the index is rebuilt
+// (see BuildID), so Defrag must be run again after each build.
+
+// HOT_ADDRESSES_FILE is the name of the file written by Defrag in the
+// directory of the index.
+const HOT_ADDRESSES_FILE = "hotAddresses"
+
+// DEFAULT_HOT_ADDRESS_ITEMS is the default DefragOptions.MinItems.
+const DEFAULT_HOT_ADDRESS_ITEMS = 1000
+
+// DefragOptions configures Defrag.
+type DefragOptions struct {
+	// MinItems is the min number of items of an address prefix to be
+	// copied.
+	MinItems int
+
+	// BucketBlocks is the number of blocks per bucket or 0 to keep all
+	// items of the prefix in one bucket.
+	BucketBlocks int
+}
+
+// DefragReport describes the output of Defrag.
+type DefragReport struct {
+	Prefixes int
+	Items    int
+	Buckets  int
+	Bytes    int
+	Duration time.Duration
+}
+
+// hotBucket has items of consecutive blocks of a hot prefix.
+type hotBucket struct {
+	// FirstBlock is the index of the first block of the bucket.
+	FirstBlock int
+	// Items are sorted item indices, offsetIndexLen bytes each.
+	Items []byte
+}
+
+type hotPrefix struct {
+	Prefix  []byte
+	Total   int
+	Buckets []hotBucket
+}
+
+// hotAddresses is the contents of HOT_ADDRESSES_FILE (Sia encoding).
+type hotAddresses struct {
+	BuildID      string
+	BucketBlocks int
+	Prefixes     []hotPrefix
+}
+
+// hotCandidates returns the address prefixes checked by Defrag: all
+// keys of the index if it has the address tree, otherwise the top
+// addresses of build_report.json.
+func (s *Server) hotCandidates() ([][]byte, error) {
+	var prefixes [][]byte
+	if s.par.AddressTree {
+		for i := 0; i < s.numAddressKeys(); i++ {
+			prefixes = append(prefixes, s.addressKey(i))
+		}
+		return prefixes, nil
+	}
+	if s.topAddresses == nil {
+		return nil, ErrNoTopAddresses
+	}
+	for _, count := range s.topAddresses {
+		prefix, err := hex.DecodeString(count.Prefix)
+		if err != nil || len(prefix) != s.addressPrefixLen {
+			return nil, fmt.Errorf("bad prefix in build_report.json: %q", count.Prefix)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// Defrag returns the contents of HOT_ADDRESSES_FILE with the address
+// prefixes having at least opts.MinItems items. The index must have
+// the address tree or build_report.json with TopAddresses, otherwise
+// it returns ErrNoTopAddresses.
+func (s *Server) Defrag(opts DefragOptions) ([]byte, DefragReport, error) {
+	started := time.Now()
+	if opts.MinItems <= 0 {
+		opts.MinItems = DEFAULT_HOT_ADDRESS_ITEMS
+	}
+	candidates, err := s.hotCandidates()
+	if err != nil {
+		return nil, DefragReport{}, err
+	}
+	hot := hotAddresses{
+		BuildID:      s.buildID,
+		BucketBlocks: opts.BucketBlocks,
+	}
+	var report DefragReport
+	var tmp [8]byte
+	for _, prefix := range candidates {
+		itemIndices, err := s.addressItems(prefix)
+		if err != nil {
+			return nil, DefragReport{}, fmt.Errorf("prefix %x: %v", prefix, err)
+		}
+		if len(itemIndices) < opts.MinItems {
+			continue
+		}
+		hp := hotPrefix{
+			Prefix: append([]byte{}, prefix...),
+			Total:  len(itemIndices),
+		}
+		for _, itemIndex := range itemIndices {
+			blockIndex := s.blockOfItem(itemIndex)
+			if opts.BucketBlocks > 0 {
+				blockIndex -= blockIndex % opts.BucketBlocks
+			} else {
+				blockIndex = 0
+			}
+			if len(hp.Buckets) == 0 || hp.Buckets[len(hp.Buckets)-1].FirstBlock != blockIndex {
+				hp.Buckets = append(hp.Buckets, hotBucket{FirstBlock: blockIndex})
+			}
+			b := &hp.Buckets[len(hp.Buckets)-1]
+			binary.LittleEndian.PutUint64(tmp[:], uint64(itemIndex))
+			b.Items = append(b.Items, tmp[:s.offsetIndexLen]...)
+		}
+		hot.Prefixes = append(hot.Prefixes, hp)
+		report.Prefixes++
+		report.Items += hp.Total
+		report.Buckets += len(hp.Buckets)
+	}
+	data := encoding.Marshal(hot)
+	report.Bytes = len(data)
+	report.Duration = time.Since(started)
+	return data, report, nil
+}
+
+// WriteHotAddresses writes the output of Defrag to HOT_ADDRESSES_FILE
+// in the directory of the index. Servers opened after that use it.
+func WriteHotAddresses(dir string, data []byte) error {
+	file := path.Join(dir, HOT_ADDRESSES_FILE)
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// readHotAddresses returns the hot prefixes of HOT_ADDRESSES_FILE by
+// prefix or nil if the file is broken or written for another index.
+func (s *Server) readHotAddresses(data []byte) map[string]*hotPrefix {
+	var hot hotAddresses
+	if err := encoding.Unmarshal(data, &hot); err != nil || hot.BuildID != s.buildID {
+		return nil
+	}
+	prefixes := make(map[string]*hotPrefix, len(hot.Prefixes))
+	for i := range hot.Prefixes {
+		hp := &hot.Prefixes[i]
+		if len(hp.Prefix) != s.addressPrefixLen {
+			return nil
+		}
+		for _, b := range hp.Buckets {
+			if len(b.Items) == 0 || len(b.Items)%s.offsetIndexLen != 0 {
+				return nil
+			}
+		}
+		prefixes[string(hp.Prefix)] = hp
+	}
+	return prefixes
+}
+
+// hotItem returns i-th item index of the bucket.
+func (s *Server) hotItem(b *hotBucket, i int) int {
+	var tmp [8]byte
+	copy(tmp[:], b.Items[i*s.offsetIndexLen:(i+1)*s.offsetIndexLen])
+	return int(binary.LittleEndian.Uint64(tmp[:]))
+}
+
+// hotWindow returns up to n item indices of the hot prefix starting
+// from the cursor start.
+func (s *Server) hotWindow(hp *hotPrefix, start string, n int) ([]int, error) {
+	bucket, pos := 0, 0
+	if start != "" {
+		id, err := ParseItemID(start)
+		if err != nil {
+			return nil, ErrBadCursor
+		}
+		itemIndex, err := s.ItemIndex(id)
+		if err != nil {
+			return nil, ErrBadCursor
+		}
+		bucket = sort.Search(len(hp.Buckets), func(i int) bool {
+			b := &hp.Buckets[i]
+			return s.hotItem(b, len(b.Items)/s.offsetIndexLen-1) >= itemIndex
+		})
+		if bucket < len(hp.Buckets) {
+			b := &hp.Buckets[bucket]
+			pos = sort.Search(len(b.Items)/s.offsetIndexLen, func(i int) bool {
+				return s.hotItem(b, i) >= itemIndex
+			})
+		}
+	}
+	var window []int
+	for ; bucket < len(hp.Buckets) && len(window) < n; bucket++ {
+		b := &hp.Buckets[bucket]
+		for ; pos < len(b.Items)/s.offsetIndexLen && len(window) < n; pos++ {
+			window = append(window, s.hotItem(b, pos))
+		}
+		pos = 0
+	}
+	return window, nil
+}
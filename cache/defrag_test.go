@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+)
+
+func TestDefrag(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	b, s := buildTestIndex(t, "", testParameters(), blocks)
+	files := b.MemoryFiles()
+	data, report, err := s.Defrag(DefragOptions{MinItems: 10, BucketBlocks: 100})
+	if err != nil {
+		t.Fatalf("Defrag: %v", err)
+	}
+	if report.Prefixes == 0 || report.Buckets < report.Prefixes {
+		t.Fatalf("Defrag report: %+v", report)
+	}
+	files[HOT_ADDRESSES_FILE] = data
+	defragged, err := NewServerFromBytes(files)
+	if err != nil {
+		t.Fatalf("NewServerFromBytes: %v", err)
+	}
+	if len(defragged.hotPrefixes) != report.Prefixes {
+		t.Fatalf("got %d hot prefixes, want %d", len(defragged.hotPrefixes), report.Prefixes)
+	}
+	top, err := s.TopAddresses(3)
+	if err != nil {
+		t.Fatalf("TopAddresses: %v", err)
+	}
+	for _, a := range top {
+		start := ""
+		for {
+			want, err := s.GetHistoryPage(a.Address[:], start, 7)
+			if err != nil {
+				t.Fatalf("GetHistoryPage: %v", err)
+			}
+			got, err := defragged.GetHistoryPage(a.Address[:], start, 7)
+			if err != nil {
+				t.Fatalf("GetHistoryPage of defragged index: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("address %s, cursor %q: pages differ", FormatAddress(a.Address), start)
+			}
+			if want.Next == "" {
+				break
+			}
+			start = want.Next
+		}
+	}
+	// The file of another index is ignored.
+	files[HOT_ADDRESSES_FILE] = encoding.Marshal(hotAddresses{BuildID: "other"})
+	other, err := NewServerFromBytes(files)
+	if err != nil {
+		t.Fatalf("NewServerFromBytes: %v", err)
+	}
+	if other.hotPrefixes != nil {
+		t.Errorf("hot prefixes of another index are used")
+	}
+}
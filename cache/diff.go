@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// MAX_DIFF_ADDRESSES is the max number of addresses listed in
+// IndexDiff.DifferentAddresses.
+const MAX_DIFF_ADDRESSES = 100
+
+// errEnoughAddresses stops the walk of blocks in DiffIndices.
+var errEnoughAddresses = fmt.Errorf("Enough addresses")
+
+// IndexDiff describes differences of two indices, e.g. to check that
+// builds are deterministic or to debug inconsistent mirrors. Fields of
+// two values refer to the first and the second index.
+type IndexDiff struct {
+	SameParameters bool
+	StartHeights   [2]int
+	Blocks         [2]int
+	Items          [2]int
+
+	// FirstDifferentBlock is the height of the first block present in
+	// both indices with different IDs or -1 if all such blocks are equal.
+	FirstDifferentBlock int
+
+	// CommonBlocks is the number of equal blocks present in both indices
+	// before FirstDifferentBlock. CommonItems is the number of items of
+	// these blocks in each index; they differ only if the builders split
+	// blocks into items differently.
+	CommonBlocks int
+	CommonItems  [2]int
+
+	// DifferentFiles lists files which differ. Indices with equal
+	// parameters and equal blocks must have equal files.
+	DifferentFiles []string
+
+	// CheckedAddresses is the number of addresses of common blocks
+	// whose histories in common blocks were compared.
+	CheckedAddresses int
+
+	// DifferentAddresses lists addresses whose histories in common
+	// blocks differ, up to MAX_DIFF_ADDRESSES.
+	DifferentAddresses []string
+}
+
+// Equal returns if no differences were found.
+func (d *IndexDiff) Equal() bool {
+	return d.SameParameters && d.StartHeights[0] == d.StartHeights[1] && d.Blocks[0] == d.Blocks[1] && d.Items[0] == d.Items[1] && d.FirstDifferentBlock == -1 && len(d.DifferentFiles) == 0 && len(d.DifferentAddresses) == 0
+}
+
+// DiffIndices compares two indices. Histories are compared for up to
+// maxAddresses addresses of common blocks, in the order of appearance.
+func DiffIndices(a, b *Server, maxAddresses int) (*IndexDiff, error) {
+	servers := [2]*Server{a, b}
+	d := &IndexDiff{
+		SameParameters:      reflect.DeepEqual(a.par, b.par),
+		FirstDifferentBlock: -1,
+	}
+	var ids [2][]types.BlockID
+	for i, s := range servers {
+		d.StartHeights[i] = s.StartHeight()
+		d.Blocks[i] = s.NumBlocks()
+		d.Items[i] = s.NumItems()
+		var err error
+		if ids[i], err = s.blockIDs(); err != nil {
+			return nil, err
+		}
+	}
+	// Heights present in both indices.
+	start := a.StartHeight()
+	if b.StartHeight() > start {
+		start = b.StartHeight()
+	}
+	end := a.StartHeight() + a.NumBlocks()
+	if bEnd := b.StartHeight() + b.NumBlocks(); bEnd < end {
+		end = bEnd
+	}
+	for height := start; height < end; height++ {
+		if ids[0][height-a.StartHeight()] != ids[1][height-b.StartHeight()] {
+			d.FirstDifferentBlock = height
+			break
+		}
+		d.CommonBlocks++
+	}
+	if d.CommonBlocks != 0 {
+		for i, s := range servers {
+			first := start - s.StartHeight()
+			payoutsStart, _, _, err := s.GetBlockItems(first)
+			if err != nil {
+				return nil, err
+			}
+			_, _, itemsEnd, err := s.GetBlockItems(first + d.CommonBlocks - 1)
+			if err != nil {
+				return nil, err
+			}
+			d.CommonItems[i] = itemsEnd - payoutsStart
+		}
+	}
+	d.DifferentFiles = diffFiles(a, b)
+	if d.CommonBlocks == 0 || maxAddresses == 0 {
+		return d, nil
+	}
+	commonEnd := start + d.CommonBlocks
+	checked := make(map[types.UnlockHash]bool)
+	check := func(uh types.UnlockHash) error {
+		if checked[uh] {
+			return nil
+		}
+		if len(checked) == maxAddresses {
+			return errEnoughAddresses
+		}
+		checked[uh] = true
+		var histories [2][]string
+		for i, s := range servers {
+			var err error
+			if histories[i], err = commonHistory(s, uh, start, commonEnd); err != nil {
+				return err
+			}
+		}
+		if !reflect.DeepEqual(histories[0], histories[1]) && len(d.DifferentAddresses) < MAX_DIFF_ADDRESSES {
+			d.DifferentAddresses = append(d.DifferentAddresses, FormatAddress(uh))
+		}
+		return nil
+	}
+	first := start - a.StartHeight()
+	err := a.ForEachBlock(first, first+d.CommonBlocks, func(block *DecodedBlock) error {
+		for _, mp := range block.MinerPayouts {
+			if err := check(mp.UnlockHash); err != nil {
+				return err
+			}
+		}
+		for i := range block.Transactions {
+			if err := forEachAddress(&block.Transactions[i], check); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errEnoughAddresses {
+		return nil, err
+	}
+	d.CheckedAddresses = len(checked)
+	return d, nil
+}
+
+// commonHistory returns IDs of items of the history of the address
+// in blocks with heights [start, end).
+func commonHistory(s *Server, uh types.UnlockHash, start, end int) ([]string, error) {
+	var ids []string
+	cursor := ""
+	for {
+		page, err := s.GetHistoryPage(uh[:], cursor, MAX_HISTORY_SIZE)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			height := s.StartHeight() + item.Block
+			if height >= start && height < end {
+				ids = append(ids, item.ID)
+			}
+		}
+		if page.Next == "" {
+			return ids, nil
+		}
+		cursor = page.Next
+	}
+}
+
+// diffFiles returns names of files which differ in the indices.
+func diffFiles(a, b *Server) []string {
+	var names []string
+	va := reflect.ValueOf(a).Elem()
+	vb := reflect.ValueOf(b).Elem()
+	st := va.Type()
+	for i := 0; i < st.NumField(); i++ {
+		ft := st.Field(i)
+		if ft.Type != reflect.TypeOf([]byte{}) {
+			continue
+		}
+		if !bytes.Equal(va.Field(i).Bytes(), vb.Field(i).Bytes()) {
+			names = append(names, strings.ToLower(ft.Name[:1])+ft.Name[1:])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestDiffIndices(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	build := func(blocks []*types.Block) *Server {
+		return buildTestServer(t, testParameters(), blocks)
+	}
+	full := build(blocks)
+	fullAgain := build(blocks)
+	d, err := DiffIndices(full, fullAgain, 50)
+	if err != nil {
+		t.Fatalf("DiffIndices: %v", err)
+	}
+	if !d.Equal() {
+		t.Errorf("DiffIndices of equal builds: %#v", d)
+	}
+	if d.CommonBlocks != len(blocks) || d.CheckedAddresses != 50 {
+		t.Errorf("DiffIndices of equal builds: CommonBlocks=%d, CheckedAddresses=%d", d.CommonBlocks, d.CheckedAddresses)
+	}
+	const nshort = 500
+	short := build(blocks[:nshort])
+	d, err = DiffIndices(full, short, 50)
+	if err != nil {
+		t.Fatalf("DiffIndices: %v", err)
+	}
+	if d.Equal() || d.FirstDifferentBlock != -1 || d.CommonBlocks != nshort {
+		t.Errorf("DiffIndices of prefix: FirstDifferentBlock=%d, CommonBlocks=%d", d.FirstDifferentBlock, d.CommonBlocks)
+	}
+	if d.CommonItems[0] != d.CommonItems[1] || d.CommonItems[1] != short.NumItems() {
+		t.Errorf("DiffIndices of prefix: CommonItems=%v, want %d", d.CommonItems, short.NumItems())
+	}
+	if len(d.DifferentAddresses) != 0 {
+		t.Errorf("DiffIndices of prefix: DifferentAddresses=%v", d.DifferentAddresses)
+	}
+	fork := *blocks[nshort]
+	fork.Nonce[0]++
+	forked := build(append(blocks[:nshort:nshort], &fork))
+	d, err = DiffIndices(full, forked, 50)
+	if err != nil {
+		t.Fatalf("DiffIndices: %v", err)
+	}
+	if d.FirstDifferentBlock != nshort || d.CommonBlocks != nshort || len(d.DifferentFiles) == 0 {
+		t.Errorf("DiffIndices of fork: FirstDifferentBlock=%d, CommonBlocks=%d, DifferentFiles=%v", d.FirstDifferentBlock, d.CommonBlocks, d.DifferentFiles)
+	}
+}
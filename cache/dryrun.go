@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrDiscarded = fmt.Errorf("The file is discarded by dry run")
+
+// discardedFile counts bytes written to it.
+type discardedFile struct {
+	size int64
+}
+
+func (f *discardedFile) Write(p []byte) (int, error) {
+	f.size += int64(len(p))
+	return len(p), nil
+}
+
+func (f *discardedFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, ErrDiscarded
+}
+
+func (f *discardedFile) Close() error {
+	return nil
+}
+
+// dryRunFS discards files of the index, only counting their sizes.
+// Temporary files of external sorting and the address tree are read
+// back by Builder, so they are kept in the directory.
+type dryRunFS struct {
+	osFS
+	discarded map[string]*discardedFile
+}
+
+func keptInDryRun(name string) bool {
+	return strings.HasSuffix(name, ".tmp") || path.Base(name) == "addressTree"+newSuffix
+}
+
+func (f dryRunFS) open(name string) (builderFile, error) {
+	return f.create(name)
+}
+
+func (f dryRunFS) create(name string) (builderFile, error) {
+	if keptInDryRun(name) {
+		return f.osFS.create(name)
+	}
+	file := &discardedFile{}
+	f.discarded[name] = file
+	return file, nil
+}
+
+func (f dryRunFS) rename(oldname, newname string) error {
+	file, has := f.discarded[oldname]
+	if !has {
+		// The address tree is complete, discard it too.
+		size, err := f.osFS.size(oldname)
+		if err != nil {
+			return err
+		}
+		if err := f.osFS.remove(oldname); err != nil {
+			return err
+		}
+		file = &discardedFile{size: size}
+	}
+	delete(f.discarded, oldname)
+	f.discarded[newname] = file
+	return nil
+}
+
+func (f dryRunFS) remove(name string) error {
+	if _, has := f.discarded[name]; !has {
+		return f.osFS.remove(name)
+	}
+	delete(f.discarded, name)
+	return nil
+}
+
+func (f dryRunFS) size(name string) (int64, error) {
+	file, has := f.discarded[name]
+	if !has {
+		return f.osFS.size(name)
+	}
+	return file.size, nil
+}
+
+func (f dryRunFS) dropCache(name string) error {
+	if _, has := f.discarded[name]; has {
+		return nil
+	}
+	return f.osFS.dropCache(name)
+}
+
+func (f dryRunFS) sync(name string) error {
+	if _, has := f.discarded[name]; has {
+		return nil
+	}
+	return f.osFS.sync(name)
+}
+
+// NewDryRunBuilder is like NewBuilderFromParameters, but the index is
+// not written: blocks pass through all the stages of the build and
+// Report() after Close has sizes of the files and statistics of the
+// address index, so parameters can be compared before a long build.
+// Temporary files of sorting are written to dir, which must be empty,
+// and removed by Close.
+func NewDryRunBuilder(dir string, memLimit int, p Parameters) (*Builder, error) {
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadDir(%q): %v", dir, err)
+	}
+	for _, f := range list {
+		if f.Name() != lockFile {
+			return nil, fmt.Errorf("Output directory is not empty")
+		}
+	}
+	lock, err := lockDir(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	fs := dryRunFS{
+		osFS:      osFS{os.Create},
+		discarded: make(map[string]*discardedFile),
+	}
+	b, err := createBuilder(dir, memLimit, p, fs)
+	if err != nil {
+		unlockDir(lock)
+		return nil, err
+	}
+	b.lock = lock
+	return b, nil
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	p := Parameters{
+		OffsetLen:               8,
+		OffsetIndexLen:          4,
+		AddressPageLen:          4096,
+		AddressPrefixLen:        16,
+		AddressFastmapPrefixLen: 5,
+		AddressOffsetLen:        4,
+		AddressTree:             true,
+	}
+	build := func(b *Builder) *BuildReport {
+		for _, block := range blocks {
+			if err := b.Add(block); err != nil {
+				t.Fatalf("b.Add: %v", err)
+			}
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("b.Close: %v", err)
+		}
+		return b.Report()
+	}
+	mb, err := NewMemoryBuilderFromParameters(1024*1024, p)
+	if err != nil {
+		t.Fatalf("NewMemoryBuilderFromParameters: %v", err)
+	}
+	want := build(mb)
+	dir, err := ioutil.TempDir("", "TestDryRun")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b, err := NewDryRunBuilder(dir, 1024*1024, p)
+	if err != nil {
+		t.Fatalf("NewDryRunBuilder: %v", err)
+	}
+	got := build(b)
+	if !reflect.DeepEqual(got.FileSizes, want.FileSizes) {
+		t.Errorf("FileSizes = %v, want %v", got.FileSizes, want.FileSizes)
+	}
+	if got.Addresses != want.Addresses || got.AddressPages != want.AddressPages || got.AddressTreeRoot != want.AddressTreeRoot {
+		t.Errorf("report = %+v, want %+v", got, want)
+	}
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	for _, f := range list {
+		if f.Name() != lockFile {
+			t.Errorf("dry run left file %s", f.Name())
+		}
+	}
+}
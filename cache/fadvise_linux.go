@@ -0,0 +1,21 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package cache
+
+import (
+	"syscall"
+)
+
+// fadvDontNeed is POSIX_FADV_DONTNEED.
+const fadvDontNeed = 4
+
+// fadviseDontNeed drops clean pages of the file from page cache.
+func fadviseDontNeed(fd uintptr) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, fd, 0, 0, fadvDontNeed, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux || (!amd64 && !arm64)
+// +build !linux !amd64,!arm64
+
+package cache
+
+// fadviseDontNeed does nothing on this platform.
+func fadviseDontNeed(fd uintptr) error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime/debug"
+)
+
+// Files of Server are mmaped, so reading a file which was truncated after
+// it was mmaped, or whose NFS server is unavailable, raises SIGBUS instead
+// of returning an error, which kills the process. Two things prevent it:
+// NewServer checks sizes of files against build_report.json before
+// mapping them, and Guard converts faults of reads of mapped files into
+// ErrFault, so a server can fail the request instead of crashing.
+
+var ErrFault = fmt.Errorf("Fault reading mmaped index file")
+
+// Guard runs f and returns its error or ErrFault if f faulted reading
+// mmaped memory. Other panics are not recovered. Guard changes a setting
+// of the current goroutine (see debug.SetPanicOnFault) while f runs.
+func Guard(f func() error) (err error) {
+	old := debug.SetPanicOnFault(true)
+	defer func() {
+		debug.SetPanicOnFault(old)
+		if r := recover(); r != nil {
+			if IsFault(r) {
+				err = ErrFault
+				return
+			}
+			panic(r)
+		}
+	}()
+	return f()
+}
+
+// IsFault returns if the recovered value is a fault of reading memory,
+// raised if debug.SetPanicOnFault is enabled.
+func IsFault(r interface{}) bool {
+	// The runtime error of a fault has the faulting address.
+	_, ok := r.(interface{ Addr() uintptr })
+	return ok
+}
+
+// checkFileSizes compares sizes of files in dir with build_report.json.
+// It does nothing if there is no build_report.json.
+func checkFileSizes(dir string) error {
+	data, err := ioutil.ReadFile(path.Join(dir, "build_report.json"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var report BuildReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return fmt.Errorf("build_report.json: %v", err)
+	}
+	for name, want := range report.FileSizes {
+		stat, err := os.Stat(path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if stat.Size() < want {
+			return fmt.Errorf("%s is truncated: %d bytes, want %d", name, stat.Size(), want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	f, err := ioutil.TempFile("", "TestGuard")
+	if err != nil {
+		t.Fatalf("ioutil.TempFile: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size := 2 * os.Getpagesize()
+	if _, err := f.Write(make([]byte, size)); err != nil {
+		t.Fatalf("f.Write: %v", err)
+	}
+	buf, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		t.Fatalf("syscall.Mmap: %v", err)
+	}
+	defer syscall.Munmap(buf)
+	var sum byte
+	if err := Guard(func() error {
+		sum += buf[size-1]
+		return nil
+	}); err != nil {
+		t.Errorf("Guard(valid read): %v", err)
+	}
+	// Reading pages beyond EOF of the truncated file raises SIGBUS.
+	if err := f.Truncate(0); err != nil {
+		t.Fatalf("f.Truncate: %v", err)
+	}
+	if err := Guard(func() error {
+		sum += buf[size-1]
+		return nil
+	}); err != ErrFault {
+		t.Errorf("Guard(read of truncated file): want ErrFault, got %v", err)
+	}
+	wantErr := fmt.Errorf("some error")
+	if err := Guard(func() error { return wantErr }); err != wantErr {
+		t.Errorf("Guard: want %v, got %v", wantErr, err)
+	}
+}
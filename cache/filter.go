@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Block filters let light clients find blocks with their addresses
+// without telling the addresses to the server, like BIP 158. The filter
+// of a block is a Golomb-coded set of the addresses used by the block:
+// each address is hashed with the key of the block to [0, N*FILTER_M),
+// where N is the number of addresses; the sorted hashes are encoded as
+// deltas with Golomb-Rice coding with parameter FILTER_P. The filter is
+// uvarint(N) followed by the bits of the deltas (most significant bit
+// first). A filter matches an address of another block with probability
+// about 1/FILTER_M. The key of a block is the first 16 bytes of the
+// Merkle root of its header, so clients with verified headers can check
+// filters of blocks against their addresses.
+
+const (
+	FILTER_P = 19
+	FILTER_M = 784931
+)
+
+var ErrBadFilter = fmt.Errorf("Bad filter")
+
+// FilterKey returns the key of the filter of the block.
+func FilterKey(header BlockHeader) [16]byte {
+	var key [16]byte
+	copy(key[:], header.MerkleRoot[:])
+	return key
+}
+
+// filterHash maps the address to [0, f).
+func filterHash(key [16]byte, address types.UnlockHash, f uint64) uint64 {
+	var buf [16 + len(types.UnlockHash{})]byte
+	copy(buf[:], key[:])
+	copy(buf[16:], address[:])
+	sum := sha256.Sum256(buf[:])
+	hi, _ := bits.Mul64(binary.BigEndian.Uint64(sum[:8]), f)
+	return hi
+}
+
+// filterHashes returns sorted unique hashes of the addresses.
+func filterHashes(key [16]byte, addresses []types.UnlockHash, n int) []uint64 {
+	f := uint64(n) * FILTER_M
+	hashes := make([]uint64, 0, len(addresses))
+	for _, address := range addresses {
+		hashes = append(hashes, filterHash(key, address, f))
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	return hashes
+}
+
+type bitWriter struct {
+	buf  []byte
+	nbit uint
+}
+
+func (w *bitWriter) writeBit(bit uint64) {
+	if w.nbit%8 == 0 {
+		w.buf = append(w.buf, 0)
+	}
+	if bit != 0 {
+		w.buf[len(w.buf)-1] |= 0x80 >> (w.nbit % 8)
+	}
+	w.nbit++
+}
+
+type bitReader struct {
+	buf  []byte
+	nbit uint
+}
+
+func (r *bitReader) readBit() (uint64, error) {
+	if r.nbit/8 >= uint(len(r.buf)) {
+		return 0, ErrBadFilter
+	}
+	bit := uint64(r.buf[r.nbit/8]>>(7-r.nbit%8)) & 1
+	r.nbit++
+	return bit, nil
+}
+
+// BuildFilter returns the filter of the addresses of a block.
+func BuildFilter(key [16]byte, addresses []types.UnlockHash) []byte {
+	unique := make(map[types.UnlockHash]struct{}, len(addresses))
+	var list []types.UnlockHash
+	for _, address := range addresses {
+		if _, has := unique[address]; !has {
+			unique[address] = struct{}{}
+			list = append(list, address)
+		}
+	}
+	var header [binary.MaxVarintLen64]byte
+	w := &bitWriter{
+		buf: append([]byte(nil), header[:binary.PutUvarint(header[:], uint64(len(list)))]...),
+	}
+	w.nbit = uint(len(w.buf)) * 8
+	prev := uint64(0)
+	for _, h := range filterHashes(key, list, len(list)) {
+		delta := h - prev
+		prev = h
+		for q := delta >> FILTER_P; q > 0; q-- {
+			w.writeBit(1)
+		}
+		w.writeBit(0)
+		for i := FILTER_P - 1; i >= 0; i-- {
+			w.writeBit((delta >> uint(i)) & 1)
+		}
+	}
+	return w.buf
+}
+
+// MatchFilter returns if the filter of the block with the key matches
+// any of the addresses.
+func MatchFilter(filter []byte, key [16]byte, addresses []types.UnlockHash) (bool, error) {
+	n, size := binary.Uvarint(filter)
+	if size <= 0 || n > uint64(len(filter))*8 {
+		return false, ErrBadFilter
+	}
+	if n == 0 || len(addresses) == 0 {
+		return false, nil
+	}
+	wanted := filterHashes(key, addresses, int(n))
+	r := &bitReader{buf: filter, nbit: uint(size) * 8}
+	value := uint64(0)
+	for i := uint64(0); i < n; i++ {
+		q := uint64(0)
+		for {
+			bit, err := r.readBit()
+			if err != nil {
+				return false, err
+			}
+			if bit == 0 {
+				break
+			}
+			q++
+		}
+		delta := q << FILTER_P
+		for j := FILTER_P - 1; j >= 0; j-- {
+			bit, err := r.readBit()
+			if err != nil {
+				return false, err
+			}
+			delta |= bit << uint(j)
+		}
+		value += delta
+		for len(wanted) != 0 && wanted[0] < value {
+			wanted = wanted[1:]
+		}
+		if len(wanted) == 0 {
+			return false, nil
+		}
+		if wanted[0] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BlockAddresses returns the addresses used by the block, with repeats.
+func (s *Server) BlockAddresses(blockIndex int) ([]types.UnlockHash, error) {
+	payoutsStart, _, itemsEnd, err := s.GetBlockItems(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []types.UnlockHash
+	add := func(address types.UnlockHash) error {
+		addresses = append(addresses, address)
+		return nil
+	}
+	for itemIndex := payoutsStart; itemIndex < itemsEnd; itemIndex++ {
+		item, err := s.GetItemWithoutProof(itemIndex)
+		if err != nil {
+			return nil, err
+		}
+		payout, tx, err := DecodeItem(item)
+		if err != nil {
+			return nil, err
+		}
+		if payout != nil {
+			add(payout.UnlockHash)
+		} else if err := forEachAddress(tx, add); err != nil {
+			return nil, err
+		}
+	}
+	return addresses, nil
+}
+
+// BlockFilter returns the filter of the block (see BuildFilter).
+func (s *Server) BlockFilter(blockIndex int) ([]byte, error) {
+	header, err := s.GetBlockHeader(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := s.BlockAddresses(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	return BuildFilter(FilterKey(header), addresses), nil
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestFilter(t *testing.T) {
+	var key [16]byte
+	key[0] = 1
+	randomAddress := func(i int) types.UnlockHash {
+		var uh types.UnlockHash
+		sum := sha256.Sum256([]byte(fmt.Sprintf("address %d", i)))
+		copy(uh[:], sum[:])
+		return uh
+	}
+	var addresses []types.UnlockHash
+	for i := 0; i < 100; i++ {
+		addresses = append(addresses, randomAddress(i))
+	}
+	// Repeats do not change the filter.
+	filter := BuildFilter(key, append(addresses, addresses[:10]...))
+	if !bytes.Equal(filter, BuildFilter(key, addresses)) {
+		t.Errorf("repeated addresses change the filter")
+	}
+	for i, address := range addresses {
+		if match, err := MatchFilter(filter, key, []types.UnlockHash{address}); err != nil || !match {
+			t.Errorf("MatchFilter(address %d) = %v, %v", i, match, err)
+		}
+	}
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		match, err := MatchFilter(filter, key, []types.UnlockHash{randomAddress(i)})
+		if err != nil {
+			t.Fatalf("MatchFilter: %v", err)
+		}
+		if match {
+			falsePositives++
+		}
+	}
+	if falsePositives > 5 {
+		t.Errorf("%d false positives of 10000", falsePositives)
+	}
+	if match, err := MatchFilter(filter, key, []types.UnlockHash{randomAddress(2000), addresses[50]}); err != nil || !match {
+		t.Errorf("MatchFilter(several addresses) = %v, %v", match, err)
+	}
+	if _, err := MatchFilter(filter[:1], key, []types.UnlockHash{addresses[99]}); err != ErrBadFilter {
+		t.Errorf("MatchFilter(truncated filter): want ErrBadFilter, got %v", err)
+	}
+	if match, err := MatchFilter(BuildFilter(key, nil), key, addresses); err != nil || match {
+		t.Errorf("MatchFilter(empty filter) = %v, %v", match, err)
+	}
+}
+
+func TestBlockFilter(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	for blockIndex := 0; blockIndex < s.NumBlocks(); blockIndex += 97 {
+		filter, err := s.BlockFilter(blockIndex)
+		if err != nil {
+			t.Fatalf("BlockFilter: %v", err)
+		}
+		header, err := s.GetBlockHeader(blockIndex)
+		if err != nil {
+			t.Fatalf("GetBlockHeader: %v", err)
+		}
+		block := blocks[blockIndex]
+		for _, mp := range block.MinerPayouts {
+			match, err := MatchFilter(filter, FilterKey(header), []types.UnlockHash{mp.UnlockHash})
+			if err != nil || !match {
+				t.Errorf("filter of block %d does not match its miner payout: %v", blockIndex, err)
+			}
+		}
+	}
+}
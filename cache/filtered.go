@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// A watch-only sialite node does not need the whole chain: it downloads
+// headers of all blocks and only the items having its addresses from a
+// full node (see FilteredBlock). The node asks for address prefixes, so
+// shorter prefixes hide its addresses among more of them at the cost of
+// downloading more items.
+
+// MAX_FILTER_PREFIXES is the max number of address prefixes of
+// GetFilteredBlock.
+const MAX_FILTER_PREFIXES = 1000
+
+var ErrBadFilterPrefix = fmt.Errorf("Bad address prefix: want 1-32 bytes")
+
+// FilteredBlock is the header of a block (HEADER_SIZE bytes) and its
+// items with Merkle proofs having addresses starting with any of the
+// prefixes of the filter.
+type FilteredBlock struct {
+	Header []byte
+	Items  []Item
+}
+
+// CheckFilterPrefixes checks the prefixes passed to GetFilteredBlock.
+func CheckFilterPrefixes(prefixes [][]byte) error {
+	if len(prefixes) > MAX_FILTER_PREFIXES {
+		return fmt.Errorf("too many prefixes: %d > %d", len(prefixes), MAX_FILTER_PREFIXES)
+	}
+	for _, prefix := range prefixes {
+		if len(prefix) == 0 || len(prefix) > len(types.UnlockHash{}) {
+			return ErrBadFilterPrefix
+		}
+	}
+	return nil
+}
+
+func matchesPrefix(address types.UnlockHash, prefixes [][]byte) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(address[:], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetFilteredBlock returns the block with given index filtered by the
+// address prefixes. Item.Block is the index of the block.
+func (s *Server) GetFilteredBlock(blockIndex int, prefixes [][]byte) (FilteredBlock, error) {
+	if err := CheckFilterPrefixes(prefixes); err != nil {
+		return FilteredBlock{}, err
+	}
+	payoutsStart, _, itemsEnd, err := s.GetBlockItems(blockIndex)
+	if err != nil {
+		return FilteredBlock{}, err
+	}
+	fb := FilteredBlock{
+		Header: s.Headers[blockIndex*headerSize : (blockIndex+1)*headerSize],
+	}
+	for itemIndex := payoutsStart; itemIndex < itemsEnd; itemIndex++ {
+		item, err := s.GetItemWithoutProof(itemIndex)
+		if err != nil {
+			return FilteredBlock{}, err
+		}
+		payout, tx, err := DecodeItem(item)
+		if err != nil {
+			return FilteredBlock{}, err
+		}
+		matches := false
+		if payout != nil {
+			matches = matchesPrefix(payout.UnlockHash, prefixes)
+		} else {
+			forEachAddress(tx, func(address types.UnlockHash) error {
+				matches = matches || matchesPrefix(address, prefixes)
+				return nil
+			})
+		}
+		if !matches {
+			continue
+		}
+		item.MerkleProof = s.buildProof(payoutsStart, item.NumLeaves, item.Index)
+		fb.Items = append(fb.Items, item)
+	}
+	return fb, nil
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestGetFilteredBlock(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	address := blocks[500].MinerPayouts[0].UnlockHash
+	prefixes := [][]byte{address[:2]}
+	found := 0
+	for blockIndex := 0; blockIndex < s.NumBlocks(); blockIndex++ {
+		fb, err := s.GetFilteredBlock(blockIndex, prefixes)
+		if err != nil {
+			t.Fatalf("GetFilteredBlock: %v", err)
+		}
+		header, err := DecodeHeader(fb.Header)
+		if err != nil {
+			t.Fatalf("DecodeHeader: %v", err)
+		}
+		if header.MerkleRoot != blocks[blockIndex].MerkleRoot() {
+			t.Errorf("block %d: wrong header", blockIndex)
+		}
+		for _, item := range fb.Items {
+			if err := VerifyItem(item, header.MerkleRoot); err != nil {
+				t.Errorf("VerifyItem(%s): %v", item.ID, err)
+			}
+			if matches, err := ItemMatches(item, address); err != nil {
+				t.Fatalf("ItemMatches: %v", err)
+			} else if len(matches) != 0 {
+				found++
+			}
+		}
+	}
+	items, err := s.addressItems(address[:])
+	if err != nil {
+		t.Fatalf("addressItems: %v", err)
+	}
+	if found != len(items) {
+		t.Errorf("found %d items of the address, want %d", found, len(items))
+	}
+	if _, err := s.GetFilteredBlock(0, [][]byte{{}}); err != ErrBadFilterPrefix {
+		t.Errorf("empty prefix: got %v, want ErrBadFilterPrefix", err)
+	}
+}
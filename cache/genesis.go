@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var ErrNoGenesis = fmt.Errorf("The index does not start from the genesis block")
+
+// Genesis is the genesis block as stored in the index.
+type Genesis struct {
+	ID        types.BlockID
+	Timestamp types.Timestamp
+
+	// Outputs are created by transactions of the genesis block
+	// (the siafund allocation). They are in the address index.
+	Outputs []GenesisOutput
+}
+
+type GenesisOutput struct {
+	Output
+	ItemID string
+}
+
+// Genesis returns the genesis block from the index. The block is read
+// from the index (not from types.GenesisBlock) and checked to be the
+// genesis block.
+func (s *Server) Genesis() (*Genesis, error) {
+	if s.par.StartHeight != 0 || s.nblocks == 0 {
+		return nil, ErrNoGenesis
+	}
+	header, err := s.GetBlockHeader(0)
+	if err != nil {
+		return nil, err
+	}
+	g := &Genesis{
+		ID:        header.ID(s.firstParentID()),
+		Timestamp: header.Timestamp,
+	}
+	if g.ID != types.GenesisID {
+		return nil, fmt.Errorf("block 0 is %s, not the genesis block %s", g.ID, types.GenesisID)
+	}
+	_, txsStart, end, err := s.GetBlockItems(0)
+	if err != nil {
+		return nil, err
+	}
+	for itemIndex := txsStart; itemIndex < end; itemIndex++ {
+		item, err := s.GetItemWithoutProof(itemIndex)
+		if err != nil {
+			return nil, err
+		}
+		_, tx, err := DecodeItem(item)
+		if err != nil {
+			return nil, err
+		}
+		for _, out := range TransactionOutputs(tx) {
+			g.Outputs = append(g.Outputs, GenesisOutput{
+				Output: out,
+				ItemID: item.ID,
+			})
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestGenesis(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	b, err := NewMemoryBuilderFromParameters(1024*1024, testParameters())
+	if err != nil {
+		t.Fatalf("NewMemoryBuilderFromParameters: %v", err)
+	}
+	if err := b.Add(blocks[1]); err == nil {
+		t.Errorf("b.Add accepted the first block which is not the genesis block")
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	g, err := s.Genesis()
+	if err != nil {
+		t.Fatalf("Genesis: %v", err)
+	}
+	if g.ID != types.GenesisID || g.Timestamp != types.GenesisBlock.Timestamp {
+		t.Errorf("Genesis() returned block %s at %d", g.ID, g.Timestamp)
+	}
+	var want []Output
+	for i := range types.GenesisBlock.Transactions {
+		want = append(want, TransactionOutputs(&types.GenesisBlock.Transactions[i])...)
+	}
+	if len(g.Outputs) != len(want) || len(want) == 0 {
+		t.Fatalf("Genesis() returned %d outputs, want %d", len(g.Outputs), len(want))
+	}
+	for i, out := range g.Outputs {
+		if out.ID != want[i].ID || out.UnlockHash != want[i].UnlockHash || out.Value.Cmp(want[i].Value) != 0 {
+			t.Errorf("output %d is %v, want %v", i, out.Output, want[i])
+		}
+		id, err := ParseItemID(out.ItemID)
+		if err != nil {
+			t.Fatalf("ParseItemID: %v", err)
+		}
+		itemIndex, err := s.ItemIndex(id)
+		if err != nil {
+			t.Fatalf("ItemIndex: %v", err)
+		}
+		items, err := s.addressItems(out.UnlockHash[:])
+		if err != nil {
+			t.Fatalf("addressItems: %v", err)
+		}
+		if !containsInt(items, itemIndex) {
+			t.Errorf("genesis item %s is not in the history of %s", out.ItemID, out.UnlockHash)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// Hashes of leaves and Merkle proofs, see Parameters.LeafHash.
+// All of them produce crypto.HashSize bytes.
+const (
+	HASH_BLAKE2B = "blake2b" // Used by Sia.
+	HASH_SHA256  = "sha256"
+)
+
+func newLeafHash(name string) (func() hash.Hash, error) {
+	switch name {
+	case "", HASH_BLAKE2B:
+		return crypto.NewHash, nil
+	case HASH_SHA256:
+		return sha256.New, nil
+	default:
+		return nil, fmt.Errorf("unknown leaf hash: %q", name)
+	}
+}
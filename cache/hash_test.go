@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/golang/snappy"
+)
+
+func TestLeafHash(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	p := testParameters()
+	p.LeafHash = HASH_SHA256
+	s := buildTestServer(t, p, blocks[:100])
+	for i := 0; i < s.NumItems(); i++ {
+		item, err := s.GetItem(i)
+		if err != nil {
+			t.Fatalf("GetItem(%d): %v", i, err)
+		}
+		data := item.Data
+		if item.Compression == SNAPPY {
+			if data, err = snappy.Decode(nil, item.Data); err != nil {
+				t.Fatalf("snappy.Decode: %v", err)
+			}
+		}
+		want := sha256.Sum256(append([]byte{0x00}, data...))
+		got := s.LeavesHashes[i*crypto.HashSize : (i+1)*crypto.HashSize]
+		if !bytes.Equal(got, want[:]) {
+			t.Errorf("leaf hash of item %d: got %x, want %x", i, got, want[:])
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	ErrNotGenesis           = fmt.Errorf("The first header is not the genesis block")
+	ErrEarlyTimestamp       = fmt.Errorf("Timestamp of the header is less than the median of previous timestamps")
+	ErrFutureTimestamp      = fmt.Errorf("Timestamp of the header is too far in the future")
+	ErrBadHeaderSize        = fmt.Errorf("Bad size of header")
+	ErrBadVerifierWindow    = fmt.Errorf("Bad number of timestamps of HeaderVerifierState")
+	ErrVerifierNoPreviousID = fmt.Errorf("HeaderVerifierState has timestamps, but no LastID")
+	ErrInsufficientWork     = fmt.Errorf("ID of the header does not meet the min target")
+)
+
+// HeaderVerifierState is the state of HeaderVerifier which is enough to
+// continue verification: the last verified header and the timestamps of
+// the last MedianTimestampWindow headers. The zero value is the state
+// before the genesis block.
+type HeaderVerifierState struct {
+	// Height is the number of verified headers.
+	Height int
+	LastID types.BlockID
+	// Timestamps of last headers, the latest first.
+	Timestamps []types.Timestamp
+}
+
+// HeaderVerifier verifies headers (records of file headers of the index,
+// see BlockHeader) as they arrive, keeping only the state needed for the
+// next header, so headers can be verified on constrained devices while
+// they are streamed from the network. It checks that headers form
+// a chain starting from the genesis block and that timestamps follow the
+// rules of consensus: not less than the median of the previous
+// MedianTimestampWindow timestamps and not further than FutureThreshold
+// in the future. Exact targets are not checked, since they depend on
+// the difficulty of all previous blocks; SetMinTarget makes it check
+// that IDs meet a floor target, so forging headers costs at least that
+// much work per header. Compare LastID with a trusted source as well.
+type HeaderVerifier struct {
+	state     HeaderVerifierState
+	clock     Clock
+	minTarget types.Target
+
+	// Buffer of sorted timestamps to find the median.
+	sorted []types.Timestamp
+}
+
+// NewHeaderVerifier continues verification from the state. If clock is
+// nil, SystemClock is used.
+func NewHeaderVerifier(state HeaderVerifierState, clock Clock) (*HeaderVerifier, error) {
+	window := int(types.MedianTimestampWindow)
+	if len(state.Timestamps) > window || (state.Height < window && len(state.Timestamps) != state.Height) || (state.Height >= window && len(state.Timestamps) != window) {
+		return nil, ErrBadVerifierWindow
+	}
+	if state.Height > 0 && state.LastID == (types.BlockID{}) {
+		return nil, ErrVerifierNoPreviousID
+	}
+	if clock == nil {
+		clock = SystemClock
+	}
+	state.Timestamps = append(make([]types.Timestamp, 0, window), state.Timestamps...)
+	return &HeaderVerifier{
+		state:  state,
+		clock:  clock,
+		sorted: make([]types.Timestamp, window),
+	}, nil
+}
+
+// SetMinTarget makes AppendHeader reject headers with IDs above target
+// (ErrInsufficientWork). The zero target disables the check.
+func (v *HeaderVerifier) SetMinTarget(target types.Target) {
+	v.minTarget = target
+}
+
+// pushTimestamp adds the timestamp of the next header to timestamps of
+// the last headers (the latest first), keeping at most cap(timestamps).
+func pushTimestamp(timestamps []types.Timestamp, timestamp types.Timestamp) []types.Timestamp {
+	if len(timestamps) == cap(timestamps) {
+		timestamps = timestamps[:len(timestamps)-1]
+	}
+	timestamps = append(timestamps, 0)
+	copy(timestamps[1:], timestamps)
+	timestamps[0] = timestamp
+	return timestamps
+}
+
+// minTimestamp returns the min valid timestamp of the next header.
+// Like in consensus, the timestamp of the genesis block is repeated
+// if there are fewer than MedianTimestampWindow previous headers.
+func (v *HeaderVerifier) minTimestamp() types.Timestamp {
+	n := copy(v.sorted, v.state.Timestamps)
+	for i := n; i < len(v.sorted); i++ {
+		v.sorted[i] = v.sorted[n-1]
+	}
+	sort.Slice(v.sorted, func(i, j int) bool {
+		return v.sorted[i] < v.sorted[j]
+	})
+	return v.sorted[len(v.sorted)/2]
+}
+
+// Append verifies the next header in the format of file headers
+// (headerSize bytes) and adds it to the chain.
+func (v *HeaderVerifier) Append(headerBytes []byte) error {
+	header, err := DecodeHeader(headerBytes)
+	if err != nil {
+		return err
+	}
+	return v.AppendHeader(header)
+}
+
+// AppendHeader is like Append, but takes the decoded header.
+func (v *HeaderVerifier) AppendHeader(header BlockHeader) error {
+	id := header.ID(v.state.LastID)
+	if v.state.Height == 0 {
+		if id != types.GenesisID {
+			return ErrNotGenesis
+		}
+	} else if header.Timestamp < v.minTimestamp() {
+		return ErrEarlyTimestamp
+	}
+	if header.Timestamp > v.clock.Now()+types.FutureThreshold {
+		return ErrFutureTimestamp
+	}
+	if v.minTarget != (types.Target{}) && bytes.Compare(id[:], v.minTarget[:]) > 0 {
+		return ErrInsufficientWork
+	}
+	v.state.Timestamps = pushTimestamp(v.state.Timestamps, header.Timestamp)
+	v.state.LastID = id
+	v.state.Height++
+	return nil
+}
+
+// State returns the current state, e.g. to save it and continue later.
+func (v *HeaderVerifier) State() HeaderVerifierState {
+	state := v.state
+	state.Timestamps = append([]types.Timestamp(nil), v.state.Timestamps...)
+	return state
+}
+
+// Height returns the number of verified headers.
+func (v *HeaderVerifier) Height() int {
+	return v.state.Height
+}
+
+// LastID returns the ID of the last verified header.
+func (v *HeaderVerifier) LastID() types.BlockID {
+	return v.state.LastID
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestHeaderVerifier(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	b, s := buildTestIndex(t, "", testParameters(), blocks)
+	last := blocks[len(blocks)-1]
+	clock := FixedClock(last.Timestamp)
+	v, err := NewHeaderVerifier(HeaderVerifierState{}, clock)
+	if err != nil {
+		t.Fatalf("NewHeaderVerifier: %v", err)
+	}
+	var middle HeaderVerifierState
+	for i := range blocks {
+		if err := v.Append(s.Headers[i*headerSize : (i+1)*headerSize]); err != nil {
+			t.Fatalf("Append(%d): %v", i, err)
+		}
+		if i == 500 {
+			middle = v.State()
+		}
+	}
+	if v.Height() != len(blocks) {
+		t.Errorf("Height() = %d, want %d", v.Height(), len(blocks))
+	}
+	if v.LastID() != last.ID() {
+		t.Errorf("LastID() = %s, want %s", v.LastID(), last.ID())
+	}
+	if state := b.HeaderVerifierState(); !reflect.DeepEqual(state, v.State()) {
+		t.Errorf("Builder.HeaderVerifierState() = %v, want %v", state, v.State())
+	}
+	// Continue from the saved state.
+	v2, err := NewHeaderVerifier(middle, clock)
+	if err != nil {
+		t.Fatalf("NewHeaderVerifier: %v", err)
+	}
+	for i := 501; i < len(blocks); i++ {
+		if err := v2.Append(s.Headers[i*headerSize : (i+1)*headerSize]); err != nil {
+			t.Fatalf("Append(%d): %v", i, err)
+		}
+	}
+	if v2.LastID() != last.ID() {
+		t.Errorf("LastID() = %s, want %s", v2.LastID(), last.ID())
+	}
+	// Bad headers.
+	if err := v.Append(s.Headers[:headerSize-1]); err != ErrBadHeaderSize {
+		t.Errorf("Append(short header) returned %v, want ErrBadHeaderSize", err)
+	}
+	early := BlockHeader{Timestamp: blocks[len(blocks)-20].Timestamp}
+	if err := v.AppendHeader(early); err != ErrEarlyTimestamp {
+		t.Errorf("AppendHeader(early) returned %v, want ErrEarlyTimestamp", err)
+	}
+	future := BlockHeader{Timestamp: last.Timestamp + types.FutureThreshold + 1}
+	if err := v.AppendHeader(future); err != ErrFutureTimestamp {
+		t.Errorf("AppendHeader(future) returned %v, want ErrFutureTimestamp", err)
+	}
+	v2.SetMinTarget(types.Target{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1})
+	next := BlockHeader{Timestamp: last.Timestamp}
+	if err := v2.AppendHeader(next); err != ErrInsufficientWork {
+		t.Errorf("AppendHeader(easy header) returned %v, want ErrInsufficientWork", err)
+	}
+	if v.LastID() != last.ID() || v.Height() != len(blocks) || v2.Height() != len(blocks) {
+		t.Errorf("rejected headers changed the state")
+	}
+	v3, err := NewHeaderVerifier(HeaderVerifierState{}, clock)
+	if err != nil {
+		t.Fatalf("NewHeaderVerifier: %v", err)
+	}
+	if err := v3.Append(s.Headers[headerSize : 2*headerSize]); err != ErrNotGenesis {
+		t.Errorf("Append(second header) returned %v, want ErrNotGenesis", err)
+	}
+	if _, err := NewHeaderVerifier(HeaderVerifierState{Height: 5, LastID: last.ID()}, clock); err != ErrBadVerifierWindow {
+		t.Errorf("NewHeaderVerifier(bad state) returned %v, want ErrBadVerifierWindow", err)
+	}
+}
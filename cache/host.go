@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// File hostKeys is an item index (see itemindex.go) with keys of ed25519
+// public keys of hosts. A transaction is indexed under the key of a host
+// if it has an announcement of the host or a revision of a contract of
+// the host. Contracts are formed with unlock conditions of the renter
+// and the host, so the key of the host is the second key of the unlock
+// conditions of revisions. Other transactions of contracts (formation,
+// storage proofs) do not have keys of hosts.
+
+// Kinds of HostEvent.
+const (
+	HOST_ANNOUNCEMENT = "announcement"
+	HOST_REVISION     = "revision"
+)
+
+// HostEvent is an announcement of a host or a revision of a contract
+// of the host.
+type HostEvent struct {
+	Kind string
+
+	// NetAddress is the announced address.
+	NetAddress modules.NetAddress
+
+	// Fields of the revision.
+	ContractID     types.FileContractID
+	RevisionNumber uint64
+	FileSize       uint64
+}
+
+// announcedKey returns the key of the host announced in the entry of
+// ArbitraryData. The signature of the announcement is checked.
+func announcedKey(data []byte) (modules.NetAddress, []byte, bool) {
+	if !bytes.HasPrefix(data, modules.PrefixHostAnnouncement[:]) {
+		return "", nil, false
+	}
+	na, spk, err := modules.DecodeAnnouncement(data)
+	if err != nil || spk.Algorithm != types.SignatureEd25519 || len(spk.Key) != crypto.PublicKeySize {
+		return "", nil, false
+	}
+	return na, spk.Key, true
+}
+
+// revisionHostKey returns the key of the host of the revision.
+func revisionHostKey(rev *types.FileContractRevision) ([]byte, bool) {
+	keys := rev.UnlockConditions.PublicKeys
+	if len(keys) != 2 || keys[1].Algorithm != types.SignatureEd25519 || len(keys[1].Key) != crypto.PublicKeySize {
+		return nil, false
+	}
+	return keys[1].Key, true
+}
+
+func (s *Builder) writeHostKeys(tx *types.Transaction, itemIndex uint64) error {
+	for _, data := range tx.ArbitraryData {
+		if _, key, ok := announcedKey(data); ok {
+			if err := s.hostKeys.add(key, itemIndex); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range tx.FileContractRevisions {
+		if key, ok := revisionHostKey(&tx.FileContractRevisions[i]); ok {
+			if err := s.hostKeys.add(key, itemIndex); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HostEvents returns events of the host with the key in the transaction.
+func HostEvents(tx *types.Transaction, pk crypto.PublicKey) []HostEvent {
+	var events []HostEvent
+	for _, data := range tx.ArbitraryData {
+		if na, key, ok := announcedKey(data); ok && bytes.Equal(key, pk[:]) {
+			events = append(events, HostEvent{
+				Kind:       HOST_ANNOUNCEMENT,
+				NetAddress: na,
+			})
+		}
+	}
+	for i := range tx.FileContractRevisions {
+		rev := &tx.FileContractRevisions[i]
+		if key, ok := revisionHostKey(rev); ok && bytes.Equal(key, pk[:]) {
+			events = append(events, HostEvent{
+				Kind:           HOST_REVISION,
+				ContractID:     rev.ParentID,
+				RevisionNumber: rev.NewRevisionNumber,
+				FileSize:       rev.NewFileSize,
+			})
+		}
+	}
+	return events
+}
+
+// HostActivity returns transactions with announcements of the host
+// with the key and revisions of its contracts, in the order of the
+// blockchain, up to MAX_HISTORY_SIZE items. See HostEvents.
+func (s *Server) HostActivity(pk crypto.PublicKey) ([]Item, error) {
+	page, err := s.HostActivityPage(pk, "", MAX_HISTORY_SIZE)
+	return page.Items, err
+}
+
+// HostActivityPage is like HostActivity, but returns up to limit items
+// starting from the cursor start (see page.go).
+func (s *Server) HostActivityPage(pk crypto.PublicKey, start string, limit int) (ItemPage, error) {
+	itemIndices := searchItemIndex(s.HostKeys, crypto.PublicKeySize, s.offsetIndexLen, pk[:])
+	items, pos, err := s.pageItems(context.Background(), itemIndices, start, limit, nil)
+	if err != nil {
+		return ItemPage{}, err
+	}
+	next, err := s.cursorAt(itemIndices, pos)
+	if err != nil {
+		return ItemPage{}, err
+	}
+	return ItemPage{Items: items, Next: next, Total: len(itemIndices)}, nil
+}
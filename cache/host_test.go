@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestHostActivity(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	sk, pk := crypto.GenerateKeyPair()
+	announcement, err := modules.CreateAnnouncement("host.example.com:9982", types.Ed25519PublicKey(pk), sk)
+	if err != nil {
+		t.Fatalf("modules.CreateAnnouncement: %v", err)
+	}
+	renter := crypto.PublicKey{1}
+	revision := types.FileContractRevision{
+		ParentID: types.FileContractID{2},
+		UnlockConditions: types.UnlockConditions{
+			PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(renter), types.Ed25519PublicKey(pk)},
+			SignaturesRequired: 2,
+		},
+		NewRevisionNumber: 5,
+		NewFileSize:       1 << 20,
+	}
+	txs := []types.Transaction{
+		{ArbitraryData: [][]byte{announcement}},
+		{ArbitraryData: [][]byte{[]byte("other")}},
+		{FileContractRevisions: []types.FileContractRevision{revision}},
+	}
+	chain := []*types.Block{blocks[0]}
+	parentID := blocks[0].ID()
+	for i, tx := range txs {
+		block := &types.Block{
+			ParentID:     parentID,
+			Timestamp:    types.Timestamp(1433600000 + i + 1),
+			Transactions: []types.Transaction{tx},
+		}
+		chain = append(chain, block)
+		parentID = block.ID()
+	}
+	s := buildTestServer(t, testParameters(), chain)
+	items, err := s.HostActivity(pk)
+	if err != nil {
+		t.Fatalf("HostActivity: %v", err)
+	}
+	if len(items) != 2 || items[0].Block != 1 || items[1].Block != 3 {
+		t.Fatalf("HostActivity returned %d items, want items of blocks 1 and 3", len(items))
+	}
+	var kinds []string
+	for _, item := range items {
+		_, tx, err := DecodeItem(item)
+		if err != nil {
+			t.Fatalf("DecodeItem: %v", err)
+		}
+		for _, event := range HostEvents(tx, pk) {
+			kinds = append(kinds, event.Kind)
+		}
+	}
+	if fmt.Sprint(kinds) != fmt.Sprint([]string{HOST_ANNOUNCEMENT, HOST_REVISION}) {
+		t.Errorf("HostEvents returned events %v", kinds)
+	}
+	if items, err := s.HostActivity(renter); err != nil || len(items) != 0 {
+		t.Errorf("HostActivity(renter) returned %d items, %v", len(items), err)
+	}
+}
@@ -0,0 +1,41 @@
+package cache
+
+// Lookups of items and addresses read random pages of a few large files,
+// so on large indices they miss the TLB more often than the page cache.
+// Transparent huge pages reduce the misses. MAP_HUGETLB can not be used
+// for mmaped files of a regular filesystem, so the kernel is advised to
+// back the mappings with huge pages (MADV_HUGEPAGE). File-backed huge
+// pages need a kernel with CONFIG_READ_ONLY_THP_FOR_FS and khugepaged;
+// otherwise the advice has no effect or fails, and the index is served
+// with normal pages.
+
+// hugePageFiles returns the mmaped files accessed randomly by lookups.
+func (s *Server) hugePageFiles() [][]byte {
+	return [][]byte{
+		s.Offsets,
+		s.AddressesFastmapData,
+		s.AddressesFastmapPrefixes,
+		s.AddressesIndices,
+		s.BlockIDsFastmapData,
+		s.BlockIDsFastmapPrefixes,
+	}
+}
+
+// AdviseHugePages advises the kernel to back the files of the index
+// accessed randomly (offsets and fastmap files) with transparent huge
+// pages. It does nothing if the files are not mmaped. It returns an
+// error if the kernel does not support it; the server works anyway.
+func (s *Server) AdviseHugePages() error {
+	if !s.mmaped {
+		return nil
+	}
+	for _, buf := range s.hugePageFiles() {
+		if len(buf) == 0 {
+			continue
+		}
+		if err := madviseHugePage(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
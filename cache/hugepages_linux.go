@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package cache
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// madvHugePage is MADV_HUGEPAGE.
+const madvHugePage = 14
+
+// madviseHugePage advises transparent huge pages for mmaped buf.
+func madviseHugePage(buf []byte) error {
+	if err := syscall.Madvise(buf, madvHugePage); err != nil {
+		return fmt.Errorf("madvise(MADV_HUGEPAGE): %v", err)
+	}
+	return nil
+}
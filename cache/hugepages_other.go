@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package cache
+
+import (
+	"fmt"
+)
+
+// madviseHugePage is not supported on this platform.
+func madviseHugePage(buf []byte) error {
+	return fmt.Errorf("Huge pages are not supported on this platform")
+}
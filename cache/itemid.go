@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Types of items in ItemID.
+const (
+	ITEM_MINER_PAYOUT = "p"
+	ITEM_TRANSACTION  = "t"
+)
+
+var ErrNoItem = fmt.Errorf("no such item in the index")
+
+// ItemID identifies an item by the chain, not by the index, so it does
+// not change across restarts, rebuilds and indices started from
+// checkpoints. The text form is "height:type:index", where type is
+// ITEM_MINER_PAYOUT or ITEM_TRANSACTION and index is the position of
+// the item among the items of this type in the block, e.g. "1234:t:5".
+type ItemID struct {
+	Height int
+	Type   string
+	Index  int
+}
+
+func (id ItemID) String() string {
+	return fmt.Sprintf("%d:%s:%d", id.Height, id.Type, id.Index)
+}
+
+// ParseItemID parses the text form of ItemID.
+func ParseItemID(text string) (ItemID, error) {
+	var id ItemID
+	parts := strings.Split(text, ":")
+	if len(parts) != 3 {
+		return id, fmt.Errorf("item ID %q: want height:type:index", text)
+	}
+	height, err := strconv.Atoi(parts[0])
+	if err != nil || height < 0 {
+		return id, fmt.Errorf("item ID %q: bad height", text)
+	}
+	if parts[1] != ITEM_MINER_PAYOUT && parts[1] != ITEM_TRANSACTION {
+		return id, fmt.Errorf("item ID %q: bad type %q", text, parts[1])
+	}
+	index, err := strconv.Atoi(parts[2])
+	if err != nil || index < 0 {
+		return id, fmt.Errorf("item ID %q: bad index", text)
+	}
+	return ItemID{Height: height, Type: parts[1], Index: index}, nil
+}
+
+func (s *Server) itemID(blockIndex, index, numMinerPayouts int) ItemID {
+	id := ItemID{
+		Height: s.StartHeight() + blockIndex,
+		Type:   ITEM_MINER_PAYOUT,
+		Index:  index,
+	}
+	if index >= numMinerPayouts {
+		id.Type = ITEM_TRANSACTION
+		id.Index -= numMinerPayouts
+	}
+	return id
+}
+
+// ItemIndex returns the index of the item in this server,
+// as accepted by GetItem. It returns ErrNotYetIndexed if the block of
+// the item is after the last block of the index.
+func (s *Server) ItemIndex(id ItemID) (int, error) {
+	if err := s.CheckHeight(id.Height); err != nil {
+		return 0, err
+	}
+	payoutsStart, txsStart, end, err := s.GetBlockItems(id.Height - s.StartHeight())
+	if err != nil {
+		return 0, ErrNoItem
+	}
+	var itemIndex int
+	switch id.Type {
+	case ITEM_MINER_PAYOUT:
+		itemIndex = payoutsStart + id.Index
+		end = txsStart
+	case ITEM_TRANSACTION:
+		itemIndex = txsStart + id.Index
+	default:
+		return 0, fmt.Errorf("item ID: bad type %q", id.Type)
+	}
+	if id.Index < 0 || itemIndex >= end {
+		return 0, ErrNoItem
+	}
+	return itemIndex, nil
+}
+
+// GetItemByID is like GetItem, but the item is identified by the text
+// form of ItemID (Item.ID).
+func (s *Server) GetItemByID(text string) (Item, error) {
+	id, err := ParseItemID(text)
+	if err != nil {
+		return Item{}, err
+	}
+	itemIndex, err := s.ItemIndex(id)
+	if err != nil {
+		return Item{}, err
+	}
+	return s.GetItem(itemIndex)
+}
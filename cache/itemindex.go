@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/starius/sialite/emsort"
+)
+
+// An item index is a file with a sorted list of records: a key of fixed
+// length and big endian index of the item, so the items of a key go in
+// the order of the blockchain. It is used for small indices of items,
+// e.g. by prefixes of ArbitraryData. Like the address index, it is
+// written under a temporary name and rebuilt from all items by Close.
+
+// bufferedFile is a builderFile written through a buffer. It is passed
+// to emsort, which closes the output.
+type bufferedFile struct {
+	*bufio.Writer
+	f builderFile
+}
+
+func (b *bufferedFile) Close() error {
+	if err := b.Flush(); err != nil {
+		b.f.Close()
+		return err
+	}
+	return b.f.Close()
+}
+
+type itemIndexWriter struct {
+	fs      builderFS
+	tmpName string
+	sorted  emsort.SortedWriter
+	tmp     builderFile
+
+	keyLen, offsetIndexLen int
+	record, tmpBuf         []byte
+}
+
+// newItemIndexWriter creates the writer of the item index stored in the
+// file name. Item indices are much smaller than the address index, so
+// they use a fraction of memLimit.
+func newItemIndexWriter(fs builderFS, dir, name string, keyLen, offsetIndexLen, memLimit int) (*itemIndexWriter, error) {
+	out, err := fs.create(path.Join(dir, name+newSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %v", name, err)
+	}
+	tmpName := path.Join(dir, name+".tmp")
+	tmp, err := fs.create(tmpName)
+	if err != nil {
+		out.Close()
+		return nil, fmt.Errorf("opening %s.tmp: %v", name, err)
+	}
+	recordSize := keyLen + offsetIndexLen
+	memLimit /= 8
+	if memLimit < recordSize {
+		memLimit = recordSize
+	}
+	sorted, err := emsort.New(&bufferedFile{bufio.NewWriter(out), out}, recordSize, emsort.BytesLess, memLimit, tmp)
+	if err != nil {
+		out.Close()
+		tmp.Close()
+		return nil, fmt.Errorf("emsort.New: %v", err)
+	}
+	return &itemIndexWriter{
+		fs:             fs,
+		tmpName:        tmpName,
+		sorted:         sorted,
+		tmp:            tmp,
+		keyLen:         keyLen,
+		offsetIndexLen: offsetIndexLen,
+		record:         make([]byte, recordSize),
+		tmpBuf:         make([]byte, 8),
+	}, nil
+}
+
+// add adds the record. The key is truncated or padded with zeros
+// to keyLen.
+func (w *itemIndexWriter) add(key []byte, itemIndex uint64) error {
+	for i := range w.record[:w.keyLen] {
+		w.record[i] = 0
+	}
+	copy(w.record[:w.keyLen], key)
+	binary.BigEndian.PutUint64(w.tmpBuf, itemIndex)
+	copy(w.record[w.keyLen:], w.tmpBuf[8-w.offsetIndexLen:])
+	if n, err := w.sorted.Write(w.record); err != nil {
+		return err
+	} else if n != len(w.record) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+func (w *itemIndexWriter) close() error {
+	if err := w.sorted.Close(); err != nil {
+		return err
+	}
+	if err := w.tmp.Close(); err != nil {
+		return err
+	}
+	return w.fs.remove(w.tmpName)
+}
+
+// searchItemIndex returns sorted unique indices of items having keys
+// starting with the prefix. The prefix must not be longer than keyLen.
+func searchItemIndex(data []byte, keyLen, offsetIndexLen int, prefix []byte) []int {
+	recordLen := keyLen + offsetIndexLen
+	n := len(data) / recordLen
+	first := sort.Search(n, func(i int) bool {
+		return bytes.Compare(data[i*recordLen:i*recordLen+keyLen], prefix) >= 0
+	})
+	var items []int
+	var tmp [8]byte
+	for i := first; i < n; i++ {
+		record := data[i*recordLen : (i+1)*recordLen]
+		if !bytes.HasPrefix(record[:keyLen], prefix) {
+			break
+		}
+		copy(tmp[8-offsetIndexLen:], record[keyLen:])
+		items = append(items, int(binary.BigEndian.Uint64(tmp[:])))
+	}
+	// Items are sorted only within the same key, so keys longer than
+	// the prefix break the order.
+	sort.Ints(items)
+	unique := items[:0]
+	for _, itemIndex := range items {
+		if len(unique) == 0 || itemIndex != unique[len(unique)-1] {
+			unique = append(unique, itemIndex)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestItemIndex(t *testing.T) {
+	fs := make(memFS)
+	w, err := newItemIndexWriter(fs, "", "test", 4, 3, 64)
+	if err != nil {
+		t.Fatalf("newItemIndexWriter: %v", err)
+	}
+	records := []struct {
+		key       string
+		itemIndex uint64
+	}{
+		{"abcd", 300}, {"abcd", 7}, {"abce", 5}, {"ab", 1000}, {"abcd", 7}, {"b", 2}, {"abcdef", 70000},
+	}
+	for _, r := range records {
+		if err := w.add([]byte(r.key), r.itemIndex); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, has := fs["test.tmp"]; has {
+		t.Errorf("test.tmp was not removed")
+	}
+	data := fs["test"+newSuffix].data
+	cases := []struct {
+		prefix string
+		items  []int
+	}{
+		{"abcd", []int{7, 300, 70000}},
+		{"abc", []int{5, 7, 300, 70000}},
+		{"ab", []int{5, 7, 300, 1000, 70000}},
+		{"ab\x00\x00", []int{1000}},
+		{"b", []int{2}},
+		{"c", nil},
+	}
+	for _, c := range cases {
+		got := searchItemIndex(data, 4, 3, []byte(c.prefix))
+		if fmt.Sprint(got) != fmt.Sprint(c.items) {
+			t.Errorf("searchItemIndex(%q) = %v, want %v", c.prefix, got, c.items)
+		}
+	}
+}
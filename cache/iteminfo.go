@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"encoding/binary"
+	"io"
+	"math/big"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// File itemInfo has a record of itemInfoSize bytes for each item:
+// 4-byte big-endian size of the item encoded by Sia (before compression)
+// and feeSize-byte big-endian sum of miner fees of the transaction
+// (0 for miner payouts). It allows listing items with sizes and fees
+// without decoding them.
+const itemInfoSize = 4 + feeSize
+
+// ItemInfo describes an item without decoding it.
+type ItemInfo struct {
+	// ID is the text form of ItemID. It is filled by BlockItemInfos.
+	ID string
+
+	// Size is the size of the item encoded by Sia.
+	Size int
+	Fee  types.Currency
+}
+
+func (s *Builder) writeItemInfo(size int, tx *types.Transaction) error {
+	var record [itemInfoSize]byte
+	binary.BigEndian.PutUint32(record[:4], uint32(size))
+	if tx != nil {
+		fee := types.NewCurrency64(0)
+		for _, f := range tx.MinerFees {
+			fee = fee.Add(f)
+		}
+		if err := putAmount(record[4:], fee); err != nil {
+			return err
+		}
+	}
+	if n, err := s.itemInfoBuf.Write(record[:]); err != nil {
+		return err
+	} else if n != itemInfoSize {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// GetItemInfo returns ItemInfo of the item with given item index.
+func (s *Server) GetItemInfo(itemIndex int) (ItemInfo, error) {
+	if itemIndex < 0 || itemIndex >= s.nitems {
+		return ItemInfo{}, ErrTooLargeIndex
+	}
+	record := s.ItemInfo[itemIndex*itemInfoSize : (itemIndex+1)*itemInfoSize]
+	return ItemInfo{
+		Size: int(binary.BigEndian.Uint32(record[:4])),
+		Fee:  types.NewCurrency(new(big.Int).SetBytes(record[4:])),
+	}, nil
+}
+
+// BlockItemInfos returns ItemInfo of all items of the block, miner
+// payouts first.
+func (s *Server) BlockItemInfos(blockIndex int) ([]ItemInfo, error) {
+	payoutsStart, txsStart, end, err := s.GetBlockItems(blockIndex)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ItemInfo, 0, end-payoutsStart)
+	for itemIndex := payoutsStart; itemIndex < end; itemIndex++ {
+		info, err := s.GetItemInfo(itemIndex)
+		if err != nil {
+			return nil, err
+		}
+		info.ID = s.itemID(blockIndex, itemIndex-payoutsStart, txsStart-payoutsStart).String()
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestItemInfo(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	for i, block := range blocks {
+		infos, err := s.BlockItemInfos(i)
+		if err != nil {
+			t.Fatalf("BlockItemInfos(%d): %v", i, err)
+		}
+		if len(infos) != len(block.MinerPayouts)+len(block.Transactions) {
+			t.Fatalf("block %d: got %d infos", i, len(infos))
+		}
+		for j, mp := range block.MinerPayouts {
+			info := infos[j]
+			if info.Size != len(encoding.Marshal(mp)) || !info.Fee.IsZero() {
+				t.Errorf("block %d, payout %d: got %+v", i, j, info)
+			}
+		}
+		for j, tx := range block.Transactions {
+			info := infos[len(block.MinerPayouts)+j]
+			fee := types.NewCurrency64(0)
+			for _, f := range tx.MinerFees {
+				fee = fee.Add(f)
+			}
+			if info.Size != len(encoding.Marshal(tx)) || info.Fee.Cmp(fee) != 0 {
+				t.Errorf("block %d, tx %d: got %+v", i, j, info)
+			}
+			if want := (ItemID{Height: i, Type: ITEM_TRANSACTION, Index: j}).String(); info.ID != want {
+				t.Errorf("block %d, tx %d: got ID %s, want %s", i, j, info.ID, want)
+			}
+		}
+	}
+	if _, err := s.GetItemInfo(s.NumItems()); err != ErrTooLargeIndex {
+		t.Errorf("GetItemInfo(NumItems()): want ErrTooLargeIndex, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+)
+
+// Several Servers, also in different processes, can serve one directory.
+// Files are mmaped read-only (PROT_READ, MAP_SHARED), so the processes
+// share the page cache. Builder never modifies files in place: it appends
+// to files of blocks data and replaces the files of the address index by
+// renaming new files over them (see newSuffix), so the mmaps of running
+// Servers stay valid while the directory is updated. However a Server
+// must not be opened while Builder is writing, since the files are not
+// consistent with each other then. This is coordinated with flock(2) on
+// the lock file: Builder holds an exclusive lock until Close, and
+// NewServer takes a shared lock while it opens the files.
+
+// lockFile is the name of the lock file in the directory.
+const lockFile = "lock"
+
+var ErrLocked = fmt.Errorf("Directory is locked by another Builder")
+
+// lockDir locks the directory. Exclusive locks fail with ErrLocked if
+// the directory is locked, shared locks wait for the exclusive lock.
+// If the lock file can not be created in a read-only directory,
+// a shared lock is not needed and lockDir returns nil. A shared lock
+// creates the lock file only if it is absent, so a Server does not try
+// to write to a directory on a read-only file system (e.g. an immutable
+// container image), where no Builder can run anyway.
+func lockDir(dir string, exclusive bool) (*os.File, error) {
+	name := path.Join(dir, lockFile)
+	var f *os.File
+	var err error
+	if !exclusive {
+		f, err = os.Open(name)
+	}
+	if exclusive || os.IsNotExist(err) {
+		f, err = os.OpenFile(name, os.O_RDONLY|os.O_CREATE, 0644)
+	}
+	if err != nil {
+		if !exclusive && isReadOnly(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := flock(f, exclusive); err != nil {
+		f.Close()
+		if !exclusive && isReadOnly(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// isReadOnly returns if the error means that the directory can not be
+// written or locked, as on read-only mounts. Read-only network mounts
+// often do not support locks (ENOLCK).
+func isReadOnly(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	return err == syscall.EROFS || err == syscall.EACCES || err == syscall.ENOLCK
+}
+
+// unlockDir releases the lock taken by lockDir.
+func unlockDir(f *os.File) error {
+	if f == nil {
+		return nil
+	}
+	return f.Close()
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLockDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLockDir")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// A lock file created by NewServer does not prevent building.
+	if _, err := NewServer(dir); err == nil {
+		t.Fatalf("NewServer opened an empty directory")
+	}
+	p := Parameters{
+		OffsetLen:               8,
+		OffsetIndexLen:          4,
+		AddressPageLen:          4096,
+		AddressPrefixLen:        32,
+		AddressFastmapPrefixLen: 5,
+		AddressOffsetLen:        4,
+	}
+	b, err := NewBuilderFromParameters(dir, 1024*1024, p)
+	if err != nil {
+		t.Fatalf("NewBuilderFromParameters: %v", err)
+	}
+	if _, err := OpenBuilder(dir, 1024*1024); err != ErrLocked {
+		t.Errorf("OpenBuilder returned %v while another Builder is open, want ErrLocked", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("b.Close: %v", err)
+	}
+	lock, err := lockDir(dir, true)
+	if err != nil {
+		t.Fatalf("lockDir after Close: %v", err)
+	}
+	if err := unlockDir(lock); err != nil {
+		t.Errorf("unlockDir: %v", err)
+	}
+}
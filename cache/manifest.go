@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// Builds are reproducible: building the same blocks with the same
+// parameters yields byte-identical files, whatever memLimit is (emsort
+// is stable) and whether the builder writes to disk or to memory. The
+// only exception is build_report.json, which has timings. A publisher of
+// an index can publish a manifest with hashes of its files, so others
+// can rebuild the index and check that the result is the same.
+
+// ManifestFiles lists the files covered by IndexManifest.
+var ManifestFiles = append([]string{"parameters.json"}, reportedFiles...)
+
+// IndexManifest maps names of files of an index to hex SHA256 hashes.
+type IndexManifest struct {
+	Files map[string]string
+}
+
+// ErrManifestMismatch is returned by VerifyManifest if hashes differ.
+var ErrManifestMismatch = fmt.Errorf("Files do not match the manifest")
+
+// ComputeManifest hashes the files of the index in dir.
+func ComputeManifest(dir string) (*IndexManifest, error) {
+	m := &IndexManifest{Files: make(map[string]string)}
+	for _, name := range ManifestFiles {
+		f, err := os.Open(path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("os.Open: %v", err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", name, err)
+		}
+		m.Files[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return m, nil
+}
+
+// ComputeMemoryManifest hashes the files returned by Builder.MemoryFiles.
+func ComputeMemoryManifest(files map[string][]byte) (*IndexManifest, error) {
+	m := &IndexManifest{Files: make(map[string]string)}
+	for _, name := range ManifestFiles {
+		data, has := files[name]
+		if !has {
+			return nil, fmt.Errorf("no file %s", name)
+		}
+		sum := sha256.Sum256(data)
+		m.Files[name] = hex.EncodeToString(sum[:])
+	}
+	return m, nil
+}
+
+// ReadManifest parses a manifest written by WriteManifest.
+func ReadManifest(r io.Reader) (*IndexManifest, error) {
+	m := &IndexManifest{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, fmt.Errorf("json.Decode: %v", err)
+	}
+	return m, nil
+}
+
+// WriteManifest writes the manifest as JSON.
+func WriteManifest(w io.Writer, m *IndexManifest) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	return e.Encode(m)
+}
+
+// Mismatches returns sorted names of files whose hashes differ in the
+// manifests or which are present in only one of them.
+func (m *IndexManifest) Mismatches(other *IndexManifest) []string {
+	var names []string
+	for name, hash := range m.Files {
+		if other.Files[name] != hash {
+			names = append(names, name)
+		}
+	}
+	for name := range other.Files {
+		if _, has := m.Files[name]; !has {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VerifyManifest hashes the files of the index in dir and compares them
+// with the published manifest. It returns names of mismatched files and
+// ErrManifestMismatch if there are any.
+func VerifyManifest(dir string, published *IndexManifest) ([]string, error) {
+	m, err := ComputeManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if mismatches := published.Mismatches(m); len(mismatches) != 0 {
+		return mismatches, ErrManifestMismatch
+	}
+	return nil, nil
+}
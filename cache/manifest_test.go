@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReproducibleBuild(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	buildInMemory := func(memLimit int) map[string][]byte {
+		b, err := NewMemoryBuilder(memLimit, 8, 4, 4096, 32, 5, 4)
+		if err != nil {
+			t.Fatalf("NewMemoryBuilder: %v", err)
+		}
+		for _, block := range blocks {
+			if err := b.Add(block); err != nil {
+				t.Fatalf("b.Add: %v", err)
+			}
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("b.Close: %v", err)
+		}
+		return b.MemoryFiles()
+	}
+	files1 := buildInMemory(1024 * 1024)
+	// Small memLimit makes emsort use many chunks.
+	files2 := buildInMemory(16 * 1024)
+	var report BuildReport
+	if err := json.Unmarshal(files2["build_report.json"], &report); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if report.EmsortChunks < 2 {
+		t.Errorf("EmsortChunks = %d, want many", report.EmsortChunks)
+	}
+	for _, name := range ManifestFiles {
+		if !bytes.Equal(files1[name], files2[name]) {
+			t.Errorf("file %s differs between builds", name)
+		}
+	}
+	published, err := ComputeMemoryManifest(files1)
+	if err != nil {
+		t.Fatalf("ComputeMemoryManifest: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestReproducibleBuild")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b, err := NewBuilder(dir, 64*1024, 8, 4, 4096, 32, 5, 4)
+	if err != nil {
+		t.Fatalf("NewBuilder: %v", err)
+	}
+	for _, block := range blocks {
+		if err := b.Add(block); err != nil {
+			t.Fatalf("b.Add: %v", err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("b.Close: %v", err)
+	}
+	if mismatches, err := VerifyManifest(dir, published); err != nil {
+		t.Errorf("VerifyManifest: %v %v", mismatches, err)
+	}
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, published); err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	parsed, err := ReadManifest(&buf)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, published) {
+		t.Errorf("ReadManifest(WriteManifest(m)) != m")
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "headers"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("os.OpenFile: %v", err)
+	}
+	if _, err := f.WriteAt([]byte{0xFF}, 0); err != nil {
+		t.Fatalf("f.WriteAt: %v", err)
+	}
+	f.Close()
+	mismatches, err := VerifyManifest(dir, published)
+	if err != ErrManifestMismatch || !reflect.DeepEqual(mismatches, []string{"headers"}) {
+		t.Errorf("VerifyManifest of modified index: %v, %v", mismatches, err)
+	}
+}
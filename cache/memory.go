@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// builderFile is a file written by Builder. *os.File implements it.
+type builderFile interface {
+	io.Writer
+	io.ReaderAt
+	io.Closer
+}
+
+// builderFS is where Builder writes its files.
+type builderFS interface {
+	// open opens a file of blocks data. See OpenBuilder.
+	open(name string) (builderFile, error)
+	create(name string) (builderFile, error)
+	rename(oldname, newname string) error
+	remove(name string) error
+	size(name string) (int64, error)
+	// dropCache writes the file to disk and drops it from page cache.
+	dropCache(name string) error
+	// sync writes the file to disk (see Builder.Checkpoint).
+	sync(name string) error
+}
+
+// osFS stores files in the file system.
+type osFS struct {
+	openFile func(name string) (*os.File, error)
+}
+
+func (f osFS) open(name string) (builderFile, error) {
+	return f.openFile(name)
+}
+
+func (osFS) create(name string) (builderFile, error) {
+	return os.Create(name)
+}
+
+func (osFS) rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (osFS) remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) size(name string) (int64, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (osFS) sync(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func (osFS) dropCache(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Dirty pages are not dropped, so write them first.
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return fadviseDontNeed(f.Fd())
+}
+
+type memFile struct {
+	data []byte
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.data = append(f.data, p...)
+	return len(p), nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// memFS stores files in memory.
+type memFS map[string]*memFile
+
+func (m memFS) open(name string) (builderFile, error) {
+	return m.create(name)
+}
+
+func (m memFS) create(name string) (builderFile, error) {
+	f := &memFile{}
+	m[name] = f
+	return f, nil
+}
+
+func (m memFS) rename(oldname, newname string) error {
+	f, has := m[oldname]
+	if !has {
+		return fmt.Errorf("no file %q", oldname)
+	}
+	delete(m, oldname)
+	m[newname] = f
+	return nil
+}
+
+func (m memFS) remove(name string) error {
+	if _, has := m[name]; !has {
+		return fmt.Errorf("no file %q", name)
+	}
+	delete(m, name)
+	return nil
+}
+
+func (m memFS) size(name string) (int64, error) {
+	f, has := m[name]
+	if !has {
+		return 0, fmt.Errorf("no file %q", name)
+	}
+	return int64(len(f.data)), nil
+}
+
+func (m memFS) dropCache(name string) error {
+	return nil
+}
+
+func (m memFS) sync(name string) error {
+	return nil
+}
+
+// NewMemoryBuilder is like NewBuilder, but the files are kept in memory.
+// After Close, pass MemoryFiles() to NewServerFromBytes.
+func NewMemoryBuilder(memLimit, offsetLen, offsetIndexLen, addressPageLen, addressPrefixLen, addressFastmapPrefixLen, addressOffsetLen int) (*Builder, error) {
+	p := Parameters{
+		OffsetLen:               offsetLen,
+		OffsetIndexLen:          offsetIndexLen,
+		AddressPageLen:          addressPageLen,
+		AddressPrefixLen:        addressPrefixLen,
+		AddressFastmapPrefixLen: addressFastmapPrefixLen,
+		AddressOffsetLen:        addressOffsetLen,
+	}
+	return NewMemoryBuilderFromParameters(memLimit, p)
+}
+
+// NewMemoryBuilderFromParameters is like NewMemoryBuilder, but takes
+// Parameters.
+func NewMemoryBuilderFromParameters(memLimit int, p Parameters) (*Builder, error) {
+	return createBuilder("", memLimit, p, make(memFS))
+}
+
+// MemoryFiles returns the files written by the builder created with
+// NewMemoryBuilder or nil for other builders.
+func (s *Builder) MemoryFiles() map[string][]byte {
+	fs := s.fs
+	if t, ok := fs.(throttledFS); ok {
+		fs = t.builderFS
+	}
+	m, ok := fs.(memFS)
+	if !ok {
+		return nil
+	}
+	files := make(map[string][]byte, len(m))
+	for name, f := range m {
+		files[name] = f.data
+	}
+	return files
+}
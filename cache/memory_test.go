@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryBuilder(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestMemoryBuilder")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b1, err := NewBuilder(dir, 1024*1024, 8, 4, 4096, 16, 5, 4)
+	if err != nil {
+		t.Fatalf("NewBuilder: %v", err)
+	}
+	b2, err := NewMemoryBuilder(1024*1024, 8, 4, 4096, 16, 5, 4)
+	if err != nil {
+		t.Fatalf("NewMemoryBuilder: %v", err)
+	}
+	for _, b := range []*Builder{b1, b2} {
+		for _, block := range blocks {
+			if err := b.Add(block); err != nil {
+				t.Fatalf("b.Add: %v", err)
+			}
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("b.Close: %v", err)
+		}
+	}
+	files := b2.MemoryFiles()
+	for _, name := range serverFiles() {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		if !bytes.Equal(data, files[name]) {
+			t.Errorf("file %s differs in memory", name)
+		}
+	}
+	s, err := NewServerFromBytes(files)
+	if err != nil {
+		t.Fatalf("NewServerFromBytes: %v", err)
+	}
+	if s.NumBlocks() != len(blocks) {
+		t.Errorf("NumBlocks() = %d, want %d", s.NumBlocks(), len(blocks))
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("s.Close: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build js
+// +build js
+
+package cache
+
+import (
+	"io"
+	"os"
+)
+
+// There is no mmap in browsers, so files are read into memory. Clients
+// built for js/wasm only need the verification and decoding code.
+
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(f, 0, int64(size)), buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func munmap(buf []byte) error {
+	return nil
+}
+
+// flock does nothing: there is no other process to lock out.
+func flock(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func madviseWillNeed(buf []byte) error {
+	return nil
+}
+
+func madviseDontNeed(buf []byte) error {
+	return nil
+}
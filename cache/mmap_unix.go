@@ -0,0 +1,44 @@
+//go:build !js
+// +build !js
+
+package cache
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps size bytes of the file read-only.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(buf []byte) error {
+	return syscall.Munmap(buf)
+}
+
+// flock takes the lock of lockDir.
+func flock(f *os.File, exclusive bool) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX | syscall.LOCK_NB
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return ErrLocked
+		}
+		return os.NewSyscallError("flock", err)
+	}
+	return nil
+}
+
+// madviseWillNeed asks the kernel to read the pages of buf.
+func madviseWillNeed(buf []byte) error {
+	return syscall.Madvise(buf, syscall.MADV_WILLNEED)
+}
+
+// madviseDontNeed drops the pages of buf from the memory of the process.
+// Pages of a file mapping are read again on next access.
+func madviseDontNeed(buf []byte) error {
+	return syscall.Madvise(buf, syscall.MADV_DONTNEED)
+}
@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"math/bits"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// The headers MMR (Merkle Mountain Range) commits to the IDs of the
+// blocks of the index, so a client knowing only the root and the
+// number of blocks can check that a block is an ancestor of the last
+// block (see ProveHeader).
+//
+// Leaf is H(0x00 || blockID), node is H(0x01 || left || right). The MMR
+// is a list of perfect trees (mountains) of decreasing heights, one per
+// bit of the number of leaves. The root is H(0x01 || peak0 || H(0x01 ||
+// peak1 || ... peakN)). File headersMMR has nodes of the mountains in
+// post-order, so it is only appended to when blocks are added.
+
+// mmrSize returns the number of nodes of the MMR with n leaves.
+func mmrSize(n int) int {
+	return 2*n - bits.OnesCount(uint(n))
+}
+
+// mmrMountains returns the heights of the mountains of the MMR with
+// n leaves from left to right.
+func mmrMountains(n int) []int {
+	var heights []int
+	for k := bits.Len(uint(n)) - 1; k >= 0; k-- {
+		if n&(1<<uint(k)) != 0 {
+			heights = append(heights, k)
+		}
+	}
+	return heights
+}
+
+type mmrPeak struct {
+	height int
+	sum    crypto.Hash
+}
+
+type mmrWriter struct {
+	h     hash.Hash
+	sum   []byte
+	file  builderFile
+	buf   *bufio.Writer
+	peaks []mmrPeak
+}
+
+func newMMRWriter(h hash.Hash, file builderFile) *mmrWriter {
+	return &mmrWriter{
+		h:    h,
+		file: file,
+		buf:  bufio.NewWriter(file),
+	}
+}
+
+func (w *mmrWriter) write(sum []byte) error {
+	if _, err := w.buf.Write(sum); err != nil {
+		return err
+	}
+	return nil
+}
+
+// add appends the leaf of the block and merges mountains of equal height.
+func (w *mmrWriter) add(id types.BlockID) error {
+	w.h.Reset()
+	_, _ = w.h.Write([]byte{0x00})
+	_, _ = w.h.Write(id[:])
+	w.sum = w.h.Sum(w.sum[:0])
+	if err := w.write(w.sum); err != nil {
+		return err
+	}
+	peak := mmrPeak{}
+	copy(peak.sum[:], w.sum)
+	for len(w.peaks) != 0 && w.peaks[len(w.peaks)-1].height == peak.height {
+		left := w.peaks[len(w.peaks)-1]
+		w.peaks = w.peaks[:len(w.peaks)-1]
+		w.sum = hashNode(w.h, w.sum[:0], left.sum[:], peak.sum[:])
+		if err := w.write(w.sum); err != nil {
+			return err
+		}
+		peak.height++
+		copy(peak.sum[:], w.sum)
+	}
+	w.peaks = append(w.peaks, peak)
+	return nil
+}
+
+func (w *mmrWriter) flush() error {
+	return w.buf.Flush()
+}
+
+func (w *mmrWriter) close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *mmrWriter) root() crypto.Hash {
+	var peaks []crypto.Hash
+	for _, p := range w.peaks {
+		peaks = append(peaks, p.sum)
+	}
+	return bagPeaks(w.h, peaks)
+}
+
+// mmrPeaks returns the peaks of the MMR with n leaves from its nodes.
+func mmrPeaks(nodes []byte, n int) []mmrPeak {
+	var peaks []mmrPeak
+	start := 0
+	for _, k := range mmrMountains(n) {
+		start += 1<<uint(k+1) - 1
+		peak := mmrPeak{height: k}
+		copy(peak.sum[:], nodes[(start-1)*crypto.HashSize:start*crypto.HashSize])
+		peaks = append(peaks, peak)
+	}
+	return peaks
+}
+
+// bagPeaks returns the root of the MMR given its peaks.
+func bagPeaks(h hash.Hash, peaks []crypto.Hash) crypto.Hash {
+	var root crypto.Hash
+	if len(peaks) == 0 {
+		return root
+	}
+	root = peaks[len(peaks)-1]
+	for i := len(peaks) - 2; i >= 0; i-- {
+		hashNode(h, root[:0], peaks[i][:], root[:])
+	}
+	return root
+}
+
+// HeadersMMRRoot returns the root of the headers MMR. It is zero if
+// the index has no blocks.
+func (s *Server) HeadersMMRRoot() crypto.Hash {
+	w := mmrWriter{
+		h:     s.leafHash(),
+		peaks: mmrPeaks(s.HeadersMMR, s.nblocks),
+	}
+	return w.root()
+}
+
+// HeaderProof proves that the block is the block with given index of
+// the index with NumBlocks blocks, i.e. the block is an ancestor of the
+// last block of the index.
+type HeaderProof struct {
+	BlockIndex int
+	NumBlocks  int
+	BlockID    types.BlockID
+
+	// Proof has siblings in the mountain of the block from the bottom,
+	// then peaks of other mountains from left to right.
+	Proof []byte
+}
+
+// ProveHeader returns the proof of the block with given index against
+// HeadersMMRRoot.
+func (s *Server) ProveHeader(blockIndex int) (*HeaderProof, error) {
+	if blockIndex < 0 || blockIndex >= s.nblocks {
+		return nil, fmt.Errorf("no block %d", blockIndex)
+	}
+	ids, err := s.blockIDs()
+	if err != nil {
+		return nil, err
+	}
+	p := &HeaderProof{
+		BlockIndex: blockIndex,
+		NumBlocks:  s.nblocks,
+		BlockID:    ids[blockIndex],
+	}
+	p.Proof = mmrProof(s.HeadersMMR, s.nblocks, blockIndex)
+	return p, nil
+}
+
+// mmrProof returns the proof of the leaf of the MMR with n leaves
+// given its nodes. See HeaderProof.Proof.
+func mmrProof(nodes []byte, n, leaf int) []byte {
+	node := func(pos int) []byte {
+		return nodes[pos*crypto.HashSize : (pos+1)*crypto.HashSize]
+	}
+	var proof []byte
+	var peaks [][]byte
+	leafStart, nodeStart := 0, 0
+	for _, k := range mmrMountains(n) {
+		size := 1<<uint(k+1) - 1
+		if leaf < leafStart || leaf >= leafStart+1<<uint(k) {
+			peaks = append(peaks, node(nodeStart+size-1))
+			leafStart += 1 << uint(k)
+			nodeStart += size
+			continue
+		}
+		// Descend from the peak to the leaf.
+		var siblings [][]byte
+		base, first := nodeStart, leafStart
+		for h := k; h > 0; h-- {
+			half := 1 << uint(h-1)
+			leftSize := 1<<uint(h) - 1
+			if leaf < first+half {
+				siblings = append(siblings, node(base+2*leftSize-1))
+			} else {
+				siblings = append(siblings, node(base+leftSize-1))
+				base += leftSize
+				first += half
+			}
+		}
+		for i := len(siblings) - 1; i >= 0; i-- {
+			proof = append(proof, siblings[i]...)
+		}
+		leafStart += 1 << uint(k)
+		nodeStart += size
+	}
+	for _, peak := range peaks {
+		proof = append(proof, peak...)
+	}
+	return proof
+}
+
+// VerifyHeaderProof checks the proof against the root of the headers
+// MMR. h is the hash of the index (see Parameters.LeafHash).
+func VerifyHeaderProof(h hash.Hash, p *HeaderProof, root crypto.Hash) bool {
+	if p.BlockIndex < 0 || p.BlockIndex >= p.NumBlocks || len(p.Proof)%crypto.HashSize != 0 {
+		return false
+	}
+	mountains := mmrMountains(p.NumBlocks)
+	mountain, leafStart := 0, 0
+	for ; p.BlockIndex >= leafStart+1<<uint(mountains[mountain]); mountain++ {
+		leafStart += 1 << uint(mountains[mountain])
+	}
+	k := mountains[mountain]
+	if len(p.Proof) != (k+len(mountains)-1)*crypto.HashSize {
+		return false
+	}
+	proofHash := func(i int) []byte {
+		return p.Proof[i*crypto.HashSize : (i+1)*crypto.HashSize]
+	}
+	h.Reset()
+	_, _ = h.Write([]byte{0x00})
+	_, _ = h.Write(p.BlockID[:])
+	var sum crypto.Hash
+	h.Sum(sum[:0])
+	pos := p.BlockIndex - leafStart
+	for i := 0; i < k; i++ {
+		if pos&(1<<uint(i)) == 0 {
+			hashNode(h, sum[:0], sum[:], proofHash(i))
+		} else {
+			hashNode(h, sum[:0], proofHash(i), sum[:])
+		}
+	}
+	var peaks []crypto.Hash
+	for i := range mountains {
+		var peak crypto.Hash
+		switch {
+		case i < mountain:
+			copy(peak[:], proofHash(k+i))
+		case i == mountain:
+			peak = sum
+		default:
+			copy(peak[:], proofHash(k+i-1))
+		}
+		peaks = append(peaks, peak)
+	}
+	return bagPeaks(h, peaks) == root
+}
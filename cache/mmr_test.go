@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestHeadersMMR(t *testing.T) {
+	for n := 1; n <= 40; n++ {
+		f := &memFile{}
+		w := newMMRWriter(crypto.NewHash(), f)
+		var ids []types.BlockID
+		for i := 0; i < n; i++ {
+			id := types.BlockID(sha256.Sum256([]byte{byte(i)}))
+			ids = append(ids, id)
+			if err := w.add(id); err != nil {
+				t.Fatalf("add: %v", err)
+			}
+		}
+		if err := w.close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if len(f.data) != mmrSize(n)*crypto.HashSize {
+			t.Fatalf("n=%d: MMR has %d nodes, want %d", n, len(f.data)/crypto.HashSize, mmrSize(n))
+		}
+		var peaks []crypto.Hash
+		for i, p := range mmrPeaks(f.data, n) {
+			if p != w.peaks[i] {
+				t.Errorf("n=%d: peak %d differs from the peak of the writer", n, i)
+			}
+			peaks = append(peaks, p.sum)
+		}
+		root := bagPeaks(crypto.NewHash(), peaks)
+		for leaf := 0; leaf < n; leaf++ {
+			p := &HeaderProof{
+				BlockIndex: leaf,
+				NumBlocks:  n,
+				BlockID:    ids[leaf],
+				Proof:      mmrProof(f.data, n, leaf),
+			}
+			if !VerifyHeaderProof(crypto.NewHash(), p, root) {
+				t.Errorf("n=%d: proof of %d is not valid", n, leaf)
+			}
+			p.BlockID = ids[(leaf+1)%n]
+			if n > 1 && VerifyHeaderProof(crypto.NewHash(), p, root) {
+				t.Errorf("n=%d: proof of %d is valid for another block", n, leaf)
+			}
+		}
+	}
+}
+
+func TestProveHeader(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	root := s.HeadersMMRRoot()
+	for blockIndex := 0; blockIndex < len(blocks); blockIndex += 37 {
+		p, err := s.ProveHeader(blockIndex)
+		if err != nil {
+			t.Fatalf("ProveHeader(%d): %v", blockIndex, err)
+		}
+		if p.BlockID != blocks[blockIndex].ID() {
+			t.Errorf("ProveHeader(%d) returned block %s", blockIndex, p.BlockID)
+		}
+		if !VerifyHeaderProof(crypto.NewHash(), p, root) {
+			t.Errorf("proof of block %d is not valid", blockIndex)
+		}
+	}
+	if _, err := s.ProveHeader(len(blocks)); err == nil {
+		t.Errorf("ProveHeader succeeded for a missing block")
+	}
+}
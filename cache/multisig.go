@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// File multisigKeys has the format of publicKeys: sorted unique records
+// of ed25519 public key and the unlock hash of multi-signature unlock
+// conditions with the key seen in inputs. It lets co-signers find their
+// shared wallets. The file is empty unless Parameters.MultisigKeys is set.
+
+// Multisig is the m-of-n structure of unlock conditions.
+type Multisig struct {
+	Required   int
+	PublicKeys []types.SiaPublicKey
+	Timelock   types.BlockHeight
+}
+
+// MultisigOf returns the structure of the unlock conditions if they
+// are not single-signature (see singleKey) or nil otherwise.
+func MultisigOf(uc *types.UnlockConditions) *Multisig {
+	if len(uc.PublicKeys) <= 1 && uc.SignaturesRequired <= 1 {
+		return nil
+	}
+	return &Multisig{
+		Required:   int(uc.SignaturesRequired),
+		PublicKeys: uc.PublicKeys,
+		Timelock:   uc.Timelock,
+	}
+}
+
+func (s *Builder) writeMultisigKeys(tx *types.Transaction) error {
+	if !s.withMultisigKeys {
+		return nil
+	}
+	write := func(uc *types.UnlockConditions) error {
+		if MultisigOf(uc) == nil {
+			return nil
+		}
+		uh := uc.UnlockHash()
+		for _, key := range uc.PublicKeys {
+			if key.Algorithm != types.SignatureEd25519 || len(key.Key) != crypto.PublicKeySize {
+				continue
+			}
+			copy(s.multisigKeyBuf, key.Key)
+			copy(s.multisigKeyBuf[crypto.PublicKeySize:], uh[:])
+			if n, err := s.multisigKeys.Write(s.multisigKeyBuf); err != nil {
+				return err
+			} else if n != publicKeyRecordSize {
+				return io.ErrShortWrite
+			}
+		}
+		return nil
+	}
+	for i := range tx.SiacoinInputs {
+		if err := write(&tx.SiacoinInputs[i].UnlockConditions); err != nil {
+			return err
+		}
+	}
+	for i := range tx.SiafundInputs {
+		if err := write(&tx.SiafundInputs[i].UnlockConditions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MultisigAddresses returns unlock hashes of multi-signature unlock
+// conditions with the key seen in inputs, sorted. It returns nothing
+// if the index was built without Parameters.MultisigKeys.
+func (s *Server) MultisigAddresses(pk crypto.PublicKey) []types.UnlockHash {
+	n := len(s.MultisigKeys) / publicKeyRecordSize
+	first := sort.Search(n, func(i int) bool {
+		key := s.MultisigKeys[i*publicKeyRecordSize : i*publicKeyRecordSize+crypto.PublicKeySize]
+		return bytes.Compare(key, pk[:]) >= 0
+	})
+	var addresses []types.UnlockHash
+	for i := first; i < n; i++ {
+		record := s.MultisigKeys[i*publicKeyRecordSize : (i+1)*publicKeyRecordSize]
+		if !bytes.Equal(record[:crypto.PublicKeySize], pk[:]) {
+			break
+		}
+		var uh types.UnlockHash
+		copy(uh[:], record[crypto.PublicKeySize:])
+		addresses = append(addresses, uh)
+	}
+	return addresses
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestMultisigKeys(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	pk1 := crypto.PublicKey{1}
+	pk2 := crypto.PublicKey{2}
+	pk3 := crypto.PublicKey{3}
+	multi := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(pk1), types.Ed25519PublicKey(pk2)},
+		SignaturesRequired: 2,
+	}
+	single := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(pk3)},
+		SignaturesRequired: 1,
+	}
+	tx := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: types.SiacoinOutputID{1}, UnlockConditions: multi},
+			{ParentID: types.SiacoinOutputID{2}, UnlockConditions: single},
+		},
+	}
+	block := &types.Block{
+		ParentID:     blocks[0].ID(),
+		Timestamp:    types.Timestamp(1433600001),
+		Transactions: []types.Transaction{tx},
+	}
+	p := testParameters()
+	p.MultisigKeys = true
+	s := buildTestServer(t, p, []*types.Block{blocks[0], block})
+	for _, pk := range []crypto.PublicKey{pk1, pk2} {
+		got := s.MultisigAddresses(pk)
+		if len(got) != 1 || got[0] != multi.UnlockHash() {
+			t.Errorf("MultisigAddresses(%x) = %v, want [%s]", pk[:1], got, multi.UnlockHash())
+		}
+	}
+	if got := s.MultisigAddresses(pk3); len(got) != 0 {
+		t.Errorf("MultisigAddresses returned addresses of a single-key input: %v", got)
+	}
+	inputs := TransactionInputs(&tx)
+	if m := inputs[0].Multisig; m == nil || m.Required != 2 || len(m.PublicKeys) != 2 {
+		t.Errorf("TransactionInputs returned multisig %v, want 2 of 2", m)
+	}
+	if inputs[1].Multisig != nil {
+		t.Errorf("TransactionInputs returned multisig of a single-key input")
+	}
+	page, err := (&Tiered{Cold: s}).GetHistoryOfAddressesPage(s.MultisigAddresses(pk1), "", 10)
+	if err != nil {
+		t.Fatalf("GetHistoryOfAddressesPage: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Block != 1 {
+		t.Errorf("GetHistoryOfAddressesPage returned %d items, want the item of block 1", len(page.Items))
+	}
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Lists of items (history of an address, activity of a host, search
+// of ArbitraryData) are returned by pages. The cursor of a page is the
+// text form of ItemID of its first item, which is stable across rebuilds
+// of the index and is valid in Tiered as well. The first page has empty
+// cursor; the cursor of the next page is empty after the last page.
+
+var ErrBadCursor = fmt.Errorf("Bad cursor")
+
+// ItemPage is a page of a list of items.
+type ItemPage struct {
+	Items []Item
+
+	// Next is the cursor of the next page or "" after the last page.
+	Next string
+
+	// Total is the number of items of the list or -1 if it is not
+	// known without reading the items.
+	Total int
+}
+
+// cursorLess returns if the cursor a is before the cursor b in the
+// order of the blockchain. Both cursors must be valid.
+func cursorLess(a, b string) bool {
+	idA, _ := ParseItemID(a)
+	idB, _ := ParseItemID(b)
+	if idA.Height != idB.Height {
+		return idA.Height < idB.Height
+	}
+	if idA.Type != idB.Type {
+		// Miner payouts go before transactions.
+		return idA.Type == ITEM_MINER_PAYOUT
+	}
+	return idA.Index < idB.Index
+}
+
+// pageStart returns the position in sorted itemIndices of the item with
+// ID start.
+func (s *Server) pageStart(itemIndices []int, start string) (int, error) {
+	if start == "" {
+		return 0, nil
+	}
+	id, err := ParseItemID(start)
+	if err != nil {
+		return 0, ErrBadCursor
+	}
+	itemIndex, err := s.ItemIndex(id)
+	if err != nil {
+		return 0, ErrBadCursor
+	}
+	return sort.SearchInts(itemIndices, itemIndex), nil
+}
+
+// pageItems reads items with item indices from sorted itemIndices
+// starting from the cursor start until limit items are accepted by
+// fill, which may also fill fields of the item. It returns the position
+// in itemIndices of the first item of the next page.
+func (s *Server) pageItems(ctx context.Context, itemIndices []int, start string, limit int, fill func(item *Item) (bool, error)) ([]Item, int, error) {
+	pos, err := s.pageStart(itemIndices, start)
+	if err != nil {
+		return nil, 0, err
+	}
+	var items []Item
+	for ; pos < len(itemIndices) && len(items) < limit; pos++ {
+		item, err := s.GetItemContext(ctx, itemIndices[pos])
+		if err != nil {
+			return nil, 0, err
+		}
+		item.Confirmations = s.nblocks - item.Block
+		if fill != nil {
+			if ok, err := fill(&item); err != nil {
+				return nil, 0, err
+			} else if !ok {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	return items, pos, nil
+}
+
+// cursorAt returns the cursor of the page starting at position pos of
+// itemIndices.
+func (s *Server) cursorAt(itemIndices []int, pos int) (string, error) {
+	if pos >= len(itemIndices) {
+		return "", nil
+	}
+	item, err := s.GetItemWithoutProof(itemIndices[pos])
+	if err != nil {
+		return "", err
+	}
+	return item.ID, nil
+}
+
+// pageTiered combines pages of both indices of Tiered. The cursor
+// selects the index to start from; the pages of Cold are followed by
+// the pages of Hot. Item.Block and Item.Confirmations of the result
+// refer to Tiered.
+func (t *Tiered) pageTiered(start string, limit int, page func(s *Server, start string, limit int) (ItemPage, error)) (ItemPage, error) {
+	if t.Hot == nil {
+		return page(t.Cold, start, limit)
+	}
+	inHot := false
+	if start != "" {
+		id, err := ParseItemID(start)
+		if err != nil {
+			return ItemPage{}, ErrBadCursor
+		}
+		s, _ := t.Layer(id.Height)
+		if s == nil {
+			return ItemPage{}, ErrBadCursor
+		}
+		inHot = s == t.Hot
+	}
+	var result ItemPage
+	hotStart := start
+	if !inHot {
+		cold, err := page(t.Cold, start, limit)
+		if err != nil {
+			return ItemPage{}, err
+		}
+		result = cold
+		hotBlocks := t.Hot.NumBlocks()
+		for i := range result.Items {
+			result.Items[i].Confirmations += hotBlocks
+		}
+		hotStart = ""
+	}
+	if !inHot && result.Next != "" {
+		// Only the total of Hot is needed.
+		hot, err := page(t.Hot, "", 0)
+		if err != nil {
+			return ItemPage{}, err
+		}
+		if result.Total >= 0 && hot.Total >= 0 {
+			result.Total += hot.Total
+		} else {
+			result.Total = -1
+		}
+		return result, nil
+	}
+	hot, err := page(t.Hot, hotStart, limit-len(result.Items))
+	if err != nil {
+		return ItemPage{}, err
+	}
+	for _, item := range hot.Items {
+		item.Block += t.Cold.NumBlocks()
+		result.Items = append(result.Items, item)
+	}
+	result.Next = hot.Next
+	if inHot {
+		// The cold part of the list is skipped; count it separately.
+		cold, err := page(t.Cold, "", 0)
+		if err != nil {
+			return ItemPage{}, err
+		}
+		result.Total = cold.Total
+	}
+	if result.Total >= 0 && hot.Total >= 0 {
+		result.Total += hot.Total
+	} else {
+		result.Total = -1
+	}
+	return result, nil
+}
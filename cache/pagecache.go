@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// dropInterval is the number of bytes appended to blockchain file
+// between drops of page cache of the files written by Builder.Add.
+const dropInterval = 256 * 1024 * 1024
+
+// growingFiles are the largest files written by Builder.Add.
+var growingFiles = []string{
+	"blockchain",
+	"offsets",
+	"leavesHashes",
+}
+
+// SetDropPageCache makes the builder write its files to disk and drop
+// them from page cache periodically and at Close (fadvise DONTNEED).
+// Otherwise large sequential writes of the build evict pages of files
+// mmaped by a Server running on the same machine. The build becomes
+// slower; see BuildReport.DropPageCacheDuration. O_DIRECT is not used,
+// since it requires aligned buffers.
+func (s *Builder) SetDropPageCache(drop bool) {
+	s.dropPageCache = drop
+	s.nextDrop = s.blockchainLen + dropInterval
+}
+
+func (s *Builder) dropCache(names []string) error {
+	started := time.Now()
+	defer func() {
+		s.dropTime += time.Since(started)
+	}()
+	for _, name := range names {
+		if err := s.fs.dropCache(path.Join(s.dir, name)); err != nil {
+			return fmt.Errorf("dropping page cache of %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+var pageSize = os.Getpagesize()
+
+// willNeed asks the kernel to read buf[start:end] of mmaped buf.
+func willNeed(buf []byte, start, end int) {
+	if start >= end {
+		return
+	}
+	// buf starts at a page boundary, since it is mmaped.
+	start &^= pageSize - 1
+	// Errors are ignored, since prefetching is a hint.
+	_ = madviseWillNeed(buf[start:end])
+}
+
+// Prefetch asks the kernel to read the pages needed by GetItem for the
+// items, so a following GetItem does not wait for disk. Reading is
+// started in background by the kernel (MADV_WILLNEED), so Prefetch
+// returns quickly. It does nothing if the files are not mmaped.
+func (s *Server) Prefetch(itemIndexes []int) {
+	if !s.mmaped {
+		return
+	}
+	for _, itemIndex := range itemIndexes {
+		if itemIndex < 0 || itemIndex >= s.nitems {
+			continue
+		}
+		s.prefetchItem(itemIndex)
+	}
+}
+
+// ReleasePages drops the pages of the mmaped files of the index from the
+// memory of the process (MADV_DONTNEED), so a server with a memory limit
+// does not accumulate pages of rarely requested blocks. The pages stay
+// in page cache, where the kernel can reclaim them, and are mapped again
+// on next access. It does nothing if the files are not mmaped.
+func (s *Server) ReleasePages() error {
+	if !s.mmaped {
+		return nil
+	}
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Type != reflect.TypeOf([]byte{}) {
+			continue
+		}
+		// Files start at page boundaries, also in the combined file.
+		buf := v.Field(i).Bytes()
+		if len(buf) == 0 {
+			continue
+		}
+		if err := madviseDontNeed(buf); err != nil {
+			return fmt.Errorf("madvise(MADV_DONTNEED): %v", err)
+		}
+	}
+	return nil
+}
+
+// SetPrefetchHistory makes GetHistory prefetch items of the next page
+// of the history, since wallets usually request it right after the
+// current one. Must be called before the server is used.
+func (s *Server) SetPrefetchHistory(prefetch bool) {
+	s.prefetchHistory = prefetch
+}
+
+// prefetchNextPage prefetches up to MAX_HISTORY_SIZE items of
+// itemIndexes.
+func (s *Server) prefetchNextPage(itemIndexes []int) {
+	if len(itemIndexes) > MAX_HISTORY_SIZE {
+		itemIndexes = itemIndexes[:MAX_HISTORY_SIZE]
+	}
+	s.Prefetch(itemIndexes)
+}
+
+func (s *Server) prefetchItem(itemIndex int) {
+	// Offsets and BlockLocations are read synchronously here;
+	// the data and the leaves hashes used to build the Merkle
+	// proof are requested from the kernel.
+	item, err := s.GetItemWithoutProof(itemIndex)
+	if err != nil {
+		return
+	}
+	dataStart, dataEnd := s.getItemDataRange(itemIndex)
+	willNeed(s.Blockchain, dataStart, dataEnd)
+	payoutsStart := itemIndex - item.Index
+	hstart := payoutsStart * crypto.HashSize
+	willNeed(s.LeavesHashes, hstart, hstart+item.NumLeaves*crypto.HashSize)
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// The address index stores Parameters.AddressPrefixLen bytes of each
+// address, so the history of an address also has items of addresses
+// sharing the prefix with it. Item.Verified tells them apart; with
+// SetVerifyAddresses such items are skipped.
+
+// SetVerifyAddresses makes GetHistory skip items without the queried
+// address. ItemPage.Total of the history is then unknown (-1). Must be
+// called before the server is used.
+func (s *Server) SetVerifyAddresses(verify bool) {
+	s.verifyAddresses = verify
+}
+
+// itemHasAddress returns if the item has the address anywhere it is
+// indexed (see forEachAddress).
+func itemHasAddress(item Item, address types.UnlockHash) (bool, error) {
+	payout, tx, err := DecodeItem(item)
+	if err != nil {
+		return false, err
+	}
+	if payout != nil {
+		return payout.UnlockHash == address, nil
+	}
+	found := false
+	forEachAddress(tx, func(uh types.UnlockHash) error {
+		found = found || uh == address
+		return nil
+	})
+	return found, nil
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestVerifyAddresses(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	// Short prefixes, so addresses share them.
+	p := testParameters()
+	p.AddressPrefixLen, p.AddressFastmapPrefixLen = 2, 1
+	s := buildTestServer(t, p, blocks)
+	address := blocks[10].MinerPayouts[0].UnlockHash
+	readAll := func() (all []Item) {
+		start := ""
+		for {
+			page, err := s.GetHistoryPage(address[:], start, 10)
+			if err != nil {
+				t.Fatalf("GetHistoryPage: %v", err)
+			}
+			all = append(all, page.Items...)
+			if page.Next == "" {
+				return all
+			}
+			start = page.Next
+		}
+	}
+	all := readAll()
+	var verified []Item
+	for _, item := range all {
+		has, err := itemHasAddress(item, address)
+		if err != nil {
+			t.Fatalf("itemHasAddress: %v", err)
+		}
+		if item.Verified != has {
+			t.Errorf("item %s: Verified = %v, want %v", item.ID, item.Verified, has)
+		}
+		if has {
+			verified = append(verified, item)
+		}
+	}
+	if len(verified) == 0 || len(verified) == len(all) {
+		t.Fatalf("%d of %d items are verified, want some of them", len(verified), len(all))
+	}
+	s.SetVerifyAddresses(true)
+	got := readAll()
+	if len(got) != len(verified) {
+		t.Fatalf("got %d items with verification, want %d", len(got), len(verified))
+	}
+	for i, item := range got {
+		if item.ID != verified[i].ID || !item.Verified {
+			t.Errorf("item %d: got %s (verified %v), want %s", i, item.ID, item.Verified, verified[i].ID)
+		}
+	}
+}
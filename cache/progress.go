@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// BlockStats describes a block added by Builder.Add. See SetOnProgress.
+type BlockStats struct {
+	Height int
+	ID     types.BlockID
+
+	// Items is the number of miner payouts and transactions.
+	Items        int
+	Transactions int
+
+	// Bytes is the number of bytes appended to blockchain file.
+	Bytes int
+
+	// Addresses is the number of records written to the address index.
+	// Blocks with many addresses make the address index grow fast.
+	Addresses int
+
+	// Duration is the time spent in Add.
+	Duration time.Duration
+}
+
+// SetOnProgress sets the function called after each block added by Add,
+// e.g. to display progress or to detect spam blocks. It is called in
+// the goroutine calling Add; nil disables it.
+func (s *Builder) SetOnProgress(f func(BlockStats)) {
+	s.onProgress = f
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestOnProgress(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	b, err := NewMemoryBuilder(1024*1024, 8, 4, 4096, 32, 5, 4)
+	if err != nil {
+		t.Fatalf("NewMemoryBuilder: %v", err)
+	}
+	var stats []BlockStats
+	b.SetOnProgress(func(st BlockStats) {
+		stats = append(stats, st)
+	})
+	if err := b.Add(blocks[0]); err != nil {
+		t.Fatalf("b.Add: %v", err)
+	}
+	block := &types.Block{
+		ParentID:  blocks[0].ID(),
+		Timestamp: types.Timestamp(1433600000 + 1),
+		Transactions: []types.Transaction{{
+			SiacoinOutputs: []types.SiacoinOutput{
+				{UnlockHash: types.UnlockHash{1}},
+				{UnlockHash: types.UnlockHash{2}},
+			},
+		}},
+	}
+	if err := b.Add(block); err != nil {
+		t.Fatalf("b.Add: %v", err)
+	}
+	// Known blocks are skipped and not reported.
+	if err := b.Add(block); err != nil {
+		t.Fatalf("b.Add: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("b.Close: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("OnProgress was called %d times, want 2", len(stats))
+	}
+	st := stats[1]
+	if st.Height != 1 || st.ID != block.ID() || st.Items != 1 || st.Transactions != 1 || st.Addresses != 2 || st.Bytes == 0 {
+		t.Errorf("got stats %+v", st)
+	}
+	if stats[0].Height != 0 || stats[0].Items != len(blocks[0].MinerPayouts)+len(blocks[0].Transactions) {
+		t.Errorf("got stats of genesis block %+v", stats[0])
+	}
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"hash"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// proofBuilder builds Merkle proofs of items from hashes of leaves.
+// The proofs are the same as built by merkletree.CachedTree, but only
+// subtrees which are needed are hashed, the hash function is reused
+// and the memory used is O(log(leaves)). Builders are reused through
+// Server.proofBuilders.
+type proofBuilder struct {
+	h hash.Hash
+
+	// stack has roots of subtrees being merged by root.
+	stack []byte
+}
+
+// root returns the Merkle root of leaves (concatenated hashes), the
+// number of which must be a power of 2. The result is valid until
+// the next call.
+func (b *proofBuilder) root(leaves []byte) []byte {
+	n := len(leaves) / crypto.HashSize
+	if n == 1 {
+		return leaves
+	}
+	b.stack = b.stack[:0]
+	for i := 0; i < n; i++ {
+		b.stack = append(b.stack, leaves[i*crypto.HashSize:(i+1)*crypto.HashSize]...)
+		// Merge pairs of subtrees of equal size.
+		for j := i + 1; j&1 == 0; j >>= 1 {
+			top := len(b.stack) - 2*crypto.HashSize
+			b.stack = hashNode(b.h, b.stack[:top], b.stack[top:top+crypto.HashSize], b.stack[top+crypto.HashSize:])
+		}
+	}
+	return b.stack
+}
+
+// prove returns the Merkle proof of the leaf with given index.
+// The tree consists of perfect subtrees of decreasing sizes (powers
+// of 2 in the number of leaves). The proof has siblings in the subtree
+// of the leaf from the bottom, then the root of the subtrees to the
+// right of it (they are merged together first) and roots of subtrees
+// to the left of it, from the nearest one.
+func (b *proofBuilder) prove(leaves []byte, index int) []byte {
+	n := len(leaves) / crypto.HashSize
+	// Find the subtree of the leaf and the subtrees around it.
+	var leftStarts, leftSizes, rightSizes []int
+	start, size := 0, 0
+	for s := highestPowerOf2(n); s > 0; s >>= 1 {
+		if n&s == 0 {
+			continue
+		}
+		switch {
+		case size != 0:
+			rightSizes = append(rightSizes, s)
+		case index < start+s:
+			size = s
+		default:
+			leftStarts = append(leftStarts, start)
+			leftSizes = append(leftSizes, s)
+			start += s
+		}
+	}
+	nproof := len(leftStarts)
+	for s := 1; s < size; s <<= 1 {
+		nproof++
+	}
+	if len(rightSizes) != 0 {
+		nproof++
+	}
+	proof := make([]byte, 0, nproof*crypto.HashSize)
+	// Siblings in the subtree of the leaf.
+	for s := 1; s < size; s <<= 1 {
+		sibling := start + ((index-start)/s^1)*s
+		proof = append(proof, b.root(leaves[sibling*crypto.HashSize:(sibling+s)*crypto.HashSize])...)
+	}
+	// Subtrees to the right, merged from the last one.
+	if len(rightSizes) != 0 {
+		var merged [crypto.HashSize]byte
+		end := n
+		for i := len(rightSizes) - 1; i >= 0; i-- {
+			s := rightSizes[i]
+			r := b.root(leaves[(end-s)*crypto.HashSize : end*crypto.HashSize])
+			if end == n {
+				copy(merged[:], r)
+			} else {
+				hashNode(b.h, merged[:0], r, merged[:])
+			}
+			end -= s
+		}
+		proof = append(proof, merged[:]...)
+	}
+	// Subtrees to the left, from the nearest one.
+	for i := len(leftStarts) - 1; i >= 0; i-- {
+		first, end := leftStarts[i], leftStarts[i]+leftSizes[i]
+		proof = append(proof, b.root(leaves[first*crypto.HashSize:end*crypto.HashSize])...)
+	}
+	return proof
+}
+
+func highestPowerOf2(n int) int {
+	if n == 0 {
+		return 0
+	}
+	p := 1
+	for p*2 <= n {
+		p *= 2
+	}
+	return p
+}
+
+func (s *Server) getProofBuilder() *proofBuilder {
+	if b, ok := s.proofBuilders.Get().(*proofBuilder); ok {
+		return b
+	}
+	return &proofBuilder{h: s.leafHash()}
+}
+
+// SetMaxProofLeaves makes GetItem skip proofs of items of blocks with
+// more than maxLeaves leaves (0 = no limit). Building such a proof hashes
+// most of the leaves of the block, so a request for many items of huge
+// blocks takes long. The items are returned with empty MerkleProof, which
+// is not valid if NumLeaves > 1, and the proof is requested separately
+// (see GetItemProof). Must be called before the server is used.
+func (s *Server) SetMaxProofLeaves(maxLeaves int) {
+	s.maxProofLeaves = maxLeaves
+}
+
+// GetItemProof returns the Merkle proof of the item regardless of
+// SetMaxProofLeaves.
+func (s *Server) GetItemProof(itemIndex int) ([]byte, error) {
+	item, err := s.GetItemWithoutProof(itemIndex)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildProof(itemIndex-item.Index, item.NumLeaves, item.Index), nil
+}
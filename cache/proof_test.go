@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/merkletree"
+)
+
+// cachedTreeProof builds the proof using merkletree.CachedTree.
+func cachedTreeProof(leaves []byte, index int) []byte {
+	tree := merkletree.NewCachedTree(crypto.NewHash(), 0)
+	if err := tree.SetIndex(uint64(index)); err != nil {
+		panic(err)
+	}
+	for i := 0; i < len(leaves)/crypto.HashSize; i++ {
+		tree.Push(leaves[i*crypto.HashSize : (i+1)*crypto.HashSize])
+	}
+	_, proofSet, _, _ := tree.Prove(nil)
+	var proof []byte
+	for _, h := range proofSet {
+		proof = append(proof, h...)
+	}
+	return proof
+}
+
+func makeLeaves(n int) []byte {
+	leaves := make([]byte, 0, n*crypto.HashSize)
+	for i := 0; i < n; i++ {
+		h := sha256.Sum256([]byte(fmt.Sprintf("leaf %d", i)))
+		leaves = append(leaves, h[:]...)
+	}
+	return leaves
+}
+
+func TestMerkleProof(t *testing.T) {
+	b := &proofBuilder{h: crypto.NewHash()}
+	for n := 1; n <= 70; n++ {
+		leaves := makeLeaves(n)
+		for index := 0; index < n; index++ {
+			want := cachedTreeProof(leaves, index)
+			if got := b.prove(leaves, index); !bytes.Equal(got, want) {
+				t.Errorf("n=%d, index=%d: proof has %d bytes, want %d", n, index, len(got), len(want))
+			}
+		}
+	}
+}
+
+func BenchmarkMerkleProof(b *testing.B) {
+	for _, n := range []int{16, 255, 4096, 65537} {
+		leaves := makeLeaves(n)
+		index := n / 3
+		b.Run(fmt.Sprintf("CachedTree-%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				cachedTreeProof(leaves, index)
+			}
+		})
+		b.Run(fmt.Sprintf("proofBuilder-%d", n), func(b *testing.B) {
+			pb := &proofBuilder{h: crypto.NewHash()}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				pb.prove(leaves, index)
+			}
+		})
+	}
+}
+
+func BenchmarkGetItem(b *testing.B) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		b.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(b, testParameters(), blocks)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetItem(i % s.NumItems()); err != nil {
+			b.Fatalf("GetItem: %v", err)
+		}
+	}
+}
+
+// syntheticChain returns blocks starting after parentID. shapes[i] is
+// the number of miner payouts and transactions of block i.
+func syntheticChain(parentID types.BlockID, shapes [][2]int) []*types.Block {
+	var blocks []*types.Block
+	for i, shape := range shapes {
+		block := &types.Block{
+			ParentID:  parentID,
+			Timestamp: types.Timestamp(1500000000 + i),
+		}
+		for j := 0; j < shape[0]; j++ {
+			block.MinerPayouts = append(block.MinerPayouts, types.SiacoinOutput{
+				Value:      types.NewCurrency64(uint64(1000*i + j + 1)),
+				UnlockHash: types.UnlockHash(sha256.Sum256([]byte(fmt.Sprintf("payout %d %d", i, j)))),
+			})
+		}
+		for j := 0; j < shape[1]; j++ {
+			tx := types.Transaction{
+				ArbitraryData: [][]byte{[]byte(fmt.Sprintf("tx %d %d", i, j))},
+			}
+			if j%2 == 0 {
+				tx.SiacoinOutputs = []types.SiacoinOutput{{
+					Value:      types.NewCurrency64(uint64(j + 1)),
+					UnlockHash: types.UnlockHash(sha256.Sum256([]byte(fmt.Sprintf("output %d %d", i, j)))),
+				}}
+			}
+			block.Transactions = append(block.Transactions, tx)
+		}
+		parentID = block.ID()
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// checkSyntheticChain builds the index of the synthetic chain and
+// checks that every item round-trips through GetItem, ItemIndex and
+// VerifyItem.
+func checkSyntheticChain(t *testing.T, shapes [][2]int) {
+	parentID := types.BlockID(sha256.Sum256([]byte("synthetic parent")))
+	blocks := syntheticChain(parentID, shapes)
+	const start = 1000
+	p := Parameters{
+		OffsetLen:               8,
+		OffsetIndexLen:          4,
+		AddressPageLen:          4096,
+		AddressPrefixLen:        16,
+		AddressFastmapPrefixLen: 5,
+		AddressOffsetLen:        4,
+		StartHeight:             start,
+		StartParentID:           &parentID,
+	}
+	b, err := NewMemoryBuilderFromParameters(1024*1024, p)
+	if err != nil {
+		t.Fatalf("NewMemoryBuilderFromParameters: %v", err)
+	}
+	for _, block := range blocks {
+		if err := b.Add(block); err != nil {
+			t.Fatalf("%v: b.Add: %v", shapes, err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("%v: b.Close: %v", shapes, err)
+	}
+	s, err := NewServerFromBytes(b.MemoryFiles())
+	if err != nil {
+		t.Fatalf("%v: NewServerFromBytes: %v", shapes, err)
+	}
+	if s.NumBlocks() != len(blocks) {
+		t.Fatalf("%v: NumBlocks() = %d, want %d", shapes, s.NumBlocks(), len(blocks))
+	}
+	nitems := 0
+	for blockIndex, block := range blocks {
+		header, err := s.GetBlockHeader(blockIndex)
+		if err != nil {
+			t.Fatalf("%v: GetBlockHeader(%d): %v", shapes, blockIndex, err)
+		}
+		if header.MerkleRoot != block.MerkleRoot() {
+			t.Errorf("%v: block %d: wrong Merkle root", shapes, blockIndex)
+		}
+		payoutsStart, txsStart, end, err := s.GetBlockItems(blockIndex)
+		if err != nil {
+			t.Fatalf("%v: GetBlockItems(%d): %v", shapes, blockIndex, err)
+		}
+		if payoutsStart != nitems || txsStart-payoutsStart != len(block.MinerPayouts) || end-txsStart != len(block.Transactions) {
+			t.Errorf("%v: block %d: GetBlockItems = %d, %d, %d", shapes, blockIndex, payoutsStart, txsStart, end)
+		}
+		for itemIndex := payoutsStart; itemIndex < end; itemIndex++ {
+			item, err := s.GetItem(itemIndex)
+			if err != nil {
+				t.Fatalf("%v: GetItem(%d): %v", shapes, itemIndex, err)
+			}
+			if item.Block != blockIndex || item.Index != itemIndex-payoutsStart || item.NumLeaves != end-payoutsStart {
+				t.Errorf("%v: item %d: block %d, index %d of %d", shapes, itemIndex, item.Block, item.Index, item.NumLeaves)
+			}
+			if err := VerifyItem(item, header.MerkleRoot); err != nil {
+				t.Errorf("%v: item %d: VerifyItem: %v", shapes, itemIndex, err)
+			}
+			var want []byte
+			if itemIndex < txsStart {
+				want = encoding.Marshal(block.MinerPayouts[itemIndex-payoutsStart])
+			} else {
+				want = encoding.Marshal(block.Transactions[itemIndex-txsStart])
+			}
+			if data, err := ItemLeafData(item); err != nil || !bytes.Equal(data, want) {
+				t.Errorf("%v: item %d: wrong data (%v)", shapes, itemIndex, err)
+			}
+			id, err := ParseItemID(item.ID)
+			if err != nil {
+				t.Fatalf("%v: ParseItemID(%q): %v", shapes, item.ID, err)
+			}
+			if got, err := s.ItemIndex(id); err != nil || got != itemIndex {
+				t.Errorf("%v: ItemIndex(%s) = %d, %v; want %d", shapes, id, got, err, itemIndex)
+			}
+		}
+		// Items after the last payout and the last transaction.
+		for _, id := range []ItemID{
+			{Height: start + blockIndex, Type: ITEM_MINER_PAYOUT, Index: len(block.MinerPayouts)},
+			{Height: start + blockIndex, Type: ITEM_TRANSACTION, Index: len(block.Transactions)},
+		} {
+			if _, err := s.ItemIndex(id); err != ErrNoItem {
+				t.Errorf("%v: ItemIndex(%s): want ErrNoItem, got %v", shapes, id, err)
+			}
+		}
+		nitems = end
+	}
+	if s.NumItems() != nitems {
+		t.Errorf("%v: NumItems() = %d, want %d", shapes, s.NumItems(), nitems)
+	}
+	if _, err := s.GetItem(nitems); err != ErrTooLargeIndex {
+		t.Errorf("%v: GetItem(%d): want ErrTooLargeIndex, got %v", shapes, nitems, err)
+	}
+}
+
+func TestProofEdgeCases(t *testing.T) {
+	for _, shapes := range [][][2]int{
+		// Payouts only, empty, single transaction, the final block
+		// is empty.
+		{{1, 0}, {0, 0}, {0, 1}, {3, 0}, {2, 5}, {0, 0}},
+		// The only block is empty, so the address index is empty.
+		{{0, 0}},
+		// The final block has a single leaf.
+		{{0, 2}, {1, 0}},
+		{{0, 0}, {0, 0}, {0, 1}},
+		// Powers of two and their neighbours.
+		{{1, 3}, {1, 4}, {1, 6}, {1, 7}, {8, 8}},
+	} {
+		checkSyntheticChain(t, shapes)
+	}
+}
+
+func TestProofRoundTripSynthetic(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 50; i++ {
+		shapes := make([][2]int, 1+r.Intn(20))
+		for j := range shapes {
+			if r.Intn(5) == 0 {
+				// Empty block.
+				continue
+			}
+			shapes[j] = [2]int{r.Intn(4), r.Intn(10)}
+		}
+		checkSyntheticChain(t, shapes)
+	}
+}
+
+func TestMaxProofLeaves(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	var proofs [][]byte
+	for itemIndex := 0; itemIndex < s.NumItems(); itemIndex++ {
+		item, err := s.GetItem(itemIndex)
+		if err != nil {
+			t.Fatalf("GetItem: %v", err)
+		}
+		proofs = append(proofs, item.MerkleProof)
+	}
+	const maxLeaves = 2
+	s.SetMaxProofLeaves(maxLeaves)
+	skipped := 0
+	for itemIndex := 0; itemIndex < s.NumItems(); itemIndex++ {
+		item, err := s.GetItem(itemIndex)
+		if err != nil {
+			t.Fatalf("GetItem: %v", err)
+		}
+		if item.NumLeaves > maxLeaves {
+			skipped++
+			if len(item.MerkleProof) != 0 {
+				t.Errorf("item %d of %d leaves has proof", itemIndex, item.NumLeaves)
+			}
+		} else if !bytes.Equal(item.MerkleProof, proofs[itemIndex]) {
+			t.Errorf("item %d of %d leaves has wrong proof", itemIndex, item.NumLeaves)
+		}
+		proof, err := s.GetItemProof(itemIndex)
+		if err != nil {
+			t.Fatalf("GetItemProof: %v", err)
+		}
+		if !bytes.Equal(proof, proofs[itemIndex]) {
+			t.Errorf("GetItemProof(%d) differs from GetItem", itemIndex)
+		}
+	}
+	if skipped == 0 {
+		t.Errorf("no blocks with more than %d leaves", maxLeaves)
+	}
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// File publicKeys is a sorted list of unique records: ed25519 public key
+// and the unlock hash of single-signature unlock conditions with the key
+// seen in inputs. Unlock conditions with a timelock have other unlock
+// hashes than StandardUnlockHash, which is why they are stored.
+const publicKeyRecordSize = crypto.PublicKeySize + crypto.HashSize
+
+// MAX_PUBLIC_KEY_ADDRESSES limits the number of addresses returned
+// by Tiered.AddressesOfPublicKey.
+const MAX_PUBLIC_KEY_ADDRESSES = 100
+
+// StandardUnlockHash returns the address of the standard unlock
+// conditions of the key: one ed25519 key, one signature, no timelock.
+func StandardUnlockHash(pk crypto.PublicKey) types.UnlockHash {
+	return types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(pk)},
+		SignaturesRequired: 1,
+	}.UnlockHash()
+}
+
+// ParsePublicKey parses an ed25519 public key in the form
+// "ed25519:<64 hex characters>" or just hex.
+func ParsePublicKey(text string) (crypto.PublicKey, error) {
+	var pk crypto.PublicKey
+	text = strings.TrimPrefix(text, "ed25519:")
+	if len(text) != 2*crypto.PublicKeySize {
+		return pk, fmt.Errorf("public key must have %d hex characters", 2*crypto.PublicKeySize)
+	}
+	if _, err := hex.Decode(pk[:], []byte(text)); err != nil {
+		return pk, fmt.Errorf("public key is not valid hex: %v", err)
+	}
+	return pk, nil
+}
+
+// singleKey returns the ed25519 key of single-signature unlock
+// conditions.
+func singleKey(uc *types.UnlockConditions) ([]byte, bool) {
+	if uc.SignaturesRequired != 1 || len(uc.PublicKeys) != 1 {
+		return nil, false
+	}
+	key := uc.PublicKeys[0]
+	if key.Algorithm != types.SignatureEd25519 || len(key.Key) != crypto.PublicKeySize {
+		return nil, false
+	}
+	return key.Key, true
+}
+
+func (s *Builder) writePublicKeys(tx *types.Transaction) error {
+	write := func(uc *types.UnlockConditions) error {
+		key, ok := singleKey(uc)
+		if !ok {
+			return nil
+		}
+		uh := uc.UnlockHash()
+		copy(s.publicKeyBuf, key)
+		copy(s.publicKeyBuf[crypto.PublicKeySize:], uh[:])
+		if n, err := s.publicKeys.Write(s.publicKeyBuf); err != nil {
+			return err
+		} else if n != publicKeyRecordSize {
+			return io.ErrShortWrite
+		}
+		return nil
+	}
+	for i := range tx.SiacoinInputs {
+		if err := write(&tx.SiacoinInputs[i].UnlockConditions); err != nil {
+			return err
+		}
+	}
+	for i := range tx.SiafundInputs {
+		if err := write(&tx.SiafundInputs[i].UnlockConditions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uniqueWriter skips records equal to the previous one. It is used
+// after emsort to remove duplicates.
+type uniqueWriter struct {
+	w    io.WriteCloser
+	prev []byte
+}
+
+func (u *uniqueWriter) Write(b []byte) (int, error) {
+	if u.prev != nil && bytes.Equal(b, u.prev) {
+		return len(b), nil
+	}
+	u.prev = append(u.prev[:0], b...)
+	return u.w.Write(b)
+}
+
+func (u *uniqueWriter) Close() error {
+	return u.w.Close()
+}
+
+// PublicKeyAddresses returns unlock hashes of single-signature unlock
+// conditions with the key seen in inputs, sorted.
+func (s *Server) PublicKeyAddresses(pk crypto.PublicKey) []types.UnlockHash {
+	n := len(s.PublicKeys) / publicKeyRecordSize
+	first := sort.Search(n, func(i int) bool {
+		key := s.PublicKeys[i*publicKeyRecordSize : i*publicKeyRecordSize+crypto.PublicKeySize]
+		return bytes.Compare(key, pk[:]) >= 0
+	})
+	var addresses []types.UnlockHash
+	for i := first; i < n; i++ {
+		record := s.PublicKeys[i*publicKeyRecordSize : (i+1)*publicKeyRecordSize]
+		if !bytes.Equal(record[:crypto.PublicKeySize], pk[:]) {
+			break
+		}
+		var uh types.UnlockHash
+		copy(uh[:], record[crypto.PublicKeySize:])
+		addresses = append(addresses, uh)
+	}
+	return addresses
+}
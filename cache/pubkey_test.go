@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestPublicKeyAddresses(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	pk1 := crypto.PublicKey{1}
+	pk2 := crypto.PublicKey{2}
+	single := func(pk crypto.PublicKey, timelock types.BlockHeight) types.UnlockConditions {
+		return types.UnlockConditions{
+			Timelock:           timelock,
+			PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(pk)},
+			SignaturesRequired: 1,
+		}
+	}
+	multi := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(pk2), types.Ed25519PublicKey(pk1)},
+		SignaturesRequired: 1,
+	}
+	inputs := []types.UnlockConditions{
+		single(pk1, 0),
+		single(pk1, 100),
+		single(pk1, 0),
+		multi,
+	}
+	chain := []*types.Block{blocks[0]}
+	parentID := blocks[0].ID()
+	for i, uc := range inputs {
+		block := &types.Block{
+			ParentID:  parentID,
+			Timestamp: types.Timestamp(1433600000 + i + 1),
+			Transactions: []types.Transaction{
+				{SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{byte(i)}, UnlockConditions: uc}}},
+			},
+		}
+		chain = append(chain, block)
+		parentID = block.ID()
+	}
+	s := buildTestServer(t, testParameters(), chain)
+	if StandardUnlockHash(pk1) != single(pk1, 0).UnlockHash() {
+		t.Errorf("StandardUnlockHash returned wrong address")
+	}
+	got := s.PublicKeyAddresses(pk1)
+	want := map[types.UnlockHash]bool{
+		single(pk1, 0).UnlockHash():   true,
+		single(pk1, 100).UnlockHash(): true,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("PublicKeyAddresses returned %d addresses, want %d", len(got), len(want))
+	}
+	for _, uh := range got {
+		if !want[uh] {
+			t.Errorf("PublicKeyAddresses returned unexpected address %s", uh)
+		}
+	}
+	if got := s.PublicKeyAddresses(pk2); len(got) != 0 {
+		t.Errorf("PublicKeyAddresses returned addresses of a multi-key input: %v", got)
+	}
+	tiered := &Tiered{Cold: s}
+	history, err := tiered.GetHistoryByPublicKey(pk1)
+	if err != nil {
+		t.Fatalf("GetHistoryByPublicKey: %v", err)
+	}
+	var historyBlocks []int
+	for _, item := range history {
+		historyBlocks = append(historyBlocks, item.Block)
+	}
+	if fmt.Sprint(historyBlocks) != "[1 2 3]" {
+		t.Errorf("GetHistoryByPublicKey returned items of blocks %v, want [1 2 3]", historyBlocks)
+	}
+	if _, err := ParsePublicKey(fmt.Sprintf("ed25519:%x", pk1[:])); err != nil {
+		t.Errorf("ParsePublicKey: %v", err)
+	}
+	if _, err := ParsePublicKey("ed25519:01"); err == nil {
+		t.Errorf("ParsePublicKey accepted a short key")
+	}
+}
@@ -0,0 +1,102 @@
+//go:build linux
+// +build linux
+
+package cache
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestServeReadOnlyMount(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	addresses, err := readAddresses()
+	if err != nil {
+		t.Fatalf("readAddresses: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestServeReadOnlyMount")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	mnt, err := ioutil.TempDir("", "TestServeReadOnlyMount")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(mnt)
+	b, err := NewBuilder(dir, 1024*1024, 8, 4, 4096, 16, 5, 4)
+	if err != nil {
+		t.Fatalf("NewBuilder: %v", err)
+	}
+	for _, block := range blocks {
+		if err := b.Add(block); err != nil {
+			t.Fatalf("b.Add: %v", err)
+		}
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("b.Close: %v", err)
+	}
+	// Images of indices may come without the lock file.
+	if err := os.Remove(filepath.Join(dir, lockFile)); err != nil {
+		t.Fatalf("os.Remove: %v", err)
+	}
+	if err := syscall.Mount(dir, mnt, "", syscall.MS_BIND, ""); err != nil {
+		t.Skipf("bind mount (needs CAP_SYS_ADMIN): %v", err)
+	}
+	defer syscall.Unmount(mnt, 0)
+	if err := syscall.Mount("", mnt, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+		t.Skipf("read-only remount: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mnt, "probe"), nil, 0644); err == nil {
+		t.Fatalf("the mount is writable")
+	}
+
+	s, err := NewServer(mnt)
+	if err != nil {
+		t.Fatalf("NewServer on a read-only mount: %v", err)
+	}
+	if s.NumBlocks() != len(blocks) {
+		t.Errorf("NumBlocks() = %d, want %d", s.NumBlocks(), len(blocks))
+	}
+	addressBytes, err := hex.DecodeString(addresses[0])
+	if err != nil {
+		t.Fatalf("hex.DecodeString: %v", err)
+	}
+	history, _, err := s.GetHistory(addressBytes[:32], "")
+	if err != nil || len(history) == 0 {
+		t.Errorf("GetHistory(%s) returned %d items, %v", addresses[0], len(history), err)
+	}
+	for _, item := range history {
+		header, err := s.GetBlockHeader(item.Block)
+		if err != nil {
+			t.Fatalf("GetBlockHeader: %v", err)
+		}
+		if err := VerifyItem(item, header.MerkleRoot); err != nil {
+			t.Errorf("VerifyItem(%s): %v", item.ID, err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("s.Close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, lockFile)); !os.IsNotExist(err) {
+		t.Errorf("NewServer created the lock file: %v", err)
+	}
+
+	// The finalizer of a Server which is not closed only unmaps files.
+	if _, err := NewServer(mnt); err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	runtime.GC()
+
+	if _, err := OpenBuilder(mnt, 1024*1024); err == nil {
+		t.Errorf("OpenBuilder succeeded on a read-only mount")
+	}
+}
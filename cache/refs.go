@@ -0,0 +1,51 @@
+package cache
+
+// A server replaced by a new version of the index may still be in use:
+// requests keep items with Data pointing to its mmaped files after the
+// last use of the Server itself, so its finalizer could unmap the files
+// while they are read. Users of a replaceable server pin it with
+// Acquire until they are done with the data, and the owner calls
+// Retire instead of dropping it; the server is closed on the last
+// Release.
+
+// Acquire pins the server until Release. It returns false if the
+// server is retired and closed; get the current version then.
+func (s *Server) Acquire() bool {
+	s.refsMu.Lock()
+	defer s.refsMu.Unlock()
+	if s.retired && s.refs == 0 {
+		return false
+	}
+	s.refs++
+	return true
+}
+
+// Release unpins the server pinned by Acquire. It closes the retired
+// server if it is the last user.
+func (s *Server) Release() error {
+	s.refsMu.Lock()
+	defer s.refsMu.Unlock()
+	if s.refs <= 0 {
+		panic("Release without Acquire")
+	}
+	s.refs--
+	if s.retired && s.refs == 0 {
+		return s.Close()
+	}
+	return nil
+}
+
+// Retire closes the server when it is not pinned by Acquire: at once or
+// on the last Release. Retiring a retired server does nothing.
+func (s *Server) Retire() error {
+	s.refsMu.Lock()
+	defer s.refsMu.Unlock()
+	if s.retired {
+		return nil
+	}
+	s.retired = true
+	if s.refs == 0 {
+		return s.Close()
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRetire(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestRetire")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	_, s := buildTestIndex(t, dir, testParameters(), blocks[:100])
+	if !s.Acquire() || !s.Acquire() {
+		t.Fatalf("Acquire of open server failed")
+	}
+	if err := s.Retire(); err != nil {
+		t.Fatalf("Retire: %v", err)
+	}
+	if err := s.Retire(); err != nil {
+		t.Fatalf("second Retire: %v", err)
+	}
+	if err := s.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	// Still pinned once.
+	if s.Blockchain == nil {
+		t.Fatalf("retired server is closed while pinned")
+	}
+	if _, err := s.GetItem(0); err != nil {
+		t.Errorf("GetItem of pinned retired server: %v", err)
+	}
+	if !s.Acquire() {
+		t.Errorf("Acquire of pinned retired server failed")
+	}
+	s.Release()
+	if err := s.Release(); err != nil {
+		t.Fatalf("last Release: %v", err)
+	}
+	if s.Blockchain != nil {
+		t.Errorf("retired server is not closed after the last Release")
+	}
+	if s.Acquire() {
+		t.Errorf("Acquire of closed server succeeded")
+	}
+
+	// A server which is not pinned is closed by Retire.
+	s2, err := NewServer(dir)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	if err := s2.Retire(); err != nil {
+		t.Fatalf("Retire: %v", err)
+	}
+	if s2.Blockchain != nil {
+		t.Errorf("Retire did not close the server")
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/starius/sialite/emsort"
+	"github.com/starius/sialite/fastmap"
+)
+
+// BuildReport is written by Builder.Close to build_report.json.
+type BuildReport struct {
+	Blocks int
+	Items  uint64
+
+	// Addresses is the number of unique address prefixes.
+	Addresses int
+	// AddressRecords is the number of (address, item) pairs.
+	AddressRecords int
+	// InlinedAddresses is the number of addresses with inlined items.
+	InlinedAddresses int
+	// AddressPages is the number of pages of addressesFastmapData.
+	AddressPages int
+	// AddressPageFill[i] is the number of pages filled by i*10%.
+	AddressPageFill [11]int
+
+	// Sizes of files, bytes.
+	FileSizes map[string]int64
+
+	// Usage of addresses.tmp by emsort.
+	EmsortChunks   int
+	EmsortTmpBytes int64
+
+	// AddressTreeRoot is the root of the Merkle tree over the address
+	// index (hex), if Parameters.AddressTree is set.
+	AddressTreeRoot string `json:",omitempty"`
+	AddressKeys     int    `json:",omitempty"`
+
+	// TopAddresses are TOP_ADDRESSES address prefixes with the most
+	// items, from the largest (see Server.TopAddresses).
+	TopAddresses []AddressCount `json:",omitempty"`
+
+	// HeadersMMRRoot is the root of the headers MMR (hex, see mmr.go).
+	HeadersMMRRoot string `json:",omitempty"`
+
+	// Durations of phases.
+	AddDuration          time.Duration
+	FlushDuration        time.Duration
+	AddressIndexDuration time.Duration
+
+	// DropPageCacheDuration is the time spent writing files to disk
+	// and dropping them from page cache, if enabled by SetDropPageCache.
+	// It is included in the durations above.
+	DropPageCacheDuration time.Duration `json:",omitempty"`
+
+	// IOThrottleDuration is the time spent waiting for the limit of
+	// disk bandwidth, if set by SetIOLimit. It is included in the
+	// durations above.
+	IOThrottleDuration time.Duration `json:",omitempty"`
+}
+
+var reportedFiles = []string{
+	"blockchain",
+	"offsets",
+	"blockLocations",
+	"leavesHashes",
+	"headers",
+	"blockFees",
+	"contractStats",
+	"itemInfo",
+	"headersMMR",
+	"addressesFastmapData",
+	"addressesFastmapPrefixes",
+	"addressesIndices",
+	"addressKeys",
+	"addressTree",
+	"blockIDsFastmapData",
+	"blockIDsFastmapPrefixes",
+	"arbitraryData",
+	"publicKeys",
+	"hostKeys",
+	"timelocks",
+	"multisigKeys",
+}
+
+func newBuildReport(dir string, fs builderFS, sortStats emsort.Stats, mapStats fastmap.MultiMapStats) (*BuildReport, error) {
+	r := &BuildReport{
+		Addresses:        mapStats.Keys,
+		AddressRecords:   mapStats.Values,
+		InlinedAddresses: mapStats.Inlined,
+		AddressPages:     mapStats.Map.Pages,
+		AddressPageFill:  mapStats.Map.Fill,
+		FileSizes:        make(map[string]int64),
+		EmsortChunks:     sortStats.Chunks,
+		EmsortTmpBytes:   sortStats.TmpBytes,
+	}
+	for _, name := range reportedFiles {
+		size, err := fs.size(path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("size of %s: %v", name, err)
+		}
+		r.FileSizes[name] = size
+	}
+	return r, nil
+}
+
+func writeBuildReport(dir string, fs builderFS, r *BuildReport) error {
+	f, err := fs.create(path.Join(dir, "build_report.json"))
+	if err != nil {
+		return fmt.Errorf("opening build_report.json: %v", err)
+	}
+	e := json.NewEncoder(f)
+	e.SetIndent("", "\t")
+	if err := e.Encode(r); err != nil {
+		f.Close()
+		return fmt.Errorf("JSON Encode: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("JSON Close: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// MAX_RESOLVE_ITEMS is the max number of items of histories of input
+// addresses decoded by one call of ResolveInputs. Addresses with long
+// histories (e.g. of exchanges) would make each call decode all their
+// items, so outputs not found within the limit are left unresolved.
+const MAX_RESOLVE_ITEMS = 10000
+
+// ResolvedInput is an input of a transaction with the output it spends.
+type ResolvedInput struct {
+	Input
+
+	// Output is the spent output or nil if it was not found within
+	// MAX_RESOLVE_ITEMS items.
+	Output *Output
+
+	// Item is the index of the item creating the output and Block is
+	// the index of its block. Outputs of file contracts are created
+	// by storage proofs, but Item points to the item with the contract.
+	Item  int
+	Block int
+
+	// TxID is the ID of the transaction creating the output.
+	// It is zero for miner payouts.
+	TxID types.TransactionID
+}
+
+// ResolveInputs finds outputs spent by the inputs of the transaction.
+// The outputs are looked up in the history of the address of each input,
+// so the cost is proportional to the size of these histories, but at
+// most MAX_RESOLVE_ITEMS items are decoded.
+func (s *Server) ResolveInputs(tx *types.Transaction) ([]ResolvedInput, error) {
+	inputs := TransactionInputs(tx)
+	resolved := make([]ResolvedInput, len(inputs))
+	byAddress := make(map[types.UnlockHash][]int)
+	var addresses []types.UnlockHash
+	for i, in := range inputs {
+		resolved[i].Input = in
+		if _, has := byAddress[in.UnlockHash]; !has {
+			addresses = append(addresses, in.UnlockHash)
+		}
+		byAddress[in.UnlockHash] = append(byAddress[in.UnlockHash], i)
+	}
+	var blockIDs []types.BlockID
+	budget := MAX_RESOLVE_ITEMS
+	for _, address := range addresses {
+		wanted := make(map[crypto.Hash][]int)
+		for _, i := range byAddress[address] {
+			wanted[inputs[i].ParentID] = append(wanted[inputs[i].ParentID], i)
+		}
+		items, err := s.addressItems(address[:])
+		if err != nil {
+			return nil, err
+		}
+		for _, itemIndex := range items {
+			if len(wanted) == 0 || budget == 0 {
+				break
+			}
+			budget--
+			item, err := s.GetItemWithoutProof(itemIndex)
+			if err != nil {
+				return nil, err
+			}
+			payout, itemTx, err := DecodeItem(item)
+			if err != nil {
+				return nil, err
+			}
+			var outputs []Output
+			var txid types.TransactionID
+			if payout != nil {
+				if payout.UnlockHash != address {
+					continue
+				}
+				if blockIDs == nil {
+					if blockIDs, err = s.blockIDs(); err != nil {
+						return nil, err
+					}
+				}
+				outputs = []Output{{
+					ID:         crypto.Hash(MinerPayoutID(blockIDs[item.Block], item.Index)),
+					Nature:     NATURE_MINER_PAYOUT,
+					Index:      item.Index,
+					UnlockHash: payout.UnlockHash,
+					Value:      payout.Value,
+				}}
+			} else {
+				outputs = TransactionOutputs(itemTx)
+				txid = itemTx.ID()
+			}
+			for j := range outputs {
+				out := outputs[j]
+				for _, i := range wanted[out.ID] {
+					resolved[i].Output = &out
+					resolved[i].Item = itemIndex
+					resolved[i].Block = item.Block
+					resolved[i].TxID = txid
+				}
+				delete(wanted, out.ID)
+			}
+		}
+	}
+	return resolved, nil
+}
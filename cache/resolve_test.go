@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestResolveInputs(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	ninputs, nresolved := 0, 0
+	for height, block := range blocks {
+		for _, tx := range block.Transactions {
+			inputs, err := s.ResolveInputs(&tx)
+			if err != nil {
+				t.Fatalf("ResolveInputs: %v", err)
+			}
+			for _, in := range inputs {
+				ninputs++
+				if in.Output == nil {
+					continue
+				}
+				nresolved++
+				if in.Output.ID != in.ParentID {
+					t.Errorf("input %x resolved to output %x", in.ParentID[:], in.Output.ID[:])
+				}
+				if in.Block > height {
+					t.Errorf("input %x of block %d spends output of block %d", in.ParentID[:], height, in.Block)
+				}
+			}
+		}
+	}
+	if nresolved != ninputs {
+		t.Errorf("resolved %d inputs of %d", nresolved, ninputs)
+	}
+	ids, err := s.BlockIDs()
+	if err != nil {
+		t.Fatalf("BlockIDs: %v", err)
+	}
+	for i, block := range blocks {
+		if ids[i] != block.ID() {
+			t.Fatalf("BlockIDs()[%d] = %s, want %s", i, ids[i], block.ID())
+		}
+	}
+	// The copy returned by BlockIDs does not change the table.
+	ids[0] = types.BlockID{}
+	if ids2, _ := s.BlockIDs(); ids2[0] != blocks[0].ID() {
+		t.Errorf("modifying the result of BlockIDs changed the table")
+	}
+	err = s.ForEachBlock(500, 502, func(block *DecodedBlock) error {
+		if want := blocks[block.Height]; block.ID != want.ID() || block.ParentID != want.ParentID {
+			t.Errorf("ForEachBlock: block %d has ID %s and parent %s, want %s and %s", block.Height, block.ID, block.ParentID, want.ID(), want.ParentID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachBlock: %v", err)
+	}
+}
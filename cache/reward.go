@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"math/big"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// feeSize is the size of a record of blockFees file.
+const feeSize = 16
+
+// BlockReward splits the sum of miner payouts of a block into the base
+// subsidy and the collected miner fees. Miner payouts of a block sum
+// up to Subsidy+Fees; payouts are not attributed individually, since
+// the miner may split the sum arbitrarily.
+type BlockReward struct {
+	Subsidy types.Currency
+	Fees    types.Currency
+}
+
+// GetBlockReward returns the reward of the block with given index.
+func (s *Server) GetBlockReward(blockIndex int) (BlockReward, error) {
+	if blockIndex < 0 || blockIndex >= s.nblocks {
+		return BlockReward{}, ErrTooLargeBlockIndex
+	}
+	start := blockIndex * feeSize
+	fees := new(big.Int).SetBytes(s.BlockFees[start : start+feeSize])
+	return BlockReward{
+		Subsidy: types.CalculateCoinbase(types.BlockHeight(s.StartHeight() + blockIndex)),
+		Fees:    types.NewCurrency(fees),
+	}, nil
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Roles of an address in an item.
+const (
+	ROLE_MINER_PAYOUT = 1 << iota
+	ROLE_SIACOIN_INPUT
+	ROLE_SIACOIN_OUTPUT
+	ROLE_SIAFUND_INPUT
+	ROLE_SIAFUND_OUTPUT
+	ROLE_CONTRACT_OUTPUT
+)
+
+// Kinds of inputs in Match.Nature. Outputs use NATURE_* constants.
+const (
+	NATURE_SIACOIN_INPUT = "siacoin_input"
+	NATURE_SIAFUND_INPUT = "siafund_input"
+)
+
+// Match is an input or an output of an item belonging to the address.
+type Match struct {
+	Nature string
+	Index  int            // Index of input or output in its slice.
+	Index0 int            // Index of FileContract or FileContractRevision.
+	Value  types.Currency // Zero for inputs.
+}
+
+// ItemMatches decodes the item and returns its inputs and outputs
+// belonging to the address.
+func ItemMatches(item Item, address types.UnlockHash) ([]Match, error) {
+	payout, tx, err := DecodeItem(item)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	if payout != nil {
+		if payout.UnlockHash == address {
+			matches = append(matches, Match{
+				Nature: NATURE_MINER_PAYOUT,
+				Index:  item.Index,
+				Value:  payout.Value,
+			})
+		}
+		return matches, nil
+	}
+	for _, in := range TransactionInputs(tx) {
+		if in.UnlockHash != address {
+			continue
+		}
+		nature := NATURE_SIACOIN_INPUT
+		if in.Siafund {
+			nature = NATURE_SIAFUND_INPUT
+		}
+		matches = append(matches, Match{
+			Nature: nature,
+			Index:  in.Index,
+		})
+	}
+	for _, out := range TransactionOutputs(tx) {
+		if out.UnlockHash != address {
+			continue
+		}
+		matches = append(matches, Match{
+			Nature: out.Nature,
+			Index:  out.Index,
+			Index0: out.Index0,
+			Value:  out.Value,
+		})
+	}
+	return matches, nil
+}
+
+// MatchesRoles returns the bitmask of roles of matches. 0 means that
+// the item matched only the prefix of the address stored in the index.
+func MatchesRoles(matches []Match) int {
+	roles := 0
+	for _, m := range matches {
+		switch m.Nature {
+		case NATURE_MINER_PAYOUT:
+			roles |= ROLE_MINER_PAYOUT
+		case NATURE_SIACOIN_INPUT:
+			roles |= ROLE_SIACOIN_INPUT
+		case NATURE_SIAFUND_INPUT:
+			roles |= ROLE_SIAFUND_INPUT
+		case NATURE_SIACOIN_OUTPUT:
+			roles |= ROLE_SIACOIN_OUTPUT
+		case NATURE_SIAFUND_OUTPUT:
+			roles |= ROLE_SIAFUND_OUTPUT
+		default:
+			roles |= ROLE_CONTRACT_OUTPUT
+		}
+	}
+	return roles
+}
+
+// ItemRoles decodes the item and returns the bitmask of roles of the
+// address in it.
+func ItemRoles(item Item, address types.UnlockHash) (int, error) {
+	matches, err := ItemMatches(item, address)
+	if err != nil {
+		return 0, err
+	}
+	return MatchesRoles(matches), nil
+}
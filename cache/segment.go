@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/golang/snappy"
+)
+
+// Segment is the data appended to the files of the index by one block.
+// Segments are used to replicate the index to other servers.
+type Segment struct {
+	Header        []byte
+	BlockLocation []byte
+	Offsets       []byte
+	LeavesHashes  []byte
+	Blockchain    []byte
+}
+
+// ParametersJSON returns contents of parameters.json of the index.
+func (s *Server) ParametersJSON() ([]byte, error) {
+	return json.Marshal(s.par)
+}
+
+// GetSegment returns the segment of the block with given index.
+func (s *Server) GetSegment(blockIndex int) (Segment, error) {
+	payoutsStart, _, end, err := s.GetBlockItems(blockIndex)
+	if err != nil {
+		return Segment{}, err
+	}
+	blockLocLen := 2 * s.offsetIndexLen
+	seg := Segment{
+		Header:        s.Headers[blockIndex*headerSize : (blockIndex+1)*headerSize],
+		BlockLocation: s.BlockLocations[blockIndex*blockLocLen : (blockIndex+1)*blockLocLen],
+		Offsets:       s.Offsets[payoutsStart*s.offsetLen : end*s.offsetLen],
+		LeavesHashes:  s.LeavesHashes[payoutsStart*crypto.HashSize : end*crypto.HashSize],
+	}
+	if end != payoutsStart {
+		start := s.getOffset(payoutsStart)
+		stop := len(s.Blockchain)
+		if end != s.nitems {
+			stop = s.getOffset(end)
+		}
+		seg.Blockchain = s.Blockchain[start:stop]
+	}
+	return seg, nil
+}
+
+func (s *Server) getOffset(itemIndex int) int {
+	var tmp [8]byte
+	start := itemIndex * s.offsetLen
+	copy(tmp[:], s.Offsets[start:start+s.offsetLen])
+	return int(binary.LittleEndian.Uint64(tmp[:]))
+}
+
+// AddSegment decodes the block from the segment and adds it.
+// The segment must extend the data added so far.
+func (s *Builder) AddSegment(seg *Segment) error {
+	if len(seg.BlockLocation) != 2*s.offsetIndexLen {
+		return fmt.Errorf("bad length of block location: %d", len(seg.BlockLocation))
+	}
+	var tmp [8]byte
+	copy(tmp[:], seg.BlockLocation[:s.offsetIndexLen])
+	payoutsStart := binary.LittleEndian.Uint64(tmp[:])
+	copy(tmp[:], seg.BlockLocation[s.offsetIndexLen:])
+	txsStart := binary.LittleEndian.Uint64(tmp[:])
+	nitems := uint64(len(seg.Offsets) / s.offsetLen)
+	if payoutsStart != s.offsetIndex || txsStart < payoutsStart || txsStart > payoutsStart+nitems {
+		return fmt.Errorf("segment does not extend the index")
+	}
+	if nitems*uint64(s.offsetLen) != uint64(len(seg.Offsets)) {
+		return fmt.Errorf("bad length of offsets: %d", len(seg.Offsets))
+	}
+	var header BlockHeader
+	if err := encoding.Unmarshal(seg.Header, &header); err != nil {
+		return fmt.Errorf("decoding header: %v", err)
+	}
+	block := &types.Block{
+		ParentID:  s.lastBlockID,
+		Nonce:     header.Nonce,
+		Timestamp: header.Timestamp,
+	}
+	getOffset := func(i uint64) uint64 {
+		var tmp [8]byte
+		copy(tmp[:], seg.Offsets[int(i)*s.offsetLen:int(i+1)*s.offsetLen])
+		return binary.LittleEndian.Uint64(tmp[:])
+	}
+	for i := uint64(0); i < nitems; i++ {
+		start := getOffset(i) - s.blockchainLen
+		stop := uint64(len(seg.Blockchain))
+		if i != nitems-1 {
+			stop = getOffset(i+1) - s.blockchainLen
+		}
+		if start > stop || stop > uint64(len(seg.Blockchain)) {
+			return fmt.Errorf("bad offsets in segment")
+		}
+		data := seg.Blockchain[start:stop]
+		if payoutsStart+i < txsStart {
+			var payout types.SiacoinOutput
+			if err := encoding.Unmarshal(data, &payout); err != nil {
+				return fmt.Errorf("decoding miner payout: %v", err)
+			}
+			block.MinerPayouts = append(block.MinerPayouts, payout)
+		} else {
+			decoded, err := snappy.Decode(nil, data)
+			if err != nil {
+				return fmt.Errorf("snappy.Decode: %v", err)
+			}
+			var tx types.Transaction
+			if err := encoding.Unmarshal(decoded, &tx); err != nil {
+				return fmt.Errorf("decoding transaction: %v", err)
+			}
+			block.Transactions = append(block.Transactions, tx)
+		}
+	}
+	if block.MerkleRoot() != header.MerkleRoot {
+		return fmt.Errorf("Merkle root of the segment does not match its header")
+	}
+	return s.Add(block)
+}
+
+// NumBlocks returns the number of blocks added so far.
+func (s *Builder) NumBlocks() int {
+	return s.nblocks
+}
+
+// BuildID identifies the contents of the index. It is the hash of
+// the parameters, the numbers of blocks and items and the header of
+// the last block, so indices built from the same blocks with the same
+// parameters have the same BuildID.
+func (s *Server) BuildID() string {
+	return s.buildID
+}
+
+func (s *Server) computeBuildID() error {
+	parametersJSON, err := s.ParametersJSON()
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	h.Write(parametersJSON)
+	fmt.Fprintf(h, "\n%d %d\n", s.nblocks, s.nitems)
+	if s.nblocks != 0 {
+		h.Write(s.Headers[(s.nblocks-1)*headerSize : s.nblocks*headerSize])
+	}
+	s.buildID = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
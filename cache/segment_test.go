@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSegments(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	dir1, err := ioutil.TempDir("", "TestSegments")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir1)
+	dir2, err := ioutil.TempDir("", "TestSegments")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir2)
+	_, s1 := buildTestIndex(t, dir1, testParameters(), blocks)
+	defer s1.Close()
+	parametersJSON, err := s1.ParametersJSON()
+	if err != nil {
+		t.Fatalf("ParametersJSON: %v", err)
+	}
+	b2, err := NewBuilderWithParameters(dir2, 1024*1024, parametersJSON)
+	if err != nil {
+		t.Fatalf("NewBuilderWithParameters: %v", err)
+	}
+	for i := 0; i < s1.NumBlocks(); i++ {
+		seg, err := s1.GetSegment(i)
+		if err != nil {
+			t.Fatalf("GetSegment(%d): %v", i, err)
+		}
+		if err := b2.AddSegment(&seg); err != nil {
+			t.Fatalf("AddSegment(%d): %v", i, err)
+		}
+	}
+	if err := b2.Close(); err != nil {
+		t.Fatalf("b2.Close: %v", err)
+	}
+	for _, name := range []string{"blockchain", "offsets", "blockLocations", "leavesHashes", "headers", "headersMMR", "addressesIndices"} {
+		data1, err := ioutil.ReadFile(filepath.Join(dir1, name))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		data2, err := ioutil.ReadFile(filepath.Join(dir2, name))
+		if err != nil {
+			t.Fatalf("ioutil.ReadFile: %v", err)
+		}
+		if !bytes.Equal(data1, data2) {
+			t.Errorf("file %s differs after replication", name)
+		}
+	}
+	s2, err := NewServer(dir2)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer s2.Close()
+	if s1.BuildID() != s2.BuildID() {
+		t.Errorf("BuildID differs after replication: %s != %s", s1.BuildID(), s2.BuildID())
+	}
+}
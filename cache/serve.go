@@ -1,19 +1,23 @@
 package cache
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash"
+	"io/ioutil"
 	"os"
 	"path"
 	"reflect"
 	"runtime"
 	"sort"
 	"strings"
-	"syscall"
+	"sync"
 
 	"github.com/NebulousLabs/Sia/crypto"
-	"github.com/NebulousLabs/merkletree"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
 	"github.com/starius/sialite/fastmap"
 )
 
@@ -26,56 +30,226 @@ type Server struct {
 	Offsets        []byte
 	BlockLocations []byte
 	LeavesHashes   []byte
+	Headers        []byte
+	BlockFees      []byte
+	ContractStats  []byte
+	ItemInfo       []byte
+	HeadersMMR     []byte
 
 	AddressesFastmapData     []byte
 	AddressesFastmapPrefixes []byte
 	AddressesIndices         []byte
+	AddressKeys              []byte
+	AddressTree              []byte
 	addressMap               *fastmap.MultiMap
 
+	BlockIDsFastmapData     []byte
+	BlockIDsFastmapPrefixes []byte
+	blockIDMap              *fastmap.Map
+
+	ArbitraryData []byte
+	PublicKeys    []byte
+	HostKeys      []byte
+	Timelocks     []byte
+	MultisigKeys  []byte
+
+	par              Parameters
+	leafHash         func() hash.Hash
 	offsetLen        int
 	offsetIndexLen   int
 	addressPrefixLen int
 
 	nblocks, nitems int
+	buildID         string
+
+	// mmaped is true if []byte fields are mmaped (see NewServer).
+	mmaped bool
+	// unmap, if not nil, unmaps the combined file instead of the
+	// []byte fields (see combined.go).
+	unmap func() error
+
+	// prefetchHistory enables prefetching of the next page in
+	// GetHistory (see SetPrefetchHistory).
+	prefetchHistory bool
+	// verifyAddresses makes GetHistory skip items of other addresses
+	// with the same prefix (see SetVerifyAddresses).
+	verifyAddresses bool
+	// maxProofLeaves limits proofs built by GetItem (see
+	// SetMaxProofLeaves).
+	maxProofLeaves int
+	// proofBuilders has reusable *proofBuilder.
+	proofBuilders sync.Pool
+	// topAddresses are BuildReport.TopAddresses or nil.
+	topAddresses []AddressCount
+	// hotPrefixes are the lists of HOT_ADDRESSES_FILE by address prefix
+	// or nil (see Defrag).
+	hotPrefixes map[string]*hotPrefix
+
+	// IDs of blocks by index, computed once by blockIDs.
+	blockIDsOnce  sync.Once
+	blockIDsTable []types.BlockID
+	blockIDsErr   error
+
+	// refs is the number of Acquire calls not released yet; retired is
+	// set by Retire (see refs.go).
+	refsMu  sync.Mutex
+	refs    int
+	retired bool
 }
 
+// NewServer mmaps the files of the directory written by Builder.
+// It waits if Builder is writing to the directory (see lock.go).
+// dir can also be a combined file or a directory with COMBINED_FILE
+// and without parameters.json (see WriteCombined).
 func NewServer(dir string) (*Server, error) {
+	if stat, err := os.Stat(dir); err == nil && stat.Mode().IsRegular() {
+		return openCombined(dir)
+	}
+	if _, err := os.Stat(path.Join(dir, "parameters.json")); os.IsNotExist(err) {
+		combined := path.Join(dir, COMBINED_FILE)
+		if _, err := os.Stat(combined); err == nil {
+			return openCombined(combined)
+		}
+	}
+	lock, err := lockDir(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockDir(lock)
+	return openServer(dir)
+}
+
+func openServer(dir string) (*Server, error) {
+	if err := checkFileSizes(dir); err != nil {
+		return nil, err
+	}
 	// Read parameters.json.
 	jf, err := os.Open(path.Join(dir, "parameters.json"))
 	if err != nil {
 		return nil, err
 	}
 	defer jf.Close()
-	var par parameters
+	var par Parameters
 	if err := json.NewDecoder(jf).Decode(&par); err != nil {
 		return nil, err
 	}
+	// Mmap all []byte fileds from files.
+	files, err := mmapFiles(dir, serverFiles())
+	if err != nil {
+		return nil, err
+	}
+	s, err := newServer(par, files)
+	if err != nil {
+		unmapAll(files)
+		return nil, err
+	}
+	if report, err := ioutil.ReadFile(path.Join(dir, "build_report.json")); err == nil {
+		s.topAddresses = readTopAddresses(report)
+	}
+	if hot, err := ioutil.ReadFile(path.Join(dir, HOT_ADDRESSES_FILE)); err == nil {
+		s.hotPrefixes = s.readHotAddresses(hot)
+	}
+	s.mmaped = true
+	runtime.SetFinalizer(s, (*Server).Close)
+	return s, nil
+}
+
+// mmapFiles mmaps the files of the directory. Empty files are nil.
+func mmapFiles(dir string, names []string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, name := range names {
+		f, err := os.Open(path.Join(dir, name))
+		if err != nil {
+			unmapAll(files)
+			return nil, err
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil {
+			unmapAll(files)
+			return nil, err
+		}
+		if stat.Size() == 0 {
+			// Mmap fails on empty files.
+			files[name] = nil
+			continue
+		}
+		buf, err := mmapFile(f, int(stat.Size()))
+		if err != nil {
+			unmapAll(files)
+			return nil, err
+		}
+		files[name] = buf
+	}
+	return files, nil
+}
+
+// NewServerFromBytes creates Server from contents of files written by
+// Builder, including parameters.json. See NewMemoryBuilder.
+func NewServerFromBytes(files map[string][]byte) (*Server, error) {
+	var par Parameters
+	if err := json.Unmarshal(files["parameters.json"], &par); err != nil {
+		return nil, fmt.Errorf("parameters.json: %v", err)
+	}
+	for _, name := range serverFiles() {
+		if _, has := files[name]; !has {
+			return nil, fmt.Errorf("no file %s", name)
+		}
+	}
+	s, err := newServer(par, files)
+	if err != nil {
+		return nil, err
+	}
+	if report, has := files["build_report.json"]; has {
+		s.topAddresses = readTopAddresses(report)
+	}
+	if hot, has := files[HOT_ADDRESSES_FILE]; has {
+		s.hotPrefixes = s.readHotAddresses(hot)
+	}
+	return s, nil
+}
+
+// serverFiles returns names of files of []byte fields of Server.
+func serverFiles() []string {
+	var names []string
+	st := reflect.TypeOf(Server{})
+	for i := 0; i < st.NumField(); i++ {
+		ft := st.Field(i)
+		if ft.Type == reflect.TypeOf([]byte{}) {
+			names = append(names, strings.ToLower(ft.Name[:1])+ft.Name[1:])
+		}
+	}
+	return names
+}
+
+func unmapAll(files map[string][]byte) {
+	for _, buf := range files {
+		if buf == nil {
+			continue
+		}
+		munmap(buf)
+	}
+}
+
+func newServer(par Parameters, files map[string][]byte) (*Server, error) {
+	leafHash, err := newLeafHash(par.LeafHash)
+	if err != nil {
+		return nil, err
+	}
 	s := &Server{
+		par:              par,
+		leafHash:         leafHash,
 		offsetLen:        par.OffsetLen,
 		offsetIndexLen:   par.OffsetIndexLen,
 		addressPrefixLen: par.AddressPrefixLen,
 	}
 	v := reflect.ValueOf(s).Elem()
 	st := v.Type()
-	// Mmap all []byte fileds from files.
 	for i := 0; i < st.NumField(); i++ {
 		ft := st.Field(i)
 		if ft.Type == reflect.TypeOf([]byte{}) {
 			name := strings.ToLower(ft.Name[:1]) + ft.Name[1:]
-			f, err := os.Open(path.Join(dir, name))
-			if err != nil {
-				return nil, err
-			}
-			defer f.Close()
-			stat, err := f.Stat()
-			if err != nil {
-				return nil, err
-			}
-			buf, err := syscall.Mmap(int(f.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
-			if err != nil {
-				return nil, err
-			}
-			v.Field(i).SetBytes(buf)
+			v.Field(i).SetBytes(files[name])
 		}
 	}
 	var uninliner fastmap.Uninliner = fastmap.NoUninliner{}
@@ -88,6 +262,9 @@ func NewServer(dir string) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	if par.AddressHeights {
+		addressMap.SetValueSuffixes()
+	}
 	s.addressMap = addressMap
 	s.nblocks = len(s.BlockLocations) / (2 * par.OffsetIndexLen)
 	if s.nblocks*(2*par.OffsetIndexLen) != len(s.BlockLocations) {
@@ -97,20 +274,90 @@ func NewServer(dir string) (*Server, error) {
 	if s.nitems*par.OffsetLen != len(s.Offsets) {
 		return nil, fmt.Errorf("Bad length of offsets")
 	}
-	runtime.SetFinalizer(s, (*Server).Close)
+	if len(s.Headers) != s.nblocks*headerSize {
+		return nil, fmt.Errorf("Bad length of headers")
+	}
+	if len(s.BlockFees) != s.nblocks*feeSize {
+		return nil, fmt.Errorf("Bad length of blockFees")
+	}
+	if len(s.ContractStats) != s.nblocks*contractStatsSize {
+		return nil, fmt.Errorf("Bad length of contractStats")
+	}
+	if len(s.ItemInfo) != s.nitems*itemInfoSize {
+		return nil, fmt.Errorf("Bad length of itemInfo")
+	}
+	if len(s.HeadersMMR) != mmrSize(s.nblocks)*crypto.HashSize {
+		return nil, fmt.Errorf("Bad length of headersMMR")
+	}
+	if len(s.ArbitraryData)%(ARBITRARY_DATA_PREFIX_LEN+par.OffsetIndexLen) != 0 {
+		return nil, fmt.Errorf("Bad length of arbitraryData")
+	}
+	if len(s.PublicKeys)%publicKeyRecordSize != 0 {
+		return nil, fmt.Errorf("Bad length of publicKeys")
+	}
+	if len(s.HostKeys)%(crypto.PublicKeySize+par.OffsetIndexLen) != 0 {
+		return nil, fmt.Errorf("Bad length of hostKeys")
+	}
+	if len(s.Timelocks)%timelockRecordSize != 0 {
+		return nil, fmt.Errorf("Bad length of timelocks")
+	}
+	if len(s.MultisigKeys)%publicKeyRecordSize != 0 {
+		return nil, fmt.Errorf("Bad length of multisigKeys")
+	}
+	if s.nblocks != 0 {
+		blockIDMap, err := fastmap.OpenMap(blockIDsPageLen, crypto.HashSize, blockIndexLen, s.BlockIDsFastmapData, s.BlockIDsFastmapPrefixes)
+		if err != nil {
+			return nil, fmt.Errorf("fastmap.OpenMap: %v", err)
+		}
+		s.blockIDMap = blockIDMap
+	}
+	if par.AddressTree {
+		nkeys := len(s.AddressKeys) / par.AddressPrefixLen
+		if nkeys*par.AddressPrefixLen != len(s.AddressKeys) {
+			return nil, fmt.Errorf("Bad length of addressKeys")
+		}
+		ntree := 0
+		for _, n := range addressTreeLevels(nkeys) {
+			ntree += n
+		}
+		if len(s.AddressTree) != ntree*crypto.HashSize {
+			return nil, fmt.Errorf("Bad length of addressTree")
+		}
+	}
+	if err := s.computeBuildID(); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
 func (s *Server) Close() error {
+	runtime.SetFinalizer(s, nil)
+	if !s.mmaped {
+		return nil
+	}
 	v := reflect.ValueOf(s).Elem()
 	st := v.Type()
+	if s.unmap != nil {
+		for i := 0; i < st.NumField(); i++ {
+			if st.Field(i).Type == reflect.TypeOf([]byte{}) {
+				v.Field(i).SetBytes(nil)
+			}
+		}
+		err := s.unmap()
+		s.unmap = nil
+		return err
+	}
 	for i := 0; i < st.NumField(); i++ {
 		ft := st.Field(i)
 		if ft.Type == reflect.TypeOf([]byte{}) {
 			buf := v.Field(i).Interface().([]byte)
-			if err := syscall.Munmap(buf); err != nil {
+			if buf == nil {
+				continue
+			}
+			if err := munmap(buf); err != nil {
 				return err
 			}
+			v.Field(i).SetBytes(nil)
 		}
 	}
 	return nil
@@ -134,51 +381,260 @@ type Item struct {
 	NumLeaves       int
 	NumMinerPayouts int
 	MerkleProof     []byte
+
+	// ID is the text form of ItemID, stable across rebuilds.
+	ID string
+
+	// Roles is a bitmask of ROLE_* describing how the queried address
+	// takes part in the item. It is filled by GetHistory only.
+	Roles int
+
+	// Matches lists inputs and outputs of the item belonging to
+	// the queried address. It is filled by GetHistory only.
+	Matches []Match
+
+	// Reward describes the block of a miner payout. It is filled by
+	// GetHistory for miner payouts only.
+	Reward BlockReward
+
+	// Confirmations is the number of blocks from the block of the item
+	// to the tip, inclusive. It is filled by GetHistory only.
+	Confirmations int
+
+	// Verified is true if the item has the queried address, not only
+	// an address with the same prefix (see prefixmatch.go). It is
+	// filled by GetHistory only.
+	Verified bool
 }
 
+// GetHistory returns the first page of up to MAX_HISTORY_SIZE items
+// of the history of the address starting from the cursor start (see
+// page.go) and the cursor of the next page.
 func (s *Server) GetHistory(address []byte, start string) (history []Item, next string, err error) {
+	page, err := s.GetHistoryPage(address, start, MAX_HISTORY_SIZE)
+	if err != nil {
+		return nil, "", err
+	}
+	return page.Items, page.Next, nil
+}
+
+// GetHistoryPage returns up to limit items of the history of the
+// address starting from the cursor start.
+func (s *Server) GetHistoryPage(address []byte, start string, limit int) (ItemPage, error) {
+	return s.GetHistoryPageContext(context.Background(), address, start, limit)
+}
+
+// GetHistoryPageContext is like GetHistoryPage, but makes spans with
+// the Tracer of ctx (see WithTracer).
+func (s *Server) GetHistoryPageContext(ctx context.Context, address []byte, start string, limit int) (ItemPage, error) {
 	if len(address) != crypto.HashSize {
-		return nil, "", fmt.Errorf("size of address: want %d, got %d", crypto.HashSize, len(address))
+		return ItemPage{}, fmt.Errorf("size of address: want %d, got %d", crypto.HashSize, len(address))
 	}
 	addressPrefix := address[:s.addressPrefixLen]
-	values, err := s.addressMap.Lookup(addressPrefix)
-	if err != nil || values == nil {
-		return nil, "", err
+	var itemIndices []int
+	var total int
+	if hp := s.hotPrefixes[string(addressPrefix)]; hp != nil {
+		// The window has the items of the page, the first item of the
+		// next page and the items to prefetch. Items may be skipped
+		// if addresses are verified, so it has all the rest then.
+		n := limit + MAX_HISTORY_SIZE
+		if s.verifyAddresses {
+			n = hp.Total
+		}
+		window, err := s.hotWindow(hp, start, n)
+		if err != nil {
+			return ItemPage{}, err
+		}
+		itemIndices, total = window, hp.Total
+	} else {
+		_, end := StartSpan(ctx, SPAN_FASTMAP_LOOKUP)
+		values, _, err := s.lookupAddress(addressPrefix)
+		end()
+		if err != nil || values == nil {
+			return ItemPage{}, err
+		}
+		n := limit + MAX_HISTORY_SIZE
+		if s.verifyAddresses {
+			n = len(values) / s.offsetIndexLen
+		}
+		itemIndices, total, err = s.addressWindow(values, start, n)
+		if err != nil {
+			return ItemPage{}, err
+		}
 	}
-	size := len(values) / s.offsetIndexLen
-	if size > MAX_HISTORY_SIZE {
-		size = MAX_HISTORY_SIZE
-		// TODO implement "next" logic.
+	var uh types.UnlockHash
+	copy(uh[:], address)
+	history, pos, err := s.pageItems(ctx, itemIndices, start, limit, func(item *Item) (bool, error) {
+		var err error
+		_, end := StartSpan(ctx, SPAN_DECOMPRESS)
+		item.Matches, err = ItemMatches(*item, uh)
+		end()
+		if err != nil {
+			return false, err
+		}
+		item.Roles = MatchesRoles(item.Matches)
+		item.Verified = len(item.Matches) != 0 || s.addressPrefixLen == crypto.HashSize
+		if !item.Verified {
+			if item.Verified, err = itemHasAddress(*item, uh); err != nil {
+				return false, err
+			}
+		}
+		if s.verifyAddresses && !item.Verified {
+			return false, nil
+		}
+		if item.Compression == NO_COMPRESSION {
+			if item.Reward, err = s.GetBlockReward(item.Block); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return ItemPage{}, err
+	}
+	if s.prefetchHistory && pos < len(itemIndices) {
+		s.prefetchNextPage(itemIndices[pos:])
+	}
+	next, err := s.cursorAt(itemIndices, pos)
+	if err != nil {
+		return ItemPage{}, err
+	}
+	if s.verifyAddresses {
+		total = -1
 	}
-	indexPos := 0
+	return ItemPage{Items: history, Next: next, Total: total}, nil
+}
+
+// addressItem returns item index i of values of the address index.
+func (s *Server) addressItem(values []byte, i int) int {
 	var tmp [8]byte
-	tmpBytes := tmp[:]
-	for i := 0; i < size; i++ {
-		indexEnd := indexPos + s.offsetIndexLen
-		copy(tmpBytes, values[indexPos:indexEnd])
-		// Value 0 is special on wire, so all indices are shifted.
-		wireItemIndex := int(binary.LittleEndian.Uint64(tmpBytes))
-		itemIndex := wireItemIndex - 1
-		indexPos = indexEnd
-		item, err := s.GetItem(itemIndex)
+	copy(tmp[:], values[i*s.offsetIndexLen:(i+1)*s.offsetIndexLen])
+	// Value 0 is special on wire, so all indices are shifted.
+	return int(binary.LittleEndian.Uint64(tmp[:])) - 1
+}
+
+// addressWindow returns up to n item indices of values of the address
+// index starting from the cursor start and the number of items of the
+// address. Values are sorted by item index (see emsort.Fields in
+// build.go), so it seeks to the cursor by binary search and decodes
+// only the window. Values of indices built before that are not sorted
+// and are decoded entirely by decodeAddressItems.
+func (s *Server) addressWindow(values []byte, start string, n int) ([]int, int, error) {
+	count := len(values) / s.offsetIndexLen
+	for i := 1; i < count; i++ {
+		if s.addressItem(values, i) < s.addressItem(values, i-1) {
+			items := s.decodeAddressItems(values)
+			return items, len(items), nil
+		}
+	}
+	pos := 0
+	if start != "" {
+		id, err := ParseItemID(start)
 		if err != nil {
-			return nil, "", err
+			return nil, 0, ErrBadCursor
 		}
-		history = append(history, item)
+		itemIndex, err := s.ItemIndex(id)
+		if err != nil {
+			return nil, 0, ErrBadCursor
+		}
+		pos = sort.Search(count, func(i int) bool {
+			return s.addressItem(values, i) >= itemIndex
+		})
+	}
+	var window []int
+	for ; pos < count && len(window) < n; pos++ {
+		itemIndex := s.addressItem(values, pos)
+		// Builder writes one index entry per occurrence of the address
+		// in the item and the duplicates are merged by MultiMapWriter,
+		// but skip them here as well in case of other writers.
+		if len(window) != 0 && window[len(window)-1] == itemIndex {
+			continue
+		}
+		window = append(window, itemIndex)
 	}
-	return history, "", nil
+	// Duplicates are merged by MultiMapWriter, so each entry is an item.
+	return window, count, nil
 }
 
 var (
-	ErrTooLargeIndex = fmt.Errorf("Error in database: too large item index")
+	ErrTooLargeIndex      = fmt.Errorf("Error in database: too large item index")
+	ErrTooLargeBlockIndex = fmt.Errorf("Error in database: too large block index")
+
+	// ErrNotYetIndexed is returned for items and blocks with heights
+	// after the last block of the index, which may appear after the
+	// index is synced, unlike ErrNoItem.
+	ErrNotYetIndexed = fmt.Errorf("Not yet indexed")
 )
 
-func (s *Server) GetItem(itemIndex int) (Item, error) {
+func (s *Server) NumBlocks() int {
+	return s.nblocks
+}
+
+// TipHeight returns the height of the last block of the index.
+func (s *Server) TipHeight() int {
+	return s.StartHeight() + s.nblocks - 1
+}
+
+// CheckHeight returns ErrNotYetIndexed if height is after the last
+// block of the index.
+func (s *Server) CheckHeight(height int) error {
+	if height > s.TipHeight() {
+		return ErrNotYetIndexed
+	}
+	return nil
+}
+
+// StartHeight returns the height of the first block of the index.
+// It is 0 unless the index starts from a checkpoint.
+func (s *Server) StartHeight() int {
+	return s.par.StartHeight
+}
+
+// firstParentID returns the parent ID of the first block of the index.
+func (s *Server) firstParentID() types.BlockID {
+	if s.par.StartParentID != nil {
+		return *s.par.StartParentID
+	}
+	return types.GenesisBlock.ParentID
+}
+
+func (s *Server) NumItems() int {
+	return s.nitems
+}
+
+// GetBlockHeader returns the header of the block with given index.
+func (s *Server) GetBlockHeader(blockIndex int) (BlockHeader, error) {
+	var header BlockHeader
+	if blockIndex < 0 || blockIndex >= s.nblocks {
+		return header, ErrTooLargeBlockIndex
+	}
+	start := blockIndex * headerSize
+	if err := encoding.Unmarshal(s.Headers[start:start+headerSize], &header); err != nil {
+		return header, err
+	}
+	return header, nil
+}
+
+// GetBlockItems returns the range of item indices of the block:
+// miner payouts are [payoutsStart, txsStart), transactions are
+// [txsStart, end).
+func (s *Server) GetBlockItems(blockIndex int) (payoutsStart, txsStart, end int, err error) {
+	if blockIndex < 0 || blockIndex >= s.nblocks {
+		return 0, 0, 0, ErrTooLargeBlockIndex
+	}
+	payoutsStart, txsStart, nleaves := s.getBlockLocation(blockIndex)
+	return payoutsStart, txsStart, payoutsStart + nleaves, nil
+}
+
+func (s *Server) getItemData(itemIndex int) []byte {
+	dataStart, dataEnd := s.getItemDataRange(itemIndex)
+	return s.Blockchain[dataStart:dataEnd]
+}
+
+// getItemDataRange returns the range of the item in Blockchain.
+func (s *Server) getItemDataRange(itemIndex int) (int, int) {
 	var tmp [8]byte
 	tmpBytes := tmp[:]
-	if itemIndex >= s.nitems {
-		return Item{}, ErrTooLargeIndex
-	}
 	start := itemIndex * s.offsetLen
 	copy(tmpBytes, s.Offsets[start:start+s.offsetLen])
 	dataStart := int(binary.LittleEndian.Uint64(tmpBytes))
@@ -187,47 +643,74 @@ func (s *Server) GetItem(itemIndex int) (Item, error) {
 		copy(tmpBytes, s.Offsets[start+s.offsetLen:start+2*s.offsetLen])
 		dataEnd = int(binary.LittleEndian.Uint64(tmpBytes))
 	}
-	data := s.Blockchain[dataStart:dataEnd]
-	// Find the block.
-	blockIndex := sort.Search(s.nblocks, func(i int) bool {
-		payoutsStart := s.getPayoutsStart(i)
-		return payoutsStart > itemIndex
-	}) - 1
+	return dataStart, dataEnd
+}
+
+// GetItemWithoutProof is like GetItem, but it does not build MerkleProof.
+func (s *Server) GetItemWithoutProof(itemIndex int) (Item, error) {
+	if itemIndex < 0 || itemIndex >= s.nitems {
+		return Item{}, ErrTooLargeIndex
+	}
+	data := s.getItemData(itemIndex)
+	blockIndex := s.blockOfItem(itemIndex)
 	payoutsStart, txsStart, nleaves := s.getBlockLocation(blockIndex)
 	item := Item{
-		Data:      data,
-		Block:     blockIndex,
-		NumLeaves: nleaves,
-		Index:     itemIndex - payoutsStart,
+		Data:            data,
+		Block:           blockIndex,
+		NumLeaves:       nleaves,
+		NumMinerPayouts: txsStart - payoutsStart,
+		Index:           itemIndex - payoutsStart,
 	}
+	item.ID = s.itemID(blockIndex, item.Index, item.NumMinerPayouts).String()
 	if itemIndex < txsStart {
 		item.Compression = NO_COMPRESSION
 	} else {
 		item.Compression = SNAPPY
 	}
-	// Build MerkleProof.
+	return item, nil
+}
+
+// blockOfItem returns the index of the block of the item.
+func (s *Server) blockOfItem(itemIndex int) int {
+	return sort.Search(s.nblocks, func(i int) bool {
+		payoutsStart := s.getPayoutsStart(i)
+		return payoutsStart > itemIndex
+	}) - 1
+}
+
+func (s *Server) GetItem(itemIndex int) (Item, error) {
+	return s.GetItemContext(context.Background(), itemIndex)
+}
+
+// GetItemContext is like GetItem, but makes spans with the Tracer of
+// ctx (see WithTracer).
+func (s *Server) GetItemContext(ctx context.Context, itemIndex int) (Item, error) {
+	_, end := StartSpan(ctx, SPAN_ITEM_READ)
+	item, err := s.GetItemWithoutProof(itemIndex)
+	end()
+	if err != nil {
+		return Item{}, err
+	}
+	if s.maxProofLeaves != 0 && item.NumLeaves > s.maxProofLeaves {
+		// The proof is left empty, see SetMaxProofLeaves.
+		return item, nil
+	}
+	_, end = StartSpan(ctx, SPAN_PROOF_BUILD)
+	item.MerkleProof = s.buildProof(itemIndex-item.Index, item.NumLeaves, item.Index)
+	end()
+	return item, nil
+}
+
+// buildProof builds the Merkle proof of the leaf index of the block
+// whose leaves start at payoutsStart.
+func (s *Server) buildProof(payoutsStart, nleaves, index int) []byte {
 	hstart := payoutsStart * crypto.HashSize
 	hstop := hstart + nleaves*crypto.HashSize
 	leavesHashes := s.LeavesHashes[hstart:hstop]
-	tree := merkletree.NewCachedTree(crypto.NewHash(), 0)
-	if err := tree.SetIndex(uint64(item.Index)); err != nil {
-		return Item{}, fmt.Errorf("tree.SetIndex(%d): %v", item.Index, err)
-	}
-	for i := 0; i < nleaves; i++ {
-		start := i * crypto.HashSize
-		stop := start + crypto.HashSize
-		tree.Push(leavesHashes[start:stop])
-	}
-	_, proofSet, _, _ := tree.Prove(nil)
-	proof := make([]byte, 0, len(proofSet)*crypto.HashSize)
-	for _, h := range proofSet {
-		if len(h) != crypto.HashSize {
-			panic("len(h)=" + string(len(h)))
-		}
-		proof = append(proof, h...)
-	}
-	item.MerkleProof = proof
-	return item, nil
+	b := s.getProofBuilder()
+	proof := b.prove(leavesHashes, index)
+	s.proofBuilders.Put(b)
+	return proof
 }
 
 func (s *Server) getBlockLocation(index int) (int, int, int) {
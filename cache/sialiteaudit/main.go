@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	files  = flag.String("files", "", "Dir with output of builder")
+	height = flag.Int("height", -1, "Height of audit (-1 = last block)")
+	out    = flag.String("out", "", "File to write Sia-encoded audit with proofs")
+)
+
+func main() {
+	flag.Parse()
+	var addresses []types.UnlockHash
+	for _, address := range flag.Args() {
+		uh, err := cache.ParseAddress(address)
+		if err != nil {
+			log.Fatalf("cache.ParseAddress(%q): %v", address, err)
+		}
+		addresses = append(addresses, uh)
+	}
+	s, err := cache.NewServer(*files)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	h := *height
+	if h == -1 {
+		h = s.TipHeight()
+	}
+	audit, err := s.Audit(addresses, h)
+	if err != nil {
+		log.Fatalf("Audit: %v", err)
+	}
+	fmt.Printf("height %d\n", audit.Height)
+	for _, o := range audit.Outputs {
+		fmt.Printf("%s %x: %s at %s (block %d)", o.Nature, o.ID[:], cache.FormatSC(o.Value), cache.FormatAddress(o.Address), o.Created.Block)
+		if o.Spent != nil {
+			fmt.Printf(", spent in block %d", o.Spent.Block)
+		}
+		fmt.Printf("\n")
+	}
+	fmt.Printf("total: %s, %s SF\n", cache.FormatSC(audit.Siacoins), cache.FormatHastings(audit.Siafunds))
+	if *out != "" {
+		if err := encoding.WriteFile(*out, audit); err != nil {
+			log.Fatalf("encoding.WriteFile: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		log.Fatalf("s.Close: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"log"
 	"os"
@@ -19,6 +20,13 @@ var (
 	files      = flag.String("files", "", "Dir to write files")
 	memLimit   = flag.Int("memlimit", 64*1024*1024, "Memory limit, bytes")
 	nblocks    = flag.Int("nblocks", 0, "Approximate max number of blocks (0 = all)")
+	appendMode = flag.Bool("append", false, "Append blocks to existing files")
+	resume     = flag.Bool("resume", false, "Resume an interrupted build from its last checkpoint (see -checkpoint_every)")
+	dryRun     = flag.Bool("dry_run", false, "Do not write the index, print sizes of files and stats of the address index (-files holds temporary files)")
+	peers      = flag.String("peers", "", "File to persist stats and bans of peers (empty = no persistence)")
+
+	dialTimeout = flag.Duration("dial_timeout", netlib.DefaultDialOptions.DialTimeout, "Timeout of connecting to the node (0 = no timeout)")
+	readTimeout = flag.Duration("read_timeout", netlib.DefaultDialOptions.ReadTimeout, "Timeout of reading a batch of blocks from the node (0 = no timeout)")
 
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 
@@ -28,8 +36,45 @@ var (
 	addressPrefixLen        = flag.Int("address_prefix_len", 16, "sizeof(prefix of address to store)")
 	addressFastmapPrefixLen = flag.Int("address_fastmap_prefix_len", 5, "sizeof(prefix of address to store in addressesFastmapPrefixes)")
 	addressOffsetLen        = flag.Int("address_offset_len", 4, "sizeof(offset in addressesIndices file)")
+	addressTree             = flag.Bool("address_tree", false, "Build Merkle tree over address index (for proofs of absence)")
+	multisigKeys            = flag.Bool("multisig_keys", false, "Index keys of multi-signature unlock conditions (to find shared wallets)")
+	addressHeights          = flag.Bool("address_heights", false, "Store heights of blocks in the address index (to seek history by height)")
+	leafHash                = flag.String("leaf_hash", cache.HASH_BLAKE2B, "Hash of leaves and Merkle proofs (blake2b or sha256)")
+	dropPageCache           = flag.Bool("drop_page_cache", false, "Drop written files from page cache to keep it for a server on the same machine")
+	ioLimit                 = flag.Int("io_limit", 0, "Limit disk IO of the build, MiB/s (0 = no limit)")
+	progressEvery           = flag.Int("progress_every", 0, "Log progress every N blocks (0 = no progress)")
+	checkpointEvery         = flag.Int("checkpoint_every", 0, "Write files of blocks to disk every N blocks, so -resume can continue an interrupted build (0 = no checkpoints)")
+	logAddresses            = flag.Int("log_addresses", 0, "Log blocks writing more records to the address index (0 = don't log)")
+	headersFirst            = flag.Bool("headers_first", false, "Download and verify headers before blocks if the node supports it")
 )
 
+// headerVerifier returns the verifier of headers of blocks after the
+// last block of b, or after the genesis block if b is empty.
+func headerVerifier(b *cache.Builder) (*cache.HeaderVerifier, error) {
+	v, err := cache.NewHeaderVerifier(b.HeaderVerifierState(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if v.Height() == 0 {
+		// The genesis block is not downloaded.
+		genesis := types.GenesisBlock.Header()
+		err := v.AppendHeader(cache.BlockHeader{
+			Nonce:      genesis.Nonce,
+			Timestamp:  genesis.Timestamp,
+			MerkleRoot: genesis.MerkleRoot,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Targets of blocks are not known without the difficulty of all
+	// previous blocks. The target of the genesis block is the floor:
+	// it proves work for each header, but not the difficulty required
+	// by consensus.
+	v.SetMinTarget(types.RootTarget)
+	return v, nil
+}
+
 func main() {
 	flag.Parse()
 	if *cpuprofile != "" {
@@ -41,22 +86,102 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 	ctx := context.Background()
-	b, err := cache.NewBuilder(*files, *memLimit, *offsetLen, *offsetIndexLen, *addressPageLen, *addressPrefixLen, *addressFastmapPrefixLen, *addressOffsetLen)
-	if err != nil {
-		log.Fatalf("cache.NewBuilder: %v", err)
+	var b *cache.Builder
+	var err error
+	if *appendMode && *dryRun {
+		log.Fatalf("-append and -dry_run are incompatible")
+	}
+	if *resume && *dryRun {
+		log.Fatalf("-resume and -dry_run are incompatible")
+	}
+	if *appendMode && *resume {
+		log.Fatalf("-append and -resume are incompatible")
+	}
+	if *resume {
+		b, err = cache.ResumeBuilder(*files, *memLimit)
+		if err != nil {
+			log.Fatalf("cache.ResumeBuilder: %v", err)
+		}
+	} else if *appendMode {
+		b, err = cache.OpenBuilder(*files, *memLimit)
+		if err != nil {
+			log.Fatalf("cache.OpenBuilder: %v", err)
+		}
+	} else {
+		p := cache.Parameters{
+			OffsetLen:               *offsetLen,
+			OffsetIndexLen:          *offsetIndexLen,
+			AddressPageLen:          *addressPageLen,
+			AddressPrefixLen:        *addressPrefixLen,
+			AddressFastmapPrefixLen: *addressFastmapPrefixLen,
+			AddressOffsetLen:        *addressOffsetLen,
+			LeafHash:                *leafHash,
+			AddressTree:             *addressTree,
+			MultisigKeys:            *multisigKeys,
+			AddressHeights:          *addressHeights,
+		}
+		if *dryRun {
+			if b, err = cache.NewDryRunBuilder(*files, *memLimit, p); err != nil {
+				log.Fatalf("cache.NewDryRunBuilder: %v", err)
+			}
+		} else if b, err = cache.NewBuilderFromParameters(*files, *memLimit, p); err != nil {
+			log.Fatalf("cache.NewBuilderFromParameters: %v", err)
+		}
+	}
+	b.SetDropPageCache(*dropPageCache)
+	b.SetIOLimit(int64(*ioLimit) * 1024 * 1024)
+	b.SetCheckpointInterval(*checkpointEvery)
+	if *progressEvery != 0 || *logAddresses != 0 {
+		b.SetOnProgress(func(st cache.BlockStats) {
+			if *progressEvery != 0 && st.Height%*progressEvery == 0 {
+				log.Printf("Added block %d.", st.Height)
+			}
+			if *logAddresses != 0 && st.Addresses > *logAddresses {
+				log.Printf("Block %d (%s) has %d transactions, %d bytes, %d addresses.", st.Height, st.ID, st.Transactions, st.Bytes, st.Addresses)
+			}
+		})
 	}
-	_, f, err := netlib.OpenOrConnect(ctx, *blockchain, *source)
+	var book *netlib.PeerBook
+	if *peers != "" {
+		if book, err = netlib.OpenPeerBook(*peers); err != nil {
+			log.Fatalf("netlib.OpenPeerBook: %v", err)
+		}
+	}
+	opts := netlib.DefaultDialOptions
+	opts.DialTimeout = *dialTimeout
+	opts.ReadTimeout = *readTimeout
+	opts.Peers = book
+	_, f, err := netlib.OpenOrConnectWithOptions(ctx, *blockchain, *source, opts)
 	if err != nil {
 		panic(err)
 	}
 	bchan := make(chan *types.Block, 2)
-	bchan <- &types.GenesisBlock
+	// Blocks already present in the files are skipped by b.Add,
+	// so the stream may overlap with them.
+	prevBlockID := types.GenesisID
+	if (*appendMode || *resume) && *blockchain == "" && b.LastBlockID() != (types.BlockID{}) {
+		prevBlockID = b.LastBlockID()
+	} else {
+		bchan <- &types.GenesisBlock
+	}
+	download := func(ctx context.Context) error {
+		return netlib.DownloadAllBlocksFrom(ctx, bchan, f, prevBlockID)
+	}
+	if *headersFirst && *blockchain == "" {
+		v, err := headerVerifier(b)
+		if err != nil {
+			log.Fatalf("headerVerifier: %v", err)
+		}
+		download = func(ctx context.Context) error {
+			return netlib.DownloadAllBlocksHeadersFirst(ctx, bchan, f, v)
+		}
+	}
 	var wg sync.WaitGroup
 	wg.Add(1)
 	ctx, cancel := context.WithCancel(ctx)
 	go func() {
 		defer wg.Done()
-		if err := netlib.DownloadAllBlocks(ctx, bchan, f); err != nil {
+		if err := download(ctx); err != nil {
 			if err != context.Canceled {
 				panic(err)
 			}
@@ -81,4 +206,16 @@ func main() {
 	if err := b.Close(); err != nil {
 		panic(err)
 	}
+	if *dryRun {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "\t")
+		if err := e.Encode(b.Report()); err != nil {
+			log.Fatalf("json.Encode: %v", err)
+		}
+	}
+	if book != nil {
+		if err := book.Save(); err != nil {
+			log.Fatalf("book.Save: %v", err)
+		}
+	}
 }
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	files = flag.String("files", "", "Dir with output of builder")
+	out   = flag.String("out", "", "Combined file to write (e.g. dir/"+cache.COMBINED_FILE+")")
+)
+
+func main() {
+	flag.Parse()
+	if err := cache.WriteCombined(*files, *out); err != nil {
+		log.Fatalf("cache.WriteCombined: %v", err)
+	}
+	// Check that the file can be opened.
+	s, err := cache.NewServer(*out)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	log.Printf("Wrote %d blocks, build ID %s.", s.NumBlocks(), s.BuildID())
+	if err := s.Close(); err != nil {
+		log.Fatalf("s.Close: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+// sialitedefrag copies the address lists of hot addresses of the index
+// to a separate file, so history pages of them are read without
+// decoding the whole list (see cache.Server.Defrag). Run it after each build.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	files        = flag.String("files", "", "Dir with output of builder")
+	minItems     = flag.Int("min_items", cache.DEFAULT_HOT_ADDRESS_ITEMS, "Min number of items of a hot address prefix")
+	bucketBlocks = flag.Int("bucket_blocks", 0, "Split lists into buckets of this number of blocks (0 = no split)")
+)
+
+func main() {
+	flag.Parse()
+	s, err := cache.NewServer(*files)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	data, report, err := s.Defrag(cache.DefragOptions{
+		MinItems:     *minItems,
+		BucketBlocks: *bucketBlocks,
+	})
+	if err != nil {
+		log.Fatalf("s.Defrag: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		log.Fatalf("s.Close: %v", err)
+	}
+	if err := cache.WriteHotAddresses(*files, data); err != nil {
+		log.Fatalf("cache.WriteHotAddresses: %v", err)
+	}
+	log.Printf("Copied %d prefixes, %d items in %d buckets (%d bytes) in %s.", report.Prefixes, report.Items, report.Buckets, report.Bytes, report.Duration)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	a            = flag.String("a", "", "Dir with output of builder (first)")
+	b            = flag.String("b", "", "Dir with output of builder (second)")
+	maxAddresses = flag.Int("max_addresses", 10000, "Max number of addresses to compare histories of")
+)
+
+func main() {
+	flag.Parse()
+	sa, err := cache.NewServer(*a)
+	if err != nil {
+		log.Fatalf("cache.NewServer(%q): %v", *a, err)
+	}
+	sb, err := cache.NewServer(*b)
+	if err != nil {
+		log.Fatalf("cache.NewServer(%q): %v", *b, err)
+	}
+	d, err := cache.DiffIndices(sa, sb, *maxAddresses)
+	if err != nil {
+		log.Fatalf("cache.DiffIndices: %v", err)
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "\t")
+	if err := e.Encode(d); err != nil {
+		log.Fatalf("JSON Encode: %v", err)
+	}
+	if err := sa.Close(); err != nil {
+		log.Fatalf("sa.Close: %v", err)
+	}
+	if err := sb.Close(); err != nil {
+		log.Fatalf("sb.Close: %v", err)
+	}
+	if !d.Equal() {
+		os.Exit(1)
+	}
+}
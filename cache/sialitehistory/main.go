@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	files   = flag.String("files", "", "Dir with output of builder")
+	address = flag.String("address", "", "Address (76 hex characters with checksum)")
+)
+
+func main() {
+	flag.Parse()
+	uh, err := cache.ParseAddress(*address)
+	if err != nil {
+		log.Fatalf("cache.ParseAddress(%q): %v", *address, err)
+	}
+	s, err := cache.NewServer(*files)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	history, _, err := s.GetHistory(uh[:], "")
+	if err != nil {
+		log.Fatalf("GetHistory: %v", err)
+	}
+	fmt.Printf("address %s\n", cache.FormatAddress(uh))
+	for _, item := range history {
+		payout, tx, err := cache.DecodeItem(item)
+		if err != nil {
+			log.Fatalf("cache.DecodeItem: %v", err)
+		}
+		if payout != nil {
+			fmt.Printf("%s block %d miner payout %d: %s -> %s\n", item.ID, item.Block, item.Index, cache.FormatSC(payout.Value), cache.FormatAddress(payout.UnlockHash))
+			fmt.Printf("\tblock subsidy %s, fees %s\n", cache.FormatSC(item.Reward.Subsidy), cache.FormatSC(item.Reward.Fees))
+			continue
+		}
+		fmt.Printf("%s block %d transaction %s\n", item.ID, item.Block, tx.ID())
+		inputs, err := s.ResolveInputs(tx)
+		if err != nil {
+			log.Fatalf("ResolveInputs: %v", err)
+		}
+		for _, in := range inputs {
+			if in.Output == nil {
+				fmt.Printf("\tinput %x from %s\n", in.ParentID[:], cache.FormatAddress(in.UnlockHash))
+				continue
+			}
+			fmt.Printf("\tinput %x from %s: %s (%s of block %d)\n", in.ParentID[:], cache.FormatAddress(in.UnlockHash), cache.FormatSC(in.Output.Value), in.Output.Nature, in.Block)
+		}
+		for _, out := range cache.TransactionOutputs(tx) {
+			fmt.Printf("\t%s %x: %s -> %s\n", out.Nature, out.ID[:], cache.FormatSC(out.Value), cache.FormatAddress(out.UnlockHash))
+		}
+	}
+	if err := s.Close(); err != nil {
+		log.Fatalf("s.Close: %v", err)
+	}
+}
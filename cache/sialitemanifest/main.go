@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	files  = flag.String("files", "", "Dir with output of builder")
+	verify = flag.String("verify", "", "Published manifest to verify the files against (empty = print the manifest)")
+)
+
+func main() {
+	flag.Parse()
+	if *verify == "" {
+		m, err := cache.ComputeManifest(*files)
+		if err != nil {
+			log.Fatalf("cache.ComputeManifest: %v", err)
+		}
+		if err := cache.WriteManifest(os.Stdout, m); err != nil {
+			log.Fatalf("cache.WriteManifest: %v", err)
+		}
+		return
+	}
+	f, err := os.Open(*verify)
+	if err != nil {
+		log.Fatalf("os.Open: %v", err)
+	}
+	published, err := cache.ReadManifest(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("cache.ReadManifest: %v", err)
+	}
+	mismatches, err := cache.VerifyManifest(*files, published)
+	if err == cache.ErrManifestMismatch {
+		for _, name := range mismatches {
+			fmt.Printf("mismatch: %s\n", name)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		log.Fatalf("cache.VerifyManifest: %v", err)
+	}
+	fmt.Printf("OK: %d files match\n", len(published.Files))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/netlib"
+)
+
+// indexParameters are the parameters of indices built by the server.
+// They are the defaults of sialitebuilder.
+var indexParameters = cache.Parameters{
+	OffsetLen:               8,
+	OffsetIndexLen:          4,
+	AddressPageLen:          4096,
+	AddressPrefixLen:        16,
+	AddressFastmapPrefixLen: 5,
+	AddressOffsetLen:        4,
+}
+
+// parseCheckpoint parses "height:blockID".
+func parseCheckpoint(checkpoint string) (int, types.BlockID, error) {
+	var id types.BlockID
+	parts := strings.SplitN(checkpoint, ":", 2)
+	if len(parts) != 2 {
+		return 0, id, fmt.Errorf("checkpoint %q: want height:blockID", checkpoint)
+	}
+	height, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, id, fmt.Errorf("checkpoint height: %v", err)
+	}
+	idBytes, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return 0, id, fmt.Errorf("checkpoint block ID: %v", err)
+	}
+	if len(idBytes) != len(id) {
+		return 0, id, fmt.Errorf("checkpoint block ID: want %d bytes, got %d", len(id), len(idBytes))
+	}
+	copy(id[:], idBytes)
+	return height, id, nil
+}
+
+// buildIndex downloads blocks after prevBlockID from the node and
+// writes the index to dir. If prevBlockID is the genesis block, the
+// genesis block itself is added first.
+func buildIndex(ctx context.Context, dir string, memLimit int, p cache.Parameters, prevBlockID types.BlockID) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := cache.NewBuilderFromParameters(dir, memLimit, p)
+	if err != nil {
+		return fmt.Errorf("cache.NewBuilderFromParameters: %v", err)
+	}
+	if prevBlockID == types.GenesisID {
+		if err := b.Add(&types.GenesisBlock); err != nil {
+			return err
+		}
+	}
+	_, f, err := netlib.OpenOrConnect(ctx, "", *source)
+	if err != nil {
+		return fmt.Errorf("netlib.OpenOrConnect: %v", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	bchan := make(chan *types.Block, 2)
+	done := make(chan error, 1)
+	go func() {
+		done <- netlib.DownloadAllBlocksFrom(ctx, bchan, f, prevBlockID)
+		close(bchan)
+	}()
+	for block := range bchan {
+		if err := b.Add(block); err != nil {
+			cancel()
+			for range bchan {
+			}
+			return err
+		}
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+	return b.Close()
+}
+
+// syncBackwards indexes blocks after the checkpoint and returns the
+// server of this index, so recent activity can be queried right away.
+// The full index is built in the background. When it is ready, its
+// files replace the index in dir and the new server is sent to updates.
+func syncBackwards(ctx context.Context, dir, checkpoint string, memLimit int, updates chan<- *cache.Server) (*cache.Server, error) {
+	height, id, err := parseCheckpoint(checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	recentDir := path.Join(dir, "recent")
+	if err := os.RemoveAll(recentDir); err != nil {
+		return nil, err
+	}
+	p := indexParameters
+	p.StartHeight = height + 1
+	p.StartParentID = &id
+	log.Printf("Indexing blocks after checkpoint %d.", height)
+	if err := buildIndex(ctx, recentDir, memLimit, p, id); err != nil {
+		return nil, fmt.Errorf("building recent index: %v", err)
+	}
+	recent, err := cache.NewServer(recentDir)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		full, err := backfill(ctx, dir, memLimit)
+		if err != nil {
+			log.Printf("Backfill failed: %v.", err)
+			return
+		}
+		select {
+		case updates <- full:
+		case <-ctx.Done():
+		}
+	}()
+	return recent, nil
+}
+
+// backfill builds the full index in dir/full and moves its files to dir.
+func backfill(ctx context.Context, dir string, memLimit int) (*cache.Server, error) {
+	fullDir := path.Join(dir, "full")
+	if err := os.RemoveAll(fullDir); err != nil {
+		return nil, err
+	}
+	log.Printf("Indexing all blocks in background.")
+	if err := buildIndex(ctx, fullDir, memLimit, indexParameters, types.GenesisID); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fullDir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	// parameters.json is moved last, since its presence means
+	// that the directory has a complete index.
+	for _, name := range names {
+		if name == "parameters.json" {
+			continue
+		}
+		if err := os.Rename(path.Join(fullDir, name), path.Join(dir, name)); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Rename(path.Join(fullDir, "parameters.json"), path.Join(dir, "parameters.json")); err != nil {
+		return nil, err
+	}
+	// Files of the recent index are still mmaped by its server,
+	// so removing them does not affect requests in flight.
+	for _, d := range []string{fullDir, path.Join(dir, "recent")} {
+		if err := os.RemoveAll(d); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Backfill completed, switching to the full index.")
+	return cache.NewServer(dir)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+
+	"github.com/starius/sialite/api"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/replication"
+)
+
+// chainConfig is an entry of the file passed in -chains.
+type chainConfig struct {
+	// Prefix of routes, e.g. "/testnet".
+	Prefix string
+
+	// Files is the dir with output of builder.
+	Files string
+
+	// Leader or Deltas, if set, is followed like -leader or -deltas.
+	Leader string
+	Deltas string
+}
+
+func readChainConfigs(file string) ([]chainConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var configs []chainConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return configs, nil
+}
+
+// openChain opens the index of the chain and starts its follower.
+// Options of the chain are copied from opts, which must not have
+// Updates, Tip, Mempool, Webhooks and SyncCheck of another chain.
+func openChain(ctx context.Context, c chainConfig, opts api.Options) (api.Chain, error) {
+	var follower *replication.Follower
+	var source replication.Source
+	if c.Leader != "" {
+		source = replication.NewLeaderSource(c.Leader, nil)
+	} else if c.Deltas != "" {
+		source = replication.NewDeltaSource(c.Deltas, nil)
+	}
+	if source != nil {
+		follower = &replication.Follower{
+			Source:   source,
+			Dir:      c.Files,
+			MemLimit: *followMemLimit,
+		}
+		if _, err := os.Stat(path.Join(c.Files, "parameters.json")); os.IsNotExist(err) {
+			log.Printf("Downloading the index of %s.", c.Prefix)
+			if _, err := follower.Sync(ctx, nil); err != nil {
+				return api.Chain{}, fmt.Errorf("follower.Sync: %v", err)
+			}
+		}
+	}
+	s, err := cache.NewServer(c.Files)
+	if err != nil {
+		return api.Chain{}, fmt.Errorf("cache.NewServer: %v", err)
+	}
+	if follower != nil {
+		updates := make(chan *cache.Server)
+		go func() {
+			if err := follower.Follow(ctx, s, *followInterval, updates); err != nil && err != context.Canceled {
+				log.Printf("follower.Follow of %s: %v.", c.Prefix, err)
+			}
+		}()
+		opts.Updates = updates
+	}
+	return api.Chain{
+		Prefix:  c.Prefix,
+		Server:  s,
+		Options: opts,
+	}, nil
+}
@@ -1,65 +1,353 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/NebulousLabs/Sia/encoding"
-	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/api"
 	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/mempool"
+	"github.com/starius/sialite/netlib"
+	"github.com/starius/sialite/replication"
+	"github.com/starius/sialite/webhook"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 var (
 	files = flag.String("files", "", "Dir with output of builder")
-	addr  = flag.String("addr", ":35813", "Address to run HTTP server")
+	addr  = flag.String("addr", ":35813", "Comma-separated addresses to run HTTP server (ignored if socket activated)")
 
-	s *cache.Server
+	maxConcurrent    = flag.Int("max_concurrent", 0, "Max number of concurrent requests (0 = no limit)")
+	shutdownTimeout  = flag.Duration("shutdown_timeout", 30*time.Second, "Time to wait for active requests on shutdown")
+	cacheHeaders     = flag.Bool("cache_headers", false, "Send ETag and Cache-Control headers for CDNs and browsers")
+	compress         = flag.Bool("compress", false, "Compress responses with gzip if the client accepts it")
+	prefetchHistory  = flag.Bool("prefetch_history", false, "Prefetch the next page of address history from disk")
+	verifyAddresses  = flag.Bool("verify_addresses", false, "Skip history items of other addresses sharing the address prefix")
+	maxProofLeaves   = flag.Int("max_proof_leaves", 0, "Build proofs of items of blocks with more leaves asynchronously at /v1/proof (0 = no limit)")
+	proofWorkers     = flag.Int("proof_workers", 1, "Number of goroutines building async proofs")
+	noAddressLookups = flag.Bool("no_address_lookups", false, "Refuse lookups of addresses (history, balance, etc); serve block filters and items only")
+	hugePages        = flag.Bool("huge_pages", false, "Advise transparent huge pages for offsets and address index files")
+	warm             = flag.Bool("warm", false, "Read fastmap prefixes and offsets into page cache in background at start")
+	memoryBudget     = flag.Int64("memory_budget", 0, "Max memory of the process in bytes, e.g. the limit of the container; caps caches and releases pages of the index (0 = no limit)")
+	apiKeys          = flag.String("api_keys", "", "JSON file with API keys required to make requests (reloaded on SIGHUP)")
+	labels           = flag.String("labels", "", "JSON file with labels of addresses added to responses (reloaded on SIGHUP)")
+
+	tlsCert         = flag.String("tls_cert", "", "TLS certificate file (serve HTTPS)")
+	tlsKey          = flag.String("tls_key", "", "TLS key file")
+	autocertDomains = flag.String("autocert_domains", "", "Comma-separated domains to get certificates from Let's Encrypt for (serve HTTPS)")
+	autocertCache   = flag.String("autocert_cache", "autocert", "Dir to store certificates from Let's Encrypt")
+	autocertAddr    = flag.String("autocert_addr", "", "Address to serve HTTP-01 challenges and redirects to HTTPS, e.g. :80 (empty = TLS-ALPN-01 only)")
+	trustedProxies  = flag.String("trusted_proxies", "", "Comma-separated addresses or CIDRs of reverse proxies; X-Forwarded-For of their requests is used")
+	rateLimit       = flag.Float64("rate_limit", 0, "Max requests per second of each client address (0 = no limit)")
+	rateBurst       = flag.Int("rate_burst", 10, "Max requests of each client address at once")
+
+	readyCheckInterval = flag.Duration("ready_check_interval", 0, "How often to compare the index with peers for /readyz (0 = do not compare)")
+	readyPeers         = flag.String("ready_peers", "", "Comma-separated peers to compare the index with (empty = random bootstrap peers)")
+	readyNumPeers      = flag.Int("ready_num_peers", 3, "Number of random bootstrap peers to compare the index with")
+	readyMaxBehind     = flag.Int("ready_max_behind", 6, "Max number of blocks the index can be behind peers to be ready")
+
+	mempoolFile   = flag.String("mempool", "", "File to persist mempool (empty = no mempool)")
+	mempoolMaxAge = flag.Duration("mempool_max_age", 24*time.Hour, "Max age of mempool transactions")
+	source        = flag.String("source", "", "Source of relayed transactions (siad node)")
+
+	replicate      = flag.Bool("replicate", false, "Serve segments of new blocks to followers")
+	leader         = flag.String("leader", "", "URL of leader to follow (empty = not a follower)")
+	deltas         = flag.String("deltas", "", "URL of delta files to follow (alternative to -leader)")
+	followInterval = flag.Duration("follow_interval", 30*time.Second, "How often to poll the leader")
+	followMemLimit = flag.Int("follow_mem_limit", 1024*1024*1024, "Memory limit of rebuilding the index")
+
+	otlpEndpoint    = flag.String("otlp_endpoint", "", "host:port of OpenTelemetry collector to export traces and metrics of requests over OTLP/HTTP (empty = no telemetry)")
+	otlpInsecure    = flag.Bool("otlp_insecure", false, "Export telemetry over HTTP instead of HTTPS")
+	traceSampleRate = flag.Float64("trace_sample_rate", 0.01, "Fraction of requests to trace")
+
+	webhooks     = flag.String("webhooks", "", "File to persist webhooks (empty = no webhooks)")
+	webhookHosts = flag.String("webhook_hosts", "", "Comma-separated hosts allowed in URLs of webhooks (empty = any host, requires -api_keys)")
+
+	chains = flag.String("chains", "", "JSON file with more chains to serve under route prefixes: [{\"Prefix\": \"/testnet\", \"Files\": \"dir\", \"Leader\": \"\", \"Deltas\": \"\"}]")
+
+	checkpoint = flag.String("checkpoint", "", "height:blockID to index recent blocks from first if -files is empty; the full index is built in background")
 )
 
-func handler(w http.ResponseWriter, r *http.Request) {
-	addressHex := r.URL.Query().Get("address")
-	var address types.UnlockHash
-	if err := address.LoadString(addressHex); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "address.LoadString(%q): %v.\n", addressHex, err)
-		log.Printf("address.LoadString(%q): %v.\n", addressHex, err)
-		return
-	}
-	addressBytes := address[:]
-	history, next, err := s.GetHistory(addressBytes, "")
+func runMempool(ctx context.Context, mp *mempool.Mempool) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := mp.Save(); err != nil {
+					log.Printf("mempool.Save: %v.", err)
+				}
+			}
+		}
+	}()
+	sess, _, err := netlib.OpenOrConnect(ctx, "", *source)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "GetHistory: %v.\n", err)
-		log.Printf("GetHistory: %v.\n", err)
+		log.Printf("netlib.OpenOrConnect: %v. Mempool is not updated.", err)
 		return
 	}
-	if len(history) == 0 {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "Not found.\n")
-		log.Printf("Not found.\n")
-		return
+	if err := netlib.ServeRelayedTransactions(ctx, sess, mp.Add); err != nil && err != context.Canceled {
+		log.Printf("netlib.ServeRelayedTransactions: %v.", err)
+	}
+}
+
+func tlsConfig() (*tls.Config, error) {
+	if *tlsCert != "" && *autocertDomains != "" {
+		return nil, fmt.Errorf("-tls_cert and -autocert_domains can not be used together")
 	}
-	l := 8 + len(next) + 8 + len(history)*(8+8+8+8+8+8+8)
-	for _, item := range history {
-		l += len(item.Data) + len(item.MerkleProof)
+	if *tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair: %v", err)
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}, nil
 	}
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", l))
-	w.WriteHeader(http.StatusOK)
-	e := encoding.NewEncoder(w)
-	if err := e.EncodeAll(next, history); err != nil {
-		return
+	if *autocertDomains != "" {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(*autocertDomains, ",")...),
+			Cache:      autocert.DirCache(*autocertCache),
+		}
+		if *autocertAddr != "" {
+			go func() {
+				log.Fatal(http.ListenAndServe(*autocertAddr, m.HTTPHandler(nil)))
+			}()
+		}
+		return m.TLSConfig(), nil
 	}
+	return nil, nil
 }
 
 func main() {
 	flag.Parse()
-	s1, err := cache.NewServer(*files)
+	var follower *replication.Follower
+	var source replication.Source
+	if *leader != "" {
+		source = replication.NewLeaderSource(*leader, nil)
+	} else if *deltas != "" {
+		source = replication.NewDeltaSource(*deltas, nil)
+	}
+	if source != nil {
+		follower = &replication.Follower{
+			Source:   source,
+			Dir:      *files,
+			MemLimit: *followMemLimit,
+		}
+		if _, err := os.Stat(path.Join(*files, "parameters.json")); os.IsNotExist(err) {
+			log.Printf("Downloading the index.")
+			if _, err := follower.Sync(context.Background(), nil); err != nil {
+				log.Fatalf("follower.Sync: %v", err)
+			}
+		}
+	}
+	var updates chan *cache.Server
+	var s *cache.Server
+	var err error
+	if _, statErr := os.Stat(path.Join(*files, "parameters.json")); *checkpoint != "" && os.IsNotExist(statErr) {
+		if follower != nil {
+			log.Fatalf("-checkpoint can not be used with -leader or -deltas")
+		}
+		updates = make(chan *cache.Server)
+		s, err = syncBackwards(context.Background(), *files, *checkpoint, *followMemLimit, updates)
+		if err != nil {
+			log.Fatalf("syncBackwards: %v", err)
+		}
+	} else {
+		s, err = cache.NewServer(*files)
+		if err != nil {
+			log.Fatalf("cache.NewServer: %v", err)
+		}
+	}
+	if *warm {
+		// s is retired when it is replaced by updates.
+		s.Acquire()
+		go func(s *cache.Server) {
+			defer s.Release()
+			report := s.Warm()
+			log.Printf("Warmed %d bytes in %s.", report.Bytes, report.Duration)
+		}(s)
+	}
+	listeners, err := api.ListenAll(*addr)
 	if err != nil {
-		log.Fatalf("cache.NewServer: %v", err)
+		log.Fatalf("api.ListenAll: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Got %s, draining connections.", sig)
+		cancel()
+	}()
+	opts := api.Options{
+		MaxConcurrentRequests: *maxConcurrent,
+		ShutdownTimeout:       *shutdownTimeout,
+		Replication:           *replicate,
+		CacheHeaders:          *cacheHeaders,
+		Compress:              *compress,
+		PrefetchHistory:       *prefetchHistory,
+		VerifyAddresses:       *verifyAddresses,
+		HugePages:             *hugePages,
+		MemoryBudget:          *memoryBudget,
+		NoAddressLookups:      *noAddressLookups,
+		MaxProofLeaves:        *maxProofLeaves,
+		ProofWorkers:          *proofWorkers,
+		RateLimit:             *rateLimit,
+		RateBurst:             *rateBurst,
+	}
+	if *otlpEndpoint != "" {
+		tel, err := newTelemetry(context.Background(), *otlpEndpoint, *otlpInsecure, *traceSampleRate)
+		if err != nil {
+			log.Fatalf("newTelemetry: %v", err)
+		}
+		defer func() {
+			if err := tel.shutdown(context.Background()); err != nil {
+				log.Printf("Telemetry shutdown: %v.", err)
+			}
+		}()
+		opts.TracerProvider = tel.tracerProvider
+		opts.MeterProvider = tel.meterProvider
+	}
+	if opts.TrustedProxies, err = api.ParseTrustedProxies(*trustedProxies); err != nil {
+		log.Fatalf("api.ParseTrustedProxies: %v", err)
+	}
+	if opts.TLSConfig, err = tlsConfig(); err != nil {
+		log.Fatalf("tlsConfig: %v", err)
+	}
+	if *readyCheckInterval != 0 {
+		opts.SyncCheck = &api.SyncCheck{
+			NumPeers:    *readyNumPeers,
+			MaxBehind:   *readyMaxBehind,
+			Interval:    *readyCheckInterval,
+			DialOptions: netlib.DefaultDialOptions,
+		}
+		if *readyPeers != "" {
+			opts.SyncCheck.Peers = strings.Split(*readyPeers, ",")
+		}
+	}
+	if follower != nil {
+		updates = make(chan *cache.Server)
+		go func() {
+			if err := follower.Follow(ctx, s, *followInterval, updates); err != nil && err != context.Canceled {
+				log.Printf("follower.Follow: %v.", err)
+			}
+		}()
+	}
+	if updates != nil {
+		opts.Updates = updates
+	}
+	if *apiKeys != "" {
+		if opts.Keys, err = api.LoadKeys(*apiKeys); err != nil {
+			log.Fatalf("api.LoadKeys: %v", err)
+		}
+	}
+	if *labels != "" {
+		if opts.Labels, err = api.LoadLabels(*labels); err != nil {
+			log.Fatalf("api.LoadLabels: %v", err)
+		}
+	}
+	if opts.Keys != nil || opts.Labels != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if opts.Keys != nil {
+					if err := opts.Keys.Reload(); err != nil {
+						log.Printf("Reloading API keys: %v.", err)
+					} else {
+						log.Printf("Reloaded API keys.")
+					}
+				}
+				if opts.Labels != nil {
+					if err := opts.Labels.Reload(); err != nil {
+						log.Printf("Reloading labels: %v.", err)
+					} else {
+						log.Printf("Reloaded labels.")
+					}
+				}
+			}
+		}()
+	}
+	if *webhooks != "" {
+		if *webhookHosts == "" && opts.Keys == nil {
+			log.Fatalf("-webhooks requires -webhook_hosts or -api_keys")
+		}
+		if opts.Webhooks, err = webhook.Open(*webhooks, nil); err != nil {
+			log.Fatalf("webhook.Open: %v", err)
+		}
+		if *webhookHosts != "" {
+			opts.Webhooks.SetAllowedHosts(strings.Split(*webhookHosts, ","))
+		}
+	}
+	if *mempoolFile != "" {
+		mp, err := mempool.Open(*mempoolFile, *mempoolMaxAge)
+		if err != nil {
+			log.Fatalf("mempool.Open: %v", err)
+		}
+		opts.Mempool = mp
+		go runMempool(ctx, mp)
+	}
+	if *chains == "" {
+		if err := api.ServeListeners(ctx, listeners, s, opts); err != nil {
+			log.Fatalf("api.ServeListeners: %v", err)
+		}
+	} else {
+		configs, err := readChainConfigs(*chains)
+		if err != nil {
+			log.Fatalf("readChainConfigs: %v", err)
+		}
+		all := []api.Chain{{Server: s, Options: opts}}
+		chainOpts := api.Options{
+			CacheHeaders:     opts.CacheHeaders,
+			Compress:         opts.Compress,
+			PrefetchHistory:  opts.PrefetchHistory,
+			VerifyAddresses:  opts.VerifyAddresses,
+			HugePages:        opts.HugePages,
+			NoAddressLookups: opts.NoAddressLookups,
+			MaxProofLeaves:   opts.MaxProofLeaves,
+			ProofWorkers:     opts.ProofWorkers,
+			Keys:             opts.Keys,
+			TracerProvider:   opts.TracerProvider,
+			MeterProvider:    opts.MeterProvider,
+		}
+		for _, c := range configs {
+			chain, err := openChain(ctx, c, chainOpts)
+			if err != nil {
+				log.Fatalf("openChain(%s): %v", c.Prefix, err)
+			}
+			if chain.Options.Updates == nil {
+				// Otherwise the API closes the current index.
+				defer chain.Server.Close()
+			}
+			all = append(all, chain)
+		}
+		if err := api.ServeChains(ctx, listeners, all, opts); err != nil {
+			log.Fatalf("api.ServeChains: %v", err)
+		}
+	}
+	if opts.Mempool != nil {
+		if err := opts.Mempool.Close(); err != nil {
+			log.Fatalf("mempool.Close: %v", err)
+		}
+	}
+	// With updates, the API has retired the index it served last.
+	if opts.Updates == nil {
+		if err := s.Close(); err != nil {
+			log.Fatalf("s.Close: %v", err)
+		}
 	}
-	s = s1
-	http.HandleFunc("/v1/history", handler)
-	log.Fatal(http.ListenAndServe(*addr, nil))
 }
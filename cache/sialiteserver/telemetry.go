@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// telemetry exports spans and metrics of requests (see api.Options) to
+// an OpenTelemetry collector over OTLP/HTTP.
+type telemetry struct {
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+}
+
+// newTelemetry returns providers exporting to endpoint ("host:port").
+// sampleRatio is the fraction of traces of requests to export.
+func newTelemetry(ctx context.Context, endpoint string, insecure bool, sampleRatio float64) (*telemetry, error) {
+	res := resource.NewSchemaless(attribute.String("service.name", "sialite"))
+	traceOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+	metricOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(endpoint)}
+	if insecure {
+		traceOpts = append(traceOpts, otlptracehttp.WithInsecure())
+		metricOpts = append(metricOpts, otlpmetrichttp.WithInsecure())
+	}
+	traceExporter, err := otlptracehttp.New(ctx, traceOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlptracehttp.New: %v", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx, metricOpts...)
+	if err != nil {
+		traceExporter.Shutdown(ctx)
+		return nil, fmt.Errorf("otlpmetrichttp.New: %v", err)
+	}
+	return &telemetry{
+		tracerProvider: sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(traceExporter),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+			sdktrace.WithResource(res),
+		),
+		meterProvider: sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+			sdkmetric.WithResource(res),
+		),
+	}, nil
+}
+
+// shutdown exports buffered spans and metrics.
+func (t *telemetry) shutdown(ctx context.Context) error {
+	if err := t.tracerProvider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("TracerProvider.Shutdown: %v", err)
+	}
+	if err := t.meterProvider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("MeterProvider.Shutdown: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	files = flag.String("files", "", "Dir with output of builder")
+)
+
+func main() {
+	flag.Parse()
+	s, err := cache.NewServer(*files)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "\t")
+	if err := e.Encode(s.Stats()); err != nil {
+		log.Fatalf("JSON Encode: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		log.Fatalf("s.Close: %v", err)
+	}
+}
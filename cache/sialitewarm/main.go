@@ -0,0 +1,27 @@
+// sialitewarm pulls the files of the index read by every lookup into
+// page cache, e.g. before starting sialiteserver after a reboot.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	files = flag.String("files", "", "Dir with output of builder")
+)
+
+func main() {
+	flag.Parse()
+	s, err := cache.NewServer(*files)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	report := s.Warm()
+	log.Printf("Warmed %d bytes in %s.", report.Bytes, report.Duration)
+	if err := s.Close(); err != nil {
+		log.Fatalf("s.Close: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"reflect"
+	"strings"
+)
+
+// IndexStats describes the size and the layout of the index.
+// It is used for capacity planning and tuning of Parameters.
+type IndexStats struct {
+	Parameters  Parameters
+	StartHeight int
+	Blocks      int
+	Items       int
+
+	// Sizes of files, bytes.
+	FileSizes map[string]int64
+	TotalSize int64
+
+	// Addresses is the number of unique address prefixes.
+	Addresses int
+	// AddressPages is the number of pages of addressesFastmapData.
+	AddressPages int
+	// AddressPageFill[i] is the number of pages filled by i*10%.
+	// Many pages filled by less than a half mean that the prefixes
+	// of addresses are long for AddressPageLen.
+	AddressPageFill [11]int
+
+	// AddressIndexSize is the total size of the address index files.
+	AddressIndexSize int64
+	// BytesPerAddress is AddressIndexSize divided by Addresses.
+	BytesPerAddress float64
+	// BytesPerItem is TotalSize divided by Items.
+	BytesPerItem float64
+
+	// TopAddresses are address prefixes with the most items, if known
+	// (see Server.TopAddresses).
+	TopAddresses []AddressCount `json:",omitempty"`
+}
+
+// Stats returns IndexStats of the index. It reads the keys of all pages
+// of the address index, so it is not intended for frequent calls.
+func (s *Server) Stats() IndexStats {
+	stats := IndexStats{
+		Parameters:  s.par,
+		StartHeight: s.StartHeight(),
+		Blocks:      s.nblocks,
+		Items:       s.nitems,
+		FileSizes:   make(map[string]int64),
+	}
+	v := reflect.ValueOf(s).Elem()
+	st := v.Type()
+	for i := 0; i < st.NumField(); i++ {
+		ft := st.Field(i)
+		if ft.Type == reflect.TypeOf([]byte{}) {
+			name := strings.ToLower(ft.Name[:1]) + ft.Name[1:]
+			size := int64(v.Field(i).Len())
+			stats.FileSizes[name] = size
+			stats.TotalSize += size
+		}
+	}
+	for _, name := range addressIndexFiles {
+		stats.AddressIndexSize += stats.FileSizes[name]
+	}
+	mapStats := s.addressMap.MapStats()
+	stats.Addresses = mapStats.Records
+	stats.AddressPages = mapStats.Pages
+	stats.AddressPageFill = mapStats.Fill
+	if stats.Addresses != 0 {
+		stats.BytesPerAddress = float64(stats.AddressIndexSize) / float64(stats.Addresses)
+	}
+	if stats.Items != 0 {
+		stats.BytesPerItem = float64(stats.TotalSize) / float64(stats.Items)
+	}
+	stats.TopAddresses = s.topAddresses
+	return stats
+}
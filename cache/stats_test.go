@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	b, s := buildTestIndex(t, "", testParameters(), blocks)
+	var report BuildReport
+	if err := json.Unmarshal(b.MemoryFiles()["build_report.json"], &report); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	stats := s.Stats()
+	if stats.Blocks != report.Blocks || uint64(stats.Items) != report.Items {
+		t.Errorf("Stats() has %d blocks and %d items, want %d and %d", stats.Blocks, stats.Items, report.Blocks, report.Items)
+	}
+	if stats.Addresses != report.Addresses || stats.AddressPages != report.AddressPages || stats.AddressPageFill != report.AddressPageFill {
+		t.Errorf("Stats() has addresses %d, pages %d, fill %v, want %d, %d, %v", stats.Addresses, stats.AddressPages, stats.AddressPageFill, report.Addresses, report.AddressPages, report.AddressPageFill)
+	}
+	for name, size := range report.FileSizes {
+		if stats.FileSizes[name] != size {
+			t.Errorf("Stats().FileSizes[%s] = %d, want %d", name, stats.FileSizes[name], size)
+		}
+	}
+	if stats.BytesPerAddress <= 0 || stats.BytesPerItem <= 0 {
+		t.Errorf("Stats() has BytesPerAddress %f, BytesPerItem %f", stats.BytesPerAddress, stats.BytesPerItem)
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// ioThrottle limits the bandwidth of reads and writes of files of
+// Builder, including temporary files of emsort. It sleeps when more
+// bytes were transferred since start than allowed by the rate.
+type ioThrottle struct {
+	mu sync.Mutex
+
+	// rate is the limit in bytes per second. 0 means no limit.
+	rate  int64
+	start time.Time
+	bytes int64
+
+	// slept is the total time spent sleeping.
+	slept time.Duration
+}
+
+func (t *ioThrottle) setRate(rate int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rate = rate
+	t.start = time.Now()
+	t.bytes = 0
+}
+
+func (t *ioThrottle) wait(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rate <= 0 {
+		return
+	}
+	now := time.Now()
+	t.bytes += int64(n)
+	due := t.start.Add(time.Duration(t.bytes * int64(time.Second) / t.rate))
+	if now.Sub(due) > time.Second {
+		// The builder was busy with something else (e.g. sorting in
+		// memory). Don't let it burst to catch up.
+		t.start = now
+		t.bytes = int64(n)
+		return
+	}
+	if due.After(now) {
+		time.Sleep(due.Sub(now))
+		t.slept += due.Sub(now)
+	}
+}
+
+func (t *ioThrottle) sleptTime() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.slept
+}
+
+// throttledFS wraps files of builderFS into throttledFile.
+type throttledFS struct {
+	builderFS
+	throttle *ioThrottle
+}
+
+func (f throttledFS) open(name string) (builderFile, error) {
+	file, err := f.builderFS.open(name)
+	if err != nil {
+		return nil, err
+	}
+	return throttledFile{file, f.throttle}, nil
+}
+
+func (f throttledFS) create(name string) (builderFile, error) {
+	file, err := f.builderFS.create(name)
+	if err != nil {
+		return nil, err
+	}
+	return throttledFile{file, f.throttle}, nil
+}
+
+type throttledFile struct {
+	builderFile
+	throttle *ioThrottle
+}
+
+func (f throttledFile) Write(p []byte) (int, error) {
+	f.throttle.wait(len(p))
+	return f.builderFile.Write(p)
+}
+
+func (f throttledFile) ReadAt(p []byte, off int64) (int, error) {
+	f.throttle.wait(len(p))
+	return f.builderFile.ReadAt(p, off)
+}
+
+// SetIOLimit limits the bandwidth of disk IO of the builder (bytes per
+// second, writes and reads summed), including temporary files of
+// external sorting, so a rebuild on the machine of a production Server
+// does not starve it of disk throughput. 0 removes the limit. The build
+// becomes slower; see BuildReport.IOThrottleDuration. Combine with
+// SetDropPageCache to also keep the page cache of the Server.
+func (s *Builder) SetIOLimit(bytesPerSecond int64) {
+	s.throttle.setRate(bytesPerSecond)
+}
@@ -0,0 +1,23 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIOThrottle(t *testing.T) {
+	var throttle ioThrottle
+	throttle.wait(1024 * 1024)
+	if throttle.sleptTime() != 0 {
+		t.Errorf("throttle without rate slept")
+	}
+	throttle.setRate(10 * 1024 * 1024)
+	started := time.Now()
+	for i := 0; i < 10; i++ {
+		throttle.wait(100 * 1024)
+	}
+	elapsed := time.Since(started)
+	if elapsed < 80*time.Millisecond || throttle.sleptTime() < 80*time.Millisecond {
+		t.Errorf("1000 KiB at 10 MiB/s took %s, slept %s", elapsed, throttle.sleptTime())
+	}
+}
@@ -0,0 +1,470 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Tiered is a read-only view of two indices as one index: Cold is the
+// large mmaped index of historical blocks and Hot is a small in-memory
+// index of recent blocks after them (see Tip). Block indices of Tiered
+// cover both: blocks of Hot go after blocks of Cold. Merkle proofs of
+// items refer to headers of the index storing the item.
+type Tiered struct {
+	Cold *Server
+	Hot  *Server // May be nil.
+}
+
+// NewTiered checks that hot extends cold and returns their Tiered view.
+// hot may be nil.
+func NewTiered(cold, hot *Server) (*Tiered, error) {
+	if hot != nil && hot.StartHeight() != cold.StartHeight()+cold.NumBlocks() {
+		return nil, fmt.Errorf("hot index starts at %d, cold index ends at %d", hot.StartHeight(), cold.StartHeight()+cold.NumBlocks())
+	}
+	return &Tiered{Cold: cold, Hot: hot}, nil
+}
+
+func (t *Tiered) NumBlocks() int {
+	n := t.Cold.NumBlocks()
+	if t.Hot != nil {
+		n += t.Hot.NumBlocks()
+	}
+	return n
+}
+
+func (t *Tiered) StartHeight() int {
+	return t.Cold.StartHeight()
+}
+
+// TipHeight returns the height of the last block of both indices.
+func (t *Tiered) TipHeight() int {
+	return t.StartHeight() + t.NumBlocks() - 1
+}
+
+// CheckHeight returns ErrNotYetIndexed if height is after the last
+// block of both indices.
+func (t *Tiered) CheckHeight(height int) error {
+	if height > t.TipHeight() {
+		return ErrNotYetIndexed
+	}
+	return nil
+}
+
+// NumItems returns the number of items of both indices.
+func (t *Tiered) NumItems() int {
+	n := t.Cold.NumItems()
+	if t.Hot != nil {
+		n += t.Hot.NumItems()
+	}
+	return n
+}
+
+// LastItemID returns the ID of the last item of both indices or "" if
+// there are no items. Items with greater IDs are not yet indexed.
+func (t *Tiered) LastItemID() (string, error) {
+	s := t.Cold
+	if t.Hot != nil && t.Hot.NumItems() != 0 {
+		s = t.Hot
+	}
+	if s.NumItems() == 0 {
+		return "", nil
+	}
+	item, err := s.GetItemWithoutProof(s.NumItems() - 1)
+	if err != nil {
+		return "", err
+	}
+	return item.ID, nil
+}
+
+// LastBlockID returns the ID of the last block.
+func (t *Tiered) LastBlockID() (types.BlockID, error) {
+	if t.Hot != nil {
+		return t.Hot.lastBlockID()
+	}
+	return t.Cold.lastBlockID()
+}
+
+// BlockIDs returns IDs of all blocks of both indices.
+func (t *Tiered) BlockIDs() ([]types.BlockID, error) {
+	ids, err := t.Cold.BlockIDs()
+	if err != nil || t.Hot == nil {
+		return ids, err
+	}
+	hotIDs, err := t.Hot.BlockIDs()
+	if err != nil {
+		return nil, err
+	}
+	return append(ids, hotIDs...), nil
+}
+
+// BlockIndexByID returns the block index in Tiered of the block with
+// the ID or ErrNoBlock.
+func (t *Tiered) BlockIndexByID(id types.BlockID) (int, error) {
+	blockIndex, err := t.Cold.BlockIndexByID(id)
+	if err != ErrNoBlock || t.Hot == nil {
+		return blockIndex, err
+	}
+	blockIndex, err = t.Hot.BlockIndexByID(id)
+	if err != nil {
+		return 0, err
+	}
+	return t.Cold.NumBlocks() + blockIndex, nil
+}
+
+// BuildID identifies the contents of both indices.
+func (t *Tiered) BuildID() string {
+	if t.Hot == nil {
+		return t.Cold.BuildID()
+	}
+	return t.Cold.BuildID() + "-" + t.Hot.BuildID()
+}
+
+// Layer returns the index storing the block with given height and the
+// block index of its first block in Tiered, or nil if there is no such
+// block.
+func (t *Tiered) Layer(height int) (*Server, int) {
+	blockIndex := height - t.StartHeight()
+	if blockIndex < 0 {
+		return nil, 0
+	}
+	if blockIndex < t.Cold.NumBlocks() {
+		return t.Cold, 0
+	}
+	if t.Hot != nil && blockIndex < t.NumBlocks() {
+		return t.Hot, t.Cold.NumBlocks()
+	}
+	return nil, 0
+}
+
+// GetBlockHeader returns the header of the block with given block index.
+func (t *Tiered) GetBlockHeader(blockIndex int) (BlockHeader, error) {
+	s, first := t.Layer(t.StartHeight() + blockIndex)
+	if s == nil {
+		return BlockHeader{}, ErrTooLargeBlockIndex
+	}
+	return s.GetBlockHeader(blockIndex - first)
+}
+
+// RawHeaders returns encoded headers (headerSize bytes each, see
+// BlockHeader) of blocks with block indices from start to end.
+func (t *Tiered) RawHeaders(start, end int) ([]byte, error) {
+	if start < 0 || start > end || end > t.NumBlocks() {
+		return nil, ErrTooLargeBlockIndex
+	}
+	headers := make([]byte, 0, (end-start)*headerSize)
+	for blockIndex := start; blockIndex < end; {
+		s, first := t.Layer(t.StartHeight() + blockIndex)
+		layerEnd := first + s.NumBlocks()
+		if layerEnd > end {
+			layerEnd = end
+		}
+		headers = append(headers, s.Headers[(blockIndex-first)*headerSize:(layerEnd-first)*headerSize]...)
+		blockIndex = layerEnd
+	}
+	return headers, nil
+}
+
+// BlockItemInfos is like Server.BlockItemInfos.
+func (t *Tiered) BlockItemInfos(blockIndex int) ([]ItemInfo, error) {
+	s, first := t.Layer(t.StartHeight() + blockIndex)
+	if s == nil {
+		return nil, ErrTooLargeBlockIndex
+	}
+	return s.BlockItemInfos(blockIndex - first)
+}
+
+// GetItemByID is like Server.GetItemByID. Item.Block is the block
+// index in Tiered.
+func (t *Tiered) GetItemByID(text string) (Item, error) {
+	id, err := ParseItemID(text)
+	if err != nil {
+		return Item{}, err
+	}
+	if err := t.CheckHeight(id.Height); err != nil {
+		return Item{}, err
+	}
+	s, first := t.Layer(id.Height)
+	if s == nil {
+		return Item{}, ErrNoItem
+	}
+	item, err := s.GetItemByID(text)
+	if err != nil {
+		return Item{}, err
+	}
+	item.Block += first
+	return item, nil
+}
+
+// GetHistory is like Server.GetHistory, but returns items of both
+// indices. Item.Block and Item.Confirmations refer to Tiered.
+func (t *Tiered) GetHistory(address []byte, start string) (history []Item, next string, err error) {
+	page, err := t.GetHistoryPage(address, start, MAX_HISTORY_SIZE)
+	if err != nil {
+		return nil, "", err
+	}
+	return page.Items, page.Next, nil
+}
+
+// GetHistoryPage is like Server.GetHistoryPage, but returns items of
+// both indices. Item.Block and Item.Confirmations refer to Tiered.
+func (t *Tiered) GetHistoryPage(address []byte, start string, limit int) (ItemPage, error) {
+	return t.GetHistoryPageContext(context.Background(), address, start, limit)
+}
+
+// GetHistoryPageContext is like GetHistoryPage, but makes spans with
+// the Tracer of ctx (see WithTracer).
+func (t *Tiered) GetHistoryPageContext(ctx context.Context, address []byte, start string, limit int) (ItemPage, error) {
+	return t.pageTiered(start, limit, func(s *Server, start string, limit int) (ItemPage, error) {
+		return s.GetHistoryPageContext(ctx, address, start, limit)
+	})
+}
+
+// SearchArbitraryData is like Server.SearchArbitraryData, but returns
+// items of both indices. Item.Block and Item.Confirmations refer to
+// Tiered.
+func (t *Tiered) SearchArbitraryData(prefix []byte) ([]Item, error) {
+	page, err := t.SearchArbitraryDataPage(prefix, "", MAX_HISTORY_SIZE)
+	return page.Items, err
+}
+
+// SearchArbitraryDataPage is like Server.SearchArbitraryDataPage, but
+// returns items of both indices.
+func (t *Tiered) SearchArbitraryDataPage(prefix []byte, start string, limit int) (ItemPage, error) {
+	return t.pageTiered(start, limit, func(s *Server, start string, limit int) (ItemPage, error) {
+		return s.SearchArbitraryDataPage(prefix, start, limit)
+	})
+}
+
+// AddressesOfPublicKey returns StandardUnlockHash of the key followed by
+// other addresses of the key found by PublicKeyAddresses in both indices,
+// up to MAX_PUBLIC_KEY_ADDRESSES addresses. The standard address is
+// included even if it was not spent from, so it may have no history.
+func (t *Tiered) AddressesOfPublicKey(pk crypto.PublicKey) []types.UnlockHash {
+	standard := StandardUnlockHash(pk)
+	addresses := []types.UnlockHash{standard}
+	seen := map[types.UnlockHash]bool{standard: true}
+	found := t.Cold.PublicKeyAddresses(pk)
+	if t.Hot != nil {
+		found = append(found, t.Hot.PublicKeyAddresses(pk)...)
+	}
+	for _, uh := range found {
+		if len(addresses) == MAX_PUBLIC_KEY_ADDRESSES {
+			break
+		}
+		if !seen[uh] {
+			seen[uh] = true
+			addresses = append(addresses, uh)
+		}
+	}
+	return addresses
+}
+
+// GetHistoryByPublicKey returns the history of all addresses returned
+// by AddressesOfPublicKey in the order of the blockchain. Items
+// belonging to several addresses are returned once, with Matches and
+// Roles of the first address.
+func (t *Tiered) GetHistoryByPublicKey(pk crypto.PublicKey) ([]Item, error) {
+	var history []Item
+	seen := make(map[string]bool)
+	for _, uh := range t.AddressesOfPublicKey(pk) {
+		items, _, err := t.GetHistory(uh[:], "")
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if !seen[item.ID] {
+				seen[item.ID] = true
+				history = append(history, item)
+			}
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		if history[i].Block != history[j].Block {
+			return history[i].Block < history[j].Block
+		}
+		return history[i].Index < history[j].Index
+	})
+	return history, nil
+}
+
+// GetHistoryByPublicKeyPage is like GetHistoryByPublicKey, but returns
+// up to limit items starting from the cursor start (see page.go).
+// Total is not known, since items of several addresses may repeat.
+func (t *Tiered) GetHistoryByPublicKeyPage(pk crypto.PublicKey, start string, limit int) (ItemPage, error) {
+	return t.GetHistoryOfAddressesPage(t.AddressesOfPublicKey(pk), start, limit)
+}
+
+// GetHistoryOfAddressesPage returns up to limit items of the merged
+// history of the addresses starting from the cursor start, like
+// GetHistoryByPublicKeyPage.
+func (t *Tiered) GetHistoryOfAddressesPage(addresses []types.UnlockHash, start string, limit int) (ItemPage, error) {
+	var history []Item
+	seen := make(map[string]bool)
+	// next is the earliest cursor of the next pages of addresses.
+	var next string
+	for _, uh := range addresses {
+		page, err := t.GetHistoryPage(uh[:], start, limit)
+		if err != nil {
+			return ItemPage{}, err
+		}
+		for _, item := range page.Items {
+			if !seen[item.ID] {
+				seen[item.ID] = true
+				history = append(history, item)
+			}
+		}
+		if page.Next != "" && (next == "" || cursorLess(page.Next, next)) {
+			next = page.Next
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		if history[i].Block != history[j].Block {
+			return history[i].Block < history[j].Block
+		}
+		return history[i].Index < history[j].Index
+	})
+	// Each address returned all its items before its next cursor, so
+	// the first limit items are complete.
+	if len(history) > limit {
+		next = history[limit].ID
+		history = history[:limit]
+	}
+	return ItemPage{Items: history, Next: next, Total: -1}, nil
+}
+
+// MultisigAddressesOfPublicKey returns addresses of multi-signature
+// unlock conditions with the key found by MultisigAddresses in both
+// indices, up to MAX_PUBLIC_KEY_ADDRESSES addresses.
+func (t *Tiered) MultisigAddressesOfPublicKey(pk crypto.PublicKey) []types.UnlockHash {
+	found := t.Cold.MultisigAddresses(pk)
+	if t.Hot != nil {
+		found = append(found, t.Hot.MultisigAddresses(pk)...)
+	}
+	var addresses []types.UnlockHash
+	seen := make(map[types.UnlockHash]bool)
+	for _, uh := range found {
+		if len(addresses) == MAX_PUBLIC_KEY_ADDRESSES {
+			break
+		}
+		if !seen[uh] {
+			seen[uh] = true
+			addresses = append(addresses, uh)
+		}
+	}
+	return addresses
+}
+
+// HostActivity is like Server.HostActivity, but returns items of both
+// indices. Item.Block and Item.Confirmations refer to Tiered.
+func (t *Tiered) HostActivity(pk crypto.PublicKey) ([]Item, error) {
+	page, err := t.HostActivityPage(pk, "", MAX_HISTORY_SIZE)
+	return page.Items, err
+}
+
+// HostActivityPage is like Server.HostActivityPage, but returns items
+// of both indices.
+func (t *Tiered) HostActivityPage(pk crypto.PublicKey, start string, limit int) (ItemPage, error) {
+	return t.pageTiered(start, limit, func(s *Server, start string, limit int) (ItemPage, error) {
+		return s.HostActivityPage(pk, start, limit)
+	})
+}
+
+// ResolveInputs is like Server.ResolveInputs, but looks up outputs in
+// both indices. ResolvedInput.Block refers to Tiered, Item refers to
+// the index storing the block.
+func (t *Tiered) ResolveInputs(tx *types.Transaction) ([]ResolvedInput, error) {
+	resolved, err := t.Cold.ResolveInputs(tx)
+	if err != nil || t.Hot == nil {
+		return resolved, err
+	}
+	hotResolved, err := t.Hot.ResolveInputs(tx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range resolved {
+		if resolved[i].Output == nil && hotResolved[i].Output != nil {
+			resolved[i] = hotResolved[i]
+			resolved[i].Block += t.Cold.NumBlocks()
+		}
+	}
+	return resolved, nil
+}
+
+// AddressActivity is like Server.AddressActivity, but counts items
+// of both indices.
+func (t *Tiered) AddressActivity(address []byte, bucket int) ([]ActivityBucket, error) {
+	buckets, err := t.Cold.AddressActivity(address, bucket)
+	if err != nil || t.Hot == nil {
+		return buckets, err
+	}
+	hotBuckets, err := t.Hot.AddressActivity(address, bucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range hotBuckets {
+		if n := len(buckets); n != 0 && buckets[n-1].Start >= b.Start {
+			// Find the bucket; timestamps are not monotonic.
+			i := sort.Search(n, func(i int) bool {
+				return buckets[i].Start >= b.Start
+			})
+			if buckets[i].Start == b.Start {
+				buckets[i].Items += b.Items
+				continue
+			}
+			buckets = append(buckets, ActivityBucket{})
+			copy(buckets[i+1:], buckets[i:])
+			buckets[i] = b
+			continue
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// Tiered returns the current index and the index of the tip as Tiered.
+// It is not updated by Add or Merge in progress (see Tip.Updating).
+// Use AcquireTiered if the result is used after a Merge can finish.
+func (t *Tip) Tiered() *Tiered {
+	snapshot := *t.snapshot.Load().(*Tiered)
+	return &snapshot
+}
+
+// AcquireTiered is like Tiered, but pins the indices until
+// Tiered.Release, so the base retired by Merge is not closed meanwhile.
+func (t *Tip) AcquireTiered() *Tiered {
+	for {
+		snapshot := t.Tiered()
+		if snapshot.Acquire() {
+			return snapshot
+		}
+		// Merge has retired the base, so the snapshot is replaced.
+	}
+}
+
+// Acquire pins both indices (see Server.Acquire). It returns false if
+// any of them is retired and closed.
+func (t *Tiered) Acquire() bool {
+	if !t.Cold.Acquire() {
+		return false
+	}
+	if t.Hot != nil && !t.Hot.Acquire() {
+		t.Cold.Release()
+		return false
+	}
+	return true
+}
+
+// Release unpins the indices pinned by Acquire.
+func (t *Tiered) Release() error {
+	err := t.Cold.Release()
+	if t.Hot != nil {
+		if err1 := t.Hot.Release(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
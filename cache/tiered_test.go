@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// buildTestTiers builds the index of all blocks (full), the index of
+// the first ncold blocks (cold) and the index of the rest (hot).
+func buildTestTiers(t *testing.T, blocks []*types.Block, ncold int) (full, cold, hot *Server) {
+	p := testParameters()
+	full = buildTestServer(t, p, blocks)
+	cold = buildTestServer(t, p, blocks[:ncold])
+	p.StartHeight = ncold
+	parentID := blocks[ncold-1].ID()
+	p.StartParentID = &parentID
+	hot = buildTestServer(t, p, blocks[ncold:])
+	return full, cold, hot
+}
+
+func TestTiered(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	const ncold = 900
+	full, cold, hot := buildTestTiers(t, blocks, ncold)
+	if _, err := NewTiered(hot, cold); err == nil {
+		t.Errorf("NewTiered accepted hot index which does not extend cold")
+	}
+	tiered, err := NewTiered(cold, hot)
+	if err != nil {
+		t.Fatalf("NewTiered: %v", err)
+	}
+	if tiered.NumBlocks() != full.NumBlocks() {
+		t.Errorf("NumBlocks() = %d, want %d", tiered.NumBlocks(), full.NumBlocks())
+	}
+	if last, err := tiered.LastBlockID(); err != nil || last != blocks[len(blocks)-1].ID() {
+		t.Errorf("LastBlockID() = %v, %v; want %v", last, err, blocks[len(blocks)-1].ID())
+	}
+	if ids, err := tiered.BlockIDs(); err != nil || len(ids) != len(blocks) || ids[ncold] != blocks[ncold].ID() {
+		t.Errorf("BlockIDs() returned %d IDs, %v", len(ids), err)
+	}
+	for blockIndex := 0; blockIndex < full.NumBlocks(); blockIndex++ {
+		want, err := full.GetBlockHeader(blockIndex)
+		if err != nil {
+			t.Fatalf("GetBlockHeader: %v", err)
+		}
+		if got, err := tiered.GetBlockHeader(blockIndex); err != nil || got != want {
+			t.Errorf("GetBlockHeader(%d) = %v, %v; want %v", blockIndex, got, err, want)
+		}
+	}
+	_, _, nitems, err := full.GetBlockItems(full.NumBlocks() - 1)
+	if err != nil {
+		t.Fatalf("GetBlockItems: %v", err)
+	}
+	for itemIndex := 0; itemIndex < nitems; itemIndex += 7 {
+		want, err := full.GetItemWithoutProof(itemIndex)
+		if err != nil {
+			t.Fatalf("GetItemWithoutProof: %v", err)
+		}
+		got, err := tiered.GetItemByID(want.ID)
+		if err != nil {
+			t.Fatalf("GetItemByID(%s): %v", want.ID, err)
+		}
+		if got.Block != want.Block || !bytes.Equal(got.Data, want.Data) {
+			t.Errorf("GetItemByID(%s) returned item %s of block %d", want.ID, got.ID, got.Block)
+		}
+	}
+}
+
+func TestHistoryPages(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	const ncold = 900
+	full, cold, hot := buildTestTiers(t, blocks, ncold)
+	tiered, err := NewTiered(cold, hot)
+	if err != nil {
+		t.Fatalf("NewTiered: %v", err)
+	}
+	// collect pages through the whole history.
+	collect := func(page func(start string) (ItemPage, error)) ([]string, int) {
+		var ids []string
+		start := ""
+		total := 0
+		for {
+			p, err := page(start)
+			if err != nil {
+				t.Fatalf("page(%q): %v", start, err)
+			}
+			total = p.Total
+			for _, item := range p.Items {
+				ids = append(ids, item.ID)
+			}
+			if p.Next == "" {
+				return ids, total
+			}
+			if len(p.Items) == 0 {
+				t.Fatalf("page(%q) is empty, but has next page", start)
+			}
+			start = p.Next
+		}
+	}
+	seen := make(map[types.UnlockHash]bool)
+	multipage := 0
+	for _, block := range blocks {
+		for _, mp := range block.MinerPayouts {
+			uh := mp.UnlockHash
+			if seen[uh] {
+				continue
+			}
+			seen[uh] = true
+			all, err := full.GetHistoryPage(uh[:], "", len(blocks)*10)
+			if err != nil {
+				t.Fatalf("GetHistoryPage: %v", err)
+			}
+			if all.Next != "" || all.Total != len(all.Items) {
+				t.Errorf("GetHistoryPage returned %d items of %d, next %q", len(all.Items), all.Total, all.Next)
+			}
+			var want []string
+			for _, item := range all.Items {
+				want = append(want, item.ID)
+			}
+			if len(want) > 1 {
+				multipage++
+			}
+			got, total := collect(func(start string) (ItemPage, error) {
+				return full.GetHistoryPage(uh[:], start, 1)
+			})
+			if !reflect.DeepEqual(got, want) || total != len(want) {
+				t.Errorf("pages of Server: got %v (total %d), want %v", got, total, want)
+			}
+			got, total = collect(func(start string) (ItemPage, error) {
+				return tiered.GetHistoryPage(uh[:], start, 1)
+			})
+			if !reflect.DeepEqual(got, want) || total != len(want) {
+				t.Errorf("pages of Tiered: got %v (total %d), want %v", got, total, want)
+			}
+		}
+	}
+	if multipage == 0 {
+		t.Errorf("no address has several items")
+	}
+	if _, err := full.GetHistoryPage(blocks[1].MinerPayouts[0].UnlockHash[:], "bad", 1); err != ErrBadCursor {
+		t.Errorf("GetHistoryPage(bad cursor) returned %v, want ErrBadCursor", err)
+	}
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// File timelocks is a sorted list of unique records: unlock hash and
+// timelock (8 bytes, big endian) of unlock conditions with non-zero
+// timelock seen in inputs. An output can not be spent before the height
+// of the timelock of its address. The timelock is a part of the unlock
+// conditions, so it is known only after an output of the address was
+// spent; addresses without records are assumed to have no timelock.
+const timelockRecordSize = crypto.HashSize + 8
+
+func (s *Builder) writeTimelocks(tx *types.Transaction) error {
+	write := func(uc *types.UnlockConditions) error {
+		if uc.Timelock == 0 {
+			return nil
+		}
+		uh := uc.UnlockHash()
+		copy(s.timelockBuf, uh[:])
+		binary.BigEndian.PutUint64(s.timelockBuf[crypto.HashSize:], uint64(uc.Timelock))
+		if n, err := s.timelocks.Write(s.timelockBuf); err != nil {
+			return err
+		} else if n != timelockRecordSize {
+			return io.ErrShortWrite
+		}
+		return nil
+	}
+	for i := range tx.SiacoinInputs {
+		if err := write(&tx.SiacoinInputs[i].UnlockConditions); err != nil {
+			return err
+		}
+	}
+	for i := range tx.SiafundInputs {
+		if err := write(&tx.SiafundInputs[i].UnlockConditions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddressTimelock returns the timelock of the address, if it is known.
+func (s *Server) AddressTimelock(address types.UnlockHash) (types.BlockHeight, bool) {
+	n := len(s.Timelocks) / timelockRecordSize
+	i := sort.Search(n, func(i int) bool {
+		uh := s.Timelocks[i*timelockRecordSize : i*timelockRecordSize+crypto.HashSize]
+		return bytes.Compare(uh, address[:]) >= 0
+	})
+	if i == n {
+		return 0, false
+	}
+	record := s.Timelocks[i*timelockRecordSize : (i+1)*timelockRecordSize]
+	if !bytes.Equal(record[:crypto.HashSize], address[:]) {
+		return 0, false
+	}
+	return types.BlockHeight(binary.BigEndian.Uint64(record[crypto.HashSize:])), true
+}
+
+// spendableHeight returns the height of the first block which can
+// include a transaction spending the output of the address created by
+// the block with given index. Miner payouts mature after
+// types.MaturityDelay blocks.
+func (s *Server) spendableHeight(address types.UnlockHash, blockIndex int, minerPayout bool) int {
+	height := s.StartHeight() + blockIndex
+	if minerPayout {
+		height += int(types.MaturityDelay) + 1
+	}
+	if timelock, has := s.AddressTimelock(address); has && int(timelock) > height {
+		height = int(timelock)
+	}
+	return height
+}
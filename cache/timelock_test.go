@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestTimelocks(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	locked := types.UnlockConditions{
+		Timelock:           500,
+		PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(crypto.PublicKey{1})},
+		SignaturesRequired: 1,
+	}
+	plain := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(crypto.PublicKey{2})},
+		SignaturesRequired: 1,
+	}
+	block1 := &types.Block{
+		ParentID:     blocks[0].ID(),
+		Timestamp:    types.Timestamp(1433600001),
+		MinerPayouts: []types.SiacoinOutput{{Value: types.NewCurrency64(7), UnlockHash: plain.UnlockHash()}},
+		Transactions: []types.Transaction{
+			{
+				SiacoinInputs:  []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}, UnlockConditions: locked}},
+				SiacoinOutputs: []types.SiacoinOutput{{Value: types.NewCurrency64(10), UnlockHash: locked.UnlockHash()}},
+			},
+		},
+	}
+	s := buildTestServer(t, testParameters(), []*types.Block{blocks[0], block1})
+	if timelock, has := s.AddressTimelock(locked.UnlockHash()); !has || timelock != 500 {
+		t.Errorf("AddressTimelock(locked) = %d, %v; want 500, true", timelock, has)
+	}
+	if _, has := s.AddressTimelock(plain.UnlockHash()); has {
+		t.Errorf("AddressTimelock(plain) returned a timelock")
+	}
+	balance, err := s.GetBalanceDetailsAt(locked.UnlockHash(), 1)
+	if err != nil {
+		t.Fatalf("GetBalanceDetailsAt: %v", err)
+	}
+	if len(balance.Outputs) != 1 || balance.Outputs[0].SpendableHeight != 500 {
+		t.Errorf("GetBalanceDetailsAt(locked) returned outputs %v, want one spendable at 500", balance.Outputs)
+	}
+	if balance.LockedSiacoins.Cmp(types.NewCurrency64(10)) != 0 || balance.UnlockHeight != 500 {
+		t.Errorf("GetBalanceDetailsAt(locked) = %s locked until %d, want 10 until 500", balance.LockedSiacoins, balance.UnlockHeight)
+	}
+	balance, err = s.GetBalanceDetailsAt(plain.UnlockHash(), 1)
+	if err != nil {
+		t.Fatalf("GetBalanceDetailsAt: %v", err)
+	}
+	wantHeight := 1 + int(types.MaturityDelay) + 1
+	if balance.LockedSiacoins.Cmp(types.NewCurrency64(7)) != 0 || balance.UnlockHeight != wantHeight {
+		t.Errorf("GetBalanceDetailsAt(plain) = %s locked until %d, want 7 until %d", balance.LockedSiacoins, balance.UnlockHeight, wantHeight)
+	}
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// tipMemLimit is the memory limit of the builder of the tip index.
+const tipMemLimit = 16 * 1024 * 1024
+
+var ErrTipNotConnected = fmt.Errorf("block is not a child of the index or of a block of the tip")
+
+// Tip keeps the most recent blocks, which are not in the immutable index
+// yet, in memory and in a write-ahead log. New blocks are served right
+// after Add from a small in-memory index (see Servers). Reorgs replacing
+// blocks of the tip are handled in the log and never touch the files of
+// the immutable index. Blocks deeper than depth are appended to the
+// immutable index by Merge.
+//
+// The log is a sequence of records: 8 bytes of length followed by the
+// Sia-encoded block. On open the records are replayed with Add.
+//
+// Readers never wait for Add or Merge, which can take minutes to append
+// blocks to the immutable index: Servers and Tiered return the indices
+// published by the last finished update, so while an update is in
+// progress (see Updating) they are stale, but consistent.
+// Tip is safe for concurrent use.
+type Tip struct {
+	// mu serializes updates.
+	mu sync.Mutex
+
+	// snapshot is *Tiered published by the last update.
+	snapshot atomic.Value
+	updating int32
+
+	base   *Server
+	baseID types.BlockID
+	depth  int
+
+	path string
+	wal  *os.File
+
+	blocks []types.Block
+	server *Server
+}
+
+// OpenTip opens or creates the log of the tip on top of base.
+// Blocks of the log which do not extend base (e.g. merged into base
+// before a crash) are skipped.
+func OpenTip(base *Server, path string, depth int) (*Tip, error) {
+	baseID, err := base.lastBlockID()
+	if err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tip{
+		base:   base,
+		baseID: baseID,
+		depth:  depth,
+		path:   path,
+		wal:    wal,
+	}
+	data, err := ioutil.ReadAll(wal)
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+	pos := 0
+	for pos+8 <= len(data) {
+		size64 := binary.LittleEndian.Uint64(data[pos : pos+8])
+		if size64 > types.BlockSizeLimit || pos+8+int(size64) > len(data) {
+			break
+		}
+		size := int(size64)
+		var block types.Block
+		if err := encoding.Unmarshal(data[pos+8:pos+8+size], &block); err != nil {
+			wal.Close()
+			return nil, fmt.Errorf("decoding block of the log: %v", err)
+		}
+		// Errors are ErrTipNotConnected, the block is skipped.
+		t.connect(&block)
+		pos += 8 + size
+	}
+	// Remove a partial record left by a crash during Add.
+	if pos != len(data) {
+		if err := wal.Truncate(int64(pos)); err != nil {
+			wal.Close()
+			return nil, err
+		}
+	}
+	if _, err := wal.Seek(int64(pos), io.SeekStart); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	if err := t.rebuild(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// lastBlockID returns the ID of the last block of the index.
+func (s *Server) lastBlockID() (types.BlockID, error) {
+	if s.nblocks == 0 {
+		return s.firstParentID(), nil
+	}
+	ids, err := s.blockIDs()
+	if err != nil {
+		return types.BlockID{}, err
+	}
+	return ids[len(ids)-1], nil
+}
+
+// connect adds the block to t.blocks, reverting blocks of the tip
+// which are not ancestors of the block. It returns false if the block
+// is already in the tip.
+func (t *Tip) connect(block *types.Block) (bool, error) {
+	id := block.ID()
+	for i := len(t.blocks) - 1; i >= 0; i-- {
+		blockID := t.blocks[i].ID()
+		if blockID == id {
+			return false, nil
+		}
+		if blockID == block.ParentID {
+			t.blocks = append(t.blocks[:i+1], *block)
+			return true, nil
+		}
+	}
+	if block.ParentID == t.baseID {
+		t.blocks = append(t.blocks[:0], *block)
+		return true, nil
+	}
+	return false, ErrTipNotConnected
+}
+
+// rebuild builds the index of the tip.
+func (t *Tip) rebuild() error {
+	if len(t.blocks) == 0 {
+		t.server = nil
+		t.publish()
+		return nil
+	}
+	p := t.base.par
+	p.StartHeight = t.base.StartHeight() + t.base.NumBlocks()
+	baseID := t.baseID
+	p.StartParentID = &baseID
+	b, err := NewMemoryBuilderFromParameters(tipMemLimit, p)
+	if err != nil {
+		return err
+	}
+	for i := range t.blocks {
+		if err := b.Add(&t.blocks[i]); err != nil {
+			return err
+		}
+	}
+	if err := b.Close(); err != nil {
+		return err
+	}
+	server, err := NewServerFromBytes(b.MemoryFiles())
+	if err != nil {
+		return err
+	}
+	server.verifyAddresses = t.base.verifyAddresses
+	t.server = server
+	t.publish()
+	return nil
+}
+
+// publish makes the indices visible to readers.
+func (t *Tip) publish() {
+	// The index of the tip always extends the base.
+	t.snapshot.Store(&Tiered{Cold: t.base, Hot: t.server})
+}
+
+// beginUpdate marks the snapshot as stale until the returned function
+// is called.
+func (t *Tip) beginUpdate() func() {
+	atomic.StoreInt32(&t.updating, 1)
+	return func() {
+		atomic.StoreInt32(&t.updating, 0)
+	}
+}
+
+// Updating returns if Add or Merge is in progress, so the indices
+// returned by Servers and Tiered may miss blocks being added.
+func (t *Tip) Updating() bool {
+	return atomic.LoadInt32(&t.updating) != 0
+}
+
+func writeRecord(w io.Writer, block *types.Block) error {
+	data := encoding.Marshal(*block)
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(data)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// Add adds the block to the tip. Its parent must be the last block of
+// the immutable index or any block of the tip; in the latter case the
+// blocks after the parent are reverted. The block is written to the
+// log and synced before Add returns.
+func (t *Tip) Add(block *types.Block) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.beginUpdate()()
+	if added, err := t.connect(block); err != nil {
+		return err
+	} else if !added {
+		return nil
+	}
+	if err := writeRecord(t.wal, block); err != nil {
+		return fmt.Errorf("writing the log: %v", err)
+	}
+	if err := t.wal.Sync(); err != nil {
+		return fmt.Errorf("syncing the log: %v", err)
+	}
+	return t.rebuild()
+}
+
+// Servers returns the immutable index and the index of the tip.
+// The index of the tip is nil if the tip is empty. Block i of the
+// tip has index base.NumBlocks()+i in the chain of the two indices.
+// They are not updated by Add or Merge in progress.
+func (t *Tip) Servers() (base, tip *Server) {
+	snapshot := t.snapshot.Load().(*Tiered)
+	return snapshot.Cold, snapshot.Hot
+}
+
+// Merge appends blocks of the tip deeper than depth to the immutable
+// index in dir (the directory of the base server) and rewrites the log
+// with the remaining blocks. It returns the new immutable index or nil
+// if nothing was merged. Readers use the old base server until Merge
+// publishes the new one; then it is retired (see Server.Retire), so it
+// is closed when readers pinning it with AcquireTiered release it.
+func (t *Tip) Merge(dir string, memLimit int) (*Server, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.beginUpdate()()
+	n := len(t.blocks) - t.depth
+	if n <= 0 {
+		return nil, nil
+	}
+	b, err := OpenBuilder(dir, memLimit)
+	if err != nil {
+		return nil, fmt.Errorf("OpenBuilder: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if err := b.Add(&t.blocks[i]); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+	if err := b.Close(); err != nil {
+		return nil, fmt.Errorf("Builder.Close: %v", err)
+	}
+	base, err := NewServer(dir)
+	if err != nil {
+		return nil, fmt.Errorf("NewServer: %v", err)
+	}
+	old := t.base
+	t.base = base
+	t.baseID = t.blocks[n-1].ID()
+	t.blocks = append([]types.Block(nil), t.blocks[n:]...)
+	// If the process crashes before the log is rewritten, merged
+	// blocks are skipped by OpenTip.
+	if err := t.rewriteLog(); err != nil {
+		return nil, fmt.Errorf("rewriting the log: %v", err)
+	}
+	if err := t.rebuild(); err != nil {
+		return nil, err
+	}
+	if err := old.Retire(); err != nil {
+		return nil, fmt.Errorf("closing the old index: %v", err)
+	}
+	return base, nil
+}
+
+// rewriteLog replaces the log with records of t.blocks atomically.
+func (t *Tip) rewriteLog() error {
+	tmpPath := t.path + newSuffix
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	for i := range t.blocks {
+		if err := writeRecord(f, &t.blocks[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := os.Rename(tmpPath, t.path); err != nil {
+		f.Close()
+		return err
+	}
+	t.wal.Close()
+	t.wal = f
+	return nil
+}
+
+func (t *Tip) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.wal.Close()
+}
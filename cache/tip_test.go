@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestTip(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestTip")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	indexDir := filepath.Join(dir, "index")
+	if err := os.Mkdir(indexDir, 0755); err != nil {
+		t.Fatalf("os.Mkdir: %v", err)
+	}
+	const nbase, ntip, depth = 900, 50, 10
+	_, base := buildTestIndex(t, indexDir, testParameters(), blocks[:nbase])
+	walPath := filepath.Join(dir, "tip.wal")
+	tip, err := OpenTip(base, walPath, depth)
+	if err != nil {
+		t.Fatalf("OpenTip: %v", err)
+	}
+	if err := tip.Add(blocks[nbase+1]); err != ErrTipNotConnected {
+		t.Errorf("tip.Add(not connected): want ErrTipNotConnected, got %v", err)
+	}
+	for _, block := range blocks[nbase : nbase+ntip] {
+		if err := tip.Add(block); err != nil {
+			t.Fatalf("tip.Add: %v", err)
+		}
+	}
+	// Replace the last 9 blocks with another block.
+	fork := *blocks[nbase+ntip-9]
+	fork.Nonce[0]++
+	if err := tip.Add(&fork); err != nil {
+		t.Fatalf("tip.Add(fork): %v", err)
+	}
+	checkTip := func(wantBase, wantTip int, wantLast types.BlockID) {
+		base, ts := tip.Servers()
+		if base.NumBlocks() != wantBase {
+			t.Errorf("base has %d blocks, want %d", base.NumBlocks(), wantBase)
+		}
+		if ts == nil {
+			t.Fatalf("tip index is nil")
+		}
+		if ts.NumBlocks() != wantTip || ts.StartHeight() != wantBase {
+			t.Errorf("tip has %d blocks from %d, want %d from %d", ts.NumBlocks(), ts.StartHeight(), wantTip, wantBase)
+		}
+		last, err := ts.lastBlockID()
+		if err != nil {
+			t.Fatalf("lastBlockID: %v", err)
+		}
+		if last != wantLast {
+			t.Errorf("last block of tip is %s, want %s", last, wantLast)
+		}
+	}
+	checkTip(nbase, ntip-8, fork.ID())
+	if err := tip.Close(); err != nil {
+		t.Fatalf("tip.Close: %v", err)
+	}
+	// Simulate a crash during Add.
+	f, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("os.OpenFile: %v", err)
+	}
+	if _, err := f.Write([]byte{100, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3}); err != nil {
+		t.Fatalf("f.Write: %v", err)
+	}
+	f.Close()
+	if tip, err = OpenTip(base, walPath, depth); err != nil {
+		t.Fatalf("OpenTip: %v", err)
+	}
+	checkTip(nbase, ntip-8, fork.ID())
+	merged, err := tip.Merge(indexDir, 1024*1024)
+	if err != nil {
+		t.Fatalf("tip.Merge: %v", err)
+	}
+	if merged == nil || merged.NumBlocks() != nbase+ntip-8-depth {
+		t.Fatalf("tip.Merge did not merge %d blocks", ntip-8-depth)
+	}
+	checkTip(nbase+ntip-8-depth, depth, fork.ID())
+	if err := tip.Close(); err != nil {
+		t.Fatalf("tip.Close: %v", err)
+	}
+	if tip, err = OpenTip(merged, walPath, depth); err != nil {
+		t.Fatalf("OpenTip: %v", err)
+	}
+	defer tip.Close()
+	checkTip(nbase+ntip-8-depth, depth, fork.ID())
+}
+
+func TestTipStaleWhileUpdating(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestTipStaleWhileUpdating")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	indexDir := filepath.Join(dir, "index")
+	if err := os.Mkdir(indexDir, 0755); err != nil {
+		t.Fatalf("os.Mkdir: %v", err)
+	}
+	const nbase, ntip, depth = 900, 30, 5
+	_, base := buildTestIndex(t, indexDir, testParameters(), blocks[:nbase])
+	tip, err := OpenTip(base, filepath.Join(dir, "tip.wal"), depth)
+	if err != nil {
+		t.Fatalf("OpenTip: %v", err)
+	}
+	defer tip.Close()
+	for _, block := range blocks[nbase : nbase+ntip] {
+		if err := tip.Add(block); err != nil {
+			t.Fatalf("tip.Add: %v", err)
+		}
+	}
+	if tip.Updating() {
+		t.Errorf("Updating() after Add returned")
+	}
+	wantTip := base.StartHeight() + nbase + ntip - 1
+
+	// Readers do not wait for an update holding the lock.
+	tip.mu.Lock()
+	end := tip.beginUpdate()
+	if !tip.Updating() {
+		t.Errorf("Updating() = false during an update")
+	}
+	if height := tip.Tiered().TipHeight(); height != wantTip {
+		t.Errorf("TipHeight() during an update = %d, want %d", height, wantTip)
+	}
+	end()
+	tip.mu.Unlock()
+
+	// Readers see the old or the new indices during Merge, never a mix.
+	done := make(chan error)
+	go func() {
+		_, err := tip.Merge(indexDir, 1024*1024)
+		done <- err
+	}()
+	for merging := true; merging; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("tip.Merge: %v", err)
+			}
+			merging = false
+		default:
+		}
+		ti := tip.AcquireTiered()
+		if ti.Hot == nil || ti.Hot.StartHeight() != ti.Cold.StartHeight()+ti.Cold.NumBlocks() {
+			t.Fatalf("inconsistent snapshot during Merge")
+		}
+		if ti.TipHeight() != wantTip {
+			t.Fatalf("TipHeight() during Merge = %d, want %d", ti.TipHeight(), wantTip)
+		}
+		// The pinned base is open even if Merge has retired it.
+		if _, err := ti.Cold.GetBlockHeader(0); err != nil {
+			t.Fatalf("GetBlockHeader during Merge: %v", err)
+		}
+		if err := ti.Release(); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+	}
+	if base.Blockchain != nil {
+		t.Errorf("the old base is not closed after Merge")
+	}
+	if tip.Updating() {
+		t.Errorf("Updating() after Merge returned")
+	}
+	if cold, hot := tip.Servers(); cold.NumBlocks() != nbase+ntip-depth || hot.NumBlocks() != depth {
+		t.Errorf("after Merge: %d and %d blocks, want %d and %d", cold.NumBlocks(), hot.NumBlocks(), nbase+ntip-depth, depth)
+	}
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TOP_ADDRESSES is the number of addresses with the most items recorded
+// in BuildReport.TopAddresses. They show the skew of the address index
+// (see MAX_HISTORY_SIZE and Parameters.AddressPageLen) and are the most
+// active addresses of the chain.
+const TOP_ADDRESSES = 100
+
+var ErrNoTopAddresses = fmt.Errorf("The index has no top addresses (built by an old version or a combined file)")
+
+// AddressCount is an address prefix (Parameters.AddressPrefixLen bytes,
+// hex) and the number of items in the address index under it.
+type AddressCount struct {
+	Prefix string
+	Items  int
+}
+
+// addressCounts is a min-heap of AddressCount by Items.
+type addressCounts []AddressCount
+
+func (h addressCounts) Len() int            { return len(h) }
+func (h addressCounts) Less(i, j int) bool  { return h[i].Items < h[j].Items }
+func (h addressCounts) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *addressCounts) Push(x interface{}) { *h = append(*h, x.(AddressCount)) }
+func (h *addressCounts) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// topAddresses keeps n keys of the address index with the most values
+// while the index is written.
+type topAddresses struct {
+	n      int
+	counts addressCounts
+}
+
+func (t *topAddresses) add(key []byte, items int) {
+	if len(t.counts) == t.n {
+		if items <= t.counts[0].Items {
+			return
+		}
+		heap.Pop(&t.counts)
+	}
+	heap.Push(&t.counts, AddressCount{
+		Prefix: hex.EncodeToString(key),
+		Items:  items,
+	})
+}
+
+// sorted returns the counts from the largest.
+func (t *topAddresses) sorted() []AddressCount {
+	counts := append([]AddressCount{}, t.counts...)
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Items != counts[j].Items {
+			return counts[i].Items > counts[j].Items
+		}
+		return counts[i].Prefix < counts[j].Prefix
+	})
+	return counts
+}
+
+// readTopAddresses returns TopAddresses of build_report.json.
+func readTopAddresses(report []byte) []AddressCount {
+	var r BuildReport
+	if err := json.Unmarshal(report, &r); err != nil {
+		return nil
+	}
+	return r.TopAddresses
+}
+
+// TopAddress is an address with the number of its items.
+type TopAddress struct {
+	Address types.UnlockHash
+	Items   int
+}
+
+// TopAddresses returns up to n addresses with the most items, from the
+// largest. Items are counted by address prefix, so an address sharing
+// the prefix with another one has the items of both. It returns
+// ErrNoTopAddresses if the index has no build_report.json with them.
+func (s *Server) TopAddresses(n int) ([]TopAddress, error) {
+	if s.topAddresses == nil {
+		return nil, ErrNoTopAddresses
+	}
+	counts := s.topAddresses
+	if n < len(counts) {
+		counts = counts[:n]
+	}
+	top := make([]TopAddress, 0, len(counts))
+	for _, count := range counts {
+		prefix, err := hex.DecodeString(count.Prefix)
+		if err != nil || len(prefix) != s.addressPrefixLen {
+			return nil, fmt.Errorf("bad prefix in build_report.json: %q", count.Prefix)
+		}
+		address, err := s.addressOfPrefix(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("address of prefix %s: %v", count.Prefix, err)
+		}
+		top = append(top, TopAddress{Address: address, Items: count.Items})
+	}
+	return top, nil
+}
+
+// addressOfPrefix finds the full address in the first item of the prefix.
+func (s *Server) addressOfPrefix(prefix []byte) (types.UnlockHash, error) {
+	itemIndices, err := s.addressItems(prefix)
+	if err != nil {
+		return types.UnlockHash{}, err
+	}
+	if len(itemIndices) == 0 {
+		return types.UnlockHash{}, ErrNoItem
+	}
+	item, err := s.GetItemWithoutProof(itemIndices[0])
+	if err != nil {
+		return types.UnlockHash{}, err
+	}
+	payout, tx, err := DecodeItem(item)
+	if err != nil {
+		return types.UnlockHash{}, err
+	}
+	if payout != nil {
+		if bytes.HasPrefix(payout.UnlockHash[:], prefix) {
+			return payout.UnlockHash, nil
+		}
+		return types.UnlockHash{}, ErrNoItem
+	}
+	var address types.UnlockHash
+	found := false
+	forEachAddress(tx, func(uh types.UnlockHash) error {
+		if !found && bytes.HasPrefix(uh[:], prefix) {
+			address, found = uh, true
+		}
+		return nil
+	})
+	if !found {
+		return types.UnlockHash{}, ErrNoItem
+	}
+	return address, nil
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopAddresses(t *testing.T) {
+	top := &topAddresses{n: 3}
+	for i, items := range []int{5, 1, 7, 3, 7, 2, 9} {
+		top.add([]byte{byte(i)}, items)
+	}
+	want := []AddressCount{{"06", 9}, {"02", 7}, {"04", 7}}
+	if got := top.sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted() = %v, want %v", got, want)
+	}
+
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	addresses, err := s.TopAddresses(10)
+	if err != nil {
+		t.Fatalf("TopAddresses: %v", err)
+	}
+	if len(addresses) != 10 {
+		t.Fatalf("got %d addresses, want 10", len(addresses))
+	}
+	for i, a := range addresses {
+		if i > 0 && a.Items > addresses[i-1].Items {
+			t.Errorf("addresses are not sorted: %v", addresses)
+		}
+		items, err := s.addressItems(a.Address[:])
+		if err != nil {
+			t.Fatalf("addressItems: %v", err)
+		}
+		if len(items) != a.Items {
+			t.Errorf("address %s: %d items, want %d", FormatAddress(a.Address), a.Items, len(items))
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"context"
+)
+
+// Names of spans of the serve path.
+const (
+	SPAN_FASTMAP_LOOKUP = "fastmap lookup"
+	SPAN_ITEM_READ      = "item read"
+	SPAN_DECOMPRESS     = "decompress"
+	SPAN_PROOF_BUILD    = "proof build"
+)
+
+// Tracer receives spans of the serve path, e.g. to export them to
+// OpenTelemetry. Spans are started by methods taking a context (e.g.
+// GetHistoryPageContext) if the context has a Tracer (see WithTracer).
+type Tracer interface {
+	// StartSpan starts a span of the operation. The returned context
+	// is the parent of nested spans; end is called when the operation
+	// finishes.
+	StartSpan(ctx context.Context, name string) (_ context.Context, end func())
+}
+
+type tracerKey struct{}
+
+// WithTracer returns the context making spans with the tracer.
+func WithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// StartSpan starts a span with the Tracer of ctx. Without a Tracer it
+// returns ctx and a no-op.
+func StartSpan(ctx context.Context, name string) (context.Context, func()) {
+	t, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok {
+		return ctx, func() {}
+	}
+	return t.StartSpan(ctx, name)
+}
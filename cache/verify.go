@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/merkletree"
+	"github.com/golang/snappy"
+)
+
+var ErrBadItemProof = fmt.Errorf("Merkle proof of the item does not match the Merkle root")
+
+// ItemLeafData returns the leaf of the item in the Merkle tree of its
+// block: Sia encoding of the miner payout or the transaction.
+func ItemLeafData(item Item) ([]byte, error) {
+	switch item.Compression {
+	case NO_COMPRESSION:
+		return item.Data, nil
+	case SNAPPY:
+		data, err := snappy.Decode(nil, item.Data)
+		if err != nil {
+			return nil, fmt.Errorf("snappy.Decode: %v", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown compression: %d", item.Compression)
+	}
+}
+
+// VerifyItem checks the Merkle proof of the item against the Merkle
+// root of its block (BlockHeader.MerkleRoot), so the item is known to
+// be in the block. Indices built with HASH_SHA256 do not match Merkle
+// roots of Sia blocks.
+func VerifyItem(item Item, root crypto.Hash) error {
+	data, err := ItemLeafData(item)
+	if err != nil {
+		return err
+	}
+	if item.Index < 0 || item.Index >= item.NumLeaves || len(item.MerkleProof)%crypto.HashSize != 0 {
+		return ErrBadItemProof
+	}
+	proofSet := [][]byte{data}
+	for i := 0; i < len(item.MerkleProof); i += crypto.HashSize {
+		proofSet = append(proofSet, item.MerkleProof[i:i+crypto.HashSize])
+	}
+	if !merkletree.VerifyProof(crypto.NewHash(), root[:], proofSet, uint64(item.Index), uint64(item.NumLeaves)) {
+		return ErrBadItemProof
+	}
+	return nil
+}
+
+// DecodeHeader decodes a record of file headers (HEADER_SIZE bytes),
+// e.g. from /v1/headers.
+func DecodeHeader(headerBytes []byte) (BlockHeader, error) {
+	var header BlockHeader
+	if len(headerBytes) != headerSize {
+		return header, ErrBadHeaderSize
+	}
+	if err := encoding.Unmarshal(headerBytes, &header); err != nil {
+		return header, fmt.Errorf("encoding.Unmarshal: %v", err)
+	}
+	return header, nil
+}
@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestVerifyItem(t *testing.T) {
+	blocks, err := read1000Blocks()
+	if err != nil {
+		t.Fatalf("read1000Blocks: %v", err)
+	}
+	s := buildTestServer(t, testParameters(), blocks)
+	for itemIndex := 0; itemIndex < s.NumItems(); itemIndex++ {
+		item, err := s.GetItem(itemIndex)
+		if err != nil {
+			t.Fatalf("GetItem: %v", err)
+		}
+		root := blocks[item.Block].MerkleRoot()
+		if err := VerifyItem(item, root); err != nil {
+			t.Errorf("VerifyItem(%s): %v", item.ID, err)
+		}
+		if item.NumLeaves < 2 {
+			continue
+		}
+		item.Index = (item.Index + 1) % item.NumLeaves
+		if err := VerifyItem(item, root); err != ErrBadItemProof {
+			t.Errorf("VerifyItem(%s) with wrong index returned %v", item.ID, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// DecodedBlock is a block of the index with decoded items.
+type DecodedBlock struct {
+	Height       int // StartHeight() + index of the block.
+	ID           types.BlockID
+	ParentID     types.BlockID
+	Header       BlockHeader
+	FirstItem    int // Index of the first miner payout.
+	FirstTx      int // Index of the first transaction.
+	MinerPayouts []types.SiacoinOutput
+	Transactions []types.Transaction
+	ItemSizes    []int // Sizes of items as stored in blockchain file.
+	Reward       BlockReward
+}
+
+// ForEachBlock decodes blocks [start, end) and passes them to f in order.
+// start and end are indices of blocks in the index, not heights.
+func (s *Server) ForEachBlock(start, end int, f func(*DecodedBlock) error) error {
+	if end > s.nblocks {
+		end = s.nblocks
+	}
+	if start < 0 {
+		start = 0
+	}
+	ids, err := s.blockIDs()
+	if err != nil {
+		return err
+	}
+	parentID := s.firstParentID()
+	if start > 0 && start <= end {
+		parentID = ids[start-1]
+	}
+	for height := start; height < end; height++ {
+		header, err := s.GetBlockHeader(height)
+		if err != nil {
+			return err
+		}
+		id := ids[height]
+		payoutsStart, txsStart, itemsEnd, err := s.GetBlockItems(height)
+		if err != nil {
+			return err
+		}
+		b := &DecodedBlock{
+			Height:    s.StartHeight() + height,
+			ID:        id,
+			ParentID:  parentID,
+			Header:    header,
+			FirstItem: payoutsStart,
+			FirstTx:   txsStart,
+		}
+		for itemIndex := payoutsStart; itemIndex < itemsEnd; itemIndex++ {
+			item, err := s.GetItemWithoutProof(itemIndex)
+			if err != nil {
+				return err
+			}
+			payout, tx, err := DecodeItem(item)
+			if err != nil {
+				return err
+			}
+			if payout != nil {
+				b.MinerPayouts = append(b.MinerPayouts, *payout)
+			} else {
+				b.Transactions = append(b.Transactions, *tx)
+			}
+			b.ItemSizes = append(b.ItemSizes, len(item.Data))
+		}
+		if b.Reward, err = s.GetBlockReward(height); err != nil {
+			return err
+		}
+		if err := f(b); err != nil {
+			return err
+		}
+		parentID = id
+	}
+	return nil
+}
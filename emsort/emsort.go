@@ -11,7 +11,6 @@ import (
 	"container/heap"
 	"fmt"
 	"io"
-	"os"
 	"sort"
 )
 
@@ -24,6 +23,24 @@ type SortedWriter interface {
 	// Close implements the method from io.Closer. It's important to call this
 	// because this is where the final sorting happens.
 	Close() error
+
+	// Stats returns statistics of sorting. Call it after Close.
+	Stats() Stats
+}
+
+// Stats describes the work done by SortedWriter.
+type Stats struct {
+	// Number of sorted chunks written to tmpfile.
+	Chunks int
+
+	// Size of tmpfile, bytes.
+	TmpBytes int64
+}
+
+// TmpFile stores sorted chunks. *os.File implements it.
+type TmpFile interface {
+	io.Writer
+	io.ReaderAt
 }
 
 // Less is a function that compares two byte arrays and determines whether a is
@@ -34,23 +51,82 @@ func BytesLess(a []byte, b []byte) bool {
 	return bytes.Compare(a, b) == -1
 }
 
+// Comparator orders items. Compare returns a negative number if a is
+// less than b, a positive number if a is greater than b and 0 if they
+// are equal.
+type Comparator interface {
+	Compare(a, b []byte) int
+}
+
+// Compare implements Comparator.
+func (less Less) Compare(a, b []byte) int {
+	if less(a, b) {
+		return -1
+	}
+	if less(b, a) {
+		return 1
+	}
+	return 0
+}
+
+// Field is a part of an item compared as a whole: byte by byte or, if
+// LittleEndian is set, as an unsigned little endian number.
+type Field struct {
+	Len          int
+	LittleEndian bool
+}
+
+// Fields is a Comparator comparing items field by field, e.g. a key
+// and then a secondary key. Bytes after the last field are not
+// compared, so items equal in all fields keep the order of writing.
+type Fields []Field
+
+func (fields Fields) Compare(a, b []byte) int {
+	start := 0
+	for _, f := range fields {
+		fa, fb := a[start:start+f.Len], b[start:start+f.Len]
+		start += f.Len
+		if !f.LittleEndian {
+			if c := bytes.Compare(fa, fb); c != 0 {
+				return c
+			}
+			continue
+		}
+		for i := f.Len - 1; i >= 0; i-- {
+			if fa[i] < fb[i] {
+				return -1
+			} else if fa[i] > fb[i] {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
 // New constructs a new SortedWriter that wraps out, chunks data into sortable
 // items using the given chunk size, compares them using the given Less and limits
-// the amount of RAM used to approximately memLimit.
-func New(out io.Writer, chunkSize int, less Less, memLimit int, tmpfile *os.File) (SortedWriter, error) {
+// the amount of RAM used to approximately memLimit. The sort is stable: items
+// equal according to less are written in the order of writing, so the output
+// does not depend on memLimit.
+func New(out io.Writer, chunkSize int, less Less, memLimit int, tmpfile TmpFile) (SortedWriter, error) {
+	return NewWithComparator(out, chunkSize, less, memLimit, tmpfile)
+}
+
+// NewWithComparator is like New, but compares items using cmp.
+func NewWithComparator(out io.Writer, chunkSize int, cmp Comparator, memLimit int, tmpfile TmpFile) (SortedWriter, error) {
 	return &sorted{
 		tmpfile:   tmpfile,
 		out:       out,
-		less:      less,
+		cmp:       cmp,
 		memLimit:  memLimit,
 		chunkSize: chunkSize,
 	}, nil
 }
 
 type sorted struct {
-	tmpfile   *os.File
+	tmpfile   TmpFile
 	out       io.Writer
-	less      Less
+	cmp       Comparator
 	memLimit  int
 	chunkSize int
 	sizes     []int
@@ -72,7 +148,7 @@ func (s *sorted) flush() error {
 	if len(s.vals)%s.chunkSize != 0 {
 		return fmt.Errorf("Writes to emsort should be aligned")
 	}
-	sort.Sort(&inmemory{s.vals, s.less, s.chunkSize})
+	sort.Stable(&inmemory{s.vals, s.cmp, s.chunkSize})
 	if n, err := s.tmpfile.Write(s.vals); err != nil {
 		return err
 	} else if n != len(s.vals) {
@@ -83,6 +159,17 @@ func (s *sorted) flush() error {
 	return nil
 }
 
+func (s *sorted) Stats() Stats {
+	var tmpBytes int64
+	for _, size := range s.sizes {
+		tmpBytes += int64(size)
+	}
+	return Stats{
+		Chunks:   len(s.sizes),
+		TmpBytes: tmpBytes,
+	}
+}
+
 func (s *sorted) Close() error {
 	if len(s.vals) > 0 {
 		flushErr := s.flush()
@@ -119,13 +206,14 @@ func (s *sorted) finalSort(files []*bufio.Reader) error {
 		return nil
 	}
 	entries := &entryHeap{
-		less:    s.less,
+		cmp:     s.cmp,
 		entries: make([]*entry, len(files)),
 	}
 	for i, file := range files {
 		e := &entry{
-			file: file,
-			val:  make([]byte, s.chunkSize),
+			file:  file,
+			val:   make([]byte, s.chunkSize),
+			index: i,
 		}
 		has, err := e.Read()
 		if err != nil {
@@ -157,7 +245,7 @@ func (s *sorted) finalSort(files []*bufio.Reader) error {
 
 type inmemory struct {
 	vals      []byte
-	less      func(a []byte, b []byte) bool
+	cmp       Comparator
 	chunkSize int
 }
 
@@ -168,7 +256,7 @@ func (im *inmemory) Len() int {
 func (im *inmemory) Less(i, j int) bool {
 	iStart := i * im.chunkSize
 	jStart := j * im.chunkSize
-	return im.less(im.vals[iStart:iStart+im.chunkSize], im.vals[jStart:jStart+im.chunkSize])
+	return im.cmp.Compare(im.vals[iStart:iStart+im.chunkSize], im.vals[jStart:jStart+im.chunkSize]) < 0
 }
 
 func (im *inmemory) Swap(i, j int) {
@@ -185,6 +273,9 @@ func (im *inmemory) Swap(i, j int) {
 type entry struct {
 	file io.Reader
 	val  []byte
+
+	// index is the index of the chunk, used to break ties.
+	index int
 }
 
 func (e *entry) Read() (bool, error) {
@@ -199,7 +290,7 @@ func (e *entry) Read() (bool, error) {
 
 type entryHeap struct {
 	entries []*entry
-	less    func([]byte, []byte) bool
+	cmp     Comparator
 }
 
 func (eh *entryHeap) Len() int {
@@ -207,7 +298,12 @@ func (eh *entryHeap) Len() int {
 }
 
 func (eh *entryHeap) Less(i, j int) bool {
-	return eh.less(eh.entries[i].val, eh.entries[j].val)
+	a, b := eh.entries[i], eh.entries[j]
+	if c := eh.cmp.Compare(a.val, b.val); c != 0 {
+		return c < 0
+	}
+	// Earlier chunks hold earlier writes.
+	return a.index < b.index
 }
 
 func (eh *entryHeap) Swap(i, j int) {
@@ -108,3 +108,79 @@ func (w *assertingWriter) finish(t *testing.T) {
 	}
 	assert.Equal(t, 100000, numResults)
 }
+
+func TestStable(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "emsort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	w := bytes.NewBuffer(nil)
+	// Compare only the first byte; the rest is the order of writing.
+	firstByteLess := func(a, b []byte) bool {
+		return a[0] < b[0]
+	}
+	s, err := New(w, 8, firstByteLess, 800, tmpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(i))
+		b[0] = byte(rand.Intn(4))
+		if _, err := s.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := w.Bytes()
+	if len(out) != 10000*8 {
+		t.Fatalf("got %d bytes, want %d", len(out), 10000*8)
+	}
+	for pos := 8; pos < len(out); pos += 8 {
+		prev, cur := out[pos-8:pos], out[pos:pos+8]
+		if prev[0] > cur[0] {
+			t.Fatalf("record %d is out of order", pos/8)
+		}
+		if prev[0] == cur[0] && bytes.Compare(prev[1:], cur[1:]) >= 0 {
+			t.Fatalf("record %d with equal key is out of order of writing", pos/8)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "emsort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	w := bytes.NewBuffer(nil)
+	// A key of 2 bytes and a little endian number of 4 bytes.
+	fields := Fields{{Len: 2}, {Len: 4, LittleEndian: true}}
+	s, err := NewWithComparator(w, 6, fields, 600, tmpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		b := make([]byte, 6)
+		b[0] = byte(rand.Intn(4))
+		binary.LittleEndian.PutUint32(b[2:], uint32(rand.Intn(100000)))
+		if _, err := s.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := w.Bytes()
+	for pos := 6; pos < len(out); pos += 6 {
+		prev, cur := out[pos-6:pos], out[pos:pos+6]
+		if c := bytes.Compare(prev[:2], cur[:2]); c > 0 {
+			t.Fatalf("record %d has lower key", pos/6)
+		} else if c == 0 && binary.LittleEndian.Uint32(prev[2:]) > binary.LittleEndian.Uint32(cur[2:]) {
+			t.Fatalf("record %d has lower number", pos/6)
+		}
+	}
+}
@@ -2,22 +2,69 @@ package fastmap
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"sort"
 )
 
 var (
-	ErrLowPrefixLen = fmt.Errorf("Prefix is too short")
+	ErrLowPrefixLen    = fmt.Errorf("Prefix is too short")
+	ErrLowPageLen      = fmt.Errorf("Page is too short for a record")
+	ErrBadPageChecksum = fmt.Errorf("Error in database: checksum of fastmap page does not match")
 )
 
+// Each page of the data file starts with a header of PAGE_HEADER_LEN
+// bytes: magic "FM", version PAGE_VERSION, a zero byte and CRC-32C of
+// the rest of the page (little endian). Maps written before headers
+// were added have no header; OpenMap tells them apart by the first
+// page, which starts with the least key in old maps.
+const (
+	PAGE_HEADER_LEN = 8
+	PAGE_VERSION    = 1
+)
+
+var (
+	pageMagic  = []byte{'F', 'M', PAGE_VERSION, 0}
+	crc32Table = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// writePageHeader fills the header of the page from the rest of it.
+func writePageHeader(page []byte) {
+	copy(page, pageMagic)
+	binary.LittleEndian.PutUint32(page[len(pageMagic):PAGE_HEADER_LEN], crc32.Checksum(page[PAGE_HEADER_LEN:], crc32Table))
+}
+
+// checkPageHeader checks the header of the page.
+func checkPageHeader(page []byte) bool {
+	if !bytes.Equal(page[:len(pageMagic)], pageMagic) {
+		return false
+	}
+	return binary.LittleEndian.Uint32(page[len(pageMagic):PAGE_HEADER_LEN]) == crc32.Checksum(page[PAGE_HEADER_LEN:], crc32Table)
+}
+
+// MapStats describes the map written by MapWriter.
+type MapStats struct {
+	Pages   int
+	Records int
+	// Fill[i] is the number of pages filled by i*10% (rounded down).
+	Fill [11]int
+}
+
 type MapWriter struct {
-	pageLen, keyLen, valueLen, prefixLen int
+	// recordsLen is the length of a page without the header.
+	recordsLen, keyLen, valueLen, prefixLen int
+
+	stats MapStats
 
 	data, prefixes io.Writer
 
 	ffff []byte
 
+	// fullPage is the page with the header being written.
+	fullPage []byte
+
 	valuesStart int
 	prevKey     []byte
 	page        []byte
@@ -29,14 +76,17 @@ type MapWriter struct {
 }
 
 func NewMapWriter(pageLen, keyLen, valueLen, prefixLen int, data, prefixes io.Writer) (*MapWriter, error) {
-	perPage := pageLen / (keyLen + valueLen)
+	perPage := (pageLen - PAGE_HEADER_LEN) / (keyLen + valueLen)
+	if perPage < 1 {
+		return nil, ErrLowPageLen
+	}
 	valuesStart := perPage * keyLen
 	ffff := make([]byte, keyLen)
 	for i := range ffff {
 		ffff[i] = 0xFF
 	}
 	return &MapWriter{
-		pageLen:     pageLen,
+		recordsLen:  pageLen - PAGE_HEADER_LEN,
 		keyLen:      keyLen,
 		valueLen:    valueLen,
 		prefixLen:   prefixLen,
@@ -45,8 +95,9 @@ func NewMapWriter(pageLen, keyLen, valueLen, prefixLen int, data, prefixes io.Wr
 		ffff:        ffff,
 		valuesStart: valuesStart,
 		prevKey:     make([]byte, keyLen),
-		page:        make([]byte, pageLen),
-		prevPage:    make([]byte, pageLen),
+		page:        make([]byte, pageLen-PAGE_HEADER_LEN),
+		prevPage:    make([]byte, pageLen-PAGE_HEADER_LEN),
+		fullPage:    make([]byte, pageLen),
 		valueStart:  valuesStart,
 	}, nil
 }
@@ -91,14 +142,13 @@ func (w *MapWriter) Write(rec []byte) (int, error) {
 		for i := w.keyStart; i < w.valuesStart; i++ {
 			w.prevPage[i] = 0xFF
 		}
-		for i := w.valueStart; i < w.pageLen; i++ {
+		for i := w.valueStart; i < w.recordsLen; i++ {
 			w.prevPage[i] = 0xFF
 		}
-		if n, err := w.data.Write(w.prevPage); err != nil {
+		if err := w.writePage(w.prevPage); err != nil {
 			return 0, err
-		} else if n != w.pageLen {
-			return 0, io.ErrShortWrite
 		}
+		w.addPageStats(w.keyStart)
 		w.keyStart = n1
 		w.valueStart = w.valuesStart + n2
 	}
@@ -122,9 +172,32 @@ func (w *MapWriter) Write(rec []byte) (int, error) {
 		w.page, w.prevPage = w.prevPage, w.page
 		w.hasPrevPage = true
 	}
+	w.stats.Records++
 	return len(rec), nil
 }
 
+// writePage writes the header and the records of the page.
+func (w *MapWriter) writePage(records []byte) error {
+	copy(w.fullPage[PAGE_HEADER_LEN:], records)
+	writePageHeader(w.fullPage)
+	if n, err := w.data.Write(w.fullPage); err != nil {
+		return err
+	} else if n != len(w.fullPage) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+func (w *MapWriter) addPageStats(keysEnd int) {
+	w.stats.Pages++
+	w.stats.Fill[10*keysEnd/w.valuesStart]++
+}
+
+// Stats returns statistics of written pages. Call it after Close.
+func (w *MapWriter) Stats() MapStats {
+	return w.stats
+}
+
 func (w *MapWriter) Close() error {
 	if w.hasPrevPage {
 		w.page = w.prevPage
@@ -134,14 +207,13 @@ func (w *MapWriter) Close() error {
 		for i := w.keyStart; i < w.valuesStart; i++ {
 			w.page[i] = 0xFF
 		}
-		for i := w.valueStart; i < w.pageLen; i++ {
+		for i := w.valueStart; i < w.recordsLen; i++ {
 			w.page[i] = 0xFF
 		}
-		if n, err := w.data.Write(w.page); err != nil {
+		if err := w.writePage(w.page); err != nil {
 			return err
-		} else if n != w.pageLen {
-			return io.ErrShortWrite
 		}
+		w.addPageStats(w.keyStart)
 		w.keyStart = 0
 	}
 	if c, ok := w.data.(io.Closer); ok {
@@ -160,6 +232,9 @@ func (w *MapWriter) Close() error {
 type Map struct {
 	npages, pageLen, keyLen, valueLen, prefixLen, perPage, valuesStart int
 
+	// headerLen is PAGE_HEADER_LEN or 0 for maps without page headers.
+	headerLen int
+
 	data, prefixes []byte
 }
 
@@ -168,11 +243,25 @@ func OpenMap(pageLen, keyLen, valueLen int, data, prefixes []byte) (*Map, error)
 	if npages*pageLen != len(data) {
 		return nil, fmt.Errorf("data length is not divided by pageLen")
 	}
-	prefixLen := len(prefixes) / npages
+	// A map without keys has no pages.
+	prefixLen := 0
+	if npages != 0 {
+		prefixLen = len(prefixes) / npages
+	}
 	if npages*prefixLen != len(prefixes) {
 		return nil, fmt.Errorf("prefixes length is not divided by the number of pages")
 	}
-	perPage := pageLen / (keyLen + valueLen)
+	headerLen := 0
+	if npages != 0 && bytes.Equal(data[:len(pageMagic)], pageMagic) {
+		if !checkPageHeader(data[:pageLen]) {
+			return nil, fmt.Errorf("page 0: %v", ErrBadPageChecksum)
+		}
+		headerLen = PAGE_HEADER_LEN
+	}
+	perPage := (pageLen - headerLen) / (keyLen + valueLen)
+	if perPage < 1 {
+		return nil, ErrLowPageLen
+	}
 	valuesStart := perPage * keyLen
 	return &Map{
 		npages:      npages,
@@ -182,11 +271,42 @@ func OpenMap(pageLen, keyLen, valueLen int, data, prefixes []byte) (*Map, error)
 		prefixLen:   prefixLen,
 		perPage:     perPage,
 		valuesStart: valuesStart,
+		headerLen:   headerLen,
 		data:        data,
 		prefixes:    prefixes,
 	}, nil
 }
 
+// records returns the records of the page without the header.
+func (m *Map) records(ipage int) []byte {
+	return m.data[ipage*m.pageLen+m.headerLen : (ipage+1)*m.pageLen]
+}
+
+// checkedRecords is like records, but checks the checksum of the page.
+func (m *Map) checkedRecords(ipage int) ([]byte, error) {
+	page := m.data[ipage*m.pageLen : (ipage+1)*m.pageLen]
+	if m.headerLen != 0 && !checkPageHeader(page) {
+		return nil, fmt.Errorf("page %d: %v", ipage, ErrBadPageChecksum)
+	}
+	return page[m.headerLen:], nil
+}
+
+// HasPageHeaders returns if pages of the map have headers with
+// checksums, which are checked by Lookup and ForEach.
+func (m *Map) HasPageHeaders() bool {
+	return m.headerLen != 0
+}
+
+// Verify checks checksums of all pages.
+func (m *Map) Verify() error {
+	for ipage := 0; ipage < m.npages; ipage++ {
+		if _, err := m.checkedRecords(ipage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *Map) Lookup(key []byte) ([]byte, error) {
 	if len(key) != m.keyLen {
 		return nil, fmt.Errorf("Bad keyLen")
@@ -202,8 +322,10 @@ func (m *Map) Lookup(key []byte) ([]byte, error) {
 		// Not found.
 		return nil, nil
 	}
-	start := ipage * m.pageLen
-	page := m.data[start : start+m.pageLen]
+	page, err := m.checkedRecords(ipage)
+	if err != nil {
+		return nil, err
+	}
 	inside := sort.Search(m.perPage, func(i int) bool {
 		start := i * m.keyLen
 		candidate := page[start : start+m.keyLen]
@@ -213,7 +335,7 @@ func (m *Map) Lookup(key []byte) ([]byte, error) {
 		// Not found.
 		return nil, nil
 	}
-	start = inside * m.keyLen
+	start := inside * m.keyLen
 	candidate := page[start : start+m.keyLen]
 	if !bytes.Equal(key, candidate) {
 		// Not found.
@@ -223,3 +345,21 @@ func (m *Map) Lookup(key []byte) ([]byte, error) {
 	value := page[start : start+m.valueLen]
 	return value, nil
 }
+
+// Stats returns statistics of the pages of the map, the same as
+// MapWriter.Stats returned when the map was written. It reads the keys
+// of all pages.
+func (m *Map) Stats() MapStats {
+	stats := MapStats{Pages: m.npages}
+	ffff := bytes.Repeat([]byte{0xFF}, m.keyLen)
+	for ipage := 0; ipage < m.npages; ipage++ {
+		page := m.records(ipage)
+		// Empty slots are at the end of the page.
+		n := sort.Search(m.perPage, func(i int) bool {
+			return bytes.Equal(page[i*m.keyLen:(i+1)*m.keyLen], ffff)
+		})
+		stats.Records += n
+		stats.Fill[10*n*m.keyLen/m.valuesStart]++
+	}
+	return stats
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -89,12 +90,30 @@ next:
 			t.Errorf("%s.Close(): %v", name, err)
 			continue next
 		}
+		// Check stats.
+		stats := w.Stats()
+		if stats.Records != len(pairs) {
+			t.Errorf("%s.Stats().Records = %d, want %d", name, stats.Records, len(pairs))
+		}
+		if stats.Pages != data.Len()/c.pageLen {
+			t.Errorf("%s.Stats().Pages = %d, want %d", name, stats.Pages, data.Len()/c.pageLen)
+		}
+		filled := 0
+		for _, n := range stats.Fill {
+			filled += n
+		}
+		if filled != stats.Pages {
+			t.Errorf("%s.Stats().Fill has %d pages, want %d", name, filled, stats.Pages)
+		}
 		// Check the map.
 		m, err := OpenMap(c.pageLen, c.keyLen, c.valueLen, data.Bytes(), prefixes.Bytes())
 		if err != nil {
 			t.Errorf("Open%s: %v", name, err)
 			continue next
 		}
+		if mapStats := m.Stats(); mapStats != stats {
+			t.Errorf("Open%s.Stats() = %v, want %v", name, mapStats, stats)
+		}
 		for _, p := range pairs {
 			key := p.key[:c.keyLen]
 			wantValue := p.value[:c.valueLen]
@@ -176,3 +195,103 @@ func TestFastmapRejectsDuplicateKeys(t *testing.T) {
 		t.Errorf("Write(): want an error because keys are duplicates")
 	}
 }
+
+func TestFastmapPageChecksum(t *testing.T) {
+	var data, prefixes bytes.Buffer
+	w, err := NewMapWriter(64, 4, 4, 4, &data, &prefixes)
+	if err != nil {
+		t.Fatalf("NewMapWriter: %v", err)
+	}
+	record := make([]byte, 8)
+	for i := 0; i < 20; i++ {
+		record[0] = byte(i)
+		record[4] = byte(i)
+		if _, err := w.Write(record); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	m, err := OpenMap(64, 4, 4, data.Bytes(), prefixes.Bytes())
+	if err != nil {
+		t.Fatalf("OpenMap: %v", err)
+	}
+	if !m.HasPageHeaders() {
+		t.Errorf("HasPageHeaders() = false")
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	key := []byte{19, 0, 0, 0}
+	if value, err := m.Lookup(key); err != nil || value == nil {
+		t.Fatalf("Lookup: %v, %v", value, err)
+	}
+	// Corrupt the last key, which is in the last page.
+	corrupted := append([]byte(nil), data.Bytes()...)
+	last := len(corrupted) - 64
+	idx := bytes.Index(corrupted[last:], []byte{19, 0, 0, 0})
+	if idx == -1 {
+		t.Fatalf("key not found in the last page")
+	}
+	corrupted[last+idx] ^= 0xFF
+	m, err = OpenMap(64, 4, 4, corrupted, prefixes.Bytes())
+	if err != nil {
+		t.Fatalf("OpenMap: %v", err)
+	}
+	if _, err := m.Lookup(key); err == nil || !strings.Contains(err.Error(), ErrBadPageChecksum.Error()) {
+		t.Errorf("Lookup in corrupted page returned %v", err)
+	}
+	if _, err := m.Lookup([]byte{0, 0, 0, 0}); err != nil {
+		t.Errorf("Lookup in good page: %v", err)
+	}
+	if err := m.Verify(); err == nil {
+		t.Errorf("Verify succeeded on corrupted map")
+	}
+}
+
+func TestFastmapWithoutPageHeaders(t *testing.T) {
+	// Page of a map written before page headers: 2 keys, 2 values and
+	// FF up to pageLen.
+	page := []byte{
+		1, 1, 1, 1, 2, 2, 2, 2,
+		10, 10, 10, 10, 20, 20, 20, 20,
+		0xFF, 0xFF, 0xFF, 0xFF,
+	}
+	m, err := OpenMap(len(page), 4, 4, page, []byte{1, 1})
+	if err != nil {
+		t.Fatalf("OpenMap: %v", err)
+	}
+	if m.HasPageHeaders() {
+		t.Errorf("HasPageHeaders() = true")
+	}
+	value, err := m.Lookup([]byte{2, 2, 2, 2})
+	if err != nil || !bytes.Equal(value, []byte{20, 20, 20, 20}) {
+		t.Errorf("Lookup returned %v, %v", value, err)
+	}
+}
+
+func TestFastmapEmpty(t *testing.T) {
+	var data, prefixes bytes.Buffer
+	w, err := NewMapWriter(4096, 32, 20, 5, &data, &prefixes)
+	if err != nil {
+		t.Fatalf("NewMapWriter: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("w.Close: %v", err)
+	}
+	m, err := OpenMap(4096, 32, 20, data.Bytes(), prefixes.Bytes())
+	if err != nil {
+		t.Fatalf("OpenMap: %v", err)
+	}
+	value, err := m.Lookup(make([]byte, 32))
+	if err != nil || value != nil {
+		t.Errorf("Lookup returned %v, %v", value, err)
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	if _, err := OpenMap(4096, 32, 20, nil, []byte{1}); err == nil {
+		t.Errorf("OpenMap accepted prefixes without pages")
+	}
+}
@@ -82,8 +82,18 @@ func (a *FFOOInliner) Uninline(container []byte) (bool, []byte, error) {
 	}
 }
 
+// MultiMapStats describes the multimap written by MultiMapWriter.
+type MultiMapStats struct {
+	Map         MapStats
+	Keys        int
+	Inlined     int
+	Values      int
+	ValuesBytes uint64
+}
+
 type MultiMapWriter struct {
 	fm               *MapWriter
+	stats            MultiMapStats
 	values           io.Writer
 	keyLen, valueLen int
 	fmRecord         []byte
@@ -98,6 +108,11 @@ type MultiMapWriter struct {
 
 	inliner Inliner
 
+	onKey func(key, values []byte) error
+
+	suffix   func(value []byte) []byte
+	withSufs []byte
+
 	// TODO should write varints to values
 }
 
@@ -129,13 +144,37 @@ func NewMultiMapWriter(pageLen, keyLen, valueLen, prefixLen, offsetLen, containe
 	}, nil
 }
 
+// SetKeyCallback sets f to be called for each key with all its values
+// in the order of keys. The slices are valid only during the call.
+func (u *MultiMapWriter) SetKeyCallback(f func(key, values []byte) error) {
+	u.onKey = f
+}
+
+// SetValueSuffix sets f returning bytes written after each value to
+// the list of values, e.g. a varint allowing to seek in the list without
+// resolving values. Lists are then prefixed by their size in bytes
+// instead of the number of values, so the map must be read after
+// MultiMap.SetValueSuffixes. Inlined values have no suffixes. The key
+// callback gets values without suffixes.
+func (u *MultiMapWriter) SetValueSuffix(f func(value []byte) []byte) {
+	u.suffix = f
+}
+
 func (u *MultiMapWriter) dump() error {
+	if u.onKey != nil && len(u.batch) != 0 {
+		if err := u.onKey(u.prevKey, u.batch); err != nil {
+			return err
+		}
+	}
 	// Try to inline.
 	binary.LittleEndian.PutUint64(u.fullOffsetBytes, u.offset)
 	isInlined, err := u.inliner.Inline(u.container, u.batch, u.offsetBytes)
+	u.stats.Keys++
+	u.stats.Values += len(u.batch) / u.valueLen
 	if err != nil {
 		return fmt.Errorf("inliner: %v", err)
 	} else if isInlined {
+		u.stats.Inlined++
 		if _, err := u.fm.Write(u.fmRecord); err != nil {
 			return err
 		}
@@ -146,18 +185,30 @@ func (u *MultiMapWriter) dump() error {
 	if _, err := u.fm.Write(u.fmRecord); err != nil {
 		return err
 	}
-	l := binary.PutUvarint(u.lenBuf, uint64(len(u.batch)/u.valueLen))
+	list := u.batch
+	size := len(u.batch) / u.valueLen
+	if u.suffix != nil {
+		u.withSufs = u.withSufs[:0]
+		for start := 0; start < len(u.batch); start += u.valueLen {
+			value := u.batch[start : start+u.valueLen]
+			u.withSufs = append(u.withSufs, value...)
+			u.withSufs = append(u.withSufs, u.suffix(value)...)
+		}
+		list = u.withSufs
+		size = len(list)
+	}
+	l := binary.PutUvarint(u.lenBuf, uint64(size))
 	if n, err := u.values.Write(u.lenBuf[:l]); err != nil {
 		return err
 	} else if n != l {
 		return io.ErrShortWrite
 	}
-	if n, err := u.values.Write(u.batch); err != nil {
+	if n, err := u.values.Write(list); err != nil {
 		return err
-	} else if n != len(u.batch) {
+	} else if n != len(list) {
 		return io.ErrShortWrite
 	}
-	u.offset += uint64(l + len(u.batch))
+	u.offset += uint64(l + len(list))
 	if u.offset > u.offsetEnd {
 		return ErrLowOffsetLen
 	}
@@ -191,6 +242,14 @@ func (u *MultiMapWriter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// Stats returns statistics of the multimap. Call it after Close.
+func (u *MultiMapWriter) Stats() MultiMapStats {
+	stats := u.stats
+	stats.Map = u.fm.Stats()
+	stats.ValuesBytes = u.offset
+	return stats
+}
+
 func (u *MultiMapWriter) Close() error {
 	if err := u.dump(); err != nil {
 		return err
@@ -213,6 +272,9 @@ type MultiMap struct {
 	valueLen int
 
 	uninliner Uninliner
+
+	// suffixes is true if lists have suffixes after values.
+	suffixes bool
 }
 
 func OpenMultiMap(pageLen, keyLen, valueLen, offsetLen, containerLen int, data, prefixes, values []byte, uninliner Uninliner) (*MultiMap, error) {
@@ -228,17 +290,42 @@ func OpenMultiMap(pageLen, keyLen, valueLen, offsetLen, containerLen int, data,
 	}, nil
 }
 
+// MapStats returns statistics of the pages of the underlying map.
+// Records of the map are keys of the multimap. See Map.Stats.
+func (u *MultiMap) MapStats() MapStats {
+	return u.fm.Stats()
+}
+
+// Verify checks checksums of all pages of the underlying map.
+func (u *MultiMap) Verify() error {
+	return u.fm.Verify()
+}
+
+// SetValueSuffixes makes Lookup read lists written with
+// MultiMapWriter.SetValueSuffix. Lookup then returns values with their
+// suffixes, except inlined values (see LookupInlined).
+func (u *MultiMap) SetValueSuffixes() {
+	u.suffixes = true
+}
+
 func (u *MultiMap) Lookup(key []byte) ([]byte, error) {
+	values, _, err := u.LookupInlined(key)
+	return values, err
+}
+
+// LookupInlined is like Lookup, but also returns if the values are
+// inlined to the map. Inlined values have no suffixes.
+func (u *MultiMap) LookupInlined(key []byte) ([]byte, bool, error) {
 	container, err := u.fm.Lookup(key)
 	if err != nil || container == nil {
-		return nil, err
+		return nil, false, err
 	}
 	// Check if it is inlined.
 	isInlined, uninlined, err := u.uninliner.Uninline(container)
 	if err != nil {
-		return nil, fmt.Errorf("uninliner: %v", err)
+		return nil, false, fmt.Errorf("uninliner: %v", err)
 	} else if isInlined {
-		return uninlined, nil
+		return uninlined, true, nil
 	}
 	// No-inline case.
 	var fullOffset [8]byte
@@ -247,12 +334,16 @@ func (u *MultiMap) Lookup(key []byte) ([]byte, error) {
 	lenPos := int(binary.LittleEndian.Uint64(fullOffsetBytes))
 	size0, l := binary.Uvarint(u.values[lenPos:])
 	if l <= 0 {
-		return nil, fmt.Errorf("Error in database: bad varint at lenPos")
+		return nil, false, fmt.Errorf("Error in database: bad varint at lenPos")
 	}
 	dataStart := lenPos + l
-	dataEnd := dataStart + int(size0)*u.valueLen
+	size := int(size0)
+	if !u.suffixes {
+		size *= u.valueLen
+	}
+	dataEnd := dataStart + size
 	if dataEnd > len(u.values) {
-		return nil, fmt.Errorf("Error in database: too large size")
+		return nil, false, fmt.Errorf("Error in database: too large size")
 	}
-	return u.values[dataStart:dataEnd], nil
+	return u.values[dataStart:dataEnd], false, nil
 }
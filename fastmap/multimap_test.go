@@ -182,3 +182,53 @@ func TestMultiMapFFOORefectsFFAnd00inValues(t *testing.T) {
 		}
 	}
 }
+
+func TestMultiMapValueSuffix(t *testing.T) {
+	var data, prefixes, values bytes.Buffer
+	w, err := NewMultiMapWriter(4096, 4, 4, 4, 4, 2*4, &data, &prefixes, &values, NewFFOOInliner(4))
+	if err != nil {
+		t.Fatalf("NewMultiMapWriter: %v", err)
+	}
+	// The suffix of a value is its first byte repeated it times.
+	w.SetValueSuffix(func(value []byte) []byte {
+		return bytes.Repeat(value[:1], int(value[0]))
+	})
+	var callbackValues []byte
+	w.SetKeyCallback(func(key, values []byte) error {
+		if key[0] == 2 {
+			callbackValues = append([]byte{}, values...)
+		}
+		return nil
+	})
+	records := [][]byte{
+		{1, 1, 1, 1, 5, 0, 0, 0},
+		{2, 2, 2, 2, 1, 0, 0, 0},
+		{2, 2, 2, 2, 2, 0, 0, 0},
+		{2, 2, 2, 2, 3, 0, 0, 0},
+	}
+	for _, record := range records {
+		if _, err := w.Write(record); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if want := []byte{1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0}; !bytes.Equal(callbackValues, want) {
+		t.Errorf("key callback got %v, want %v", callbackValues, want)
+	}
+	m, err := OpenMultiMap(4096, 4, 4, 4, 2*4, data.Bytes(), prefixes.Bytes(), values.Bytes(), NewFFOOInliner(4))
+	if err != nil {
+		t.Fatalf("OpenMultiMap: %v", err)
+	}
+	m.SetValueSuffixes()
+	batch, inlined, err := m.LookupInlined([]byte{1, 1, 1, 1})
+	if err != nil || !inlined || !bytes.Equal(batch, []byte{5, 0, 0, 0}) {
+		t.Errorf("LookupInlined of inlined value returned %v, %v, %v", batch, inlined, err)
+	}
+	batch, inlined, err = m.LookupInlined([]byte{2, 2, 2, 2})
+	want := []byte{1, 0, 0, 0, 1, 2, 0, 0, 0, 2, 2, 3, 0, 0, 0, 3, 3, 3}
+	if err != nil || inlined || !bytes.Equal(batch, want) {
+		t.Errorf("LookupInlined returned %v, %v, %v; want %v", batch, inlined, err, want)
+	}
+}
@@ -0,0 +1,204 @@
+package fastmap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// Overlay is a small mutable map stored in a side file. It is consulted
+// before an immutable Map (see OverlayMap), so values of the Map can be
+// updated without a rebuild, e.g. to mark outputs as spent as new blocks
+// arrive. The file is a log of records (key followed by value); a later
+// record of a key overrides earlier ones. The whole overlay is kept in
+// memory, so it must be merged into the Map (see Merge) from time to time.
+type Overlay struct {
+	keyLen, valueLen int
+
+	file   *os.File
+	values map[string][]byte
+}
+
+// OpenOverlay opens or creates the overlay file. A partial record at
+// the end of the file (left by a crash during Put) is discarded.
+func OpenOverlay(path string, keyLen, valueLen int) (*Overlay, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	recLen := keyLen + valueLen
+	complete := len(data) / recLen * recLen
+	if complete != len(data) {
+		if err := file.Truncate(int64(complete)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if _, err := file.Seek(int64(complete), io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	o := &Overlay{
+		keyLen:   keyLen,
+		valueLen: valueLen,
+		file:     file,
+		values:   make(map[string][]byte),
+	}
+	for start := 0; start < complete; start += recLen {
+		rec := data[start : start+recLen]
+		o.values[string(rec[:keyLen])] = rec[keyLen:]
+	}
+	return o, nil
+}
+
+// Put sets the value of the key. The record is written to the file,
+// but the file is not synced (see Sync).
+func (o *Overlay) Put(key, value []byte) error {
+	if len(key) != o.keyLen {
+		return fmt.Errorf("Bad keyLen")
+	}
+	if len(value) != o.valueLen {
+		return fmt.Errorf("Bad valueLen")
+	}
+	rec := make([]byte, 0, o.keyLen+o.valueLen)
+	rec = append(rec, key...)
+	rec = append(rec, value...)
+	if _, err := o.file.Write(rec); err != nil {
+		return err
+	}
+	o.values[string(key)] = rec[o.keyLen:]
+	return nil
+}
+
+// Lookup returns the value of the key or nil if the overlay
+// does not have it.
+func (o *Overlay) Lookup(key []byte) []byte {
+	return o.values[string(key)]
+}
+
+// Len returns the number of keys in the overlay.
+func (o *Overlay) Len() int {
+	return len(o.values)
+}
+
+// Sync writes the file to disk.
+func (o *Overlay) Sync() error {
+	return o.file.Sync()
+}
+
+// Reset removes all records, e.g. after they were merged into the Map.
+func (o *Overlay) Reset() error {
+	if err := o.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := o.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	o.values = make(map[string][]byte)
+	return nil
+}
+
+func (o *Overlay) Close() error {
+	return o.file.Close()
+}
+
+// sortedKeys returns keys of the overlay in ascending order.
+func (o *Overlay) sortedKeys() []string {
+	keys := make([]string, 0, len(o.values))
+	for key := range o.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// OverlayMap is an immutable Map with values updated by an Overlay.
+type OverlayMap struct {
+	base    *Map
+	overlay *Overlay
+}
+
+func NewOverlayMap(base *Map, overlay *Overlay) (*OverlayMap, error) {
+	if base.keyLen != overlay.keyLen || base.valueLen != overlay.valueLen {
+		return nil, fmt.Errorf("overlay has keyLen %d and valueLen %d, map has %d and %d", overlay.keyLen, overlay.valueLen, base.keyLen, base.valueLen)
+	}
+	return &OverlayMap{base: base, overlay: overlay}, nil
+}
+
+func (m *OverlayMap) Lookup(key []byte) ([]byte, error) {
+	if len(key) != m.base.keyLen {
+		return nil, fmt.Errorf("Bad keyLen")
+	}
+	if value := m.overlay.Lookup(key); value != nil {
+		return value, nil
+	}
+	return m.base.Lookup(key)
+}
+
+// Merge writes all records of the map, with values of the overlay,
+// to w in the order required by MapWriter. w is not closed.
+func (m *OverlayMap) Merge(w *MapWriter) error {
+	keys := m.overlay.sortedKeys()
+	rec := make([]byte, m.base.keyLen+m.base.valueLen)
+	write := func(key, value []byte) error {
+		copy(rec, key)
+		copy(rec[m.base.keyLen:], value)
+		_, err := w.Write(rec)
+		return err
+	}
+	err := m.base.ForEach(func(key, value []byte) error {
+		// Write keys of the overlay which go before the key.
+		for len(keys) != 0 && keys[0] < string(key) {
+			if err := write([]byte(keys[0]), m.overlay.values[keys[0]]); err != nil {
+				return err
+			}
+			keys = keys[1:]
+		}
+		if len(keys) != 0 && keys[0] == string(key) {
+			value = m.overlay.values[keys[0]]
+			keys = keys[1:]
+		}
+		return write(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := write([]byte(key), m.overlay.values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEach calls f for all records of the map in the order of keys.
+// Slices passed to f point to the data of the map.
+func (m *Map) ForEach(f func(key, value []byte) error) error {
+	ffff := bytes.Repeat([]byte{0xFF}, m.keyLen)
+	for ipage := 0; ipage < m.npages; ipage++ {
+		page, err := m.checkedRecords(ipage)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < m.perPage; i++ {
+			key := page[i*m.keyLen : (i+1)*m.keyLen]
+			if bytes.Equal(key, ffff) {
+				// Empty slots are at the end of the page.
+				break
+			}
+			start := m.valuesStart + i*m.valueLen
+			if err := f(key, page[start:start+m.valueLen]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package fastmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	const (
+		pageLen   = 4096
+		keyLen    = 16
+		valueLen  = 4
+		prefixLen = 5
+	)
+	r := rand.New(rand.NewSource(0))
+	randBytes := func(n int) []byte {
+		buf := make([]byte, n)
+		r.Read(buf)
+		return buf
+	}
+	want := make(map[string][]byte)
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		key := string(randBytes(keyLen))
+		want[key] = randBytes(valueLen)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var data, prefixes bytes.Buffer
+	w, err := NewMapWriter(pageLen, keyLen, valueLen, prefixLen, &data, &prefixes)
+	if err != nil {
+		t.Fatalf("NewMapWriter: %v", err)
+	}
+	for _, key := range keys {
+		if _, err := w.Write(append([]byte(key), want[key]...)); err != nil {
+			t.Fatalf("w.Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("w.Close: %v", err)
+	}
+	base, err := OpenMap(pageLen, keyLen, valueLen, data.Bytes(), prefixes.Bytes())
+	if err != nil {
+		t.Fatalf("OpenMap: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestOverlay")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	overlayPath := path.Join(dir, "overlay")
+	o, err := OpenOverlay(overlayPath, keyLen, valueLen)
+	if err != nil {
+		t.Fatalf("OpenOverlay: %v", err)
+	}
+	// Update some existing keys (twice) and add new ones.
+	for i := 0; i < 100; i++ {
+		key := keys[r.Intn(len(keys))]
+		for j := 0; j < 2; j++ {
+			want[key] = randBytes(valueLen)
+			if err := o.Put([]byte(key), want[key]); err != nil {
+				t.Fatalf("o.Put: %v", err)
+			}
+		}
+		newKey := string(randBytes(keyLen))
+		want[newKey] = randBytes(valueLen)
+		if err := o.Put([]byte(newKey), want[newKey]); err != nil {
+			t.Fatalf("o.Put: %v", err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatalf("o.Close: %v", err)
+	}
+	// Simulate a crash during Put.
+	f, err := os.OpenFile(overlayPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("os.OpenFile: %v", err)
+	}
+	if _, err := f.Write(randBytes(keyLen)); err != nil {
+		t.Fatalf("f.Write: %v", err)
+	}
+	f.Close()
+	o, err = OpenOverlay(overlayPath, keyLen, valueLen)
+	if err != nil {
+		t.Fatalf("OpenOverlay: %v", err)
+	}
+	defer o.Close()
+	m, err := NewOverlayMap(base, o)
+	if err != nil {
+		t.Fatalf("NewOverlayMap: %v", err)
+	}
+	check := func(name string, lookup func(key []byte) ([]byte, error)) {
+		for key, value := range want {
+			got, err := lookup([]byte(key))
+			if err != nil {
+				t.Fatalf("%s.Lookup: %v", name, err)
+			}
+			if !bytes.Equal(got, value) {
+				t.Errorf("%s.Lookup(%x) = %x, want %x", name, key, got, value)
+			}
+		}
+		if got, err := lookup(randBytes(keyLen)); err != nil || got != nil {
+			t.Errorf("%s.Lookup(missing) = %x, %v", name, got, err)
+		}
+	}
+	check("OverlayMap", m.Lookup)
+	// Merge into a new map. Buffers of base are still in use.
+	var data2, prefixes2 bytes.Buffer
+	w, err = NewMapWriter(pageLen, keyLen, valueLen, prefixLen, &data2, &prefixes2)
+	if err != nil {
+		t.Fatalf("NewMapWriter: %v", err)
+	}
+	if err := m.Merge(w); err != nil {
+		t.Fatalf("m.Merge: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("w.Close: %v", err)
+	}
+	merged, err := OpenMap(pageLen, keyLen, valueLen, data2.Bytes(), prefixes2.Bytes())
+	if err != nil {
+		t.Fatalf("OpenMap: %v", err)
+	}
+	check("merged", merged.Lookup)
+	if err := o.Reset(); err != nil {
+		t.Fatalf("o.Reset: %v", err)
+	}
+	if o.Len() != 0 {
+		t.Errorf("o.Len() = %d after Reset", o.Len())
+	}
+}
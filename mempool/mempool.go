@@ -0,0 +1,353 @@
+// Package mempool keeps unconfirmed transactions and persists them
+// to disk, so they survive restarts.
+package mempool
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// record is the on-disk form of an entry.
+type record struct {
+	Tx   types.Transaction
+	Seen int64 // Unix time.
+}
+
+type Entry struct {
+	Tx   types.Transaction
+	ID   types.TransactionID
+	Seen time.Time
+
+	size int // Length of Sia-encoded Tx.
+}
+
+// Mempool is a set of unconfirmed transactions. It is safe for
+// concurrent use. New transactions are appended to the file,
+// removals are applied by rewriting the file in Save.
+type Mempool struct {
+	mu      sync.RWMutex
+	entries map[types.TransactionID]*Entry
+	file    *os.File
+	path    string
+	maxAge  time.Duration
+
+	// bytes is the sum of sizes of entries. If maxBytes is not 0,
+	// the oldest entries are evicted to keep bytes under it.
+	bytes     int
+	maxBytes  int
+	evictions int64
+}
+
+// Open loads the mempool from the file (creating it if needed),
+// dropping entries older than maxAge.
+func Open(path string, maxAge time.Duration) (*Mempool, error) {
+	m := &Mempool{
+		entries: make(map[types.TransactionID]*Entry),
+		path:    path,
+		maxAge:  maxAge,
+	}
+	f, err := os.Open(path)
+	if err == nil {
+		err = m.load(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	m.expire(time.Now())
+	// Rewrite the file to drop expired entries.
+	if err := m.rewrite(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Mempool) load(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		var rec record
+		if err := encoding.ReadObject(br, &rec, types.BlockSizeLimit); err == io.EOF {
+			return nil
+		} else if err == io.ErrUnexpectedEOF {
+			// Partial write before a crash.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		m.insert(&Entry{
+			Tx:   rec.Tx,
+			ID:   rec.Tx.ID(),
+			Seen: time.Unix(rec.Seen, 0),
+			size: len(encoding.Marshal(rec.Tx)),
+		})
+	}
+}
+
+func (m *Mempool) insert(e *Entry) {
+	m.entries[e.ID] = e
+	m.bytes += e.size
+}
+
+func (m *Mempool) remove(id types.TransactionID) {
+	if e, has := m.entries[id]; has {
+		delete(m.entries, id)
+		m.bytes -= e.size
+	}
+}
+
+// evict removes the oldest entries while the mempool is larger than
+// maxBytes. Evicted entries are removed from the file by Save.
+func (m *Mempool) evict() {
+	if m.maxBytes == 0 || m.bytes <= m.maxBytes {
+		return
+	}
+	entries := make([]*Entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Seen.Before(entries[j].Seen)
+	})
+	for _, e := range entries {
+		if m.bytes <= m.maxBytes {
+			break
+		}
+		m.remove(e.ID)
+		m.evictions++
+	}
+}
+
+// SetMaxBytes limits the total size of Sia-encoded transactions of the
+// mempool (0 = no limit). The oldest transactions are evicted first.
+func (m *Mempool) SetMaxBytes(maxBytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxBytes = maxBytes
+	m.evict()
+}
+
+// Size returns the number of transactions and their total size.
+func (m *Mempool) Size() (count, bytes int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.entries), m.bytes
+}
+
+// Evictions returns the number of transactions evicted to stay under
+// the limit set by SetMaxBytes.
+func (m *Mempool) Evictions() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.evictions
+}
+
+func (m *Mempool) expire(now time.Time) {
+	if m.maxAge == 0 {
+		return
+	}
+	for id, e := range m.entries {
+		if now.Sub(e.Seen) > m.maxAge {
+			m.remove(id)
+		}
+	}
+}
+
+// rewrite writes all entries to a new file and replaces the old one.
+// The old file is kept open until the new one replaces it, so Add
+// keeps appending to the file in use if rewrite fails.
+func (m *Mempool) rewrite() error {
+	tmpPath := m.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, e := range m.entries {
+		if err := encoding.WriteObject(w, record{Tx: e.Tx, Seen: e.Seen.Unix()}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	// tmp is positioned at its end, so new records are appended to it
+	// after it replaces the old file.
+	if err := os.Rename(tmpPath, m.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	old := m.file
+	m.file = tmp
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// Add adds transactions to the mempool and appends them to the file.
+// Known transactions are ignored.
+func (m *Mempool) Add(txs []types.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, tx := range txs {
+		id := tx.ID()
+		if _, has := m.entries[id]; has {
+			continue
+		}
+		if err := encoding.WriteObject(m.file, record{Tx: tx, Seen: now.Unix()}); err != nil {
+			return err
+		}
+		m.insert(&Entry{
+			Tx:   tx,
+			ID:   id,
+			Seen: now,
+			size: len(encoding.Marshal(tx)),
+		})
+	}
+	m.evict()
+	return nil
+}
+
+// RemoveConfirmed removes transactions confirmed by a block (txs are
+// transactions of the block) and transactions spending the same outputs,
+// which can not be confirmed anymore. They are removed from the file by
+// Save.
+func (m *Mempool) RemoveConfirmed(txs []types.Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	spent := make(map[types.OutputID]bool)
+	for i := range txs {
+		m.remove(txs[i].ID())
+		for _, si := range txs[i].SiacoinInputs {
+			spent[types.OutputID(si.ParentID)] = true
+		}
+		for _, si := range txs[i].SiafundInputs {
+			spent[types.OutputID(si.ParentID)] = true
+		}
+	}
+	for id, e := range m.entries {
+		if spendsAny(&e.Tx, spent) {
+			m.remove(id)
+		}
+	}
+}
+
+// spendsAny returns if the transaction spends any of the outputs.
+func spendsAny(tx *types.Transaction, outputs map[types.OutputID]bool) bool {
+	for _, si := range tx.SiacoinInputs {
+		if outputs[types.OutputID(si.ParentID)] {
+			return true
+		}
+	}
+	for _, si := range tx.SiafundInputs {
+		if outputs[types.OutputID(si.ParentID)] {
+			return true
+		}
+	}
+	return false
+}
+
+// Save drops expired entries and rewrites the file.
+func (m *Mempool) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(time.Now())
+	return m.rewrite()
+}
+
+// Entries returns all transactions of the mempool.
+func (m *Mempool) Entries() []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]Entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+// ByAddress returns transactions having the address in inputs or outputs.
+func (m *Mempool) ByAddress(address types.UnlockHash) []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var entries []Entry
+	for _, e := range m.entries {
+		if hasAddress(&e.Tx, address) {
+			entries = append(entries, *e)
+		}
+	}
+	return entries
+}
+
+// hasAddress returns if the address is in the transaction. The addresses
+// are those indexed by cache, including outputs of file contracts and
+// their revisions.
+func hasAddress(tx *types.Transaction, address types.UnlockHash) bool {
+	for _, si := range tx.SiacoinInputs {
+		if si.UnlockConditions.UnlockHash() == address {
+			return true
+		}
+	}
+	for _, si := range tx.SiafundInputs {
+		if si.UnlockConditions.UnlockHash() == address {
+			return true
+		}
+	}
+	for _, so := range tx.SiacoinOutputs {
+		if so.UnlockHash == address {
+			return true
+		}
+	}
+	for _, so := range tx.SiafundOutputs {
+		if so.UnlockHash == address {
+			return true
+		}
+	}
+	for _, contract := range tx.FileContracts {
+		if hasOutput(contract.ValidProofOutputs, address) || hasOutput(contract.MissedProofOutputs, address) {
+			return true
+		}
+	}
+	for _, rev := range tx.FileContractRevisions {
+		if hasOutput(rev.NewValidProofOutputs, address) || hasOutput(rev.NewMissedProofOutputs, address) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOutput(outputs []types.SiacoinOutput, address types.UnlockHash) bool {
+	for _, so := range outputs {
+		if so.UnlockHash == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Close saves the mempool and closes the file.
+func (m *Mempool) Close() error {
+	if err := m.Save(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.file.Close()
+}
@@ -0,0 +1,225 @@
+package mempool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func tempMempool(t *testing.T, maxAge time.Duration) (*Mempool, string, func()) {
+	dir, err := ioutil.TempDir("", "mempool")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	path := filepath.Join(dir, "mempool")
+	m, err := Open(path, maxAge)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Open: %v", err)
+	}
+	return m, path, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func testTxs(n int) []types.Transaction {
+	txs := make([]types.Transaction, n)
+	for i := range txs {
+		txs[i].ArbitraryData = [][]byte{{byte(i)}}
+		txs[i].SiacoinOutputs = []types.SiacoinOutput{{
+			Value:      types.NewCurrency64(uint64(i + 1)),
+			UnlockHash: types.UnlockHash{byte(i)},
+		}}
+	}
+	return txs
+}
+
+func ids(entries []Entry) map[types.TransactionID]bool {
+	result := make(map[types.TransactionID]bool)
+	for _, e := range entries {
+		result[e.ID] = true
+	}
+	return result
+}
+
+func TestRemoveConfirmed(t *testing.T) {
+	m, path, cleanup := tempMempool(t, 0)
+	defer cleanup()
+	txs := testTxs(5)
+	if err := m.Add(txs); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	// Known transactions are ignored.
+	if err := m.Add(txs[:2]); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if count, _ := m.Size(); count != 5 {
+		t.Fatalf("Size() = %d, want 5", count)
+	}
+	// The block confirms transactions 1 and 3 and one unknown one.
+	m.RemoveConfirmed([]types.Transaction{txs[1], txs[3], testTxs(10)[9]})
+	got := ids(m.Entries())
+	for i, tx := range txs {
+		if want := i != 1 && i != 3; got[tx.ID()] != want {
+			t.Errorf("transaction %d in mempool: %v, want %v", i, got[tx.ID()], want)
+		}
+	}
+	count, bytes := m.Size()
+	wantBytes := 0
+	for _, i := range []int{0, 2, 4} {
+		wantBytes += len(encoding.Marshal(txs[i]))
+	}
+	if count != 3 || bytes != wantBytes {
+		t.Errorf("Size() = %d, %d, want 3, %d", count, bytes, wantBytes)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	m2, err := Open(path, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer m2.Close()
+	got2 := ids(m2.Entries())
+	if len(got2) != 3 || got2[txs[1].ID()] || got2[txs[3].ID()] {
+		t.Errorf("removed transactions after reopening: %v", got2)
+	}
+}
+
+func TestReopenKeepsAdded(t *testing.T) {
+	m, path, cleanup := tempMempool(t, 0)
+	defer cleanup()
+	txs := testTxs(3)
+	if err := m.Add(txs); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	// Added transactions are appended to the file before Save.
+	m2, err := Open(path, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer m2.Close()
+	got := ids(m2.Entries())
+	for i, tx := range txs {
+		if !got[tx.ID()] {
+			t.Errorf("transaction %d lost after reopening", i)
+		}
+	}
+	m.Close()
+}
+
+func TestExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestExpire")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mempool")
+	txs := testTxs(2)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("os.Create: %v", err)
+	}
+	now := time.Now()
+	records := []record{
+		{Tx: txs[0], Seen: now.Add(-2 * time.Hour).Unix()},
+		{Tx: txs[1], Seen: now.Unix()},
+	}
+	for _, rec := range records {
+		if err := encoding.WriteObject(f, rec); err != nil {
+			t.Fatalf("encoding.WriteObject: %v", err)
+		}
+	}
+	f.Close()
+	m, err := Open(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer m.Close()
+	got := ids(m.Entries())
+	if len(got) != 1 || !got[txs[1].ID()] {
+		t.Errorf("entries after expiration: %v, want only transaction 1", got)
+	}
+}
+
+func TestSetMaxBytes(t *testing.T) {
+	m, _, cleanup := tempMempool(t, 0)
+	defer cleanup()
+	defer m.Close()
+	txs := testTxs(4)
+	for _, tx := range txs {
+		if err := m.Add([]types.Transaction{tx}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		// Seen has the precision of the clock; make the order strict.
+		m.mu.Lock()
+		m.entries[tx.ID()].Seen = time.Unix(int64(len(m.entries)), 0)
+		m.mu.Unlock()
+	}
+	size := len(encoding.Marshal(txs[0]))
+	m.SetMaxBytes(2 * size)
+	got := ids(m.Entries())
+	if len(got) != 2 || !got[txs[2].ID()] || !got[txs[3].ID()] {
+		t.Errorf("entries after SetMaxBytes: %v, want the 2 newest", got)
+	}
+	if m.Evictions() != 2 {
+		t.Errorf("Evictions() = %d, want 2", m.Evictions())
+	}
+}
+
+func TestByAddress(t *testing.T) {
+	m, _, cleanup := tempMempool(t, 0)
+	defer cleanup()
+	defer m.Close()
+	txs := testTxs(3)
+	if err := m.Add(txs); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	entries := m.ByAddress(types.UnlockHash{1})
+	if len(entries) != 1 || entries[0].ID != txs[1].ID() {
+		t.Errorf("ByAddress = %v, want transaction 1", entries)
+	}
+	if entries := m.ByAddress(types.UnlockHash{9}); len(entries) != 0 {
+		t.Errorf("ByAddress of unknown address = %v, want none", entries)
+	}
+	// Outputs of file contracts are addresses of the transaction too.
+	contract := types.Transaction{
+		FileContracts: []types.FileContract{{
+			MissedProofOutputs: []types.SiacoinOutput{{Value: types.NewCurrency64(1), UnlockHash: types.UnlockHash{7}}},
+		}},
+	}
+	if err := m.Add([]types.Transaction{contract}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	entries = m.ByAddress(types.UnlockHash{7})
+	if len(entries) != 1 || entries[0].ID != contract.ID() {
+		t.Errorf("ByAddress of output of file contract = %v, want the contract", entries)
+	}
+}
+
+func TestRemoveConflicting(t *testing.T) {
+	m, _, cleanup := tempMempool(t, 0)
+	defer cleanup()
+	defer m.Close()
+	txs := testTxs(3)
+	txs[0].SiacoinInputs = []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}}
+	txs[1].SiafundInputs = []types.SiafundInput{{ParentID: types.SiafundOutputID{2}}}
+	txs[2].SiacoinInputs = []types.SiacoinInput{{ParentID: types.SiacoinOutputID{3}}}
+	if err := m.Add(txs); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	// The block has other transactions spending outputs of 0 and 1.
+	confirmed := testTxs(6)[3:5]
+	confirmed[0].SiacoinInputs = []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}}
+	confirmed[1].SiafundInputs = []types.SiafundInput{{ParentID: types.SiafundOutputID{2}}}
+	m.RemoveConfirmed(confirmed)
+	got := ids(m.Entries())
+	if len(got) != 1 || !got[txs[2].ID()] {
+		t.Errorf("entries after RemoveConfirmed: %v, want only transaction 2", got)
+	}
+}
@@ -0,0 +1,121 @@
+package netlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// BlockHistory returns block IDs sent in SendBlocks to find the last
+// common block with the peer, as siad does: the 12 last blocks of the
+// chain, then blocks with exponentially growing steps, and the genesis.
+// ids are IDs of the blocks of the chain in order.
+func BlockHistory(ids []types.BlockID) [32]types.BlockID {
+	var history [32]types.BlockID
+	n := 0
+	step := 1
+	for i := len(ids) - 1; i >= 0 && n < 31; i -= step {
+		history[n] = ids[i]
+		n++
+		if n >= 12 {
+			step *= 2
+		}
+	}
+	history[31] = types.GenesisID
+	return history
+}
+
+// ChainComparison is the chain of a peer relative to the local chain.
+type ChainComparison struct {
+	// Ancestor is the last block of the local chain which the peer has
+	// (one of BlockHistory). If Ancestor is the last local block, the
+	// peer is on the local chain.
+	Ancestor types.BlockID
+
+	// Blocks is the number of blocks the peer has after Ancestor.
+	// If the peer has no blocks after it, the peer can be behind on
+	// the local chain as well.
+	Blocks int
+}
+
+// Diverged returns if the chain of the peer forked from the local chain
+// ending with tip.
+func (c *ChainComparison) Diverged(tip types.BlockID) bool {
+	return c.Ancestor != tip && c.Blocks != 0
+}
+
+// CompareChain finds the last common block of the local chain with
+// block IDs ids and the chain of the peer using SendBlocks, and counts
+// blocks of the peer after it. It stops after max blocks.
+func CompareChain(ctx context.Context, conn io.ReadWriter, ids []types.BlockID, max int) (*ChainComparison, error) {
+	if err := resetDeadline(conn); err != nil {
+		return nil, err
+	}
+	var rpcName [8]byte
+	copy(rpcName[:], "SendBlocks")
+	if err := encoding.WriteObject(conn, rpcName); err != nil {
+		return nil, err
+	}
+	history := BlockHistory(ids)
+	if err := encoding.WriteObject(conn, history); err != nil {
+		return nil, err
+	}
+	c := &ChainComparison{
+		Ancestor: history[0],
+	}
+	var prevBlockID types.BlockID
+	moreAvailable := true
+	for moreAvailable && c.Blocks < max {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if err := resetDeadline(conn); err != nil {
+			return nil, err
+		}
+		var newBlocks []types.Block
+		if err := encoding.ReadObject(conn, &newBlocks, uint64(consensus.MaxCatchUpBlocks)*types.BlockSizeLimit); err != nil {
+			return nil, err
+		}
+		if err := encoding.ReadObject(conn, &moreAvailable, 1); err != nil {
+			return nil, err
+		}
+		for i := range newBlocks {
+			b := &newBlocks[i]
+			if c.Blocks == 0 {
+				if !historyContains(history, b.ParentID) {
+					return nil, &BadBlockError{
+						ID:     b.ID(),
+						Reason: fmt.Sprintf("parent %s is not in the history", b.ParentID),
+					}
+				}
+				c.Ancestor = b.ParentID
+			} else if b.ParentID != prevBlockID {
+				return nil, &BadBlockError{
+					ID:     b.ID(),
+					Reason: fmt.Sprintf("parent: %s, prev: %s", b.ParentID, prevBlockID),
+				}
+			}
+			c.Blocks++
+			prevBlockID = b.ID()
+		}
+	}
+	if c.Blocks > max {
+		c.Blocks = max
+	}
+	return c, nil
+}
+
+func historyContains(history [32]types.BlockID, id types.BlockID) bool {
+	for _, h := range history {
+		if h == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package netlib
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func TestBlockHistory(t *testing.T) {
+	ids := make([]types.BlockID, 1000)
+	for i := range ids {
+		ids[i][0] = byte(i)
+		ids[i][1] = byte(i >> 8)
+		ids[i][2] = 1
+	}
+	history := BlockHistory(ids)
+	// 12 last blocks, then steps 2, 4, 8, ...
+	wantIndices := []int{999, 998, 997, 996, 995, 994, 993, 992, 991, 990, 989, 988, 986, 982, 974, 958, 926, 862, 734, 478}
+	for i, index := range wantIndices {
+		if history[i] != ids[index] {
+			t.Errorf("history[%d] is not block %d", i, index)
+		}
+	}
+	for i := len(wantIndices); i < 31; i++ {
+		if history[i] != (types.BlockID{}) {
+			t.Errorf("history[%d] is not empty", i)
+		}
+	}
+	if history[31] != types.GenesisID {
+		t.Errorf("history[31] is not the genesis")
+	}
+	short := BlockHistory(ids[:3])
+	for i := 0; i < 3; i++ {
+		if short[i] != ids[2-i] {
+			t.Errorf("short history[%d] is not block %d", i, 2-i)
+		}
+	}
+}
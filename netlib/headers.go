@@ -0,0 +1,240 @@
+package netlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+)
+
+const (
+	// headerSize is the size of encoded types.BlockHeader.
+	headerSize = 32 + 8 + 8 + 32
+
+	// sendHeadersRPC is the identifier of the RPC sending headers.
+	// Identifiers of RPCs are 8 bytes and siad truncates longer names
+	// (SendBlocks is sent as "SendBloc"), so the name has exactly 8
+	// bytes to be distinct from other RPCs.
+	sendHeadersRPC = "SendHdrs"
+)
+
+var (
+	// ErrNoHeaderRPC is returned by DownloadHeaders if the peer closed
+	// the stream without sending any header. Peers close streams of
+	// RPCs they do not know, so this means header-only download is
+	// not supported and SendBlocks must be used instead.
+	ErrNoHeaderRPC = fmt.Errorf("peer does not serve %s", sendHeadersRPC)
+
+	// errMissingBodies is returned by DownloadBodies if the peer has
+	// fewer blocks than headers.
+	errMissingBodies = fmt.Errorf("peer does not have blocks of all headers")
+)
+
+// DownloadHeaders downloads headers of all blocks after the last header
+// verified by v and verifies them with v (see cache.HeaderVerifier).
+// The protocol mirrors SendBlocks, but block headers are sent instead
+// of full blocks.
+func DownloadHeaders(ctx context.Context, conn io.ReadWriter, v *cache.HeaderVerifier) ([]types.BlockHeader, error) {
+	if err := resetDeadline(conn); err != nil {
+		return nil, err
+	}
+	var rpcName [8]byte
+	copy(rpcName[:], sendHeadersRPC)
+	if err := encoding.WriteObject(conn, rpcName); err != nil {
+		return nil, err
+	}
+	var history [32]types.BlockID
+	history[0] = v.LastID()
+	history[31] = types.GenesisID
+	if err := encoding.WriteObject(conn, history); err != nil {
+		return nil, err
+	}
+	var headers []types.BlockHeader
+	moreAvailable := true
+	for moreAvailable {
+		select {
+		case <-ctx.Done():
+			return headers, ctx.Err()
+		default:
+		}
+		if err := resetDeadline(conn); err != nil {
+			return headers, err
+		}
+		var newHeaders []types.BlockHeader
+		if err := encoding.ReadObject(conn, &newHeaders, uint64(consensus.MaxCatchUpBlocks)*headerSize+8); err != nil {
+			if len(headers) == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				return nil, ErrNoHeaderRPC
+			}
+			return headers, err
+		}
+		if err := encoding.ReadObject(conn, &moreAvailable, 1); err != nil {
+			return headers, err
+		}
+		for _, h := range newHeaders {
+			if h.ParentID != v.LastID() {
+				return headers, &BadBlockError{
+					ID:     h.ID(),
+					Reason: fmt.Sprintf("header parent: %s, prev: %s", h.ParentID, v.LastID()),
+				}
+			}
+			err := v.AppendHeader(cache.BlockHeader{
+				Nonce:      h.Nonce,
+				Timestamp:  h.Timestamp,
+				MerkleRoot: h.MerkleRoot,
+			})
+			if err != nil {
+				return headers, &BadBlockError{
+					ID:     h.ID(),
+					Reason: fmt.Sprintf("header %d: %v", v.Height(), err),
+				}
+			}
+			headers = append(headers, h)
+		}
+	}
+	log.Printf("Downloaded %d headers.", len(headers))
+	return headers, nil
+}
+
+// DownloadBlock downloads the block with the given ID using SendBlk.
+func DownloadBlock(conn io.ReadWriter, id types.BlockID) (*types.Block, error) {
+	if err := resetDeadline(conn); err != nil {
+		return nil, err
+	}
+	var rpcName [8]byte
+	copy(rpcName[:], "SendBlk")
+	if err := encoding.WriteObject(conn, rpcName); err != nil {
+		return nil, err
+	}
+	if err := encoding.WriteObject(conn, id); err != nil {
+		return nil, err
+	}
+	var b types.Block
+	if err := encoding.ReadObject(conn, &b, types.BlockSizeLimit); err != nil {
+		return nil, err
+	}
+	if b.ID() != id {
+		return nil, &BadBlockError{
+			ID:     b.ID(),
+			Reason: fmt.Sprintf("requested block %s", id),
+		}
+	}
+	return &b, nil
+}
+
+// downloadBodies downloads blocks after prevBlockID with SendBlocks
+// until all headers are matched. It returns the number of blocks sent
+// to bchan.
+func downloadBodies(ctx context.Context, bchan chan *types.Block, conn io.ReadWriter, prevBlockID types.BlockID, headers []types.BlockHeader) (int, error) {
+	if err := resetDeadline(conn); err != nil {
+		return 0, err
+	}
+	var rpcName [8]byte
+	copy(rpcName[:], "SendBlocks")
+	if err := encoding.WriteObject(conn, rpcName); err != nil {
+		return 0, err
+	}
+	var history [32]types.BlockID
+	history[0] = prevBlockID
+	history[31] = types.GenesisID
+	if err := encoding.WriteObject(conn, history); err != nil {
+		return 0, err
+	}
+	n := 0
+	moreAvailable := true
+	for moreAvailable && n < len(headers) {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		default:
+		}
+		if err := resetDeadline(conn); err != nil {
+			return n, err
+		}
+		var newBlocks []types.Block
+		if err := encoding.ReadObject(conn, &newBlocks, uint64(consensus.MaxCatchUpBlocks)*types.BlockSizeLimit); err != nil {
+			return n, err
+		}
+		if err := encoding.ReadObject(conn, &moreAvailable, 1); err != nil {
+			return n, err
+		}
+		for i := range newBlocks {
+			if n == len(headers) {
+				// Blocks mined after the headers were downloaded.
+				break
+			}
+			b := &newBlocks[i]
+			if id := b.ID(); id != headers[n].ID() {
+				return n, &BadBlockError{
+					ID:     id,
+					Reason: fmt.Sprintf("block %d does not match header %s", n, headers[n].ID()),
+				}
+			}
+			bchan <- b
+			n++
+		}
+	}
+	if n < len(headers) {
+		return n, errMissingBodies
+	}
+	return n, nil
+}
+
+// DownloadBodies downloads blocks matching the headers, which follow
+// prevBlockID, and sends them to bchan in order. Blocks are downloaded
+// in batches with SendBlocks; if a stream breaks, a new stream
+// continues after the last received block. Every block must match its
+// header.
+func DownloadBodies(ctx context.Context, bchan chan *types.Block, sess func() (io.ReadWriter, error), prevBlockID types.BlockID, headers []types.BlockHeader) error {
+	for len(headers) != 0 {
+		stream, err := sess()
+		if err != nil {
+			return err
+		}
+		n, err := downloadBodies(ctx, bchan, stream, prevBlockID, headers)
+		reportBadBlock(stream, err)
+		if c, ok := stream.(io.Closer); ok {
+			c.Close()
+		}
+		if n != 0 {
+			log.Printf("Downloaded %d blocks.", n)
+			prevBlockID = headers[n-1].ID()
+			headers = headers[n:]
+		}
+		if err == nil {
+			return nil
+		}
+		if n == 0 || (err != io.EOF && err != io.ErrUnexpectedEOF) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DownloadAllBlocksHeadersFirst downloads all blocks after the last
+// header verified by v. Headers are downloaded and verified with v
+// first, then bodies are fetched in batches. If the peer does not serve
+// header-only download, it falls back to DownloadAllBlocksFrom.
+func DownloadAllBlocksHeadersFirst(ctx context.Context, bchan chan *types.Block, sess func() (io.ReadWriter, error), v *cache.HeaderVerifier) error {
+	prevBlockID := v.LastID()
+	stream, err := sess()
+	if err != nil {
+		return err
+	}
+	headers, err := DownloadHeaders(ctx, stream, v)
+	reportBadBlock(stream, err)
+	if c, ok := stream.(io.Closer); ok {
+		c.Close()
+	}
+	if err == ErrNoHeaderRPC {
+		log.Printf("Peer does not serve headers, using SendBlocks.")
+		return DownloadAllBlocksFrom(ctx, bchan, sess, prevBlockID)
+	} else if err != nil {
+		return err
+	}
+	return DownloadBodies(ctx, bchan, sess, prevBlockID, headers)
+}
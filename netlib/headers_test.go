@@ -0,0 +1,253 @@
+package netlib
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/cache/cachetest"
+)
+
+// fakePeer serves SendBlocks and SendHdrs over the chain of blocks,
+// like siad serves SendBlocks. After breakAfter batches (if not 0) it
+// closes the stream.
+type fakePeer struct {
+	blocks     []*types.Block
+	rpcs       []string
+	breakAfter int
+}
+
+func (p *fakePeer) serve(conn net.Conn) {
+	defer conn.Close()
+	var rpcName [8]byte
+	if err := encoding.ReadObject(conn, &rpcName, 8); err != nil {
+		return
+	}
+	name := strings.TrimRight(string(rpcName[:]), "\x00")
+	p.rpcs = append(p.rpcs, name)
+	var history [32]types.BlockID
+	if err := encoding.ReadObject(conn, &history, 32*32); err != nil {
+		return
+	}
+	start := -1
+	for i, b := range p.blocks {
+		if b.ID() == history[0] {
+			start = i + 1
+		}
+	}
+	if start == -1 {
+		return
+	}
+	batches := 0
+	for start < len(p.blocks) {
+		end := start + int(consensus.MaxCatchUpBlocks)
+		if end > len(p.blocks) {
+			end = len(p.blocks)
+		}
+		var err error
+		switch name {
+		case "SendBloc":
+			var blocks []types.Block
+			for _, b := range p.blocks[start:end] {
+				blocks = append(blocks, *b)
+			}
+			err = encoding.WriteObject(conn, blocks)
+		case sendHeadersRPC:
+			var headers []types.BlockHeader
+			for _, b := range p.blocks[start:end] {
+				headers = append(headers, b.Header())
+			}
+			err = encoding.WriteObject(conn, headers)
+		default:
+			return
+		}
+		if err != nil {
+			return
+		}
+		if err := encoding.WriteObject(conn, end < len(p.blocks)); err != nil {
+			return
+		}
+		start = end
+		batches++
+		if p.breakAfter != 0 && batches == p.breakAfter {
+			return
+		}
+	}
+}
+
+func (p *fakePeer) dial() net.Conn {
+	client, server := net.Pipe()
+	go p.serve(server)
+	return client
+}
+
+func (p *fakePeer) sess() (io.ReadWriter, error) {
+	return p.dial(), nil
+}
+
+func genesisVerifier(t *testing.T, blocks []*types.Block) *cache.HeaderVerifier {
+	clock := cache.FixedClock(blocks[len(blocks)-1].Timestamp)
+	v, err := cache.NewHeaderVerifier(cache.HeaderVerifierState{}, clock)
+	if err != nil {
+		t.Fatalf("NewHeaderVerifier: %v", err)
+	}
+	genesis := blocks[0]
+	err = v.AppendHeader(cache.BlockHeader{
+		Nonce:      genesis.Nonce,
+		Timestamp:  genesis.Timestamp,
+		MerkleRoot: genesis.MerkleRoot(),
+	})
+	if err != nil {
+		t.Fatalf("AppendHeader(genesis): %v", err)
+	}
+	return v
+}
+
+func TestSendHeadersRPCName(t *testing.T) {
+	if len(sendHeadersRPC) != 8 {
+		t.Errorf("len(%q) = %d, want 8", sendHeadersRPC, len(sendHeadersRPC))
+	}
+	// Names of RPCs of siad, truncated to 8 bytes.
+	for _, name := range []string{"SendBlocks", "SendBlk", "RelayHeader", "RelayTransactionSet", "ShareNodes", "DiscoverIP"} {
+		if len(name) > 8 {
+			name = name[:8]
+		}
+		if name == sendHeadersRPC {
+			t.Errorf("%s collides with RPC %s of siad", sendHeadersRPC, name)
+		}
+	}
+}
+
+func TestDownloadHeaders(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	p := &fakePeer{blocks: blocks}
+	v := genesisVerifier(t, blocks)
+	conn := p.dial()
+	headers, err := DownloadHeaders(context.Background(), conn, v)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("DownloadHeaders: %v", err)
+	}
+	if len(headers) != len(blocks)-1 {
+		t.Fatalf("got %d headers, want %d", len(headers), len(blocks)-1)
+	}
+	if v.LastID() != blocks[len(blocks)-1].ID() || v.Height() != len(blocks) {
+		t.Errorf("verifier is at %d %s, want %d %s", v.Height(), v.LastID(), len(blocks), blocks[len(blocks)-1].ID())
+	}
+	if p.rpcs[0] != sendHeadersRPC {
+		t.Errorf("RPC %q was called, want %q", p.rpcs[0], sendHeadersRPC)
+	}
+
+	// Headers with IDs above the min target are rejected.
+	v2 := genesisVerifier(t, blocks)
+	var hard types.Target
+	hard[len(hard)-1] = 1
+	v2.SetMinTarget(hard)
+	conn = p.dial()
+	_, err = DownloadHeaders(context.Background(), conn, v2)
+	conn.Close()
+	if _, ok := err.(*BadBlockError); !ok || !strings.Contains(err.Error(), cache.ErrInsufficientWork.Error()) {
+		t.Errorf("DownloadHeaders with hard target returned %v, want BadBlockError of insufficient work", err)
+	}
+
+	// Timestamps are checked.
+	bad := append([]*types.Block(nil), blocks[:100]...)
+	early := *bad[50]
+	early.Timestamp = bad[0].Timestamp
+	bad[50] = &early
+	p2 := &fakePeer{blocks: bad}
+	conn = p2.dial()
+	headers, err = DownloadHeaders(context.Background(), conn, genesisVerifier(t, blocks))
+	conn.Close()
+	if _, ok := err.(*BadBlockError); !ok {
+		t.Errorf("DownloadHeaders with early timestamp returned %v, want BadBlockError", err)
+	}
+	if len(headers) != 49 {
+		t.Errorf("got %d headers before the bad one, want 49", len(headers))
+	}
+}
+
+func TestDownloadHeadersNoRPC(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		// Peers close streams of unknown RPCs.
+		var rpcName [8]byte
+		encoding.ReadObject(server, &rpcName, 8)
+		var history [32]types.BlockID
+		encoding.ReadObject(server, &history, 32*32)
+		server.Close()
+	}()
+	v, err := cache.NewHeaderVerifier(cache.HeaderVerifierState{}, nil)
+	if err != nil {
+		t.Fatalf("NewHeaderVerifier: %v", err)
+	}
+	if _, err := DownloadHeaders(context.Background(), client, v); err != ErrNoHeaderRPC {
+		t.Errorf("DownloadHeaders returned %v, want ErrNoHeaderRPC", err)
+	}
+}
+
+func TestDownloadBodies(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	var headers []types.BlockHeader
+	for _, b := range blocks[1:] {
+		headers = append(headers, b.Header())
+	}
+	// The peer has more blocks than headers and breaks streams.
+	p := &fakePeer{blocks: blocks, breakAfter: 30}
+	bchan := make(chan *types.Block, len(blocks))
+	if err := DownloadBodies(context.Background(), bchan, p.sess, blocks[0].ID(), headers[:500]); err != nil {
+		t.Fatalf("DownloadBodies: %v", err)
+	}
+	close(bchan)
+	i := 1
+	for b := range bchan {
+		if b.ID() != blocks[i].ID() {
+			t.Fatalf("block %d is %s, want %s", i, b.ID(), blocks[i].ID())
+		}
+		i++
+	}
+	if i != 501 {
+		t.Errorf("got %d blocks, want 500", i-1)
+	}
+	// 500 blocks in batches of MaxCatchUpBlocks, 30 batches per stream.
+	perStream := 30 * int(consensus.MaxCatchUpBlocks)
+	if want := (500 + perStream - 1) / perStream; len(p.rpcs) != want {
+		t.Errorf("%d streams were used, want %d", len(p.rpcs), want)
+	}
+	for _, name := range p.rpcs {
+		if name != "SendBloc" {
+			t.Errorf("RPC %q was called, want SendBlocks", name)
+		}
+	}
+
+	// Blocks not matching headers are rejected.
+	wrong := append([]types.BlockHeader(nil), headers[:20]...)
+	wrong[10].Nonce[0]++
+	bchan = make(chan *types.Block, len(blocks))
+	err = DownloadBodies(context.Background(), bchan, (&fakePeer{blocks: blocks}).sess, blocks[0].ID(), wrong)
+	if _, ok := err.(*BadBlockError); !ok {
+		t.Errorf("DownloadBodies with wrong header returned %v, want BadBlockError", err)
+	}
+	if len(bchan) != 10 {
+		t.Errorf("%d blocks were sent before the wrong one, want 10", len(bchan))
+	}
+
+	// The peer does not have all blocks.
+	bchan = make(chan *types.Block, len(blocks))
+	err = DownloadBodies(context.Background(), bchan, (&fakePeer{blocks: blocks[:100]}).sess, blocks[0].ID(), headers[:200])
+	if err != errMissingBodies {
+		t.Errorf("DownloadBodies with missing blocks returned %v, want errMissingBodies", err)
+	}
+}
@@ -7,13 +7,13 @@ import (
 	"log"
 	"net"
 	"os"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
 	"github.com/NebulousLabs/Sia/types"
-	"github.com/NebulousLabs/fastrand"
 	"github.com/xtaci/smux"
 )
 
@@ -23,20 +23,151 @@ type sessionHeader struct {
 	NetAddress modules.NetAddress
 }
 
+const (
+	// minPeerVersion is the first version of siad using smux sessions
+	// and exchanging sessionHeader. Older peers speak a different
+	// protocol, which is not supported.
+	minPeerVersion = "1.3.0"
+
+	rejectResponse = "reject"
+)
+
+var (
+	ErrOldPeer = fmt.Errorf("peer version is older than %s", minPeerVersion)
+
+	// rpcVersions maps names of supported RPCs to the version of siad
+	// which introduced them. All of them predate minPeerVersion, so
+	// peers passing the handshake serve them, but an RPC added to siad
+	// later is refused to older peers by Peer.Supports.
+	rpcVersions = map[string]string{
+		"SendBlocks": "0.3.0",
+		"ShareNodes": "0.3.0",
+		// siad 0.5.1 and older relay whole blocks with RelayBlock.
+		"SendBlk":     "0.5.2",
+		"RelayHeader": "0.5.2",
+	}
+)
+
+// DialOptions configures connections to peers. Zero values disable
+// the corresponding timeouts.
+type DialOptions struct {
+	// DialTimeout limits establishing of TCP connection.
+	DialTimeout time.Duration
+
+	// ReadTimeout limits the handshake and every read of RPC responses.
+	// The deadline is reset after each batch of blocks.
+	ReadTimeout time.Duration
+
+	// KeepAlive is the period of TCP keepalive probes.
+	KeepAlive time.Duration
+
+	// Peers, if not nil, records quality of peers. Banned peers are
+	// not connected to.
+	Peers *PeerBook
+}
+
+// DefaultDialOptions are used by Connect, ConnectPeer and OpenOrConnect.
+var DefaultDialOptions = DialOptions{
+	DialTimeout: 30 * time.Second,
+	ReadTimeout: 2 * time.Minute,
+	KeepAlive:   30 * time.Second,
+}
+
+// Peer is a connection to siad after the handshake.
+type Peer struct {
+	Conn    net.Conn
+	Version string
+}
+
+// Supports returns if the peer serves the RPC.
+func (p *Peer) Supports(rpcName string) bool {
+	v, has := rpcVersions[rpcName]
+	return has && build.VersionCmp(p.Version, v) >= 0
+}
+
 func Connect(ctx context.Context, node string) (net.Conn, error) {
+	p, err := ConnectPeer(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	return p.Conn, nil
+}
+
+// ConnectPeer connects to node and negotiates the session depending on
+// the version of the peer.
+func ConnectPeer(ctx context.Context, node string) (*Peer, error) {
+	return ConnectPeerWithOptions(ctx, node, DefaultDialOptions)
+}
+
+// ConnectPeerWithOptions is like ConnectPeer, but uses opts.
+func ConnectPeerWithOptions(ctx context.Context, node string, opts DialOptions) (*Peer, error) {
 	log.Println("Using node: ", node)
-	conn, err := net.Dial("tcp", node)
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: opts.KeepAlive,
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", node)
 	if err != nil {
 		return nil, err
 	}
-	version := build.Version
-	if err := encoding.WriteObject(conn, version); err != nil {
+	if opts.ReadTimeout != 0 {
+		if err := conn.SetDeadline(time.Now().Add(opts.ReadTimeout)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	p, err := handshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Deadlines of the session are set on its streams.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// deadlineResetter is implemented by streams with read timeout.
+type deadlineResetter interface {
+	resetDeadline() error
+}
+
+// resetDeadline moves the read deadline of the stream, if it has one.
+func resetDeadline(conn io.ReadWriter) error {
+	if d, ok := conn.(deadlineResetter); ok {
+		return d.resetDeadline()
+	}
+	return nil
+}
+
+// timeoutStream is a stream of a session with read timeout.
+type timeoutStream struct {
+	*smux.Stream
+	timeout time.Duration
+}
+
+func (s *timeoutStream) resetDeadline() error {
+	return s.SetReadDeadline(time.Now().Add(s.timeout))
+}
+
+func handshake(conn net.Conn) (*Peer, error) {
+	if err := encoding.WriteObject(conn, build.Version); err != nil {
 		return nil, err
 	}
+	var version string
 	if err := encoding.ReadObject(conn, &version, uint64(100)); err != nil {
 		return nil, err
 	}
 	log.Println(version)
+	if version == rejectResponse {
+		return nil, fmt.Errorf("peer rejected our version %s", build.Version)
+	} else if !build.IsVersion(version) {
+		return nil, fmt.Errorf("peer sent invalid version %q", version)
+	} else if build.VersionCmp(version, minPeerVersion) < 0 {
+		return nil, fmt.Errorf("%v: %s", ErrOldPeer, version)
+	}
 	sh := sessionHeader{
 		GenesisID:  types.GenesisID,
 		UniqueID:   [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
@@ -56,13 +187,23 @@ func Connect(ctx context.Context, node string) (net.Conn, error) {
 	if err := encoding.ReadObject(conn, &sh, uint64(100)); err != nil {
 		return nil, err
 	}
+	if sh.GenesisID != types.GenesisID {
+		encoding.WriteObject(conn, rejectResponse)
+		return nil, fmt.Errorf("peer has different genesis block %s", sh.GenesisID)
+	}
 	if err := encoding.WriteObject(conn, modules.AcceptResponse); err != nil {
 		return nil, err
 	}
-	return conn, nil
+	return &Peer{
+		Conn:    conn,
+		Version: version,
+	}, nil
 }
 
 func DownloadBlocks(ctx context.Context, bchan chan *types.Block, conn io.ReadWriter, prevBlockID types.BlockID) (types.BlockID, error) {
+	if err := resetDeadline(conn); err != nil {
+		return prevBlockID, err
+	}
 	var rpcName [8]byte
 	copy(rpcName[:], "SendBlocks")
 	if err := encoding.WriteObject(conn, rpcName); err != nil {
@@ -82,6 +223,9 @@ func DownloadBlocks(ctx context.Context, bchan chan *types.Block, conn io.ReadWr
 			return prevBlockID, ctx.Err()
 		default:
 		}
+		if err := resetDeadline(conn); err != nil {
+			return prevBlockID, err
+		}
 		// Read a slice of blocks from the wire.
 		var newBlocks []types.Block
 		if err := encoding.ReadObject(conn, &newBlocks, uint64(consensus.MaxCatchUpBlocks)*types.BlockSizeLimit); err != nil {
@@ -94,7 +238,10 @@ func DownloadBlocks(ctx context.Context, bchan chan *types.Block, conn io.ReadWr
 		for i := range newBlocks {
 			b := &newBlocks[i]
 			if b.ParentID != prevBlockID {
-				return prevBlockID, fmt.Errorf("parent: %s, prev: %s", b.ParentID, prevBlockID)
+				return prevBlockID, &BadBlockError{
+					ID:     b.ID(),
+					Reason: fmt.Sprintf("parent: %s, prev: %s", b.ParentID, prevBlockID),
+				}
 			}
 			log.Printf("Downloaded block %s.", b.ID())
 			bchan <- b
@@ -105,13 +252,18 @@ func DownloadBlocks(ctx context.Context, bchan chan *types.Block, conn io.ReadWr
 }
 
 func DownloadAllBlocks(ctx context.Context, bchan chan *types.Block, sess func() (io.ReadWriter, error)) error {
-	prevBlockID := types.GenesisID
+	return DownloadAllBlocksFrom(ctx, bchan, sess, types.GenesisID)
+}
+
+// DownloadAllBlocksFrom downloads all blocks after prevBlockID.
+func DownloadAllBlocksFrom(ctx context.Context, bchan chan *types.Block, sess func() (io.ReadWriter, error), prevBlockID types.BlockID) error {
 	for {
 		stream, err := sess()
 		if err != nil {
 			return err
 		}
 		newPrevBlockID, err := DownloadBlocks(ctx, bchan, stream, prevBlockID)
+		reportBadBlock(stream, err)
 		hadBlocks := newPrevBlockID != prevBlockID
 		log.Printf("DownloadBlocks returned %v, %v.", hadBlocks, err)
 		if err == nil || newPrevBlockID == prevBlockID {
@@ -140,6 +292,14 @@ func (t *blockchainReader) Write(b []byte) (int, error) {
 }
 
 func OpenOrConnect(ctx context.Context, file, node string) (*smux.Session, func() (io.ReadWriter, error), error) {
+	return OpenOrConnectWithOptions(ctx, file, node, DefaultDialOptions)
+}
+
+// OpenOrConnectWithOptions is like OpenOrConnect, but uses opts.
+// If opts.Peers is set, quality of the peer is recorded there and
+// banned peers are not connected to. If node is empty, a random
+// bootstrap peer which is not banned is used.
+func OpenOrConnectWithOptions(ctx context.Context, file, node string, opts DialOptions) (*smux.Session, func() (io.ReadWriter, error), error) {
 	if file != "" {
 		bc, err := os.Open(file)
 		if err != nil {
@@ -150,20 +310,53 @@ func OpenOrConnect(ctx context.Context, file, node string) (*smux.Session, func(
 		}
 		return nil, f, nil
 	}
-	if node == "" {
-		i := fastrand.Intn(len(modules.BootstrapPeers))
-		node = string(modules.BootstrapPeers[i])
-	}
-	conn, err := Connect(ctx, node)
+	s, err := Dial(ctx, node, opts)
 	if err != nil {
 		return nil, nil, err
 	}
-	sess, err := smux.Client(conn, nil)
-	if err != nil {
+	if err := s.rpc("SendBlocks"); err != nil {
+		s.Close()
 		return nil, nil, err
 	}
-	f := func() (io.ReadWriter, error) {
-		return sess.OpenStream()
+	return s.sess, s.OpenStream, nil
+}
+
+// ServeRelayedTransactions accepts streams opened by the peer and passes
+// transaction sets relayed by it to f. Other RPCs are ignored.
+// It returns when the session is closed or ctx is canceled.
+func ServeRelayedTransactions(ctx context.Context, sess *smux.Session, f func([]types.Transaction) error) error {
+	go func() {
+		<-ctx.Done()
+		sess.Close()
+	}()
+	for {
+		stream, err := sess.AcceptStream()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		var rpcName [8]byte
+		if err := encoding.ReadObject(stream, &rpcName, 8); err != nil {
+			stream.Close()
+			continue
+		}
+		var relayName [8]byte
+		copy(relayName[:], "RelayTransactionSet")
+		if rpcName != relayName {
+			stream.Close()
+			continue
+		}
+		var txs []types.Transaction
+		err = encoding.ReadObject(stream, &txs, types.BlockSizeLimit)
+		stream.Close()
+		if err != nil {
+			log.Printf("Failed to read relayed transactions: %v.", err)
+			continue
+		}
+		if err := f(txs); err != nil {
+			return err
+		}
 	}
-	return sess, f, nil
 }
@@ -0,0 +1,34 @@
+package netlib
+
+import (
+	"testing"
+)
+
+func TestSupports(t *testing.T) {
+	cases := []struct {
+		version, rpc string
+		want         bool
+	}{
+		{"1.3.0", "SendBlocks", true},
+		{"1.3.0", "SendBlk", true},
+		{"1.4.1", "RelayHeader", true},
+		{"0.5.2", "SendBlk", true},
+		{"0.5.1", "SendBlk", false},
+		{"0.5.1", "RelayHeader", false},
+		{"0.5.1", "SendBlocks", true},
+		{"1.3.0", "UnknownRPC", false},
+	}
+	for _, c := range cases {
+		p := &Peer{Version: c.version}
+		if got := p.Supports(c.rpc); got != c.want {
+			t.Errorf("peer %s: Supports(%s) = %v, want %v", c.version, c.rpc, got, c.want)
+		}
+	}
+	s := &Session{Peer: &Peer{Version: "0.5.1"}, Node: "old.example.com:9981"}
+	if err := s.rpc("SendBlk"); err == nil {
+		t.Errorf("the session of peer 0.5.1 allowed SendBlk")
+	}
+	if err := s.rpc("SendBlocks"); err != nil {
+		t.Errorf("the session of peer 0.5.1 refused SendBlocks: %v", err)
+	}
+}
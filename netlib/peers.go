@@ -0,0 +1,194 @@
+package netlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// HANDSHAKE_FAILURES_TO_BAN is the number of consecutive failed
+	// handshakes after which the peer is banned for HANDSHAKE_BAN.
+	HANDSHAKE_FAILURES_TO_BAN = 3
+	HANDSHAKE_BAN             = time.Hour
+
+	// BAD_BLOCK_BAN is how long the peer is banned after it served
+	// a block not extending the chain.
+	BAD_BLOCK_BAN = 24 * time.Hour
+)
+
+var ErrBanned = fmt.Errorf("peer is banned")
+
+// BadBlockError is returned by download functions if the peer sent
+// a block or a header which does not extend the chain or a block
+// other than requested.
+type BadBlockError struct {
+	ID     types.BlockID
+	Reason string
+}
+
+func (e *BadBlockError) Error() string {
+	return fmt.Sprintf("bad block %s: %s", e.ID, e.Reason)
+}
+
+// PeerStats is the quality record of a peer.
+type PeerStats struct {
+	// FailedHandshakes is the number of consecutive failed handshakes.
+	FailedHandshakes int
+	BadBlocks        int
+	BytesDownloaded  int64
+	DownloadTime     time.Duration
+	BannedUntil      time.Time
+}
+
+// PeerBook keeps PeerStats of peers and persists them to disk, so bans
+// survive restarts. It is safe for concurrent use.
+type PeerBook struct {
+	mu    sync.Mutex
+	path  string
+	peers map[string]*PeerStats
+}
+
+// OpenPeerBook loads the peer book from the file (creating it if needed).
+func OpenPeerBook(path string) (*PeerBook, error) {
+	b := &PeerBook{
+		path:  path,
+		peers: make(map[string]*PeerStats),
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &b.peers); err != nil {
+			return nil, fmt.Errorf("loading %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Save writes the peer book to its file.
+func (b *PeerBook) Save() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.save()
+}
+
+func (b *PeerBook) save() error {
+	data, err := json.MarshalIndent(b.peers, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmpPath := b.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, b.path)
+}
+
+// Stats returns the stats of the peer.
+func (b *PeerBook) Stats(node string) PeerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p, has := b.peers[node]; has {
+		return *p
+	}
+	return PeerStats{}
+}
+
+// Banned returns if the peer is banned at the moment.
+func (b *PeerBook) Banned(node string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, has := b.peers[node]
+	return has && now.Before(p.BannedUntil)
+}
+
+func (b *PeerBook) peer(node string) *PeerStats {
+	p, has := b.peers[node]
+	if !has {
+		p = &PeerStats{}
+		b.peers[node] = p
+	}
+	return p
+}
+
+func (b *PeerBook) handshakeFailed(node string, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.peer(node)
+	p.FailedHandshakes++
+	if p.FailedHandshakes >= HANDSHAKE_FAILURES_TO_BAN {
+		p.BannedUntil = now.Add(HANDSHAKE_BAN)
+		p.FailedHandshakes = 0
+	}
+	return b.save()
+}
+
+func (b *PeerBook) handshakeSucceeded(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.peer(node).FailedHandshakes = 0
+}
+
+func (b *PeerBook) badBlock(node string, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.peer(node)
+	p.BadBlocks++
+	p.BannedUntil = now.Add(BAD_BLOCK_BAN)
+	return b.save()
+}
+
+func (b *PeerBook) downloaded(node string, n int, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.peer(node)
+	p.BytesDownloaded += int64(n)
+	p.DownloadTime += d
+}
+
+// peerStream is a stream of a peer which records throughput
+// and bad blocks in PeerBook.
+type peerStream struct {
+	io.ReadWriter
+	book *PeerBook
+	node string
+}
+
+func (s *peerStream) Read(p []byte) (int, error) {
+	started := time.Now()
+	n, err := s.ReadWriter.Read(p)
+	s.book.downloaded(s.node, n, time.Since(started))
+	return n, err
+}
+
+func (s *peerStream) resetDeadline() error {
+	return resetDeadline(s.ReadWriter)
+}
+
+func (s *peerStream) Close() error {
+	if c, ok := s.ReadWriter.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// reportBadBlock bans the peer of the stream if err is BadBlockError.
+func reportBadBlock(stream io.ReadWriter, err error) {
+	if _, ok := err.(*BadBlockError); !ok {
+		return
+	}
+	if ps, ok := stream.(*peerStream); ok {
+		log.Printf("Banning %s for %s: %v.", ps.node, BAD_BLOCK_BAN, err)
+		if err := ps.book.badBlock(ps.node, time.Now()); err != nil {
+			log.Printf("Saving peer book: %v.", err)
+		}
+	}
+}
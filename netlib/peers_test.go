@@ -0,0 +1,55 @@
+package netlib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPeerBookBans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestPeerBookBans")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "peers.json")
+	b, err := OpenPeerBook(path)
+	if err != nil {
+		t.Fatalf("OpenPeerBook: %v", err)
+	}
+	now := time.Now()
+	const node = "1.2.3.4:9981"
+	for i := 0; i < HANDSHAKE_FAILURES_TO_BAN-1; i++ {
+		if err := b.handshakeFailed(node, now); err != nil {
+			t.Fatalf("handshakeFailed: %v", err)
+		}
+	}
+	if b.Banned(node, now) {
+		t.Errorf("peer is banned after %d failed handshakes", HANDSHAKE_FAILURES_TO_BAN-1)
+	}
+	if err := b.handshakeFailed(node, now); err != nil {
+		t.Fatalf("handshakeFailed: %v", err)
+	}
+	if !b.Banned(node, now) {
+		t.Errorf("peer is not banned after %d failed handshakes", HANDSHAKE_FAILURES_TO_BAN)
+	}
+	if b.Banned(node, now.Add(HANDSHAKE_BAN+time.Second)) {
+		t.Errorf("peer is banned after the ban expired")
+	}
+	const node2 = "5.6.7.8:9981"
+	if err := b.badBlock(node2, now); err != nil {
+		t.Fatalf("badBlock: %v", err)
+	}
+	b2, err := OpenPeerBook(path)
+	if err != nil {
+		t.Fatalf("OpenPeerBook: %v", err)
+	}
+	if !b2.Banned(node, now) || !b2.Banned(node2, now) {
+		t.Errorf("bans were not persisted")
+	}
+	if stats := b2.Stats(node2); stats.BadBlocks != 1 {
+		t.Errorf("BadBlocks = %d, want 1", stats.BadBlocks)
+	}
+}
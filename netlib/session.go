@@ -0,0 +1,166 @@
+package netlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+	"github.com/xtaci/smux"
+)
+
+const (
+	// maxSharedNodes is the max number of addresses returned by ShareNodes.
+	maxSharedNodes = 10
+
+	// maxNetAddressSize is the max size of encoded modules.NetAddress:
+	// length prefix, host name and port.
+	maxNetAddressSize = 8 + 255 + 6
+)
+
+// Session is a multiplexed connection to a peer. Each RPC runs in its
+// own stream, so several RPCs (downloading blocks, sharing nodes,
+// serving relayed transactions) can run concurrently over one
+// connection, as in siad. It is safe for concurrent use.
+type Session struct {
+	Peer *Peer
+	Node string
+
+	sess *smux.Session
+	opts DialOptions
+}
+
+// Dial connects to node and opens a session. If node is empty,
+// a random bootstrap peer (not banned in opts.Peers) is used.
+func Dial(ctx context.Context, node string, opts DialOptions) (*Session, error) {
+	book := opts.Peers
+	if node == "" {
+		for _, i := range fastrand.Perm(len(modules.BootstrapPeers)) {
+			node = string(modules.BootstrapPeers[i])
+			if book == nil || !book.Banned(node, time.Now()) {
+				break
+			}
+		}
+	}
+	if book != nil && book.Banned(node, time.Now()) {
+		return nil, fmt.Errorf("%s: %v", node, ErrBanned)
+	}
+	p, err := ConnectPeerWithOptions(ctx, node, opts)
+	if err != nil {
+		if book != nil {
+			if err := book.handshakeFailed(node, time.Now()); err != nil {
+				log.Printf("Saving peer book: %v.", err)
+			}
+		}
+		return nil, err
+	}
+	if book != nil {
+		book.handshakeSucceeded(node)
+	}
+	sess, err := smux.Client(p.Conn, nil)
+	if err != nil {
+		p.Conn.Close()
+		return nil, err
+	}
+	return &Session{
+		Peer: p,
+		Node: node,
+		sess: sess,
+		opts: opts,
+	}, nil
+}
+
+// Close closes the session and the connection.
+func (s *Session) Close() error {
+	return s.sess.Close()
+}
+
+// OpenStream opens a stream for a new RPC.
+func (s *Session) OpenStream() (io.ReadWriter, error) {
+	stream, err := s.sess.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	var rw io.ReadWriter = stream
+	if s.opts.ReadTimeout != 0 {
+		rw = &timeoutStream{Stream: stream, timeout: s.opts.ReadTimeout}
+	}
+	if s.opts.Peers != nil {
+		rw = &peerStream{ReadWriter: rw, book: s.opts.Peers, node: s.Node}
+	}
+	return rw, nil
+}
+
+func (s *Session) rpc(name string) error {
+	if !s.Peer.Supports(name) {
+		return fmt.Errorf("peer %s (version %s) does not support %s", s.Node, s.Peer.Version, name)
+	}
+	return nil
+}
+
+// DownloadBlocks downloads all blocks after prevBlockID.
+// See DownloadAllBlocksFrom.
+func (s *Session) DownloadBlocks(ctx context.Context, bchan chan *types.Block, prevBlockID types.BlockID) error {
+	if err := s.rpc("SendBlocks"); err != nil {
+		return err
+	}
+	return DownloadAllBlocksFrom(ctx, bchan, s.OpenStream, prevBlockID)
+}
+
+// CompareChain compares the local chain with block IDs ids with the
+// chain of the peer. See the function CompareChain.
+func (s *Session) CompareChain(ctx context.Context, ids []types.BlockID, max int) (*ChainComparison, error) {
+	if err := s.rpc("SendBlocks"); err != nil {
+		return nil, err
+	}
+	stream, err := s.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := stream.(io.Closer); ok {
+		defer c.Close()
+	}
+	return CompareChain(ctx, stream, ids, max)
+}
+
+// ShareNodes asks the peer for addresses of other peers.
+func (s *Session) ShareNodes() ([]modules.NetAddress, error) {
+	if err := s.rpc("ShareNodes"); err != nil {
+		return nil, err
+	}
+	stream, err := s.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := stream.(io.Closer); ok {
+		defer c.Close()
+	}
+	if err := resetDeadline(stream); err != nil {
+		return nil, err
+	}
+	var rpcName [8]byte
+	copy(rpcName[:], "ShareNodes")
+	if err := encoding.WriteObject(stream, rpcName); err != nil {
+		return nil, err
+	}
+	var nodes []modules.NetAddress
+	if err := encoding.ReadObject(stream, &nodes, 8+maxSharedNodes*maxNetAddressSize); err != nil {
+		return nil, err
+	}
+	if len(nodes) > maxSharedNodes {
+		return nil, fmt.Errorf("peer %s shared %d nodes, max %d", s.Node, len(nodes), maxSharedNodes)
+	}
+	return nodes, nil
+}
+
+// ServeRelayedTransactions passes transaction sets relayed by the peer
+// to f, while other RPCs run over the session. See the function
+// ServeRelayedTransactions.
+func (s *Session) ServeRelayedTransactions(ctx context.Context, f func([]types.Transaction) error) error {
+	return ServeRelayedTransactions(ctx, s.sess, f)
+}
@@ -0,0 +1,251 @@
+// Package parquetexport writes the contents of the index built by
+// cache.Builder into Parquet files partitioned by block range.
+//
+// Each partition is a directory named blocks=START-END (END is exclusive)
+// containing transactions.parquet, outputs.parquet and
+// address_activity.parquet.
+package parquetexport
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type Transaction struct {
+	ID                string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Height            int64  `parquet:"name=height, type=INT64"`
+	Timestamp         int64  `parquet:"name=timestamp, type=INT64"`
+	ItemIndex         int64  `parquet:"name=item_index, type=INT64"`
+	Position          int32  `parquet:"name=position, type=INT32"`
+	Size              int32  `parquet:"name=size, type=INT32"`
+	SiacoinInputs     int32  `parquet:"name=siacoin_inputs, type=INT32"`
+	SiacoinOutputs    int32  `parquet:"name=siacoin_outputs, type=INT32"`
+	SiafundInputs     int32  `parquet:"name=siafund_inputs, type=INT32"`
+	SiafundOutputs    int32  `parquet:"name=siafund_outputs, type=INT32"`
+	FileContracts     int32  `parquet:"name=file_contracts, type=INT32"`
+	ContractRevisions int32  `parquet:"name=contract_revisions, type=INT32"`
+	StorageProofs     int32  `parquet:"name=storage_proofs, type=INT32"`
+	MinerFees         string `parquet:"name=miner_fees, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type Output struct {
+	ID         string `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Height     int64  `parquet:"name=height, type=INT64"`
+	ItemIndex  int64  `parquet:"name=item_index, type=INT64"`
+	Nature     string `parquet:"name=nature, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Position   int32  `parquet:"name=position, type=INT32"`
+	Position0  int32  `parquet:"name=position0, type=INT32"`
+	UnlockHash string `parquet:"name=unlock_hash, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Value      string `parquet:"name=value, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type AddressActivity struct {
+	UnlockHash string `parquet:"name=unlock_hash, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Height     int64  `parquet:"name=height, type=INT64"`
+	Timestamp  int64  `parquet:"name=timestamp, type=INT64"`
+	ItemIndex  int64  `parquet:"name=item_index, type=INT64"`
+	Spent      bool   `parquet:"name=spent, type=BOOLEAN"`
+	Received   bool   `parquet:"name=received, type=BOOLEAN"`
+}
+
+type table struct {
+	file   source.ParquetFile
+	writer *writer.ParquetWriter
+}
+
+func openTable(dir, name string, obj interface{}) (*table, error) {
+	file, err := local.NewLocalFileWriter(filepath.Join(dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("local.NewLocalFileWriter(%q): %v", name, err)
+	}
+	w, err := writer.NewParquetWriter(file, obj, 1)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("writer.NewParquetWriter(%q): %v", name, err)
+	}
+	w.CompressionType = parquet.CompressionCodec_SNAPPY
+	return &table{file: file, writer: w}, nil
+}
+
+func (t *table) close() error {
+	if err := t.writer.WriteStop(); err != nil {
+		return fmt.Errorf("WriteStop: %v", err)
+	}
+	return t.file.Close()
+}
+
+type partition struct {
+	transactions, outputs, activity *table
+}
+
+func openPartition(dir string, start, end int) (*partition, error) {
+	pdir := filepath.Join(dir, fmt.Sprintf("blocks=%d-%d", start, end))
+	if err := os.Mkdir(pdir, 0755); err != nil {
+		return nil, err
+	}
+	p := &partition{}
+	var err error
+	if p.transactions, err = openTable(pdir, "transactions.parquet", new(Transaction)); err != nil {
+		return nil, err
+	}
+	if p.outputs, err = openTable(pdir, "outputs.parquet", new(Output)); err != nil {
+		return nil, err
+	}
+	if p.activity, err = openTable(pdir, "address_activity.parquet", new(AddressActivity)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *partition) close() error {
+	for _, t := range []*table{p.transactions, p.outputs, p.activity} {
+		if err := t.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *partition) addBlock(b *cache.DecodedBlock) error {
+	height := int64(b.Height)
+	timestamp := int64(b.Header.Timestamp)
+	for i, payout := range b.MinerPayouts {
+		itemIndex := int64(b.FirstItem + i)
+		id := cache.MinerPayoutID(b.ID, i)
+		uh := payout.UnlockHash.String()
+		if err := p.outputs.writer.Write(Output{
+			ID:         id.String(),
+			Height:     height,
+			ItemIndex:  itemIndex,
+			Nature:     cache.NATURE_MINER_PAYOUT,
+			Position:   int32(i),
+			UnlockHash: uh,
+			Value:      cache.FormatHastings(payout.Value),
+		}); err != nil {
+			return err
+		}
+		if err := p.activity.writer.Write(AddressActivity{
+			UnlockHash: uh,
+			Height:     height,
+			Timestamp:  timestamp,
+			ItemIndex:  itemIndex,
+			Received:   true,
+		}); err != nil {
+			return err
+		}
+	}
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		itemIndex := int64(b.FirstTx + i)
+		fees := types.NewCurrency64(0)
+		for _, fee := range tx.MinerFees {
+			fees = fees.Add(fee)
+		}
+		if err := p.transactions.writer.Write(Transaction{
+			ID:                tx.ID().String(),
+			Height:            height,
+			Timestamp:         timestamp,
+			ItemIndex:         itemIndex,
+			Position:          int32(i),
+			Size:              int32(b.ItemSizes[len(b.MinerPayouts)+i]),
+			SiacoinInputs:     int32(len(tx.SiacoinInputs)),
+			SiacoinOutputs:    int32(len(tx.SiacoinOutputs)),
+			SiafundInputs:     int32(len(tx.SiafundInputs)),
+			SiafundOutputs:    int32(len(tx.SiafundOutputs)),
+			FileContracts:     int32(len(tx.FileContracts)),
+			ContractRevisions: int32(len(tx.FileContractRevisions)),
+			StorageProofs:     int32(len(tx.StorageProofs)),
+			MinerFees:         cache.FormatHastings(fees),
+		}); err != nil {
+			return err
+		}
+		// One activity record per address per transaction.
+		activity := make(map[types.UnlockHash]*AddressActivity)
+		var order []types.UnlockHash
+		touch := func(uh types.UnlockHash) *AddressActivity {
+			a, has := activity[uh]
+			if !has {
+				a = &AddressActivity{
+					UnlockHash: uh.String(),
+					Height:     height,
+					Timestamp:  timestamp,
+					ItemIndex:  itemIndex,
+				}
+				activity[uh] = a
+				order = append(order, uh)
+			}
+			return a
+		}
+		for _, in := range cache.TransactionInputs(tx) {
+			touch(in.UnlockHash).Spent = true
+		}
+		for _, out := range cache.TransactionOutputs(tx) {
+			touch(out.UnlockHash).Received = true
+			if err := p.outputs.writer.Write(Output{
+				ID:         hex.EncodeToString(out.ID[:]),
+				Height:     height,
+				ItemIndex:  itemIndex,
+				Nature:     out.Nature,
+				Position:   int32(out.Index),
+				Position0:  int32(out.Index0),
+				UnlockHash: out.UnlockHash.String(),
+				Value:      cache.FormatHastings(out.Value),
+			}); err != nil {
+				return err
+			}
+		}
+		for _, uh := range order {
+			if err := p.activity.writer.Write(*activity[uh]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Export writes blocks of s into dir, one partition per blocksPerPartition
+// blocks. Partitions start at heights divisible by blocksPerPartition, so
+// the first and the last partitions of an index starting from
+// a checkpoint may be shorter. Blocks are decoded one by one, so memory
+// usage does not depend on the size of the blockchain.
+func Export(s *cache.Server, dir string, blocksPerPartition int) error {
+	if blocksPerPartition <= 0 {
+		return fmt.Errorf("blocksPerPartition must be positive")
+	}
+	var p *partition
+	endHeight := s.StartHeight() + s.NumBlocks()
+	err := s.ForEachBlock(0, s.NumBlocks(), func(b *cache.DecodedBlock) error {
+		if p == nil || b.Height%blocksPerPartition == 0 {
+			if p != nil {
+				if err := p.close(); err != nil {
+					return err
+				}
+			}
+			end := b.Height - b.Height%blocksPerPartition + blocksPerPartition
+			if end > endHeight {
+				end = endHeight
+			}
+			var err error
+			if p, err = openPartition(dir, b.Height, end); err != nil {
+				return err
+			}
+		}
+		return p.addBlock(b)
+	})
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		return p.close()
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package parquetexport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/cache/cachetest"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// readTable reads all rows of the Parquet file into *rows, which is
+// a pointer to a slice of obj.
+func readTable(path string, obj, rows interface{}) error {
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return fmt.Errorf("local.NewLocalFileReader(%q): %v", path, err)
+	}
+	defer file.Close()
+	r, err := reader.NewParquetReader(file, obj, 1)
+	if err != nil {
+		return fmt.Errorf("reader.NewParquetReader(%q): %v", path, err)
+	}
+	defer r.ReadStop()
+	n := int(r.GetNumRows())
+	v := reflect.ValueOf(rows).Elem()
+	v.Set(reflect.MakeSlice(v.Type(), n, n))
+	if err := r.Read(rows); err != nil {
+		return fmt.Errorf("Read(%q): %v", path, err)
+	}
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	addresses, err := cachetest.ReadAddresses()
+	if err != nil {
+		t.Fatalf("cachetest.ReadAddresses: %v", err)
+	}
+	s := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	dir, err := ioutil.TempDir("", "TestExport")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Export(s, dir, 0); err == nil {
+		t.Errorf("Export accepted blocksPerPartition=0")
+	}
+	// 300 does not divide 1000, so the last partition is shorter.
+	if err := Export(s, dir, 300); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	var partitions []string
+	for _, f := range list {
+		partitions = append(partitions, f.Name())
+	}
+	wantPartitions := []string{"blocks=0-300", "blocks=300-600", "blocks=600-900", "blocks=900-1000"}
+	if !reflect.DeepEqual(partitions, wantPartitions) {
+		t.Fatalf("partitions: got %v, want %v", partitions, wantPartitions)
+	}
+
+	var transactions []Transaction
+	var outputs []Output
+	var activity []AddressActivity
+	for i, partition := range partitions {
+		var txs []Transaction
+		if err := readTable(filepath.Join(dir, partition, "transactions.parquet"), new(Transaction), &txs); err != nil {
+			t.Fatal(err)
+		}
+		for _, tx := range txs {
+			if tx.Height < int64(i*300) || tx.Height >= int64((i+1)*300) {
+				t.Errorf("partition %s has transaction of block %d", partition, tx.Height)
+			}
+		}
+		transactions = append(transactions, txs...)
+		var outs []Output
+		if err := readTable(filepath.Join(dir, partition, "outputs.parquet"), new(Output), &outs); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, outs...)
+		var acts []AddressActivity
+		if err := readTable(filepath.Join(dir, partition, "address_activity.parquet"), new(AddressActivity), &acts); err != nil {
+			t.Fatal(err)
+		}
+		activity = append(activity, acts...)
+	}
+
+	var wantTxs []Transaction
+	var wantPayouts []string
+	for height, block := range blocks {
+		blockID := block.ID()
+		for i := range block.MinerPayouts {
+			wantPayouts = append(wantPayouts, cache.MinerPayoutID(blockID, i).String())
+		}
+		for i, tx := range block.Transactions {
+			wantTxs = append(wantTxs, Transaction{
+				ID:             tx.ID().String(),
+				Height:         int64(height),
+				Timestamp:      int64(block.Timestamp),
+				Position:       int32(i),
+				SiacoinInputs:  int32(len(tx.SiacoinInputs)),
+				SiacoinOutputs: int32(len(tx.SiacoinOutputs)),
+			})
+		}
+	}
+	if len(transactions) != len(wantTxs) {
+		t.Fatalf("got %d transactions, want %d", len(transactions), len(wantTxs))
+	}
+	for i, tx := range transactions {
+		want := wantTxs[i]
+		if tx.ID != want.ID || tx.Height != want.Height || tx.Timestamp != want.Timestamp || tx.Position != want.Position || tx.SiacoinInputs != want.SiacoinInputs || tx.SiacoinOutputs != want.SiacoinOutputs || tx.Size <= 0 {
+			t.Errorf("transaction %d: got %+v, want %+v", i, tx, want)
+		}
+		if i > 0 && tx.ItemIndex <= transactions[i-1].ItemIndex {
+			t.Errorf("transaction %d: item index %d after %d", i, tx.ItemIndex, transactions[i-1].ItemIndex)
+		}
+	}
+	var payouts []string
+	for _, out := range outputs {
+		if out.Nature == cache.NATURE_MINER_PAYOUT {
+			payouts = append(payouts, out.ID)
+		}
+	}
+	if !reflect.DeepEqual(payouts, wantPayouts) {
+		t.Errorf("got %d miner payouts, want %d", len(payouts), len(wantPayouts))
+	}
+
+	// address_activity has the items of the history of each address.
+	activityOf := make(map[types.UnlockHash]int)
+	for _, a := range activity {
+		uh, err := cache.ParseAddress(a.UnlockHash)
+		if err != nil {
+			t.Fatalf("ParseAddress(%s): %v", a.UnlockHash, err)
+		}
+		activityOf[uh]++
+	}
+	for _, address := range addresses {
+		uh, err := cache.ParseAddress(address)
+		if err != nil {
+			t.Fatalf("ParseAddress(%s): %v", address, err)
+		}
+		page, err := s.GetHistoryPage(uh[:], "", 10*len(blocks))
+		if err != nil {
+			t.Fatalf("GetHistoryPage(%s): %v", address, err)
+		}
+		if page.Next != "" {
+			t.Fatalf("GetHistoryPage(%s) returned a partial history", address)
+		}
+		if activityOf[uh] != len(page.Items) || len(page.Items) == 0 {
+			t.Errorf("address %s has %d activity records, want %d", address, activityOf[uh], len(page.Items))
+		}
+	}
+}
+
+func TestExportCheckpoint(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	const start = 500
+	p := cachetest.Checkpoint(cachetest.Parameters(), blocks, start)
+	s := cachetest.BuildServer(t, p, blocks[start:])
+	dir, err := ioutil.TempDir("", "TestExportCheckpoint")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := Export(s, dir, 300); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ioutil.ReadDir: %v", err)
+	}
+	var partitions []string
+	for _, f := range list {
+		partitions = append(partitions, f.Name())
+	}
+	// Partitions start at multiples of 300, as in the full export.
+	wantPartitions := []string{"blocks=500-600", "blocks=600-900", "blocks=900-1000"}
+	if !reflect.DeepEqual(partitions, wantPartitions) {
+		t.Fatalf("partitions: got %v, want %v", partitions, wantPartitions)
+	}
+	ntxs := 0
+	for _, partition := range partitions {
+		var first, end int64
+		if _, err := fmt.Sscanf(partition, "blocks=%d-%d", &first, &end); err != nil {
+			t.Fatalf("fmt.Sscanf(%q): %v", partition, err)
+		}
+		var txs []Transaction
+		if err := readTable(filepath.Join(dir, partition, "transactions.parquet"), new(Transaction), &txs); err != nil {
+			t.Fatal(err)
+		}
+		for _, tx := range txs {
+			if tx.Height < first || tx.Height >= end {
+				t.Errorf("partition %s has transaction of block %d", partition, tx.Height)
+			} else if want := blocks[tx.Height].Transactions[tx.Position].ID().String(); tx.ID != want {
+				t.Errorf("transaction %d of block %d: got %s, want %s", tx.Position, tx.Height, tx.ID, want)
+			}
+		}
+		ntxs += len(txs)
+	}
+	wantTxs := 0
+	for _, block := range blocks[start:] {
+		wantTxs += len(block.Transactions)
+	}
+	if ntxs != wantTxs {
+		t.Errorf("got %d transactions, want %d", ntxs, wantTxs)
+	}
+}
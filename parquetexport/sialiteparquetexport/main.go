@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/parquetexport"
+)
+
+var (
+	input              = flag.String("input", "", "Input dir (output of sialitebuilder)")
+	output             = flag.String("output", "", "Output dir")
+	blocksPerPartition = flag.Int("blocks_per_partition", 10000, "Number of blocks per partition")
+)
+
+func main() {
+	flag.Parse()
+	s, err := cache.NewServer(*input)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	if err := parquetexport.Export(s, *output, *blocksPerPartition); err != nil {
+		log.Fatalf("parquetexport.Export: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		log.Fatalf("s.Close: %v", err)
+	}
+}
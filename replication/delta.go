@@ -0,0 +1,205 @@
+package replication
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/starius/sialite/cache"
+)
+
+// Delta files are immutable files with segments of consecutive blocks.
+// A directory of delta files has manifest.json listing them, which is
+// the only file changed by Publish. The directory can be served by
+// any static HTTP server or CDN and followed with NewDeltaSource.
+//
+// Delta files are only a transport format: cache.Server still mmaps
+// the monolithic files of the index, not a list of segments, so a
+// follower applies downloaded deltas to its local index with
+// cache.Builder (see Follower.Sync) instead of serving them directly.
+
+const manifestName = "manifest.json"
+
+type Delta struct {
+	Name       string
+	FirstBlock int
+	NumBlocks  int
+	Size       int64
+	SHA256     string
+}
+
+type Manifest struct {
+	Parameters json.RawMessage
+	Deltas     []Delta
+
+	// Commitment to the address index of the last published block,
+	// if the index has the address tree. See cache.VerifyAddress.
+	AddressTreeRoot string `json:",omitempty"`
+	AddressKeys     int    `json:",omitempty"`
+}
+
+// NumBlocks returns the number of blocks covered by the deltas.
+func (m *Manifest) NumBlocks() int {
+	if len(m.Deltas) == 0 {
+		return 0
+	}
+	last := m.Deltas[len(m.Deltas)-1]
+	return last.FirstBlock + last.NumBlocks
+}
+
+func readManifest(dir string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return &Manifest{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return m, nil
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// Publish writes delta files with blocks of s not yet present in dir
+// and updates the manifest. Each delta has at most blocksPerDelta blocks.
+func Publish(s *cache.Server, dir string, blocksPerDelta int) error {
+	if blocksPerDelta <= 0 {
+		return fmt.Errorf("blocksPerDelta must be positive, got %d", blocksPerDelta)
+	}
+	m, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	parametersJSON, err := s.ParametersJSON()
+	if err != nil {
+		return err
+	}
+	if m.Parameters == nil {
+		m.Parameters = parametersJSON
+	}
+	for start := m.NumBlocks(); start < s.NumBlocks(); start += blocksPerDelta {
+		end := start + blocksPerDelta
+		if end > s.NumBlocks() {
+			end = s.NumBlocks()
+		}
+		segments := make([]cache.Segment, 0, end-start)
+		for i := start; i < end; i++ {
+			seg, err := s.GetSegment(i)
+			if err != nil {
+				return fmt.Errorf("GetSegment(%d): %v", i, err)
+			}
+			segments = append(segments, seg)
+		}
+		data := encoding.Marshal(segments)
+		sum := sha256.Sum256(data)
+		d := Delta{
+			Name:       fmt.Sprintf("%08d-%08d.delta", start, end),
+			FirstBlock: start,
+			NumBlocks:  end - start,
+			Size:       int64(len(data)),
+			SHA256:     hex.EncodeToString(sum[:]),
+		}
+		if err := writeFileAtomic(path.Join(dir, d.Name), data); err != nil {
+			return err
+		}
+		m.Deltas = append(m.Deltas, d)
+	}
+	if root, err := s.AddressTreeRoot(); err == nil {
+		m.AddressTreeRoot = hex.EncodeToString(root[:])
+		m.AddressKeys = s.NumAddressKeys()
+	}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path.Join(dir, manifestName), data)
+}
+
+// deltaSource downloads segments from a directory written by Publish.
+type deltaSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewDeltaSource returns Source downloading delta files from url,
+// e.g. "https://cdn.example.com/sialite". client may be nil.
+func NewDeltaSource(url string, client *http.Client) Source {
+	return &deltaSource{url: url, client: client}
+}
+
+func (d *deltaSource) manifest(ctx context.Context) (*Manifest, error) {
+	data, err := get(ctx, d.client, d.url+"/"+manifestName)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return m, nil
+}
+
+func (d *deltaSource) Parameters(ctx context.Context) ([]byte, error) {
+	m, err := d.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.Parameters, nil
+}
+
+func (d *deltaSource) Segments(ctx context.Context, start int) ([]cache.Segment, error) {
+	m, err := d.manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, delta := range m.Deltas {
+		if start < delta.FirstBlock || start >= delta.FirstBlock+delta.NumBlocks {
+			continue
+		}
+		data, err := get(ctx, d.client, d.url+"/"+delta.Name)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != delta.SHA256 {
+			return nil, fmt.Errorf("%s: checksum mismatch", delta.Name)
+		}
+		var segments []cache.Segment
+		if err := encoding.Unmarshal(data, &segments); err != nil {
+			return nil, fmt.Errorf("decoding %s: %v", delta.Name, err)
+		}
+		if len(segments) != delta.NumBlocks {
+			return nil, fmt.Errorf("%s: want %d segments, got %d", delta.Name, delta.NumBlocks, len(segments))
+		}
+		return segments[start-delta.FirstBlock:], nil
+	}
+	return nil, nil
+}
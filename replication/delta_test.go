@@ -0,0 +1,178 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/starius/sialite/cache/cachetest"
+)
+
+func TestPublish(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "TestPublish")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s600 := cachetest.BuildServer(t, cachetest.Parameters(), blocks[:600])
+	defer s600.Close()
+	if err := Publish(s600, dir, 0); err == nil {
+		t.Errorf("Publish accepted blocksPerDelta=0")
+	}
+	if err := Publish(s600, dir, 250); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	first, err := ioutil.ReadFile(filepath.Join(dir, "00000000-00000250.delta"))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	s := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	defer s.Close()
+	if err := Publish(s, dir, 250); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+	wantNames := []string{
+		"00000000-00000250.delta",
+		"00000250-00000500.delta",
+		"00000500-00000600.delta",
+		"00000600-00000850.delta",
+		"00000850-00001000.delta",
+	}
+	if len(m.Deltas) != len(wantNames) {
+		t.Fatalf("got %d deltas, want %d", len(m.Deltas), len(wantNames))
+	}
+	for i, d := range m.Deltas {
+		if d.Name != wantNames[i] {
+			t.Errorf("delta %d: name %s, want %s", i, d.Name, wantNames[i])
+		}
+	}
+	if m.NumBlocks() != s.NumBlocks() {
+		t.Errorf("manifest NumBlocks() = %d, want %d", m.NumBlocks(), s.NumBlocks())
+	}
+	// Published deltas are immutable.
+	first2, err := ioutil.ReadFile(filepath.Join(dir, wantNames[0]))
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile: %v", err)
+	}
+	if !bytes.Equal(first, first2) {
+		t.Errorf("delta %s changed by the second Publish", wantNames[0])
+	}
+
+	hs := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer hs.Close()
+	ctx := context.Background()
+	source := NewDeltaSource(hs.URL, nil)
+	parametersJSON, err := source.Parameters(ctx)
+	if err != nil {
+		t.Fatalf("Parameters: %v", err)
+	}
+	wantParameters, err := s.ParametersJSON()
+	if err != nil {
+		t.Fatalf("ParametersJSON: %v", err)
+	}
+	// The manifest is indented, so compare compacted JSON.
+	var got, want bytes.Buffer
+	if err := json.Compact(&got, parametersJSON); err != nil {
+		t.Fatalf("json.Compact: %v", err)
+	}
+	if err := json.Compact(&want, wantParameters); err != nil {
+		t.Fatalf("json.Compact: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("Parameters() = %s, want %s", parametersJSON, wantParameters)
+	}
+	segments, err := source.Segments(ctx, 300)
+	if err != nil {
+		t.Fatalf("Segments: %v", err)
+	}
+	if len(segments) != 200 {
+		t.Fatalf("Segments(300) returned %d segments, want 200", len(segments))
+	}
+	for i := range segments {
+		want, err := s.GetSegment(300 + i)
+		if err != nil {
+			t.Fatalf("GetSegment(%d): %v", 300+i, err)
+		}
+		if !bytes.Equal(encoding.Marshal(segments[i]), encoding.Marshal(want)) {
+			t.Errorf("segment %d differs", 300+i)
+		}
+	}
+	if segments, err := source.Segments(ctx, s.NumBlocks()); err != nil || len(segments) != 0 {
+		t.Errorf("Segments after the last block = %d segments, %v, want none", len(segments), err)
+	}
+
+	followerDir, err := ioutil.TempDir("", "TestPublishFollower")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(followerDir)
+	f := &Follower{Source: source, Dir: followerDir, MemLimit: 1024 * 1024}
+	s2, err := f.Sync(ctx, nil)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	defer s2.Close()
+	if s2.NumBlocks() != s.NumBlocks() {
+		t.Errorf("follower has %d blocks, want %d", s2.NumBlocks(), s.NumBlocks())
+	}
+	last, err := s2.GetSegment(s.NumBlocks() - 1)
+	if err != nil {
+		t.Fatalf("GetSegment: %v", err)
+	}
+	wantLast, err := s.GetSegment(s.NumBlocks() - 1)
+	if err != nil {
+		t.Fatalf("GetSegment: %v", err)
+	}
+	if !bytes.Equal(encoding.Marshal(last), encoding.Marshal(wantLast)) {
+		t.Errorf("the last segment of the follower differs")
+	}
+
+	// Corrupted deltas are rejected.
+	if err := ioutil.WriteFile(filepath.Join(dir, wantNames[1]), []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile: %v", err)
+	}
+	if _, err := source.Segments(ctx, 300); err == nil {
+		t.Errorf("Segments accepted a corrupted delta")
+	}
+}
+
+func TestManifestNumBlocks(t *testing.T) {
+	m := &Manifest{}
+	if m.NumBlocks() != 0 {
+		t.Errorf("NumBlocks() of empty manifest = %d, want 0", m.NumBlocks())
+	}
+	m.Deltas = []Delta{{FirstBlock: 0, NumBlocks: 10}, {FirstBlock: 10, NumBlocks: 5}}
+	if m.NumBlocks() != 15 {
+		t.Errorf("NumBlocks() = %d, want 15", m.NumBlocks())
+	}
+}
+
+func TestReadManifestMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReadManifestMissing")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+	if len(m.Deltas) != 0 || m.Parameters != nil {
+		t.Errorf("readManifest of empty dir = %v, want empty manifest", m)
+	}
+}
@@ -0,0 +1,125 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/starius/sialite/cache"
+)
+
+// FilteredSource downloads blocks filtered by address prefixes from
+// /v1/replication/filtered of a full sialite server, so a watch-only
+// node gets headers of all blocks, but only its own items.
+type FilteredSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewFilteredSource returns FilteredSource downloading blocks from the
+// server, e.g. "http://full:35813". client may be nil.
+func NewFilteredSource(url string, client *http.Client) *FilteredSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &FilteredSource{url: url, client: client}
+}
+
+func (f *FilteredSource) post(ctx context.Context, body []byte) ([]byte, error) {
+	url := f.url + "/v1/replication/filtered"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("POST %s: too large response", url)
+	}
+	return data, nil
+}
+
+// Blocks returns filtered blocks starting with block start. It returns
+// an empty list if there are no blocks after start. Items are checked
+// against the headers of their blocks; the headers are not verified
+// (see Sync). The server can omit items, which is not detected.
+func (f *FilteredSource) Blocks(ctx context.Context, start int, prefixes [][]byte) ([]cache.FilteredBlock, error) {
+	hexPrefixes := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		hexPrefixes[i] = hex.EncodeToString(prefix)
+	}
+	body, err := json.Marshal(struct {
+		Start    int      `json:"start"`
+		Prefixes []string `json:"prefixes"`
+	}{start, hexPrefixes})
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []cache.FilteredBlock
+	if err := encoding.Unmarshal(data, &blocks); err != nil {
+		return nil, fmt.Errorf("decoding filtered blocks: %v", err)
+	}
+	for i, fb := range blocks {
+		header, err := cache.DecodeHeader(fb.Header)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %v", start+i, err)
+		}
+		for _, item := range fb.Items {
+			if item.Block != start+i {
+				return nil, fmt.Errorf("block %d: item %s of block %d", start+i, item.ID, item.Block)
+			}
+			if err := cache.VerifyItem(item, header.MerkleRoot); err != nil {
+				return nil, fmt.Errorf("block %d: item %s: %v", start+i, item.ID, err)
+			}
+		}
+	}
+	return blocks, nil
+}
+
+// Sync downloads blocks after the last header of the verifier, appends
+// their headers to it and passes the blocks to handle in order, until
+// the server has no more blocks. The index of the server must start
+// with the genesis block, as the verifier does.
+func (f *FilteredSource) Sync(ctx context.Context, v *cache.HeaderVerifier, prefixes [][]byte, handle func(fb cache.FilteredBlock) error) error {
+	if err := cache.CheckFilterPrefixes(prefixes); err != nil {
+		return err
+	}
+	for {
+		blocks, err := f.Blocks(ctx, v.Height(), prefixes)
+		if err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		for _, fb := range blocks {
+			if err := v.Append(fb.Header); err != nil {
+				return fmt.Errorf("header %d: %v", v.Height(), err)
+			}
+			if err := handle(fb); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package replication keeps a copy of the index of another sialite
+// server in sync. The follower downloads segments of new blocks from
+// a Source and applies them with cache.Builder, so followers do not
+// connect to Sia peers.
+package replication
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/starius/sialite/cache"
+)
+
+// maxResponseSize limits the size of downloaded files.
+const maxResponseSize = 1 << 30
+
+// Source provides segments of blocks.
+type Source interface {
+	// Parameters returns contents of parameters.json of the index.
+	Parameters(ctx context.Context) ([]byte, error)
+
+	// Segments returns segments of blocks starting with block start.
+	// It returns an empty list if there are no blocks after start.
+	Segments(ctx context.Context, start int) ([]cache.Segment, error)
+}
+
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("GET %s: too large response", url)
+	}
+	return data, nil
+}
+
+// leaderSource downloads segments from /v1/replication/* of a leader.
+type leaderSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewLeaderSource returns Source downloading segments from
+// the leader, e.g. "http://leader:35813". client may be nil.
+func NewLeaderSource(url string, client *http.Client) Source {
+	return &leaderSource{url: url, client: client}
+}
+
+func (l *leaderSource) Parameters(ctx context.Context) ([]byte, error) {
+	return get(ctx, l.client, l.url+"/v1/replication/parameters")
+}
+
+func (l *leaderSource) Segments(ctx context.Context, start int) ([]cache.Segment, error) {
+	data, err := get(ctx, l.client, fmt.Sprintf("%s/v1/replication/segments?start=%d", l.url, start))
+	if err != nil {
+		return nil, err
+	}
+	var segments []cache.Segment
+	if err := encoding.Unmarshal(data, &segments); err != nil {
+		return nil, fmt.Errorf("decoding segments: %v", err)
+	}
+	return segments, nil
+}
+
+type Follower struct {
+	Source Source
+
+	// Dir is the directory of the local copy of the index.
+	Dir string
+
+	// MemLimit is passed to cache.OpenBuilder.
+	MemLimit int
+}
+
+// Sync downloads new blocks from the source and adds them to the
+// local index. s is the current local index (nil if Dir is empty).
+// It returns the new index or nil if there are no new blocks.
+//
+// The files of the index are not incremental: cache.OpenBuilder reads
+// all blocks of the index to restore the address index, so each Sync
+// finding new blocks costs as much as reading the whole index, however
+// few blocks were added (see BenchmarkSync). All blocks available from
+// the source are added in one Sync, so the cost is paid once per poll
+// rather than once per block, and the interval of Follow should be
+// well above the time of rebuilding the index.
+func (f *Follower) Sync(ctx context.Context, s *cache.Server) (*cache.Server, error) {
+	nblocks := 0
+	if s != nil {
+		nblocks = s.NumBlocks()
+	}
+	segments, err := f.Source.Segments(ctx, nblocks)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, nil
+	}
+	var b *cache.Builder
+	if _, err := os.Stat(path.Join(f.Dir, "parameters.json")); os.IsNotExist(err) {
+		parametersJSON, err := f.Source.Parameters(ctx)
+		if err != nil {
+			return nil, err
+		}
+		b, err = cache.NewBuilderWithParameters(f.Dir, f.MemLimit, parametersJSON)
+		if err != nil {
+			return nil, fmt.Errorf("cache.NewBuilderWithParameters: %v", err)
+		}
+	} else {
+		b, err = cache.OpenBuilder(f.Dir, f.MemLimit)
+		if err != nil {
+			return nil, fmt.Errorf("cache.OpenBuilder: %v", err)
+		}
+	}
+	// In case of errors, the blocks added so far are kept.
+next:
+	for len(segments) != 0 {
+		for i := range segments {
+			if err := b.AddSegment(&segments[i]); err != nil {
+				log.Printf("AddSegment: %v.", err)
+				break next
+			}
+		}
+		segments, err = f.Source.Segments(ctx, b.NumBlocks())
+		if err != nil {
+			log.Printf("Downloading segments: %v.", err)
+			break next
+		}
+	}
+	if err := b.Close(); err != nil {
+		return nil, fmt.Errorf("Builder.Close: %v", err)
+	}
+	return cache.NewServer(f.Dir)
+}
+
+// Follow calls Sync every interval until ctx is canceled and sends
+// new versions of the index to updates. See Sync about the cost of
+// each poll finding new blocks.
+func (f *Follower) Follow(ctx context.Context, s *cache.Server, interval time.Duration, updates chan<- *cache.Server) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		s1, err := f.Sync(ctx, s)
+		if err != nil {
+			log.Printf("Sync: %v.", err)
+			continue
+		}
+		if s1 == nil {
+			continue
+		}
+		log.Printf("Synced up to %d blocks.", s1.NumBlocks())
+		s = s1
+		select {
+		case updates <- s:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package replication
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/cache/cachetest"
+)
+
+// serverSource is Source serving the first limit blocks of a server.
+type serverSource struct {
+	s     *cache.Server
+	limit int
+}
+
+func (ss *serverSource) Parameters(ctx context.Context) ([]byte, error) {
+	return ss.s.ParametersJSON()
+}
+
+func (ss *serverSource) Segments(ctx context.Context, start int) ([]cache.Segment, error) {
+	var segments []cache.Segment
+	for i := start; i < ss.limit && i < start+100; i++ {
+		seg, err := ss.s.GetSegment(i)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+func TestSync(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	leader := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	dir, err := ioutil.TempDir("", "TestSync")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	source := &serverSource{s: leader, limit: 600}
+	f := &Follower{Source: source, Dir: dir, MemLimit: 1024 * 1024}
+	s, err := f.Sync(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if s.NumBlocks() != 600 {
+		t.Fatalf("NumBlocks() = %d, want 600", s.NumBlocks())
+	}
+	if s1, err := f.Sync(context.Background(), s); err != nil || s1 != nil {
+		t.Fatalf("Sync without new blocks = %v, %v, want nil, nil", s1, err)
+	}
+	source.limit = leader.NumBlocks()
+	s2, err := f.Sync(context.Background(), s)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	s.Close()
+	defer s2.Close()
+	if s2.NumBlocks() != leader.NumBlocks() {
+		t.Fatalf("NumBlocks() = %d, want %d", s2.NumBlocks(), leader.NumBlocks())
+	}
+	for i := 0; i < leader.NumBlocks(); i++ {
+		want, err := leader.GetSegment(i)
+		if err != nil {
+			t.Fatalf("leader.GetSegment(%d): %v", i, err)
+		}
+		got, err := s2.GetSegment(i)
+		if err != nil {
+			t.Fatalf("GetSegment(%d): %v", i, err)
+		}
+		if string(encoding.Marshal(got)) != string(encoding.Marshal(want)) {
+			t.Errorf("segment %d differs from the leader", i)
+		}
+	}
+}
+
+// BenchmarkSync measures Sync adding one block to an index of 999
+// blocks, which costs as much as reading the whole index.
+func BenchmarkSync(b *testing.B) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		b.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	leader := cachetest.BuildServer(b, cachetest.Parameters(), blocks)
+	dir, err := ioutil.TempDir("", "BenchmarkSync")
+	if err != nil {
+		b.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		os.RemoveAll(dir)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			b.Fatalf("os.Mkdir: %v", err)
+		}
+		source := &serverSource{s: leader, limit: leader.NumBlocks() - 1}
+		f := &Follower{Source: source, Dir: dir, MemLimit: 1024 * 1024}
+		s, err := f.Sync(ctx, nil)
+		if err != nil {
+			b.Fatalf("Sync: %v", err)
+		}
+		source.limit = leader.NumBlocks()
+		b.StartTimer()
+		s1, err := f.Sync(ctx, s)
+		if err != nil {
+			b.Fatalf("Sync: %v", err)
+		}
+		b.StopTimer()
+		s.Close()
+		s1.Close()
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/replication"
+)
+
+var (
+	files          = flag.String("files", "", "Dir with output of builder")
+	out            = flag.String("out", "", "Dir with delta files to update")
+	blocksPerDelta = flag.Int("blocks_per_delta", 1000, "Max number of blocks in one delta file")
+)
+
+func main() {
+	flag.Parse()
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		log.Fatalf("os.MkdirAll: %v", err)
+	}
+	s, err := cache.NewServer(*files)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	defer s.Close()
+	if err := replication.Publish(s, *out, *blocksPerDelta); err != nil {
+		log.Fatalf("replication.Publish: %v", err)
+	}
+}
@@ -0,0 +1,440 @@
+// Package sialiteclient is a client of the HTTP API of sialite server
+// which does not trust the server: headers are verified and stored in a
+// local file (see wallet.HeaderStore) and every returned item is checked
+// against the Merkle root of its block before it is returned.
+//
+// The server can still hide items, since proofs of completeness are not
+// checked, but it can not invent payments.
+package sialiteclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/wallet"
+)
+
+var (
+	ErrUnrelatedItem = fmt.Errorf("The item does not mention the address")
+	ErrBadOutput     = fmt.Errorf("The item does not match the output")
+)
+
+// Error is an error response of the server (see api.ErrorResponse).
+// Requests failing with Retryable errors may succeed if repeated after
+// RetryAfter (0 if the server does not set Retry-After).
+type Error struct {
+	Method     string            `json:"-"`
+	Query      string            `json:"-"`
+	Status     int               `json:"-"`
+	Code       string            `json:"code"`
+	Message    string            `json:"message"`
+	Retryable  bool              `json:"retryable"`
+	RetryAfter time.Duration     `json:"-"`
+	Details    map[string]string `json:"details"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%s %s: %d %s", e.Method, e.Query, e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Query, e.Status, e.Code, e.Message)
+}
+
+// IsRetryable returns if err is an Error with Retryable set.
+func IsRetryable(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Retryable
+}
+
+// newError returns Error from the response. Bodies which are not JSON
+// (servers before error responses had JSON bodies) become the message.
+func newError(method, query string, status int, header http.Header, data []byte) *Error {
+	e := &Error{
+		Method: method,
+		Query:  query,
+		Status: status,
+	}
+	if err := json.Unmarshal(data, e); err != nil || e.Code == "" {
+		e.Message = string(bytes.TrimSpace(data))
+		e.Retryable = status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+	}
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return e
+}
+
+// proofPollInterval is the delay between polls of /v1/proof/:token
+// if the server does not set Retry-After.
+const proofPollInterval = time.Second
+
+type Options struct {
+	// Client makes HTTP requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Key, if set, is sent in X-Sialite-Key.
+	Key string
+
+	// Clock is passed to wallet.OpenHeaderStore.
+	Clock cache.Clock
+}
+
+// Client talks to one sialite server.
+type Client struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	headers *wallet.HeaderStore
+}
+
+// Entry is a verified item of the history.
+type Entry struct {
+	Item   cache.Item
+	ID     cache.ItemID
+	Header cache.BlockHeader
+
+	// Either Payout or Transaction is set.
+	Payout      *types.SiacoinOutput
+	Transaction *types.Transaction
+}
+
+// keyTransport adds the API key to requests.
+type keyTransport struct {
+	base http.RoundTripper
+	key  string
+}
+
+func (t keyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Header = make(http.Header, len(r.Header)+1)
+	for k, v := range r.Header {
+		r2.Header[k] = v
+	}
+	r2.Header.Set("X-Sialite-Key", t.key)
+	return t.base.RoundTrip(r2)
+}
+
+// New opens the file of headers and returns the client of the server,
+// e.g. "http://localhost:35813". Headers are downloaded on demand.
+func New(serverURL, headersFile string, opts Options) (*Client, error) {
+	headers, err := wallet.OpenHeaderStore(headersFile, opts.Clock)
+	if err != nil {
+		return nil, fmt.Errorf("wallet.OpenHeaderStore: %v", err)
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if opts.Key != "" {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		withKey := *client
+		withKey.Transport = keyTransport{base: base, key: opts.Key}
+		client = &withKey
+	}
+	return &Client{
+		url:     serverURL,
+		client:  client,
+		headers: headers,
+	}, nil
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.headers.Close()
+}
+
+// SyncHeaders downloads new headers. It returns the number of appended
+// headers.
+func (c *Client) SyncHeaders() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return wallet.SyncHeaders(c.client, c.url, c.headers)
+}
+
+// Height returns the number of verified headers.
+func (c *Client) Height() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.headers.Height()
+}
+
+// Header returns the verified header of the block, syncing headers if
+// the block is not known yet.
+func (c *Client) Header(height int) (cache.BlockHeader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height >= c.headers.Height() {
+		if _, err := wallet.SyncHeaders(c.client, c.url, c.headers); err != nil {
+			return cache.BlockHeader{}, fmt.Errorf("wallet.SyncHeaders: %v", err)
+		}
+	}
+	return c.headers.Header(height)
+}
+
+func (c *Client) do(ctx context.Context, method, query string) (int, http.Header, []byte, error) {
+	req, err := http.NewRequest(method, c.url+query, nil)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, data, nil
+}
+
+// VerifyItem checks the item against the header of its block. Proofs
+// of items of huge blocks omitted by the server are requested from
+// /v1/proof and added to the item.
+func (c *Client) VerifyItem(ctx context.Context, item *cache.Item) (Entry, error) {
+	id, err := cache.ParseItemID(item.ID)
+	if err != nil {
+		return Entry{}, err
+	}
+	header, err := c.Header(id.Height)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(item.MerkleProof) == 0 && item.NumLeaves > 1 {
+		if item.MerkleProof, err = c.proof(ctx, item.ID); err != nil {
+			return Entry{}, err
+		}
+	}
+	if err := cache.VerifyItem(*item, header.MerkleRoot); err != nil {
+		return Entry{}, fmt.Errorf("item %s: %v", item.ID, err)
+	}
+	payout, tx, err := cache.DecodeItem(*item)
+	if err != nil {
+		return Entry{}, fmt.Errorf("cache.DecodeItem(%s): %v", item.ID, err)
+	}
+	return Entry{
+		Item:        *item,
+		ID:          id,
+		Header:      header,
+		Payout:      payout,
+		Transaction: tx,
+	}, nil
+}
+
+// proof builds the proof of the item using /v1/proof.
+func (c *Client) proof(ctx context.Context, itemID string) ([]byte, error) {
+	query := "/v1/proof?id=" + url.QueryEscape(itemID)
+	method := "POST"
+	for {
+		status, header, data, err := c.do(ctx, method, query)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK && status != http.StatusAccepted {
+			return nil, newError(method, query, status, header, data)
+		}
+		var resp struct {
+			Token string `json:"token"`
+			Done  bool   `json:"done"`
+			Proof []byte `json:"proof"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("decoding %s: %v", query, err)
+		}
+		if resp.Done {
+			if resp.Error != "" {
+				return nil, fmt.Errorf("proof of %s: %s", itemID, resp.Error)
+			}
+			return resp.Proof, nil
+		}
+		delay := proofPollInterval
+		if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		method, query = "GET", "/v1/proof/"+resp.Token
+	}
+}
+
+// History returns a verified page of the history of the address and
+// the cursor of the next page ("" on the last page).
+func (c *Client) History(ctx context.Context, address types.UnlockHash, cursor string) ([]Entry, string, error) {
+	query := "/v1/history?address=" + cache.FormatAddress(address)
+	if cursor != "" {
+		query += "&cursor=" + url.QueryEscape(cursor)
+	}
+	status, header, data, err := c.do(ctx, "GET", query)
+	if err != nil {
+		return nil, "", err
+	}
+	if status == http.StatusNotFound {
+		return nil, "", nil
+	} else if status != http.StatusOK {
+		return nil, "", newError("GET", "/v1/history", status, header, data)
+	}
+	var next string
+	var items []cache.Item
+	if err := encoding.NewDecoder(bytes.NewReader(data)).DecodeAll(&next, &items); err != nil {
+		return nil, "", fmt.Errorf("decoding /v1/history: %v", err)
+	}
+	entries := make([]Entry, 0, len(items))
+	for i := range items {
+		entry, err := c.VerifyItem(ctx, &items[i])
+		if err != nil {
+			return nil, "", err
+		}
+		if !mentions(entry, address) {
+			return nil, "", fmt.Errorf("item %s: %v", entry.Item.ID, ErrUnrelatedItem)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next, nil
+}
+
+// mentions returns if the address receives or spends in the entry.
+func mentions(entry Entry, address types.UnlockHash) bool {
+	if entry.Payout != nil {
+		return entry.Payout.UnlockHash == address
+	}
+	for _, output := range cache.TransactionOutputs(entry.Transaction) {
+		if output.UnlockHash == address {
+			return true
+		}
+	}
+	for _, input := range cache.TransactionInputs(entry.Transaction) {
+		if input.UnlockHash == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Audit returns unspent outputs of the addresses at the height (see
+// /v1/audit), assuming the server indexes the chain from genesis.
+// Items creating and spending the outputs are verified and the totals
+// are recomputed from the verified outputs.
+func (c *Client) Audit(ctx context.Context, addresses []types.UnlockHash, height int) (*cache.Audit, error) {
+	query := "/v1/audit?height=" + strconv.Itoa(height)
+	for _, address := range addresses {
+		query += "&address=" + cache.FormatAddress(address)
+	}
+	status, header, data, err := c.do(ctx, "GET", query)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, newError("GET", "/v1/audit", status, header, data)
+	}
+	var audit cache.Audit
+	if err := encoding.Unmarshal(data, &audit); err != nil {
+		return nil, fmt.Errorf("decoding /v1/audit: %v", err)
+	}
+	audit.Siacoins = types.ZeroCurrency
+	audit.Siafunds = types.ZeroCurrency
+	for i := range audit.Outputs {
+		out := &audit.Outputs[i]
+		if err := c.verifyOutput(ctx, out, height); err != nil {
+			return nil, err
+		}
+		if out.Nature == cache.NATURE_SIAFUND_OUTPUT {
+			audit.Siafunds = audit.Siafunds.Add(out.Value)
+		} else {
+			audit.Siacoins = audit.Siacoins.Add(out.Value)
+		}
+	}
+	return &audit, nil
+}
+
+// verifyOutput checks that the output was created up to the height by
+// the created item and the spent item, if any, spends it later.
+func (c *Client) verifyOutput(ctx context.Context, out *cache.AuditOutput, height int) error {
+	created, err := c.VerifyItem(ctx, &out.Created)
+	if err != nil {
+		return err
+	}
+	if created.ID.Height > height {
+		return fmt.Errorf("output %s: created at %d: %v", out.ID, created.ID.Height, ErrBadOutput)
+	}
+	if created.Payout != nil {
+		// The ID of a miner payout depends on the block ID, which
+		// is not stored with headers.
+		if out.Nature != cache.NATURE_MINER_PAYOUT || created.Payout.UnlockHash != out.Address || created.Payout.Value.Cmp(out.Value) != 0 {
+			return fmt.Errorf("output %s: %v", out.ID, ErrBadOutput)
+		}
+	} else {
+		found := false
+		for _, output := range cache.TransactionOutputs(created.Transaction) {
+			if output.ID == out.ID && output.UnlockHash == out.Address && output.Value.Cmp(out.Value) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("output %s: %v", out.ID, ErrBadOutput)
+		}
+	}
+	if out.Spent == nil {
+		return nil
+	}
+	spent, err := c.VerifyItem(ctx, out.Spent)
+	if err != nil {
+		return err
+	}
+	if spent.ID.Height <= height {
+		return fmt.Errorf("output %s: spent at %d: %v", out.ID, spent.ID.Height, ErrBadOutput)
+	}
+	if spent.Transaction != nil {
+		for _, input := range cache.TransactionInputs(spent.Transaction) {
+			if input.ParentID == out.ID {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("output %s: spending %v", out.ID, ErrBadOutput)
+}
+
+// Used returns if the address has verified history. Client implements
+// wallet.Checker.
+func (c *Client) Used(address types.UnlockHash) (bool, error) {
+	entries, _, err := c.History(context.Background(), address, "")
+	if err != nil {
+		return false, err
+	}
+	return len(entries) != 0, nil
+}
+
+// Balance returns the verified balance of the address at the last
+// synced header, assuming the server indexes the chain from genesis.
+// Client implements wallet.Watcher.
+func (c *Client) Balance(address types.UnlockHash) (siacoins, siafunds types.Currency, err error) {
+	if _, err := c.SyncHeaders(); err != nil {
+		return siacoins, siafunds, fmt.Errorf("SyncHeaders: %v", err)
+	}
+	audit, err := c.Audit(context.Background(), []types.UnlockHash{address}, c.Height()-1)
+	if err != nil {
+		return siacoins, siafunds, err
+	}
+	return audit.Siacoins, audit.Siafunds, nil
+}
@@ -0,0 +1,232 @@
+// Package sialitemobile wraps sialiteclient for Android and iOS wallets:
+//
+//	gomobile bind -target=android ./sialiteclient/sialitemobile
+//
+// Exported signatures use only types supported by gomobile: strings,
+// bools, int, int64, []byte, errors and pointers to structs of this
+// package. Lists are returned as structs with Len and Get, amounts as
+// decimal strings of hastings and addresses as 76 hex characters.
+package sialitemobile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/entropy-mnemonics"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/sialiteclient"
+	"github.com/starius/sialite/wallet"
+)
+
+// Client verifies responses of one sialite server against headers
+// stored in a file of the app.
+type Client struct {
+	c       *sialiteclient.Client
+	timeout time.Duration
+}
+
+// NewClient opens the file of headers. key is the API key or "".
+func NewClient(url, headersFile, key string) (*Client, error) {
+	c, err := sialiteclient.New(url, headersFile, sialiteclient.Options{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return &Client{c: c}, nil
+}
+
+// SetTimeout limits each call to the server to given number of
+// milliseconds (0 = no limit).
+func (c *Client) SetTimeout(milliseconds int64) {
+	c.timeout = time.Duration(milliseconds) * time.Millisecond
+}
+
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	if c.timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+func (c *Client) Close() error {
+	return c.c.Close()
+}
+
+// SyncHeaders downloads new headers and returns their number.
+func (c *Client) SyncHeaders() (int, error) {
+	return c.c.SyncHeaders()
+}
+
+// Height returns the number of verified headers.
+func (c *Client) Height() int {
+	return c.c.Height()
+}
+
+// Balance is the verified balance of an address.
+type Balance struct {
+	Siacoins string
+	Siafunds string
+}
+
+// Balance returns the balance of the address at the last header.
+func (c *Client) Balance(address string) (*Balance, error) {
+	uh, err := cache.ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.c.SyncHeaders(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	audit, err := c.c.Audit(ctx, []types.UnlockHash{uh}, c.c.Height()-1)
+	if err != nil {
+		return nil, err
+	}
+	return &Balance{
+		Siacoins: cache.FormatHastings(audit.Siacoins),
+		Siafunds: cache.FormatHastings(audit.Siafunds),
+	}, nil
+}
+
+// HistoryEntry is a verified item of the history of an address.
+type HistoryEntry struct {
+	ID        string
+	Height    int
+	Timestamp int64
+
+	// MinerPayout is true for miner payouts, false for transactions.
+	MinerPayout bool
+
+	// Received is the sum of siacoin outputs to the address.
+	Received string
+
+	// Spends is true if the address spends outputs in the item.
+	Spends bool
+
+	// JSON describes all outputs and inputs of the item.
+	JSON string
+}
+
+// HistoryPage is a page of the history. Next is the cursor of the next
+// page or "" on the last page.
+type HistoryPage struct {
+	Next    string
+	entries []*HistoryEntry
+}
+
+func (p *HistoryPage) Len() int {
+	return len(p.entries)
+}
+
+// Get returns i-th entry or nil if i is out of range.
+func (p *HistoryPage) Get(i int) *HistoryEntry {
+	if i < 0 || i >= len(p.entries) {
+		return nil
+	}
+	return p.entries[i]
+}
+
+type outputJSON struct {
+	ID      string `json:"id,omitempty"`
+	Nature  string `json:"nature"`
+	Address string `json:"address"`
+	Value   string `json:"value"`
+}
+
+type inputJSON struct {
+	ParentID string `json:"parent_id"`
+	Siafund  bool   `json:"siafund,omitempty"`
+	Address  string `json:"address"`
+}
+
+// History returns the page of the history starting from the cursor
+// ("" for the first page).
+func (c *Client) History(address, cursor string) (*HistoryPage, error) {
+	uh, err := cache.ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	entries, next, err := c.c.History(ctx, uh, cursor)
+	if err != nil {
+		return nil, err
+	}
+	page := &HistoryPage{Next: next}
+	for _, entry := range entries {
+		e, err := newHistoryEntry(entry, uh)
+		if err != nil {
+			return nil, err
+		}
+		page.entries = append(page.entries, e)
+	}
+	return page, nil
+}
+
+func newHistoryEntry(entry sialiteclient.Entry, address types.UnlockHash) (*HistoryEntry, error) {
+	e := &HistoryEntry{
+		ID:        entry.Item.ID,
+		Height:    entry.ID.Height,
+		Timestamp: int64(entry.Header.Timestamp),
+	}
+	received := types.ZeroCurrency
+	var desc struct {
+		Outputs []outputJSON `json:"outputs"`
+		Inputs  []inputJSON  `json:"inputs,omitempty"`
+	}
+	if entry.Payout != nil {
+		e.MinerPayout = true
+		received = entry.Payout.Value
+		desc.Outputs = append(desc.Outputs, outputJSON{
+			Nature:  cache.NATURE_MINER_PAYOUT,
+			Address: cache.FormatAddress(entry.Payout.UnlockHash),
+			Value:   cache.FormatHastings(entry.Payout.Value),
+		})
+	} else {
+		for _, output := range cache.TransactionOutputs(entry.Transaction) {
+			if output.UnlockHash == address && output.Nature != cache.NATURE_SIAFUND_OUTPUT {
+				received = received.Add(output.Value)
+			}
+			desc.Outputs = append(desc.Outputs, outputJSON{
+				ID:      output.ID.String(),
+				Nature:  output.Nature,
+				Address: cache.FormatAddress(output.UnlockHash),
+				Value:   cache.FormatHastings(output.Value),
+			})
+		}
+		for _, input := range cache.TransactionInputs(entry.Transaction) {
+			if input.UnlockHash == address {
+				e.Spends = true
+			}
+			desc.Inputs = append(desc.Inputs, inputJSON{
+				ParentID: input.ParentID.String(),
+				Siafund:  input.Siafund,
+				Address:  cache.FormatAddress(input.UnlockHash),
+			})
+		}
+	}
+	e.Received = cache.FormatHastings(received)
+	data, err := json.Marshal(desc)
+	if err != nil {
+		return nil, err
+	}
+	e.JSON = string(data)
+	return e, nil
+}
+
+// DeriveAddress returns the address of the seed (phrase of siad) with
+// given index, the same as siad.
+func DeriveAddress(phrase string, index int64) (string, error) {
+	if index < 0 {
+		return "", fmt.Errorf("negative index %d", index)
+	}
+	seed, err := modules.StringToSeed(phrase, mnemonics.English)
+	if err != nil {
+		return "", fmt.Errorf("modules.StringToSeed: %v", err)
+	}
+	return cache.FormatAddress(wallet.DeriveKey(seed, uint64(index)).Address), nil
+}
@@ -0,0 +1,196 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command sialitewasm exports the verification code of sialite to
+// browsers as the global object sialite:
+//
+//	GOOS=js GOARCH=wasm go build -o sialite.wasm ./sialiteclient/sialitewasm
+//
+// Functions take Uint8Array and return JSON strings. A failure is
+// returned as {"error": "..."}.
+//
+//	sialite.verifyHeaders(state, headers) -> {"state": "...", "height": n}
+//	  Verifies headers from /v1/headers following the state returned
+//	  by the previous call ("" for the genesis block).
+//	sialite.decodeHistory(body) -> {"next": "...", "items": [{"id", "height", "data"}]}
+//	  Splits the response of /v1/history into items. "data" is
+//	  Sia-encoded item in base64, pass it to verifyItem decoded.
+//	sialite.verifyItem(item, header) -> {"id", "outputs": [...], "inputs": [...]}
+//	  Checks the item against the header of its block (HEADER_SIZE
+//	  bytes, e.g. stored from /v1/headers) and decodes it.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"syscall/js"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/starius/sialite/cache"
+)
+
+type outputJSON struct {
+	ID      string `json:"id"`
+	Nature  string `json:"nature"`
+	Address string `json:"address"`
+	Value   string `json:"value"`
+}
+
+type inputJSON struct {
+	ParentID string `json:"parent_id"`
+	Siafund  bool   `json:"siafund,omitempty"`
+	Address  string `json:"address"`
+}
+
+type itemJSON struct {
+	ID      string       `json:"id"`
+	Height  int          `json:"height"`
+	Data    []byte       `json:"data,omitempty"`
+	Outputs []outputJSON `json:"outputs,omitempty"`
+	Inputs  []inputJSON  `json:"inputs,omitempty"`
+}
+
+func bytesOf(v js.Value) []byte {
+	buf := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(buf, v)
+	return buf
+}
+
+// export wraps f, which returns a JSON-encodable result, as a JS function.
+func export(name string, f func(args []js.Value) (interface{}, error)) {
+	js.Global().Get("sialite").Set(name, js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var resp interface{}
+		result, err := f(args)
+		if err != nil {
+			resp = map[string]string{"error": err.Error()}
+		} else {
+			resp = result
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{"error": err.Error()})
+		}
+		return string(data)
+	}))
+}
+
+func verifyHeaders(args []js.Value) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("want 2 arguments, got %d", len(args))
+	}
+	var state cache.HeaderVerifierState
+	if stateJSON := args[0].String(); stateJSON != "" {
+		if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+	}
+	v, err := cache.NewHeaderVerifier(state, nil)
+	if err != nil {
+		return nil, err
+	}
+	headers := bytesOf(args[1])
+	if len(headers)%cache.HEADER_SIZE != 0 {
+		return nil, cache.ErrBadHeaderSize
+	}
+	for i := 0; i < len(headers); i += cache.HEADER_SIZE {
+		if err := v.Append(headers[i : i+cache.HEADER_SIZE]); err != nil {
+			return nil, fmt.Errorf("header %d: %v", v.Height(), err)
+		}
+	}
+	newState, err := json.Marshal(v.State())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"state":  string(newState),
+		"height": v.Height(),
+	}, nil
+}
+
+func decodeHistory(args []js.Value) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("want 1 argument, got %d", len(args))
+	}
+	var next string
+	var items []cache.Item
+	if err := encoding.NewDecoder(bytes.NewReader(bytesOf(args[0]))).DecodeAll(&next, &items); err != nil {
+		return nil, fmt.Errorf("decoding history: %v", err)
+	}
+	resp := struct {
+		Next  string     `json:"next"`
+		Items []itemJSON `json:"items"`
+	}{Next: next}
+	for _, item := range items {
+		id, err := cache.ParseItemID(item.ID)
+		if err != nil {
+			return nil, err
+		}
+		resp.Items = append(resp.Items, itemJSON{
+			ID:     item.ID,
+			Height: id.Height,
+			Data:   encoding.Marshal(item),
+		})
+	}
+	return resp, nil
+}
+
+func verifyItem(args []js.Value) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("want 2 arguments, got %d", len(args))
+	}
+	var item cache.Item
+	if err := encoding.Unmarshal(bytesOf(args[0]), &item); err != nil {
+		return nil, fmt.Errorf("decoding item: %v", err)
+	}
+	header, err := cache.DecodeHeader(bytesOf(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.VerifyItem(item, header.MerkleRoot); err != nil {
+		return nil, err
+	}
+	id, err := cache.ParseItemID(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	payout, tx, err := cache.DecodeItem(item)
+	if err != nil {
+		return nil, err
+	}
+	resp := itemJSON{ID: item.ID, Height: id.Height}
+	if payout != nil {
+		// The ID of a miner payout depends on the block ID.
+		resp.Outputs = append(resp.Outputs, outputJSON{
+			Nature:  cache.NATURE_MINER_PAYOUT,
+			Address: cache.FormatAddress(payout.UnlockHash),
+			Value:   cache.FormatHastings(payout.Value),
+		})
+		return resp, nil
+	}
+	for _, output := range cache.TransactionOutputs(tx) {
+		resp.Outputs = append(resp.Outputs, outputJSON{
+			ID:      output.ID.String(),
+			Nature:  output.Nature,
+			Address: cache.FormatAddress(output.UnlockHash),
+			Value:   cache.FormatHastings(output.Value),
+		})
+	}
+	for _, input := range cache.TransactionInputs(tx) {
+		resp.Inputs = append(resp.Inputs, inputJSON{
+			ParentID: input.ParentID.String(),
+			Siafund:  input.Siafund,
+			Address:  cache.FormatAddress(input.UnlockHash),
+		})
+	}
+	return resp, nil
+}
+
+func main() {
+	js.Global().Set("sialite", js.Global().Get("Object").New())
+	export("verifyHeaders", verifyHeaders)
+	export("decodeHistory", decodeHistory)
+	export("verifyItem", verifyItem)
+	// Keep the exported functions alive.
+	select {}
+}
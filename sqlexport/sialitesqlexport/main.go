@@ -0,0 +1,38 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/sqlexport"
+)
+
+var (
+	input       = flag.String("input", "", "Input dir (output of sialitebuilder)")
+	output      = flag.String("output", "", "Output SQLite file")
+	blocksPerTx = flag.Int("blocks_per_tx", 1000, "Number of blocks per SQL transaction")
+)
+
+func main() {
+	flag.Parse()
+	s, err := cache.NewServer(*input)
+	if err != nil {
+		log.Fatalf("cache.NewServer: %v", err)
+	}
+	db, err := sql.Open("sqlite3", *output)
+	if err != nil {
+		log.Fatalf("sql.Open: %v", err)
+	}
+	if err := sqlexport.Export(db, s, *blocksPerTx); err != nil {
+		log.Fatalf("sqlexport.Export: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Fatalf("db.Close: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		log.Fatalf("s.Close: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Package sqlexport writes the contents of the index built by
+// cache.Builder into an SQL database. The schema is written for SQLite.
+package sqlexport
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/starius/sialite/cache"
+)
+
+const schema = `
+CREATE TABLE blocks (
+	height      INTEGER PRIMARY KEY,
+	id          BLOB NOT NULL,
+	parent_id   BLOB NOT NULL,
+	nonce       BLOB NOT NULL,
+	timestamp   INTEGER NOT NULL,
+	merkle_root BLOB NOT NULL,
+	first_item  INTEGER NOT NULL,
+	num_items   INTEGER NOT NULL,
+	subsidy     TEXT NOT NULL,
+	fees        TEXT NOT NULL
+);
+CREATE TABLE transactions (
+	item_index INTEGER PRIMARY KEY,
+	id         BLOB NOT NULL,
+	height     INTEGER NOT NULL,
+	position   INTEGER NOT NULL,
+	size       INTEGER NOT NULL
+);
+CREATE TABLE outputs (
+	id          BLOB NOT NULL,
+	item_index  INTEGER NOT NULL,
+	height      INTEGER NOT NULL,
+	nature      TEXT NOT NULL,
+	position    INTEGER NOT NULL,
+	position0   INTEGER NOT NULL,
+	unlock_hash BLOB NOT NULL,
+	value       TEXT NOT NULL
+);
+CREATE TABLE inputs (
+	parent_id   BLOB NOT NULL,
+	item_index  INTEGER NOT NULL,
+	height      INTEGER NOT NULL,
+	siafund     INTEGER NOT NULL,
+	position    INTEGER NOT NULL,
+	unlock_hash BLOB NOT NULL
+);
+CREATE TABLE address_items (
+	unlock_hash BLOB NOT NULL,
+	item_index  INTEGER NOT NULL
+);
+`
+
+// Indices are created after filling the tables, which is much faster.
+const indices = `
+CREATE UNIQUE INDEX blocks_id ON blocks (id);
+CREATE INDEX transactions_id ON transactions (id);
+CREATE INDEX transactions_height ON transactions (height);
+CREATE INDEX outputs_id ON outputs (id);
+CREATE INDEX outputs_unlock_hash ON outputs (unlock_hash);
+CREATE INDEX outputs_item_index ON outputs (item_index);
+CREATE INDEX inputs_parent_id ON inputs (parent_id);
+CREATE INDEX inputs_unlock_hash ON inputs (unlock_hash);
+CREATE INDEX inputs_item_index ON inputs (item_index);
+CREATE INDEX address_items_unlock_hash ON address_items (unlock_hash);
+CREATE INDEX address_items_item_index ON address_items (item_index);
+`
+
+// inserts are the statements inserting rows into the tables of schema.
+// The values are listed in the order of columns of the tables.
+var inserts = []struct {
+	table, query string
+}{
+	{"blocks", "INSERT INTO blocks VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"},
+	{"transactions", "INSERT INTO transactions VALUES (?, ?, ?, ?, ?)"},
+	{"outputs", "INSERT INTO outputs VALUES (?, ?, ?, ?, ?, ?, ?, ?)"},
+	{"inputs", "INSERT INTO inputs VALUES (?, ?, ?, ?, ?, ?)"},
+	{"address_items", "INSERT INTO address_items VALUES (?, ?)"},
+}
+
+type exporter struct {
+	tx                                           *sql.Tx
+	blocks, transactions, outputs, inputs, links *sql.Stmt
+}
+
+func (e *exporter) begin(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("db.Begin: %v", err)
+	}
+	e.tx = tx
+	// The order of inserts.
+	stmts := []**sql.Stmt{&e.blocks, &e.transactions, &e.outputs, &e.inputs, &e.links}
+	for i, insert := range inserts {
+		stmt, err := tx.Prepare(insert.query)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("tx.Prepare(%q): %v", insert.query, err)
+		}
+		*stmts[i] = stmt
+	}
+	return nil
+}
+
+func (e *exporter) commit() error {
+	if err := e.tx.Commit(); err != nil {
+		return fmt.Errorf("tx.Commit: %v", err)
+	}
+	return nil
+}
+
+func (e *exporter) addBlock(b *cache.DecodedBlock) error {
+	numItems := len(b.MinerPayouts) + len(b.Transactions)
+	if _, err := e.blocks.Exec(b.Height, b.ID[:], b.ParentID[:], b.Header.Nonce[:], uint64(b.Header.Timestamp), b.Header.MerkleRoot[:], b.FirstItem, numItems, cache.FormatHastings(b.Reward.Subsidy), cache.FormatHastings(b.Reward.Fees)); err != nil {
+		return fmt.Errorf("inserting block %d: %v", b.Height, err)
+	}
+	for i, payout := range b.MinerPayouts {
+		itemIndex := b.FirstItem + i
+		id := cache.MinerPayoutID(b.ID, i)
+		if _, err := e.outputs.Exec(id[:], itemIndex, b.Height, cache.NATURE_MINER_PAYOUT, i, 0, payout.UnlockHash[:], cache.FormatHastings(payout.Value)); err != nil {
+			return fmt.Errorf("inserting miner payout: %v", err)
+		}
+		if _, err := e.links.Exec(payout.UnlockHash[:], itemIndex); err != nil {
+			return fmt.Errorf("inserting address link: %v", err)
+		}
+	}
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		itemIndex := b.FirstTx + i
+		size := b.ItemSizes[len(b.MinerPayouts)+i]
+		txid := tx.ID()
+		if _, err := e.transactions.Exec(itemIndex, txid[:], b.Height, i, size); err != nil {
+			return fmt.Errorf("inserting transaction: %v", err)
+		}
+		seen := make(map[[32]byte]struct{})
+		link := func(uh [32]byte) error {
+			if _, has := seen[uh]; has {
+				return nil
+			}
+			seen[uh] = struct{}{}
+			if _, err := e.links.Exec(uh[:], itemIndex); err != nil {
+				return fmt.Errorf("inserting address link: %v", err)
+			}
+			return nil
+		}
+		for _, in := range cache.TransactionInputs(tx) {
+			siafund := 0
+			if in.Siafund {
+				siafund = 1
+			}
+			if _, err := e.inputs.Exec(in.ParentID[:], itemIndex, b.Height, siafund, in.Index, in.UnlockHash[:]); err != nil {
+				return fmt.Errorf("inserting input: %v", err)
+			}
+			if err := link(in.UnlockHash); err != nil {
+				return err
+			}
+		}
+		for _, out := range cache.TransactionOutputs(tx) {
+			if _, err := e.outputs.Exec(out.ID[:], itemIndex, b.Height, out.Nature, out.Index, out.Index0, out.UnlockHash[:], cache.FormatHastings(out.Value)); err != nil {
+				return fmt.Errorf("inserting output: %v", err)
+			}
+			if err := link(out.UnlockHash); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Export creates tables in db and fills them with blocks of s.
+// Blocks are inserted in batches of blocksPerTx blocks per SQL transaction.
+// Indices are created at the end.
+func Export(db *sql.DB, s *cache.Server, blocksPerTx int) error {
+	if blocksPerTx <= 0 {
+		return fmt.Errorf("blocksPerTx must be positive")
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return fmt.Errorf("creating tables: %v", err)
+	}
+	e := &exporter{}
+	if err := e.begin(db); err != nil {
+		return err
+	}
+	err := s.ForEachBlock(0, s.NumBlocks(), func(b *cache.DecodedBlock) error {
+		if err := e.addBlock(b); err != nil {
+			return err
+		}
+		if (b.Height-s.StartHeight()+1)%blocksPerTx == 0 {
+			if err := e.commit(); err != nil {
+				return err
+			}
+			if err := e.begin(db); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		e.tx.Rollback()
+		return err
+	}
+	if err := e.commit(); err != nil {
+		return err
+	}
+	if _, err := db.Exec(indices); err != nil {
+		return fmt.Errorf("creating indices: %v", err)
+	}
+	return nil
+}
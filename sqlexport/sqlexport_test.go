@@ -0,0 +1,207 @@
+package sqlexport
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/cache/cachetest"
+)
+
+func TestExport(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	addresses, err := cachetest.ReadAddresses()
+	if err != nil {
+		t.Fatalf("cachetest.ReadAddresses: %v", err)
+	}
+	s := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	dir, err := ioutil.TempDir("", "TestExport")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "index.sqlite"))
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer db.Close()
+	// 300 does not divide 1000, so the last SQL transaction is partial.
+	if err := Export(db, s, 300); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	// Each insert has a value for each column of its table.
+	for _, insert := range inserts {
+		rows, err := db.Query("PRAGMA table_info(" + insert.table + ")")
+		if err != nil {
+			t.Fatalf("PRAGMA table_info(%s): %v", insert.table, err)
+		}
+		columns := 0
+		for rows.Next() {
+			columns++
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("PRAGMA table_info(%s): %v", insert.table, err)
+		}
+		rows.Close()
+		if values := strings.Count(insert.query, "?"); columns == 0 || values != columns {
+			t.Errorf("table %s has %d columns, insert has %d values", insert.table, columns, values)
+		}
+	}
+
+	rows, err := db.Query("SELECT height, id, parent_id, timestamp, first_item, num_items FROM blocks ORDER BY height")
+	if err != nil {
+		t.Fatalf("SELECT FROM blocks: %v", err)
+	}
+	nblocks, nitems := 0, 0
+	for rows.Next() {
+		var height, firstItem, numItems int
+		var timestamp int64
+		var id, parentID []byte
+		if err := rows.Scan(&height, &id, &parentID, &timestamp, &firstItem, &numItems); err != nil {
+			t.Fatalf("rows.Scan: %v", err)
+		}
+		block := blocks[nblocks]
+		wantID := block.ID()
+		if height != nblocks || !bytes.Equal(id, wantID[:]) || !bytes.Equal(parentID, block.ParentID[:]) || timestamp != int64(block.Timestamp) {
+			t.Errorf("row %d of blocks: height %d, ID %x, parent %x, timestamp %d", nblocks, height, id, parentID, timestamp)
+		}
+		if firstItem != nitems || numItems != len(block.MinerPayouts)+len(block.Transactions) {
+			t.Errorf("block %d: items %d-%d, want from %d", height, firstItem, firstItem+numItems, nitems)
+		}
+		nblocks++
+		nitems += numItems
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("SELECT FROM blocks: %v", err)
+	}
+	rows.Close()
+	if nblocks != len(blocks) || nitems != s.NumItems() {
+		t.Errorf("got %d blocks of %d items, want %d blocks of %d items", nblocks, nitems, len(blocks), s.NumItems())
+	}
+
+	var txids [][]byte
+	npayouts := 0
+	for _, block := range blocks {
+		npayouts += len(block.MinerPayouts)
+		for _, tx := range block.Transactions {
+			txid := tx.ID()
+			txids = append(txids, txid[:])
+		}
+	}
+	rows, err = db.Query("SELECT id FROM transactions ORDER BY item_index")
+	if err != nil {
+		t.Fatalf("SELECT FROM transactions: %v", err)
+	}
+	ntxs := 0
+	for rows.Next() {
+		var id []byte
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("rows.Scan: %v", err)
+		}
+		if ntxs < len(txids) && !bytes.Equal(id, txids[ntxs]) {
+			t.Errorf("transaction %d has ID %x, want %x", ntxs, id, txids[ntxs])
+		}
+		ntxs++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("SELECT FROM transactions: %v", err)
+	}
+	rows.Close()
+	if ntxs != len(txids) {
+		t.Errorf("got %d transactions, want %d", ntxs, len(txids))
+	}
+	var gotPayouts int
+	if err := db.QueryRow("SELECT COUNT(*) FROM outputs WHERE nature = ?", cache.NATURE_MINER_PAYOUT).Scan(&gotPayouts); err != nil {
+		t.Fatalf("SELECT FROM outputs: %v", err)
+	}
+	if gotPayouts != npayouts {
+		t.Errorf("got %d miner payouts, want %d", gotPayouts, npayouts)
+	}
+
+	// address_items has the items of the history of each address.
+	for _, address := range addresses {
+		addressBytes, err := hex.DecodeString(address)
+		if err != nil {
+			t.Fatalf("hex.DecodeString(%s): %v", address, err)
+		}
+		page, err := s.GetHistoryPage(addressBytes[:32], "", 10*len(blocks))
+		if err != nil {
+			t.Fatalf("GetHistoryPage(%s): %v", address, err)
+		}
+		if page.Next != "" {
+			t.Fatalf("GetHistoryPage(%s) returned a partial history", address)
+		}
+		var links int
+		if err := db.QueryRow("SELECT COUNT(*) FROM address_items WHERE unlock_hash = ?", addressBytes[:32]).Scan(&links); err != nil {
+			t.Fatalf("SELECT FROM address_items: %v", err)
+		}
+		if links != len(page.Items) || links == 0 {
+			t.Errorf("address %s has %d rows in address_items, want %d", address, links, len(page.Items))
+		}
+	}
+
+	// The tables exist, so the second export fails.
+	if err := Export(db, s, 300); err == nil {
+		t.Errorf("Export into a filled database succeeded")
+	}
+}
+
+func TestExportCheckpoint(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	const start = 500
+	p := cachetest.Checkpoint(cachetest.Parameters(), blocks, start)
+	s := cachetest.BuildServer(t, p, blocks[start:])
+	dir, err := ioutil.TempDir("", "TestExportCheckpoint")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "index.sqlite"))
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer db.Close()
+	if err := Export(db, s, 300); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	rows, err := db.Query("SELECT height, id FROM blocks ORDER BY height")
+	if err != nil {
+		t.Fatalf("SELECT FROM blocks: %v", err)
+	}
+	defer rows.Close()
+	want := start
+	for rows.Next() {
+		var height int
+		var id []byte
+		if err := rows.Scan(&height, &id); err != nil {
+			t.Fatalf("rows.Scan: %v", err)
+		}
+		if height != want || want >= len(blocks) {
+			t.Fatalf("got block %d, want %d", height, want)
+		}
+		if wantID := blocks[height].ID(); !bytes.Equal(id, wantID[:]) {
+			t.Errorf("block %d has ID %x, want %x", height, id, wantID[:])
+		}
+		want++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("SELECT FROM blocks: %v", err)
+	}
+	if want != len(blocks) {
+		t.Errorf("got blocks from %d to %d, want to %d", start, want, len(blocks))
+	}
+}
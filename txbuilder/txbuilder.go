@@ -0,0 +1,307 @@
+// Package txbuilder constructs unsigned siacoin transactions from the
+// unspent outputs found by a sialite server (see cache.Audit): it
+// selects outputs for the amount to pay, adds the change output and the
+// miner fee. Signing is left to the wallet.
+package txbuilder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+)
+
+var (
+	ErrInsufficientFunds = fmt.Errorf("Insufficient funds")
+	ErrNoOutputs         = fmt.Errorf("No outputs to pay")
+	ErrUnknownStrategy   = fmt.Errorf("Unknown coin selection strategy")
+)
+
+// MinFeePerByte is the fee per byte of transaction below which nodes
+// do not relay transactions (10 mS/KB, as in siad).
+var MinFeePerByte = types.SiacoinPrecision.Div64(100).Div64(1000)
+
+// UTXO is an unspent siacoin output which the wallet can spend.
+type UTXO struct {
+	ID               types.SiacoinOutputID
+	Value            types.Currency
+	UnlockConditions types.UnlockConditions
+
+	// Height is the height of the block creating the output.
+	Height int
+	// SpendableHeight is the first height which can spend the output
+	// (see cache.AuditOutput).
+	SpendableHeight int
+}
+
+// FromAudit returns siacoin outputs of the audit spendable at height.
+// conditions are the unlock conditions of the addresses of the wallet
+// (see wallet.Key); outputs of other addresses are skipped. Outputs
+// spent by transactions of the mempool should be removed by the caller.
+func FromAudit(audit *cache.Audit, conditions map[types.UnlockHash]types.UnlockConditions, height int) ([]UTXO, error) {
+	var utxos []UTXO
+	for _, out := range audit.Outputs {
+		if out.Nature == cache.NATURE_SIAFUND_OUTPUT || out.SpendableHeight > height {
+			continue
+		}
+		uc, has := conditions[out.Address]
+		if !has {
+			continue
+		}
+		id, err := cache.ParseItemID(out.Created.ID)
+		if err != nil {
+			return nil, err
+		}
+		utxos = append(utxos, UTXO{
+			ID:               types.SiacoinOutputID(out.ID),
+			Value:            out.Value,
+			UnlockConditions: uc,
+			Height:           id.Height,
+			SpendableHeight:  out.SpendableHeight,
+		})
+	}
+	return utxos, nil
+}
+
+// Strategy is the way of choosing outputs to spend.
+type Strategy int
+
+const (
+	// LARGEST_FIRST spends few large outputs, so transactions are small.
+	LARGEST_FIRST Strategy = iota
+	// SMALLEST_FIRST consolidates small outputs.
+	SMALLEST_FIRST
+	// OLDEST_FIRST spends outputs in the order of the chain.
+	OLDEST_FIRST
+	// EXACT_MATCH looks for outputs paying the amount with fee without
+	// change, which reveals less about the wallet, and falls back to
+	// LARGEST_FIRST.
+	EXACT_MATCH
+)
+
+// exactMatchTries limits the search of EXACT_MATCH.
+const exactMatchTries = 100000
+
+// Select returns the outputs to pay target by the strategy.
+func Select(utxos []UTXO, target types.Currency, strategy Strategy) ([]UTXO, error) {
+	sorted := append([]UTXO{}, utxos...)
+	switch strategy {
+	case LARGEST_FIRST, EXACT_MATCH:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Value.Cmp(sorted[j].Value) > 0
+		})
+	case SMALLEST_FIRST:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Value.Cmp(sorted[j].Value) < 0
+		})
+	case OLDEST_FIRST:
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Height < sorted[j].Height
+		})
+	default:
+		return nil, ErrUnknownStrategy
+	}
+	if strategy == EXACT_MATCH {
+		if selected := exactMatch(sorted, target); selected != nil {
+			return selected, nil
+		}
+	}
+	var selected []UTXO
+	sum := types.ZeroCurrency
+	for _, utxo := range sorted {
+		if sum.Cmp(target) >= 0 {
+			break
+		}
+		selected = append(selected, utxo)
+		sum = sum.Add(utxo.Value)
+	}
+	if sum.Cmp(target) < 0 {
+		return nil, ErrInsufficientFunds
+	}
+	return selected, nil
+}
+
+// exactMatch searches outputs sorted from the largest with sum equal
+// to target (depth-first, skipping branches which can not reach it).
+func exactMatch(sorted []UTXO, target types.Currency) []UTXO {
+	// rest[i] is the sum of sorted[i:].
+	rest := make([]types.Currency, len(sorted)+1)
+	rest[len(sorted)] = types.ZeroCurrency
+	for i := len(sorted) - 1; i >= 0; i-- {
+		rest[i] = rest[i+1].Add(sorted[i].Value)
+	}
+	tries := 0
+	var path []UTXO
+	var search func(i int, need types.Currency) bool
+	search = func(i int, need types.Currency) bool {
+		if need.IsZero() {
+			return true
+		}
+		tries++
+		if i == len(sorted) || tries > exactMatchTries || rest[i].Cmp(need) < 0 {
+			return false
+		}
+		if sorted[i].Value.Cmp(need) <= 0 {
+			path = append(path, sorted[i])
+			if search(i+1, need.Sub(sorted[i].Value)) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return search(i+1, need)
+	}
+	if !search(0, target) {
+		return nil
+	}
+	return path
+}
+
+// placeholderSignature has the size of an ed25519 signature.
+var placeholderSignature = make([]byte, crypto.SignatureSize)
+
+// EstimateSize returns the size of the transaction after signing, one
+// signature per required signature of each input covering the whole
+// transaction.
+func EstimateSize(tx types.Transaction) int {
+	signed := tx
+	signed.TransactionSignatures = append([]types.TransactionSignature{}, tx.TransactionSignatures...)
+	if len(signed.TransactionSignatures) == 0 {
+		for _, input := range tx.SiacoinInputs {
+			for i := uint64(0); i < input.UnlockConditions.SignaturesRequired; i++ {
+				signed.TransactionSignatures = append(signed.TransactionSignatures, types.TransactionSignature{
+					ParentID:       crypto.Hash(input.ParentID),
+					PublicKeyIndex: i,
+					CoveredFields:  types.CoveredFields{WholeTransaction: true},
+					Signature:      placeholderSignature,
+				})
+			}
+		}
+	}
+	return len(encoding.Marshal(signed))
+}
+
+// EstimateFee returns the miner fee of the signed transaction.
+func EstimateFee(tx types.Transaction, feePerByte types.Currency) types.Currency {
+	return feePerByte.Mul64(uint64(EstimateSize(tx)))
+}
+
+// FeePerByte returns the median fee per byte of the transactions of
+// the items (see cache.Server.BlockItemInfos), e.g. of recent blocks,
+// but not less than MinFeePerByte.
+func FeePerByte(infos []cache.ItemInfo) types.Currency {
+	var rates []types.Currency
+	for _, info := range infos {
+		if info.Size == 0 || info.Fee.IsZero() {
+			continue
+		}
+		rates = append(rates, info.Fee.Div64(uint64(info.Size)))
+	}
+	if len(rates) == 0 {
+		return MinFeePerByte
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Cmp(rates[j]) < 0
+	})
+	median := rates[len(rates)/2]
+	if median.Cmp(MinFeePerByte) < 0 {
+		return MinFeePerByte
+	}
+	return median
+}
+
+// RecentFeePerByte returns FeePerByte of the last nblocks blocks of
+// the index.
+func RecentFeePerByte(s *cache.Server, nblocks int) (types.Currency, error) {
+	var infos []cache.ItemInfo
+	for blockIndex := s.NumBlocks() - 1; blockIndex >= 0 && blockIndex >= s.NumBlocks()-nblocks; blockIndex-- {
+		blockInfos, err := s.BlockItemInfos(blockIndex)
+		if err != nil {
+			return types.Currency{}, err
+		}
+		infos = append(infos, blockInfos...)
+	}
+	return FeePerByte(infos), nil
+}
+
+// Request describes the transaction to build.
+type Request struct {
+	Outputs []types.SiacoinOutput
+
+	// Change receives the rest of the spent outputs. Change below
+	// DustThreshold is added to the fee instead.
+	Change types.UnlockHash
+
+	FeePerByte types.Currency
+	Strategy   Strategy
+}
+
+// DustThreshold returns the value of an output which costs more in fees
+// to spend than it is worth.
+func DustThreshold(feePerByte types.Currency) types.Currency {
+	withInput := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{
+			UnlockConditions: types.UnlockConditions{
+				PublicKeys:         []types.SiaPublicKey{{Algorithm: types.SignatureEd25519, Key: make([]byte, crypto.PublicKeySize)}},
+				SignaturesRequired: 1,
+			},
+		}},
+	}
+	return EstimateFee(withInput, feePerByte).Sub(EstimateFee(types.Transaction{}, feePerByte))
+}
+
+// Build selects outputs among utxos to pay the request and returns the
+// unsigned transaction and the spent outputs in the order of inputs.
+func Build(utxos []UTXO, req Request) (types.Transaction, []UTXO, error) {
+	if len(req.Outputs) == 0 {
+		return types.Transaction{}, nil, ErrNoOutputs
+	}
+	pay := types.ZeroCurrency
+	for _, out := range req.Outputs {
+		pay = pay.Add(out.Value)
+	}
+	dust := DustThreshold(req.FeePerByte)
+	fee := types.ZeroCurrency
+	// The fee depends on the number of inputs, so outputs are selected
+	// again until the fee covers the transaction.
+	for {
+		selected, err := Select(utxos, pay.Add(fee), req.Strategy)
+		if err != nil {
+			return types.Transaction{}, nil, err
+		}
+		tx := types.Transaction{
+			SiacoinOutputs: append([]types.SiacoinOutput{}, req.Outputs...),
+		}
+		sum := types.ZeroCurrency
+		for _, utxo := range selected {
+			tx.SiacoinInputs = append(tx.SiacoinInputs, types.SiacoinInput{
+				ParentID:         utxo.ID,
+				UnlockConditions: utxo.UnlockConditions,
+			})
+			sum = sum.Add(utxo.Value)
+		}
+		// The fee and the change are not greater than sum, so with
+		// both set to sum the size is not less than the final one.
+		tx.MinerFees = []types.Currency{sum}
+		tx.SiacoinOutputs = append(tx.SiacoinOutputs, types.SiacoinOutput{
+			Value:      sum,
+			UnlockHash: req.Change,
+		})
+		needFee := EstimateFee(tx, req.FeePerByte)
+		if sum.Cmp(pay.Add(needFee)) < 0 {
+			fee = needFee
+			continue
+		}
+		change := sum.Sub(pay).Sub(needFee)
+		if change.Cmp(dust) < 0 {
+			tx.SiacoinOutputs = tx.SiacoinOutputs[:len(req.Outputs)]
+			needFee = needFee.Add(change)
+		} else {
+			tx.SiacoinOutputs[len(req.Outputs)].Value = change
+		}
+		tx.MinerFees = []types.Currency{needFee}
+		return tx, selected, nil
+	}
+}
@@ -0,0 +1,101 @@
+package txbuilder
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+func fakeUTXOs(values ...uint64) []UTXO {
+	var utxos []UTXO
+	for i, v := range values {
+		utxos = append(utxos, UTXO{
+			ID:     types.SiacoinOutputID{byte(i + 1)},
+			Value:  types.SiacoinPrecision.Mul64(v),
+			Height: len(values) - i,
+			UnlockConditions: types.UnlockConditions{
+				PublicKeys:         []types.SiaPublicKey{{Algorithm: types.SignatureEd25519, Key: make([]byte, 32)}},
+				SignaturesRequired: 1,
+			},
+		})
+	}
+	return utxos
+}
+
+func sum(utxos []UTXO) types.Currency {
+	total := types.ZeroCurrency
+	for _, utxo := range utxos {
+		total = total.Add(utxo.Value)
+	}
+	return total
+}
+
+func TestSelect(t *testing.T) {
+	utxos := fakeUTXOs(5, 1, 10, 3, 7)
+	cases := []struct {
+		strategy Strategy
+		target   uint64
+		want     []uint64
+	}{
+		{LARGEST_FIRST, 12, []uint64{10, 7}},
+		{SMALLEST_FIRST, 4, []uint64{1, 3}},
+		{OLDEST_FIRST, 8, []uint64{7, 3}},
+		{EXACT_MATCH, 9, []uint64{5, 3, 1}},
+		{EXACT_MATCH, 26, []uint64{10, 7, 5, 3, 1}},
+	}
+	for _, c := range cases {
+		selected, err := Select(utxos, types.SiacoinPrecision.Mul64(c.target), c.strategy)
+		if err != nil {
+			t.Fatalf("Select(%d, %d): %v", c.strategy, c.target, err)
+		}
+		if len(selected) != len(c.want) {
+			t.Fatalf("Select(%d, %d) returned %d outputs, want %v", c.strategy, c.target, len(selected), c.want)
+		}
+		for i, utxo := range selected {
+			if utxo.Value.Cmp(types.SiacoinPrecision.Mul64(c.want[i])) != 0 {
+				t.Errorf("Select(%d, %d)[%d] = %v, want %d SC", c.strategy, c.target, i, utxo.Value, c.want[i])
+			}
+		}
+	}
+	if _, err := Select(utxos, types.SiacoinPrecision.Mul64(27), LARGEST_FIRST); err != ErrInsufficientFunds {
+		t.Errorf("Select of too much: got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	utxos := fakeUTXOs(5, 1, 10, 3, 7)
+	feePerByte := MinFeePerByte
+	for _, strategy := range []Strategy{LARGEST_FIRST, SMALLEST_FIRST, OLDEST_FIRST, EXACT_MATCH} {
+		req := Request{
+			Outputs: []types.SiacoinOutput{
+				{Value: types.SiacoinPrecision.Mul64(8), UnlockHash: types.UnlockHash{1}},
+			},
+			Change:     types.UnlockHash{2},
+			FeePerByte: feePerByte,
+			Strategy:   strategy,
+		}
+		tx, spent, err := Build(utxos, req)
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		if len(tx.SiacoinInputs) != len(spent) {
+			t.Fatalf("%d inputs, %d spent outputs", len(tx.SiacoinInputs), len(spent))
+		}
+		out := types.ZeroCurrency
+		for _, o := range tx.SiacoinOutputs {
+			out = out.Add(o.Value)
+		}
+		for _, fee := range tx.MinerFees {
+			out = out.Add(fee)
+		}
+		if out.Cmp(sum(spent)) != 0 {
+			t.Errorf("strategy %d: outputs and fees %v, inputs %v", strategy, out, sum(spent))
+		}
+		if tx.MinerFees[0].Cmp(EstimateFee(tx, feePerByte)) < 0 {
+			t.Errorf("strategy %d: fee %v is less than estimated %v", strategy, tx.MinerFees[0], EstimateFee(tx, feePerByte))
+		}
+	}
+	if _, _, err := Build(utxos, Request{FeePerByte: feePerByte}); err != ErrNoOutputs {
+		t.Errorf("Build without outputs: got %v, want ErrNoOutputs", err)
+	}
+}
@@ -0,0 +1,197 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/entropy-mnemonics"
+	"github.com/starius/sialite/cache"
+)
+
+// MAX_RANGE_COUNT limits the number of addresses of a seed range.
+const MAX_RANGE_COUNT = 100000
+
+// Descriptor describes a watch-only wallet: labeled lists of addresses.
+// An entry can also specify a range of addresses of a seed; Expand
+// replaces the seed with the derived addresses, so descriptors are
+// saved without seeds. Example:
+//
+//	{"entries": [
+//		{"label": "cold", "addresses": ["<76 hex characters>"]},
+//		{"label": "main", "seed": "<seed words>", "start": 0, "count": 100}
+//	]}
+type Descriptor struct {
+	Entries []DescriptorEntry `json:"entries"`
+}
+
+type DescriptorEntry struct {
+	Label     string   `json:"label"`
+	Addresses []string `json:"addresses,omitempty"`
+
+	// Addresses of the seed with indices [Start, Start+Count).
+	Seed  string `json:"seed,omitempty"`
+	Start uint64 `json:"start,omitempty"`
+	Count uint64 `json:"count,omitempty"`
+}
+
+// ParseDescriptor parses and checks JSON of Descriptor.
+func ParseDescriptor(data []byte) (*Descriptor, error) {
+	var d Descriptor
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	for _, e := range d.Entries {
+		if e.Label == "" {
+			return nil, fmt.Errorf("entry without label")
+		}
+		for _, address := range e.Addresses {
+			if _, err := cache.ParseAddress(address); err != nil {
+				return nil, fmt.Errorf("entry %q: address %q: %v", e.Label, address, err)
+			}
+		}
+		if e.Seed == "" && (e.Start != 0 || e.Count != 0) {
+			return nil, fmt.Errorf("entry %q: range without seed", e.Label)
+		}
+		if e.Count > MAX_RANGE_COUNT {
+			return nil, fmt.Errorf("entry %q: count %d is larger than %d", e.Label, e.Count, MAX_RANGE_COUNT)
+		}
+	}
+	return &d, nil
+}
+
+// LoadDescriptor reads the descriptor from the file.
+func LoadDescriptor(path string) (*Descriptor, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDescriptor(data)
+}
+
+// Save writes the descriptor to the file. Seeds must be expanded.
+func (d *Descriptor) Save(path string) error {
+	for _, e := range d.Entries {
+		if e.Seed != "" {
+			return fmt.Errorf("entry %q has a seed; call Expand", e.Label)
+		}
+	}
+	data, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Expand derives addresses of seed ranges and removes the seeds.
+func (d *Descriptor) Expand() error {
+	for i := range d.Entries {
+		e := &d.Entries[i]
+		if e.Seed == "" {
+			continue
+		}
+		seed, err := modules.StringToSeed(e.Seed, mnemonics.English)
+		if err != nil {
+			return fmt.Errorf("entry %q: modules.StringToSeed: %v", e.Label, err)
+		}
+		for index := e.Start; index < e.Start+e.Count; index++ {
+			e.Addresses = append(e.Addresses, cache.FormatAddress(DeriveKey(seed, index).Address))
+		}
+		e.Seed = ""
+		e.Start = 0
+		e.Count = 0
+	}
+	return nil
+}
+
+// Import adds entries of other to d. Addresses of entries with
+// the same label are merged. Seeds of other must be expanded.
+func (d *Descriptor) Import(other *Descriptor) error {
+	byLabel := make(map[string]int)
+	for i, e := range d.Entries {
+		byLabel[e.Label] = i
+	}
+	for _, e := range other.Entries {
+		if e.Seed != "" {
+			return fmt.Errorf("entry %q has a seed; call Expand", e.Label)
+		}
+		i, has := byLabel[e.Label]
+		if !has {
+			byLabel[e.Label] = len(d.Entries)
+			d.Entries = append(d.Entries, DescriptorEntry{Label: e.Label})
+			i = len(d.Entries) - 1
+		}
+		known := make(map[string]bool)
+		for _, address := range d.Entries[i].Addresses {
+			known[address] = true
+		}
+		for _, address := range e.Addresses {
+			if !known[address] {
+				known[address] = true
+				d.Entries[i].Addresses = append(d.Entries[i].Addresses, address)
+			}
+		}
+	}
+	return nil
+}
+
+// Watcher provides history and balances of addresses.
+type Watcher interface {
+	Checker
+	Balance(address types.UnlockHash) (siacoins, siafunds types.Currency, err error)
+}
+
+// LabelReport is the state of the addresses of a label.
+type LabelReport struct {
+	Label     string
+	Addresses int
+	Used      int
+	Siacoins  types.Currency
+	Siafunds  types.Currency
+}
+
+// Watch queries addresses of the descriptor and returns the reports
+// in the order of entries. Seeds must be expanded.
+func Watch(d *Descriptor, watcher Watcher) ([]LabelReport, error) {
+	var reports []LabelReport
+	for _, e := range d.Entries {
+		if e.Seed != "" {
+			return nil, fmt.Errorf("entry %q has a seed; call Expand", e.Label)
+		}
+		r := LabelReport{
+			Label:     e.Label,
+			Addresses: len(e.Addresses),
+			Siacoins:  types.ZeroCurrency,
+			Siafunds:  types.ZeroCurrency,
+		}
+		for _, text := range e.Addresses {
+			address, err := cache.ParseAddress(text)
+			if err != nil {
+				return nil, err
+			}
+			used, err := watcher.Used(address)
+			if err != nil {
+				return nil, fmt.Errorf("checking address %s: %v", text, err)
+			}
+			if !used {
+				continue
+			}
+			r.Used++
+			siacoins, siafunds, err := watcher.Balance(address)
+			if err != nil {
+				return nil, fmt.Errorf("balance of address %s: %v", text, err)
+			}
+			r.Siacoins = r.Siacoins.Add(siacoins)
+			r.Siafunds = r.Siafunds.Add(siafunds)
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
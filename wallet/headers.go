@@ -0,0 +1,196 @@
+package wallet
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/starius/sialite/cache"
+)
+
+// headersChunk is the number of headers read at once when the store
+// is verified.
+const headersChunk = 1024
+
+// HeaderStore is a file of verified headers (cache.HEADER_SIZE bytes
+// each) starting from the genesis block. Only the state of
+// cache.HeaderVerifier is kept in memory.
+type HeaderStore struct {
+	f        *os.File
+	clock    cache.Clock
+	verifier *cache.HeaderVerifier
+}
+
+// OpenHeaderStore opens or creates the file of headers and verifies
+// its contents. A partial header at the end, left by interrupted
+// Append, is removed. If clock is nil, cache.SystemClock is used.
+func OpenHeaderStore(file string, clock cache.Clock) (*HeaderStore, error) {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	hs := &HeaderStore{f: f, clock: clock}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := hs.verify(int(stat.Size()) / cache.HEADER_SIZE); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return hs, nil
+}
+
+// verify verifies first n headers of the file and truncates the rest.
+func (hs *HeaderStore) verify(n int) error {
+	verifier, err := cache.NewHeaderVerifier(cache.HeaderVerifierState{}, hs.clock)
+	if err != nil {
+		return err
+	}
+	if _, err := hs.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, headersChunk*cache.HEADER_SIZE)
+	for height := 0; height < n; {
+		chunk := n - height
+		if chunk > headersChunk {
+			chunk = headersChunk
+		}
+		data := buf[:chunk*cache.HEADER_SIZE]
+		if _, err := io.ReadFull(hs.f, data); err != nil {
+			return fmt.Errorf("reading headers: %v", err)
+		}
+		for i := 0; i < chunk; i++ {
+			if err := verifier.Append(data[i*cache.HEADER_SIZE : (i+1)*cache.HEADER_SIZE]); err != nil {
+				return fmt.Errorf("header %d: %v", height+i, err)
+			}
+		}
+		height += chunk
+	}
+	if err := hs.f.Truncate(int64(n * cache.HEADER_SIZE)); err != nil {
+		return err
+	}
+	hs.verifier = verifier
+	return nil
+}
+
+// Height returns the number of stored headers.
+func (hs *HeaderStore) Height() int {
+	return hs.verifier.Height()
+}
+
+// Header returns the stored header of the block with given height.
+func (hs *HeaderStore) Header(height int) (cache.BlockHeader, error) {
+	if height < 0 || height >= hs.Height() {
+		return cache.BlockHeader{}, fmt.Errorf("no header %d, store has %d headers", height, hs.Height())
+	}
+	buf := make([]byte, cache.HEADER_SIZE)
+	if _, err := hs.f.ReadAt(buf, int64(height*cache.HEADER_SIZE)); err != nil {
+		return cache.BlockHeader{}, err
+	}
+	return cache.DecodeHeader(buf)
+}
+
+// Tip returns the state of the verifier after the last header. Its
+// LastID is the ID of the last block.
+func (hs *HeaderStore) Tip() cache.HeaderVerifierState {
+	return hs.verifier.State()
+}
+
+// Append verifies headers (cache.HEADER_SIZE bytes each) following the
+// stored ones and appends them to the file. If any header is invalid,
+// nothing is appended.
+func (hs *HeaderStore) Append(headers []byte) error {
+	if len(headers)%cache.HEADER_SIZE != 0 {
+		return cache.ErrBadHeaderSize
+	}
+	verifier, err := cache.NewHeaderVerifier(hs.verifier.State(), hs.clock)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(headers); i += cache.HEADER_SIZE {
+		if err := verifier.Append(headers[i : i+cache.HEADER_SIZE]); err != nil {
+			return fmt.Errorf("header %d: %v", hs.Height()+i/cache.HEADER_SIZE, err)
+		}
+	}
+	if _, err := hs.f.WriteAt(headers, int64(hs.Height()*cache.HEADER_SIZE)); err != nil {
+		return err
+	}
+	if err := hs.f.Sync(); err != nil {
+		return err
+	}
+	hs.verifier = verifier
+	return nil
+}
+
+// Truncate removes headers above the height, e.g. on reorg.
+// The remaining headers are verified again to restore the state.
+func (hs *HeaderStore) Truncate(height int) error {
+	if height < 0 || height > hs.Height() {
+		return fmt.Errorf("can not truncate %d headers to %d", hs.Height(), height)
+	}
+	if err := hs.verify(height); err != nil {
+		return err
+	}
+	return hs.f.Sync()
+}
+
+func (hs *HeaderStore) Close() error {
+	return hs.f.Close()
+}
+
+// SyncHeaders downloads headers above the tip of the store from
+// /v1/headers of sialite server. If the server is on another fork, the
+// stored headers are truncated back until the chains agree. It returns
+// the number of appended headers.
+func SyncHeaders(client *http.Client, url string, hs *HeaderStore) (int, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	appended := 0
+	back := 1
+	for {
+		tip := hs.Tip()
+		query := fmt.Sprintf("%s/v1/headers?start=%d", url, tip.Height)
+		if tip.Height != 0 {
+			query += "&parent=" + tip.LastID.String()
+		}
+		resp, err := client.Get(query)
+		if err != nil {
+			return appended, err
+		}
+		headers, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return appended, err
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusConflict:
+			if tip.Height == 0 {
+				return appended, fmt.Errorf("GET /v1/headers: %s", resp.Status)
+			}
+			height := tip.Height - back
+			if height < 0 {
+				height = 0
+			}
+			if err := hs.Truncate(height); err != nil {
+				return appended, err
+			}
+			back *= 2
+			continue
+		default:
+			return appended, fmt.Errorf("GET /v1/headers: %s", resp.Status)
+		}
+		if len(headers) == 0 {
+			return appended, nil
+		}
+		if err := hs.Append(headers); err != nil {
+			return appended, err
+		}
+		appended += len(headers) / cache.HEADER_SIZE
+	}
+}
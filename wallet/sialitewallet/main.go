@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/entropy-mnemonics"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/wallet"
+)
+
+var (
+	server   = flag.String("server", "http://localhost:35813", "URL of sialite server")
+	files    = flag.String("files", "", "Dir with output of builder (instead of -server)")
+	gapLimit = flag.Int("gap_limit", wallet.DEFAULT_GAP_LIMIT, "Number of unused addresses to stop scanning")
+
+	descriptor = flag.String("descriptor", "", "Watch-only wallet file; if set, balances of its labels are printed as JSON instead of scanning a seed")
+	importFile = flag.String("import", "", "Descriptor to import into -descriptor (seed ranges are derived, seeds are not saved)")
+)
+
+type labelResult struct {
+	Addresses int    `json:"addresses"`
+	Used      int    `json:"used"`
+	Siacoins  string `json:"siacoins"`
+	Siafunds  string `json:"siafunds"`
+}
+
+func watch(watcher wallet.Watcher) {
+	d := &wallet.Descriptor{}
+	if _, err := os.Stat(*descriptor); err == nil {
+		if d, err = wallet.LoadDescriptor(*descriptor); err != nil {
+			log.Fatalf("wallet.LoadDescriptor: %v", err)
+		}
+	}
+	if *importFile != "" {
+		imported, err := wallet.LoadDescriptor(*importFile)
+		if err != nil {
+			log.Fatalf("wallet.LoadDescriptor: %v", err)
+		}
+		if err := imported.Expand(); err != nil {
+			log.Fatalf("Expand: %v", err)
+		}
+		if err := d.Import(imported); err != nil {
+			log.Fatalf("Import: %v", err)
+		}
+		if err := d.Save(*descriptor); err != nil {
+			log.Fatalf("Save: %v", err)
+		}
+	}
+	reports, err := wallet.Watch(d, watcher)
+	if err != nil {
+		log.Fatalf("wallet.Watch: %v", err)
+	}
+	results := make(map[string]labelResult)
+	for _, r := range reports {
+		results[r.Label] = labelResult{
+			Addresses: r.Addresses,
+			Used:      r.Used,
+			Siacoins:  cache.FormatSC(r.Siacoins),
+			Siafunds:  cache.FormatHastings(r.Siafunds),
+		}
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "\t")
+	if err := e.Encode(results); err != nil {
+		log.Fatalf("Encode: %v", err)
+	}
+}
+
+func main() {
+	flag.Parse()
+	var checker wallet.Watcher = wallet.HTTPChecker{URL: *server}
+	if *files != "" {
+		s, err := cache.NewServer(*files)
+		if err != nil {
+			log.Fatalf("cache.NewServer: %v", err)
+		}
+		defer s.Close()
+		checker = wallet.ServerChecker{Server: s}
+	}
+	if *descriptor != "" {
+		watch(checker)
+		return
+	} else if *importFile != "" {
+		log.Fatalf("-import requires -descriptor")
+	}
+	fmt.Fprintf(os.Stderr, "Enter the seed: ")
+	phrase, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		log.Fatalf("Reading the seed: %v", err)
+	}
+	seed, err := modules.StringToSeed(strings.TrimSpace(phrase), mnemonics.English)
+	if err != nil {
+		log.Fatalf("modules.StringToSeed: %v", err)
+	}
+	result, err := wallet.Scan(seed, checker, *gapLimit)
+	if err != nil {
+		log.Fatalf("wallet.Scan: %v", err)
+	}
+	for _, index := range result.Used {
+		fmt.Printf("%d %s\n", index, cache.FormatAddress(wallet.DeriveKey(seed, index).Address))
+	}
+	fmt.Printf("Next unused address: %d %s\n", result.Next, cache.FormatAddress(wallet.DeriveKey(seed, result.Next).Address))
+}
@@ -0,0 +1,77 @@
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	ErrNoKey       = fmt.Errorf("No key of the address of the input")
+	ErrNotStandard = fmt.Errorf("Unlock conditions of the input are not standard single-signature ones")
+)
+
+// WholeTransaction returns CoveredFields of a signature covering all
+// fields of the transaction except other signatures.
+func WholeTransaction() types.CoveredFields {
+	return types.CoveredFields{WholeTransaction: true}
+}
+
+// isStandard returns if uc require one signature of one ed25519 key, as
+// unlock conditions of DeriveKey (the timelock does not matter).
+func isStandard(uc types.UnlockConditions) bool {
+	return uc.SignaturesRequired == 1 && len(uc.PublicKeys) == 1 &&
+		uc.PublicKeys[0].Algorithm == types.SignatureEd25519
+}
+
+// Sign signs all siacoin and siafund inputs of the transaction with the
+// keys, one signature per input covering the whole transaction. It
+// returns an error matching ErrNoKey (see errors.Is) if an input belongs
+// to an address without key and ErrNotStandard if an input has other
+// unlock conditions than standard single-signature ones; the
+// transaction is not changed then. The transaction must be complete,
+// since changes invalidate the signatures.
+func Sign(tx *types.Transaction, keys []Key) error {
+	byAddress := make(map[types.UnlockHash]Key, len(keys))
+	for _, key := range keys {
+		byAddress[key.Address] = key
+	}
+	var parents []crypto.Hash
+	var conditions []types.UnlockConditions
+	for _, input := range tx.SiacoinInputs {
+		parents = append(parents, crypto.Hash(input.ParentID))
+		conditions = append(conditions, input.UnlockConditions)
+	}
+	for _, input := range tx.SiafundInputs {
+		parents = append(parents, crypto.Hash(input.ParentID))
+		conditions = append(conditions, input.UnlockConditions)
+	}
+	var signers []Key
+	for i, uc := range conditions {
+		key, has := byAddress[uc.UnlockHash()]
+		if !has {
+			return fmt.Errorf("input %d: %w", i, ErrNoKey)
+		}
+		if !isStandard(uc) {
+			return fmt.Errorf("input %d: %w", i, ErrNotStandard)
+		}
+		signers = append(signers, key)
+	}
+	first := len(tx.TransactionSignatures)
+	for i := range signers {
+		tx.TransactionSignatures = append(tx.TransactionSignatures, types.TransactionSignature{
+			ParentID:       parents[i],
+			PublicKeyIndex: 0,
+			CoveredFields:  WholeTransaction(),
+		})
+	}
+	// The hash of a signature covering the whole transaction includes
+	// the fields of the signature itself, but no other signatures, so
+	// all of them are added before signing.
+	for i, key := range signers {
+		sig := crypto.SignHash(tx.SigHash(first+i), key.SecretKey)
+		tx.TransactionSignatures[first+i].Signature = sig[:]
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package wallet helps SPV wallets based on Sia seeds: it derives
+// addresses of the seed, finds used ones using a sialite server and signs
+// transactions (see txbuilder).
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+)
+
+// DEFAULT_GAP_LIMIT is the number of consecutive unused addresses
+// after which scanning stops.
+const DEFAULT_GAP_LIMIT = 50
+
+// Key is a key derived from the seed, the same way siad does it.
+type Key struct {
+	Index            uint64
+	SecretKey        crypto.SecretKey
+	UnlockConditions types.UnlockConditions
+	Address          types.UnlockHash
+}
+
+// DeriveKey returns the key of the seed with given index.
+func DeriveKey(seed modules.Seed, index uint64) Key {
+	sk, pk := crypto.GenerateKeyPairDeterministic(crypto.HashAll(seed, index))
+	uc := types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{types.Ed25519PublicKey(pk)},
+		SignaturesRequired: 1,
+	}
+	return Key{
+		Index:            index,
+		SecretKey:        sk,
+		UnlockConditions: uc,
+		Address:          uc.UnlockHash(),
+	}
+}
+
+// Checker checks if the address appears in the blockchain.
+type Checker interface {
+	Used(address types.UnlockHash) (bool, error)
+}
+
+// ServerChecker checks addresses using local cache.Server.
+type ServerChecker struct {
+	Server *cache.Server
+}
+
+func (c ServerChecker) Used(address types.UnlockHash) (bool, error) {
+	history, _, err := c.Server.GetHistory(address[:], "")
+	if err != nil {
+		return false, err
+	}
+	return len(history) != 0, nil
+}
+
+func (c ServerChecker) Balance(address types.UnlockHash) (siacoins, siafunds types.Currency, err error) {
+	return c.Server.GetBalanceAt(address, c.Server.TipHeight())
+}
+
+// HTTPChecker checks addresses using /v1/history of sialite server.
+type HTTPChecker struct {
+	// URL of the server, e.g. "http://localhost:35813".
+	URL string
+
+	Client *http.Client
+}
+
+func (c HTTPChecker) Used(address types.UnlockHash) (bool, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(c.URL + "/v1/history?address=" + cache.FormatAddress(address))
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("GET /v1/history: %s", resp.Status)
+	}
+}
+
+// Balance returns the balance using /v1/balance of sialite server.
+func (c HTTPChecker) Balance(address types.UnlockHash) (siacoins, siafunds types.Currency, err error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(c.URL + "/v1/balance?address=" + cache.FormatAddress(address))
+	if err != nil {
+		return siacoins, siafunds, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return siacoins, siafunds, fmt.Errorf("GET /v1/balance: %s", resp.Status)
+	}
+	var balance struct {
+		Siacoins cache.Amount `json:"siacoins"`
+		Siafunds string       `json:"siafunds"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&balance); err != nil {
+		return siacoins, siafunds, fmt.Errorf("decoding /v1/balance: %v", err)
+	}
+	if siacoins, err = cache.ParseHastings(balance.Siacoins.Hastings); err != nil {
+		return siacoins, siafunds, err
+	}
+	if siafunds, err = cache.ParseHastings(balance.Siafunds); err != nil {
+		return siacoins, siafunds, err
+	}
+	return siacoins, siafunds, nil
+}
+
+type ScanResult struct {
+	// Used lists indices of used addresses.
+	Used []uint64
+
+	// Next is the index following the last used address.
+	Next uint64
+}
+
+// Scan derives addresses of the seed and checks them until gapLimit
+// consecutive addresses are unused.
+func Scan(seed modules.Seed, checker Checker, gapLimit int) (ScanResult, error) {
+	return scan(func(index uint64) types.UnlockHash {
+		return DeriveKey(seed, index).Address
+	}, checker, gapLimit)
+}
+
+func scan(derive func(index uint64) types.UnlockHash, checker Checker, gapLimit int) (ScanResult, error) {
+	var result ScanResult
+	for index := uint64(0); index < result.Next+uint64(gapLimit); index++ {
+		address := derive(index)
+		used, err := checker.Used(address)
+		if err != nil {
+			return result, fmt.Errorf("checking address %d (%s): %v", index, cache.FormatAddress(address), err)
+		}
+		if used {
+			result.Used = append(result.Used, index)
+			result.Next = index + 1
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,268 @@
+package wallet
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/entropy-mnemonics"
+	"github.com/starius/sialite/api"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/cache/cachetest"
+)
+
+type usedSet map[types.UnlockHash]bool
+
+func (s usedSet) Used(address types.UnlockHash) (bool, error) {
+	return s[address], nil
+}
+
+func fakeAddress(index uint64) types.UnlockHash {
+	var uh types.UnlockHash
+	binary.LittleEndian.PutUint64(uh[:], index+1)
+	return uh
+}
+
+func TestScan(t *testing.T) {
+	cases := []struct {
+		used     []uint64
+		gapLimit int
+		want     []uint64
+		wantNext uint64
+	}{
+		{nil, 5, nil, 0},
+		{[]uint64{0}, 5, []uint64{0}, 1},
+		{[]uint64{0, 4, 9}, 5, []uint64{0, 4, 9}, 10},
+		{[]uint64{0, 4, 10}, 5, []uint64{0, 4}, 5},
+		{[]uint64{5}, 5, nil, 0},
+		{[]uint64{5}, 6, []uint64{5}, 6},
+	}
+	for _, c := range cases {
+		set := make(usedSet)
+		for _, index := range c.used {
+			set[fakeAddress(index)] = true
+		}
+		result, err := scan(fakeAddress, set, c.gapLimit)
+		if err != nil {
+			t.Errorf("scan(%v, %d): %v", c.used, c.gapLimit, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.Used, c.want) || result.Next != c.wantNext {
+			t.Errorf("scan(%v, %d) = %v, %d; want %v, %d", c.used, c.gapLimit, result.Used, result.Next, c.want, c.wantNext)
+		}
+	}
+}
+
+// fakeWatcher reports 1 hasting and 2 siafunds for used addresses.
+type fakeWatcher struct {
+	usedSet
+}
+
+func (w fakeWatcher) Balance(address types.UnlockHash) (siacoins, siafunds types.Currency, err error) {
+	return types.NewCurrency64(1), types.NewCurrency64(2), nil
+}
+
+func TestDescriptor(t *testing.T) {
+	var seed modules.Seed
+	seed[0] = 1
+	phrase, err := modules.SeedToString(seed, mnemonics.English)
+	if err != nil {
+		t.Fatalf("modules.SeedToString: %v", err)
+	}
+	cold := cache.FormatAddress(fakeAddress(100))
+	d, err := ParseDescriptor([]byte(`{"entries": [
+		{"label": "cold", "addresses": ["` + cold + `"]},
+		{"label": "main", "seed": "` + phrase + `", "start": 2, "count": 3}
+	]}`))
+	if err != nil {
+		t.Fatalf("ParseDescriptor: %v", err)
+	}
+	for _, bad := range []string{
+		`{"entries": [{"addresses": ["` + cold + `"]}]}`,
+		`{"entries": [{"label": "a", "addresses": ["` + cold[:64] + `"]}]}`,
+		`{"entries": [{"label": "a", "count": 3}]}`,
+		`{"entries": [{"label": "a", "seed": "x", "count": 1000000}]}`,
+	} {
+		if _, err := ParseDescriptor([]byte(bad)); err == nil {
+			t.Errorf("ParseDescriptor(%s) succeeded", bad)
+		}
+	}
+	dir, err := ioutil.TempDir("", "TestDescriptor")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wallet.json")
+	if err := d.Save(path); err == nil {
+		t.Errorf("Save succeeded with a seed")
+	}
+	if err := d.Expand(); err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	main := d.Entries[1]
+	if main.Seed != "" || len(main.Addresses) != 3 || main.Addresses[0] != cache.FormatAddress(DeriveKey(seed, 2).Address) {
+		t.Errorf("Expand: got entry %+v", main)
+	}
+	// Importing the same addresses does not duplicate them.
+	if err := d.Import(&Descriptor{Entries: []DescriptorEntry{{Label: "cold", Addresses: []string{cold}}}}); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(d.Entries) != 2 || len(d.Entries[0].Addresses) != 1 {
+		t.Errorf("Import duplicated addresses: %+v", d.Entries)
+	}
+	if err := d.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if d, err = LoadDescriptor(path); err != nil {
+		t.Fatalf("LoadDescriptor: %v", err)
+	}
+	watcher := fakeWatcher{usedSet{
+		fakeAddress(100):           true,
+		DeriveKey(seed, 2).Address: true,
+		DeriveKey(seed, 4).Address: true,
+	}}
+	reports, err := Watch(d, watcher)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	want := []struct {
+		label           string
+		addresses, used int
+	}{
+		{"cold", 1, 1},
+		{"main", 3, 2},
+	}
+	if len(reports) != len(want) {
+		t.Fatalf("Watch returned %d reports, want %d", len(reports), len(want))
+	}
+	for i, w := range want {
+		r := reports[i]
+		if r.Label != w.label || r.Addresses != w.addresses || r.Used != w.used {
+			t.Errorf("report %d = %+v, want %+v", i, r, w)
+		}
+		if r.Siacoins.Cmp(types.NewCurrency64(uint64(w.used))) != 0 || r.Siafunds.Cmp(types.NewCurrency64(uint64(2*w.used))) != 0 {
+			t.Errorf("report %d has balance %s, %s", i, r.Siacoins, r.Siafunds)
+		}
+	}
+}
+
+func serveBlocks(t *testing.T, blocks []*types.Block) *httptest.Server {
+	s := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	return httptest.NewServer(api.NewHandler(s, api.Options{}))
+}
+
+func TestSyncHeaders(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	// The fork replaces blocks after 500.
+	fork := append([]*types.Block(nil), blocks[:500]...)
+	for i := 0; i < 10; i++ {
+		parent := fork[len(fork)-1]
+		fork = append(fork, &types.Block{
+			ParentID:  parent.ID(),
+			Timestamp: parent.Timestamp + 1,
+		})
+	}
+	main := serveBlocks(t, blocks)
+	defer main.Close()
+	forked := serveBlocks(t, fork)
+	defer forked.Close()
+	dir, err := ioutil.TempDir("", "TestSyncHeaders")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "headers")
+	clock := cache.FixedClock(blocks[len(blocks)-1].Timestamp)
+	hs, err := OpenHeaderStore(file, clock)
+	if err != nil {
+		t.Fatalf("OpenHeaderStore: %v", err)
+	}
+	check := func(blocks []*types.Block) {
+		if hs.Height() != len(blocks) || hs.Tip().LastID != blocks[len(blocks)-1].ID() {
+			t.Errorf("store has %d headers, tip %s; want %d, %s", hs.Height(), hs.Tip().LastID, len(blocks), blocks[len(blocks)-1].ID())
+		}
+	}
+	if n, err := SyncHeaders(nil, main.URL, hs); err != nil || n != len(blocks) {
+		t.Fatalf("SyncHeaders returned %d, %v", n, err)
+	}
+	check(blocks)
+	// Nothing to download.
+	if n, err := SyncHeaders(nil, main.URL, hs); err != nil || n != 0 {
+		t.Fatalf("SyncHeaders returned %d, %v", n, err)
+	}
+	// Reorg.
+	if _, err := SyncHeaders(nil, forked.URL, hs); err != nil {
+		t.Fatalf("SyncHeaders: %v", err)
+	}
+	check(fork)
+	if err := hs.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// A partial header is removed on open.
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("os.OpenFile: %v", err)
+	}
+	f.Write(make([]byte, cache.HEADER_SIZE/2))
+	f.Close()
+	if hs, err = OpenHeaderStore(file, clock); err != nil {
+		t.Fatalf("OpenHeaderStore: %v", err)
+	}
+	defer hs.Close()
+	check(fork)
+	if err := hs.Truncate(100); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	check(blocks[:100])
+}
+
+func TestSign(t *testing.T) {
+	var seed modules.Seed
+	key1, key2, other := DeriveKey(seed, 1), DeriveKey(seed, 2), DeriveKey(seed, 3)
+	tx := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: types.SiacoinOutputID{1}, UnlockConditions: key1.UnlockConditions},
+			{ParentID: types.SiacoinOutputID{2}, UnlockConditions: key2.UnlockConditions},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Value: types.SiacoinPrecision, UnlockHash: other.Address},
+		},
+	}
+	unsigned := tx
+	if err := Sign(&tx, []Key{key1, key2}); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if len(tx.TransactionSignatures) != 2 {
+		t.Fatalf("got %d signatures, want 2", len(tx.TransactionSignatures))
+	}
+	if err := tx.StandaloneValid(0); err != nil {
+		t.Errorf("StandaloneValid: %v", err)
+	}
+	// The first input is valid, but the transaction is not changed.
+	if err := Sign(&unsigned, []Key{key1}); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Sign without a key of an input: got %v, want %v", err, ErrNoKey)
+	}
+	if len(unsigned.TransactionSignatures) != 0 {
+		t.Errorf("Sign failed, but added %d signatures", len(unsigned.TransactionSignatures))
+	}
+	multisig := unsigned
+	multisig.SiacoinInputs = []types.SiacoinInput{unsigned.SiacoinInputs[0], unsigned.SiacoinInputs[1]}
+	multisig.SiacoinInputs[1].UnlockConditions.SignaturesRequired = 2
+	key2.Address = multisig.SiacoinInputs[1].UnlockConditions.UnlockHash()
+	if err := Sign(&multisig, []Key{key1, key2}); !errors.Is(err, ErrNotStandard) {
+		t.Errorf("Sign of a multisig input: got %v, want %v", err, ErrNotStandard)
+	}
+	if len(multisig.TransactionSignatures) != 0 {
+		t.Errorf("Sign failed, but added %d signatures", len(multisig.TransactionSignatures))
+	}
+}
@@ -0,0 +1,367 @@
+// Package webhook notifies registered URLs about confirmed items
+// of addresses when new blocks are indexed. Hooks are persisted
+// to disk, so they survive restarts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/NebulousLabs/fastrand"
+	"github.com/starius/sialite/cache"
+)
+
+// MaxAddresses is the max number of addresses of a hook.
+const MaxAddresses = 100
+
+// DeliveryTimeout is the timeout of POST requests to hooks made by the
+// default client of Manager.
+const DeliveryTimeout = 30 * time.Second
+
+var (
+	ErrNoHook         = fmt.Errorf("no such webhook")
+	ErrHostNotAllowed = fmt.Errorf("host of webhook URL is not allowed")
+)
+
+// Hook is a registered webhook.
+type Hook struct {
+	ID               string
+	URL              string
+	Addresses        []types.UnlockHash
+	MinConfirmations int
+
+	// Notified is the number of blocks of the index covered by
+	// delivered notifications. Items of later blocks are sent when
+	// they get MinConfirmations.
+	Notified int
+}
+
+// Notification is the Sia-encoded body POSTed to the URL of a hook.
+// Items are returned by cache.Server.GetHistory and include Merkle
+// proofs; Items[i] belongs to Addresses[i].
+type Notification struct {
+	Hook      string
+	Blocks    int // Number of blocks in the index.
+	Addresses []types.UnlockHash
+	Items     []cache.Item
+}
+
+// Manager keeps webhooks and delivers notifications.
+// It is safe for concurrent use.
+type Manager struct {
+	mu           sync.Mutex
+	hooks        map[string]*Hook
+	path         string
+	client       *http.Client
+	allowedHosts map[string]bool
+
+	// notifyMu serializes Notify calls.
+	notifyMu sync.Mutex
+
+	// pending is the latest index passed to Updated and not notified
+	// yet. delivering is true while the goroutine of Updated runs.
+	pendingMu  sync.Mutex
+	pending    *cache.Server
+	delivering bool
+}
+
+// Open loads webhooks from the file (creating it if needed).
+// If client is nil, a client with DeliveryTimeout is used.
+func Open(path string, client *http.Client) (*Manager, error) {
+	if client == nil {
+		client = &http.Client{Timeout: DeliveryTimeout}
+	}
+	m := &Manager{
+		hooks:  make(map[string]*Hook),
+		path:   path,
+		client: client,
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		var hooks []*Hook
+		if err := json.Unmarshal(data, &hooks); err != nil {
+			return nil, fmt.Errorf("loading %s: %v", path, err)
+		}
+		for _, h := range hooks {
+			m.hooks[h.ID] = h
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return m, nil
+}
+
+// save writes all hooks to a new file and replaces the old one.
+// It must be called with mu held.
+func (m *Manager) save() error {
+	hooks := make([]*Hook, 0, len(m.hooks))
+	for _, h := range m.hooks {
+		hooks = append(hooks, h)
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].ID < hooks[j].ID
+	})
+	data, err := json.MarshalIndent(hooks, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmpPath := m.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, m.path)
+}
+
+// confirmedEnd returns the number of first blocks of the index whose
+// items have at least minConfirmations.
+func confirmedEnd(nblocks, minConfirmations int) int {
+	if minConfirmations < 1 {
+		// Every indexed item has at least one confirmation.
+		minConfirmations = 1
+	}
+	end := nblocks - minConfirmations + 1
+	if end < 0 {
+		end = 0
+	}
+	return end
+}
+
+// SetAllowedHosts restricts URLs of new hooks to the hosts (compared
+// with url.URL.Hostname, case-insensitive). If hosts is empty, any host
+// is allowed, so callers of Register must be trusted: the server sends
+// requests to the URLs, which may be internal addresses.
+func (m *Manager) SetAllowedHosts(hosts []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allowedHosts = nil
+	if len(hosts) != 0 {
+		m.allowedHosts = make(map[string]bool, len(hosts))
+		for _, host := range hosts {
+			m.allowedHosts[strings.ToLower(host)] = true
+		}
+	}
+}
+
+// HasAllowedHosts returns if URLs of new hooks are restricted by
+// SetAllowedHosts.
+func (m *Manager) HasAllowedHosts() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.allowedHosts != nil
+}
+
+// Register adds a webhook. Only items of blocks added to the index
+// after registration are sent; nblocks is the current number of blocks.
+func (m *Manager) Register(hookURL string, addresses []types.UnlockHash, minConfirmations, nblocks int) (*Hook, error) {
+	u, err := url.Parse(hookURL)
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse(%q): %v", hookURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("bad scheme of webhook URL: %q", u.Scheme)
+	}
+	if !m.hostAllowed(u.Hostname()) {
+		return nil, fmt.Errorf("%v: %q", ErrHostNotAllowed, u.Hostname())
+	}
+	if len(addresses) == 0 || len(addresses) > MaxAddresses {
+		return nil, fmt.Errorf("want from 1 to %d addresses, got %d", MaxAddresses, len(addresses))
+	}
+	if minConfirmations < 0 {
+		return nil, fmt.Errorf("negative min confirmations: %d", minConfirmations)
+	}
+	h := &Hook{
+		ID:               hex.EncodeToString(fastrand.Bytes(16)),
+		URL:              hookURL,
+		Addresses:        addresses,
+		MinConfirmations: minConfirmations,
+		Notified:         confirmedEnd(nblocks, minConfirmations),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks[h.ID] = h
+	if err := m.save(); err != nil {
+		delete(m.hooks, h.ID)
+		return nil, err
+	}
+	hook := *h
+	return &hook, nil
+}
+
+func (m *Manager) hostAllowed(host string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.allowedHosts == nil || m.allowedHosts[strings.ToLower(host)]
+}
+
+// Remove removes the webhook.
+func (m *Manager) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, has := m.hooks[id]
+	if !has {
+		return ErrNoHook
+	}
+	delete(m.hooks, id)
+	if err := m.save(); err != nil {
+		m.hooks[id] = h
+		return err
+	}
+	return nil
+}
+
+// Hooks returns copies of all webhooks.
+func (m *Manager) Hooks() []Hook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hooks := make([]Hook, 0, len(m.hooks))
+	for _, h := range m.hooks {
+		hooks = append(hooks, *h)
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].ID < hooks[j].ID
+	})
+	return hooks
+}
+
+// Notify sends items of s which got enough confirmations since the last
+// notification of each hook. If delivery fails, the items are sent again
+// by the next call. Call it (or Updated) when the index is updated.
+func (m *Manager) Notify(ctx context.Context, s *cache.Server) {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	for _, h := range m.Hooks() {
+		end := confirmedEnd(s.NumBlocks(), h.MinConfirmations)
+		if end <= h.Notified {
+			continue
+		}
+		n, err := collect(s, &h, end)
+		if err != nil {
+			log.Printf("Webhook %s: %v.", h.ID, err)
+			continue
+		}
+		if len(n.Items) != 0 {
+			if err := m.post(ctx, h.URL, n); err != nil {
+				log.Printf("Webhook %s: %v.", h.ID, err)
+				continue
+			}
+		}
+		m.mu.Lock()
+		if stored, has := m.hooks[h.ID]; has {
+			stored.Notified = end
+			if err := m.save(); err != nil {
+				log.Printf("Saving webhooks: %v.", err)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Updated schedules Notify with s in a background goroutine and returns
+// at once, so slow hooks do not delay updates of the index. If Notify
+// is in progress, only the latest index passed to Updated is notified
+// after it. s is pinned (see cache.Server.Acquire) until it is notified
+// or replaced by a later index.
+func (m *Manager) Updated(s *cache.Server) {
+	if !s.Acquire() {
+		return
+	}
+	m.pendingMu.Lock()
+	defer m.pendingMu.Unlock()
+	if m.pending != nil {
+		m.pending.Release()
+	}
+	m.pending = s
+	if !m.delivering {
+		m.delivering = true
+		go m.deliver()
+	}
+}
+
+func (m *Manager) deliver() {
+	for {
+		m.pendingMu.Lock()
+		s := m.pending
+		m.pending = nil
+		if s == nil {
+			m.delivering = false
+			m.pendingMu.Unlock()
+			return
+		}
+		m.pendingMu.Unlock()
+		m.Notify(context.Background(), s)
+		if err := s.Release(); err != nil {
+			log.Printf("Closing the old index: %v.", err)
+		}
+	}
+}
+
+// collect returns items of blocks [h.Notified, end) of the addresses.
+// Items of other addresses sharing the prefix are skipped.
+func collect(s *cache.Server, h *Hook, end int) (*Notification, error) {
+	n := &Notification{
+		Hook:   h.ID,
+		Blocks: s.NumBlocks(),
+	}
+	for _, address := range h.Addresses {
+		cursor, err := s.HistoryCursorAt(address[:], s.StartHeight()+h.Notified)
+		if err != nil {
+			return nil, fmt.Errorf("HistoryCursorAt(%s): %v", cache.FormatAddress(address), err)
+		}
+		// Items are in the order of blocks.
+		for cursor != "" {
+			page, err := s.GetHistoryPage(address[:], cursor, cache.MAX_HISTORY_SIZE)
+			if err != nil {
+				return nil, fmt.Errorf("GetHistoryPage(%s): %v", cache.FormatAddress(address), err)
+			}
+			cursor = page.Next
+			for _, item := range page.Items {
+				if item.Block >= end {
+					cursor = ""
+					break
+				}
+				if item.Block >= h.Notified && item.Verified {
+					n.Addresses = append(n.Addresses, address)
+					n.Items = append(n.Items, item)
+				}
+			}
+		}
+	}
+	return n, nil
+}
+
+func (m *Manager) post(ctx context.Context, hookURL string, n *Notification) error {
+	var buf bytes.Buffer
+	if err := encoding.NewEncoder(&buf).Encode(n); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", hookURL, &buf)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Sialite-Webhook", n.Hook)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s", hookURL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+	"github.com/starius/sialite/cache"
+	"github.com/starius/sialite/cache/cachetest"
+)
+
+func TestConfirmedEnd(t *testing.T) {
+	cases := []struct {
+		nblocks, minConfirmations, want int
+	}{
+		{100, 0, 100},
+		{100, 1, 100},
+		{100, 6, 95},
+		{3, 6, 0},
+		{0, 0, 0},
+	}
+	for _, c := range cases {
+		if got := confirmedEnd(c.nblocks, c.minConfirmations); got != c.want {
+			t.Errorf("confirmedEnd(%d, %d) = %d, want %d", c.nblocks, c.minConfirmations, got, c.want)
+		}
+	}
+}
+
+func TestRegisterPersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestRegisterPersists")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "webhooks.json")
+	m, err := Open(path, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	addresses := []types.UnlockHash{{1, 2, 3}}
+	if _, err := m.Register("ftp://example.com/", addresses, 6, 100); err == nil {
+		t.Errorf("Register accepted ftp URL")
+	}
+	if _, err := m.Register("https://example.com/", nil, 6, 100); err == nil {
+		t.Errorf("Register accepted empty list of addresses")
+	}
+	h1, err := m.Register("https://example.com/1", addresses, 6, 100)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if h1.Notified != 95 {
+		t.Errorf("Notified = %d, want 95", h1.Notified)
+	}
+	h2, err := m.Register("https://example.com/2", addresses, 0, 100)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := m.Remove(h1.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := m.Remove(h1.ID); err != ErrNoHook {
+		t.Errorf("Remove of removed hook: want ErrNoHook, got %v", err)
+	}
+	m2, err := Open(path, nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	hooks := m2.Hooks()
+	if len(hooks) != 1 || hooks[0].ID != h2.ID || hooks[0].URL != h2.URL || hooks[0].Addresses[0] != addresses[0] {
+		t.Errorf("Hooks() after reopening = %v, want [%v]", hooks, *h2)
+	}
+}
+
+// fullHistory returns IDs of all items of the address.
+func fullHistory(t *testing.T, s *cache.Server, address types.UnlockHash) []string {
+	var ids []string
+	cursor := ""
+	for {
+		page, err := s.GetHistoryPage(address[:], cursor, cache.MAX_HISTORY_SIZE)
+		if err != nil {
+			t.Fatalf("GetHistoryPage: %v", err)
+		}
+		for _, item := range page.Items {
+			if item.Verified {
+				ids = append(ids, item.ID)
+			}
+		}
+		if page.Next == "" {
+			return ids
+		}
+		cursor = page.Next
+	}
+}
+
+func TestNotifyAllPages(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	addresses, err := cachetest.ReadUnlockHashes()
+	if err != nil {
+		t.Fatalf("cachetest.ReadUnlockHashes: %v", err)
+	}
+	const split = 600
+	s1 := cachetest.BuildServer(t, cachetest.Parameters(), blocks[:split])
+	s2 := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	// The address with the longest history, split by both indices.
+	var address types.UnlockHash
+	var want []string
+	for _, a := range addresses {
+		ids := fullHistory(t, s2, a)
+		if len(ids) > len(want) && len(fullHistory(t, s1, a)) < len(ids) {
+			address, want = a, ids
+		}
+	}
+	if len(want) <= cache.MAX_HISTORY_SIZE {
+		t.Fatalf("no address with more than %d items", cache.MAX_HISTORY_SIZE)
+	}
+
+	var mu sync.Mutex
+	var got []string
+	hookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		if err := encoding.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("decoding notification: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for i, item := range n.Items {
+			if n.Addresses[i] != address {
+				t.Errorf("item %s of address %s", item.ID, cache.FormatAddress(n.Addresses[i]))
+			}
+			got = append(got, item.ID)
+		}
+	}))
+	defer hookServer.Close()
+
+	dir, err := ioutil.TempDir("", "TestNotifyAllPages")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := Open(filepath.Join(dir, "webhooks.json"), nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	h, err := m.Register(hookServer.URL, []types.UnlockHash{address}, 0, 0)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	m.Notify(context.Background(), s1)
+	m.Notify(context.Background(), s2)
+	// Nothing is sent again.
+	m.Notify(context.Background(), s2)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != len(want) {
+		t.Fatalf("delivered %d items, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("item %d: got %s, want %s", i, got[i], want[i])
+		}
+	}
+	if hooks := m.Hooks(); len(hooks) != 1 || hooks[0].ID != h.ID || hooks[0].Notified != len(blocks) {
+		t.Errorf("Hooks() = %v, want Notified = %d", hooks, len(blocks))
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestAllowedHosts")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := Open(filepath.Join(dir, "webhooks.json"), nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if m.client.Timeout != DeliveryTimeout {
+		t.Errorf("timeout of the default client = %v, want %v", m.client.Timeout, DeliveryTimeout)
+	}
+	if m.HasAllowedHosts() {
+		t.Errorf("HasAllowedHosts() = true by default")
+	}
+	m.SetAllowedHosts([]string{"Hooks.example.com"})
+	if !m.HasAllowedHosts() {
+		t.Errorf("HasAllowedHosts() = false after SetAllowedHosts")
+	}
+	addresses := []types.UnlockHash{{1, 2, 3}}
+	for _, u := range []string{
+		"http://127.0.0.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"https://example.com/",
+		"https://hooks.example.com.evil.com/",
+	} {
+		if _, err := m.Register(u, addresses, 0, 100); err == nil {
+			t.Errorf("Register(%q) succeeded", u)
+		}
+	}
+	if _, err := m.Register("https://hooks.example.com:8443/sia", addresses, 0, 100); err != nil {
+		t.Errorf("Register of allowed host: %v", err)
+	}
+	m.SetAllowedHosts(nil)
+	if _, err := m.Register("http://127.0.0.1/", addresses, 0, 100); err != nil {
+		t.Errorf("Register without allowed hosts: %v", err)
+	}
+}
+
+func TestUpdatedDoesNotWaitForHooks(t *testing.T) {
+	blocks, err := cachetest.ReadBlocks()
+	if err != nil {
+		t.Fatalf("cachetest.ReadBlocks: %v", err)
+	}
+	addresses, err := cachetest.ReadUnlockHashes()
+	if err != nil {
+		t.Fatalf("cachetest.ReadUnlockHashes: %v", err)
+	}
+	s := cachetest.BuildServer(t, cachetest.Parameters(), blocks)
+	release := make(chan struct{})
+	posted := make(chan struct{}, 10)
+	hookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted <- struct{}{}
+		<-release
+	}))
+	defer hookServer.Close()
+	defer close(release)
+	dir, err := ioutil.TempDir("", "TestUpdatedDoesNotWaitForHooks")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := Open(filepath.Join(dir, "webhooks.json"), nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := m.Register(hookServer.URL, addresses, 0, 0); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		m.Updated(s)
+		m.Updated(s)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Updated waits for the hook")
+	}
+	select {
+	case <-posted:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the hook is not notified")
+	}
+}